@@ -34,10 +34,11 @@
 // The metadata mirror pauses while a scan runs, because both spend the same
 // one-request-per-second MusicBrainz budget and the scan is the one with a user
 // attached. Nothing here touches that budget: images come from the artwork hosts'
-// own throttle (~2 req/s per host, modules.artworkRateLimit), and the only disk this
-// writes is config/artwork/. Yielding would buy a scan nothing measurable and would
-// make the case this exists for — an artist added mid-scan whose covers a user is
-// about to want — the slowest one.
+// own throttle (~2 req/s per host, modules.artworkRateLimit), and the disk it writes
+// is config/artwork/ plus, for a library that opted in, a few image files beside the
+// audio — never the audio itself. Yielding would buy a scan nothing measurable and
+// would make the case this exists for — an artist added mid-scan whose covers a user
+// is about to want — the slowest one.
 package artwork
 
 import (
@@ -50,9 +51,11 @@ import (
 
 	"github.com/aunefyren/autotaggerr/components"
 	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/files"
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/quiet"
 	"gorm.io/gorm"
 )
 
@@ -222,6 +225,9 @@ type Summary struct {
 	// monogram tiles.
 	Missing int `json:"missing"`
 	Errors  int `json:"errors"`
+	// Sidecars is the image files written into library folders, for the libraries
+	// that asked for them (see sidecars.go).
+	Sidecars int `json:"sidecars"`
 
 	LastError string `json:"last_error,omitempty"`
 
@@ -245,12 +251,15 @@ type Result struct {
 	Fresh   int
 	Missing int
 	Errors  int
+	// Sidecars counts image files written into library folders.
+	Sidecars int
 
 	LastError string
 
-	// Items is the per-image detail, and holds **failures only**. A row per coverless
-	// album would be thousands of rows saying nothing happened, and "no image" is the
-	// ordinary outcome this pass exists to record cheaply.
+	// Items is the per-image detail, and holds failures and the sidecars written. A
+	// row per coverless album would be thousands of rows saying nothing happened, and
+	// "no image" is the ordinary outcome this pass exists to record cheaply; a file
+	// that appeared in someone's library is the opposite, and gets its row.
 	Items      []models.EventItem
 	ItemsTotal int
 
@@ -288,9 +297,23 @@ type Runner struct {
 	hooks   Targets
 	full    bool
 	force   bool
+	// fullUnattended says the queued pass is the cron's, which quiet hours hold back;
+	// deferredUntil is the window end its deferral was recorded against, and recheck
+	// the timer that wakes the worker to look again.
+	fullUnattended bool
+	deferredUntil  time.Time
+	recheck        *time.Timer
 
 	wake chan struct{}
 
+	// quietHours holds back the scheduled pass, and pauses one running at its next
+	// sidecar when a window opens (see queue.go). nil is never quiet. passUnattended
+	// is whether the pass running is the cron's, and passEvent its Activity event,
+	// which a pause is recorded under.
+	quietHours     *quiet.Hours
+	passUnattended atomic.Bool
+	passEvent      *models.Event
+
 	running atomic.Bool
 
 	statusMu sync.Mutex
@@ -320,6 +343,7 @@ func newRunner(db *gorm.DB, cfg models.ConfigStruct) *Runner {
 		db:              db,
 		providers:       components.ArtworkProviders,
 		wake:            make(chan struct{}, 1),
+		quietHours:      quiet.New(func() string { return files.ConfigFile.AutotaggerrQuietHours }),
 		eventRetention:  retentionOrDefault(cfg.AutotaggerrEventRetention, models.DefaultEventRetention),
 		detailRetention: retentionOrDefault(cfg.AutotaggerrEventDetailRetention, models.DefaultEventDetailRetention),
 	}
@@ -439,6 +463,9 @@ func summaryLine(res Result, took time.Duration) string {
 	if res.Missing > 0 {
 		line += fmt.Sprintf(", %d with no image available", res.Missing)
 	}
+	if res.Sidecars > 0 {
+		line += fmt.Sprintf(", %d sidecar(s) written", res.Sidecars)
+	}
 	if res.Errors > 0 {
 		line += fmt.Sprintf(", %d failed", res.Errors)
 	}
@@ -462,6 +489,7 @@ func (r *Runner) record(ev *models.Event, started, finished time.Time, res Resul
 		"fresh":     res.Fresh,
 		"missing":   res.Missing,
 		"errors":    res.Errors,
+		"sidecars":  res.Sidecars,
 		"cancelled": cancelled,
 		"detail": map[string]any{
 			"recorded": len(res.Items),
@@ -478,6 +506,7 @@ func (r *Runner) record(ev *models.Event, started, finished time.Time, res Resul
 		{Label: "Fetched", Value: res.Fetched},
 		{Label: "Already cached", Value: res.Fresh, Kind: models.EventStatMuted},
 		{Label: "No image available", Value: res.Missing, Kind: models.EventStatMuted},
+		{Label: "Sidecars written", Value: res.Sidecars, Filter: models.EventItemStatusChanged},
 		{Label: "Failed", Value: res.Errors, Kind: models.EventStatBad, Filter: models.EventItemStatusError},
 	}
 
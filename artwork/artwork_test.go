@@ -16,6 +16,7 @@ import (
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/quiet"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -320,7 +321,7 @@ func TestPendingTargetsAreDrainedDuringAPass(t *testing.T) {
 	// Queued before the pass starts, so the first boundary check picks it up.
 	r.Warm(nil, []string{groupF})
 
-	res, cancelled := r.execute(context.Background(), providers, []unit{coverUnit(groupG)}, false)
+	res, cancelled := r.execute(context.Background(), providers, Targets{}, []unit{coverUnit(groupG)}, false)
 	if cancelled {
 		t.Fatal("pass reported itself cancelled")
 	}
@@ -340,7 +341,7 @@ func TestCancelledPassStopsEarly(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
-	res, cancelled := r.execute(ctx, providers, []unit{coverUnit(groupA)}, false)
+	res, cancelled := r.execute(ctx, providers, Targets{}, []unit{coverUnit(groupA)}, false)
 	if !cancelled {
 		t.Error("a cancelled pass did not report itself cancelled")
 	}
@@ -356,12 +357,30 @@ func TestQueuedForceIsSticky(t *testing.T) {
 	r.RefreshCollection(true)
 	r.RefreshCollection(false)
 
-	queued, force := r.takeFull()
+	queued, force, _ := r.takeFull()
 	if !queued || !force {
 		t.Errorf("queued = %v force = %v, want both true", queued, force)
 	}
 }
 
+// The cron's pass waits out quiet hours; pressing the button takes it over.
+func TestQuietHoursDeferTheScheduledPass(t *testing.T) {
+	r := newRunner(nil, models.ConfigStruct{})
+	r.quietHours = quiet.New(func() string { return "00:00-12:00, 12:00-00:00" })
+
+	r.RefreshCollectionOnSchedule()
+	if !r.deferFull() {
+		t.Fatal("the scheduled pass was not deferred in quiet hours")
+	}
+	r.RefreshCollection(false)
+	if r.deferFull() {
+		t.Error("a pass somebody asked for was deferred")
+	}
+	if queued, _, unattended := r.takeFull(); !queued || unattended {
+		t.Errorf("queued = %v unattended = %v, want a queued pass that is no longer the cron's", queued, unattended)
+	}
+}
+
 // The disabled switch governs unattended work, and the create hooks are the half that
 // is easy to forget: the cron job is gated where it is installed, so without this a
 // user who turned artwork off would still see it fetch every time an album arrived.
@@ -381,7 +400,7 @@ func TestDisabledStopsTheCreateHooks(t *testing.T) {
 	// not gated: a control that silently did nothing because of a setting on another
 	// page is the worse failure.
 	r.RefreshCollection(false)
-	if queued, _ := r.takeFull(); !queued {
+	if queued, _, _ := r.takeFull(); !queued {
 		t.Error("the manual refresh was swallowed by the disabled switch")
 	}
 
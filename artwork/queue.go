@@ -2,6 +2,7 @@ package artwork
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/aunefyren/autotaggerr/events"
@@ -9,6 +10,7 @@ import (
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/quiet"
 )
 
 // The queue is what lets one runner serve two very differently shaped requests: a
@@ -33,6 +35,17 @@ import (
 // here rather than in the caller because every caller would otherwise need its own
 // copy of it — the hook sites are spread across collection's create paths and none of
 // them knows what the others are doing.
+//
+// # Quiet hours hold back the scheduled pass
+//
+// The cron's pass is unattended, and while it is quiet (package quiet) it is left
+// queued, with its deferral recorded in the feed, until the window ends. A pass that
+// is running when a window opens pauses before its next sidecar: the image cache lives
+// under config/ and is nobody's media, but a cover.jpg appearing in an album folder is
+// a change the media server rescans for. A pass somebody pressed the button for is not
+// held, and neither is targeted work — it follows a row being created, which in quiet
+// hours is somebody doing something, since the scheduled scans that create rows on
+// their own are held back themselves.
 
 // Warm queues artwork for entities that just entered the collection. It returns
 // immediately: the caller is a database write path, and *Add artist* must not take
@@ -92,6 +105,25 @@ func (r *Runner) RefreshCollection(force bool) {
 	// A queued pass that anyone asked to force stays forced. Two presses where one
 	// ticked the box must not resolve to the cheap reading of the expensive request.
 	r.force = r.force || force
+	// And one somebody asked for is no longer the cron's, so quiet hours let it run.
+	r.fullUnattended = false
+	r.queueMu.Unlock()
+
+	r.nudge()
+}
+
+// RefreshCollectionOnSchedule is RefreshCollection for the cron: never forced, and
+// held back by quiet hours. A pass somebody already queued by hand stays theirs.
+func (r *Runner) RefreshCollectionOnSchedule() {
+	if r == nil {
+		return
+	}
+
+	r.queueMu.Lock()
+	if !r.full {
+		r.full = true
+		r.fullUnattended = true
+	}
 	r.queueMu.Unlock()
 
 	r.nudge()
@@ -116,13 +148,82 @@ func (r *Runner) takeHooks() Targets {
 	return pending
 }
 
-// takeFull removes and returns the queued collection-wide request, if any.
-func (r *Runner) takeFull() (queued, force bool) {
+// takeFull removes and returns the queued collection-wide request, if any, and whether
+// it is the cron's.
+func (r *Runner) takeFull() (queued, force, unattended bool) {
 	r.queueMu.Lock()
 	defer r.queueMu.Unlock()
-	queued, force = r.full, r.force
-	r.full, r.force = false, false
-	return queued, force
+	queued, force, unattended = r.full, r.force, r.fullUnattended
+	r.full, r.force, r.fullUnattended = false, false, false
+	r.deferredUntil = time.Time{}
+	return queued, force, unattended
+}
+
+// deferFull reports whether the queued pass is held back by quiet hours. The first
+// time in a window it records the deferral, and each time it arms a timer to wake the
+// worker — at the window end, or sooner so a shortened window is noticed.
+func (r *Runner) deferFull() bool {
+	r.queueMu.Lock()
+	unattended := r.full && r.fullUnattended
+	r.queueMu.Unlock()
+	if !unattended {
+		return false
+	}
+	until, held := r.quietHours.Until()
+	if !held {
+		return false
+	}
+
+	r.queueMu.Lock()
+	fresh := !r.deferredUntil.Equal(until)
+	r.deferredUntil = until
+	if r.recheck != nil {
+		r.recheck.Stop()
+	}
+	r.recheck = time.AfterFunc(min(time.Until(until), quiet.RecheckInterval), r.nudge)
+	r.queueMu.Unlock()
+
+	if fresh {
+		logger.Log.Infof("quiet hours until %s; deferring the scheduled artwork refresh", until.Format("15:04"))
+		ev := events.Begin(r.db, models.EventTypeQuietHours, "Deferred: Artwork refresh")
+		events.Finish(r.db, ev, models.EventStatusOK, "Waits for quiet hours to end at "+until.Format("15:04"), map[string]any{
+			"until": until,
+		})
+	}
+	return true
+}
+
+// holdForQuietHours pauses a scheduled pass while it is quiet, before it writes the
+// next sidecar; any other pass returns at once. The pause is recorded under the pass's
+// event. It returns ctx's error if the pass is stopped while paused.
+func (r *Runner) holdForQuietHours(ctx context.Context) error {
+	if !r.passUnattended.Load() {
+		return nil
+	}
+	until, held := r.quietHours.Until()
+	if !held {
+		return nil
+	}
+
+	logger.Log.Infof("quiet hours until %s; pausing the artwork refresh before its next sidecar", until.Format("15:04"))
+	started := time.Now()
+	pause := events.BeginChild(r.db, r.passEvent, models.EventTypeQuietHours, "Paused for quiet hours")
+	for held {
+		timer := time.NewTimer(min(time.Until(until), quiet.RecheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			events.Finish(r.db, pause, models.EventStatusCancelled, "Stopped while paused for quiet hours", nil)
+			return ctx.Err()
+		case <-timer.C:
+		}
+		until, held = r.quietHours.Until()
+	}
+	paused := time.Since(started).Round(time.Second)
+	events.Finish(r.db, pause, models.EventStatusOK, fmt.Sprintf("Paused for %s", paused), map[string]any{
+		"paused": paused.String(),
+	})
+	return nil
 }
 
 // worker drains the queue for the life of the process. Targeted work first, then the
@@ -135,13 +236,18 @@ func (r *Runner) worker() {
 				r.run(pending, false, false)
 				continue
 			}
-			if queued, force := r.takeFull(); queued {
+			if r.deferFull() {
+				break
+			}
+			if queued, force, unattended := r.takeFull(); queued {
 				targets, err := CollectionTargets(r.db)
 				if err != nil {
 					logger.Log.Warnf("could not enumerate artwork targets: %s", err.Error())
 					continue
 				}
+				r.passUnattended.Store(unattended)
 				r.run(targets, force, true)
+				r.passUnattended.Store(false)
 				continue
 			}
 			break
@@ -152,7 +258,8 @@ func (r *Runner) worker() {
 // run executes one target set.
 //
 // scheduled says this is the collection-wide pass, which always records an Activity
-// event. A targeted warm records one **only if it actually fetched an image**:
+// event. A targeted warm records one **only if it actually fetched an image** or
+// wrote a sidecar:
 // adding twenty artists should not put twenty rows in the feed, and a warm that found
 // everything already cached did nothing worth reading about. Real work and real
 // failures still surface.
@@ -195,9 +302,11 @@ func (r *Runner) run(targets Targets, force, scheduled bool) {
 	if scheduled {
 		ev = events.Begin(r.db, models.EventTypeArtwork, title)
 		stopProgress = events.StartProgress(r.db, ev, r.Progress)
+		r.passEvent = ev
+		defer func() { r.passEvent = nil }()
 	}
 
-	res, cancelled := r.execute(ctx, providers, units, force)
+	res, cancelled := r.execute(ctx, providers, targets, units, force)
 
 	if stopProgress != nil {
 		stopProgress()
@@ -211,7 +320,7 @@ func (r *Runner) run(targets Targets, force, scheduled bool) {
 	r.statusMu.Unlock()
 
 	if !scheduled {
-		if res.Fetched == 0 && res.Errors == 0 {
+		if res.Fetched == 0 && res.Errors == 0 && res.Sidecars == 0 {
 			return
 		}
 		ev = events.Begin(r.db, models.EventTypeArtwork, title)
@@ -219,8 +328,9 @@ func (r *Runner) run(targets Targets, force, scheduled bool) {
 	r.record(ev, started, finished, res, cancelled, summary.Total, summary.Done)
 }
 
-// execute warms every unit, draining newly-notified targets first at each boundary.
-func (r *Runner) execute(ctx context.Context, providers modules.ArtworkProviders, units []unit, force bool) (Result, bool) {
+// execute warms every unit, draining newly-notified targets first at each boundary,
+// then writes the sidecars for everything it covered.
+func (r *Runner) execute(ctx context.Context, providers modules.ArtworkProviders, targets Targets, units []unit, force bool) (Result, bool) {
 	res := Result{detailLimit: r.detailRetention}
 
 	for _, u := range units {
@@ -229,7 +339,7 @@ func (r *Runner) execute(ctx context.Context, providers modules.ArtworkProviders
 		}
 		// New rows jump the queue. Checked per image rather than per pass, because
 		// the pass is the thing that would otherwise make them wait.
-		r.drainPending(ctx, providers, &res)
+		targets.merge(r.drainPending(ctx, providers, &res))
 		if ctx.Err() != nil {
 			return res, true
 		}
@@ -239,34 +349,38 @@ func (r *Runner) execute(ctx context.Context, providers modules.ArtworkProviders
 	}
 
 	// Anything that arrived during the final image still belongs to this pass.
-	r.drainPending(ctx, providers, &res)
-	return res, false
+	targets.merge(r.drainPending(ctx, providers, &res))
+
+	r.writeSidecars(ctx, providers, targets, &res)
+	return res, ctx.Err() != nil
 }
 
 // drainPending warms whatever row creation notified about since the last check,
-// folding it into the running pass's counters.
+// folding it into the running pass's counters, and returns what it took so the pass
+// writes those entities' sidecars too.
 //
 // Never forced, whatever the surrounding pass is doing: these are entities that were
 // created seconds ago and cannot have a stale cached copy, so re-downloading them
 // would spend a transfer to replace an image with itself.
-func (r *Runner) drainPending(ctx context.Context, providers modules.ArtworkProviders, res *Result) {
+func (r *Runner) drainPending(ctx context.Context, providers modules.ArtworkProviders, res *Result) Targets {
 	pending := r.takeHooks()
 	if pending.Empty() {
-		return
+		return pending
 	}
 	extra := plan(providers, pending)
 	if len(extra) == 0 {
-		return
+		return pending
 	}
 
 	r.setStatus(func(s *Summary) { s.Total += len(extra) })
 	for _, u := range extra {
 		if ctx.Err() != nil {
-			return
+			return pending
 		}
 		r.warmOne(providers, u, false, res, true)
 		r.setStatus(func(s *Summary) { s.Done++ })
 	}
+	return pending
 }
 
 // Progress reads the live counters for the event-progress flusher.
@@ -0,0 +1,389 @@
+package artwork
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/collection"
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"gorm.io/gorm"
+)
+
+// Sidecars are the images a media server reads out of the library itself. Plex,
+// Jellyfin and Navidrome all look for cover.jpg beside an album's tracks and
+// artist.jpg in the artist's folder before they look anywhere else, and a library
+// that has none leaves each of them to find its own — usually a worse scan, and
+// never the one the rest of Autotaggerr shows.
+//
+// # Only what is ours
+//
+// A library folder is the user's. A sidecar is written where the slot is empty, and
+// replaced only while its bytes are still exactly what Autotaggerr wrote there —
+// models.ArtworkSidecar keeps the hash. A cover.jpg that was there first, or one of
+// ours that someone has since swapped for a better scan, is theirs from then on and
+// is never touched, not even to bring it up to date.
+//
+// The slot is judged by every name a player reads for it, in any case and either
+// extension: a folder with its own Folder.JPG already has a cover, and writing a
+// cover.jpg beside it would quietly change which one the server picks.
+//
+// # Why this rides the artwork refresh
+//
+// The images are already here: the pass that warms a row's thumbnail is the pass
+// that knows the entity just entered the collection, and the cache it fills is what
+// the sidecar is copied from. The cover is the one exception in size — a player
+// shows it full-screen, so it is the 1200px thumbnail rather than the row's 250.
+//
+// The cover is the folder's edition's, not the album's: the files in the folder embed
+// their release's front cover, and a cover.jpg showing the group's — the original
+// pressing's, say, beside a remaster's tracks — would disagree with them. The group's
+// cover stands in only where the release has none of its own.
+
+// sidecarCoverSize is the cover edge written beside the tracks: the largest the Cover
+// Art Archive serves as a thumbnail.
+const sidecarCoverSize = 1200
+
+// sidecar is one image slot in a library folder.
+type sidecar struct {
+	// name is written with the image's own extension; others are the names a user's
+	// own image for the same slot goes by.
+	name   string
+	others []string
+
+	kind string
+	size int
+}
+
+var (
+	coverSidecar  = sidecar{"cover", []string{"folder"}, modules.ArtworkKindFront, sidecarCoverSize}
+	artistSidecar = sidecar{"artist", nil, modules.ArtworkKindThumb, 0}
+	fanartSidecar = sidecar{"fanart", []string{"backdrop"}, modules.ArtworkKindBackground, 0}
+)
+
+// imageSource is an entity a sidecar's image may come from. A slot is given its
+// sources in order, and the first that has an image fills it.
+type imageSource struct {
+	entity string
+	mbid   string
+}
+
+// sidecarExtension is the extension an image is written under. Anything but JPEG and
+// PNG is skipped rather than written: no player reads cover.webp.
+func sidecarExtension(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/jpeg"):
+		return ".jpg"
+	case strings.HasPrefix(contentType, "image/png"):
+		return ".png"
+	}
+	return ""
+}
+
+// holds reports whether a file name fills this slot.
+func (s sidecar) holds(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return false
+	}
+	base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if strings.EqualFold(base, s.name) {
+		return true
+	}
+	for _, other := range s.others {
+		if strings.EqualFold(base, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSidecars places the sidecars for one pass's targets, in the folders of every
+// library that asked for them.
+//
+// It runs after the images are warmed, so the common case copies from the cache. A
+// pass over a collection no library writes sidecars for costs one count query, which
+// is why that check comes before resolving a single folder.
+func (r *Runner) writeSidecars(ctx context.Context, providers modules.ArtworkProviders, targets Targets, res *Result) {
+	if r.db == nil || targets.Empty() {
+		return
+	}
+	var enabled int64
+	if err := r.db.Model(&models.Library{}).Where("write_artwork_sidecars = ?", true).Count(&enabled).Error; err != nil {
+		logger.Log.Warnf("could not read the sidecar setting: %s", err.Error())
+		return
+	}
+	if enabled == 0 {
+		return
+	}
+
+	if components.CanServeArtistImages(providers) {
+		for _, id := range targets.Artists {
+			if ctx.Err() != nil || r.holdForQuietHours(ctx) != nil {
+				return
+			}
+			folders, err := collection.ArtistTargets(r.db, id)
+			if err != nil {
+				r.sidecarFailed(res, id, models.EventItemKindEntity, err)
+				continue
+			}
+			for _, folder := range folders {
+				// Depth one only: ArtistTargets falls back to a file's own folder when
+				// the layout does not fit, and an artist.jpg in an album folder or the
+				// library root would be read as something it is not.
+				if !folder.Library.WriteArtworkSidecars || folderDepth(folder) != 1 {
+					continue
+				}
+				artist := []imageSource{{modules.ArtworkEntityArtist, id}}
+				r.placeSidecar(providers, folder.Path, artistSidecar, artist, res)
+				r.placeSidecar(providers, folder.Path, fanartSidecar, artist, res)
+			}
+		}
+	}
+
+	if components.CanServeCovers(providers) {
+		for _, id := range targets.Groups {
+			if ctx.Err() != nil || r.holdForQuietHours(ctx) != nil {
+				return
+			}
+			folders, err := collection.ReleaseGroupTargets(r.db, id)
+			if err != nil {
+				r.sidecarFailed(res, id, models.EventItemKindEntity, err)
+				continue
+			}
+			releases, err := folderReleases(r.db, id)
+			if err != nil {
+				r.sidecarFailed(res, id, models.EventItemKindEntity, err)
+				continue
+			}
+			for _, folder := range folders {
+				// An album folder, or a disc folder under one. A cover.jpg in an artist
+				// folder would become that artist's picture.
+				if !folder.Library.WriteArtworkSidecars || folderDepth(folder) < 2 {
+					continue
+				}
+				var sources []imageSource
+				if release := releases[folder.Path]; release != "" {
+					sources = append(sources, imageSource{modules.ArtworkEntityRelease, release})
+				}
+				sources = append(sources, imageSource{modules.ArtworkEntityReleaseGroup, id})
+				r.placeSidecar(providers, folder.Path, coverSidecar, sources, res)
+			}
+		}
+	}
+}
+
+// folderReleases maps each folder holding a release group's files to the edition
+// they are tagged with. A folder that mixes editions gets the one most of its files
+// carry, the lower MBID on a tie, so the same folder always gets the same cover.
+func folderReleases(db *gorm.DB, releaseGroupMBID string) (map[string]string, error) {
+	items, err := collection.ReleaseGroupItems(db, releaseGroupMBID)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]map[string]int{}
+	for _, item := range items {
+		folder := filepath.Dir(item.Path)
+		if counts[folder] == nil {
+			counts[folder] = map[string]int{}
+		}
+		counts[folder][item.MBReleaseID]++
+	}
+	releases := make(map[string]string, len(counts))
+	for folder, editions := range counts {
+		best := ""
+		for release, n := range editions {
+			if best == "" || n > editions[best] || (n == editions[best] && release < best) {
+				best = release
+			}
+		}
+		releases[folder] = best
+	}
+	return releases, nil
+}
+
+// folderDepth is how far below its library root a folder sits: 0 for the root, 1 for
+// an artist folder, 2 for an album. -1 means it is not under the root at all.
+func folderDepth(target collection.ArtistTarget) int {
+	rel, err := filepath.Rel(target.Library.Path, target.Path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return -1
+	}
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// placeSidecar fills one slot in one folder, if the slot is empty or ours.
+func (r *Runner) placeSidecar(providers modules.ArtworkProviders, dir string, s sidecar, sources []imageSource, res *Result) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		r.sidecarFailed(res, dir, models.EventItemKindSidecar, err)
+		return
+	}
+	// Every file already in the slot must be ours before anything is fetched: one that
+	// is not means the slot is the user's, and the image would go unused.
+	var ours []string
+	current := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !s.holds(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		sum, owned, err := r.ownsSidecar(path)
+		if err != nil {
+			r.sidecarFailed(res, path, models.EventItemKindSidecar, err)
+			return
+		}
+		if !owned {
+			return
+		}
+		ours = append(ours, path)
+		current[path] = sum
+	}
+
+	var art modules.Artwork
+	for _, source := range sources {
+		art, err = modules.GetArtwork(providers, source.entity, source.mbid, s.kind, s.size)
+		if !isNoArtwork(err) {
+			break
+		}
+	}
+	if isNoArtwork(err) {
+		return
+	}
+	if err != nil {
+		r.sidecarFailed(res, filepath.Join(dir, s.name+".jpg"), models.EventItemKindSidecar, err)
+		return
+	}
+	ext := sidecarExtension(art.ContentType)
+	if ext == "" {
+		logger.Log.Debugf("not writing a %s sidecar in %s: %s is not a format players read", s.name, dir, art.ContentType)
+		return
+	}
+
+	target := filepath.Join(dir, s.name+ext)
+	digest := sha256.Sum256(art.Data)
+	sum := hex.EncodeToString(digest[:])
+	if current[target] == sum {
+		return
+	}
+
+	if err := writeSidecarFile(target, art.Data); err != nil {
+		r.sidecarFailed(res, target, models.EventItemKindSidecar, err)
+		return
+	}
+	if err := r.rememberSidecar(target, sum); err != nil {
+		// The image is written but not recorded, so the next pass will read it as the
+		// user's and leave it be — the safe way round for this to fail.
+		logger.Log.Warnf("wrote %s but could not record it: %s", target, err.Error())
+	}
+
+	// A PNG that became a JPEG, say: the old file was ours, and leaving it would put
+	// two covers in the slot.
+	for _, path := range ours {
+		if path == target {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Log.Warnf("could not remove the replaced sidecar %s: %s", path, err.Error())
+			continue
+		}
+		r.db.Where("path = ?", path).Delete(&models.ArtworkSidecar{})
+	}
+
+	res.Sidecars++
+	r.setStatus(func(s *Summary) { s.Sidecars++ })
+	res.note(models.EventItem{
+		Path:   target,
+		Kind:   models.EventItemKindSidecar,
+		Status: models.EventItemStatusChanged,
+	})
+}
+
+// ownsSidecar reports whether a file is one Autotaggerr wrote and nobody has changed
+// since, along with the hash of what it holds now.
+func (r *Runner) ownsSidecar(path string) (sum string, owned bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	digest := sha256.Sum256(data)
+	sum = hex.EncodeToString(digest[:])
+
+	var rows []models.ArtworkSidecar
+	if err := r.db.Where("path = ?", path).Limit(1).Find(&rows).Error; err != nil {
+		return sum, false, err
+	}
+	return sum, len(rows) == 1 && rows[0].SHA256 == sum, nil
+}
+
+func (r *Runner) rememberSidecar(path, sum string) error {
+	var row models.ArtworkSidecar
+	if err := r.db.Where("path = ?", path).Limit(1).Find(&row).Error; err != nil {
+		return err
+	}
+	if row.Path == "" {
+		return r.db.Create(&models.ArtworkSidecar{Path: path, SHA256: sum}).Error
+	}
+	return r.db.Model(&row).Update("sha256", sum).Error
+}
+
+// writeSidecarFile writes through a temporary name and a rename, so a media server
+// scanning the folder mid-write never reads half an image — and a pass killed
+// mid-write never leaves one behind for the next pass to mistake for the user's.
+func writeSidecarFile(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".autotaggerr-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	// CreateTemp's 0600 would hide the image from a media server running as
+	// somebody else.
+	if err := temp.Chmod(0o644); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+// sidecarFailed records a sidecar that could not be written. The pass carries on, as
+// it does for an image that would not download.
+func (r *Runner) sidecarFailed(res *Result, path, kind string, err error) {
+	message := fmt.Sprintf("sidecar %s: %s", path, err.Error())
+	logger.Log.Warnf("artwork refresh failed for %s", message)
+	res.Errors++
+	res.LastError = message
+	res.note(models.EventItem{
+		Path:   path,
+		Kind:   kind,
+		Status: models.EventItemStatusError,
+		Error:  err.Error(),
+	})
+	r.setStatus(func(s *Summary) {
+		s.Errors++
+		s.LastError = message
+	})
+}
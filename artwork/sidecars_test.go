@@ -0,0 +1,227 @@
+package artwork
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/collection"
+	"github.com/aunefyren/autotaggerr/models"
+	"gorm.io/gorm"
+)
+
+const (
+	sidecarArtist  = "99999999-9999-4999-8999-999999999999"
+	sidecarGroup   = "aaaaaaaa-aaaa-4aaa-8aaa-aaaaaaaaaaaa"
+	sidecarRelease = "bbbbbbbb-bbbb-4bbb-8bbb-bbbbbbbbbbbb"
+)
+
+// sidecarLibrary seeds a library at a temporary root holding one album of one track,
+// laid out the way the pipeline assumes, and returns the album folder.
+func sidecarLibrary(t *testing.T, db *gorm.DB, enabled bool) string {
+	t.Helper()
+	root := t.TempDir()
+	album := filepath.Join(root, "Talk Talk", "Spirit of Eden")
+	if err := os.MkdirAll(album, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	library := models.Library{Name: "Music", Path: root, Enabled: true, WriteArtworkSidecars: enabled}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatalf("seed library: %v", err)
+	}
+	for _, row := range []any{
+		&models.CollectionRelease{MBID: sidecarRelease, ReleaseGroupMBID: sidecarGroup, ArtistMBID: sidecarArtist},
+		&models.LibraryItem{LibraryID: library.ID, Path: filepath.Join(album, "01.flac"), MBReleaseID: sidecarRelease, Status: models.LibraryItemStatusOK},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	return album
+}
+
+func sidecarItems(t *testing.T, db *gorm.DB) []models.EventItem {
+	t.Helper()
+	var items []models.EventItem
+	if err := db.Where("kind = ?", models.EventItemKindSidecar).Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestSidecarCoverIsWrittenOnceAndReported(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := testDB(t)
+	album := sidecarLibrary(t, db, true)
+	providers, _ := coverServer(t, servesJPEG)
+	r := runnerFor(t, db, providers)
+
+	r.run(Targets{Groups: []string{sidecarGroup}}, false, false)
+
+	cover := filepath.Join(album, "cover.jpg")
+	if data, err := os.ReadFile(cover); err != nil || !bytes.Equal(data, jpeg) {
+		t.Fatalf("cover.jpg = %q, %v", data, err)
+	}
+	if info, _ := os.Stat(cover); info.Mode().Perm() != 0o644 {
+		t.Errorf("cover.jpg mode = %v; a media server running as someone else must be able to read it", info.Mode().Perm())
+	}
+	items := sidecarItems(t, db)
+	if len(items) != 1 || items[0].Path != cover || items[0].Status != models.EventItemStatusChanged {
+		t.Fatalf("sidecar rows = %+v, want one for %s", items, cover)
+	}
+	entries, _ := os.ReadDir(album)
+	if len(entries) != 1 {
+		t.Errorf("the album folder holds %d entries, want only cover.jpg", len(entries))
+	}
+
+	// The same image again is nothing to write, and nothing to report.
+	r.run(Targets{Groups: []string{sidecarGroup}}, false, false)
+	if got := len(sidecarItems(t, db)); got != 1 {
+		t.Errorf("%d sidecar rows after an unchanged pass, want 1", got)
+	}
+}
+
+// The cover beside the tracks is their edition's, which is what they embed; the
+// album's stands in only for an edition the Cover Art Archive has no cover for.
+func TestSidecarCoverIsTheFoldersRelease(t *testing.T) {
+	edition := append(append([]byte{}, jpeg...), "edition"...)
+	for _, tc := range []struct {
+		name       string
+		hasRelease bool
+		want       []byte
+	}{
+		{"the release's own cover", true, edition},
+		{"the group's when the release has none", false, jpeg},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			db := testDB(t)
+			album := sidecarLibrary(t, db, true)
+			providers, _ := coverServer(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.Contains(r.URL.Path, "/release/"+sidecarRelease+"/"):
+					if !tc.hasRelease {
+						http.NotFound(w, r)
+						return
+					}
+					w.Write(edition)
+				case strings.Contains(r.URL.Path, "/release-group/"+sidecarGroup+"/"):
+					w.Write(jpeg)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			r := runnerFor(t, db, providers)
+
+			var res Result
+			r.writeSidecars(t.Context(), providers, Targets{Groups: []string{sidecarGroup}}, &res)
+
+			if data, err := os.ReadFile(filepath.Join(album, "cover.jpg")); err != nil || !bytes.Equal(data, tc.want) {
+				t.Errorf("cover.jpg = %q, %v; want %q", data, err, tc.want)
+			}
+		})
+	}
+}
+
+// A library folder is the user's: a cover that was there first, under any name a
+// player reads for the slot, or one of ours that they replaced, is left exactly as it is.
+func TestSidecarNeverReplacesTheUsersImage(t *testing.T) {
+	for _, name := range []string{"cover.jpg", "Folder.JPG", "cover.png"} {
+		t.Run(name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			db := testDB(t)
+			album := sidecarLibrary(t, db, true)
+			theirs := filepath.Join(album, name)
+			if err := os.WriteFile(theirs, []byte("their scan"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			providers, calls := coverServer(t, servesJPEG)
+			r := runnerFor(t, db, providers)
+			r.warmOne(providers, coverUnit(sidecarGroup), false, &Result{}, false)
+			before := *calls
+
+			var res Result
+			r.writeSidecars(t.Context(), providers, Targets{Groups: []string{sidecarGroup}}, &res)
+
+			if data, _ := os.ReadFile(theirs); string(data) != "their scan" {
+				t.Errorf("%s was changed", name)
+			}
+			if _, err := os.Stat(filepath.Join(album, "cover.jpg")); name != "cover.jpg" && err == nil {
+				t.Error("a cover.jpg was written beside the user's own cover")
+			}
+			if res.Sidecars != 0 || *calls != before {
+				t.Errorf("sidecars=%d requests=%d; a slot the user filled needs no image", res.Sidecars, *calls-before)
+			}
+		})
+	}
+}
+
+// Ours is judged by content: a sidecar still holding what was written is brought up to
+// date when the image changes upstream, and one that somebody edited is theirs.
+func TestSidecarIsOursOnlyWhileItsBytesAre(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := testDB(t)
+	album := sidecarLibrary(t, db, true)
+	providers, _ := coverServer(t, servesJPEG)
+	r := runnerFor(t, db, providers)
+	targets := Targets{Groups: []string{sidecarGroup}}
+	cover := filepath.Join(album, "cover.jpg")
+
+	// An older cover of ours: on disk and recorded with its own hash.
+	old := []byte("last month's cover")
+	digest := sha256.Sum256(old)
+	if err := os.WriteFile(cover, old, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.rememberSidecar(cover, hex.EncodeToString(digest[:])); err != nil {
+		t.Fatal(err)
+	}
+
+	var res Result
+	r.writeSidecars(t.Context(), providers, targets, &res)
+	if data, _ := os.ReadFile(cover); !bytes.Equal(data, jpeg) || res.Sidecars != 1 {
+		t.Fatalf("our own outdated sidecar was not replaced (sidecars=%d)", res.Sidecars)
+	}
+
+	if err := os.WriteFile(cover, []byte("a better scan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res = Result{}
+	r.writeSidecars(t.Context(), providers, targets, &res)
+	if data, _ := os.ReadFile(cover); string(data) != "a better scan" || res.Sidecars != 0 {
+		t.Errorf("an edited sidecar was overwritten (sidecars=%d)", res.Sidecars)
+	}
+}
+
+func TestSidecarsNeedTheLibraryOptionAndAnAlbumFolder(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db := testDB(t)
+	album := sidecarLibrary(t, db, false)
+	providers, _ := coverServer(t, servesJPEG)
+	r := runnerFor(t, db, providers)
+
+	var res Result
+	r.writeSidecars(t.Context(), providers, Targets{Groups: []string{sidecarGroup}}, &res)
+	if _, err := os.Stat(filepath.Join(album, "cover.jpg")); err == nil || res.Sidecars != 0 {
+		t.Error("a library that did not opt in got a sidecar")
+	}
+
+	root := filepath.Dir(filepath.Dir(album))
+	for path, want := range map[string]int{
+		root:                        0,
+		filepath.Dir(album):         1,
+		album:                       2,
+		filepath.Join(album, "CD1"): 3,
+		filepath.Dir(root):          -1,
+	} {
+		target := collection.ArtistTarget{Library: models.Library{Path: root}, Path: path}
+		if got := folderDepth(target); got != want {
+			t.Errorf("folderDepth(%s) = %d, want %d", path, got, want)
+		}
+	}
+}
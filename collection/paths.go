@@ -132,6 +132,17 @@ func ReleaseGroupItems(db *gorm.DB, releaseGroupMBID string) ([]models.LibraryIt
 	return items, err
 }
 
+// ReleaseItems returns the taggable files of one edition, by path.
+func ReleaseItems(db *gorm.DB, releaseMBID string) ([]models.LibraryItem, error) {
+	if db == nil || releaseMBID == "" {
+		return nil, nil
+	}
+	var items []models.LibraryItem
+	err := db.Where("mb_release_id = ?", releaseMBID).Scopes(models.TaggableItems).
+		Order("path").Find(&items).Error
+	return items, err
+}
+
 // disownedItems are the files the disk view deliberately drops: status `unmatched`
 // means the manager was asked and answered that it does not know this file, so no
 // owned edition is recorded for it and `collection_releases` has nothing to match on.
@@ -221,6 +232,26 @@ func ReleaseGroupTargets(db *gorm.DB, releaseGroupMBID string) ([]ArtistTarget,
 	if err != nil {
 		return nil, err
 	}
+	return folderTargets(db, items)
+}
+
+// ReleaseTargets is ReleaseGroupTargets for one edition: the folders its files sit in,
+// disowned ones included, for the same reason.
+func ReleaseTargets(db *gorm.DB, releaseMBID string) ([]ArtistTarget, error) {
+	items, err := ReleaseItems(db, releaseMBID)
+	if err != nil {
+		return nil, err
+	}
+	items, err = withDisowned(db, items, func(item models.LibraryItem) bool { return item.MBReleaseID == releaseMBID })
+	if err != nil {
+		return nil, err
+	}
+	return folderTargets(db, items)
+}
+
+// folderTargets is each file's own directory, once, with its library — the album-level
+// granularity the release-group and release scopes walk at.
+func folderTargets(db *gorm.DB, items []models.LibraryItem) ([]ArtistTarget, error) {
 	if len(items) == 0 {
 		return nil, nil
 	}
@@ -62,3 +62,14 @@ func CanServeCovers(providers modules.ArtworkProviders) bool {
 func CanServeArtistImages(providers modules.ArtworkProviders) bool {
 	return providers.FanartEnabled && strings.TrimSpace(providers.FanartAPIKey) != ""
 }
+
+// AcoustIDSource returns the enabled AcoustID data source, if one is configured.
+// No row means the feature was never set up, which is a normal state and not an
+// error — the first of the three switches that make fingerprinting detachable. It
+// lives here for the reason ArtworkProviders does: the identify endpoint and the
+// inbox import both ask it.
+func AcoustIDSource(db *gorm.DB) (models.DataSource, bool) {
+	var row models.DataSource
+	err := db.Where("type = ? AND enabled = ?", models.DataSourceTypeAcoustID, true).First(&row).Error
+	return row, err == nil
+}
@@ -156,6 +156,9 @@ func NewManager(row models.Manager) (Manager, error) {
 // built-in engine (modules' FLAC/MP3 writers); the profile only tunes it.
 type Tagger struct {
 	profile models.TaggerProfile
+	// artwork is where embedded covers come from. Resolved with the profile because
+	// both come out of the database, and Settings is where the writers see it.
+	artwork modules.ArtworkProviders
 }
 
 // NewTagger builds a Tagger from its profile row.
@@ -166,5 +169,28 @@ func NewTagger(profile models.TaggerProfile) *Tagger {
 // WriteEnabled reports whether this profile writes tags at all.
 func (t *Tagger) WriteEnabled() bool { return t.profile.WriteTags }
 
-// Settings is what the tag writers read: the profile's knobs, and nothing else.
-func (t *Tagger) Settings() models.TaggerSettings { return t.profile.Settings() }
+// Settings is what the tag writers read: the profile's knobs, plus the cover source
+// they embed from when the profile asks for covers.
+func (t *Tagger) Settings() models.TaggerSettings {
+	settings := t.profile.Settings()
+	settings.CoverArtEnabled = CanServeCovers(t.artwork)
+	settings.CoverArtBaseURL = t.artwork.CoverArtBaseURL
+	return settings
+}
+
+// ItemSettings is Settings for writing one indexed file: with the fields it has locked.
+func (t *Tagger) ItemSettings(item models.LibraryItem) models.TaggerSettings {
+	settings := t.Settings()
+	settings.LockedFields = item.LockedFields
+	return settings
+}
+
+// FileSettings is ItemSettings for a file known only by its path, as a walk knows it.
+// A file not indexed yet has nothing locked.
+func (t *Tagger) FileSettings(db *gorm.DB, path string) models.TaggerSettings {
+	var item models.LibraryItem
+	if err := db.Select("locked_fields").Where("path = ?", path).Limit(1).Find(&item).Error; err != nil {
+		logger.Log.Warnf("failed to read the locked fields of %q: %s", path, err.Error())
+	}
+	return t.ItemSettings(item)
+}
@@ -1,9 +1,12 @@
 package components
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
@@ -951,3 +954,80 @@ func TestRecordItemFailureRespectsPin(t *testing.T) {
 		t.Errorf("the pin was overwritten on the failure path: %+v", item)
 	}
 }
+
+// bareFlac writes a FLAC with nothing but a STREAMINFO block in front of bytes
+// standing in for the frames — a real enough file for the tag engine, which never
+// decodes audio, on a machine without ffmpeg.
+func bareFlac(t *testing.T) string {
+	t.Helper()
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:], 4096)
+	binary.BigEndian.PutUint16(streamInfo[2:], 4096)
+	binary.BigEndian.PutUint32(streamInfo[10:], 44100<<12|15<<4)
+	file := append([]byte("fLaC\x80\x00\x00\x22"), streamInfo...)
+	file = append(file, 0xff, 0xf8)
+	file = append(file, bytes.Repeat([]byte{0x5a}, 4000)...)
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// A backup restore or an rsync resets the mtime of files whose bytes never moved.
+// The skip check must see through that — otherwise every restore is a full
+// re-process — but not through a tag edit another tool made, which is the one change
+// in the same shape that it has to act on.
+func TestShouldSkipSeesThroughAResetMTime(t *testing.T) {
+	db := testDB(t)
+	library := models.Library{Name: "Test", Path: "/music"}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	path := bareFlac(t)
+	if _, _, _, err := modules.SetFileTags(path, models.FileTags{Title: "Intro"}, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFileTags: %v", err)
+	}
+	recordItem(db, library.ID, path, correlated(), false, "v-test", models.ManagerTypeAutotaggerr, nil)
+
+	var item models.LibraryItem
+	if err := db.Where("path = ?", path).First(&item).Error; err != nil {
+		t.Fatalf("item not recorded: %v", err)
+	}
+	if item.ContentHash == "" || item.TagStateHash == "" {
+		t.Fatalf("hashes not recorded: content=%q tags=%q", item.ContentHash, item.TagStateHash)
+	}
+
+	touched := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if !shouldSkip(db, path, "v-test", models.ManagerTypeAutotaggerr) {
+		t.Fatal("a file whose only change is its mtime was re-processed")
+	}
+	if err := db.Where("path = ?", path).First(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.ModTime == nil || item.ModTime.Unix() != touched.Unix() {
+		t.Errorf("mod_time = %v, want it restamped to %v so the next scan takes the cheap path", item.ModTime, touched)
+	}
+
+	// Another tagger edits the title in place, and a sync carries the edit over with
+	// the source's mtime.
+	if _, _, _, err := modules.SetFileTags(path, models.FileTags{Title: "Outro"}, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFileTags: %v", err)
+	}
+	synced := touched.Add(-time.Hour)
+	if err := os.Chtimes(path, synced, synced); err != nil {
+		t.Fatal(err)
+	}
+	if shouldSkip(db, path, "v-test", models.ManagerTypeAutotaggerr) {
+		t.Fatal("a file whose tags another tool edited was skipped")
+	}
+	if err := db.Where("path = ?", path).First(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.TagsEditedAt == nil {
+		t.Error("the outside edit was not recorded on the item")
+	}
+}
@@ -27,21 +27,44 @@ func ComputeItemDiff(db *gorm.DB, meta metadata.MetadataSource, item models.Libr
 		return nil, err
 	}
 
-	response, err := meta.GetRelease(item.MBReleaseID)
+	settings := tagger.ItemSettings(item)
+	desired, track, response, err := DesiredTags(meta, settings, item)
 	if err != nil {
 		return nil, err
 	}
+	// Measured gains only: a diff is a read, and decoding a page of files to render it
+	// is not one.
+	modules.MeasureReplayGain(&desired, item.Path, library.Path, track, response, settings, false)
+	return modules.DiffFileTags(item.Path, desired, settings)
+}
+
+// DesiredTags builds the tags the tagging path would write to one correlated file,
+// short of ReplayGain: the release is fetched through meta, the matched track found,
+// and its titles localized. The track and release are returned for callers that go on
+// to measure loudness. Renaming names files from these, so a file's path and its tags
+// always tell the same story.
+func DesiredTags(meta metadata.MetadataSource, settings models.TaggerSettings, item models.LibraryItem) (models.FileTags, models.Track, models.MusicBrainzReleaseResponse, error) {
+	if item.MBReleaseID == "" || item.MBReleaseTrackID == "" {
+		return models.FileTags{}, models.Track{}, models.MusicBrainzReleaseResponse{}, fmt.Errorf("this file has no MusicBrainz correlation yet — scan it first")
+	}
+	response, err := meta.GetRelease(item.MBReleaseID)
+	if err != nil {
+		return models.FileTags{}, models.Track{}, models.MusicBrainzReleaseResponse{}, err
+	}
 
 	for _, media := range response.Media {
 		for _, track := range media.Tracks {
 			if track.ID == item.MBReleaseTrackID {
-				desired, err := modules.BuildFileTags(track, media, response, tagger.Settings())
+				desired, err := modules.BuildFileTags(track, media, response, settings)
 				if err != nil {
-					return nil, err
+					return models.FileTags{}, track, response, err
+				}
+				if err := modules.LocalizeTitles(&desired, track, media, response, settings, meta.GetRelease); err != nil {
+					return models.FileTags{}, track, response, err
 				}
-				return modules.DiffFileTags(item.Path, desired, tagger.Settings())
+				return desired, track, response, nil
 			}
 		}
 	}
-	return nil, fmt.Errorf("matched track no longer present in the release data")
+	return models.FileTags{}, models.Track{}, response, fmt.Errorf("matched track no longer present in the release data")
 }
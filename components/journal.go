@@ -0,0 +1,107 @@
+package components
+
+import (
+	"time"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// journal is where a DetailCollector keeps the undo record of the writes it is told
+// about (models.TagJournalEntry), under the event whose rows they are.
+type journal struct {
+	db      *gorm.DB
+	eventID uuid.UUID
+}
+
+// Journal makes the collector keep an undo record of every tag write AddChanged is
+// given, under eventID, and returns it. The record is the collector's to keep because
+// the collector is already where every write of a run is reported, whichever path
+// made it; a collector without one journals nothing, which is what a caller with the
+// journal switched off wants. A nil db or event leaves the collector as it was.
+func (d *DetailCollector) Journal(db *gorm.DB, eventID uuid.UUID) *DetailCollector {
+	if d == nil || db == nil || eventID == uuid.Nil {
+		return d
+	}
+	d.journal = &journal{db: db, eventID: eventID}
+	return d
+}
+
+// record writes one file's entry. A file not yet in the index — a walk records its
+// row after tagging it — is journaled by path alone.
+func (j *journal) record(path string, changes []models.TagChange) {
+	if j == nil {
+		return
+	}
+	fields := JournalChanges(changes)
+	if len(fields) == 0 {
+		return
+	}
+	entry := models.TagJournalEntry{EventID: j.eventID, Path: path, Changes: fields}
+	var ids []uuid.UUID
+	if err := j.db.Model(&models.LibraryItem{}).Where("path = ?", path).Limit(1).Pluck("id", &ids).Error; err == nil && len(ids) == 1 {
+		entry.LibraryItemID = &ids[0]
+	}
+	RecordJournal(j.db, entry)
+}
+
+// JournalChanges keeps the fields of a write that can be put back: every one with its
+// raw values on either side. The cover row has neither and is dropped.
+func JournalChanges(changes []models.TagChange) []models.JournalChange {
+	var fields []models.JournalChange
+	for _, c := range changes {
+		if c.Before == nil && c.After == nil {
+			continue
+		}
+		fields = append(fields, models.JournalChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+	return fields
+}
+
+// RecordJournal stores one entry. Best effort, like the rest of Activity: a write the
+// journal missed cannot be rolled back, but it happened, and failing the file over its
+// undo record would report a file that was tagged as one that was not.
+func RecordJournal(db *gorm.DB, entry models.TagJournalEntry) {
+	if err := db.Create(&entry).Error; err != nil {
+		logger.Log.Warnf("failed to journal the tag write to %q: %s", entry.Path, err.Error())
+	}
+}
+
+// EventJournal selects the entries of an event and of its stages that no rollback
+// has dealt with, newest first — the order they are put back in, so a file written
+// twice in one run ends up as it was before the first write.
+func EventJournal(db *gorm.DB, eventID uuid.UUID) *gorm.DB {
+	stages := db.Model(&models.Event{}).Select("id").Where("parent_id = ?", eventID)
+	return db.Model(&models.TagJournalEntry{}).
+		Where("event_id = ? OR event_id IN (?)", eventID, stages).
+		Where("rolled_back_at IS NULL").
+		Order("created_at DESC, id DESC")
+}
+
+// ItemJournal selects one file's entries that no rollback has dealt with, newest
+// first, leaving out those a rollback wrote (see TagJournalEntry.Undoes). A file is
+// matched by its row, or by path where the entry was written before it had one.
+func ItemJournal(db *gorm.DB, item models.LibraryItem) *gorm.DB {
+	return db.Model(&models.TagJournalEntry{}).
+		Where("library_item_id = ? OR (library_item_id IS NULL AND path = ?)", item.ID, item.Path).
+		Where("rolled_back_at IS NULL AND undoes IS NULL").
+		Order("created_at DESC, id DESC")
+}
+
+// PruneJournal drops the entries older than days. Less than one day drops them all:
+// that is the journal switched off, and a rollback of whatever it held before would
+// reach back past anything the setting now promises.
+func PruneJournal(db *gorm.DB, days int) {
+	if db == nil {
+		return
+	}
+	q := db.Where("1 = 1")
+	if days > 0 {
+		q = db.Where("created_at < ?", time.Now().AddDate(0, 0, -days))
+	}
+	if err := q.Delete(&models.TagJournalEntry{}).Error; err != nil {
+		logger.Log.Warnf("failed to prune the tag journal: %s", err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package components
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+// TestJournalKeepsWhatCanBePutBack: a collector with a journal records every changed
+// field with its raw values — past the detail cap, which the journal does not share —
+// and leaves the cover row out, since a described picture cannot be restored.
+func TestJournalKeepsWhatCanBePutBack(t *testing.T) {
+	db := testDB(t)
+	eventID := uuid.New()
+	detail := NewDetailCollector(0).Journal(db, eventID)
+	detail.AddChanged("/music/a.flac", 2, []models.TagChange{
+		{Field: "TITLE", Old: "Old", New: "New", Before: []string{"Old"}, After: []string{"New"}},
+		{Field: "COVERART", Old: "none", New: "500x500 JPEG"},
+	})
+	detail.AddChanged("/music/b.flac", 1, []models.TagChange{{Field: "COVERART", New: "500x500 JPEG"}})
+
+	var entries []models.TagJournalEntry
+	if err := EventJournal(db, eventID).Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/music/a.flac" {
+		t.Fatalf("entries = %+v, want one for a.flac", entries)
+	}
+	if got := entries[0].Changes; len(got) != 1 || got[0].Field != "TITLE" || got[0].Before[0] != "Old" {
+		t.Errorf("changes = %+v", got)
+	}
+
+	old := models.TagJournalEntry{EventID: eventID, Path: "/music/c.flac"}
+	old.CreatedAt = time.Now().AddDate(0, 0, -40)
+	RecordJournal(db, old)
+	PruneJournal(db, 30)
+	var left int64
+	db.Model(&models.TagJournalEntry{}).Count(&left)
+	if left != 1 {
+		t.Errorf("%d entries after pruning to 30 days, want 1", left)
+	}
+	PruneJournal(db, 0)
+	db.Model(&models.TagJournalEntry{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d entries after switching the journal off, want 0", left)
+	}
+}
@@ -1,8 +1,11 @@
 package components
 
 import (
+	"context"
 	"errors"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +32,12 @@ type DetailCollector struct {
 	items   []models.EventItem
 	changed int // total changed files seen, including any past the limit
 	failed  int // total failed files seen, including any past the limit
+	// journal, when set, is where AddChanged keeps the undo record of each write.
+	// Unlike items it is never capped; see Journal.
+	journal *journal
+	// fields counts the files each tag would change on, for a dry run's summary
+	// (see AddWouldChange). Keyed in upper case, as the readers key a file's tags.
+	fields map[string]int
 }
 
 // NewDetailCollector returns a collector holding at most limit entries. A limit < 1
@@ -42,6 +51,9 @@ func (d *DetailCollector) AddChanged(path string, tagsWritten int, changes []mod
 	if d == nil {
 		return
 	}
+	// Outside the lock: it is a database write, and a pool of workers should not
+	// queue behind each other's.
+	d.journal.record(path, changes)
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.changed++
@@ -53,6 +65,51 @@ func (d *DetailCollector) AddChanged(path string, tagsWritten int, changes []mod
 	})
 }
 
+// AddWouldChange records a file a dry run would rewrite, with the changes it would
+// make. It counts as changed, so Totals reads the same for a dry run as for the run
+// it stands in for, and every field is counted towards TagSummary.
+func (d *DetailCollector) AddWouldChange(path string, changes []models.TagChange) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changed++
+	if d.fields == nil {
+		d.fields = map[string]int{}
+	}
+	for _, change := range changes {
+		d.fields[strings.ToUpper(change.Field)]++
+	}
+	d.append(models.EventItem{
+		Path:        path,
+		Status:      models.EventItemStatusWouldChange,
+		TagsWritten: len(changes),
+		Changes:     changes,
+	})
+}
+
+// TagSummary is how many files each tag would change on, across every file given to
+// AddWouldChange: most files first, then by tag.
+func (d *DetailCollector) TagSummary() []models.TagChangeCount {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	summary := make([]models.TagChangeCount, 0, len(d.fields))
+	for field, files := range d.fields {
+		summary = append(summary, models.TagChangeCount{Field: field, Files: files})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Files != summary[j].Files {
+			return summary[i].Files > summary[j].Files
+		}
+		return summary[i].Field < summary[j].Field
+	})
+	return summary
+}
+
 // AddError records a file that could not be processed.
 func (d *DetailCollector) AddError(path string, err error) {
 	if d == nil || err == nil {
@@ -68,6 +125,21 @@ func (d *DetailCollector) AddError(path string, err error) {
 	})
 }
 
+// AddSkipped records a file left as it was on purpose, with the reason. It counts as
+// neither changed nor failed.
+func (d *DetailCollector) AddSkipped(path, reason string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.append(models.EventItem{
+		Path:   path,
+		Status: models.EventItemStatusSkipped,
+		Error:  reason,
+	})
+}
+
 // Adopt folds another collector's rows into this one under the given phase, and adds
 // its totals to this one's. It is how a run's tagging stage reports both halves of what
 // it wrote — the files the walk found changed on disk, and the files re-tagged because
@@ -178,7 +250,7 @@ func ProcessFile(
 	unchanged = true // no tag write unless the profile enables it
 	if tagger.WriteEnabled() {
 		var changes []models.TagChange
-		unchanged, tagsWritten, changes, err = modules.TagResolvedFile(filePath, correlation, plexClient, refreshSet, rootDir, tagger.Settings())
+		unchanged, tagsWritten, changes, err = modules.TagResolvedFile(filePath, correlation, plexClient, refreshSet, rootDir, tagger.FileSettings(db, filePath))
 		if err != nil {
 			recordItem(db, library.ID, filePath, correlation, false, processedVersion, managerType, err)
 			detail.AddError(filePath, err)
@@ -206,7 +278,7 @@ func ScanLibrary(
 	processedVersion string,
 	workers int,
 ) (counter, unchangedFiles, tagsWritten int, errorFiles []string, err error) {
-	return ScanLibraryRoots(db, library, nil, plexClient, refreshSet, detail, processedVersion, workers, false, nil)
+	return ScanLibraryRoots(context.Background(), db, library, nil, plexClient, refreshSet, detail, processedVersion, modules.WalkLimits{Workers: workers}, false, nil, nil)
 }
 
 // ScanLibraryRoots is ScanLibrary narrowed to part of a library: it walks each of
@@ -220,8 +292,8 @@ func ScanLibrary(
 // root instead would make every file one segment too shallow and correlate the whole
 // scope to the wrong album.
 //
-// Roots are walked in sequence, each with the full worker pool, and their counters
-// summed. A root that no longer exists on disk is walked as an empty folder — the
+// Roots are walked in sequence, each under the full limits (see modules.WalkLimits),
+// and their counters summed. A root that no longer exists on disk is walked as an empty folder — the
 // zero counters that produces are the honest report for "the folder is gone", and it
 // keeps one stale target from abandoning the others.
 //
@@ -233,7 +305,14 @@ func ScanLibrary(
 // unchanged on disk. It exists for the manager repair path: a release selection
 // changed in Lidarr does not touch a byte on disk, so the only way to pull the new
 // correlation down onto already-tagged files is to ignore the skip cache for one run.
+//
+// ctx stops the walk between files (see WalkAndProcess). A cancelled scan returns the
+// counters for what it did get through, with ctx's error, and walks no further root.
+//
+// marks, keyed by root, is where each root's walk resumes and is recorded (see
+// modules.WalkMark). A root without one is walked from the top; nil walks them all so.
 func ScanLibraryRoots(
+	ctx context.Context,
 	db *gorm.DB,
 	library models.Library,
 	roots []string,
@@ -241,8 +320,9 @@ func ScanLibraryRoots(
 	refreshSet *modules.AlbumRefreshSet,
 	detail *DetailCollector,
 	processedVersion string,
-	workers int,
+	limits modules.WalkLimits,
 	force bool,
+	marks map[string]*modules.WalkMark,
 	onFile func(path string),
 ) (counter, unchangedFiles, tagsWritten int, errorFiles []string, err error) {
 	manager, tagger, err := BuildForLibrary(db, library)
@@ -256,7 +336,10 @@ func ScanLibraryRoots(
 	managerType := manager.Type()
 	errorFiles = []string{}
 	for _, root := range roots {
-		c, u, tw, errs, walkErr := modules.WalkAndProcess(root, workers, func(path string) (bool, int, error) {
+		c, u, tw, errs, walkErr := modules.WalkAndProcess(ctx, root, marks[root], limits, func(path string) (bool, int, error) {
+			if detachedDuplicate(db, path) {
+				return true, 0, nil // a person decided this copy is not the one; force included
+			}
 			if !force && shouldSkip(db, path, processedVersion, managerType) {
 				return true, 0, nil // counts as unchanged
 			}
@@ -276,9 +359,13 @@ func ScanLibraryRoots(
 // shouldSkip reports whether a file can be skipped this scan: its index row exists
 // and is healthy (status ok with a correlation), the running app version still
 // matches the one that tagged it, the correlation came from the library's current
-// manager, and the file is byte-identical on disk (same size and modification
-// second). It deliberately does not detect upstream MusicBrainz changes — that is
-// the drift sync's job (M4).
+// manager, and the file is unchanged on disk. It deliberately does not detect
+// upstream MusicBrainz changes — that is the drift sync's job (M4).
+//
+// "Unchanged" is the same size and modification second, and failing that, the same
+// audio and the same tags (see unchangedByContent). The second test is what stops an
+// rsync or a backup restore, which resets every mtime it touches, from costing a full
+// re-process of the library.
 //
 // The manager check is what makes a manager swap take effect: without it a file
 // keeps reporting the old correlation_source forever, because nothing else about
@@ -307,8 +394,100 @@ func shouldSkip(db *gorm.DB, filePath, processedVersion, managerType string) boo
 	if err != nil {
 		return false
 	}
-	// Compare to the second: SQLite time round-tripping can drop sub-second precision.
-	return item.Size == fi.Size() && item.ModTime.Unix() == fi.ModTime().Unix()
+	if sameIdentity(item, fi) {
+		return true
+	}
+	return unchangedByContent(db, item, fi)
+}
+
+// sameIdentity reports whether a file still has the size and modification time its
+// row recorded. Compared to the second: SQLite time round-tripping can drop
+// sub-second precision.
+func sameIdentity(item models.LibraryItem, fi os.FileInfo) bool {
+	return item.ModTime != nil && item.Size == fi.Size() && item.ModTime.Unix() == fi.ModTime().Unix()
+}
+
+// unchangedByContent is the skip check's second opinion, for a file whose size or
+// mtime moved: it reads the file and compares its audio and tag hashes with the ones
+// recorded when it was last processed. Both matching means nothing happened to the
+// file but its timestamp, and the row is restamped with the new identity so the next
+// scan takes the cheap path again.
+//
+// Audio that matches under tags that do not is the one case worth saying out loud:
+// another tool has edited the tags. The file is re-processed like any changed file,
+// and the row's TagsEditedAt records that it happened.
+//
+// A row from before the hashes were recorded has neither, and falls back to the old
+// answer — the file changed — which records them.
+func unchangedByContent(db *gorm.DB, item models.LibraryItem, fi os.FileInfo) bool {
+	if item.ContentHash == "" || item.TagStateHash == "" {
+		return false
+	}
+	audio, err := modules.AudioHash(item.Path)
+	if err != nil || audio != item.ContentHash {
+		return false
+	}
+	tags, err := modules.TagStateHash(item.Path)
+	if err != nil {
+		return false
+	}
+	if tags != item.TagStateHash {
+		NoteTagsEdited(db, item)
+		return false
+	}
+
+	mod := fi.ModTime()
+	if err := db.Model(&models.LibraryItem{}).Where("id = ?", item.ID).
+		Updates(map[string]any{"size": fi.Size(), "mod_time": mod}).Error; err != nil {
+		logger.Log.Warnf("failed to restamp library item for %q: %s", item.Path, err.Error())
+	}
+	return true
+}
+
+// NoteTagsEdited records that a file's tags were found changed by something other
+// than Autotaggerr.
+func NoteTagsEdited(db *gorm.DB, item models.LibraryItem) {
+	logger.Log.Warnf("the tags of %q were edited outside Autotaggerr since it last wrote them", item.Path)
+	if err := db.Model(&models.LibraryItem{}).Where("id = ?", item.ID).Update("tags_edited_at", time.Now()).Error; err != nil {
+		logger.Log.Warnf("failed to record the tag edit on %q: %s", item.Path, err.Error())
+	}
+}
+
+// ItemHashes returns the audio and tag hashes to record on a file's row after it was
+// processed. The audio is only read again when it has to be: a row whose hash was
+// taken while the file had the identity `before` still holds it, since no tag write
+// touches the audio. A hash that cannot be taken comes back empty, which the skip
+// check reads as "unknown" rather than as a match.
+func ItemHashes(item models.LibraryItem, before os.FileInfo) (contentHash, tagStateHash string) {
+	contentHash = item.ContentHash
+	if contentHash == "" || before == nil || !sameIdentity(item, before) {
+		hash, err := modules.AudioHash(item.Path)
+		if err != nil {
+			logger.Log.Warnf("failed to hash the audio of %q: %s", item.Path, err.Error())
+		}
+		contentHash = hash
+	}
+	tagStateHash, err := modules.TagStateHash(item.Path)
+	if err != nil {
+		logger.Log.Warnf("failed to hash the tags of %q: %s", item.Path, err.Error())
+	}
+	return contentHash, tagStateHash
+}
+
+// detachedDuplicate reports whether a file was detached as the losing copy of a
+// duplicate. Processing one would correlate it straight back into the collection and
+// undo the decision, so the walk passes it by.
+func detachedDuplicate(db *gorm.DB, filePath string) bool {
+	if db == nil {
+		return false
+	}
+	var count int64
+	if err := db.Model(&models.LibraryItem{}).
+		Where("path = ? AND duplicate_of_id IS NOT NULL", filePath).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
 }
 
 // pinnedCorrelation returns a file's stored correlation when its index row is pinned
@@ -338,7 +517,7 @@ func pinnedCorrelation(db *gorm.DB, filePath string) (models.Correlation, bool)
 // TaggerForLibrary returns just the tagger a library is configured with (no
 // manager construction) — used by the drift sync's re-tag path.
 func TaggerForLibrary(db *gorm.DB, library models.Library) *Tagger {
-	return NewTagger(resolveTaggerProfile(db, library, true))
+	return resolveTagger(db, library, true)
 }
 
 // BuildForLibrary assembles the manager and tagger a library is configured with,
@@ -353,11 +532,12 @@ func BuildForLibrary(db *gorm.DB, library models.Library) (Manager, *Tagger, err
 	if err != nil {
 		return nil, nil, err
 	}
-	return manager, NewTagger(resolveTaggerProfile(db, library, true)), nil
+	return manager, resolveTagger(db, library, true), nil
 }
 
 // recordItem upserts the library_items row for a file: its correlation, on-disk
-// identity (size/mtime), and scan/tag timestamps. Failures to record are logged
+// identity (size/mtime, and after a success the audio and tag hashes), and scan/tag
+// timestamps. Failures to record are logged
 // but never abort processing — the index is a cache of decisions, not the source
 // of truth for whether a file was tagged.
 func recordItem(db *gorm.DB, libraryID uuid.UUID, filePath string, correlation models.Correlation, unchanged bool, processedVersion, managerType string, procErr error) {
@@ -375,7 +555,13 @@ func recordItem(db *gorm.DB, libraryID uuid.UUID, filePath string, correlation m
 	item.LibraryID = libraryID
 	item.LastScannedAt = &now
 
-	if fi, statErr := os.Stat(filePath); statErr == nil {
+	fi, statErr := os.Stat(filePath)
+	if statErr == nil {
+		// Hashed before the identity below is overwritten, which is what ItemHashes
+		// compares against to decide whether the audio needs reading again.
+		if procErr == nil {
+			item.ContentHash, item.TagStateHash = ItemHashes(item, fi)
+		}
 		item.Size = fi.Size()
 		mod := fi.ModTime()
 		item.ModTime = &mod
@@ -0,0 +1,88 @@
+package components
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"gorm.io/gorm"
+)
+
+// PreviewFile is ProcessFile for a dry run. The file is correlated the way a run
+// would correlate it — a pin reused, the manager asked otherwise — and diffed against
+// what the tagger would write, and the changes go to detail as would-be changes.
+// Nothing is written: not the file, not its index row, not Plex. The index row
+// matters as much as the file here: recording one would stamp the file as processed,
+// and the next real run would skip it as already done.
+func PreviewFile(db *gorm.DB, manager Manager, tagger *Tagger, detail *DetailCollector, filePath, rootDir string) (unchanged bool, tagsWritten int, err error) {
+	correlation, pinned := pinnedCorrelation(db, filePath)
+	if !pinned {
+		correlation, err = manager.Correlate(filePath, rootDir)
+		if err != nil {
+			// Unmatched is no more a failure here than in a run: nothing would be
+			// written to the file, which is the answer.
+			if errors.Is(err, modules.ErrUnmatched) {
+				return true, 0, nil
+			}
+			detail.AddError(filePath, err)
+			return false, 0, err
+		}
+	}
+
+	if !tagger.WriteEnabled() {
+		return true, 0, nil // a profile that writes nothing would write nothing
+	}
+	changes, err := modules.PreviewResolvedFile(filePath, correlation, rootDir, tagger.FileSettings(db, filePath))
+	if err != nil {
+		detail.AddError(filePath, err)
+		return false, 0, err
+	}
+	if len(changes) == 0 {
+		return true, 0, nil
+	}
+	detail.AddWouldChange(filePath, changes)
+	return false, len(changes), nil
+}
+
+// PreviewLibraryRoots is ScanLibraryRoots for a dry run: the same walk, with each file
+// going through PreviewFile. Every file is previewed, as under force. The skip cache
+// says whether a file changed since it was last written, which is not the question
+// a dry run asks — a profile the library does not use yet would write to files no
+// scan has reason to look at again. Detached duplicates are still passed by, as a run
+// passes them by.
+func PreviewLibraryRoots(
+	ctx context.Context,
+	db *gorm.DB,
+	library models.Library,
+	roots []string,
+	detail *DetailCollector,
+	limits modules.WalkLimits,
+	onFile func(path string),
+) (counter, unchangedFiles, tagsWritten int, errorFiles []string, err error) {
+	manager, tagger, err := BuildForLibrary(db, library)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	if len(roots) == 0 {
+		roots = []string{library.Path}
+	}
+
+	errorFiles = []string{}
+	for _, root := range roots {
+		c, u, tw, errs, walkErr := modules.WalkAndProcess(ctx, root, nil, limits, func(path string) (bool, int, error) {
+			if detachedDuplicate(db, path) {
+				return true, 0, nil
+			}
+			return PreviewFile(db, manager, tagger, detail, path, library.Path)
+		}, onFile)
+		counter += c
+		unchangedFiles += u
+		tagsWritten += tw
+		errorFiles = append(errorFiles, errs...)
+		if walkErr != nil {
+			return counter, unchangedFiles, tagsWritten, errorFiles, walkErr
+		}
+	}
+	return counter, unchangedFiles, tagsWritten, errorFiles, nil
+}
@@ -25,8 +25,7 @@ func BuildForFile(db *gorm.DB, filePath, fileRoot string) (models.Library, Manag
 		return library, nil, nil, err
 	}
 
-	tagger := NewTagger(resolveTaggerProfile(db, library, found))
-	return library, manager, tagger, nil
+	return library, manager, resolveTagger(db, library, found), nil
 }
 
 // findLibraryForFile returns the configured library that contains filePath (the
@@ -93,6 +92,14 @@ func resolveManagerRow(db *gorm.DB, library models.Library, found bool) (models.
 	return models.Manager{Type: models.ManagerTypeAutotaggerr, Enabled: true}, nil
 }
 
+// resolveTagger builds the tagger a library is configured with, together with the
+// artwork source its profile embeds covers from.
+func resolveTagger(db *gorm.DB, library models.Library, found bool) *Tagger {
+	tagger := NewTagger(resolveTaggerProfile(db, library, found))
+	tagger.artwork = ArtworkProviders(db)
+	return tagger
+}
+
 func resolveTaggerProfile(db *gorm.DB, library models.Library, found bool) models.TaggerProfile {
 	if db != nil {
 		if found && library.TaggerProfileID != nil {
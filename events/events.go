@@ -199,12 +199,16 @@ func Items(db *gorm.DB, eventID uuid.UUID) ([]models.EventItem, error) {
 // flight is the one fact worth keeping — "interrupted during Tagging" is actionable in
 // a way "interrupted" is not. The stage rows need no such help; each already carries
 // its own title.
+//
+// A run that recorded a checkpoint (see models.RunCheckpoint) is closed as resumable
+// rather than failed: it did not fail, it was cut short, and the next run of the same
+// scope will carry on from where it stopped.
 func ReconcileRunning(db *gorm.DB) {
 	if db == nil {
 		return
 	}
 	var running []models.Event
-	if err := db.Select("id", "parent_id", "title").
+	if err := db.Select("id", "parent_id", "title", "checkpoint").
 		Where("status = ?", models.EventStatusRunning).
 		Find(&running).Error; err != nil {
 		logger.Log.Warnf("failed to enumerate interrupted events: %s", err.Error())
@@ -228,20 +232,29 @@ func ReconcileRunning(db *gorm.DB) {
 	now := time.Now()
 	closed := 0
 
-	// Runs whose stage is known are closed one at a time, since each gets its own
+	// Runs whose stage or checkpoint is known are closed one at a time, since each gets its own
 	// summary. There is at most a handful: one boot's worth of a serial queue.
 	for _, ev := range running {
 		stages := stagesByRun[ev.ID]
-		if len(stages) == 0 {
+		if len(stages) == 0 && ev.Checkpoint == nil {
 			continue
 		}
+		status := models.EventStatusError
+		summary := "interrupted — the service restarted while this was running"
+		if len(stages) > 0 {
+			summary = fmt.Sprintf("interrupted during %s — the service restarted while this was running",
+				strings.Join(stages, " and "))
+		}
+		if ev.Checkpoint != nil {
+			status = models.EventStatusResumable
+			summary += "; the next run of it resumes from where it stopped"
+		}
 		res := db.Model(&models.Event{}).
 			Where("id = ? AND status = ?", ev.ID, models.EventStatusRunning).
 			Updates(map[string]any{
-				"status":      models.EventStatusError,
+				"status":      status,
 				"finished_at": now,
-				"summary": fmt.Sprintf("interrupted during %s — the service restarted while this was running",
-					strings.Join(stages, " and ")),
+				"summary":     summary,
 			})
 		if res.Error != nil {
 			logger.Log.Warnf("failed to reconcile interrupted run: %s", res.Error.Error())
@@ -128,6 +128,34 @@ func TestReconcileRunning(t *testing.T) {
 	}
 }
 
+// A run that recorded a checkpoint was cut short, not broken: it is closed as
+// resumable with the checkpoint left on the row for the next run to pick up.
+func TestReconcileRunningKeepsACheckpointedRunResumable(t *testing.T) {
+	db := testDB(t)
+	run := Begin(db, models.EventTypeProcess, "interrupted run")
+	BeginChild(db, run, models.EventTypeTagFiles, "Tagging")
+	checkpoint := &models.RunCheckpoint{Scope: "lib", Reached: map[string]string{"lib:/music": "/music/A/01.flac"}}
+	if err := db.Model(&models.Event{}).Where("id = ?", run.ID).Select("checkpoint").Updates(&models.Event{Checkpoint: checkpoint}).Error; err != nil {
+		t.Fatalf("record checkpoint: %v", err)
+	}
+
+	ReconcileRunning(db)
+
+	var got models.Event
+	if err := db.First(&got, "id = ?", run.ID).Error; err != nil {
+		t.Fatalf("reload run: %v", err)
+	}
+	if got.Status != models.EventStatusResumable || got.FinishedAt == nil {
+		t.Errorf("run closed as %q (finished %v), want resumable", got.Status, got.FinishedAt)
+	}
+	if !strings.Contains(got.Summary, "Tagging") || !strings.Contains(got.Summary, "resumes") {
+		t.Errorf("summary = %q, want the stage and that the next run resumes", got.Summary)
+	}
+	if got.Checkpoint == nil || got.Checkpoint.Reached["lib:/music"] != "/music/A/01.flac" {
+		t.Errorf("checkpoint = %+v, want it kept as recorded", got.Checkpoint)
+	}
+}
+
 // TestReconcileRunningNamesTheStage covers the half a run cannot report itself: the
 // stage that was in flight lives on a different row, so without this the feed says a
 // run was interrupted but not what it was doing. The stage's own row needs no help —
@@ -150,6 +150,12 @@ func LoadConfig() (err error) {
 		anythingChanged = true
 	}
 
+	if ConfigFile.AutotaggerrProcessResumeHours == 0 {
+		// set new value (how long a stopped run can be resumed); negative turns it off
+		ConfigFile.AutotaggerrProcessResumeHours = models.DefaultProcessResumeHours
+		anythingChanged = true
+	}
+
 	if ConfigFile.AutotaggerrEventRetention < 1 {
 		// set new value (how many Activity runs are kept)
 		ConfigFile.AutotaggerrEventRetention = models.DefaultEventRetention
@@ -162,6 +168,12 @@ func LoadConfig() (err error) {
 		anythingChanged = true
 	}
 
+	if ConfigFile.AutotaggerrTagJournalDays == 0 {
+		// set new value (how long tag writes can be rolled back); negative turns it off
+		ConfigFile.AutotaggerrTagJournalDays = models.DefaultTagJournalDays
+		anythingChanged = true
+	}
+
 	if ConfigFile.AutotaggerrLogLevel == "" {
 		level := logrus.InfoLevel
 		ConfigFile.AutotaggerrLogLevel = level.String()
@@ -205,8 +217,10 @@ func CreateConfigFile() error {
 	ConfigFile.AutotaggerrVersion = autotaggerrVersionParameter
 	ConfigFile.AutotaggerrProcessCronSchedule = "0 0 18 * * 7"
 	ConfigFile.AutotaggerrProcessConcurrency = 4
+	ConfigFile.AutotaggerrProcessResumeHours = models.DefaultProcessResumeHours
 	ConfigFile.AutotaggerrEventRetention = models.DefaultEventRetention
 	ConfigFile.AutotaggerrEventDetailRetention = models.DefaultEventDetailRetention
+	ConfigFile.AutotaggerrTagJournalDays = models.DefaultTagJournalDays
 
 	ConfigFile.AutotaggerrMirrorDisabled = false
 	ConfigFile.AutotaggerrMirrorCronSchedule = "0 0 3 * * *"
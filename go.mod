@@ -11,7 +11,10 @@ require (
 	github.com/glebarez/sqlite v1.11.0
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/google/uuid v1.6.0
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/jfreymuth/oggvorbis v1.0.5
 	github.com/mewkiz/flac v1.0.13
+	github.com/pion/opus v0.0.0-20260504155822-67f6be33ea99
 	github.com/sirupsen/logrus v1.10.0
 	golang.org/x/oauth2 v0.36.0
 	golang.org/x/sys v0.47.0
@@ -19,6 +22,11 @@ require (
 	gorm.io/gorm v1.31.2
 )
 
+// Test only: shine encodes the MP3s modules/loudness_test.go measures, since there is
+// no MP3 fixture to check in that a reference encoder made. Nothing outside a _test.go
+// file imports it, so it is not linked into the binary.
+require github.com/braheezy/shine-mp3 v0.1.0
+
 require (
 	github.com/bytedance/sonic/loader v0.5.2 // indirect
 	github.com/cloudwego/base64x v0.1.7 // indirect
@@ -39,6 +47,7 @@ require (
 	github.com/goccy/go-json v0.10.6 // indirect
 	github.com/goccy/go-yaml v1.19.2 // indirect
 	github.com/icza/bitio v1.1.0 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
@@ -0,0 +1,295 @@
+// Package inbox identifies loose files dropped into a library's inbox folder, so an
+// import can place them in the library.
+//
+// Identification fails closed, as every automatic identification here does: a file
+// left in the inbox costs one manual attach, while a confident wrong answer writes the
+// wrong album into its tags and then resolves as that album forever after. So each
+// step only answers when it is sure, and a file none of them is sure about stays where
+// it was dropped.
+//
+// Files are identified a folder at a time, because a folder is an album far more often
+// than not, and the album is what the weaker evidence needs:
+//
+//  1. **Tags.** A file already carrying MusicBrainz IDs (tagged by Picard, or by
+//     Autotaggerr elsewhere) is taken at its word — the native manager's own rule.
+//  2. **The folder's release.** The release the tagged files agree on, or else the one
+//     AcoustID places every fingerprinted file on. Files that disagree leave the
+//     folder with no release, and the rest of it unidentified.
+//  3. **The track.** modules.MapFilesToTracks pairs the remaining files with the
+//     release's tracks. A file AcoustID heard must pair with its own recording; one it
+//     did not hear is only placed by an unambiguous track number, never by order.
+package inbox
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+)
+
+// Files lists the audio files under dir, grouped by the folder they are in, each
+// group sorted. Hidden folders — a download client's partial-file directory — are
+// not walked.
+func Files(dir string) (map[string][]string, error) {
+	groups := map[string][]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && len(d.Name()) > 0 && d.Name()[0] == '.' {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && modules.IsSupportedFile(path) {
+			folder := filepath.Dir(path)
+			groups[folder] = append(groups[folder], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, paths := range groups {
+		sort.Strings(paths)
+	}
+	return groups, nil
+}
+
+// Result is what identification made of one file.
+type Result struct {
+	Path        string
+	Correlation models.Correlation
+	// Reason says why the file could not be identified; empty when it was.
+	Reason string
+}
+
+// Identified reports whether the file has a release and a track.
+func (r Result) Identified() bool {
+	return r.Reason == "" && r.Correlation.MBReleaseID != "" && r.Correlation.MBReleaseTrackID != ""
+}
+
+// Identifier holds what identification reads from. Each step is a function so a test
+// can stand in for the file, AcoustID and MusicBrainz.
+type Identifier struct {
+	// GetRelease fetches a release's tracklist.
+	GetRelease func(mbID string) (models.MusicBrainzReleaseResponse, error)
+	// Fingerprint identifies a file from its audio (modules.IdentifyFile, ranked). Nil
+	// when the library has not opted in or AcoustID is not set up, which leaves a
+	// folder only its tags to go on.
+	Fingerprint func(path string) ([]modules.RankedCandidate, error)
+	// Tags reads a file's embedded correlation. Nil reads it as the native manager
+	// does.
+	Tags func(path string) (models.Correlation, error)
+}
+
+func (id Identifier) tags(path string) (models.Correlation, error) {
+	if id.Tags != nil {
+		return id.Tags(path)
+	}
+	return modules.ResolveCorrelation(path, nil, filepath.Dir(path), true)
+}
+
+// Folder identifies the files of one folder (see the package comment). The results
+// are in the order of paths.
+func (id Identifier) Folder(paths []string) []Result {
+	results := make([]Result, len(paths))
+	var rest []int
+	tagged := map[string]bool{}
+	claimed := map[string]int{} // track ID → files placed on it
+	for i, path := range paths {
+		results[i].Path = path
+		correlation, err := id.tags(path)
+		if err == nil && correlation.MBReleaseID != "" && correlation.MBReleaseTrackID != "" {
+			if correlation.Source == "" {
+				correlation.Source = models.CorrelationSourceTags
+			}
+			results[i].Correlation = correlation
+			tagged[correlation.MBReleaseID] = true
+			claimed[correlation.MBReleaseTrackID]++
+			continue
+		}
+		rest = append(rest, i)
+	}
+	if len(rest) == 0 {
+		return results
+	}
+
+	heard := id.fingerprint(paths, rest)
+	release, why := folderRelease(tagged, heard, rest)
+	if release == "" {
+		for _, i := range rest {
+			results[i].Reason = why
+		}
+		return results
+	}
+
+	response, err := id.GetRelease(release)
+	if err != nil {
+		for _, i := range rest {
+			results[i].Reason = fmt.Sprintf("the folder looks like release %s, which could not be loaded: %s", release, err.Error())
+		}
+		return results
+	}
+	tracks := modules.ReleaseTracks(response)
+	restPaths := make([]string, len(rest))
+	for j, i := range rest {
+		restPaths[j] = paths[i]
+	}
+	mapping := modules.MapFilesToTracks(restPaths, tracks)
+
+	for j, i := range rest {
+		recording := heard[i].recordingOn(release)
+		track, how, ok := pick(mapping[j], recording, tracks)
+		if !ok {
+			results[i].Reason = how
+			continue
+		}
+		source := models.CorrelationSourceImport
+		if recording != "" {
+			source = models.CorrelationSourceFingerprint
+		}
+		results[i].Correlation = models.Correlation{
+			MBReleaseID:      release,
+			MBReleaseTrackID: track.TrackID,
+			MBRecordingID:    track.RecordingID,
+			TrackTitle:       track.TrackTitle,
+			Source:           source,
+		}
+		claimed[track.TrackID]++
+	}
+
+	// Two files on one track means one of them is wrong, and nothing says which.
+	for _, i := range rest {
+		if c := results[i].Correlation; c.MBReleaseTrackID != "" && claimed[c.MBReleaseTrackID] > 1 {
+			results[i].Correlation = models.Correlation{}
+			results[i].Reason = "another file in the folder is the same track"
+		}
+	}
+	return results
+}
+
+// heard is what AcoustID said about one file: its ranked candidates, or nothing.
+type heard []modules.RankedCandidate
+
+// releases lists the releases the file's candidates put it on.
+func (h heard) releases() map[string]bool {
+	out := map[string]bool{}
+	for _, c := range h {
+		if c.ReleaseMBID != "" {
+			out[c.ReleaseMBID] = true
+		}
+	}
+	return out
+}
+
+// recordingOn is the recording AcoustID heard on release, or "" if it heard none.
+func (h heard) recordingOn(release string) string {
+	for _, c := range h {
+		if c.ReleaseMBID == release {
+			return c.RecordingMBID
+		}
+	}
+	return ""
+}
+
+// fingerprint asks AcoustID about each unidentified file. A failure for one file is
+// that file not heard; it is not the folder's failure.
+func (id Identifier) fingerprint(paths []string, rest []int) map[int]heard {
+	out := map[int]heard{}
+	if id.Fingerprint == nil {
+		return out
+	}
+	for _, i := range rest {
+		if candidates, err := id.Fingerprint(paths[i]); err == nil && len(candidates) > 0 {
+			out[i] = candidates
+		}
+	}
+	return out
+}
+
+// folderRelease picks the one release the folder is, or says why there is none. The
+// tagged files' release wins when they agree on one; otherwise every heard file must
+// share a release, and the top-ranked candidates decide between several shared ones.
+func folderRelease(tagged map[string]bool, heardFiles map[int]heard, rest []int) (string, string) {
+	if len(tagged) == 1 {
+		for release := range tagged {
+			return release, ""
+		}
+	}
+	if len(tagged) > 1 {
+		return "", "the tagged files in this folder are from different releases"
+	}
+	if len(heardFiles) == 0 {
+		return "", "no MusicBrainz tags, and no fingerprint match"
+	}
+
+	var shared map[string]bool
+	tops := map[string]bool{}
+	for _, i := range rest {
+		h, ok := heardFiles[i]
+		if !ok {
+			continue
+		}
+		tops[h[0].ReleaseMBID] = true
+		releases := h.releases()
+		if shared == nil {
+			shared = releases
+			continue
+		}
+		for release := range shared {
+			if !releases[release] {
+				delete(shared, release)
+			}
+		}
+	}
+	if len(tops) == 1 {
+		for release := range tops {
+			if shared[release] {
+				return release, ""
+			}
+		}
+	}
+	if len(shared) == 1 {
+		for release := range shared {
+			return release, ""
+		}
+	}
+	return "", "the fingerprints do not agree on one release for this folder"
+}
+
+// pick settles one file's track: the proposed pairing when it is the recording the
+// file was heard as, else the one track of that recording; with nothing heard, the
+// pairing only when a track number made it. On failure the string says why.
+func pick(proposed modules.FileTrackMapping, recording string, tracks []modules.ReleaseTrack) (modules.FileTrackMapping, string, bool) {
+	if recording == "" {
+		if proposed.How == modules.MapByNumber {
+			return proposed, modules.MapByNumber, true
+		}
+		return modules.FileTrackMapping{}, "no fingerprint match, and no track number that places it on the release", false
+	}
+	if proposed.TrackID != "" && proposed.RecordingID == recording {
+		return proposed, proposed.How, true
+	}
+	var found []modules.ReleaseTrack
+	for _, t := range tracks {
+		if t.RecordingID == recording && !t.Video {
+			found = append(found, t)
+		}
+	}
+	if len(found) == 1 {
+		t := found[0]
+		return modules.FileTrackMapping{
+			Path: proposed.Path, TrackID: t.TrackID, RecordingID: t.RecordingID,
+			TrackNumber: t.Number, TrackTitle: t.Title, Medium: t.Medium,
+		}, "recording", true
+	}
+	if len(found) > 1 {
+		return modules.FileTrackMapping{}, "the recording it was heard as is on the release more than once", false
+	}
+	return modules.FileTrackMapping{}, "the recording it was heard as is not on the folder's release", false
+}
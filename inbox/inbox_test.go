@@ -0,0 +1,162 @@
+package inbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+)
+
+func release() models.MusicBrainzReleaseResponse {
+	track := func(id, recording, number string, position int) models.Track {
+		t := models.Track{ID: id, Title: "Track " + number, Position: position, Number: number}
+		t.Recording.ID = recording
+		return t
+	}
+	return models.MusicBrainzReleaseResponse{
+		ID: "rel",
+		Media: []models.MusicBrainzMedia{{
+			Position: 1,
+			Tracks: []models.Track{
+				track("t1", "rec-1", "1", 1),
+				track("t2", "rec-2", "2", 2),
+				track("t3", "rec-3", "3", 3),
+			},
+		}},
+	}
+}
+
+// identifier answers from maps: tags by path, fingerprints by path, one release.
+func identifier(tags map[string]models.Correlation, heard map[string][]modules.RankedCandidate) Identifier {
+	id := Identifier{
+		GetRelease: func(mbID string) (models.MusicBrainzReleaseResponse, error) {
+			if mbID != "rel" {
+				return models.MusicBrainzReleaseResponse{}, errors.New("not found")
+			}
+			return release(), nil
+		},
+		Tags: func(path string) (models.Correlation, error) { return tags[path], nil },
+	}
+	if heard != nil {
+		id.Fingerprint = func(path string) ([]modules.RankedCandidate, error) { return heard[path], nil }
+	}
+	return id
+}
+
+func candidate(release, recording string) modules.RankedCandidate {
+	var c modules.RankedCandidate
+	c.ReleaseMBID = release
+	c.RecordingMBID = recording
+	return c
+}
+
+// TestFolderTakesTheTaggedFilesRelease: one file tagged by Picard names the album, and
+// its untagged neighbours are placed on it by their track numbers.
+func TestFolderTakesTheTaggedFilesRelease(t *testing.T) {
+	paths := []string{"/in/a/01 One.flac", "/in/a/02 Two.flac", "/in/a/03 Three.flac"}
+	id := identifier(map[string]models.Correlation{
+		paths[0]: {MBReleaseID: "rel", MBReleaseTrackID: "t1", MBRecordingID: "rec-1"},
+	}, nil)
+
+	results := id.Folder(paths)
+	for i, want := range []struct{ track, source string }{
+		{"t1", models.CorrelationSourceTags},
+		{"t2", models.CorrelationSourceImport},
+		{"t3", models.CorrelationSourceImport},
+	} {
+		got := results[i]
+		if !got.Identified() || got.Correlation.MBReleaseTrackID != want.track || got.Correlation.Source != want.source {
+			t.Errorf("%s = %+v, want track %s from %s", got.Path, got, want.track, want.source)
+		}
+	}
+}
+
+// TestFolderNeverPlacesByOrder: with nothing heard and one file unnumbered, the only
+// pairing left is sort order, which is a guess — so nothing untagged is placed.
+func TestFolderNeverPlacesByOrder(t *testing.T) {
+	paths := []string{"/in/a/01 One.flac", "/in/a/02 Two.flac", "/in/a/bonus.flac"}
+	id := identifier(map[string]models.Correlation{
+		paths[0]: {MBReleaseID: "rel", MBReleaseTrackID: "t1"},
+	}, nil)
+
+	results := id.Folder(paths)
+	if !results[0].Identified() {
+		t.Errorf("the tagged file lost its tags: %+v", results[0])
+	}
+	for _, got := range results[1:] {
+		if got.Identified() || got.Reason == "" {
+			t.Errorf("%s = %+v, want unidentified with a reason", got.Path, got)
+		}
+	}
+}
+
+// TestFolderByFingerprint: untagged, unnumbered files AcoustID agrees on are placed on
+// their own recordings; one heard as a recording the release lacks stays behind.
+func TestFolderByFingerprint(t *testing.T) {
+	paths := []string{"/in/b/x.flac", "/in/b/y.flac", "/in/b/z.flac"}
+	id := identifier(nil, map[string][]modules.RankedCandidate{
+		paths[0]: {candidate("rel", "rec-3"), candidate("other", "rec-3")},
+		paths[1]: {candidate("rel", "rec-1")},
+		paths[2]: {candidate("rel", "rec-9")},
+	})
+
+	results := id.Folder(paths)
+	if got := results[0].Correlation; got.MBReleaseTrackID != "t3" || got.Source != models.CorrelationSourceFingerprint {
+		t.Errorf("x = %+v, want t3 by fingerprint", results[0])
+	}
+	if got := results[1].Correlation; got.MBReleaseTrackID != "t1" {
+		t.Errorf("y = %+v, want t1", results[1])
+	}
+	if results[2].Identified() {
+		t.Errorf("z = %+v, want unidentified", results[2])
+	}
+}
+
+// TestFolderFailsClosed: fingerprints that disagree leave the folder with no release,
+// and two files on one track are both left, since either could be the wrong one.
+func TestFolderFailsClosed(t *testing.T) {
+	paths := []string{"/in/c/1.flac", "/in/c/2.flac"}
+	results := identifier(nil, map[string][]modules.RankedCandidate{
+		paths[0]: {candidate("rel", "rec-1")},
+		paths[1]: {candidate("other", "rec-2")},
+	}).Folder(paths)
+	for _, got := range results {
+		if got.Identified() {
+			t.Errorf("disagreeing folder: %s = %+v", got.Path, got)
+		}
+	}
+
+	results = identifier(nil, map[string][]modules.RankedCandidate{
+		paths[0]: {candidate("rel", "rec-2")},
+		paths[1]: {candidate("rel", "rec-2")},
+	}).Folder(paths)
+	for _, got := range results {
+		if got.Identified() {
+			t.Errorf("duplicate track: %s = %+v", got.Path, got)
+		}
+	}
+}
+
+func TestFilesGroupsByFolderAndSkipsHidden(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"a/02.flac", "a/01.mp3", "a/cover.jpg", "b/1.flac", ".partial/x.flac"} {
+		path := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groups, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := groups[filepath.Join(dir, "a")]
+	if len(groups) != 2 || len(a) != 2 || filepath.Base(a[0]) != "01.mp3" {
+		t.Fatalf("groups = %v", groups)
+	}
+}
@@ -39,6 +39,7 @@ import (
 	"github.com/aunefyren/autotaggerr/routers"
 	"github.com/aunefyren/autotaggerr/settings"
 	"github.com/aunefyren/autotaggerr/utilities"
+	"github.com/aunefyren/autotaggerr/watch"
 	"github.com/aunefyren/autotaggerr/web"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -54,6 +55,8 @@ var (
 	// settingsRuntime owns the recurring schedules and re-applies settings saved in
 	// the UI to this running process.
 	settingsRuntime *settings.Runtime
+	// libraryWatcher scans watched libraries' folders as changes settle in them.
+	libraryWatcher *watch.Watcher
 )
 
 func main() {
@@ -194,12 +197,17 @@ func main() {
 	events.MigrateLegacyTypes(db)
 
 	// The same reconciliation for migrations marked as having a manager repair in
-	// flight: no job survived the restart, so any surviving mark is a row claiming work
-	// is happening that is not. Startup-only, for the reason ReconcileRunning is.
+	// flight: any surviving mark is a row claiming work is happening that is not. A
+	// repair that was still queued is marked again when the runner replays it below.
+	// Startup-only, for the reason ReconcileRunning is.
 	migration.ReconcileQueued(db)
 
 	// Shared scan runner: the cron job, the startup run, and the API all drive
 	// library processing through this one instance (single-run guard + status).
+	// It puts back whatever was queued when the last process stopped — after the
+	// reconciliation above, so a replayed job's event is never taken for an orphan,
+	// and before the schedules below, so a cron firing at boot dedups onto the
+	// restored job instead of jumping ahead of it.
 	scanRunner = process.NewRunner(db, plexClient, files.ConfigFile)
 
 	// The metadata-refresh runner is owned by the scan runner and already wired to
@@ -229,24 +237,26 @@ func main() {
 	// Every recurring job is described once and owned by the settings runtime, which
 	// installs them here and re-installs them when a schedule is saved in the UI. The
 	// mirror's refresh is enqueued through the scan runner (SyncDrift) rather than
-	// started directly, so every background job shares one serial queue.
+	// started directly, so every background job shares one serial queue. Each queues
+	// through its OnSchedule variant, which quiet hours hold back; the same verb
+	// pressed in the UI is not.
 	settingsRuntime = settings.NewRuntime(
 		chrono.NewDefaultTaskScheduler(),
-		scanRunner.SetConcurrency,
+		scanRunner.ApplyLimits,
 		settings.CronJob{
 			Name:     "scan",
-			Run:      func() { scanRunner.RunAll() },
+			Run:      func() { scanRunner.RunAllOnSchedule() },
 			Schedule: func(c models.ConfigStruct) string { return c.AutotaggerrProcessCronSchedule },
 		},
 		settings.CronJob{
 			Name:     "metadata refresh",
-			Run:      func() { scanRunner.SyncDrift() },
+			Run:      func() { scanRunner.SyncDriftOnSchedule() },
 			Schedule: func(c models.ConfigStruct) string { return c.AutotaggerrMirrorCronSchedule },
 			Enabled:  func(c models.ConfigStruct) bool { return !c.AutotaggerrMirrorDisabled },
 		},
 		settings.CronJob{
 			Name:     "artwork refresh",
-			Run:      func() { artworkRunner.RefreshCollection(false) },
+			Run:      func() { artworkRunner.RefreshCollectionOnSchedule() },
 			Schedule: func(c models.ConfigStruct) string { return c.AutotaggerrArtworkCronSchedule },
 			Enabled:  func(c models.ConfigStruct) bool { return !c.AutotaggerrArtworkDisabled },
 		},
@@ -258,6 +268,21 @@ func main() {
 	)
 	settingsRuntime.Schedule(files.ConfigFile)
 
+	// Libraries with a schedule of their own get it beside the global scan. The rows
+	// are read once here; the library handlers keep the set current after that.
+	settingsRuntime.SetLibraryRunner(scanRunner.RunLibraryOnSchedule)
+	var scheduledLibraries []models.Library
+	if err := db.Find(&scheduledLibraries).Error; err != nil {
+		logger.Log.Error("failed to load libraries for their schedules. error: " + err.Error())
+	}
+	settingsRuntime.ScheduleLibraries(scheduledLibraries)
+
+	// Libraries that opted in are watched, and a folder whose changes have settled is
+	// queued as its own scan — an import is tagged when it lands, not at the next
+	// scheduled pass.
+	libraryWatcher = watch.NewWatcher(db, scanRunner.RunFolders)
+	libraryWatcher.Start()
+
 	// Nothing is kicked off here. Both verbs used to have an "on start up" config key,
 	// from before there was a UI to press: a scan and a metadata refresh are now a
 	// button on the Activity page and a schedule that is installed above, so a restart
@@ -301,13 +326,14 @@ func main() {
 		}
 	}()
 
-	shutdown(server, scanRunner, settingsRuntime)
+	shutdown(server, scanRunner, settingsRuntime, libraryWatcher)
 }
 
-// shutdownGrace bounds how long a job already in flight is given to finish. A scan of
-// a large library takes far longer than this; the point is not to wait it out but to
-// let the common case — a job seconds from done, or none at all — end cleanly instead
-// of being killed mid-write.
+// shutdownGrace bounds how long a job already in flight is given to stop. The runner
+// cancels it, and a cancelled job stops at its next file, release or entity — so this
+// is time for the writes in flight to land and the event to be closed as cancelled,
+// not time to finish the job. It only runs out on a job that does not stop, such as
+// a manager refresh waiting on Lidarr.
 const shutdownGrace = 30 * time.Second
 
 // shutdown blocks until the process is asked to stop, then stops it in the order that
@@ -318,17 +344,18 @@ const shutdownGrace = 30 * time.Second
 // events.ReconcileRunning closing the orphaned event on the next boot. That is a
 // safety net, and a poor substitute for stopping on purpose.
 //
-// The order is the whole design. Schedules first, so no cron fires into a process
-// that is leaving. Then HTTP, which both stops new requests arriving and waits for the
-// ones in flight — including the synchronous re-tags that write files outside the
-// queue. Only then the job runner, because until the API is closed it can still be
-// handed work.
-func shutdown(server *http.Server, runner *process.Runner, schedules *settings.Runtime) {
+// The order is the whole design. Schedules and the watcher first, so no cron or
+// settled folder fires into a process that is leaving. Then HTTP, which both stops new
+// requests arriving and waits for the ones in flight — including the synchronous
+// re-tags that write files outside the queue. Only then the job runner, because until
+// the API is closed it can still be handed work.
+func shutdown(server *http.Server, runner *process.Runner, schedules *settings.Runtime, watcher *watch.Watcher) {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	logger.Log.Infof("received %s; shutting down", <-stop)
 
 	schedules.Stop()
+	watcher.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
 	defer cancel()
@@ -337,10 +364,10 @@ func shutdown(server *http.Server, runner *process.Runner, schedules *settings.R
 	}
 
 	if err := runner.Shutdown(ctx); err != nil {
-		// The job outlived the grace period. Its event stays `running` and is closed
-		// out on the next boot, exactly as after a crash — the difference is that this
-		// one is logged as the deliberate choice it is.
-		logger.Log.Warnf("a background job was still running after %s; exiting anyway", shutdownGrace)
+		// The job did not stop within the grace period. Its event stays `running` and
+		// is closed out on the next boot, exactly as after a crash — the difference is
+		// that this one is logged as the deliberate choice it is.
+		logger.Log.Warnf("a background job was still running %s after it was cancelled; exiting anyway", shutdownGrace)
 	}
 
 	logger.Log.Info("Autotaggerr stopped")
@@ -372,6 +399,7 @@ func initRouter(db *gorm.DB, scanRunner *process.Runner, mirrorRunner *mirror.Ru
 		Rebuilder:  collection.NewRebuilder(db),
 		Meta:       modules.NewMetadataSource(),
 		Settings:   settingsRuntime,
+		Watcher:    libraryWatcher,
 		SigningKey: files.GetPrivateKey(0),
 		AppName:    cfg.AutotaggerrName,
 		Version:    cfg.AutotaggerrVersion,
@@ -188,7 +188,7 @@ func (r *Result) tally(phase string, mutate func(*PhaseStat)) {
 }
 
 // Scope is what one pass covers. Every entry is a list of MBIDs, so narrowing to a
-// release-group later needs a constructor rather than new machinery.
+// release-group is a constructor (ReleaseGroupScope) rather than new machinery.
 //
 // Force ignores the cache TTL. It is what a manual refresh means: a user who
 // suspects a release is wrong is not helped by "it was checked recently, come back
@@ -333,6 +333,45 @@ func ArtistScope(db *gorm.DB, artistMBID string, force bool) (Scope, error) {
 	return scope, nil
 }
 
+// ReleaseGroupScope covers one album: the release-group's edition list and every
+// edition of it the collection holds. It is what fixing one album needs — the rows its
+// files are tagged from — without the rest of the artist's discography. Like
+// ArtistScope it honours the cache unless force is asked for.
+func ReleaseGroupScope(db *gorm.DB, releaseGroupMBID string, force bool) (Scope, error) {
+	var group models.CollectionReleaseGroup
+	if err := db.Where("mb_id = ?", releaseGroupMBID).First(&group).Error; err != nil {
+		return Scope{}, err
+	}
+	name := group.Title
+	if name == "" {
+		name = releaseGroupMBID
+	}
+
+	title := "Metadata refresh for " + name
+	if force {
+		title = "Full metadata refresh for " + name
+	}
+	scope := Scope{
+		Title:  title,
+		Force:  force,
+		Detail: map[string]any{"release_group": name, "release_group_mb_id": releaseGroupMBID},
+	}
+
+	retired, err := retiredGroups(db)
+	if err != nil {
+		return scope, err
+	}
+	if !retired[releaseGroupMBID] {
+		scope.Groups = []string{releaseGroupMBID}
+	}
+	releases, err := collection.ReleaseGroupReleaseMBIDs(db, releaseGroupMBID)
+	if err != nil {
+		return scope, err
+	}
+	scope.Releases = releases
+	return scope, nil
+}
+
 // LibraryScope covers everything one library's files point at: their releases, the
 // release-groups and artists those belong to, and each artist's discography.
 //
@@ -123,6 +123,9 @@ func TestOnlyAnExplicitForceIgnoresTheCache(t *testing.T) {
 	if err := db.Create(&lib).Error; err != nil {
 		t.Fatalf("seed library: %v", err)
 	}
+	if err := db.Create(&models.CollectionReleaseGroup{MBID: "rg1", ArtistMBID: "a1", Title: "Spirit of Eden"}).Error; err != nil {
+		t.Fatalf("seed release-group: %v", err)
+	}
 
 	artist, err := ArtistScope(db, "a1", false)
 	if err != nil {
@@ -136,12 +139,17 @@ func TestOnlyAnExplicitForceIgnoresTheCache(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CollectionScope: %v", err)
 	}
+	album, err := ReleaseGroupScope(db, "rg1", false)
+	if err != nil {
+		t.Fatalf("ReleaseGroupScope: %v", err)
+	}
 
 	for name, scope := range map[string]Scope{
-		"ArtistScope(false)":     artist,
-		"LibraryScope":           library,
-		"CollectionScope(false)": collection,
-		"DueScope":               DueScope([]string{"rel-1"}),
+		"ArtistScope(false)":       artist,
+		"LibraryScope":             library,
+		"CollectionScope(false)":   collection,
+		"ReleaseGroupScope(false)": album,
+		"DueScope":                 DueScope([]string{"rel-1"}),
 	} {
 		if scope.Force {
 			t.Errorf("%s ignores the cache without being asked to", name)
@@ -165,6 +173,13 @@ func TestOnlyAnExplicitForceIgnoresTheCache(t *testing.T) {
 	if !forcedArtist.Force {
 		t.Error("ArtistScope(db, mbid, true) must ignore the cache — it is how one artist is asked")
 	}
+	forcedAlbum, err := ReleaseGroupScope(db, "rg1", true)
+	if err != nil {
+		t.Fatalf("ReleaseGroupScope(force): %v", err)
+	}
+	if !forcedAlbum.Force || forcedAlbum.Title != "Full metadata refresh for Spirit of Eden" {
+		t.Errorf("ReleaseGroupScope(db, mbid, true) = %q force=%v, want the forced reading", forcedAlbum.Title, forcedAlbum.Force)
+	}
 	// A forced pass says so in its title, so a queue entry and an event row are not
 	// indistinguishable from the cheap reading.
 	if !strings.Contains(forcedArtist.Title, "Full metadata refresh") {
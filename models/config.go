@@ -17,6 +17,17 @@ type DatabaseConfig struct {
 // which a genre list still reads as a description rather than a dump.
 const DefaultMaxGenres = 5
 
+// Embedded cover art limits, used when a profile leaves its own at zero. 500px is
+// the Cover Art Archive's middle thumbnail and plenty for a car head unit or a phone's
+// lock screen, both of which are where an embedded cover is actually looked at; a
+// player with a screen worth more reads the folder's cover.jpg. The byte cap is there
+// for the head units, several of which refuse a file whose picture is over a megabyte
+// rather than merely skipping the picture.
+const (
+	DefaultCoverArtMaxSize  = 500
+	DefaultCoverArtMaxBytes = 1 << 20
+)
+
 // Activity retention. Both figures are shared by every emitter that prunes or writes
 // the event tables — the processing runner and the metadata mirror — because they
 // write the same two tables and a feed pruned to two different depths would drop
@@ -33,6 +44,19 @@ const (
 	DefaultEventDetailRetention = 500
 )
 
+// DefaultProcessResumeHours is how long a processing run that stopped short stays
+// resumable: a run of the same scope starting within this many hours of it picks up
+// from its checkpoint. A day covers a restart, a container update and a stop pressed
+// by mistake; after that the library has had time to change under the checkpoint,
+// and walking it afresh is the safer reading of it.
+const DefaultProcessResumeHours = 24
+
+// DefaultTagJournalDays is how long the undo journal keeps a tag write's
+// before-values. A month covers noticing a bad edit at the next listen, or the next
+// weekly run; the journal holds every changed field of every file written, so a
+// longer reach is a bigger table.
+const DefaultTagJournalDays = 30
+
 // How the SMTP connection is encrypted. The default is Auto, which infers the answer
 // from the port and is right for every hosted provider; the explicit modes exist for
 // the self-hosted relay that gets it wrong — one that offers STARTTLS and fails the
@@ -78,6 +102,20 @@ type ConfigStruct struct {
 
 	AutotaggerrProcessCronSchedule string `json:"autotaggerr_process_cron_schedule"`
 	AutotaggerrProcessConcurrency  int    `json:"autotaggerr_process_concurrency"`
+	// AutotaggerrProcessFormatConcurrency caps how many files of one format a run has
+	// in flight, keyed by extension without the dot ({"flac": 2}). It narrows the
+	// worker count — a library's own, or the one above — and never widens it.
+	AutotaggerrProcessFormatConcurrency map[string]int `json:"autotaggerr_process_format_concurrency"`
+	// AutotaggerrProcessIOLimitMB is a ceiling, in megabytes per second, on the disk
+	// traffic file processing causes across every run. Zero is no ceiling.
+	AutotaggerrProcessIOLimitMB int `json:"autotaggerr_process_io_limit_mb"`
+	// AutotaggerrQuietHours is when scheduled work keeps its hands off the library,
+	// as daily windows: "18:00-23:30", several separated by commas. Empty is none.
+	AutotaggerrQuietHours string `json:"autotaggerr_quiet_hours"`
+	// AutotaggerrProcessResumeHours is how long a stopped or interrupted run can be
+	// resumed from its checkpoint (see DefaultProcessResumeHours). Zero means the
+	// default; a negative value turns resuming off, and every run walks from the top.
+	AutotaggerrProcessResumeHours int `json:"autotaggerr_process_resume_hours"`
 
 	// AutotaggerrEventRetention and AutotaggerrEventDetailRetention size the Activity
 	// feed: how many runs are kept, and how much per-file detail each one stores.
@@ -87,6 +125,10 @@ type ConfigStruct struct {
 	// Zero or less means the default.
 	AutotaggerrEventRetention       int `json:"autotaggerr_event_retention"`
 	AutotaggerrEventDetailRetention int `json:"autotaggerr_event_detail_retention"`
+	// AutotaggerrTagJournalDays is how long a tag write can be rolled back (see
+	// DefaultTagJournalDays). Zero means the default; a negative value turns the
+	// journal off, and with it rollback.
+	AutotaggerrTagJournalDays int `json:"autotaggerr_tag_journal_days"`
 
 	// MusicBrainz mirror. The mirror refreshes the local copy of every MusicBrainz
 	// entity the collection refers to on a schedule, so browsing reads the database
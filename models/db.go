@@ -45,6 +45,21 @@ const (
 	CorrelationSourceTags        = "tags"
 	CorrelationSourceFingerprint = "fingerprint"
 	CorrelationSourceManual      = "manual"
+	// CorrelationSourceImport is a file an inbox import placed on a release by its
+	// track number alone: the folder was identified — by a sibling's tags or
+	// fingerprints — and the file's number named the track.
+	CorrelationSourceImport = "import"
+
+	ImportModeMove = "move"
+	ImportModeCopy = "copy"
+
+	// What a tagger profile does with one tag; see TaggerProfile.TagPolicies.
+	// TagPolicyOverwrite is also what a key without a policy gets, but for the
+	// few DefaultTagPolicy names.
+	TagPolicyOverwrite = "overwrite"
+	TagPolicyFillEmpty = "fill_empty"
+	TagPolicyNever     = "never"
+	TagPolicyRemove    = "remove"
 
 	LibraryItemStatusOK        = "ok"
 	LibraryItemStatusUnmatched = "unmatched"
@@ -114,10 +129,39 @@ const (
 	// counters measured in images beside counters measured in MusicBrainz requests.
 	EventTypeArtwork = "artwork_refresh"
 	EventTypeHealth  = "health_check"
+	// EventTypeDuplicates is a duplicate resolved by hand: which copy was kept, and
+	// what happened to the others. Recorded because one of the two actions deletes
+	// audio, and that is not something to leave without a trace.
+	EventTypeDuplicates = "duplicates"
+	// EventTypeQuietHours is scheduled work held back by quiet hours: a job deferred
+	// until a window ends, or a running one paused at a file boundary. Recorded so a
+	// nightly run that started at seven in the morning has its reason in the feed.
+	EventTypeQuietHours = "quiet_hours"
+	// EventTypeRename is a library laid out by its naming template: every file moved,
+	// one row each, so where a file went is never a guess.
+	EventTypeRename = "rename"
+	// EventTypeImport is a library's inbox imported: one row per file, saying where
+	// it went or why it stayed.
+	EventTypeImport = "import"
+	// EventTypeRollback is journaled tag writes put back as they were: a run's, or
+	// one file's last. Its own writes are journaled too, so a rollback can be undone
+	// the same way.
+	EventTypeRollback = "rollback"
+	// EventTypeDryRun is a processing run or a Tag files that worked out what it would
+	// write and wrote nothing: one row per file that would change, and a count per tag.
+	EventTypeDryRun = "dry_run"
 
 	EventStatusRunning = "running"
 	EventStatusOK      = "ok"
 	EventStatusError   = "error"
+	// EventStatusCancelled is a run someone stopped. Its counters are what it did
+	// before it stopped, which is neither a success nor a failure.
+	EventStatusCancelled = "cancelled"
+	// EventStatusResumable is a processing run the service restarted under, closed at
+	// startup by events.ReconcileRunning with its checkpoint intact: the next run of
+	// the same scope carries on from it (see RunCheckpoint). A run interrupted before
+	// it had a checkpoint is closed as an error, as before.
+	EventStatusResumable = "resumable"
 
 	ManagedByAutotaggerr = "autotaggerr"
 	ManagedByLidarr      = "lidarr"
@@ -281,6 +325,39 @@ type TaggerProfile struct {
 	// Off by default; see TaggerSettings.MP3MultiValueTags for why it is a choice at
 	// all rather than simply correct.
 	MP3MultiValueTags bool `json:"mp3_multi_value_tags"`
+	// EmbedCoverArt writes the release's front cover into every file it tags. Off by
+	// default: it is a few hundred kilobytes per track, which a library of 50k tracks
+	// notices, and a first enable rewrites every file once.
+	EmbedCoverArt bool `json:"embed_cover_art"`
+	// CoverArtMaxSize is the largest edge, in pixels, an embedded cover may have, and
+	// CoverArtMaxBytes the largest it may be on disk. Zero or less means
+	// DefaultCoverArtMaxSize / DefaultCoverArtMaxBytes.
+	CoverArtMaxSize  int `json:"cover_art_max_size"`
+	CoverArtMaxBytes int `json:"cover_art_max_bytes"`
+	// The recording credit families, each written only when its switch is on. Off by
+	// default for the same reason as the cover: a first enable rewrites every file
+	// that has the credit, and a family nobody asked for is tags nobody reads.
+	WritePerformerCredits bool `json:"write_performer_credits"`
+	WriteProducerCredits  bool `json:"write_producer_credits"`
+	WriteEngineerCredits  bool `json:"write_engineer_credits"`
+	WriteMixerCredits     bool `json:"write_mixer_credits"`
+	WriteArrangerCredits  bool `json:"write_arranger_credits"`
+	// Locale names the script and language the profile wants names in, as a locale
+	// tag ("en", "ja-Latn"). Blank writes every name as the release spells it.
+	Locale string `json:"locale"`
+	// PreferTransliteratedTitles takes album and track titles from a pseudo-release
+	// that transliterates this one, when MusicBrainz links one in the locale's script.
+	PreferTransliteratedTitles bool `json:"prefer_transliterated_titles"`
+	// WriteReplayGain measures each file's loudness and writes its ReplayGain tags
+	// (R128 gain on Opus). Off by default: the first measurement decodes every file.
+	WriteReplayGain bool `json:"write_replay_gain"`
+	// TagPolicies overrides, per tag, what a write does with it: TagPolicyOverwrite
+	// (what a tag gets without an entry, ALBUMSORT aside; see DefaultTagPolicy),
+	// TagPolicyFillEmpty to write only into a file that has no value, TagPolicyNever
+	// to leave the file's value alone, and TagPolicyRemove to clear it whatever
+	// RemoveValues says. Keys are the upper-cased tag names the engines diff by
+	// ("GENRE", "TITLE"); see docs/tagging.md.
+	TagPolicies map[string]string `gorm:"serializer:json" json:"tag_policies"`
 }
 
 // TaggerSettings is the subset of a profile that the tag writers actually read: how
@@ -320,6 +397,65 @@ type TaggerSettings struct {
 	// joins repeated Vorbis comments on read, so the spec-correct form costs nothing
 	// there and is unconditional (see docs/tagging.md).
 	MP3MultiValueTags bool
+	// EmbedCoverArt, CoverArtMaxSize and CoverArtMaxBytes are the profile's cover
+	// policy; see TaggerProfile.
+	EmbedCoverArt    bool
+	CoverArtMaxSize  int
+	CoverArtMaxBytes int
+	// CoverArtEnabled and CoverArtBaseURL describe the Cover Art Archive data source
+	// the covers come from. They are not profile settings — data sources are
+	// configured once for the whole install — so Settings leaves them empty and the
+	// caller that holds the database fills them in (components.Tagger). A profile that
+	// embeds covers on an install with the source disabled embeds nothing.
+	CoverArtEnabled bool
+	CoverArtBaseURL string
+	// Credits is which recording credit families the profile writes.
+	Credits CreditFamilies
+	// Locale and PreferTransliteratedTitles are the profile's name localization;
+	// see TaggerProfile.
+	Locale                     string
+	PreferTransliteratedTitles bool
+	// ReplayGain is the profile's WriteReplayGain.
+	ReplayGain bool
+	// TagPolicies is the profile's; see TaggerProfile.
+	TagPolicies map[string]string
+	// LockedFields are the tags of the one file being written that nobody but its
+	// owner may change (LibraryItem.LockedFields). Not a profile setting either: the
+	// caller that knows which file it is writing fills them in (components.Tagger).
+	LockedFields []string
+}
+
+// defaultTagPolicies are the policies a tag has when the profile gives it none.
+// ALBUMSORT only fills: MusicBrainz keeps no sort name for a release, so its value is
+// the title, which is worth writing into a file with no sort title and never over one
+// somebody set by hand.
+var defaultTagPolicies = map[string]string{
+	"ALBUMSORT": TagPolicyFillEmpty,
+}
+
+// DefaultTagPolicy is the policy key has in a profile with no entry for it:
+// TagPolicyOverwrite for every tag but the few in defaultTagPolicies.
+func DefaultTagPolicy(key string) string {
+	if policy, ok := defaultTagPolicies[strings.ToUpper(key)]; ok {
+		return policy
+	}
+	return TagPolicyOverwrite
+}
+
+// TagPolicy is what a write does with key: TagPolicyNever for a field the file has
+// locked, whatever the profile says, then the profile's own policy for it, then
+// DefaultTagPolicy.
+func (s TaggerSettings) TagPolicy(key string) string {
+	key = strings.ToUpper(key)
+	for _, locked := range s.LockedFields {
+		if strings.ToUpper(locked) == key {
+			return TagPolicyNever
+		}
+	}
+	if policy, ok := s.TagPolicies[key]; ok && policy != "" {
+		return policy
+	}
+	return DefaultTagPolicy(key)
 }
 
 // Settings projects the stored profile onto the values the tag writers read.
@@ -333,6 +469,20 @@ func (t TaggerProfile) Settings() TaggerSettings {
 		IgnoreRedundantContributingArtists: t.IgnoreRedundantContributingArtists,
 		MaxGenres:                          t.MaxGenres,
 		MP3MultiValueTags:                  t.MP3MultiValueTags,
+		EmbedCoverArt:                      t.EmbedCoverArt,
+		CoverArtMaxSize:                    t.CoverArtMaxSize,
+		CoverArtMaxBytes:                   t.CoverArtMaxBytes,
+		Credits: CreditFamilies{
+			Performers: t.WritePerformerCredits,
+			Producers:  t.WriteProducerCredits,
+			Engineers:  t.WriteEngineerCredits,
+			Mixers:     t.WriteMixerCredits,
+			Arrangers:  t.WriteArrangerCredits,
+		},
+		Locale:                     t.Locale,
+		PreferTransliteratedTitles: t.PreferTransliteratedTitles,
+		ReplayGain:                 t.WriteReplayGain,
+		TagPolicies:                t.TagPolicies,
 	}
 }
 
@@ -356,6 +506,42 @@ type Library struct {
 	// "use_acoust_id", which reads like a typo and silently breaks any raw column
 	// reference written from the Go field or JSON name.
 	UseAcoustID bool `gorm:"column:use_acoustid" json:"use_acoustid"`
+	// WriteArtworkSidecars lets the artwork refresh put cover.jpg into this library's
+	// album folders and artist.jpg / fanart.jpg into its artist folders, for the media
+	// servers that read local images before anything embedded. Off by default: it is
+	// the one artwork feature that writes into the library rather than config/.
+	WriteArtworkSidecars bool `json:"write_artwork_sidecars"`
+	// Watch scans this library's folders as changes settle in them, instead of waiting
+	// for the next scheduled scan (see package watch). Off by default: it holds an
+	// inotify watch per folder, or polls the tree on a network mount.
+	Watch bool `json:"watch"`
+	// ProcessConcurrency is how many of this library's files a run processes at once,
+	// in place of autotaggerr_process_concurrency. Zero means that global value. It is
+	// per library because the libraries are often on different disks: spinning disks
+	// want few workers, an SSD wants many, and one number cannot suit both.
+	ProcessConcurrency int `json:"process_concurrency"`
+	// NamingTemplate lays the library's files out by their tags, e.g.
+	// "{albumartist}/{album} ({originalyear})/{disc:02}-{track:02} {title}" (see
+	// package rename). Empty leaves files where they are. Only a library Autotaggerr
+	// manages itself may be renamed: under Lidarr the layout is Lidarr's, and moving its
+	// files would only make it lose track of them.
+	NamingTemplate string `json:"naming_template"`
+	// InboxPath is a folder outside the library that files are dropped into to be
+	// imported: identified, placed by NamingTemplate (or rename.DefaultTemplate) and
+	// indexed (see package inbox). Empty means the library has no inbox. Like renaming,
+	// only a library Autotaggerr manages itself may have one.
+	InboxPath string `json:"inbox_path"`
+	// ImportMode is ImportModeMove (the default, for "") or ImportModeCopy, which
+	// leaves the inbox as it was — for an inbox a download client is still seeding
+	// from.
+	ImportMode string `json:"import_mode"`
+	// WatchMode is how the library is being watched right now — "inotify", "poll" — or
+	// "" when it is not. Filled in by the API like NextRun.
+	WatchMode string `gorm:"-" json:"watch_mode"`
+	// NextRun is when Cron next scans this library, filled in by the API from the
+	// installed schedule: nil when the library has no schedule of its own, or is
+	// disabled. Not stored — it is only ever as true as the scheduler.
+	NextRun *time.Time `gorm:"-" json:"next_run"`
 }
 
 // LibraryItem is the owned correlation index: one row per file, recording which
@@ -364,11 +550,15 @@ type Library struct {
 // detection and present/wanted reporting.
 type LibraryItem struct {
 	Base
-	LibraryID   uuid.UUID  `gorm:"type:uuid;index;not null" json:"library_id"`
-	Path        string     `gorm:"uniqueIndex;not null" json:"path"`
-	Size        int64      `json:"size"`
-	ModTime     *time.Time `json:"mod_time"`
-	ContentHash string     `json:"content_hash"`
+	LibraryID uuid.UUID  `gorm:"type:uuid;index;not null" json:"library_id"`
+	Path      string     `gorm:"uniqueIndex;not null" json:"path"`
+	Size      int64      `json:"size"`
+	ModTime   *time.Time `json:"mod_time"`
+	// ContentHash is modules.AudioHash of the file when it was last processed: a hash
+	// of the audio alone, so a tag write leaves it alone and a touched mtime cannot
+	// fake a change. It is what lets the skip check trust a file whose mtime a backup
+	// or rsync has reset.
+	ContentHash string `json:"content_hash"`
 
 	MBReleaseID      string `gorm:"index" json:"mb_release_id"`
 	MBRecordingID    string `json:"mb_recording_id"`
@@ -385,13 +575,26 @@ type LibraryItem struct {
 	CorrelatedAt        *time.Time `json:"correlated_at"`
 	LastScannedAt       *time.Time `json:"last_scanned_at"`
 	LastTaggedAt        *time.Time `json:"last_tagged_at"`
-	TagStateHash        string     `json:"tag_state_hash"`
+	// TagStateHash is modules.TagStateHash of the file as Autotaggerr last left it.
+	// A file whose audio still matches ContentHash but whose tags no longer match this
+	// has been edited by another tool.
+	TagStateHash string `json:"tag_state_hash"`
+	// TagsEditedAt is when a scan or re-tag last found the file's tags changed behind
+	// Autotaggerr's back (see TagStateHash). Nil when that has never been seen. It is
+	// kept after the file is re-tagged: the point is to say that something else is
+	// writing to this library.
+	TagsEditedAt *time.Time `json:"tags_edited_at"`
 	// ProcessedVersion records the app version that last processed this file. A
 	// scan only skips an unchanged file when the running version still matches, so
 	// upgrades that change tag logic re-process everything once.
 	ProcessedVersion string `json:"processed_version"`
 	// Pinned marks a manual correlation that automatic resolution must never override.
 	Pinned bool `json:"pinned"`
+	// DuplicateOfID is the item this file was detached in favour of, when someone
+	// resolved a duplicate by keeping the other copy (see GET /library-items/duplicates).
+	// A detached file stays on disk and in the index, but reads as unmatched and is
+	// walked past by every scan, so the collection counts the keeper alone.
+	DuplicateOfID *uuid.UUID `gorm:"type:uuid;index" json:"duplicate_of_id"`
 	// Status is what the *last attempt* did, not what the file is. The MB ID columns
 	// above are the file's identity and outlive any failure to act on it — a lookup
 	// that fails must not erase what a file is, or the file leaves the disk view and
@@ -412,6 +615,10 @@ type LibraryItem struct {
 	// matters most during an outage, when every file in a run fails at once and
 	// would otherwise be indistinguishable from a library full of broken files.
 	LastErrorTransient bool `json:"last_error_transient"`
+	// LockedFields are tags of this file no write changes, whatever its library's
+	// profile says — the hand-curated GENRE on one album, kept while everything else
+	// follows MusicBrainz. Upper-cased tag names, as in TaggerProfile.TagPolicies.
+	LockedFields []string `gorm:"serializer:json" json:"locked_fields"`
 }
 
 // TaggableItems is a GORM scope narrowing a LibraryItem query to the files a tag write
@@ -549,6 +756,20 @@ type ArtworkCacheEntry struct {
 	ExpiresAt   time.Time `json:"expires_at"`
 }
 
+// ArtworkSidecar records an image file Autotaggerr wrote into a library folder, and
+// the hash of what it wrote. That hash is the whole ownership rule: a cover.jpg is
+// ours to replace only while its bytes are still the bytes we put there. Anything
+// else — a file that was there first, or ours after someone swapped in a better scan
+// — belongs to the user and is never touched.
+//
+// A row, not a marker beside the image, because a marker is one more file in a folder
+// the media servers list, and one a tidy-minded user deletes.
+type ArtworkSidecar struct {
+	Base
+	Path   string `gorm:"uniqueIndex;not null" json:"path"`
+	SHA256 string `gorm:"column:sha256" json:"sha256"`
+}
+
 // MusicBrainz entity migration kinds and the entity types they apply to.
 //
 // MusicBrainz entities are mutable: they get merged into one another and, more
@@ -816,6 +1037,13 @@ type Event struct {
 	// few that are.
 	Stats []EventStat `gorm:"serializer:json" json:"stats,omitempty"`
 
+	// Checkpoint is how far a processing run's walk got, written while it runs and
+	// kept on the row when it stops short, so the next run of the same scope can pick
+	// up there. Nil on every other event, and cleared from a run's row once it has
+	// finished or been picked up. Not sent to the feed: it is the runner's bookkeeping,
+	// and `details.resumed_from` on the run that used it is the part worth showing.
+	Checkpoint *RunCheckpoint `gorm:"serializer:json" json:"-"`
+
 	// Items is the per-file detail (EventItem rows), attached by the single-event
 	// endpoint only — never stored on this row and never loaded for the feed, where
 	// 50 events would drag thousands of rows behind them.
@@ -834,6 +1062,34 @@ type Event struct {
 	// stops "Tagging" being unmoored, and it is filled in for every stage row rather
 	// than only for a filtered feed.
 	ParentTitle string `gorm:"-" json:"parent_title,omitempty"`
+
+	// Journaled is how many of this event's tag writes, and its stages', the undo
+	// journal still holds and no rollback has dealt with — what a rollback of it
+	// would try to put back. Filled in by the single-event endpoint.
+	Journaled int `gorm:"-" json:"journaled,omitempty"`
+}
+
+// RunCheckpoint is where a processing run stood when it last recorded its progress.
+//
+// Roots are keyed "<library id>:<root path>", since the same folder can be a root of
+// two libraries. A root the walk finished is in Done; one it was part-way through has
+// its modules.WalkMark point in Reached. Retry is the files of a root that failed:
+// the point has moved past them, so they are listed for the resumed run to process
+// again and report, and a finished root with failures stays in Reached rather than
+// Done. Drift is the releases the run's refresh found changed upstream, kept because
+// the refresh that found them has already updated the cache — a resumed run's own
+// refresh would not find them again, and their files would never be re-tagged.
+type RunCheckpoint struct {
+	// Scope identifies what the run covered (see process.scopeKey). A checkpoint is
+	// only ever picked up by a run of the same scope.
+	Scope string `json:"scope"`
+	// WalkStarted is when the first run of the chain began walking, so a resumed run's
+	// album-gain pass still covers the releases the earlier one scanned.
+	WalkStarted time.Time           `json:"walk_started"`
+	Done        []string            `json:"done,omitempty"`
+	Reached     map[string]string   `json:"reached,omitempty"`
+	Retry       map[string][]string `json:"retry,omitempty"`
+	Drift       []string            `json:"drift,omitempty"`
 }
 
 // EventStat is one counter on an event's detail view.
@@ -865,10 +1121,24 @@ const (
 // value (empty when the field was absent), New the value written. Stored as JSON on
 // the EventItem that owns it: a diff is only ever read together with its file, so it
 // needs no table of its own.
+//
+// Before and After are the raw values Old and New describe, carried from the writer
+// to the undo journal (TagJournalEntry) and never stored on the event row, which only
+// ever shows them. Both are nil on the cover row: a picture is described, not kept,
+// so it cannot be put back.
 type TagChange struct {
+	Field  string   `json:"field"`
+	Old    string   `json:"old"`
+	New    string   `json:"new"`
+	Before []string `json:"-"`
+	After  []string `json:"-"`
+}
+
+// TagChangeCount is one line of a dry run's per-tag summary: a tag, and on how many
+// files the run would change it. Kept in the event's details as tag_summary.
+type TagChangeCount struct {
 	Field string `json:"field"`
-	Old   string `json:"old"`
-	New   string `json:"new"`
+	Files int    `json:"files"`
 }
 
 // EventItem is one file's outcome within an Event — the per-file detail behind a
@@ -997,6 +1267,23 @@ const (
 	// source used to have it and says so) and from Error (we could not ask) — this is
 	// a complete answer that happens to be "no".
 	EventItemStatusUnknown = "unknown"
+	// EventItemStatusDetached and EventItemStatusDeleted are what a resolved
+	// duplicate did to a copy that was not kept: left on disk but out of the
+	// collection, or removed from disk.
+	EventItemStatusDetached = "detached"
+	EventItemStatusDeleted  = "deleted"
+	// EventItemStatusMoved is a file a rename moved, and EventItemStatusSkipped one it
+	// left where it was because moving it would have gone wrong — its Error says why.
+	EventItemStatusMoved   = "moved"
+	EventItemStatusSkipped = "skipped"
+	// EventItemStatusImported is an inbox file placed in the library, and
+	// EventItemStatusUnidentified one that stayed in the inbox because nothing could
+	// say what it is; it waits in the attach flow.
+	EventItemStatusImported     = "imported"
+	EventItemStatusUnidentified = "unidentified"
+	// EventItemStatusWouldChange is a file a dry run found it would write, with the
+	// changes it would make. Nothing was written to it.
+	EventItemStatusWouldChange = "would_change"
 )
 
 // What an EventItem describes. Empty (EventItemKindFile) is the default and covers
@@ -1009,6 +1296,19 @@ const (
 	// the outcome is whether Plex accepted the request — no tags were written and no
 	// MBID was read, so both of the other renderings would say something untrue.
 	EventItemKindAlbum = "album"
+	// EventItemKindSidecar is an image file the artwork refresh wrote into a library
+	// folder. A file, but not an audio file: rendered as one would report "0 tags
+	// written" about something that has no tags.
+	EventItemKindSidecar = "sidecar"
+	// EventItemKindDuplicate is a copy of a duplicate that was not kept. An audio
+	// file, but one nothing wrote tags to — its row says what was done with it.
+	EventItemKindDuplicate = "duplicate"
+	// EventItemKindMove is a file a rename moved or meant to. Path is where it was; its
+	// one Changes entry, field "path", is where it went.
+	EventItemKindMove = "move"
+	// EventItemKindImport is an inbox file. Path is where it was dropped; an imported
+	// one's Changes entry, field "path", is where it went.
+	EventItemKindImport = "import"
 )
 
 // Stage of a run a detail row belongs to. Empty means the ordinary scan-walk file row.
@@ -1025,6 +1325,9 @@ const (
 	// tagging event, and the phase is what keeps the two halves of it apart in the
 	// detail list — they answer different questions about the same run.
 	EventItemPhaseDrift = "drift"
+	// EventItemPhaseAlbumGain is a file rewritten because another file of its release
+	// changed the release's album gain.
+	EventItemPhaseAlbumGain = "album_gain"
 )
 
 // CollectionArtist is a MusicBrainz artist present in (or monitored for) the
@@ -1265,6 +1568,99 @@ type AcoustIDLookup struct {
 	FetchedAt  time.Time  `json:"fetched_at"`
 }
 
+// LoudnessAnalysis caches one file's loudness measurement for ReplayGain.
+//
+// It is keyed by path and invalidated by size/mtime, as AcoustIDLookup is, because
+// the decode is the expensive part and a library's audio rarely changes. A tag write
+// changes both, so the writer moves the row onto the file's new identity after a write
+// of its own (the audio it measured is untouched); anything else that changes the file
+// costs one new measurement.
+type LoudnessAnalysis struct {
+	Path    string     `gorm:"primarykey" json:"path"`
+	Size    int64      `json:"size"`
+	ModTime *time.Time `json:"mod_time"`
+	// AnalyzerVersion is the meter that measured it. A row from another version is
+	// measured again, so a fix to the meter reaches files already measured.
+	AnalyzerVersion int `json:"analyzer_version"`
+	// Histogram is the file's gating blocks, binned by loudness with each bin's exact
+	// energy (JSON). It is kept instead of one integrated figure because an album's
+	// loudness gates the blocks of all its tracks together, which no combination of
+	// the tracks' own figures reproduces.
+	Histogram  string    `gorm:"type:text" json:"-"`
+	Peak       float64   `json:"peak"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+}
+
+// ImportedFile remembers an inbox file a copy-mode import has already copied, so
+// the next import passes over it instead of finding its copy in the way. It is keyed
+// by path and matched by size/mtime, as AcoustIDLookup is: a file replaced in the
+// inbox under the same name is imported again.
+type ImportedFile struct {
+	Path       string     `gorm:"primarykey" json:"path"`
+	LibraryID  uuid.UUID  `gorm:"type:uuid;index" json:"library_id"`
+	Size       int64      `json:"size"`
+	ModTime    *time.Time `json:"mod_time"`
+	Target     string     `json:"target"`
+	ImportedAt time.Time  `json:"imported_at"`
+}
+
+// TagJournalEntry is the undo record of one tag write: the fields a run changed on
+// one file, with their values before and after. The Activity feed keeps a
+// description of the same change (EventItem.Changes), but it is capped per event and
+// describes rather than keeps the values, so it cannot put a file back. The journal
+// is not capped — a bad MusicBrainz edit that rewrote thousands of files is exactly
+// the case it exists for — and is pruned by age instead
+// (autotaggerr_tag_journal_days).
+//
+// EventID is the event whose detail rows list the write, which for a processing run
+// is its tagging stage. LibraryItemID is resolved by path when the entry is written
+// and is nil for a file not yet indexed; a rollback goes by it where it can, so a
+// file renamed since is still found.
+type TagJournalEntry struct {
+	Base
+	EventID       uuid.UUID       `gorm:"type:uuid;index;not null" json:"event_id"`
+	LibraryItemID *uuid.UUID      `gorm:"type:uuid;index" json:"library_item_id,omitempty"`
+	Path          string          `gorm:"index" json:"path"`
+	Changes       []JournalChange `gorm:"serializer:json" json:"changes"`
+	// Undoes is the entry a rollback wrote this one by putting back. A file's own
+	// rollback skips these, so pressing it twice steps further back rather than
+	// undoing the undo; rolling back the rollback's event is how that is done.
+	Undoes *uuid.UUID `gorm:"type:uuid" json:"undoes,omitempty"`
+	// RolledBackAt and RollbackEventID are set once a rollback has dealt with the
+	// entry, whether it restored every field or kept some that had changed since.
+	RolledBackAt    *time.Time `json:"rolled_back_at,omitempty"`
+	RollbackEventID *uuid.UUID `gorm:"type:uuid" json:"rollback_event_id,omitempty"`
+}
+
+// JournalChange is one field of a TagJournalEntry: the key as the file's format
+// spells it, and its raw values either side of the write. Empty Before means the
+// field was absent and a rollback removes it.
+type JournalChange struct {
+	Field  string   `json:"field"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+// QueuedJob is one job waiting in the processing queue, kept so the queue outlives
+// the process. The runner rewrites the table whenever the queue changes and replays
+// it at the next start.
+//
+// A job is stored as its key — the verb and its scope, "retag_library:<id>" — rather
+// than as the work it resolved to. Replaying the verb re-resolves the scope against
+// the database as it is at the next start, so a library deleted in between drops its
+// jobs instead of scanning a folder that no longer belongs to anything. Title is kept
+// for the log line that says what was dropped.
+type QueuedJob struct {
+	Key      string `gorm:"primarykey" json:"key"`
+	Kind     string `gorm:"not null" json:"kind"`
+	Title    string `json:"title"`
+	Position int    `gorm:"index" json:"position"`
+	// Unattended marks a job nobody asked for — a schedule's or the watcher's — which
+	// quiet hours hold back. Stored so a restart inside a window does not promote the
+	// night's scheduled scan to one that runs straight away.
+	Unattended bool `json:"unattended"`
+}
+
 // CollectionRelease is one *edition* you own files of, under a release-group.
 //
 // It exists because collapsing a release-group to its best-owned edition throws
@@ -1375,6 +1771,7 @@ func AllDBModels() []any {
 		&MusicbrainzEntityCache{},
 		&ProviderCache{},
 		&ArtworkCacheEntry{},
+		&ArtworkSidecar{},
 		&MusicbrainzMigration{},
 		&User{},
 		&AuthProvider{},
@@ -1386,5 +1783,9 @@ func AllDBModels() []any {
 		&CollectionRelease{},
 		&CollectionDesire{},
 		&AcoustIDLookup{},
+		&LoudnessAnalysis{},
+		&ImportedFile{},
+		&TagJournalEntry{},
+		&QueuedJob{},
 	}
 }
@@ -19,6 +19,10 @@ type TagDiffEntry struct {
 	Current string `json:"current"`
 	Desired string `json:"desired"`
 	Changed bool   `json:"changed"`
+	// Policy is the profile's policy for the tag when it is not a plain overwrite
+	// (TaggerProfile.TagPolicies), and Locked says the file's own lock is why.
+	Policy string `json:"policy,omitempty"`
+	Locked bool   `json:"locked,omitempty"`
 }
 
 // FileTags is what Autotaggerr wants a file to say, one field per concept rather
@@ -40,8 +44,26 @@ type FileTags struct {
 	// AlbumArtists carries the whole credit for players that can read it — without
 	// it the names disagreed with MBAlbumArtistIDs, which has always listed every
 	// credited artist.
-	AlbumArtist           string   `json:"album_artist"`
-	AlbumArtists          []string `json:"album_artists"`
+	AlbumArtist  string   `json:"album_artist"`
+	AlbumArtists []string `json:"album_artists"`
+	// ArtistSort and AlbumArtistSort are Artist and AlbumArtist spelled with the
+	// artists' MusicBrainz sort names, so "The Beatles" files under B. AlbumSort is
+	// the release title: MusicBrainz keeps no sort name for a release, so it is only
+	// ever written into a file without one (see DefaultTagPolicy).
+	ArtistSort      string `json:"artist_sort"`
+	AlbumArtistSort string `json:"album_artist_sort"`
+	AlbumSort       string `json:"album_sort"`
+	// NativeArtist, NativeAlbumArtist, NativeAlbum and NativeTitle are the names as
+	// the release spells them, kept when the profile's locale replaced them and blank
+	// when it did not. LocalizedArtists and LocalizedTitles say whether the profile
+	// localizes those names at all; the native tags are written only when it does, so
+	// a profile without a locale leaves another tool's native tags alone.
+	NativeArtist          string   `json:"native_artist"`
+	NativeAlbumArtist     string   `json:"native_album_artist"`
+	NativeAlbum           string   `json:"native_album"`
+	NativeTitle           string   `json:"native_title"`
+	LocalizedArtists      bool     `json:"-"`
+	LocalizedTitles       bool     `json:"-"`
 	Genres                []string `json:"genres"`
 	OriginalDate          string   `json:"original_date"`
 	OriginalYear          string   `json:"original_year"`
@@ -68,12 +90,84 @@ type FileTags struct {
 	Media                 string   `json:"media"`
 	Barcode               string   `json:"barcode"`
 	CatalogNumbers        []string `json:"catalog_numbers"`
-	// ASIN, Composer and Author used to sit here. Nothing ever populated them —
-	// BuildFileTags hardcoded all three to "" — and neither tag map reads them, so
-	// they were three fields whose only possible effect was clearing another
-	// tagger's value under remove_values. MusicBrainz can supply composer (via work
-	// relations) and ASIN (on the release); adding either back is a fetch and a
-	// mapping, not a field on this struct.
+	// Composers, Lyricists and Writers are the artists credited on the works this
+	// recording performs, and Works and MBWorkIDs those works. A medley performs
+	// several, so every one is a list. Writer is MusicBrainz's "composer and/or
+	// lyricist" — the credit when nobody has said which — and is kept apart rather
+	// than guessed into either.
+	Composers []string `json:"composers"`
+	Lyricists []string `json:"lyricists"`
+	Writers   []string `json:"writers"`
+	Works     []string `json:"works"`
+	MBWorkIDs []string `json:"mm_work_ids"`
+	// WorkCredits reports whether the five fields above are known. A release cached
+	// before the fetch asked for work relations has none to offer, and writing its
+	// empty lists would read as "nobody wrote this" — under remove_values, clearing a
+	// composer another tagger got right. When false the writers leave those tags alone.
+	WorkCredits bool `json:"-"`
+	// Performers, Producers, Engineers, Mixers and Arrangers are the artists the
+	// recording's own relationships credit. A performer carries the instrument or
+	// voice they are credited for, which the formats store beside the name.
+	Performers []PerformerCredit `json:"performers"`
+	Producers  []string          `json:"producers"`
+	Engineers  []string          `json:"engineers"`
+	Mixers     []string          `json:"mixers"`
+	Arrangers  []string          `json:"arrangers"`
+	// RecordingCredits is which of those five families the writers may touch: the
+	// ones the profile asked for, and only when the release was fetched with its
+	// relations. A family left out is left alone on the file, for WorkCredits' reason.
+	RecordingCredits CreditFamilies `json:"-"`
+	// FrontCover is the release's front cover to embed. Nil means there is nothing to
+	// say about pictures — the profile does not embed covers, or none could be had —
+	// and a writer leaves whatever picture the file carries alone.
+	FrontCover *CoverArt `json:"-"`
+	// TrackGain and AlbumGain are the loudness of this file and of its whole release,
+	// for ReplayGain. Nil means not measured — the profile does not ask, the format has
+	// no decoder, or the release is not all on disk yet — and a writer leaves the gain
+	// tags alone rather than clear what another analyser measured.
+	TrackGain *Loudness `json:"-"`
+	AlbumGain *Loudness `json:"-"`
+	// Restore, when set, makes the write a rollback rather than a tagging: the
+	// writer leaves every other field of the metadata aside and puts exactly these
+	// keys back to exactly these raw values, an empty list removing the key. Keys are
+	// spelled as the format's own reader reports them (see TagJournalEntry).
+	Restore map[string][]string `json:"-"`
+	// ASIN and Author used to sit here, beside a Composer that was never populated
+	// either — BuildFileTags hardcoded all three to "" — so their only possible effect
+	// was clearing another tagger's value under remove_values. Composer came back as
+	// Composers once the work relations were fetched; MusicBrainz can supply ASIN on
+	// the release, and adding it back is a mapping, not a field on this struct.
+}
+
+// PerformerCredit is one performer and what they are credited with playing or singing.
+// Role is blank for a performer credited with neither.
+type PerformerCredit struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// CreditFamilies names the recording credit families, one switch each.
+type CreditFamilies struct {
+	Performers bool
+	Producers  bool
+	Engineers  bool
+	Mixers     bool
+	Arrangers  bool
+}
+
+// CoverArt is an image to embed, with the facts the formats want stored beside it.
+type CoverArt struct {
+	Data     []byte
+	MIMEType string
+	Width    int
+	Height   int
+}
+
+// Loudness is one measurement of programme loudness: the gated integrated loudness of
+// ITU-R BS.1770 in LUFS, and the sample peak as a fraction of full scale.
+type Loudness struct {
+	Integrated float64
+	Peak       float64
 }
 
 type CachedMusicBrainzRelease struct {
@@ -73,6 +73,10 @@ type MusicBrainzReleaseResponse struct {
 		Script   string `json:"script"`
 	} `json:"text-representation"`
 	Barcode string `json:"barcode"`
+	// Relations are the release's relationships to other releases — among them the
+	// translated and transliterated tracklistings. Nil on a release cached before the
+	// fetch asked for them, for the reason Track's recording relations are.
+	Relations []Relation `json:"relations"`
 }
 
 type Track struct {
@@ -95,6 +99,12 @@ type Track struct {
 			Name  string `json:"name"`
 			Count int    `json:"count"`
 		} `json:"tags"`
+		// Relations are the recording's own relationships: the works it performs, and
+		// through them who wrote them. Nil — not empty — on a release cached before the
+		// fetch asked for them, which is how FetchedWithRelations tells "nobody is
+		// credited" from "we never asked". No omitempty, so the difference survives the
+		// round trip through the cache.
+		Relations []Relation `json:"relations"`
 	} `json:"recording"`
 	Number       string         `json:"number"`
 	ArtistCredit []ArtistCredit `json:"artist-credit"`
@@ -122,6 +132,58 @@ type Track struct {
 // false for everything, which is exactly the behaviour that predates this rule.
 func (t Track) IsVideo() bool { return t.Recording.Video }
 
+// Relation is one MusicBrainz relationship, from the entity that carries it to the
+// one named by TargetType — whose payload is the only one of Artist, Work and Release filled in.
+type Relation struct {
+	Type       string   `json:"type"`
+	TypeID     string   `json:"type-id"`
+	TargetType string   `json:"target-type"`
+	Direction  string   `json:"direction"`
+	Attributes []string `json:"attributes"`
+	// TargetCredit is the name the target is credited under on this relationship,
+	// blank when it is credited under its own name.
+	TargetCredit string          `json:"target-credit"`
+	Artist       *Artist         `json:"artist,omitempty"`
+	Work         *Work           `json:"work,omitempty"`
+	Release      *RelatedRelease `json:"release,omitempty"`
+}
+
+// RelatedRelease is a release as it hangs off another release's relationship: enough
+// to say what it is without fetching it.
+type RelatedRelease struct {
+	ID                 string `json:"id"`
+	Title              string `json:"title"`
+	Status             string `json:"status"`
+	TextRepresentation struct {
+		Language string `json:"language"`
+		Script   string `json:"script"`
+	} `json:"text-representation"`
+}
+
+// Work is a composition, as it hangs off a recording's performance relationship.
+// Its Relations are where the composer, lyricist and writer credits live.
+type Work struct {
+	ID             string     `json:"id"`
+	Title          string     `json:"title"`
+	Disambiguation string     `json:"disambiguation"`
+	Relations      []Relation `json:"relations"`
+}
+
+// FetchedWithRelations reports whether this release was fetched with its recording and
+// work relationships. Releases cached before the fetch asked for them carry none, and
+// stay that way until their cache entry expires; until then their work credits are
+// unknown, which is not the same as absent.
+func (r MusicBrainzReleaseResponse) FetchedWithRelations() bool {
+	for _, media := range r.Media {
+		for _, track := range media.Tracks {
+			if track.Recording.Relations == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 type Artist struct {
 	ID   string `json:"id"`
 	Tags []struct {
@@ -140,6 +202,21 @@ type Artist struct {
 	Type    string `json:"type"`
 	Country string `json:"country"`
 	TypeID  string `json:"type-id"`
+	// Aliases are the artist's other names, each for a locale or none. Nil when the
+	// fetch did not ask for them, which a profile's locale preference reads as "no
+	// localized name to offer" rather than "none exists".
+	Aliases []Alias `json:"aliases"`
+}
+
+// Alias is one of an artist's other names. Primary marks the one MusicBrainz editors
+// chose for its locale.
+type Alias struct {
+	Name     string `json:"name"`
+	SortName string `json:"sort-name"`
+	Locale   string `json:"locale"`
+	Type     string `json:"type"`
+	Primary  bool   `json:"primary"`
+	Ended    bool   `json:"ended"`
 }
 
 type ArtistCredit struct {
@@ -4,8 +4,9 @@
 //
 // Everything here is optional and fails soft. A missing cover is not an error —
 // it is the normal case for obscure releases — so a failed lookup returns
-// ErrNoArtwork and the UI falls back to a monogram tile. Nothing in the tagging
-// pipeline depends on this file.
+// ErrNoArtwork and the UI falls back to a monogram tile. The tagging pipeline reads
+// release covers from here when a profile embeds them (see cover.go), and treats a
+// missing one the same way: the file is tagged without a new picture.
 //
 // Three properties make it safe to call from a table with a hundred rows:
 //
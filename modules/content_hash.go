@@ -0,0 +1,250 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AudioHash returns a sha256 of a file's audio payload: everything a tag write cannot
+// touch. Two files share it exactly when they hold the same encoded audio, whatever
+// their tags, padding or modification time say.
+//
+// It exists because size and mtime are a poor witness to "this file is unchanged".
+// rsync, backup restores and NAS snapshots rewrite the mtime of files whose bytes
+// never moved, and a scan that trusts the mtime alone re-processes the whole library
+// after every one of them. The audio hash is the second opinion the skip check asks
+// for before believing it.
+//
+// What counts as the payload is decided per container, by the same readers the
+// writers use — so "excluded" means precisely the bytes the writers rewrite:
+//
+//   - FLAC: every byte after the last metadata block (and any ID3v2 prefix).
+//   - MP3: the file without its leading ID3v2 tag and trailing ID3v1 tag.
+//   - Ogg: the granule and payload of every page after the header packets. Not the
+//     pages themselves — a comment packet that grows renumbers and re-checksums every
+//     page after it, without changing a sample.
+//   - MP4: the payload of every mdat atom. moov moves and grows on a tag write, and
+//     the chunk offsets inside it move with it.
+func AudioHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		err = hashFLACAudio(file, sum)
+	case ".mp3":
+		err = hashMP3Audio(file, sum)
+	case ".ogg", ".opus":
+		err = hashOggAudio(file, sum)
+	case ".m4a":
+		err = hashMP4Audio(file, sum)
+	default:
+		return "", errors.New("unsupported file type")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the audio of %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// hashFLACAudio hashes the frames, which start where readFLACMetadata stopped.
+func hashFLACAudio(file *os.File, sum hash.Hash) error {
+	metadata, err := readFLACMetadata(file)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(sum, io.NewSectionReader(file, metadata.audioOffset, info.Size()-metadata.audioOffset))
+	return err
+}
+
+// hashMP3Audio hashes what is left between the ID3v2 tag in front and the ID3v1 tag
+// behind. The ID3v1 trailer is excluded even though the current engine never writes
+// one: stripID3v1 removes it on the first write, and that must not read as new audio.
+func hashMP3Audio(file *os.File, sum hash.Hash) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	start, end := int64(0), info.Size()
+
+	header := make([]byte, 10)
+	if n, _ := file.ReadAt(header, 0); n == len(header) && bytes.HasPrefix(header, []byte("ID3")) {
+		size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+		start = 10 + size
+		if header[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+	}
+
+	magic := make([]byte, 4)
+	if end-start >= id3v1TagSize {
+		if _, err := file.ReadAt(magic[:3], end-id3v1TagSize); err != nil {
+			return err
+		}
+		if string(magic[:3]) == "TAG" {
+			end -= id3v1TagSize
+			if end-start >= id3v1ExtendedTagSize {
+				if _, err := file.ReadAt(magic, end-id3v1ExtendedTagSize); err != nil {
+					return err
+				}
+				if string(magic) == "TAG+" {
+					end -= id3v1ExtendedTagSize
+				}
+			}
+		}
+	}
+	if end < start {
+		return errors.New("ID3v2 tag runs past the end of the file")
+	}
+	_, err = io.Copy(sum, io.NewSectionReader(file, start, end-start))
+	return err
+}
+
+// hashOggAudio hashes the pages after the header packets, by content rather than by
+// their bytes on disk (see AudioHash).
+func hashOggAudio(file *os.File, sum hash.Hash) error {
+	// Buffered: the page reader asks for a few bytes at a time.
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if _, err := readOggHeaders(reader); err != nil {
+		return err
+	}
+	granule := make([]byte, 8)
+	for {
+		page, err := readOggPage(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(granule, page.Granule)
+		sum.Write(granule)
+		sum.Write(page.Data)
+	}
+}
+
+// hashMP4Audio hashes each top-level mdat atom's payload, walking only the atom
+// headers in between the way readMP4Moov does.
+func hashMP4Audio(file *os.File, sum hash.Hash) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+
+	found := false
+	header := make([]byte, 16)
+	for offset := int64(0); offset < end; {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return errors.New("truncated MP4 atom header")
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return errors.New("truncated MP4 atom header")
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return fmt.Errorf("MP4 atom %q runs past the end of the file", kind)
+		}
+		if kind == "mdat" {
+			found = true
+			if _, err := io.Copy(sum, io.NewSectionReader(file, offset+headerSize, size-headerSize)); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	if !found {
+		return fmt.Errorf("%w: no mdat atom", ErrMP4Unsupported)
+	}
+	return nil
+}
+
+// GetFileTagsMap reads a file's tags in the shape its format's diff works on:
+// Vorbis comment keys for FLAC and Ogg, the ID3 and MP4 readers' keys otherwise.
+func GetFileTagsMap(filePath string) (map[string][]string, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		return getFlacTagsMap(filePath)
+	case ".ogg", ".opus":
+		return getOggTagsMap(filePath)
+	case ".mp3":
+		return GetMP3Tags(filePath)
+	case ".m4a":
+		return GetMP4Tags(filePath)
+	default:
+		return nil, errors.New("unsupported file type")
+	}
+}
+
+// TagStateHash returns a sha256 of a file's tags as they are on disk now. Recorded
+// after every write, it is what tells "the file is as Autotaggerr left it" apart from
+// "another tool has been at its tags" — which size and mtime cannot, once something
+// has reset the mtime.
+func TagStateHash(filePath string) (string, error) {
+	tags, err := GetFileTagsMap(filePath)
+	if err != nil {
+		return "", err
+	}
+	return hashTags(tags), nil
+}
+
+// hashTags hashes a tag map independently of the order it was read in. Keys are
+// compared upper-cased, as every diff in the app compares them; values keep their
+// order, since that is part of what a multi-value tag says.
+func hashTags(tags map[string][]string) string {
+	raw := make([]string, 0, len(tags))
+	for key := range tags {
+		raw = append(raw, key)
+	}
+	sort.Strings(raw) // two spellings of one key merge in a fixed order
+
+	keys := make([]string, 0, len(tags))
+	byKey := make(map[string][]string, len(tags))
+	for _, key := range raw {
+		upper := strings.ToUpper(key)
+		if _, ok := byKey[upper]; !ok {
+			keys = append(keys, upper)
+		}
+		byKey[upper] = append(byKey[upper], tags[key]...)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.New()
+	for _, key := range keys {
+		sum.Write([]byte(key))
+		for _, value := range byKey[key] {
+			sum.Write([]byte{0x1f})
+			sum.Write([]byte(value))
+		}
+		sum.Write([]byte{0x1e})
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// A tag write — including one that outgrows the file's padding and moves the audio —
+// must leave the audio hash exactly where it was, and the tag hash somewhere else.
+// Each container is written the way that disturbs it most.
+func TestAudioHashSurvivesTagWrites(t *testing.T) {
+	meta := models.FileTags{Title: "Title", Genres: []string{strings.Repeat("g", 70000)}}
+
+	for _, tc := range []struct {
+		name string
+		path func(t *testing.T) string
+	}{
+		{"flac outgrowing its padding", func(t *testing.T) string {
+			return synthFLAC(t, nil, commentBlock(), paddingBlock(16))
+		}},
+		{"ogg headers growing a page", func(t *testing.T) string {
+			path, _ := synthOgg(t, oggVorbis, ".ogg", nil, 4, 300)
+			return path
+		}},
+		{"mp4 moov in front of mdat", func(t *testing.T) string {
+			return synthMP4(t, nil, false)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := tc.path(t)
+			audioBefore, err := AudioHash(path)
+			if err != nil {
+				t.Fatalf("AudioHash: %v", err)
+			}
+			tagsBefore, err := TagStateHash(path)
+			if err != nil {
+				t.Fatalf("TagStateHash: %v", err)
+			}
+
+			if _, _, _, err := SetFileTags(path, meta, models.TaggerSettings{}); err != nil {
+				t.Fatalf("SetFileTags: %v", err)
+			}
+
+			if got, err := AudioHash(path); err != nil || got != audioBefore {
+				t.Errorf("AudioHash after a tag write = %q, %v; want it unchanged", got, err)
+			}
+			if got, err := TagStateHash(path); err != nil || got == tagsBefore {
+				t.Errorf("TagStateHash after a tag write = %q, %v; want it changed", got, err)
+			}
+		})
+	}
+}
+
+// The MP3 payload is what sits between the two ID3 tags, so neither tag — nor
+// stripping the ID3v1 trailer, which the first write does — reads as new audio.
+func TestAudioHashExcludesID3Tags(t *testing.T) {
+	frames := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 500)
+	id3v2 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x14"), bytes.Repeat([]byte{0}, 20)...)
+
+	write := func(parts ...[]byte) string {
+		path := filepath.Join(t.TempDir(), "track.mp3")
+		if err := os.WriteFile(path, slices.Concat(parts...), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bare, err := AudioHash(write(frames))
+	if err != nil {
+		t.Fatalf("AudioHash: %v", err)
+	}
+	tagged, err := AudioHash(write(id3v2, frames, id3v1ExtendedBlock(), id3v1Block()))
+	if err != nil {
+		t.Fatalf("AudioHash: %v", err)
+	}
+	if tagged != bare {
+		t.Error("the ID3 tags were hashed as audio")
+	}
+
+	other, err := AudioHash(write(id3v2, frames[1:], id3v1Block()))
+	if err != nil {
+		t.Fatalf("AudioHash: %v", err)
+	}
+	if other == bare {
+		t.Error("different audio hashed the same")
+	}
+}
+
+// The tag hash is a fact about the tags, not about the order a reader returned them
+// in or how a key was spelled.
+func TestHashTagsIgnoresOrderAndKeyCase(t *testing.T) {
+	a := hashTags(map[string][]string{"TITLE": {"Intro"}, "genre": {"Hip Hop", "Rap"}})
+	b := hashTags(map[string][]string{"GENRE": {"Hip Hop", "Rap"}, "title": {"Intro"}})
+	if a != b {
+		t.Error("the same tags hashed differently")
+	}
+	if c := hashTags(map[string][]string{"TITLE": {"Intro"}, "GENRE": {"Rap", "Hip Hop"}}); c == a {
+		t.Error("reordering a multi-value tag did not change the hash")
+	}
+	if d := hashTags(map[string][]string{"TITLE": {"Intro", ""}, "GENRE": {"Hip Hop", "Rap"}}); d == a {
+		t.Error("an extra empty value did not change the hash")
+	}
+}
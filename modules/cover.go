@@ -0,0 +1,130 @@
+package modules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // DecodeConfig for the dimensions a FLAC PICTURE block stores
+	_ "image/png"
+	"path/filepath"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// Embedded cover art: the release's front cover, written into the files themselves
+// for the players that never see the folder — a car stereo reading a USB stick, a
+// phone syncing a playlist. It comes out of the same artwork cache the web UI reads,
+// so embedding a cover into an album's twelve tracks costs one download, usually
+// none, since the UI has fetched it already.
+
+// frontCoverForRelease returns the cover to embed for a release under the profile's
+// policy, or nil when there is none to embed. Nil is not an error and leaves the
+// file's own picture alone, so a provider outage costs a scan its covers and nothing
+// else.
+//
+// The policy is met by choosing, not by resizing: the Cover Art Archive serves 250,
+// 500 and 1200px thumbnails, and the largest that fits both the edge and the byte
+// limit wins. Re-encoding here would mean a JPEG encoder and a second lossy
+// generation of an image that already exists at a size that fits.
+func frontCoverForRelease(releaseID string, tagger models.TaggerSettings) *models.CoverArt {
+	if !tagger.EmbedCoverArt || !tagger.CoverArtEnabled || releaseID == "" {
+		return nil
+	}
+	maxSize := tagger.CoverArtMaxSize
+	if maxSize <= 0 {
+		maxSize = models.DefaultCoverArtMaxSize
+	}
+	maxBytes := tagger.CoverArtMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = models.DefaultCoverArtMaxBytes
+	}
+	providers := ArtworkProviders{CoverArtEnabled: true, CoverArtBaseURL: tagger.CoverArtBaseURL}
+
+	for i := len(coverArtSizes) - 1; i >= 0; i-- {
+		size := coverArtSizes[i]
+		if size > maxSize {
+			continue
+		}
+		art, err := GetArtwork(providers, ArtworkEntityRelease, releaseID, ArtworkKindFront, size)
+		if errors.Is(err, ErrNoArtwork) {
+			return nil
+		}
+		if err != nil {
+			logger.Log.Warnf("no cover to embed for release %s: %s", releaseID, err.Error())
+			return nil
+		}
+		if len(art.Data) > maxBytes {
+			continue // a smaller thumbnail may fit
+		}
+		return newCoverArt(art.Data, art.ContentType)
+	}
+	logger.Log.Debugf("no cover for release %s fits %dpx / %d bytes; not embedding one", releaseID, maxSize, maxBytes)
+	return nil
+}
+
+// newCoverArt wraps image bytes with their dimensions. An image the standard decoders
+// cannot size still embeds, with zero dimensions, which the FLAC spec allows.
+func newCoverArt(data []byte, mimeType string) *models.CoverArt {
+	cover := &models.CoverArt{Data: data, MIMEType: mimeType}
+	if config, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		cover.Width, cover.Height = config.Width, config.Height
+		if cover.MIMEType == "" {
+			cover.MIMEType = "image/" + format
+		}
+	}
+	return cover
+}
+
+// coverChanged is the cover half of a diff: a desired cover differs from what the
+// file holds when the bytes differ. Nil desired is never a change, for the reason
+// FileTags.FrontCover gives.
+func coverChanged(existing, desired *models.CoverArt) bool {
+	if desired == nil {
+		return false
+	}
+	return existing == nil || !bytes.Equal(existing.Data, desired.Data)
+}
+
+// fileFrontCover reads the front cover a file already embeds, for the engines that
+// embed one: FLAC and MP3. embeds is false for the other formats, whose writers leave
+// pictures alone, so there is no cover change to report on them.
+func fileFrontCover(filePath string) (cover *models.CoverArt, embeds bool, err error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		flacMeta, err := readFLACMetadataFile(filePath)
+		if err != nil {
+			return nil, true, fmt.Errorf("read flac cover failed: %w", err)
+		}
+		return flacMeta.frontCover(), true, nil
+	case ".mp3":
+		cover, err := mp3FrontCover(filePath)
+		if err != nil {
+			return nil, true, fmt.Errorf("read mp3 cover failed: %w", err)
+		}
+		return cover, true, nil
+	}
+	return nil, false, nil
+}
+
+// coverTagChange is the Activity feed's row for a replaced cover. The bytes are no use
+// to a reader; what changed, as far as anyone can tell from a list, is the size.
+func coverTagChange(existing, desired *models.CoverArt) models.TagChange {
+	return models.TagChange{Field: coverTagField, Old: describeCover(existing), New: describeCover(desired)}
+}
+
+// coverTagField names the cover in a TagChange, on every engine.
+const coverTagField = "COVERART"
+
+func describeCover(cover *models.CoverArt) string {
+	if cover == nil {
+		return ""
+	}
+	size := fmt.Sprintf("%d KB", (len(cover.Data)+512)/1024)
+	if cover.Width > 0 && cover.Height > 0 {
+		return fmt.Sprintf("%s %dx%d, %s", cover.MIMEType, cover.Width, cover.Height, size)
+	}
+	return cover.MIMEType + ", " + size
+}
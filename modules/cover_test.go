@@ -0,0 +1,216 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/bogem/id3v2"
+)
+
+// testCover is a real, decodable image, so the dimensions the writers store are
+// checked rather than assumed.
+func testCover(t *testing.T, width, height int) *models.CoverArt {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return newCoverArt(buf.Bytes(), "image/png")
+}
+
+func TestFlacEmbedsTheFrontCoverOnceAndKeepsOtherPictures(t *testing.T) {
+	back := flacBlock{Type: flacBlockPicture, Data: encodeFLACPicture(4, &models.CoverArt{Data: []byte("back"), MIMEType: "image/jpeg"})}
+	path := synthFLAC(t, nil, commentBlock("TITLE=Intro"), back, paddingBlock(flacRewritePadding))
+	cover := testCover(t, 3, 2)
+	meta := models.FileTags{Title: "Intro", FrontCover: cover}
+
+	unchanged, written, changed, err := SetFlacTags(path, meta, models.TaggerSettings{})
+	if err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+	if unchanged || written != 1 || len(changed) != 1 || changed[0].Field != coverTagField {
+		t.Fatalf("a new cover alone should be one change, got unchanged=%v written=%d changes=%v", unchanged, written, changed)
+	}
+	if !strings.Contains(changed[0].New, "3x2") || changed[0].Old != "" {
+		t.Errorf("cover change = %+v", changed[0])
+	}
+
+	flacMeta := assertFLACFramesIntact(t, path)
+	got := flacMeta.frontCover()
+	if got == nil || !bytes.Equal(got.Data, cover.Data) || got.Width != 3 || got.Height != 2 || got.MIMEType != "image/png" {
+		t.Fatalf("front cover read back as %+v", got)
+	}
+	pictures := 0
+	for _, block := range flacMeta.blocks {
+		if block.Type == flacBlockPicture {
+			pictures++
+		}
+	}
+	if pictures != 2 {
+		t.Errorf("%d PICTURE blocks, want the back cover and the front cover", pictures)
+	}
+
+	// The same cover is no change; a missing one says nothing about the picture.
+	for _, again := range []*models.CoverArt{cover, nil} {
+		meta.FrontCover = again
+		if unchanged, _, _, err := SetFlacTags(path, meta, models.TaggerSettings{}); err != nil || !unchanged {
+			t.Errorf("cover %v: unchanged=%v err=%v, want a no-op", again != nil, unchanged, err)
+		}
+	}
+	if flacMeta := assertFLACFramesIntact(t, path); flacMeta.frontCover() == nil {
+		t.Error("a nil FrontCover removed the embedded cover")
+	}
+
+	// A better scan replaces the old one rather than adding a second.
+	meta.FrontCover = testCover(t, 5, 5)
+	if _, _, changed, err := SetFlacTags(path, meta, models.TaggerSettings{}); err != nil || len(changed) != 1 {
+		t.Fatalf("replacing the cover: changes=%v err=%v", changed, err)
+	}
+	if got := assertFLACFramesIntact(t, path).frontCover(); got.Width != 5 {
+		t.Errorf("front cover is %dx%d after the replacement", got.Width, got.Height)
+	}
+}
+
+func TestMP3EmbedsTheFrontCoverOnceAndKeepsOtherPictures(t *testing.T) {
+	path := writeTail(t)
+	seed, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.AddAttachedPicture(id3v2.PictureFrame{Encoding: id3v2.EncodingUTF8, MimeType: "image/jpeg", PictureType: id3v2.PTArtistPerformer, Description: "artist", Picture: []byte("artist")})
+	if err := seed.Save(); err != nil {
+		t.Fatal(err)
+	}
+	seed.Close()
+
+	cover := testCover(t, 3, 2)
+	meta := models.FileTags{Title: "Intro", FrontCover: cover}
+	unchanged, _, changed, err := SetMP3Tags(path, meta, models.TaggerSettings{})
+	if err != nil || unchanged {
+		t.Fatalf("SetMP3Tags: unchanged=%v err=%v", unchanged, err)
+	}
+	if len(changed) != 2 || changed[0].Field != coverTagField {
+		t.Errorf("changes = %v, want COVERART and TITLE", changed)
+	}
+
+	got, err := mp3FrontCover(path)
+	if err != nil || got == nil || !bytes.Equal(got.Data, cover.Data) {
+		t.Fatalf("front cover read back as %+v, err %v", got, err)
+	}
+	tag, _ := id3v2.Open(path, id3v2.Options{Parse: true})
+	if pictures := len(tag.GetFrames("APIC")); pictures != 2 {
+		t.Errorf("%d APIC frames, want the artist picture and the front cover", pictures)
+	}
+	tag.Close()
+
+	if unchanged, _, _, err := SetMP3Tags(path, meta, models.TaggerSettings{}); err != nil || !unchanged {
+		t.Errorf("second identical write should be a no-op, got unchanged=%v err=%v", unchanged, err)
+	}
+}
+
+// The policy is met by picking among the sizes the Cover Art Archive serves: the
+// largest under the edge limit, stepping down while it is over the byte limit.
+func TestFrontCoverForReleasePicksTheLargestSizeThatFits(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ResetArtworkNegativeCache()
+
+	server, _ := artworkTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var size int
+		fmt.Sscanf(r.URL.Path[strings.LastIndex(r.URL.Path, "-")+1:], "%d", &size)
+		// An image whose byte count is its edge, so the byte limit is easy to aim.
+		w.Write(append(append([]byte{}, jpegBytes...), make([]byte, size-len(jpegBytes))...))
+	})
+	tagger := models.TaggerSettings{EmbedCoverArt: true, CoverArtEnabled: true, CoverArtBaseURL: server.URL}
+
+	for _, tc := range []struct {
+		maxSize, maxBytes, want int
+	}{
+		{0, 0, 500},       // the defaults
+		{1200, 0, 1200},   // the edge allows the original thumbnail
+		{1000, 0, 500},    // no 1000px thumbnail exists; the next one down does
+		{1200, 600, 500},  // 1200 is over the byte limit
+		{1200, 100, 0},    // nothing fits: embed nothing rather than break the limit
+		{100, 1 << 20, 0}, // nothing is that small
+	} {
+		tagger.CoverArtMaxSize, tagger.CoverArtMaxBytes = tc.maxSize, tc.maxBytes
+		cover := frontCoverForRelease(testMBID, tagger)
+		got := 0
+		if cover != nil {
+			got = len(cover.Data)
+		}
+		if got != tc.want {
+			t.Errorf("max %dpx / %d bytes picked %d, want %d", tc.maxSize, tc.maxBytes, got, tc.want)
+		}
+	}
+
+	tagger.CoverArtMaxSize, tagger.CoverArtMaxBytes = 0, 0
+	for _, off := range []models.TaggerSettings{
+		{CoverArtEnabled: true, CoverArtBaseURL: server.URL}, // the profile does not embed
+		{EmbedCoverArt: true},                                // the install has no cover source
+	} {
+		if frontCoverForRelease(testMBID, off) != nil {
+			t.Errorf("%+v embedded a cover", off)
+		}
+	}
+}
+
+// A dry run fetches the cover a write would embed, so the change is previewed — and
+// not previewed once the file holds it.
+func TestPreviewResolvedFileReportsTheCover(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ResetArtworkNegativeCache()
+
+	server, _ := artworkTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jpegBytes)
+	})
+	tagger := models.TaggerSettings{EmbedCoverArt: true, CoverArtEnabled: true, CoverArtBaseURL: server.URL}
+	seedReleaseCache(t, testMBID, models.MusicBrainzReleaseResponse{
+		ID: testMBID, Title: "Album",
+		ArtistCredit: []models.ArtistCredit{{Name: "Band", Artist: models.Artist{ID: "art-1", Name: "Band"}}},
+		Media:        []models.MusicBrainzMedia{{Position: 1, Tracks: []models.Track{{ID: "trk-1", Title: "Intro", Position: 1, Number: "1"}}}},
+	}, time.Now().Add(time.Hour))
+	correlation := models.Correlation{MBReleaseID: testMBID, MBReleaseTrackID: "trk-1"}
+	path := synthFLAC(t, nil, commentBlock("TITLE=Intro"), paddingBlock(flacRewritePadding))
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := PreviewResolvedFile(path, correlation, "", tagger)
+	if err != nil {
+		t.Fatalf("PreviewResolvedFile: %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("a preview wrote to the file")
+	}
+	var cover *models.TagChange
+	for i := range changes {
+		if changes[i].Field == coverTagField {
+			cover = &changes[i]
+		}
+	}
+	if cover == nil || cover.Old != "" || cover.New == "" {
+		t.Fatalf("changes = %+v, want the cover a write would embed", changes)
+	}
+
+	if _, _, _, err := SetFlacTags(path, models.FileTags{Title: "Intro", FrontCover: newCoverArt(jpegBytes, "image/jpeg")}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = PreviewResolvedFile(path, correlation, "", tagger)
+	if err != nil {
+		t.Fatalf("PreviewResolvedFile: %v", err)
+	}
+	for _, change := range changes {
+		if change.Field == coverTagField {
+			t.Errorf("cover change %+v previewed on a file that already holds the cover", change)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/utilities"
+)
+
+// Recording credits: who played, produced, engineered, mixed and arranged this
+// recording. Unlike the work credits (works.go) these hang directly off the recording,
+// as artist-recording relationships that arrive with the release payload under the
+// same includes.
+//
+// The family a relationship lands in is Picard's, so a library tagged here and one
+// tagged by Picard agree on who counts as an engineer.
+
+// creditFamily is one recording credit family: the key every engine writes it under,
+// and the TIPL role ID3 files it by. Performers have no TIPL role — they are TMCL.
+type creditFamily struct {
+	key      string
+	tiplRole string
+	enabled  func(models.CreditFamilies) bool
+	field    func(*models.FileTags) *[]string
+}
+
+var (
+	producerFamily = creditFamily{"PRODUCER", "producer",
+		func(c models.CreditFamilies) bool { return c.Producers },
+		func(m *models.FileTags) *[]string { return &m.Producers }}
+	engineerFamily = creditFamily{"ENGINEER", "engineer",
+		func(c models.CreditFamilies) bool { return c.Engineers },
+		func(m *models.FileTags) *[]string { return &m.Engineers }}
+	mixerFamily = creditFamily{"MIXER", "mix",
+		func(c models.CreditFamilies) bool { return c.Mixers },
+		func(m *models.FileTags) *[]string { return &m.Mixers }}
+	arrangerFamily = creditFamily{"ARRANGER", "arranger",
+		func(c models.CreditFamilies) bool { return c.Arrangers },
+		func(m *models.FileTags) *[]string { return &m.Arrangers }}
+
+	// involvedFamilies are the families ID3 keeps together in one TIPL frame.
+	involvedFamilies = []creditFamily{producerFamily, engineerFamily, mixerFamily, arrangerFamily}
+)
+
+// performerTagKey is the key performers are written under, one "Name (role)" value
+// per credit — Picard's Vorbis form, and what Navidrome splits back apart.
+const performerTagKey = "PERFORMER"
+
+// involvedFamilyFor maps an artist-recording relationship type onto its family.
+// Everything that is a kind of engineering — recording, mastering, the live sound
+// — is ENGINEER, as Picard has it; a DJ-mix, a remix or a conductor is none of these.
+var involvedFamilyFor = map[string]creditFamily{
+	"producer":            producerFamily,
+	"engineer":            engineerFamily,
+	"audio":               engineerFamily,
+	"sound":               engineerFamily,
+	"recording":           engineerFamily,
+	"mastering":           engineerFamily,
+	"live sound":          engineerFamily,
+	"mix":                 mixerFamily,
+	"arranger":            arrangerFamily,
+	"instrument arranger": arrangerFamily,
+	"vocal arranger":      arrangerFamily,
+	"orchestrator":        arrangerFamily,
+	"instrumentator":      arrangerFamily,
+}
+
+// performerRelations are the relationship types that credit a performer, with the
+// role used when the relationship names no instrument or voice.
+var performerRelations = map[string]string{
+	"instrument":           "",
+	"vocal":                "vocals",
+	"performer":            "",
+	"performing orchestra": "orchestra",
+	"concertmaster":        "concertmaster",
+}
+
+// performerModifiers are the relationship attributes that qualify a role rather than
+// name one. They prefix every instrument the relationship credits: a guest on guitar
+// and bass is a guest on each.
+var performerModifiers = map[string]bool{
+	"additional": true,
+	"guest":      true,
+	"solo":       true,
+}
+
+// applyRecordingCredits fills a FileTags' recording credits and records which of the
+// families the writers may touch: the ones the profile asked for, once the release is
+// known to carry its relations.
+func applyRecordingCredits(metadata *models.FileTags, track models.Track, response models.MusicBrainzReleaseResponse, tagger models.TaggerSettings) {
+	if !response.FetchedWithRelations() {
+		return
+	}
+	metadata.RecordingCredits = tagger.Credits
+
+	for _, rel := range track.Recording.Relations {
+		if rel.TargetType != "artist" || rel.Artist == nil {
+			continue
+		}
+		name := creditedName(rel, tagger)
+		if family, ok := involvedFamilyFor[rel.Type]; ok {
+			field := family.field(metadata)
+			*field = appendNew(*field, name)
+			continue
+		}
+		if fallback, ok := performerRelations[rel.Type]; ok {
+			for _, role := range performerRoles(rel.Attributes, fallback) {
+				credit := models.PerformerCredit{Name: name, Role: role}
+				if !containsPerformer(metadata.Performers, credit) {
+					metadata.Performers = append(metadata.Performers, credit)
+				}
+			}
+		}
+	}
+
+	for _, family := range involvedFamilies {
+		field := family.field(metadata)
+		*field = utilities.NormalizeTagValues(*field)
+	}
+}
+
+// creditedName is the name a relationship credits its artist under. It honours the
+// profile the way the artist credit does: the locale's alias when there is one, then
+// use_current_artist_name — off writes the name printed in the liner notes, on writes
+// the artist's current one.
+func creditedName(rel models.Relation, tagger models.TaggerSettings) string {
+	if alias, ok := localeAlias(*rel.Artist, tagger.Locale); ok {
+		return alias.Name
+	}
+	if !tagger.UseCurrentArtistName && rel.TargetCredit != "" {
+		return rel.TargetCredit
+	}
+	return rel.Artist.Name
+}
+
+// performerRoles turns a relationship's attributes into the roles it credits, one per
+// instrument or voice, each carrying the relationship's modifiers.
+func performerRoles(attributes []string, fallback string) []string {
+	var modifiers, instruments []string
+	for _, attribute := range attributes {
+		if performerModifiers[attribute] {
+			modifiers = append(modifiers, attribute)
+		} else {
+			instruments = append(instruments, attribute)
+		}
+	}
+	if len(instruments) == 0 {
+		instruments = []string{fallback}
+	}
+	roles := make([]string, 0, len(instruments))
+	for _, instrument := range instruments {
+		roles = append(roles, strings.TrimSpace(strings.Join(append(append([]string{}, modifiers...), instrument), " ")))
+	}
+	return roles
+}
+
+func containsPerformer(list []models.PerformerCredit, credit models.PerformerCredit) bool {
+	for _, have := range list {
+		if have == credit {
+			return true
+		}
+	}
+	return false
+}
+
+// performerValue renders a performer credit the way it is compared and stored as
+// text: "Name (role)", or the bare name when there is no role.
+func performerValue(name, role string) string {
+	if role == "" {
+		return name
+	}
+	return name + " (" + role + ")"
+}
+
+func performerValues(credits []models.PerformerCredit) []string {
+	values := make([]string, 0, len(credits))
+	for _, credit := range credits {
+		values = append(values, performerValue(credit.Name, credit.Role))
+	}
+	return values
+}
+
+// withCreditTags adds the enabled recording credit families to an engine's desired
+// map, under the same keys on every engine that writes them. A family that is off, or
+// whose credits are unknown, is not in the map at all, so the file's own value stands
+// even under remove_values.
+func withCreditTags(desired map[string][]string, metadata models.FileTags) map[string][]string {
+	if metadata.RecordingCredits.Performers {
+		desired[performerTagKey] = performerValues(metadata.Performers)
+	}
+	for _, family := range involvedFamilies {
+		if family.enabled(metadata.RecordingCredits) {
+			desired[family.key] = *family.field(&metadata)
+		}
+	}
+	return desired
+}
@@ -0,0 +1,153 @@
+package modules
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/bogem/id3v2"
+)
+
+// creditRelease is a track whose recording carries every kind of relationship the
+// credits read, and two they must not: a remixer, and the performance of a work.
+const creditRelease = `{
+  "id": "rel-1",
+  "title": "Session",
+  "artist-credit": [{"name": "The Trio", "artist": {"id": "trio", "name": "The Trio"}}],
+  "media": [{"position": 1, "tracks": [{
+    "id": "track-1", "position": 1, "title": "Blues",
+    "recording": {"id": "rec-1", "title": "Blues", "relations": [
+      {"type": "instrument", "target-type": "artist", "attributes": ["guest", "guitar", "bass"], "artist": {"id": "a1", "name": "Ann Axe"}},
+      {"type": "vocal", "target-type": "artist", "artist": {"id": "a2", "name": "Sam Singer"}},
+      {"type": "instrument", "target-type": "artist", "attributes": ["piano"], "target-credit": "B. Keys", "artist": {"id": "a3", "name": "Bill Keys"}},
+      {"type": "producer", "target-type": "artist", "artist": {"id": "a4", "name": "Pat Producer"}},
+      {"type": "recording", "target-type": "artist", "artist": {"id": "a5", "name": "Ed Engineer"}},
+      {"type": "mastering", "target-type": "artist", "artist": {"id": "a5", "name": "Ed Engineer"}},
+      {"type": "mix", "target-type": "artist", "artist": {"id": "a6", "name": "Max Mixer"}},
+      {"type": "orchestrator", "target-type": "artist", "artist": {"id": "a7", "name": "Oz Arranger"}},
+      {"type": "remixer", "target-type": "artist", "artist": {"id": "a8", "name": "Remix Person"}},
+      {"type": "performance", "target-type": "work", "work": {"id": "work-1", "title": "Blues", "relations": []}}
+    ]}
+  }]}]
+}`
+
+var allCredits = models.CreditFamilies{Performers: true, Producers: true, Engineers: true, Mixers: true, Arrangers: true}
+
+func TestRecordingCreditsFollowPicardsFamilies(t *testing.T) {
+	release := decodeWorkRelease(t, creditRelease)
+	track, media := release.Media[0].Tracks[0], release.Media[0]
+
+	metadata, err := BuildFileTags(track, media, release, models.TaggerSettings{Credits: allCredits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flac := buildFLACDesiredTags(metadata)
+	assertTag(t, flac, "PERFORMER", "Ann Axe (guest guitar); Ann Axe (guest bass); Sam Singer (vocals); B. Keys (piano)")
+	assertTag(t, flac, "PRODUCER", "Pat Producer")
+	assertTag(t, flac, "ENGINEER", "Ed Engineer") // recording and mastering, credited once
+	assertTag(t, flac, "MIXER", "Max Mixer")
+	assertTag(t, flac, "ARRANGER", "Oz Arranger")
+
+	// Each family is its own switch, and a family that is off is not in the map at
+	// all — the file's own value stands, even under remove_values.
+	some, _ := BuildFileTags(track, media, release, models.TaggerSettings{Credits: models.CreditFamilies{Producers: true}})
+	desired := buildMP3DesiredTags(some)
+	assertTag(t, desired, "PRODUCER", "Pat Producer")
+	for _, key := range []string{"PERFORMER", "ENGINEER", "MIXER", "ARRANGER"} {
+		if _, ok := desired[key]; ok {
+			t.Errorf("%s is in the desired tags with its family off", key)
+		}
+	}
+
+	// Known only once the release carries relations, whatever the profile asks.
+	bare := decodeWorkRelease(t, `{"id": "r", "artist-credit": [{"name": "A", "artist": {"id": "a"}}],
+		"media": [{"position": 1, "tracks": [{"id": "t", "position": 1, "recording": {"id": "r"}}]}]}`)
+	unknown, _ := BuildFileTags(bare.Media[0].Tracks[0], bare.Media[0], bare, models.TaggerSettings{Credits: allCredits})
+	if _, ok := buildFLACDesiredTags(unknown)["PRODUCER"]; ok {
+		t.Error("a release cached without relations wrote an empty PRODUCER")
+	}
+}
+
+// MP3 keeps performers in TMCL and everyone else in TIPL, as role/name pairs — pairs
+// whichever multi-value form the profile picked, and without disturbing a TIPL role
+// that is not ours.
+func TestMP3WritesCreditsAsTMCLAndTIPLPairs(t *testing.T) {
+	path := writeTail(t)
+	seed, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.AddTextFrame("TIPL", id3v2.EncodingUTF8, "DJ-mix\x00Someone Else\x00producer\x00Old Producer")
+	if err := seed.Save(); err != nil {
+		t.Fatal(err)
+	}
+	seed.Close()
+
+	metadata := models.FileTags{
+		Title:            "Blues",
+		RecordingCredits: models.CreditFamilies{Performers: true, Producers: true, Mixers: true},
+		Performers:       []models.PerformerCredit{{Name: "Ann Axe", Role: "guitar"}, {Name: "Sam Singer", Role: "vocals"}},
+		Producers:        []string{"Pat Producer", "Second Producer"},
+		Mixers:           []string{"Max Mixer"},
+		Engineers:        []string{"Ed Engineer"}, // family off: not written
+	}
+	if _, _, _, err := SetMP3Tags(path, metadata, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tag.GetTextFrame("TMCL").Text; got != "guitar\x00Ann Axe\x00vocals\x00Sam Singer" {
+		t.Errorf("TMCL = %q", got)
+	}
+	if got := decodeCreditPairs(tag.GetTextFrame("TIPL").Text); !slices.Equal(got, [][2]string{
+		{"DJ-mix", "Someone Else"},
+		{"producer", "Pat Producer"}, {"producer", "Second Producer"},
+		{"mix", "Max Mixer"},
+	}) {
+		t.Errorf("TIPL pairs = %q", got)
+	}
+	tag.Close()
+
+	tags, err := GetMP3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags["PERFORMER"]; !slices.Equal(got, []string{"Ann Axe (guitar)", "Sam Singer (vocals)"}) {
+		t.Errorf("PERFORMER read back as %v", got)
+	}
+	if _, ok := tags["ENGINEER"]; ok {
+		t.Error("ENGINEER was written with its family off")
+	}
+	if unchanged, _, _, err := SetMP3Tags(path, metadata, models.TaggerSettings{}); err != nil || !unchanged {
+		t.Errorf("second identical write should be a no-op, got unchanged=%v err=%v", unchanged, err)
+	}
+}
+
+func TestFlacWritesOnePerformerCommentPerCredit(t *testing.T) {
+	path := synthFLAC(t, nil, commentBlock("TITLE=Blues"), paddingBlock(flacRewritePadding))
+	metadata := models.FileTags{
+		Title:            "Blues",
+		RecordingCredits: models.CreditFamilies{Performers: true, Arrangers: true},
+		Performers:       []models.PerformerCredit{{Name: "Ann Axe", Role: "guitar"}, {Name: "The Band"}},
+		Arrangers:        []string{"Oz Arranger"},
+	}
+	if _, _, _, err := SetFlacTags(path, metadata, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := getFlacTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags["PERFORMER"]; !slices.Equal(got, []string{"Ann Axe (guitar)", "The Band"}) {
+		t.Errorf("PERFORMER = %v", got)
+	}
+	if got := tags["ARRANGER"]; !slices.Equal(got, []string{"Oz Arranger"}) {
+		t.Errorf("ARRANGER = %v", got)
+	}
+	if unchanged, _, _, err := SetFlacTags(path, metadata, models.TaggerSettings{}); err != nil || !unchanged {
+		t.Errorf("second identical write should be a no-op, got unchanged=%v err=%v", unchanged, err)
+	}
+}
@@ -1,10 +1,12 @@
 package modules
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -94,12 +96,13 @@ func (s *AlbumRefreshSet) Snapshot() map[string]string {
 var supportedExtensions = map[string]bool{
 	".flac": true,
 	".mp3":  true,
-	".m4a":  false,
-	".ogg":  false,
+	".m4a":  true,
+	".ogg":  true,
+	".opus": true,
 	".wav":  false,
 }
 
-// extractMusicBrainzReleaseID extracts the MusicBrainz Album ID from either MP3 (ID3v2) or FLAC (Vorbis)
+// ExtractMusicBrainzReleaseID extracts the MusicBrainz Album ID from FLAC, MP3 (ID3v2), Ogg Vorbis/Opus (Vorbis comments) or M4A (iTunes items).
 func ExtractMusicBrainzReleaseID(filePath string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
@@ -108,12 +111,16 @@ func ExtractMusicBrainzReleaseID(filePath string) (string, error) {
 		return extractFromID3v2(filePath, "release")
 	case ".flac":
 		return ExtractFLACTag(filePath, "", "release")
+	case ".m4a":
+		return extractFromMP4(filePath, "release")
+	case ".ogg", ".opus":
+		return ExtractOggTag(filePath, "", "release")
 	default:
 		return "", errors.New("unsupported file type")
 	}
 }
 
-// extractMusicBrainzReleaseID extracts the MusicBrainz Track ID from either MP3 (ID3v2) or FLAC (Vorbis)
+// ExtractMusicBrainzTrackID extracts the MusicBrainz Track ID from FLAC, MP3 (ID3v2), Ogg Vorbis/Opus (Vorbis comments) or M4A (iTunes items).
 func ExtractMusicBrainzTrackID(filePath string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
@@ -122,12 +129,16 @@ func ExtractMusicBrainzTrackID(filePath string) (string, error) {
 		return extractFromID3v2(filePath, "track")
 	case ".flac":
 		return ExtractFLACTag(filePath, "", "track")
+	case ".m4a":
+		return extractFromMP4(filePath, "track")
+	case ".ogg", ".opus":
+		return ExtractOggTag(filePath, "", "track")
 	default:
 		return "", errors.New("unsupported file type")
 	}
 }
 
-// extractMusicBrainzReleaseID extracts the MusicBrainz Recording ID from either MP3 (ID3v2) or FLAC (Vorbis)
+// ExtractMusicBrainzRecordingID extracts the MusicBrainz Recording ID from FLAC, MP3 (ID3v2), Ogg Vorbis/Opus (Vorbis comments) or M4A (iTunes items).
 func ExtractMusicBrainzRecordingID(filePath string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
@@ -136,12 +147,16 @@ func ExtractMusicBrainzRecordingID(filePath string) (string, error) {
 		return extractFromID3v2(filePath, "recording")
 	case ".flac":
 		return ExtractFLACTag(filePath, "", "recording")
+	case ".m4a":
+		return extractFromMP4(filePath, "recording")
+	case ".ogg", ".opus":
+		return ExtractOggTag(filePath, "", "recording")
 	default:
 		return "", errors.New("unsupported file type")
 	}
 }
 
-// extractMusicBrainzReleaseID extracts the track titlle from either MP3 (ID3v2) or FLAC (Vorbis)
+// ExtractTrackTitle extracts the track title from FLAC, MP3 (ID3v2), Ogg Vorbis/Opus (Vorbis comments) or M4A (iTunes items).
 func ExtractTrackTitle(filePath string) (string, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
@@ -150,6 +165,10 @@ func ExtractTrackTitle(filePath string) (string, error) {
 		return extractFromID3v2(filePath, "title")
 	case ".flac":
 		return ExtractFLACTag(filePath, "title", "")
+	case ".m4a":
+		return extractFromMP4(filePath, "title")
+	case ".ogg", ".opus":
+		return ExtractOggTag(filePath, "title", "")
 	default:
 		return "", errors.New("unsupported file type")
 	}
@@ -163,6 +182,10 @@ func SetFileTags(filePath string, metadata models.FileTags, tagger models.Tagger
 		return SetMP3Tags(filePath, metadata, tagger)
 	case ".flac":
 		return SetFlacTags(filePath, metadata, tagger)
+	case ".m4a":
+		return SetMP4Tags(filePath, metadata, tagger)
+	case ".ogg", ".opus":
+		return SetOggTags(filePath, metadata, tagger)
 	default:
 		return false, 0, nil, errors.New("unsupported file type")
 	}
@@ -275,12 +298,83 @@ func ResolveCorrelation(filePath string, lidarrClient *LidarrClient, rootDir str
 // TagResolvedFile writes tags for an already-correlated file. changed is the
 // field-level diff applied, for the Activity feed's per-file detail.
 func TagResolvedFile(filePath string, correlation models.Correlation, plexClient *PlexClient, refreshSet *AlbumRefreshSet, rootDir string, tagger models.TaggerSettings) (unchanged bool, tagsWritten int, changed []models.TagChange, err error) {
+	track, media, response, err := resolvedTrack(filePath, correlation)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	return ProcessTrackFileAfterMatch(
+		filePath,
+		nil,
+		plexClient,
+		refreshSet,
+		rootDir,
+		tagger,
+		track,
+		media,
+		response)
+}
+
+// PreviewResolvedFile is TagResolvedFile without the write: the same release, the
+// same track, the same disc guard and the same desired tags, diffed against the file
+// by DiffFileTags, and returned as the changes a write would make. It is what a dry
+// run reports. The cover is the write's own, out of the artwork cache a dry run
+// fills once per release, and compared with the file's the way the engine that would
+// embed it compares. Loudness is left out, as it is not a read: it is taken from
+// measurements already cached rather than by decoding the file.
+func PreviewResolvedFile(filePath string, correlation models.Correlation, rootDir string, tagger models.TaggerSettings) ([]models.TagChange, error) {
+	track, media, response, err := resolvedTrack(filePath, correlation)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := BuildFileTags(track, media, response, tagger)
+	if err != nil {
+		return nil, err
+	}
+	if err := LocalizeTitles(&metadata, track, media, response, tagger, GetMusicBrainzRelease); err != nil {
+		return nil, err
+	}
+	MeasureReplayGain(&metadata, filePath, rootDir, track, response, tagger, false)
+	entries, err := DiffFileTags(filePath, metadata, tagger)
+	if err != nil {
+		return nil, err
+	}
+	changes := WouldChange(entries)
+
+	metadata.FrontCover = frontCoverForRelease(response.ID, tagger)
+	if metadata.FrontCover != nil {
+		existingCover, embeds, err := fileFrontCover(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if embeds && coverChanged(existingCover, metadata.FrontCover) {
+			changes = append(changes, coverTagChange(existingCover, metadata.FrontCover))
+			utilities.SortTagChanges(changes)
+		}
+	}
+	return changes, nil
+}
+
+// WouldChange turns a diff's changed rows into the TagChanges a write would report.
+// The two sides are already rendered as the writer renders them (see DiffFileTags).
+func WouldChange(entries []models.TagDiffEntry) []models.TagChange {
+	var changes []models.TagChange
+	for _, entry := range entries {
+		if entry.Changed {
+			changes = append(changes, models.TagChange{Field: entry.Key, Old: entry.Current, New: entry.Desired})
+		}
+	}
+	return changes
+}
+
+// resolvedTrack fetches the release a correlation names and finds the file's track
+// on it, refusing one the disc guard says is the wrong disc.
+func resolvedTrack(filePath string, correlation models.Correlation) (models.Track, models.MusicBrainzMedia, models.MusicBrainzReleaseResponse, error) {
 	// Get MB data from API
 	response, err := GetMusicBrainzRelease(correlation.MBReleaseID)
 	if err != nil {
 		// wrap the cause; the scan/single-file caller logs this together with the
 		// file path, so no separate log line is needed here
-		return false, 0, nil, fmt.Errorf("failed to get MB release data: %w", err)
+		return models.Track{}, models.MusicBrainzMedia{}, response, fmt.Errorf("failed to get MB release data: %w", err)
 	}
 	logger.Log.Debug("MB title response: " + response.Title)
 
@@ -291,25 +385,16 @@ func TagResolvedFile(filePath string, correlation models.Correlation, plexClient
 				logger.Log.Debug("release track ID found in MB response")
 				if err := verifyDiscFolder(filePath, correlation, track, media, response); err != nil {
 					logger.Log.Warnf("refusing to tag '%s': %s", filePath, err.Error())
-					return false, 0, nil, err
+					return track, media, response, err
 				}
-				return ProcessTrackFileAfterMatch(
-					filePath,
-					nil,
-					plexClient,
-					refreshSet,
-					rootDir,
-					tagger,
-					track,
-					media,
-					response)
+				return track, media, response, nil
 			}
 		}
 	}
 
 	logger.Log.Errorf("failed to tag file, track (track ID %s, release ID %s, title %s) not found in release data for '%s'", correlation.MBReleaseTrackID, correlation.MBReleaseID, correlation.TrackTitle, response.ID)
 	logger.Log.Warn("the manager's release selection and track mapping disagree; a force re-correlate may reconcile them")
-	return false, 0, nil, fmt.Errorf("%w: track %s is not in release %s — the manager's release and track mapping disagree; force re-correlate this artist to reconcile", ErrTrackNotInRelease, correlation.MBReleaseTrackID, response.ID)
+	return models.Track{}, models.MusicBrainzMedia{}, response, fmt.Errorf("%w: track %s is not in release %s — the manager's release and track mapping disagree; force re-correlate this artist to reconcile", ErrTrackNotInRelease, correlation.MBReleaseTrackID, response.ID)
 }
 
 // verifyDiscFolder is the last check before a write: it refuses a correlation that
@@ -389,6 +474,16 @@ func ProcessTrackFileAfterMatch(
 	if err != nil {
 		return false, 0, nil, err
 	}
+	// The cover is fetched here rather than in BuildFileTags, which stays free of I/O
+	// so the diff view can call it for a page of files at once.
+	metadata.FrontCover = frontCoverForRelease(response.ID, tagger)
+	// So is the transliterated tracklisting, for the same reason.
+	if err := LocalizeTitles(&metadata, track, media, response, tagger, GetMusicBrainzRelease); err != nil {
+		return false, 0, nil, err
+	}
+	// And the loudness, which decodes this file and perhaps its siblings.
+	MeasureReplayGain(&metadata, filePath, rootDir, track, response, tagger, true)
+	before, _ := os.Stat(filePath)
 
 	// re-tag file with new information
 	unchanged, tagsWritten, changed, err = SetFileTags(filePath, metadata, tagger)
@@ -398,6 +493,9 @@ func ProcessTrackFileAfterMatch(
 	} else {
 		logger.Log.Debug("file tagger finished")
 	}
+	if !unchanged {
+		restampLoudness(filePath, before)
+	}
 
 	changeString := "unchanged"
 	if !unchanged {
@@ -428,13 +526,8 @@ func BuildFileTags(
 	// determine release artist
 	releaseArtist := ""
 	if len(response.ArtistCredit) > 0 {
-		if tagger.UseCurrentArtistName {
-			// use current artist name if configured
-			releaseArtist = response.ArtistCredit[0].Artist.Name
-		} else {
-			// use original release artist name if configured
-			releaseArtist = response.ArtistCredit[0].Name
-		}
+		// the profile's locale alias, else the current or the credited name
+		releaseArtist = artistCreditName(response.ArtistCredit[0], tagger)
 	} else {
 		return models.FileTags{}, errors.New("failed to determine album artist")
 	}
@@ -448,8 +541,14 @@ func BuildFileTags(
 	// whose artist the album artist does not name at all. Loose comparison so
 	// punctuation or accent differences between the two credits do not keep a
 	// genuinely redundant string.
+	trackArtistSort := MusicBrainzArtistSortNamesToString(track.ArtistCredit, tagger)
+	nativeArtist := MusicBrainzArtistsArrayToString(track.ArtistCredit, withoutLocale(tagger))
 	if tagger.IgnoreRedundantContributingArtists && utilities.EqLoose(trackArtist, releaseArtist) {
 		trackArtist = ""
+		// The sort and native tags go with the tag they describe: a sort name for an
+		// ARTIST the file does not carry would be a sort key for nothing.
+		trackArtistSort = ""
+		nativeArtist = ""
 	}
 	logger.Log.Trace("track artists: " + trackArtist)
 
@@ -460,11 +559,7 @@ func BuildFileTags(
 	creditedNames := func(credits []models.ArtistCredit) []string {
 		names := make([]string, 0, len(credits))
 		for _, artistCredit := range credits {
-			if tagger.UseCurrentArtistName {
-				names = append(names, artistCredit.Artist.Name)
-			} else {
-				names = append(names, artistCredit.Name)
-			}
+			names = append(names, artistCreditName(artistCredit, tagger))
 		}
 		return utilities.NormalizeTagValues(names)
 	}
@@ -512,15 +607,23 @@ func BuildFileTags(
 	}
 
 	metadata := models.FileTags{
-		Artist:                trackArtist,
-		Artists:               trackArtists,
-		AlbumArtist:           releaseArtist,
-		AlbumArtists:          releaseArtists,
+		Artist:       trackArtist,
+		Artists:      trackArtists,
+		AlbumArtist:  releaseArtist,
+		AlbumArtists: releaseArtists,
+		ArtistSort:   trackArtistSort,
+		// The first credited artist's, because ALBUMARTIST names only that one.
+		AlbumArtistSort: artistCreditSortName(response.ArtistCredit[0], tagger),
+		// Native spellings, kept only where the locale changed them.
+		LocalizedArtists:      tagger.Locale != "",
+		NativeArtist:          nativeIfDifferent(nativeArtist, trackArtist),
+		NativeAlbumArtist:     nativeIfDifferent(artistCreditName(response.ArtistCredit[0], withoutLocale(tagger)), releaseArtist),
 		OriginalDate:          releaseGroupDate,
 		OriginalYear:          releaseGroupYear,
 		ReleaseDate:           releaseDate,
 		ReleaseYear:           releaseYear,
 		Album:                 response.Title,
+		AlbumSort:             response.Title,
 		Title:                 track.Title,
 		ISRCs:                 utilities.NormalizeTagValues(track.Recording.ISRCs),
 		Track:                 strconv.Itoa(track.Position),
@@ -548,6 +651,8 @@ func BuildFileTags(
 		genres = append(genres, models.MusicBrainzNamedCount{Name: genre.Name, Count: genre.Count})
 	}
 	metadata.Genres = selectGenres(genres, tagger.MaxGenres)
+	applyWorkCredits(&metadata, track, response, tagger)
+	applyRecordingCredits(&metadata, track, response, tagger)
 
 	return metadata, nil
 }
@@ -615,6 +720,16 @@ func DiffFileTags(filePath string, metadata models.FileTags, tagger models.Tagge
 		}
 		existing = m
 		changed, _ = utilities.DiffFlacTags(existing, desired, tagger)
+	case ".ogg", ".opus":
+		// The same Vorbis comments as FLAC in a different container, so the same map
+		// and the same diff.
+		headers, comments, err := readOggComments(filePath)
+		if err != nil {
+			return nil, err
+		}
+		desired = renderFLACTags(buildOggDesiredTags(metadata, headers.codec))
+		existing = comments.tagsMap()
+		changed, _ = utilities.DiffFlacTags(existing, desired, tagger)
 	case ".mp3":
 		desired = renderMP3Tags(buildMP3DesiredTags(metadata), tagger)
 		m, err := GetMP3Tags(filePath)
@@ -623,10 +738,25 @@ func DiffFileTags(filePath string, metadata models.FileTags, tagger models.Tagge
 		}
 		existing = m
 		changed, _ = utilities.DiffID3Tags(existing, desired, tagger)
+	case ".m4a":
+		desired = renderMP4Tags(buildMP4DesiredTags(metadata), tagger)
+		m, err := GetMP4Tags(filePath)
+		if err != nil {
+			return nil, err
+		}
+		existing = m
+		changed, _ = utilities.DiffID3Tags(existing, desired, tagger)
 	default:
 		return nil, errors.New("unsupported file type")
 	}
 
+	// A tag a policy removes and the engine does not otherwise write is a row too: it
+	// is a change the write would make.
+	for k, values := range utilities.ApplyTagPolicies(existing, desired, tagger) {
+		if _, ok := desired[k]; !ok {
+			desired[k] = values
+		}
+	}
 	keys := make([]string, 0, len(desired))
 	for k := range desired {
 		keys = append(keys, k)
@@ -637,6 +767,12 @@ func DiffFileTags(filePath string, metadata models.FileTags, tagger models.Tagge
 	for _, k := range keys {
 		up := strings.ToUpper(k)
 		_, isChanged := changed[up]
+		// Desired stays what the metadata says even for a tag the file keeps, so the
+		// view can show what the policy or lock is holding back.
+		policy := tagger.TagPolicy(up)
+		if policy == models.TagPolicyRemove {
+			desired[k] = nil
+		}
 
 		// The preview says what a write would do, so a changed row renders its two sides
 		// the way the write reports them: a value count is part of the change on a
@@ -655,7 +791,12 @@ func DiffFileTags(filePath string, metadata models.FileTags, tagger models.Tagge
 		if current == "" && want == "" {
 			continue // nothing to show for an empty-on-both tag
 		}
-		entries = append(entries, models.TagDiffEntry{Key: k, Current: current, Desired: want, Changed: isChanged})
+		entry := models.TagDiffEntry{Key: k, Current: current, Desired: want, Changed: isChanged}
+		if policy != models.TagPolicyOverwrite {
+			entry.Policy = policy
+			entry.Locked = slices.ContainsFunc(tagger.LockedFields, func(f string) bool { return strings.EqualFold(f, up) })
+		}
+		entries = append(entries, entry)
 	}
 	return entries, nil
 }
@@ -674,21 +815,44 @@ func ScanFolderRecursive(root string, lidarrClient *LidarrClient, plexClient *Pl
 ) {
 	refreshSet := NewAlbumRefreshSet(albumsWhoNeedMetadataRefreshSoFar)
 
-	counter, unchangedFiles, allTagsWritten, errorFiles, err = WalkAndProcess(root, concurrency, func(path string) (bool, int, error) {
+	counter, unchangedFiles, allTagsWritten, errorFiles, err = WalkAndProcess(context.Background(), root, nil, WalkLimits{Workers: concurrency}, func(path string) (bool, int, error) {
 		return ProcessTrackFile(path, lidarrClient, plexClient, refreshSet, root, tagger)
 	}, nil)
 
 	return counter, unchangedFiles, allTagsWritten, errorFiles, refreshSet.Snapshot(), err
 }
 
+// IsSupportedFile reports whether a scan would process the file at path, by the same
+// extension check the walk uses — for a caller deciding whether a change on disk is
+// worth a scan at all.
+func IsSupportedFile(path string) bool {
+	return supportedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
 // CountSupportedFiles walks root and counts the audio files a scan would process.
 // It is the same enumeration WalkAndProcess uses for its own progress logging,
 // exposed so a caller can size a progress bar across several roots before any of
 // them starts. Walk errors are ignored, exactly as the scan tolerates them.
 func CountSupportedFiles(root string) int {
+	return CountRemainingFiles(root, nil)
+}
+
+// CountRemainingFiles counts the files a walk resuming from mark would visit: the
+// ones CountSupportedFiles counts, less those the mark says are done. A nil mark
+// counts them all.
+func CountRemainingFiles(root string, mark *WalkMark) int {
 	total := 0
 	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err == nil && !d.IsDir() && supportedExtensions[strings.ToLower(filepath.Ext(path))] {
+		if err != nil {
+			return nil
+		}
+		if mark.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && IsSupportedFile(path) {
 			total++
 		}
 		return nil
@@ -706,7 +870,22 @@ func CountSupportedFiles(root string) int {
 // It runs on the worker goroutine, so it must be cheap and safe for concurrent
 // calls — the scan uses it to advance a live progress counter without the per-file
 // hot path ever taking a lock.
-func WalkAndProcess(root string, workers int, process func(path string) (unchanged bool, tagsWritten int, err error), onFile func(path string)) (
+//
+// ctx is checked between files, never during one: once cancelled, no further file is
+// handed to the pool, the files already in it finish their writes, and the counters
+// come back for the files that were done alongside ctx's error. Interrupting a tag
+// write is how a file ends up half-written, so a stop waits for at most one file per
+// worker.
+//
+// mark, if non-nil, is both read and kept up to date: the walk passes over what it says
+// was done by an earlier walk, and records how far this one gets (see WalkMark).
+//
+// limits sizes the pool (see WalkLimits). A format at its cap holds the walk until one
+// of its files finishes, even when the next file is of another format: the walk is one
+// ordered pass, and that order is what WalkMark records. In practice a library is
+// mostly one format, and the cap is what stops a mixed one from thrashing the disk
+// behind its slow half.
+func WalkAndProcess(ctx context.Context, root string, mark *WalkMark, limits WalkLimits, process func(path string) (unchanged bool, tagsWritten int, err error), onFile func(path string)) (
 	counter int,
 	unchangedFiles int,
 	allTagsWritten int,
@@ -716,19 +895,18 @@ func WalkAndProcess(root string, workers int, process func(path string) (unchang
 	errorFiles = []string{}
 
 	// <1 falls back to the default; 1 reproduces the old serial behavior exactly
-	if workers < 1 {
-		workers = defaultProcessConcurrency
-	}
+	workers := limits.workers()
+	formatSlots := limits.formatSlots()
 
 	// first pass, count total supported files
-	totalFiles := CountSupportedFiles(root)
+	totalFiles := CountRemainingFiles(root, mark)
 
 	if totalFiles == 0 {
 		logger.Log.Info("no supported files found in: " + root)
 		return 0, 0, 0, errorFiles, nil
 	}
 
-	logger.Log.Infof("found %d supported files. starting processing with %d worker(s)...", totalFiles, workers)
+	logger.Log.Infof("found %d supported files. starting processing with %s...", totalFiles, limits)
 
 	var (
 		counterAtomic   atomic.Int64 // successfully processed files
@@ -750,15 +928,52 @@ func WalkAndProcess(root string, workers int, process func(path string) (unchang
 		if walkErr != nil {
 			return walkErr
 		}
-		if d.IsDir() || !supportedExtensions[strings.ToLower(filepath.Ext(path))] {
+		if mark.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !IsSupportedFile(path) {
 			return nil
 		}
 
-		wg.Add(1)
+		// A pause lands here, between files: nothing new starts until Hold returns.
+		if limits.Hold != nil {
+			if err := limits.Hold(ctx); err != nil {
+				return err
+			}
+		}
+
+		// The format's slot first, then the pool's: waiting on a capped format while
+		// holding a pool slot would idle a worker for nothing.
+		formatSem := formatSlots[fileFormat(path)]
+		if formatSem != nil {
+			formatSem <- struct{}{}
+		}
 		sem <- struct{}{} // blocks when the pool is full (backpressure)
+		// Checked once a worker is free rather than before waiting for one: a stop
+		// asked for while the pool was full must not still start the next file.
+		if err := ctx.Err(); err != nil {
+			<-sem
+			if formatSem != nil {
+				<-formatSem
+			}
+			return err
+		}
+		mark.dispatched(path)
+		wg.Add(1)
 		go func(path string) {
 			defer wg.Done()
-			defer func() { <-sem }()
+			defer func() {
+				<-sem
+				if formatSem != nil {
+					<-formatSem
+				}
+			}()
+			// Finished whether or not it failed, so the mark moves past it; a failure
+			// is kept in the mark's Retry as well (see WalkMark).
+			defer mark.finished(path)
 			// Progress advances for every file visited, error or not, so the bar can
 			// reach 100% on a scan that hits some failures. Deferred so the error
 			// early-return below still counts the file as done.
@@ -767,8 +982,14 @@ func WalkAndProcess(root string, workers int, process func(path string) (unchang
 			}
 
 			unchanged, tagsWritten, procErr := process(path)
+			// Paid with the slots still held, so a ceiling slows the walk down
+			// instead of letting the next file start on credit.
+			if limits.Bandwidth.Rate() > 0 {
+				limits.Bandwidth.Charge(ctx, fileTraffic(path, unchanged && procErr == nil, tagsWritten))
+			}
 			if procErr != nil {
 				logger.Log.Error("failed to process file '" + path + "'. error: " + procErr.Error())
+				mark.fail(path)
 				resultMu.Lock()
 				errorFiles = append(errorFiles, path)
 				resultMu.Unlock()
@@ -1,7 +1,12 @@
 package modules
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/aunefyren/autotaggerr/models"
@@ -88,3 +93,132 @@ func TestReleaseToAlbumType(t *testing.T) {
 		})
 	}
 }
+
+// A cancelled walk hands no further file to the pool, and reports the files it did get
+// through — a stop is a shorter run, not a lost one.
+func TestWalkAndProcessStopsBetweenFiles(t *testing.T) {
+	root := t.TempDir()
+	for i := 1; i <= 5; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("%02d.flac", i)), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var seen []string
+	counter, unchanged, _, errs, err := WalkAndProcess(ctx, root, nil, WalkLimits{Workers: 1}, func(path string) (bool, int, error) {
+		seen = append(seen, path)
+		if len(seen) == 2 {
+			cancel() // the file in hand finishes; the next is never started
+		}
+		return true, 0, nil
+	}, nil)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(seen) != 2 || counter != 2 || unchanged != 2 || len(errs) != 0 {
+		t.Errorf("processed %d file(s), counted %d (%d unchanged, %d errors); want 2 of each and no errors",
+			len(seen), counter, unchanged, len(errs))
+	}
+}
+
+// A walk picked up from its mark visits exactly the files the stopped one did not
+// finish — including across folders, and where walk order and string order disagree.
+func TestWalkAndProcessResumesFromItsMark(t *testing.T) {
+	root := t.TempDir()
+	var all []string
+	for _, rel := range []string{"A/01.flac", "A/02.flac", "A-B/01.flac", "B/CD1/01.flac", "B/CD2/01.flac"} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := NewWalkMark("")
+	var seen []string
+	record := func(path string) (bool, int, error) {
+		seen = append(seen, path)
+		if len(seen) == 3 {
+			cancel()
+		}
+		return true, 0, nil
+	}
+	if _, _, _, _, err := WalkAndProcess(ctx, root, first, WalkLimits{Workers: 1}, record, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("first walk: err = %v, want context.Canceled", err)
+	}
+	if first.Reached() != all[2] {
+		t.Fatalf("reached %q, want %q", first.Reached(), all[2])
+	}
+
+	second := NewWalkMark(first.Reached())
+	if n := CountRemainingFiles(root, second); n != 2 {
+		t.Errorf("CountRemainingFiles = %d, want the 2 not yet done", n)
+	}
+	if _, _, _, _, err := WalkAndProcess(context.Background(), root, second, WalkLimits{Workers: 1}, record, nil); err != nil {
+		t.Fatalf("resumed walk: %v", err)
+	}
+	if !reflect.DeepEqual(seen, all) {
+		t.Errorf("visited %v,\nwant each file once, in walk order: %v", seen, all)
+	}
+	if second.Reached() != all[4] {
+		t.Errorf("reached %q after the resumed walk, want the last file", second.Reached())
+	}
+}
+
+// A file that fails does not hold the mark back, and is not lost behind it either:
+// the mark lists it, and a walk resumed with that list visits it again — and only it
+// and what the stopped walk never reached.
+func TestWalkAndProcessRetriesWhatItFailed(t *testing.T) {
+	root := t.TempDir()
+	var all []string
+	for _, name := range []string{"01.flac", "02.flac", "03.flac", "04.flac"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := NewWalkMark("")
+	var seen []string
+	process := func(path string) (bool, int, error) {
+		seen = append(seen, path)
+		if len(seen) == 3 {
+			cancel()
+		}
+		if path == all[1] && len(seen) == 2 {
+			return false, 0, errors.New("unreadable")
+		}
+		return true, 0, nil
+	}
+	_, _, _, errs, err := WalkAndProcess(ctx, root, first, WalkLimits{Workers: 1}, process, nil)
+	if !errors.Is(err, context.Canceled) || !reflect.DeepEqual(errs, []string{all[1]}) {
+		t.Fatalf("first walk: err = %v, failed %v", err, errs)
+	}
+	if first.Reached() != all[2] || !reflect.DeepEqual(first.Retry(), []string{all[1]}) {
+		t.Fatalf("reached %q, retry %v; want past the failure, with it listed", first.Reached(), first.Retry())
+	}
+
+	second := NewWalkMark(first.Reached(), first.Retry()...)
+	if n := CountRemainingFiles(root, second); n != 2 {
+		t.Errorf("CountRemainingFiles = %d, want the failed file and the one not reached", n)
+	}
+	seen = nil
+	counter, _, _, errs, err := WalkAndProcess(context.Background(), root, second, WalkLimits{Workers: 1}, process, nil)
+	if err != nil || counter != 2 || len(errs) != 0 {
+		t.Fatalf("resumed walk: err = %v, processed %d, failed %v", err, counter, errs)
+	}
+	if !reflect.DeepEqual(seen, []string{all[1], all[3]}) {
+		t.Errorf("visited %v, want the retry and the last file", seen)
+	}
+	if second.Reached() != all[3] || len(second.Retry()) != 0 {
+		t.Errorf("reached %q, retry %v after the resumed walk", second.Reached(), second.Retry())
+	}
+}
@@ -3,7 +3,6 @@ package modules
 import (
 	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 
 	"github.com/aunefyren/autotaggerr/logger"
@@ -43,7 +42,11 @@ func ExtractFLACTag(filePath, key, metadataType string) (string, error) {
 }
 
 // getFlacTagsMap returns all Vorbis comments as KEY -> []values (uppercased keys).
+// A metadata write a crash interrupted is finished first (see overwriteFile).
 func getFlacTagsMap(filePath string) (map[string][]string, error) {
+	if err := recoverOverwrite(filePath); err != nil {
+		return nil, err
+	}
 	stream, err := flac.ParseFile(filePath)
 	if err != nil {
 		return nil, err
@@ -110,7 +113,7 @@ func renderFLACTags(desired map[string][]string) map[string][]string {
 // silently carried fewer genres than the same albums as MP3 for no reason anyone
 // chose.
 func buildFLACDesiredTags(metadata models.FileTags) map[string][]string {
-	return map[string][]string{
+	desired := map[string][]string{
 		"ARTIST":      single(metadata.Artist),
 		"ARTISTS":     metadata.Artists,
 		"ALBUMARTIST": single(metadata.AlbumArtist),
@@ -121,6 +124,9 @@ func buildFLACDesiredTags(metadata models.FileTags) map[string][]string {
 		// ALBUMARTISTS carries the full credit for players that can read it, exactly
 		// as ARTISTS already sits beside ARTIST.
 		"ALBUMARTISTS":               metadata.AlbumArtists,
+		"ARTISTSORT":                 single(metadata.ArtistSort),
+		"ALBUMARTISTSORT":            single(metadata.AlbumArtistSort),
+		"ALBUMSORT":                  single(metadata.AlbumSort),
 		"GENRE":                      metadata.Genres,
 		"DATE":                       single(metadata.ReleaseDate),
 		"YEAR":                       single(metadata.ReleaseYear),
@@ -149,68 +155,72 @@ func buildFLACDesiredTags(metadata models.FileTags) map[string][]string {
 		"MEDIA":                      single(metadata.Media),
 		"BARCODE":                    single(metadata.Barcode),
 		"CATALOGNUMBER":              metadata.CatalogNumbers,
-		// ASIN, COMPOSER and AUTHOR are deliberately absent: nothing ever resolved a
-		// value for them, so listing them here only ever cleared whatever another
-		// tagger had written once remove_values was on. Leaving them out means a
-		// foreign tagger's value survives. MusicBrainz can supply composer (via work
-		// relations) and ASIN (on the release) if they are ever wanted for real —
-		// that is a fetch and a mapping, and it starts with models.FileTags.
+		// ASIN and AUTHOR are deliberately absent: nothing resolves a value for them,
+		// so listing them here would only clear whatever another tagger had written
+		// once remove_values was on.
 	}
+	// Picard's keys. Added only when the release was fetched with its relations;
+	// see models.FileTags.WorkCredits and RecordingCredits.
+	desired = withWorkTags(desired, metadata, [5]string{"COMPOSER", "LYRICIST", "WRITER", "WORK", "MUSICBRAINZ_WORKID"})
+	desired = withCreditTags(desired, metadata)
+	return withLoudnessTags(withNativeTags(desired, metadata), metadata)
 }
 
 // SetFlacTags updates multiple Vorbis comment tags on a FLAC file. The returned
 // changes are the field-level before/after of what was written — the Activity feed's
 // per-file detail; see models.TagChange.
+//
+// The metadata is written in one pass by writeFLACMetadata: over the old chain when
+// the new one fits its room, through a temporary file and a rename when not. This
+// used to be a metaflac process per removed key and per value — a fresh open, parse
+// and rewrite of the file each time, dozens per track on a first tagging pass — and a
+// binary every install had to carry.
 func SetFlacTags(filePath string, metadata models.FileTags, tagger models.TaggerSettings) (unchanged bool, tagsWritten int, changed []models.TagChange, err error) {
-	unchanged = false
-	tagsWritten = 0
+	desired := renderFLACTags(buildFLACDesiredTags(metadata))
 
-	filePath, err = utilities.NormalizePathForExternalTool(filePath)
+	flacMeta, err := readFLACMetadataFile(filePath)
 	if err != nil {
-		logger.Log.Error("failed to normalize path. error: " + err.Error())
-		return unchanged, tagsWritten, nil, errors.New("failed to normalize path")
+		return false, 0, nil, err
 	}
-
-	desired := renderFLACTags(buildFLACDesiredTags(metadata))
-
-	existing, err := getFlacTagsMap(filePath)
+	comments, _, err := flacMeta.comments()
 	if err != nil {
-		// Optional: keep going even if read fails, or return error
-		return unchanged, tagsWritten, nil, err
+		return false, 0, nil, fmt.Errorf("unreadable vorbis comments: %w", err)
+	}
+	existing := comments.tagsMap()
+	if metadata.Restore != nil {
+		desired, tagger = restoreDesired(existing, desired, metadata.Restore), restoreTagger(tagger)
 	}
 
 	changes, hasChanges := utilities.DiffFlacTags(existing, desired, tagger)
-	if !hasChanges {
+	existingCover := flacMeta.frontCover()
+	replaceCover := coverChanged(existingCover, metadata.FrontCover)
+	if !hasChanges && !replaceCover {
 		logger.Log.Debug("no tag changes needed: " + filePath)
-		return true, tagsWritten, nil, nil
+		return true, 0, nil, nil
 	}
 
-	// --no-utf8-convert tells metaflac the tag arguments are already UTF-8 and must be
-	// stored verbatim. Our Go strings are always UTF-8, so this is correct — and it is
-	// locale-independent. Without it, metaflac converts from the process's "local
-	// charset" to UTF-8, and on a host where that locale resolves to ASCII/C (a minimal
-	// container, or any box without en_US.UTF-8 generated) every non-ASCII byte is
-	// replaced with '#'. Forcing LANG/LC_ALL=en_US.UTF-8 here used to *cause* that,
-	// because a locale that is not installed falls back to C.
-	for key, values := range changes {
-		// remove then set only the keys that changed
-		removeCmd := exec.Command("metaflac", "--no-utf8-convert", "--remove-tag="+key, filePath)
-		if err := removeCmd.Run(); err != nil {
-			logger.Log.Error(fmt.Sprintf("failed to remove tag %s: %s", key, err.Error()))
-			return unchanged, tagsWritten, changed, errors.New("failed to remove tag")
+	blocks := flacMeta.blocks
+	if hasChanges {
+		// A key with no values was cleared by the profile's remove_values: apply
+		// removes its comments and writes nothing in their place, rather than a blank
+		// comment.
+		comments.apply(changes)
+		if blocks, err = withComments(blocks, comments); err != nil {
+			return false, 0, nil, err
 		}
-
-		// One --set-tag per value. A key with no values was cleared by the profile's
-		// remove_values, and the --remove-tag above is the whole write — setting an
-		// empty comment instead would leave a blank one behind for every cleared tag.
-		for _, value := range values {
-			setCmd := exec.Command("metaflac", "--no-utf8-convert", "--set-tag", fmt.Sprintf("%s=%s", key, value), filePath)
-			if err := setCmd.Run(); err != nil {
-				logger.Log.Error(fmt.Sprintf("failed to set tag %s: %s", key, err.Error()))
-				return unchanged, tagsWritten, changed, errors.New("failed to set tag")
-			}
+	}
+	if replaceCover {
+		if blocks, err = withFrontCover(blocks, metadata.FrontCover); err != nil {
+			return false, 0, nil, err
 		}
+	}
+	if err := writeFLACMetadata(filePath, flacMeta, blocks); err != nil {
+		logger.Log.Error("failed to write FLAC tags. error: " + err.Error())
+		return false, 0, nil, fmt.Errorf("flac tag write failed: %w", err)
+	}
 
+	changed = make([]models.TagChange, 0, len(changes)+1)
+	for key, values := range changes {
 		tagsWritten++
 		// Recorded only after the write succeeded, so the diff reports what is on
 		// disk rather than what was intended.
@@ -218,12 +228,18 @@ func SetFlacTags(filePath string, metadata models.FileTags, tagger models.Tagger
 		// "A" and "B" are the change being made here, and joining renders them
 		// identically (see utilities.DescribeTagValues).
 		changed = append(changed, models.TagChange{
-			Field: key,
-			Old:   utilities.DescribeTagValues(existing[key]),
-			New:   utilities.DescribeTagValues(values),
+			Field:  key,
+			Old:    utilities.DescribeTagValues(existing[key]),
+			New:    utilities.DescribeTagValues(values),
+			Before: existing[key],
+			After:  values,
 		})
 	}
+	if replaceCover {
+		tagsWritten++
+		changed = append(changed, coverTagChange(existingCover, metadata.FrontCover))
+	}
 
 	utilities.SortTagChanges(changed)
-	return unchanged, tagsWritten, changed, nil
+	return false, tagsWritten, changed, nil
 }
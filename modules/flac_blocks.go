@@ -0,0 +1,362 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// FLAC metadata block types this package reads or writes. Every other type (SEEKTABLE,
+// CUESHEET, APPLICATION) is carried through a rewrite byte for byte, and so is every
+// PICTURE other than the front cover.
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockPadding       = 1
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+// flacPictureFrontCover is the PICTURE type of a front cover, the ID3 APIC numbering
+// both formats share.
+const flacPictureFrontCover = 3
+
+// flacMaxBlockLength is the largest body a metadata block header can describe: the
+// length field is 24 bits.
+const flacMaxBlockLength = 1<<24 - 1
+
+// flacRewritePadding is the PADDING left behind when the file has to be rewritten. It
+// is what libFLAC's encoder leaves by default, and what other taggers expect to find
+// for writes of their own.
+const flacRewritePadding = 8192
+
+// flacVendor is the vendor string of a comment block this package creates. One that
+// already exists keeps its own: it names the encoder, not the tagger.
+const flacVendor = "Autotaggerr"
+
+// flacCommentCodec is the comment list as FLAC stores it: the list Vorbis and Opus use,
+// with no magic in front and no framing bit after, which is all a codec is to
+// parseVorbisComments.
+var flacCommentCodec = oggCodec{name: "flac"}
+
+// flacBlock is one metadata block. Whether it is the last one is not stored; it is a
+// property of where the block ends up, and encodeFLACBlocks sets it.
+type flacBlock struct {
+	Type byte
+	Data []byte
+}
+
+// flacMetadata is everything in front of a FLAC file's first audio frame.
+type flacMetadata struct {
+	// prefix is an ID3v2 tag some rippers put in front of the signature. The spec does
+	// not allow it and players skip it; it is carried through untouched, since removing
+	// it would be a decision about somebody else's data.
+	prefix []byte
+	blocks []flacBlock
+	// audioOffset is where the first frame starts, which is where the metadata ends.
+	audioOffset int64
+}
+
+// readFLACMetadata reads the signature and metadata blocks from r, stopping at the
+// first frame.
+func readFLACMetadata(r io.Reader) (*flacMetadata, error) {
+	parsed := &flacMetadata{}
+
+	signature := make([]byte, 4)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return nil, fmt.Errorf("not a FLAC file: %w", err)
+	}
+	if bytes.HasPrefix(signature, []byte("ID3")) {
+		header := make([]byte, 10)
+		copy(header, signature)
+		if _, err := io.ReadFull(r, header[4:]); err != nil {
+			return nil, fmt.Errorf("truncated ID3v2 prefix: %w", err)
+		}
+		size := int(header[6])<<21 | int(header[7])<<14 | int(header[8])<<7 | int(header[9])
+		if header[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("truncated ID3v2 prefix: %w", err)
+		}
+		parsed.prefix = append(header, body...)
+		if _, err := io.ReadFull(r, signature); err != nil {
+			return nil, fmt.Errorf("not a FLAC file: %w", err)
+		}
+	}
+	if string(signature) != "fLaC" {
+		return nil, errors.New("not a FLAC file: signature is missing")
+	}
+
+	offset := int64(len(parsed.prefix)) + 4
+	for last := false; !last; {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("truncated metadata block header: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		if blockType == 0x7f {
+			return nil, errors.New("invalid metadata block type")
+		}
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("truncated metadata block: %w", err)
+		}
+		parsed.blocks = append(parsed.blocks, flacBlock{Type: blockType, Data: data})
+		offset += 4 + int64(length)
+	}
+	if parsed.blocks[0].Type != flacBlockStreamInfo {
+		return nil, errors.New("first metadata block is not STREAMINFO")
+	}
+	parsed.audioOffset = offset
+	return parsed, nil
+}
+
+// readFLACMetadataFile is readFLACMetadata on a path, after finishing any write to it
+// a crash interrupted.
+func readFLACMetadataFile(filePath string) (*flacMetadata, error) {
+	if err := recoverOverwrite(filePath); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readFLACMetadata(file)
+}
+
+// comments decodes the file's VORBIS_COMMENT block, returning its index, or -1 and
+// an empty list when the file has none.
+func (m *flacMetadata) comments() (vorbisComments, int, error) {
+	for i, block := range m.blocks {
+		if block.Type == flacBlockVorbisComment {
+			parsed, err := parseVorbisComments(block.Data, flacCommentCodec)
+			return parsed, i, err
+		}
+	}
+	return vorbisComments{Vendor: flacVendor}, -1, nil
+}
+
+// withComments returns blocks with the comment block replaced by comments, or inserted
+// after STREAMINFO when there was none.
+func withComments(blocks []flacBlock, comments vorbisComments) ([]flacBlock, error) {
+	data := comments.encode(flacCommentCodec)
+	if len(data) > flacMaxBlockLength {
+		return nil, fmt.Errorf("vorbis comments are %d bytes; a FLAC metadata block holds at most %d", len(data), flacMaxBlockLength)
+	}
+	block := flacBlock{Type: flacBlockVorbisComment, Data: data}
+
+	out := append([]flacBlock{}, blocks...)
+	for i := range out {
+		if out[i].Type == flacBlockVorbisComment {
+			out[i] = block
+			return out, nil
+		}
+	}
+	return append(out[:1], append([]flacBlock{block}, out[1:]...)...), nil
+}
+
+// frontCover decodes the file's front cover PICTURE block, or returns nil when it has
+// none. A block that does not parse is treated as no cover, so the next write
+// replaces it.
+func (m *flacMetadata) frontCover() *models.CoverArt {
+	for _, block := range m.blocks {
+		if block.Type != flacBlockPicture {
+			continue
+		}
+		if pictureType, cover, err := parseFLACPicture(block.Data); err == nil && pictureType == flacPictureFrontCover {
+			return cover
+		}
+	}
+	return nil
+}
+
+// withFrontCover returns blocks with every front cover PICTURE replaced by cover, in
+// the place the first one held, or appended when there was none. Pictures of other
+// types — a back cover, a booklet page — are somebody's deliberate addition and stay.
+func withFrontCover(blocks []flacBlock, cover *models.CoverArt) ([]flacBlock, error) {
+	data := encodeFLACPicture(flacPictureFrontCover, cover)
+	if len(data) > flacMaxBlockLength {
+		return nil, fmt.Errorf("cover is %d bytes; a FLAC metadata block holds at most %d", len(data), flacMaxBlockLength)
+	}
+	block := flacBlock{Type: flacBlockPicture, Data: data}
+
+	out := make([]flacBlock, 0, len(blocks)+1)
+	placed := false
+	for _, existing := range blocks {
+		if existing.Type == flacBlockPicture {
+			if pictureType, _, err := parseFLACPicture(existing.Data); err != nil || pictureType == flacPictureFrontCover {
+				if !placed {
+					out = append(out, block)
+					placed = true
+				}
+				continue
+			}
+		}
+		out = append(out, existing)
+	}
+	if !placed {
+		out = append(out, block)
+	}
+	return out, nil
+}
+
+// parseFLACPicture decodes a PICTURE block body.
+func parseFLACPicture(data []byte) (uint32, *models.CoverArt, error) {
+	rest := data
+	readUint32 := func() (uint32, error) {
+		if len(rest) < 4 {
+			return 0, errors.New("truncated PICTURE block")
+		}
+		value := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		return value, nil
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(n) > uint64(len(rest)) {
+			return nil, errors.New("PICTURE field runs past the block")
+		}
+		value := rest[:n]
+		rest = rest[n:]
+		return value, nil
+	}
+
+	pictureType, err := readUint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	mimeType, err := readBytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := readBytes(); err != nil { // description
+		return 0, nil, err
+	}
+	width, err := readUint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	height, err := readUint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	rest = rest[min(8, len(rest)):] // colour depth and palette size
+	picture, err := readBytes()
+	if err != nil {
+		return 0, nil, err
+	}
+	return pictureType, &models.CoverArt{
+		Data:     picture,
+		MIMEType: string(mimeType),
+		Width:    int(width),
+		Height:   int(height),
+	}, nil
+}
+
+// encodeFLACPicture is the write direction of parseFLACPicture. The colour depth is
+// stated as 24 bits, which every cover this package embeds is; the palette size is
+// zero, which is what it means for a JPEG or a true-colour PNG.
+func encodeFLACPicture(pictureType uint32, cover *models.CoverArt) []byte {
+	var out bytes.Buffer
+	writeUint32 := func(value uint32) { binary.Write(&out, binary.BigEndian, value) }
+	writeUint32(pictureType)
+	writeUint32(uint32(len(cover.MIMEType)))
+	out.WriteString(cover.MIMEType)
+	writeUint32(0) // description
+	writeUint32(uint32(cover.Width))
+	writeUint32(uint32(cover.Height))
+	writeUint32(24)
+	writeUint32(0)
+	writeUint32(uint32(len(cover.Data)))
+	out.Write(cover.Data)
+	return out.Bytes()
+}
+
+// encodeFLACBlocks renders the signature and blocks, flagging the last block as such.
+func encodeFLACBlocks(blocks []flacBlock) []byte {
+	var out bytes.Buffer
+	out.WriteString("fLaC")
+	for i, block := range blocks {
+		header := uint32(block.Type)<<24 | uint32(len(block.Data))
+		if i == len(blocks)-1 {
+			header |= 0x80 << 24
+		}
+		binary.Write(&out, binary.BigEndian, header)
+		out.Write(block.Data)
+	}
+	return out.Bytes()
+}
+
+// fitFLACPadding lays blocks out to take exactly room bytes (signature included),
+// making up the difference with a single PADDING block at the end. It reports false
+// when that cannot be done: the blocks are too big, or the difference is under the
+// four bytes a block header needs.
+func fitFLACPadding(blocks []flacBlock, room int64) ([]flacBlock, bool) {
+	size := int64(4)
+	for _, block := range blocks {
+		size += 4 + int64(len(block.Data))
+	}
+	spare := room - size
+	switch {
+	case spare == 0:
+		return blocks, true
+	case spare >= 4 && spare-4 <= flacMaxBlockLength:
+		return append(blocks, flacBlock{Type: flacBlockPadding, Data: make([]byte, spare-4)}), true
+	default:
+		return nil, false
+	}
+}
+
+// writeFLACMetadata replaces the metadata of the file m was read from with blocks.
+// Existing PADDING blocks are dropped from blocks first; they are the room the write
+// has to work with, not content.
+//
+// A new chain that fits the room the old one took — which, with the padding a rewrite
+// leaves, is nearly every tagging pass — is written over the old one, the way
+// metaflac does it: the padding shrinks as blocks grow and grows as they shrink, and
+// the audio is not touched. overwriteFile journals the chain first, so a crash part
+// way through leaves a file the next read puts right rather than a chain no reader
+// can walk.
+//
+// A chain that does not fit rewrites the file through rewriteFile, with
+// flacRewritePadding of fresh padding so that the next change fits.
+func writeFLACMetadata(filePath string, m *flacMetadata, blocks []flacBlock) error {
+	content := make([]flacBlock, 0, len(blocks)+1)
+	for _, block := range blocks {
+		if block.Type != flacBlockPadding {
+			content = append(content, block)
+		}
+	}
+
+	room := m.audioOffset - int64(len(m.prefix))
+	if fitted, ok := fitFLACPadding(content, room); ok {
+		return overwriteFile(filePath, int64(len(m.prefix)), encodeFLACBlocks(fitted))
+	}
+
+	content = append(content, flacBlock{Type: flacBlockPadding, Data: make([]byte, flacRewritePadding)})
+	return rewriteFile(filePath, func(source *os.File, target io.Writer) error {
+		if _, err := target.Write(m.prefix); err != nil {
+			return err
+		}
+		if _, err := target.Write(encodeFLACBlocks(content)); err != nil {
+			return err
+		}
+		if _, err := source.Seek(m.audioOffset, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(target, source)
+		return err
+	})
+}
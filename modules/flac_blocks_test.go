@@ -0,0 +1,323 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// The writer never looks at a frame, so these fixtures are a real STREAMINFO and
+// metadata blocks in front of bytes standing in for the audio — enough for
+// mewkiz/flac to parse the result, which is the reader the rest of the package uses.
+
+// flacFrames stands in for the audio; every test checks it comes through untouched.
+var flacFrames = append([]byte{0xff, 0xf8}, bytes.Repeat([]byte{0x5a}, 4000)...)
+
+func flacStreamInfo() flacBlock {
+	data := make([]byte, 34)
+	binary.BigEndian.PutUint16(data[0:], 4096) // minimum block size
+	binary.BigEndian.PutUint16(data[2:], 4096) // maximum block size
+	// 44100 Hz, mono, 16 bits per sample, sample count unknown.
+	binary.BigEndian.PutUint32(data[10:], 44100<<12|0<<9|15<<4)
+	return flacBlock{Type: flacBlockStreamInfo, Data: data}
+}
+
+// synthFLAC writes prefix + the blocks (STREAMINFO first) + flacFrames.
+func synthFLAC(t *testing.T, prefix []byte, blocks ...flacBlock) string {
+	t.Helper()
+	file := slices.Concat(prefix, encodeFLACBlocks(append([]flacBlock{flacStreamInfo()}, blocks...)), flacFrames)
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func commentBlock(comments ...string) flacBlock {
+	return flacBlock{Type: flacBlockVorbisComment, Data: vorbisComments{Vendor: "reference libFLAC 1.4.3", Comments: comments}.encode(flacCommentCodec)}
+}
+
+func paddingBlock(n int) flacBlock {
+	return flacBlock{Type: flacBlockPadding, Data: make([]byte, n)}
+}
+
+// seedFlacComment appends a raw comment, the way another tagger would have left it.
+func seedFlacComment(t *testing.T, path, comment string) {
+	t.Helper()
+	flacMeta, err := readFLACMetadataFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, _, err := flacMeta.comments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments.Comments = append(comments.Comments, comment)
+	blocks, err := withComments(flacMeta.blocks, comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFLACMetadata(path, flacMeta, blocks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFLACFramesIntact(t *testing.T, path string) *flacMetadata {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flacMeta, err := readFLACMetadata(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("readFLACMetadata: %v", err)
+	}
+	if !bytes.Equal(data[flacMeta.audioOffset:], flacFrames) {
+		t.Fatal("the frames did not come through the write")
+	}
+	return flacMeta
+}
+
+func TestFlacWriteGrowsIntoPadding(t *testing.T) {
+	path := synthFLAC(t, nil, commentBlock("ENCODER=synth", "TITLE=old"), paddingBlock(flacRewritePadding))
+	before, _ := os.Stat(path)
+
+	meta := models.FileTags{Artist: "Compton’s Most Wanted", Title: "Intro", Genres: []string{"Hip Hop", "Rap"}}
+	unchanged, written, changed, err := SetFlacTags(path, meta, models.TaggerSettings{})
+	if err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+	if unchanged || written != 3 || len(changed) != 3 {
+		t.Fatalf("unchanged=%v written=%d changes=%v", unchanged, written, changed)
+	}
+
+	// The comment block grew into the padding: the new chain is written over the old
+	// one and the padding shrinks by what the comments gained.
+	after, _ := os.Stat(path)
+	if !os.SameFile(before, after) || after.Size() != before.Size() {
+		t.Error("a chain that fits the old padding should be written over the old chain")
+	}
+	flacMeta := assertFLACFramesIntact(t, path)
+	grown := len(flacMeta.blocks[1].Data) - len(commentBlock("ENCODER=synth", "TITLE=old").Data)
+	if last := flacMeta.blocks[len(flacMeta.blocks)-1]; last.Type != flacBlockPadding || len(last.Data) != flacRewritePadding-grown {
+		t.Errorf("padding after an in-place write = %d bytes, want %d", len(last.Data), flacRewritePadding-grown)
+	}
+	if _, err := os.Stat(overwriteJournalPath(path)); !os.IsNotExist(err) {
+		t.Errorf("the journal was left behind: %v", err)
+	}
+
+	// Read back through mewkiz/flac, the reader everything else uses.
+	tags, err := getFlacTagsMap(path)
+	if err != nil {
+		t.Fatalf("getFlacTagsMap: %v", err)
+	}
+	for key, want := range map[string][]string{
+		"ARTIST":  {"Compton’s Most Wanted"},
+		"TITLE":   {"Intro"},
+		"GENRE":   {"Hip Hop", "Rap"},
+		"ENCODER": {"synth"},
+	} {
+		if got := tags[key]; !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	comments, _, _ := flacMeta.comments()
+	if comments.Vendor != "reference libFLAC 1.4.3" {
+		t.Errorf("vendor = %q; it names the encoder and is not ours to change", comments.Vendor)
+	}
+
+	if unchanged, _, _, err := SetFlacTags(path, meta, models.TaggerSettings{}); err != nil || !unchanged {
+		t.Errorf("second identical write should be a no-op, got unchanged=%v err=%v", unchanged, err)
+	}
+}
+
+func TestFlacWriteInPlaceWithinPadding(t *testing.T) {
+	path := synthFLAC(t, nil, commentBlock("ENCODER=synth", "TITLE=old"), paddingBlock(100))
+	before, _ := os.Stat(path)
+	headers := func() []byte {
+		data, _ := os.ReadFile(path)
+		return slices.Concat(data[42:46], data[len(data)-len(flacFrames)-104:len(data)-len(flacFrames)-100])
+	}
+	wantHeaders := headers()
+
+	if _, _, _, err := SetFlacTags(path, models.FileTags{Title: "new"}, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if !os.SameFile(before, after) || after.Size() != before.Size() {
+		t.Error("a same-length change to one block should be written over that block alone")
+	}
+	if !bytes.Equal(headers(), wantHeaders) {
+		t.Error("an in-place write touched a block header")
+	}
+	assertFLACFramesIntact(t, path)
+	if tags, err := getFlacTagsMap(path); err != nil || !slices.Equal(tags["TITLE"], []string{"new"}) {
+		t.Errorf("TITLE = %v, err %v", tags["TITLE"], err)
+	}
+
+	// A PICTURE added takes its room from the padding as well.
+	flacMeta, err := readFLACMetadataFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := withFrontCover(flacMeta.blocks, &models.CoverArt{MIMEType: "image/png", Data: []byte("png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFLACMetadata(path, flacMeta, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := os.Stat(path); !os.SameFile(after, written) || written.Size() != before.Size() {
+		t.Error("a PICTURE that fits the padding should not rewrite the file")
+	}
+	if cover := assertFLACFramesIntact(t, path).frontCover(); cover == nil || string(cover.Data) != "png" {
+		t.Errorf("front cover = %+v", cover)
+	}
+}
+
+func TestFlacWriteInterruptedOverwriteIsFinished(t *testing.T) {
+	path := synthFLAC(t, nil, commentBlock("ENCODER=synth", "TITLE=old"), paddingBlock(flacRewritePadding))
+	original, _ := os.ReadFile(path)
+
+	// The chain a retitle writes, journaled, and then cut off half way over the file
+	// the way a crash would leave it.
+	flacMeta, err := readFLACMetadataFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := withComments(flacMeta.blocks, vorbisComments{Vendor: "reference libFLAC 1.4.3", Comments: []string{"ENCODER=synth", "TITLE=" + strings.Repeat("new", 100)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitted, ok := fitFLACPadding(blocks[:len(blocks)-1], flacMeta.audioOffset)
+	if !ok {
+		t.Fatal("the new chain should fit")
+	}
+	chain := encodeFLACBlocks(fitted)
+	if err := journalOverwrite(path, 0, chain); err != nil {
+		t.Fatal(err)
+	}
+	torn := slices.Concat(chain[:len(chain)/2], original[len(chain)/2:])
+	if err := os.WriteFile(path, torn, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next read finishes the write rather than failing on the torn chain.
+	tags, err := getFlacTagsMap(path)
+	if err != nil {
+		t.Fatalf("getFlacTagsMap on an interrupted write: %v", err)
+	}
+	if !slices.Equal(tags["TITLE"], []string{strings.Repeat("new", 100)}) {
+		t.Errorf("TITLE = %v, want the journaled value", tags["TITLE"])
+	}
+	assertFLACFramesIntact(t, path)
+	if _, err := os.Stat(overwriteJournalPath(path)); !os.IsNotExist(err) {
+		t.Errorf("the journal was not removed: %v", err)
+	}
+	if _, _, _, err := SetFlacTags(path, models.FileTags{Title: "Title"}, models.TaggerSettings{}); err != nil {
+		t.Errorf("SetFlacTags after recovery: %v", err)
+	}
+
+	// A journal the crash cut short is from before the file was touched: it is
+	// dropped and the file left as it is.
+	before, _ := os.ReadFile(path)
+	if err := journalOverwrite(path, 0, chain); err != nil {
+		t.Fatal(err)
+	}
+	journal, _ := os.ReadFile(overwriteJournalPath(path))
+	if err := os.WriteFile(overwriteJournalPath(path), journal[:len(journal)-10], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFLACMetadataFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Error("a journal cut short was replayed into the file")
+	}
+	if _, err := os.Stat(overwriteJournalPath(path)); !os.IsNotExist(err) {
+		t.Errorf("a journal cut short was not removed: %v", err)
+	}
+}
+
+func TestFlacWriteOutgrowingPaddingRewritesTheFile(t *testing.T) {
+	application := flacBlock{Type: 2, Data: []byte("abcdsome application data")}
+	path := synthFLAC(t, nil, application, commentBlock(), paddingBlock(16))
+
+	meta := models.FileTags{Title: "Title", Genres: []string{strings.Repeat("g", 500)}}
+	if _, _, _, err := SetFlacTags(path, meta, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+
+	flacMeta := assertFLACFramesIntact(t, path)
+	types := []byte{}
+	for _, block := range flacMeta.blocks {
+		types = append(types, block.Type)
+	}
+	if !slices.Equal(types, []byte{flacBlockStreamInfo, 2, flacBlockVorbisComment, flacBlockPadding}) {
+		t.Errorf("block order = %v; blocks that are not ours must keep their place", types)
+	}
+	if !bytes.Equal(flacMeta.blocks[1].Data, application.Data) {
+		t.Error("the APPLICATION block was changed")
+	}
+	if got := len(flacMeta.blocks[3].Data); got != flacRewritePadding {
+		t.Errorf("padding after a rewrite = %d, want %d so the next write fits", got, flacRewritePadding)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("the rewrite left %d files behind", len(entries))
+	}
+}
+
+func TestFlacWriteExactFitAndNoCommentBlock(t *testing.T) {
+	// No comment block and no padding: the first write adds both, and has to rewrite.
+	path := synthFLAC(t, nil)
+	if _, _, _, err := SetFlacTags(path, models.FileTags{Title: "Title"}, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+	flacMeta := assertFLACFramesIntact(t, path)
+	comments, index, err := flacMeta.comments()
+	if err != nil || index != 1 {
+		t.Fatalf("the comment block should follow STREAMINFO, got index %d err %v", index, err)
+	}
+	if comments.Vendor != flacVendor || !slices.Equal(comments.Comments, []string{"TITLE=Title"}) {
+		t.Errorf("comments = %+v", comments)
+	}
+
+	// A change that leaves one to three spare bytes cannot be padded in place — a
+	// block header alone is four — so it must rewrite rather than corrupt.
+	room := flacMeta.audioOffset
+	for spare := int64(0); spare < 6; spare++ {
+		blocks := []flacBlock{flacStreamInfo(), {Type: flacBlockVorbisComment, Data: make([]byte, room-4-4-34-4-spare)}}
+		fitted, ok := fitFLACPadding(blocks, room)
+		if want := spare == 0 || spare >= 4; ok != want {
+			t.Errorf("spare %d: fits=%v, want %v", spare, ok, want)
+		}
+		if ok && int64(len(encodeFLACBlocks(fitted))) != room {
+			t.Errorf("spare %d: laid out to %d bytes, want %d", spare, len(encodeFLACBlocks(fitted)), room)
+		}
+	}
+}
+
+func TestFlacWriteKeepsAnID3v2Prefix(t *testing.T) {
+	prefix := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05"), "xxxxx"...)
+	path := synthFLAC(t, prefix, paddingBlock(100))
+
+	if _, _, _, err := SetFlacTags(path, models.FileTags{Title: "Title"}, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetFlacTags: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(data, prefix) {
+		t.Error("the ID3v2 prefix was not carried through")
+	}
+	assertFLACFramesIntact(t, path)
+	if tags, err := getFlacTagsMap(path); err != nil || !slices.Equal(tags["TITLE"], []string{"Title"}) {
+		t.Errorf("TITLE = %v, err %v", tags["TITLE"], err)
+	}
+}
@@ -0,0 +1,244 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// Localized names: a profile's locale preference, for a library whose listeners
+// want 坂本龍一 as Ryuichi Sakamoto. It works at two levels, because MusicBrainz keeps
+// the two kinds of name in two places.
+//
+// Artists have aliases, each tagged with the locale it is the name for, one of them
+// marked primary. Those arrive with the release (the aliases include), so an artist's
+// localized name costs nothing to look up.
+//
+// Titles have no aliases. A release's tracklisting in another script is a separate
+// pseudo-release linked by a "transl-tracklisting" relationship, and using it means
+// fetching it — which is why that half is opt-in, and why it lives outside
+// BuildFileTags, whose callers rely on it doing no I/O.
+//
+// Either way the release's own spelling is not thrown away: it is kept in the
+// *_NATIVE tags, so the file still says what the sleeve says.
+
+// transliterationRelation is the release-release relationship type linking a release
+// to a pseudo-release carrying its tracklisting translated or transliterated.
+const transliterationRelation = "transl-tracklisting"
+
+// defaultTransliterationScript is the script a transliterated title is looked for in
+// when the profile's locale does not name one.
+const defaultTransliterationScript = "Latn"
+
+// normalizeLocale lower-cases a locale tag and spells it the way MusicBrainz does,
+// with underscores: "ja-Latn" and "ja_latn" are the same preference.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "-", "_"))
+}
+
+// localeLanguage is the language half of a normalized locale.
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(locale, "_")
+	return language
+}
+
+// localeScript finds the ISO 15924 script subtag of a locale — the four-letter one —
+// in MusicBrainz's capitalisation, or "" when the locale names none.
+func localeScript(locale string) string {
+	for _, part := range strings.Split(normalizeLocale(locale), "_")[1:] {
+		if len(part) == 4 {
+			return strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return ""
+}
+
+// localeAlias picks an artist's name for a locale: an alias for exactly that locale,
+// or — when the preference names only a language — for any region of it, the primary
+// alias first either way. Search hints are misspellings kept so search finds the
+// artist and ended aliases are names the artist no longer goes by; neither is a name
+// to write.
+//
+// "ja-Latn" never falls back to a plain "ja" alias: that would be the native script,
+// the very thing the preference exists to avoid.
+func localeAlias(artist models.Artist, locale string) (models.Alias, bool) {
+	want := normalizeLocale(locale)
+	if want == "" {
+		return models.Alias{}, false
+	}
+	languageOnly := !strings.Contains(want, "_")
+
+	var best models.Alias
+	found := false
+	for _, alias := range artist.Aliases {
+		if alias.Ended || alias.Type == "Search hint" || alias.Name == "" {
+			continue
+		}
+		have := normalizeLocale(alias.Locale)
+		if have != want && !(languageOnly && localeLanguage(have) == want) {
+			continue
+		}
+		// An exact match beats a regional one, and a primary alias beats either of
+		// its own kind.
+		if !found || rankAlias(alias, want) > rankAlias(best, want) {
+			best, found = alias, true
+		}
+	}
+	return best, found
+}
+
+func rankAlias(alias models.Alias, want string) int {
+	rank := 0
+	if normalizeLocale(alias.Locale) == want {
+		rank += 2
+	}
+	if alias.Primary {
+		rank++
+	}
+	return rank
+}
+
+// artistCreditName is the name one credited artist is written under: their alias for
+// the profile's locale when they have one, and otherwise the credited or current name
+// as use_current_artist_name says.
+func artistCreditName(credit models.ArtistCredit, tagger models.TaggerSettings) string {
+	if alias, ok := localeAlias(credit.Artist, tagger.Locale); ok {
+		return alias.Name
+	}
+	if tagger.UseCurrentArtistName {
+		return credit.Artist.Name
+	}
+	return credit.Name
+}
+
+// artistCreditSortName is artistCreditName's sort key. A localized name sorts by its
+// alias's own sort name, since "Sakamoto, Ryuichi" is not the sort name of 坂本龍一.
+func artistCreditSortName(credit models.ArtistCredit, tagger models.TaggerSettings) string {
+	if alias, ok := localeAlias(credit.Artist, tagger.Locale); ok {
+		if alias.SortName != "" {
+			return alias.SortName
+		}
+		return alias.Name
+	}
+	if credit.Artist.SortName != "" {
+		return credit.Artist.SortName
+	}
+	return artistCreditName(credit, tagger)
+}
+
+// withoutLocale is the same profile with no locale, for spelling a name natively.
+func withoutLocale(tagger models.TaggerSettings) models.TaggerSettings {
+	tagger.Locale = ""
+	return tagger
+}
+
+// nativeIfDifferent returns the native spelling when localizing changed it, and ""
+// when it did not — a native tag that repeats the tag beside it says nothing.
+func nativeIfDifferent(native, localized string) string {
+	if native == localized {
+		return ""
+	}
+	return native
+}
+
+// transliteratedReleaseID picks the pseudo-release whose tracklisting to take titles
+// from: one linked from this release in the locale's script, preferring one that keeps
+// the release's language — a transliteration rather than a translation. "" means
+// there is none, or the profile does not ask.
+func transliteratedReleaseID(response models.MusicBrainzReleaseResponse, tagger models.TaggerSettings) string {
+	if !tagger.PreferTransliteratedTitles {
+		return ""
+	}
+	script := localeScript(tagger.Locale)
+	if script == "" {
+		script = defaultTransliterationScript
+	}
+	if strings.EqualFold(response.TextRepresentation.Script, script) {
+		return "" // already in it
+	}
+
+	chosen := ""
+	for _, rel := range response.Relations {
+		if rel.Type != transliterationRelation || rel.Direction == "backward" || rel.Release == nil {
+			continue
+		}
+		if !strings.EqualFold(rel.Release.TextRepresentation.Script, script) {
+			continue
+		}
+		if rel.Release.TextRepresentation.Language == response.TextRepresentation.Language {
+			return rel.Release.ID
+		}
+		if chosen == "" {
+			chosen = rel.Release.ID
+		}
+	}
+	return chosen
+}
+
+// LocalizeTitles applies the profile's transliterated-title preference to tags built
+// by BuildFileTags: the album and track titles come from the linked pseudo-release,
+// matched by disc and track position, and the release's own titles move to the native
+// tags. getRelease fetches the pseudo-release, through the same cache as any release.
+//
+// A release cached before the fetch asked for its relationships cannot say whether it
+// has a transliteration, so it is left as it is — titles and native tags both — until
+// its entry refreshes. A pseudo-release that cannot be fetched fails the file, rather
+// than writing native titles over transliterated ones for the length of an outage.
+func LocalizeTitles(
+	metadata *models.FileTags,
+	track models.Track,
+	media models.MusicBrainzMedia,
+	response models.MusicBrainzReleaseResponse,
+	tagger models.TaggerSettings,
+	getRelease func(mbID string) (models.MusicBrainzReleaseResponse, error),
+) error {
+	if !tagger.PreferTransliteratedTitles || response.Relations == nil {
+		return nil
+	}
+	metadata.LocalizedTitles = true
+
+	pseudoID := transliteratedReleaseID(response, tagger)
+	if pseudoID == "" {
+		return nil
+	}
+	pseudo, err := getRelease(pseudoID)
+	if err != nil {
+		return fmt.Errorf("failed to get the transliterated release %s: %w", pseudoID, err)
+	}
+
+	if pseudo.Title != "" {
+		metadata.NativeAlbum = nativeIfDifferent(metadata.Album, pseudo.Title)
+		metadata.Album = pseudo.Title
+		metadata.AlbumSort = pseudo.Title
+	}
+	for _, pseudoMedia := range pseudo.Media {
+		if pseudoMedia.Position != media.Position {
+			continue
+		}
+		for _, pseudoTrack := range pseudoMedia.Tracks {
+			if pseudoTrack.Position == track.Position && pseudoTrack.Title != "" {
+				metadata.NativeTitle = nativeIfDifferent(metadata.Title, pseudoTrack.Title)
+				metadata.Title = pseudoTrack.Title
+				return nil
+			}
+		}
+	}
+	logger.Log.Debugf("transliterated release %s has no track %d on disc %d; keeping the native title", pseudoID, track.Position, media.Position)
+	return nil
+}
+
+// withNativeTags adds the native-spelling keys to an engine's desired map, for the
+// halves of localization the profile has on.
+func withNativeTags(desired map[string][]string, metadata models.FileTags) map[string][]string {
+	if metadata.LocalizedArtists {
+		desired["ARTIST_NATIVE"] = single(metadata.NativeArtist)
+		desired["ALBUMARTIST_NATIVE"] = single(metadata.NativeAlbumArtist)
+	}
+	if metadata.LocalizedTitles {
+		desired["ALBUM_NATIVE"] = single(metadata.NativeAlbum)
+		desired["TITLE_NATIVE"] = single(metadata.NativeTitle)
+	}
+	return desired
+}
@@ -0,0 +1,132 @@
+package modules
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+func sakamoto() models.ArtistCredit {
+	return models.ArtistCredit{Name: "坂本龍一", Artist: models.Artist{
+		ID: "rs", Name: "坂本龍一", SortName: "坂本龍一",
+		Aliases: []models.Alias{
+			{Name: "Sakamoto Ryūichi", Locale: "ja_Latn", SortName: "Sakamoto, Ryūichi"},
+			{Name: "Ryuichi Sakamoto", Locale: "en", SortName: "Sakamoto, Ryuichi", Primary: true},
+			{Name: "Ryuichi Sakamoto (US)", Locale: "en_US"},
+			{Name: "Riuichi Sakamoto", Locale: "en", Type: "Search hint", Primary: true},
+			{Name: "坂本龍一", Locale: "ja", Primary: true},
+		},
+	}}
+}
+
+func TestLocaleAliasPicksTheNameForTheLocale(t *testing.T) {
+	credit := sakamoto()
+	for locale, want := range map[string]string{
+		"en":      "Ryuichi Sakamoto",      // the primary alias, not the search hint
+		"EN-us":   "Ryuichi Sakamoto (US)", // exact, in any spelling of the tag
+		"ja-Latn": "Sakamoto Ryūichi",
+		"ja":      "坂本龍一",
+		"de":      "坂本龍一", // no alias: the credited name
+		"":        "坂本龍一",
+	} {
+		if got := artistCreditName(credit, models.TaggerSettings{Locale: locale}); got != want {
+			t.Errorf("locale %q: %q, want %q", locale, got, want)
+		}
+	}
+
+	// A script preference never settles for the language's own alias: ja_Latn with no
+	// romanised alias is the credited name, not the kanji one marked primary for "ja".
+	credit.Artist.Aliases = credit.Artist.Aliases[1:]
+	credit.Name = "Ryuichi Sakamoto"
+	if got := artistCreditName(credit, models.TaggerSettings{Locale: "ja-Latn"}); got != "Ryuichi Sakamoto" {
+		t.Errorf("ja-Latn fell back to %q", got)
+	}
+}
+
+func TestLocaleRenamesArtistsAndKeepsTheNativeSpelling(t *testing.T) {
+	release := models.MusicBrainzReleaseResponse{ID: "r", Title: "音楽図鑑", ArtistCredit: []models.ArtistCredit{sakamoto()}}
+	track := models.Track{Title: "TIBETAN DANCE", ArtistCredit: []models.ArtistCredit{sakamoto()}}
+
+	metadata, err := BuildFileTags(track, models.MusicBrainzMedia{}, release, models.TaggerSettings{Locale: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Artist != "Ryuichi Sakamoto" || metadata.AlbumArtist != "Ryuichi Sakamoto" {
+		t.Errorf("artist %q / album artist %q, want the English alias", metadata.Artist, metadata.AlbumArtist)
+	}
+	if metadata.ArtistSort != "Sakamoto, Ryuichi" {
+		t.Errorf("ARTISTSORT = %q; a localized name sorts by its alias's sort name", metadata.ArtistSort)
+	}
+	desired := buildFLACDesiredTags(metadata)
+	assertTag(t, desired, "ARTIST_NATIVE", "坂本龍一")
+	assertTag(t, desired, "ALBUMARTIST_NATIVE", "坂本龍一")
+
+	// Without a locale the native keys are not ours to write, or to clear.
+	plain, _ := BuildFileTags(track, models.MusicBrainzMedia{}, release, models.TaggerSettings{})
+	if _, ok := buildMP3DesiredTags(plain)["ARTIST_NATIVE"]; ok {
+		t.Error("ARTIST_NATIVE is in the desired tags of a profile with no locale")
+	}
+}
+
+// transliterated returns a release linked to two pseudo-releases in Latin script: an
+// English translation, and the romanised transliteration that keeps the language.
+func transliterated() models.MusicBrainzReleaseResponse {
+	release := models.MusicBrainzReleaseResponse{ID: "orig", Title: "音楽図鑑"}
+	release.TextRepresentation.Language, release.TextRepresentation.Script = "jpn", "Jpan"
+	for _, pseudo := range []struct{ id, language string }{{"translation", "eng"}, {"romaji", "jpn"}} {
+		related := &models.RelatedRelease{ID: pseudo.id, Status: "Pseudo-Release"}
+		related.TextRepresentation.Language, related.TextRepresentation.Script = pseudo.language, "Latn"
+		release.Relations = append(release.Relations, models.Relation{
+			Type: "transl-tracklisting", TargetType: "release", Direction: "forward", Release: related,
+		})
+	}
+	return release
+}
+
+func TestLocalizeTitlesTakesTheTransliteratedTracklisting(t *testing.T) {
+	release := transliterated()
+	media := models.MusicBrainzMedia{Position: 1}
+	track := models.Track{Position: 2, Title: "羽の林で"}
+	tagger := models.TaggerSettings{Locale: "ja-Latn", PreferTransliteratedTitles: true}
+
+	var fetched []string
+	getRelease := func(id string) (models.MusicBrainzReleaseResponse, error) {
+		fetched = append(fetched, id)
+		return models.MusicBrainzReleaseResponse{ID: id, Title: "Ongaku Zukan", Media: []models.MusicBrainzMedia{{
+			Position: 1, Tracks: []models.Track{{Position: 1, Title: "Tibetan Dance"}, {Position: 2, Title: "Hane no Hayashi de"}},
+		}}}, nil
+	}
+
+	metadata := models.FileTags{Album: release.Title, Title: track.Title}
+	if err := LocalizeTitles(&metadata, track, media, release, tagger, getRelease); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 1 || fetched[0] != "romaji" {
+		t.Errorf("fetched %v; a transliteration beats a translation", fetched)
+	}
+	if metadata.Album != "Ongaku Zukan" || metadata.Title != "Hane no Hayashi de" {
+		t.Errorf("titles = %q / %q", metadata.Album, metadata.Title)
+	}
+	desired := buildFLACDesiredTags(metadata)
+	assertTag(t, desired, "ALBUM_NATIVE", "音楽図鑑")
+	assertTag(t, desired, "TITLE_NATIVE", "羽の林で")
+
+	// A release cached before its relationships were fetched cannot say whether it has
+	// a transliteration, so nothing about its titles is touched — native tags included.
+	stale := release
+	stale.Relations = nil
+	untouched := models.FileTags{Album: release.Title, Title: track.Title}
+	if err := LocalizeTitles(&untouched, track, media, stale, tagger, getRelease); err != nil || untouched.LocalizedTitles {
+		t.Errorf("a release without relations was localized (err %v)", err)
+	}
+
+	// An outage fails the file rather than writing the native titles back over the
+	// transliterated ones.
+	failing := func(string) (models.MusicBrainzReleaseResponse, error) {
+		return models.MusicBrainzReleaseResponse{}, errors.New("503")
+	}
+	if err := LocalizeTitles(&models.FileTags{}, track, media, release, tagger, failing); err == nil {
+		t.Error("a failed pseudo-release fetch was not reported")
+	}
+}
@@ -0,0 +1,785 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/pion/opus"
+	"github.com/pion/opus/pkg/oggreader"
+)
+
+// Loudness: ReplayGain 2.0 measured in-process, so a library normalised for Plexamp or
+// a portable player needs no second tool after every pass — and no second tool whose
+// tags this one's diff then argues with.
+//
+// ReplayGain 2.0 is EBU R128 measurement with a different target: the meter is ITU-R
+// BS.1770's gated K-weighted loudness, and a gain is the distance from -18 LUFS.
+//
+// Measuring means decoding, which is the expensive part, so every measurement is
+// cached against the file's size and mtime (models.LoudnessAnalysis) and a file is
+// decoded once unless its audio changes. Album gain gates the blocks of every track
+// of the release together; the release's tracklist (ReleaseTracks) says which tracks
+// those are and the library index says which files hold them, and until all of them
+// are on disk the album gain is not known and not written.
+//
+// Opus carries the same measurement as R128_* gains relative to -23 LUFS instead, as
+// RFC 7845 asks, because an Opus player applies those and ignores REPLAYGAIN_*.
+//
+// FLAC is decoded through mewkiz/flac, the reader the FLAC engine already uses, MP3
+// through hajimehoshi/go-mp3, Vorbis through jfreymuth/oggvorbis and Opus through
+// pion/opus; all are pure Go, so the binary stays self-contained. AAC has no decoder
+// here, and an M4A is not measured, which leaves its gain tags as they are.
+
+const (
+	// replayGainReference is ReplayGain 2.0's target loudness in LUFS.
+	replayGainReference = -18.0
+	// r128Reference is EBU R128's, which Opus's R128_* gains are relative to.
+	r128Reference = -23.0
+
+	// loudnessAbsoluteGate and loudnessRelativeGate are BS.1770's two gates: blocks
+	// quieter than -70 LUFS are silence, and blocks more than 10 LU below the loudness
+	// of the rest are pauses, and neither counts toward the average.
+	loudnessAbsoluteGate = -70.0
+	loudnessRelativeGate = -10.0
+	// loudnessBinWidth is the histogram's resolution in LU. Every bin keeps the exact
+	// energy of its blocks, so the only approximation is which side of the relative
+	// gate the one bin it falls in counts on.
+	loudnessBinWidth = 0.1
+	// surroundWeight is BS.1770's weight for the surround channels (+1.5 dB).
+	surroundWeight = 1.41
+
+	// loudnessAnalyzerVersion is stamped on every cached measurement. Bump it when the
+	// meter changes, and files already measured are measured again.
+	loudnessAnalyzerVersion = 1
+)
+
+// ErrNoDecoder means a file is in a format the loudness meter cannot decode.
+var ErrNoDecoder = errors.New("no in-process decoder for this format")
+
+// errNotMeasured means a cache-only lookup found no current measurement.
+var errNotMeasured = errors.New("not measured yet")
+
+// loudnessDecoders decodes a file into a meter, by extension.
+var loudnessDecoders = map[string]func(path string) (loudnessMeasurement, error){
+	".flac": measureFLAC,
+	".mp3":  measureMP3,
+	".ogg":  measureOgg,
+	".opus": measureOgg,
+}
+
+// biquad is one second-order IIR section, transposed direct form II.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns BS.1770's K-weighting pre-filter for a sample rate: a high shelf
+// for the head, then the RLB high-pass. The standard gives coefficients for 48 kHz
+// only; these are its analogue prototypes bilinear-transformed for any rate, which
+// reproduce the published 48 kHz coefficients.
+func kWeighting(rate float64) [2]biquad {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// channelWeights are BS.1770's per-channel weights for FLAC's channel orders: 1 for
+// the front channels, 1.41 for the surrounds, and nothing for the LFE.
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for i := range weights {
+		weights[i] = 1
+	}
+	switch channels {
+	case 4: // L R Ls Rs
+		weights[2], weights[3] = surroundWeight, surroundWeight
+	case 5: // L R C Ls Rs
+		weights[3], weights[4] = surroundWeight, surroundWeight
+	case 6, 7, 8: // L R C LFE, then surrounds
+		weights[3] = 0
+		for i := 4; i < channels; i++ {
+			weights[i] = surroundWeight
+		}
+	}
+	return weights
+}
+
+// loudnessBin is one histogram bin: how many gating blocks fell in it, and their
+// summed mean-square energy.
+type loudnessBin struct {
+	Blocks int     `json:"n"`
+	Energy float64 `json:"e"`
+}
+
+// loudnessHistogram is a file's (or an album's) gating blocks above the absolute
+// gate, keyed by loudness in loudnessBinWidth steps from the gate up.
+type loudnessHistogram map[int]loudnessBin
+
+func energyLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func (h loudnessHistogram) add(energy float64) {
+	loudness := energyLoudness(energy)
+	if !(loudness > loudnessAbsoluteGate) {
+		return
+	}
+	index := int((loudness - loudnessAbsoluteGate) / loudnessBinWidth)
+	bin := h[index]
+	bin.Blocks++
+	bin.Energy += energy
+	h[index] = bin
+}
+
+func (h loudnessHistogram) merge(other loudnessHistogram) {
+	for index, bin := range other {
+		have := h[index]
+		have.Blocks += bin.Blocks
+		have.Energy += bin.Energy
+		h[index] = have
+	}
+}
+
+// integrated is the gated loudness of the histogram's blocks, false when there are
+// none — a silent file has no loudness to normalise.
+//
+// The bins are summed in loudness order, not map order: floating-point addition is not
+// associative, and a gain that could differ in its last written digit from one pass to
+// the next would rewrite the file every time.
+func (h loudnessHistogram) integrated() (float64, bool) {
+	indexes := make([]int, 0, len(h))
+	for index := range h {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	blocks, energy := 0, 0.0
+	for _, index := range indexes {
+		blocks += h[index].Blocks
+		energy += h[index].Energy
+	}
+	if blocks == 0 {
+		return 0, false
+	}
+	threshold := energyLoudness(energy/float64(blocks)) + loudnessRelativeGate
+
+	blocks, energy = 0, 0
+	for _, index := range indexes {
+		bin := h[index]
+		if energyLoudness(bin.Energy/float64(bin.Blocks)) >= threshold {
+			blocks += bin.Blocks
+			energy += bin.Energy
+		}
+	}
+	if blocks == 0 {
+		return 0, false
+	}
+	return energyLoudness(energy / float64(blocks)), true
+}
+
+// loudnessMeasurement is what measuring one file leaves: its blocks and its peak.
+type loudnessMeasurement struct {
+	histogram loudnessHistogram
+	peak      float64
+}
+
+func (m loudnessMeasurement) loudness() (models.Loudness, bool) {
+	integrated, ok := m.histogram.integrated()
+	if !ok {
+		return models.Loudness{}, false
+	}
+	return models.Loudness{Integrated: integrated, Peak: m.peak}, true
+}
+
+// loudnessMeter is a BS.1770 meter fed one interleaved frame at a time. Blocks are
+// 400 ms with 75% overlap, built from 100 ms sub-blocks, and a trailing partial block
+// is dropped as the standard says.
+type loudnessMeter struct {
+	weights     []float64
+	filters     [][2]biquad
+	subBlockLen int
+	subCount    int
+	subSum      []float64
+	// recent is the weighted energy of the last sub-blocks, up to the four a block
+	// spans.
+	recent      []float64
+	measurement loudnessMeasurement
+}
+
+func newLoudnessMeter(rate, channels int) *loudnessMeter {
+	meter := &loudnessMeter{
+		weights:     channelWeights(channels),
+		filters:     make([][2]biquad, channels),
+		subBlockLen: rate / 10,
+		subSum:      make([]float64, channels),
+		measurement: loudnessMeasurement{histogram: loudnessHistogram{}},
+	}
+	for i := range meter.filters {
+		meter.filters[i] = kWeighting(float64(rate))
+	}
+	return meter
+}
+
+// addFrame feeds one sample per channel, each as a fraction of full scale.
+func (m *loudnessMeter) addFrame(samples []float64) {
+	for channel, sample := range samples {
+		if peak := math.Abs(sample); peak > m.measurement.peak {
+			m.measurement.peak = peak
+		}
+		filters := &m.filters[channel]
+		weighted := filters[1].process(filters[0].process(sample))
+		m.subSum[channel] += weighted * weighted
+	}
+	m.subCount++
+	if m.subCount < m.subBlockLen {
+		return
+	}
+
+	energy := 0.0
+	for channel, sum := range m.subSum {
+		energy += m.weights[channel] * sum / float64(m.subBlockLen)
+		m.subSum[channel] = 0
+	}
+	m.subCount = 0
+
+	m.recent = append(m.recent, energy)
+	if len(m.recent) > 4 {
+		m.recent = m.recent[1:]
+	}
+	if len(m.recent) == 4 {
+		m.measurement.histogram.add((m.recent[0] + m.recent[1] + m.recent[2] + m.recent[3]) / 4)
+	}
+}
+
+// measureFLAC decodes a FLAC file through the meter.
+func measureFLAC(path string) (loudnessMeasurement, error) {
+	if err := recoverOverwrite(path); err != nil {
+		return loudnessMeasurement{}, err
+	}
+	stream, err := flac.Open(path)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	defer stream.Close()
+
+	info := stream.Info
+	if info.SampleRate < 10 || info.NChannels == 0 {
+		return loudnessMeasurement{}, fmt.Errorf("FLAC stream info is unusable (%d Hz, %d channels)", info.SampleRate, info.NChannels)
+	}
+	meter := newLoudnessMeter(int(info.SampleRate), int(info.NChannels))
+	scale := 1 / float64(int64(1)<<(info.BitsPerSample-1))
+	samples := make([]float64, info.NChannels)
+	for {
+		frame, err := stream.ParseNext()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return loudnessMeasurement{}, err
+		}
+		for i := 0; i < int(frame.BlockSize); i++ {
+			for channel, subframe := range frame.Subframes {
+				samples[channel] = float64(subframe.Samples[i]) * scale
+			}
+			meter.addFrame(samples)
+		}
+	}
+	return meter.measurement, nil
+}
+
+// measureMP3 decodes an MP3 file through the meter. go-mp3 always decodes to 16-bit
+// stereo, a mono stream's one channel twice over; BS.1770 sums the channels' energy,
+// so a mono file is metered on the one channel it has rather than read 3 dB louder
+// than it plays.
+func measureMP3(path string) (loudnessMeasurement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	defer file.Close()
+
+	mono, err := mp3IsMono(file)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return loudnessMeasurement{}, err
+	}
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	if decoder.SampleRate() < 10 {
+		return loudnessMeasurement{}, fmt.Errorf("MP3 sample rate is unusable (%d Hz)", decoder.SampleRate())
+	}
+
+	channels := 2
+	if mono {
+		channels = 1
+	}
+	meter := newLoudnessMeter(decoder.SampleRate(), channels)
+	samples := make([]float64, channels)
+	buffer := make([]byte, 1<<16)
+	for {
+		n, err := io.ReadFull(decoder, buffer)
+		for i := 0; i+4 <= n; i += 4 {
+			for channel := range samples {
+				samples[channel] = float64(int16(binary.LittleEndian.Uint16(buffer[i+2*channel:]))) / (1 << 15)
+			}
+			meter.addFrame(samples)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return loudnessMeasurement{}, err
+		}
+	}
+	return meter.measurement, nil
+}
+
+// measureOgg decodes an Ogg Vorbis or Ogg Opus file through the meter. The extension
+// does not say which (an .ogg is either), so the first page does.
+func measureOgg(path string) (loudnessMeasurement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	defer file.Close()
+
+	first, err := readOggPage(file)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	codec, err := detectOggCodec(first.Data)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return loudnessMeasurement{}, err
+	}
+	if codec.name == oggOpus.name {
+		return measureOpus(bufio.NewReader(file))
+	}
+	return measureVorbis(bufio.NewReader(file))
+}
+
+// vorbisChannelOrder maps Vorbis's channel order onto FLAC's, which is the order
+// channelWeights knows: Vorbis puts the centre second and the LFE last.
+var vorbisChannelOrder = map[int][]int{
+	3: {0, 2, 1},
+	5: {0, 2, 1, 3, 4},
+	6: {0, 2, 1, 4, 5, 3},
+	7: {0, 2, 1, 5, 6, 4, 3},
+	8: {0, 2, 1, 6, 7, 4, 5, 3},
+}
+
+// measureVorbis decodes an Ogg Vorbis stream through the meter, with
+// jfreymuth/oggvorbis.
+func measureVorbis(r io.Reader) (loudnessMeasurement, error) {
+	reader, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	channels := reader.Channels()
+	if reader.SampleRate() < 10 || channels == 0 {
+		return loudnessMeasurement{}, fmt.Errorf("Vorbis stream info is unusable (%d Hz, %d channels)", reader.SampleRate(), channels)
+	}
+	order := vorbisChannelOrder[channels]
+
+	meter := newLoudnessMeter(reader.SampleRate(), channels)
+	samples := make([]float64, channels)
+	buffer := make([]float32, 4096*channels)
+	for {
+		n, err := reader.Read(buffer)
+		for i := 0; i+channels <= n; i += channels {
+			for channel := range samples {
+				target := channel
+				if order != nil {
+					target = order[channel]
+				}
+				samples[target] = float64(buffer[i+channel])
+			}
+			meter.addFrame(samples)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return loudnessMeasurement{}, err
+		}
+	}
+	return meter.measurement, nil
+}
+
+// measureOpus decodes an Ogg Opus stream through the meter, with pion/opus. What is
+// metered is what a player plays: the pre-skip is dropped and the header's output
+// gain applied, which is also the level RFC 7845 has the R128 gains count from.
+//
+// Only channel mapping family 0 — mono or stereo, one stream — is decoded. Surround
+// Opus is several streams in one packet, which the decoder does not take apart.
+func measureOpus(r io.Reader) (loudnessMeasurement, error) {
+	reader, header, err := oggreader.NewWith(r)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	if header.ChannelMap != 0 {
+		return loudnessMeasurement{}, fmt.Errorf("Opus channel mapping family %d is not decoded", header.ChannelMap)
+	}
+	channels := int(header.Channels)
+	decoder, err := opus.NewDecoderWithOutput(48000, channels)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+	gain := math.Pow(10, float64(int16(header.OutputGain))/256/20)
+	skip := int(header.PreSkip)
+
+	meter := newLoudnessMeter(48000, channels)
+	samples := make([]float64, channels)
+	// 120 ms, the longest packet Opus allows.
+	buffer := make([]float32, 5760*channels)
+	for {
+		packet, _, err := reader.ParseNextPacket()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return loudnessMeasurement{}, err
+		}
+		if bytes.HasPrefix(packet, []byte(oggOpus.commentMagic)) {
+			continue
+		}
+		n, err := decoder.DecodeToFloat32(packet, buffer)
+		if err != nil {
+			return loudnessMeasurement{}, err
+		}
+		for i := 0; i < n; i++ {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			for channel := range samples {
+				samples[channel] = float64(buffer[i*channels+channel]) * gain
+			}
+			meter.addFrame(samples)
+		}
+	}
+	return meter.measurement, nil
+}
+
+// mp3IsMono reads the channel mode of the first frame header after any ID3v2 tag.
+func mp3IsMono(r io.Reader) (bool, error) {
+	reader := bufio.NewReader(r)
+	if head, err := reader.Peek(10); err == nil && string(head[:3]) == "ID3" {
+		size := int(head[6])<<21 | int(head[7])<<14 | int(head[8])<<7 | int(head[9])
+		if head[5]&0x10 != 0 {
+			size += 10 // footer
+		}
+		if _, err := reader.Discard(10 + size); err != nil {
+			return false, fmt.Errorf("truncated ID3v2 tag: %w", err)
+		}
+	}
+	// The first sync word, searched for rather than assumed: some files have junk or
+	// a stray zero run between the tag and the audio.
+	for {
+		header, err := reader.Peek(4)
+		if err != nil {
+			return false, errors.New("no MPEG frame header found")
+		}
+		if header[0] == 0xff && header[1]&0xe0 == 0xe0 {
+			return header[3]>>6 == 3, nil
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return false, err
+		}
+	}
+}
+
+// loudnessLocks serialises measuring by path, so two workers tagging the same album
+// decode each sibling once between them rather than once each. Striped rather than
+// one lock per path, which would be a map that only ever grows.
+var loudnessLocks [64]sync.Mutex
+
+func lockLoudness(path string) func() {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(path))
+	mu := &loudnessLocks[hash.Sum32()%uint32(len(loudnessLocks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// measureLoudness returns a file's measurement: from the cache when the file is
+// byte-identical to when it was measured, and otherwise by decoding it — or, when
+// analyze is false, not at all (errNotMeasured).
+func measureLoudness(path string, analyze bool) (loudnessMeasurement, error) {
+	decode, ok := loudnessDecoders[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return loudnessMeasurement{}, ErrNoDecoder
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return loudnessMeasurement{}, err
+	}
+
+	defer lockLoudness(path)()
+	if cacheDB != nil {
+		var cached models.LoudnessAnalysis
+		if err := cacheDB.First(&cached, "path = ?", path).Error; err == nil &&
+			cached.AnalyzerVersion == loudnessAnalyzerVersion && sameFileIdentity(cached.Size, cached.ModTime, fi) {
+			histogram := loudnessHistogram{}
+			if err := json.Unmarshal([]byte(cached.Histogram), &histogram); err == nil {
+				return loudnessMeasurement{histogram: histogram, peak: cached.Peak}, nil
+			}
+		}
+	}
+	if !analyze {
+		return loudnessMeasurement{}, errNotMeasured
+	}
+
+	measurement, err := decode(path)
+	if err != nil {
+		return loudnessMeasurement{}, fmt.Errorf("failed to measure the loudness of %s: %w", path, err)
+	}
+	if cacheDB != nil {
+		payload, _ := json.Marshal(measurement.histogram)
+		modTime := fi.ModTime()
+		row := models.LoudnessAnalysis{
+			Path: path, Size: fi.Size(), ModTime: &modTime,
+			AnalyzerVersion: loudnessAnalyzerVersion,
+			Histogram:       string(payload), Peak: measurement.peak,
+			AnalyzedAt: time.Now(),
+		}
+		if err := cacheDB.Save(&row).Error; err != nil {
+			logger.Log.Warnf("failed to cache the loudness of %s: %s", path, err.Error())
+		}
+	}
+	return measurement, nil
+}
+
+// sameFileIdentity compares a stored size/mtime with a file's, to the second as the
+// scan's skip check does.
+func sameFileIdentity(size int64, modTime *time.Time, fi os.FileInfo) bool {
+	return modTime != nil && size == fi.Size() && modTime.Unix() == fi.ModTime().Unix()
+}
+
+// restampLoudness moves a file's measurement onto its identity after a tag write.
+// The write changed the size and mtime the cache is keyed on, but not a sample of the
+// audio, and without this every tagged file would be decoded again on the next pass.
+// A row that did not match the file before the write is left to miss.
+func restampLoudness(path string, before os.FileInfo) {
+	if cacheDB == nil || before == nil {
+		return
+	}
+	defer lockLoudness(path)()
+
+	var cached models.LoudnessAnalysis
+	if err := cacheDB.First(&cached, "path = ?", path).Error; err != nil || !sameFileIdentity(cached.Size, cached.ModTime, before) {
+		return
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	modTime := after.ModTime()
+	cached.Size, cached.ModTime = after.Size(), &modTime
+	if err := cacheDB.Save(&cached).Error; err != nil {
+		logger.Log.Warnf("failed to keep the loudness of %s after tagging it: %s", path, err.Error())
+	}
+}
+
+// releaseFiles maps each track of a release to the indexed file under rootDir that
+// holds it. Only the index knows which files are which tracks: two releases can share
+// a folder, and one release can span several.
+func releaseFiles(rootDir, releaseID string) map[string]string {
+	files := map[string]string{}
+	if cacheDB == nil || releaseID == "" {
+		return files
+	}
+	var items []models.LibraryItem
+	if err := cacheDB.Select("path", "mb_release_track_id").
+		Where("mb_release_id = ? AND mb_release_track_id <> ''", releaseID).
+		Order("path").Find(&items).Error; err != nil {
+		logger.Log.Warnf("failed to list the files of release %s: %s", releaseID, err.Error())
+		return files
+	}
+	prefix := filepath.Clean(rootDir) + string(filepath.Separator)
+	for _, item := range items {
+		if !strings.HasPrefix(item.Path, prefix) {
+			continue // the same release in another library
+		}
+		if _, taken := files[item.MBReleaseTrackID]; !taken {
+			files[item.MBReleaseTrackID] = item.Path
+		}
+	}
+	return files
+}
+
+// unmeasurableFormats remembers the extensions already reported as having no
+// decoder, so a library of MP3s says so once rather than once per file.
+var unmeasurableFormats sync.Map
+
+// MeasureReplayGain fills a FileTags' TrackGain and AlbumGain when the profile writes
+// ReplayGain. analyze false answers from cached measurements only, which is what the
+// diff view wants: it must not decode a page of files to render.
+//
+// It never fails the file. A track that cannot be measured keeps whatever gain tags
+// it has; so does every track of an album one of whose files cannot be, since an album
+// gain measured without a track is a different album's.
+func MeasureReplayGain(
+	metadata *models.FileTags,
+	filePath, rootDir string,
+	track models.Track,
+	response models.MusicBrainzReleaseResponse,
+	tagger models.TaggerSettings,
+	analyze bool,
+) {
+	if !tagger.ReplayGain {
+		return
+	}
+	own, err := measureLoudness(filePath, analyze)
+	if err != nil {
+		reportUnmeasured(filePath, err)
+		return
+	}
+	if loudness, ok := own.loudness(); ok {
+		metadata.TrackGain = &loudness
+	}
+
+	files := releaseFiles(rootDir, response.ID)
+	files[track.ID] = filePath
+	album := loudnessMeasurement{histogram: loudnessHistogram{}}
+	var siblings []string
+	for _, releaseTrack := range ReleaseTracks(response) {
+		if releaseTrack.Video {
+			continue // a bonus DVD is not part of how loud the album is
+		}
+		path, ok := files[releaseTrack.TrackID]
+		if !ok {
+			logger.Log.Debugf("album gain for release %s waits for track %s to be in the library", response.ID, releaseTrack.TrackID)
+			return
+		}
+		siblings = append(siblings, path)
+	}
+	for _, path := range siblings {
+		measurement := own
+		if path != filePath {
+			if measurement, err = measureLoudness(path, analyze); err != nil {
+				reportUnmeasured(path, err)
+				return
+			}
+		}
+		album.histogram.merge(measurement.histogram)
+		album.peak = math.Max(album.peak, measurement.peak)
+	}
+	if loudness, ok := album.loudness(); ok {
+		metadata.AlbumGain = &loudness
+	}
+}
+
+func reportUnmeasured(path string, err error) {
+	switch {
+	case errors.Is(err, ErrNoDecoder):
+		ext := strings.ToLower(filepath.Ext(path))
+		if _, seen := unmeasurableFormats.LoadOrStore(ext, true); !seen {
+			logger.Log.Infof("ReplayGain: %s files cannot be decoded in-process yet; their gain tags are left as they are", ext)
+		}
+	case errors.Is(err, errNotMeasured):
+	default:
+		logger.Log.Warn(err.Error())
+	}
+}
+
+// formatGain renders a ReplayGain gain the way every other analyser writes it.
+func formatGain(loudness models.Loudness) string {
+	return fmt.Sprintf("%.2f dB", replayGainReference-loudness.Integrated)
+}
+
+func formatPeak(loudness models.Loudness) string {
+	return fmt.Sprintf("%.6f", loudness.Peak)
+}
+
+// formatR128Gain renders an Opus R128 gain: a Q7.8 fixed-point integer of dB, clamped
+// to what the 16 bits hold.
+func formatR128Gain(loudness models.Loudness) string {
+	q78 := math.Round((r128Reference - loudness.Integrated) * 256)
+	return fmt.Sprintf("%d", int(math.Max(math.MinInt16, math.Min(math.MaxInt16, q78))))
+}
+
+// replayGainKeys are the tags ReplayGain 2.0 is written under on every engine except
+// Opus.
+var replayGainKeys = []string{"REPLAYGAIN_TRACK_GAIN", "REPLAYGAIN_TRACK_PEAK", "REPLAYGAIN_ALBUM_GAIN", "REPLAYGAIN_ALBUM_PEAK"}
+
+// withLoudnessTags adds the measured gains to an engine's desired map. A gain that
+// was not measured is not in the map, so the file's own value stands.
+func withLoudnessTags(desired map[string][]string, metadata models.FileTags) map[string][]string {
+	if metadata.TrackGain != nil {
+		desired["REPLAYGAIN_TRACK_GAIN"] = single(formatGain(*metadata.TrackGain))
+		desired["REPLAYGAIN_TRACK_PEAK"] = single(formatPeak(*metadata.TrackGain))
+	}
+	if metadata.AlbumGain != nil {
+		desired["REPLAYGAIN_ALBUM_GAIN"] = single(formatGain(*metadata.AlbumGain))
+		desired["REPLAYGAIN_ALBUM_PEAK"] = single(formatPeak(*metadata.AlbumGain))
+	}
+	return desired
+}
+
+// asR128Tags turns the ReplayGain half of a desired map into Opus's R128 gains. RFC
+// 7845 has a player apply R128_*, relative to -23 LUFS, and ignore REPLAYGAIN_*, so an
+// Opus file carries the one and not the other. There is no R128 peak: Opus decodes to
+// floating point, where a peak above full scale is not clipping.
+func asR128Tags(desired map[string][]string, metadata models.FileTags) map[string][]string {
+	for _, key := range replayGainKeys {
+		delete(desired, key)
+	}
+	if metadata.TrackGain != nil {
+		desired["R128_TRACK_GAIN"] = single(formatR128Gain(*metadata.TrackGain))
+	}
+	if metadata.AlbumGain != nil {
+		desired["R128_ALBUM_GAIN"] = single(formatR128Gain(*metadata.AlbumGain))
+	}
+	return desired
+}
@@ -0,0 +1,340 @@
+package modules
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/braheezy/shine-mp3/pkg/mp3"
+	"github.com/google/uuid"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// tone is a stretch of 1 kHz sine on both channels, at a level in dBFS.
+type tone struct {
+	dbfs    float64
+	seconds float64
+}
+
+// toneFLAC encodes a real 16-bit stereo FLAC of the given tones, with room left for
+// the tag writers to work in place.
+func toneFLAC(t *testing.T, path string, rate int, tones ...tone) string {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &meta.StreamInfo{BlockSizeMin: 4096, BlockSizeMax: 4096, SampleRate: uint32(rate), NChannels: 2, BitsPerSample: 16}
+	padding := &meta.Block{Header: meta.Header{Type: meta.TypePadding, Length: flacRewritePadding}}
+	enc, err := flac.NewEncoder(file, info, padding)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var samples []int32
+	for _, part := range tones {
+		amplitude := math.Pow(10, part.dbfs/20) * math.MaxInt16
+		for i := 0; i < int(part.seconds*float64(rate)); i++ {
+			samples = append(samples, int32(math.Round(amplitude*math.Sin(2*math.Pi*1000*float64(len(samples))/float64(rate)))))
+		}
+	}
+	for start := 0; start < len(samples); start += 4096 {
+		block := samples[start:min(start+4096, len(samples))]
+		subframe := func() *frame.Subframe {
+			return &frame.Subframe{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: append([]int32(nil), block...), NSamples: len(block)}
+		}
+		if err := enc.WriteFrame(&frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true, BlockSize: uint16(len(block)), SampleRate: uint32(rate),
+				Channels: frame.ChannelsLR, BitsPerSample: 16,
+			},
+			Subframes: []*frame.Subframe{subframe(), subframe()},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// toneMP3 encodes a real 128 kbps MP3 of the given tones, stereo or mono, with the
+// pure-Go shine encoder.
+func toneMP3(t *testing.T, path string, rate, channels int, tones ...tone) string {
+	t.Helper()
+	var samples []int16
+	n := 0
+	for _, part := range tones {
+		amplitude := math.Pow(10, part.dbfs/20) * math.MaxInt16
+		for i := 0; i < int(part.seconds*float64(rate)); i++ {
+			sample := int16(math.Round(amplitude * math.Sin(2*math.Pi*1000*float64(n)/float64(rate))))
+			for range channels {
+				samples = append(samples, sample)
+			}
+			n++
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := mp3.NewEncoder(rate, channels).Write(file, samples); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func measured(t *testing.T, path string) models.Loudness {
+	t.Helper()
+	measurement, err := loudnessDecoders[filepath.Ext(path)](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loudness, ok := measurement.loudness()
+	if !ok {
+		t.Fatal("no loudness measured")
+	}
+	return loudness
+}
+
+// The calibration EBU Tech 3341 opens with: a stereo 1 kHz sine at -23 dBFS reads
+// -23 LUFS, at any sample rate.
+func TestLoudnessMeterIsCalibrated(t *testing.T) {
+	for _, rate := range []int{44100, 48000, 96000} {
+		path := toneFLAC(t, filepath.Join(t.TempDir(), "tone.flac"), rate, tone{-23, 5})
+		loudness := measured(t, path)
+		if math.Abs(loudness.Integrated+23) > 0.1 {
+			t.Errorf("%d Hz: %.2f LUFS, want -23", rate, loudness.Integrated)
+		}
+		if want := math.Pow(10, -23.0/20); math.Abs(loudness.Peak-want) > 0.001 {
+			t.Errorf("%d Hz: peak %.4f, want %.4f", rate, loudness.Peak, want)
+		}
+	}
+}
+
+// A quiet passage more than 10 LU under the rest is a pause, not part of how loud the
+// track is — and true silence is not a loudness at all.
+func TestLoudnessMeterGates(t *testing.T) {
+	dir := t.TempDir()
+	loudness := measured(t, toneFLAC(t, filepath.Join(dir, "pause.flac"), 48000, tone{-20, 5}, tone{-45, 5}))
+	// The 400 ms blocks straddling the drop still count, hence the wider tolerance.
+	if math.Abs(loudness.Integrated+20) > 0.2 {
+		t.Errorf("%.2f LUFS; the quiet half should be gated out", loudness.Integrated)
+	}
+
+	silent, err := measureFLAC(toneFLAC(t, filepath.Join(dir, "silent.flac"), 48000, tone{math.Inf(-1), 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := silent.loudness(); ok {
+		t.Error("a silent file measured a loudness")
+	}
+}
+
+// twoTrackRelease is an album of two tracks, each indexed under rootDir only when its
+// path is given.
+func twoTrackRelease(t *testing.T, rootDir string, paths ...string) models.MusicBrainzReleaseResponse {
+	t.Helper()
+	release := models.MusicBrainzReleaseResponse{ID: "rel-gain", Media: []models.MusicBrainzMedia{{
+		Position: 1, Tracks: []models.Track{{ID: "t1", Position: 1}, {ID: "t2", Position: 2}},
+	}}}
+	for i, path := range paths {
+		item := models.LibraryItem{
+			LibraryID: uuid.New(), Path: path,
+			MBReleaseID: release.ID, MBReleaseTrackID: "t" + strconv.Itoa(i+1),
+		}
+		if err := cacheDB.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return release
+}
+
+func assertGain(t *testing.T, got *models.Loudness, want float64) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("not measured, want %.2f LUFS", want)
+	}
+	if math.Abs(got.Integrated-want) > 0.1 {
+		t.Errorf("%.2f LUFS, want %.2f", got.Integrated, want)
+	}
+}
+
+func TestReplayGainMeasuresTheTrackAndTheWholeAlbum(t *testing.T) {
+	dbForCache(t)
+	root := t.TempDir()
+	loud := toneFLAC(t, filepath.Join(root, "01.flac"), 48000, tone{-14, 4})
+	quiet := toneFLAC(t, filepath.Join(root, "02.flac"), 48000, tone{-24, 4})
+	tagger := models.TaggerSettings{ReplayGain: true}
+
+	// Only the first track is in the index: the album gain is not known yet, so it
+	// is not in the desired tags to be written — or cleared.
+	release := twoTrackRelease(t, root, loud)
+	var metadata models.FileTags
+	MeasureReplayGain(&metadata, loud, root, release.Media[0].Tracks[0], release, tagger, true)
+	if metadata.TrackGain == nil || metadata.AlbumGain != nil {
+		t.Fatalf("track %v, album %v; want a track gain and no album gain", metadata.TrackGain, metadata.AlbumGain)
+	}
+	assertGain(t, metadata.TrackGain, -14)
+	desired := buildFLACDesiredTags(metadata)
+	if _, ok := desired["REPLAYGAIN_TRACK_GAIN"]; !ok {
+		t.Error("the track gain is not in the desired tags")
+	}
+	if _, ok := desired["REPLAYGAIN_ALBUM_GAIN"]; ok {
+		t.Error("an album gain was written before the album was all here")
+	}
+
+	// With both, the album is gated as one programme — the energy mean of two equally
+	// long tracks, not the mean of their LUFS — and peaks where its loudest track does.
+	if err := cacheDB.Create(&models.LibraryItem{LibraryID: uuid.New(), Path: quiet, MBReleaseID: release.ID, MBReleaseTrackID: "t2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	metadata = models.FileTags{}
+	MeasureReplayGain(&metadata, quiet, root, release.Media[0].Tracks[1], release, tagger, true)
+	if metadata.AlbumGain == nil {
+		t.Fatal("no album gain with every track indexed")
+	}
+	assertGain(t, metadata.TrackGain, -24)
+	assertGain(t, metadata.AlbumGain, 10*math.Log10((math.Pow(10, -1.4)+math.Pow(10, -2.4))/2))
+	if want := math.Pow(10, -14.0/20); math.Abs(metadata.AlbumGain.Peak-want) > 0.001 {
+		t.Errorf("album peak %.4f, want the loud track's %.4f", metadata.AlbumGain.Peak, want)
+	}
+}
+
+// The cache is what makes the second pass free: a file is decoded once, and a tag
+// write of our own does not count as the file changing.
+func TestReplayGainIsMeasuredOncePerFile(t *testing.T) {
+	dbForCache(t)
+	root := t.TempDir()
+	path := toneFLAC(t, filepath.Join(root, "01.flac"), 48000, tone{-20, 3})
+	release := twoTrackRelease(t, root, path)
+	release.Media[0].Tracks = release.Media[0].Tracks[:1]
+	release.Title, release.ArtistCredit = "Tones", []models.ArtistCredit{{Name: "Oscillator"}}
+
+	decodes := 0
+	loudnessDecoders[".flac"] = func(path string) (loudnessMeasurement, error) {
+		decodes++
+		return measureFLAC(path)
+	}
+	t.Cleanup(func() { loudnessDecoders[".flac"] = measureFLAC })
+
+	tagger := models.TaggerSettings{ReplayGain: true}
+	track := release.Media[0].Tracks[0]
+	for pass := 1; pass <= 2; pass++ {
+		unchanged, _, _, err := ProcessTrackFileAfterMatch(path, nil, nil, nil, root, tagger, track, release.Media[0], release)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unchanged != (pass == 2) {
+			t.Errorf("pass %d: unchanged = %v", pass, unchanged)
+		}
+	}
+	if decodes != 1 {
+		t.Errorf("decoded %d times; the tag write should not have invalidated the measurement", decodes)
+	}
+	tags, err := getFlacTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"REPLAYGAIN_TRACK_GAIN", "REPLAYGAIN_ALBUM_GAIN"} {
+		var gain float64
+		if len(tags[key]) != 1 {
+			t.Fatalf("%s = %q", key, tags[key])
+		}
+		if _, err := fmt.Sscanf(tags[key][0], "%f dB", &gain); err != nil || math.Abs(gain-2) > 0.1 {
+			t.Errorf("%s = %q, want about 2 dB over the -18 LUFS reference", key, tags[key][0])
+		}
+	}
+
+	// The diff view reads measurements and never decodes.
+	touched := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	var preview models.FileTags
+	MeasureReplayGain(&preview, path, root, track, release, tagger, false)
+	if preview.TrackGain != nil || decodes != 1 {
+		t.Errorf("a cache-only lookup of a changed file measured it (decodes %d)", decodes)
+	}
+}
+
+// MP3 decodes in-process too. go-mp3 hands back a mono stream as two identical
+// channels, and metering both would read 3 dB loud: the same sine on one channel is
+// half the energy of the stereo calibration tone.
+//
+// A lossy encoder does not promise to keep the level it is given to a tenth of a dB
+// (shine's output decodes about 1 dB loud, in go-mp3 and minimp3 alike), so the level
+// itself is held to mp3Tolerance. What the decoder path has to get exactly right is
+// checked relative to another file from the same encoder, where its gain cancels: a
+// tone 10 dB quieter reads 10 LU quieter, and the mono file 3 LU under the stereo one.
+func TestLoudnessMeterDecodesMP3(t *testing.T) {
+	const mp3Tolerance = 1.5
+	dir := t.TempDir()
+	stereo := measured(t, toneMP3(t, filepath.Join(dir, "stereo.mp3"), 44100, 2, tone{-23, 5}))
+	if math.Abs(stereo.Integrated+23) > mp3Tolerance {
+		t.Errorf("stereo: %.2f LUFS, want -23 ± %.1f", stereo.Integrated, mp3Tolerance)
+	}
+	quieter := measured(t, toneMP3(t, filepath.Join(dir, "quieter.mp3"), 44100, 2, tone{-33, 5}))
+	if step := stereo.Integrated - quieter.Integrated; math.Abs(step-10) > 0.1 {
+		t.Errorf("10 dB quieter reads %.2f LU quieter", step)
+	}
+	if ratio := stereo.Peak / quieter.Peak; math.Abs(ratio-math.Pow(10, 0.5))/math.Pow(10, 0.5) > 0.05 {
+		t.Errorf("peak ratio %.3f over 10 dB, want about %.3f", ratio, math.Pow(10, 0.5))
+	}
+	mono := measured(t, toneMP3(t, filepath.Join(dir, "mono.mp3"), 44100, 1, tone{-23, 5}))
+	if step := stereo.Integrated - mono.Integrated; math.Abs(step-3.01) > 0.1 {
+		t.Errorf("mono reads %.2f LU under stereo, want 3.01", step)
+	}
+}
+
+// Ogg decodes in-process as well, Vorbis and Opus both. The Vorbis file is the one
+// jfreymuth/oggvorbis tests against; its reference PCM, which ships beside it there,
+// measures -10.88 LUFS through this meter. The Opus file is a 1 kHz stereo sine at
+// -17 dBFS with an output gain of -6 dB in its header, which a player applies: -23
+// LUFS as it plays (see testdata/README.md).
+func TestLoudnessMeterDecodesOgg(t *testing.T) {
+	vorbis := measured(t, filepath.Join("testdata", "vorbis.ogg"))
+	if math.Abs(vorbis.Integrated+10.88) > 0.05 {
+		t.Errorf("Vorbis: %.2f LUFS, want -10.88", vorbis.Integrated)
+	}
+	opus := measured(t, filepath.Join("testdata", "tone.opus"))
+	if math.Abs(opus.Integrated+23) > 0.1 {
+		t.Errorf("Opus: %.2f LUFS, want -23 with the output gain applied", opus.Integrated)
+	}
+}
+
+// Opus players apply R128_* and ignore REPLAYGAIN_* (RFC 7845), so Opus gets the one
+// and not the other; Vorbis keeps ReplayGain's keys.
+func TestReplayGainOnOpusIsR128(t *testing.T) {
+	metadata := models.FileTags{TrackGain: &models.Loudness{Integrated: -16, Peak: 0.9}, AlbumGain: &models.Loudness{Integrated: -30.5}}
+	opus := buildOggDesiredTags(metadata, oggOpus)
+	assertTag(t, opus, "R128_TRACK_GAIN", "-1792") // -7 dB in Q7.8
+	assertTag(t, opus, "R128_ALBUM_GAIN", "1920")  // +7.5 dB
+	if _, ok := opus["REPLAYGAIN_TRACK_GAIN"]; ok {
+		t.Error("Opus carries REPLAYGAIN_TRACK_GAIN")
+	}
+	assertTag(t, buildOggDesiredTags(metadata, oggVorbis), "REPLAYGAIN_TRACK_GAIN", "-2.00 dB")
+}
+
+// A format with no decoder is not measured, and an unmeasured file keeps the gain
+// tags it has: the keys are not in the desired map at all.
+func TestUndecodableFormatsAreLeftAlone(t *testing.T) {
+	path := synthMP4(t, nil, false)
+	var m4a models.FileTags
+	MeasureReplayGain(&m4a, path, filepath.Dir(path), models.Track{ID: "t1"}, models.MusicBrainzReleaseResponse{ID: "r"}, models.TaggerSettings{ReplayGain: true}, true)
+	if m4a.TrackGain != nil {
+		t.Error("an M4A was measured with no decoder for it")
+	}
+	if _, ok := buildMP4DesiredTags(m4a)["REPLAYGAIN_TRACK_GAIN"]; ok {
+		t.Error("an unmeasured M4A would have its gain cleared")
+	}
+}
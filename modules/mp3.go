@@ -3,6 +3,7 @@ package modules
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"strings"
 
@@ -43,6 +44,12 @@ func renderMP3Values(values []string, multiValue bool) []string {
 func renderMP3Tags(desired map[string][]string, tagger models.TaggerSettings) map[string][]string {
 	rendered := make(map[string][]string, len(desired))
 	for key, values := range desired {
+		if isCreditKey(key) {
+			// A credit frame is a list of pairs whatever the setting: joining the
+			// names would pair one role with all of them.
+			rendered[key] = utilities.NormalizeTagValues(values)
+			continue
+		}
 		rendered[key] = renderMP3Values(values, tagger.MP3MultiValueTags)
 	}
 	return rendered
@@ -58,18 +65,22 @@ func encodeID3FrameValue(values []string) string {
 // pure (no I/O) so the field-to-tag wiring can be unit-tested. Values are carried as
 // the several values they are; renderMP3Values decides how they reach the file.
 func buildMP3DesiredTags(metadata models.FileTags) map[string][]string {
-	return map[string][]string{
+	desired := map[string][]string{
 		"ARTIST":      single(metadata.Artist),
 		"ARTISTS":     metadata.Artists,
 		"ALBUMARTIST": single(metadata.AlbumArtist),
 		// Single-valued for Plex, which renders a joined string as one artist named
 		// "A; B"; ALBUMARTISTS carries the full credit alongside it.
 		"ALBUMARTISTS": metadata.AlbumArtists,
-		"GENRE":        metadata.Genres,
-		"ALBUM":        single(metadata.Album),
-		"TITLE":        single(metadata.Title),
-		"TRACKNUMBER":  single(metadata.Track),
-		"DISCNUMBER":   single(metadata.DiscNumber),
+		// TSOP, TSO2 and TSOA (see id3TextFrameForKey).
+		"ARTISTSORT":      single(metadata.ArtistSort),
+		"ALBUMARTISTSORT": single(metadata.AlbumArtistSort),
+		"ALBUMSORT":       single(metadata.AlbumSort),
+		"GENRE":           metadata.Genres,
+		"ALBUM":           single(metadata.Album),
+		"TITLE":           single(metadata.Title),
+		"TRACKNUMBER":     single(metadata.Track),
+		"DISCNUMBER":      single(metadata.DiscNumber),
 
 		// Totals ride along in the composite TRCK/TPOS frames ("3/12", "1/2")
 		// written below — the standard ID3 representation, which GetMP3Tags splits
@@ -121,6 +132,15 @@ func buildMP3DesiredTags(metadata models.FileTags) map[string][]string {
 		// under its own key for the reason ufidTagKey explains.
 		ufidTagKey: single(metadata.MBRecordingID),
 	}
+	// COMPOSER and LYRICIST go to TCOM and TEXT (see id3TextFrameForKey); WRITER,
+	// WORK and the work MBID have no standard frame and land in TXXX frames under
+	// Picard's descriptions.
+	desired = withWorkTags(desired, metadata, [5]string{"COMPOSER", "LYRICIST", "WRITER", "WORK", "MusicBrainz Work Id"})
+	// The recording credits are pairs in TMCL and TIPL rather than frames of their
+	// own; see id3CreditFrames.
+	desired = withCreditTags(desired, metadata)
+	// The native spellings are TXXX frames under the same keys.
+	return withLoudnessTags(withNativeTags(desired, metadata), metadata)
 }
 
 // pairedFrameValue renders the "n/total" halves of a paired ID3 frame (track, disc).
@@ -157,17 +177,26 @@ func splitPairedFrameValue(value string) (number, total string) {
 var id3TextFrameForKey = map[string]string{
 	"ARTIST":      "TPE1",
 	"ALBUMARTIST": "TPE2",
-	"ALBUM":       "TALB",
-	"TITLE":       "TIT2",
-	"GENRE":       "TCON",
-	"DATE":        "TDRC",
-	"TDOR":        "TDOR",
-	"TMED":        "TMED",
-	"PUBLISHER":   "TPUB",
+	// TSO2 is not in the ID3v2.4 standard but is iTunes' album artist sort frame,
+	// and the one Picard, Navidrome and foobar2000 read.
+	"ARTISTSORT":      "TSOP",
+	"ALBUMARTISTSORT": "TSO2",
+	"ALBUMSORT":       "TSOA",
+	"ALBUM":           "TALB",
+	"TITLE":           "TIT2",
+	"GENRE":           "TCON",
+	"DATE":            "TDRC",
+	"TDOR":            "TDOR",
+	"TMED":            "TMED",
+	"PUBLISHER":       "TPUB",
 	// TSRC is the standard frame for the ISRC. It replaced the TXXX artefact
 	// described by legacyISRCFrameDescription; being in this map gives it the read
 	// direction for free, through id3KeyForTextFrame.
 	"ISRC": "TSRC",
+	// The standard frames for a work's credits. Writer has none: ID3 has no frame for
+	// "composer and/or lyricist", so it is a TXXX frame like Picard's.
+	"COMPOSER": "TCOM",
+	"LYRICIST": "TEXT",
 }
 
 // id3PairedFrames are the two frames that carry a number and a total in one value.
@@ -177,6 +206,116 @@ var id3PairedFrames = map[string][2]string{
 	"TPOS": {"DISCNUMBER", "DISCTOTAL"},
 }
 
+// The ID3v2.4 credit frames. Each is a list of role/name pairs in one text frame,
+// null-separated like any multi-value frame: TMCL names musicians by instrument, TIPL
+// everyone else involved by what they did. Several of our keys can share one, so a
+// change to any of them rewrites the frame whole — the way the paired frames work.
+const (
+	id3MusicianCreditsFrame = "TMCL"
+	id3InvolvedPeopleFrame  = "TIPL"
+)
+
+// isCreditKey reports whether a key is written into one of the credit frames.
+func isCreditKey(key string) bool {
+	key = strings.ToUpper(key)
+	if key == performerTagKey {
+		return true
+	}
+	_, ok := involvedFamilyForKey(key)
+	return ok
+}
+
+func involvedFamilyForKey(upperKey string) (creditFamily, bool) {
+	for _, family := range involvedFamilies {
+		if family.key == upperKey {
+			return family, true
+		}
+	}
+	return creditFamily{}, false
+}
+
+// involvedFamilyForRole finds the family a TIPL role belongs to. Roles are matched in
+// any case; one that is none of ours (a DJ-mix, say) belongs to whoever wrote it.
+func involvedFamilyForRole(role string) (creditFamily, bool) {
+	for _, family := range involvedFamilies {
+		if strings.EqualFold(strings.TrimSpace(role), family.tiplRole) {
+			return family, true
+		}
+	}
+	return creditFamily{}, false
+}
+
+// decodeCreditPairs splits a credit frame's payload into role/name pairs. An odd
+// entry out at the end is a role with nobody in it, and is dropped.
+func decodeCreditPairs(text string) [][2]string {
+	if text == "" {
+		return nil
+	}
+	parts := strings.Split(text, id3MultiValueSeparator)
+	pairs := make([][2]string, 0, len(parts)/2)
+	for i := 0; i+1 < len(parts); i += 2 {
+		pairs = append(pairs, [2]string{parts[i], parts[i+1]})
+	}
+	return pairs
+}
+
+// encodeCreditPairs is the write direction of decodeCreditPairs. No pairs encode to
+// "", which deletes the frame.
+func encodeCreditPairs(pairs [][2]string) string {
+	parts := make([]string, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, pair[0], pair[1])
+	}
+	return strings.Join(parts, id3MultiValueSeparator)
+}
+
+// musicianCreditPairs renders performer credits as TMCL pairs. They are built from the
+// credits themselves rather than from the "Name (role)" values the diff compares, so
+// a name that happens to end in parentheses is not split into a role.
+func musicianCreditPairs(credits []models.PerformerCredit) [][2]string {
+	pairs := make([][2]string, 0, len(credits))
+	seen := make(map[string]bool, len(credits))
+	for _, credit := range credits {
+		value := performerValue(credit.Name, credit.Role)
+		if credit.Name == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		pairs = append(pairs, [2]string{credit.Role, credit.Name})
+	}
+	return pairs
+}
+
+// involvedPeoplePairs rebuilds the TIPL frame for a write, reporting how many of our
+// keys changed in it. Each family of ours takes its value from the change set when it
+// changed and from the file when it did not, so a family the diff skipped is carried
+// across rather than dropped; roles that are not ours are kept exactly as they were.
+func involvedPeoplePairs(current string, changes, existing map[string][]string) (pairs [][2]string, written int) {
+	for _, family := range involvedFamilies {
+		if _, ok := changes[family.key]; ok {
+			written++
+		}
+	}
+	if written == 0 {
+		return nil, 0
+	}
+	for _, pair := range decodeCreditPairs(current) {
+		if _, ours := involvedFamilyForRole(pair[0]); !ours {
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, family := range involvedFamilies {
+		names, changed := changes[family.key]
+		if !changed {
+			names = existing[family.key]
+		}
+		for _, name := range names {
+			pairs = append(pairs, [2]string{family.tiplRole, name})
+		}
+	}
+	return pairs, written
+}
+
 // id3KeyForTextFrame is the read direction of id3TextFrameForKey, derived from it so
 // the two cannot drift apart.
 var id3KeyForTextFrame = func() map[string]string {
@@ -248,9 +387,31 @@ func SetMP3Tags(filePath string, metadata models.FileTags, tagger models.TaggerS
 	if err != nil {
 		return false, 0, nil, fmt.Errorf("read mp3 tags failed: %w", err)
 	}
+	if metadata.Restore != nil {
+		// Performers are written from metadata.Performers, which a rollback does not
+		// carry; see RestorableField.
+		restore := maps.Clone(metadata.Restore)
+		delete(restore, performerTagKey)
+		desired, tagger = restoreDesired(existing, desired, restore), restoreTagger(tagger)
+	}
+	// The writer reads values from desired, not from the change set, so the policies
+	// the diff honours are applied here first (see utilities.ApplyTagPolicies).
+	desired = utilities.ApplyTagPolicies(existing, desired, tagger)
 
 	changes, hasChanges := utilities.DiffID3Tags(existing, desired, tagger)
-	if !hasChanges {
+
+	// The cover is read only when there is one to compare against: the picture is
+	// the largest thing in most tags, and a profile that does not embed has no
+	// question to ask of it.
+	var existingCover *models.CoverArt
+	if metadata.FrontCover != nil {
+		if existingCover, err = mp3FrontCover(filePath); err != nil {
+			return false, 0, nil, fmt.Errorf("read mp3 cover failed: %w", err)
+		}
+	}
+	replaceCover := coverChanged(existingCover, metadata.FrontCover)
+
+	if !hasChanges && !replaceCover {
 		logger.Log.Debug("no tag changes, returning")
 		return true, 0, nil, nil
 	}
@@ -327,8 +488,26 @@ func SetMP3Tags(filePath string, metadata models.FileTags, tagger models.TaggerS
 		}
 	}
 
+	// Then the credit frames, each rewritten whole for the same reason.
+	if want, ok := changes[performerTagKey]; ok {
+		logger.Log.Trace("adding " + id3MusicianCreditsFrame)
+		// Built from the structured credits, which a policy that removes the tag has
+		// not touched: no values wanted is the frame cleared.
+		frame := ""
+		if len(want) > 0 {
+			frame = encodeCreditPairs(musicianCreditPairs(metadata.Performers))
+		}
+		writeText(id3MusicianCreditsFrame, frame)
+		tagsWritten++
+	}
+	if pairs, written := involvedPeoplePairs(tag.GetTextFrame(id3InvolvedPeopleFrame).Text, changes, existing); written > 0 {
+		logger.Log.Trace("adding " + id3InvolvedPeopleFrame)
+		writeText(id3InvolvedPeopleFrame, encodeCreditPairs(pairs))
+		tagsWritten += written
+	}
+
 	for upperKey := range changes {
-		if isPairedHalf(upperKey) {
+		if isPairedHalf(upperKey) || isCreditKey(upperKey) {
 			continue // written above
 		}
 		logger.Log.Trace("adding " + upperKey)
@@ -346,6 +525,11 @@ func SetMP3Tags(filePath string, metadata models.FileTags, tagger models.TaggerS
 		tagsWritten++
 	}
 
+	if replaceCover {
+		replaceMP3FrontCover(tag, metadata.FrontCover)
+		tagsWritten++
+	}
+
 	// Every write is also the chance to retire the legacy ISRC frame, whether or not
 	// the ISRC itself changed — a file whose ISRC is already correct would otherwise
 	// keep the artefact forever, since nothing would ever mark it as drift.
@@ -383,17 +567,22 @@ func SetMP3Tags(filePath string, metadata models.FileTags, tagger models.TaggerS
 	// tag is saved in one pass, so there is no per-field success to report, and
 	// `changes` is already exactly the set of fields that differed. tagsWritten can
 	// exceed this count — a changed DISCNUMBER also rewrites its paired DISCTOTAL.
-	changed = make([]models.TagChange, 0, len(changes))
+	changed = make([]models.TagChange, 0, len(changes)+1)
 	for key, values := range changes {
 		// Described rather than joined, for the same reason as FLAC: with
 		// mp3_multi_value_tags on, the change from a "; "-joined frame to a
 		// null-separated one is invisible once both sides are joined back together.
 		changed = append(changed, models.TagChange{
-			Field: key,
-			Old:   utilities.DescribeTagValues(existing[key]),
-			New:   utilities.DescribeTagValues(values),
+			Field:  key,
+			Old:    utilities.DescribeTagValues(existing[key]),
+			New:    utilities.DescribeTagValues(values),
+			Before: existing[key],
+			After:  values,
 		})
 	}
+	if replaceCover {
+		changed = append(changed, coverTagChange(existingCover, metadata.FrontCover))
+	}
 	utilities.SortTagChanges(changed)
 
 	return false, tagsWritten, changed, nil
@@ -548,6 +737,50 @@ func deleteMusicBrainzUFIDFrame(tag *id3v2.Tag) {
 	}
 }
 
+// mp3FrontCover reads the file's front cover APIC frame, or returns nil when it has
+// none. Only APIC is parsed; the text frames are GetMP3Tags' business.
+func mp3FrontCover(filePath string) (*models.CoverArt, error) {
+	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true, ParseFrames: []string{"Attached picture"}})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+	for _, frame := range tag.GetFrames("APIC") {
+		if picture, ok := frame.(id3v2.PictureFrame); ok && picture.PictureType == id3v2.PTFrontCover {
+			return newCoverArt(picture.Picture, picture.MimeType), nil
+		}
+	}
+	return nil, nil
+}
+
+// replaceMP3FrontCover swaps every front cover APIC frame for cover and puts the
+// other pictures back, the way deleteMusicBrainzUFIDFrame treats UFID: a back cover
+// or an artist photo another tool embedded is not ours to drop.
+//
+// Ours goes in last. ID3 allows one APIC per description, and bogem/id3v2 enforces it
+// by keying pictures on the description alone, so a kept picture that also has an
+// empty description — which the spec never allowed beside ours — gives way to it
+// rather than replacing it.
+func replaceMP3FrontCover(tag *id3v2.Tag, cover *models.CoverArt) {
+	kept := make([]id3v2.Framer, 0)
+	for _, frame := range tag.GetFrames("APIC") {
+		if picture, ok := frame.(id3v2.PictureFrame); ok && picture.PictureType == id3v2.PTFrontCover {
+			continue
+		}
+		kept = append(kept, frame)
+	}
+	tag.DeleteFrames("APIC")
+	for _, frame := range kept {
+		tag.AddFrame("APIC", frame)
+	}
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		MimeType:    cover.MIMEType,
+		PictureType: id3v2.PTFrontCover,
+		Picture:     cover.Data,
+	})
+}
+
 // dropUnkeyedUserDefinedFrames removes TXXX frames that carry no description, and
 // reports how many it dropped.
 //
@@ -644,6 +877,20 @@ func GetMP3Tags(filePath string) (map[string][]string, error) {
 					add(halves[1], total)
 					continue
 				}
+				switch frameID {
+				case id3MusicianCreditsFrame:
+					for _, pair := range decodeCreditPairs(typed.Text) {
+						add(performerTagKey, performerValue(strings.TrimSpace(pair[1]), strings.TrimSpace(pair[0])))
+					}
+					continue
+				case id3InvolvedPeopleFrame:
+					for _, pair := range decodeCreditPairs(typed.Text) {
+						if family, ours := involvedFamilyForRole(pair[0]); ours {
+							add(family.key, pair[1])
+						}
+					}
+					continue
+				}
 				if key, known := id3KeyForTextFrame[frameID]; known {
 					add(key, typed.Text)
 				}
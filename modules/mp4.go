@@ -0,0 +1,733 @@
+package modules
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/utilities"
+)
+
+// MP4 (.m4a — AAC and ALAC alike) keeps its tags as iTunes "ilst" items inside
+// moov/udta/meta. The engine below reads and writes them in-process, with the atom
+// names Picard uses, so a file tagged here and a file tagged by Picard read the same
+// in every player that understands either.
+//
+// The hard part of MP4 is not the tags but the sample table: chunk offsets (stco /
+// co64) are absolute file positions, so growing the moov box moves the audio that
+// follows it and every offset has to move with it. That is done on every write where
+// the size changes, and it is why a fragmented file — whose offsets live in moof boxes
+// spread through the file — is refused rather than half-handled.
+
+// ErrMP4Unsupported means the file is an MP4 this engine will not rewrite: fragmented,
+// missing its moov box, or carrying more than one. Refused, like ErrOggUnsupported,
+// because a writer that guesses at a container's layout is how a file stops playing.
+var ErrMP4Unsupported = errors.New("unsupported MP4 layout")
+
+const (
+	// mp4FreeformMean is the namespace of the "----" items Picard and iTunes write.
+	// Items under any other mean belong to another application and are left alone.
+	mp4FreeformMean = "com.apple.iTunes"
+	mp4FreeformAtom = "----"
+
+	// mp4DataTypeImplicit and mp4DataTypeUTF8 are the well-known type codes of a data
+	// atom: binary (trkn, disk) and text (everything else written here).
+	mp4DataTypeImplicit = 0
+	mp4DataTypeUTF8     = 1
+)
+
+// mp4AtomForKey maps a desired-tag key, upper-cased as the diff returns it, onto the
+// standard iTunes atom that holds it. A key not listed here is written as a freeform
+// "----:com.apple.iTunes:<key>" item, in the desired map's own spelling — the same
+// split the MP3 engine makes between standard frames and TXXX.
+var mp4AtomForKey = map[string]string{
+	"TITLE":       "\xa9nam",
+	"ARTIST":      "\xa9ART",
+	"ALBUMARTIST": "aART",
+	// iTunes' sort atoms.
+	"ARTISTSORT":      "soar",
+	"ALBUMARTISTSORT": "soaa",
+	"ALBUMSORT":       "soal",
+	"ALBUM":           "\xa9alb",
+	"GENRE":           "\xa9gen",
+	"DATE":            "\xa9day",
+	"COMPOSER":        "\xa9wrt",
+	"WORK":            "\xa9wrk",
+}
+
+// mp4KeyForAtom is the read direction of mp4AtomForKey, derived so the two cannot
+// drift apart.
+var mp4KeyForAtom = func() map[string]string {
+	reverse := make(map[string]string, len(mp4AtomForKey))
+	for key, atom := range mp4AtomForKey {
+		reverse[atom] = key
+	}
+	return reverse
+}()
+
+// mp4PairedAtoms are the binary number/total pairs, which like ID3's TRCK and TPOS are
+// one atom holding two fields and are written together.
+var mp4PairedAtoms = map[string][2]string{
+	"trkn": {"TRACKNUMBER", "TRACKTOTAL"},
+	"disk": {"DISCNUMBER", "DISCTOTAL"},
+}
+
+// buildMP4DesiredTags maps resolved metadata onto the MP4 keys we write. Kept pure
+// (no I/O) like its FLAC and MP3 siblings. The freeform names are Picard's, which is
+// what makes this "Picard-compatible": Picard, Navidrome, beets and MusicBee look for
+// the MBIDs under exactly these spellings.
+func buildMP4DesiredTags(metadata models.FileTags) map[string][]string {
+	desired := map[string][]string{
+		"TITLE":  single(metadata.Title),
+		"ARTIST": single(metadata.Artist),
+		// Single-valued for Plex, as on both other engines; ALBUMARTISTS carries the
+		// whole credit.
+		"ALBUMARTIST":     single(metadata.AlbumArtist),
+		"ALBUM":           single(metadata.Album),
+		"GENRE":           metadata.Genres,
+		"TRACKNUMBER":     single(metadata.Track),
+		"TRACKTOTAL":      single(metadata.TrackTotal),
+		"DISCNUMBER":      single(metadata.DiscNumber),
+		"DISCTOTAL":       single(metadata.DiscTotal),
+		"ARTISTS":         metadata.Artists,
+		"ALBUMARTISTS":    metadata.AlbumArtists,
+		"ARTISTSORT":      single(metadata.ArtistSort),
+		"ALBUMARTISTSORT": single(metadata.AlbumArtistSort),
+		"ALBUMSORT":       single(metadata.AlbumSort),
+		// ©day holds the full release date. There is no separate year atom — players
+		// read the year off the front of ©day — so ReleaseYear has nowhere of its own
+		// to go, and inventing a freeform one would be read by nothing.
+		"DATE": single(metadata.ReleaseDate),
+		// Lower case for the reason the MP3 map gives "year": it is the spelling the
+		// other engines' readers already match on.
+		"originaldate":  single(metadata.OriginalDate),
+		"originalyear":  single(metadata.OriginalYear),
+		"ISRC":          metadata.ISRCs,
+		"SCRIPT":        single(metadata.Script),
+		"MEDIA":         single(metadata.Media),
+		"LABEL":         metadata.RecordLabels,
+		"BARCODE":       single(metadata.Barcode),
+		"CATALOGNUMBER": metadata.CatalogNumbers,
+
+		"MusicBrainz Album Status":          single(metadata.MBAlbumStatus),
+		"MusicBrainz Album Type":            single(metadata.MBAlbumType),
+		"MusicBrainz Album Release Country": single(metadata.MBAlbumReleaseCountry),
+		"MusicBrainz Album Id":              single(metadata.MBAlbumID),
+		"MusicBrainz Artist Id":             metadata.MBArtistIDs,
+		"MusicBrainz Album Artist Id":       metadata.MBAlbumArtistIDs,
+		"MusicBrainz Release Group Id":      single(metadata.MBReleaseGroupID),
+		"MusicBrainz Release Track Id":      single(metadata.MBReleaseTrackID),
+		// Picard's name for the *recording* MBID on MP4 is "MusicBrainz Track Id" — the
+		// same historical naming FLAC's MUSICBRAINZ_TRACKID carries. Writing it under
+		// any other name would leave every MP4-reading tool unable to find it.
+		"MusicBrainz Track Id": single(metadata.MBRecordingID),
+	}
+	// Composer and work have iTunes atoms (©wrt, ©wrk); lyricist, writer and the work
+	// MBID are freeform items under Picard's names.
+	desired = withWorkTags(desired, metadata, [5]string{"COMPOSER", "LYRICIST", "WRITER", "WORK", "MusicBrainz Work Id"})
+	return withLoudnessTags(withNativeTags(desired, metadata), metadata)
+}
+
+// renderMP4Tags decides how several values reach an MP4 item, and it is the MP3
+// decision, not a new one: ffmpeg never gained multi-value support for MP4 either, so
+// Plex sees only the first of several data atoms exactly as it sees only the first
+// value of a null-separated ID3 frame. The profile's mp3_multi_value_tags therefore
+// governs both — off writes one "; "-joined value, on writes one data atom per value,
+// which is what Picard writes and reads.
+func renderMP4Tags(desired map[string][]string, tagger models.TaggerSettings) map[string][]string {
+	rendered := make(map[string][]string, len(desired))
+	for key, values := range desired {
+		rendered[key] = renderMP3Values(values, tagger.MP3MultiValueTags)
+	}
+	return rendered
+}
+
+// mp4Box is one atom. A container's Payload is only what precedes its children (the
+// version and flags of a full box such as meta); a leaf's is its whole content.
+type mp4Box struct {
+	Type     string
+	Payload  []byte
+	Children []*mp4Box
+}
+
+// mp4Containers are the atoms descended into. Everything else is carried as an opaque
+// leaf and re-emitted byte for byte, which is what keeps the rewrite from touching the
+// parts of the file it does not understand.
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true,
+	"udta": true, "meta": true, "ilst": true,
+}
+
+// parseMP4Boxes parses a run of sibling atoms. parent decides what counts as a
+// container: every child of ilst is one (an item holding data, mean and name atoms).
+func parseMP4Boxes(data []byte, parent string) ([]*mp4Box, error) {
+	boxes := []*mp4Box{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			// QuickTime ends some udta atoms with a 32-bit zero terminator. It is not an
+			// atom, but it is part of the parent's size, so it is carried through.
+			if len(data) == 4 && binary.BigEndian.Uint32(data) == 0 {
+				boxes = append(boxes, &mp4Box{Payload: append([]byte(nil), data...)})
+				break
+			}
+			return nil, errors.New("truncated MP4 atom header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, errors.New("truncated MP4 atom header")
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, fmt.Errorf("MP4 atom %q runs past its parent", kind)
+		}
+
+		box := &mp4Box{Type: kind}
+		payload := data[header:size]
+		if mp4Containers[kind] || parent == "ilst" {
+			prefix := 0
+			// meta is a full box in iTunes files (4 bytes of version and flags before
+			// its children) and a plain one in QuickTime's; hdlr always comes first, so
+			// where it sits says which this is.
+			if kind == "meta" && !(len(payload) >= 8 && string(payload[4:8]) == "hdlr") {
+				prefix = 4
+			}
+			if prefix > len(payload) {
+				return nil, errors.New("truncated MP4 meta atom")
+			}
+			box.Payload = append([]byte(nil), payload[:prefix]...)
+			children, err := parseMP4Boxes(payload[prefix:], kind)
+			if err != nil {
+				return nil, err
+			}
+			box.Children = children
+		} else {
+			box.Payload = append([]byte(nil), payload...)
+		}
+		boxes = append(boxes, box)
+		data = data[size:]
+	}
+	return boxes, nil
+}
+
+// encode renders the atom and its children. A box with no type is a terminator
+// parseMP4Boxes carried through, and is its payload alone.
+func (b *mp4Box) encode() []byte {
+	if b.Type == "" {
+		return b.Payload
+	}
+	body := append([]byte(nil), b.Payload...)
+	for _, child := range b.Children {
+		body = append(body, child.encode()...)
+	}
+	size := uint64(len(body)) + 8
+	if size > 0xffffffff {
+		out := make([]byte, 16, size+8)
+		binary.BigEndian.PutUint32(out, 1)
+		copy(out[4:8], b.Type)
+		binary.BigEndian.PutUint64(out[8:16], size+8)
+		return append(out, body...)
+	}
+	out := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(out, uint32(size))
+	copy(out[4:8], b.Type)
+	return append(out, body...)
+}
+
+// child returns the first child atom of the given type, or nil.
+func (b *mp4Box) child(kind string) *mp4Box {
+	for _, c := range b.Children {
+		if c.Type == kind {
+			return c
+		}
+	}
+	return nil
+}
+
+// appendChild adds a child atom, ahead of a trailing terminator if the box has one.
+func (b *mp4Box) appendChild(c *mp4Box) {
+	n := len(b.Children)
+	if n > 0 && b.Children[n-1].Type == "" {
+		b.Children = append(b.Children[:n-1], c, b.Children[n-1])
+		return
+	}
+	b.Children = append(b.Children, c)
+}
+
+// mp4Layout locates the file's moov box among the top-level atoms.
+type mp4Layout struct {
+	moovOffset int64
+	moovSize   int64
+	moov       *mp4Box
+}
+
+// readMP4Moov finds and parses moov. Only the atom headers of the rest of the file are
+// read, so an hour of ALAC costs a handful of seeks, not a read of the audio.
+func readMP4Moov(file *os.File) (*mp4Layout, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	end := info.Size()
+
+	layout := &mp4Layout{moovOffset: -1}
+	header := make([]byte, 16)
+	for offset := int64(0); offset < end; {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return nil, errors.New("truncated MP4 atom header")
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, errors.New("truncated MP4 atom header")
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > end {
+			return nil, fmt.Errorf("MP4 atom %q runs past the end of the file", kind)
+		}
+
+		switch kind {
+		case "moof":
+			return nil, fmt.Errorf("%w: fragmented MP4", ErrMP4Unsupported)
+		case "moov":
+			if layout.moovOffset >= 0 {
+				return nil, fmt.Errorf("%w: more than one moov atom", ErrMP4Unsupported)
+			}
+			layout.moovOffset, layout.moovSize = offset, size
+		}
+		offset += size
+	}
+	if layout.moovOffset < 0 {
+		return nil, fmt.Errorf("%w: no moov atom", ErrMP4Unsupported)
+	}
+
+	raw := make([]byte, layout.moovSize)
+	if _, err := file.ReadAt(raw, layout.moovOffset); err != nil {
+		return nil, err
+	}
+	boxes, err := parseMP4Boxes(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	layout.moov = boxes[0]
+	if layout.moov.child("mvex") != nil {
+		return nil, fmt.Errorf("%w: fragmented MP4", ErrMP4Unsupported)
+	}
+	return layout, nil
+}
+
+// ilst returns the moov's item list, or nil when the file has no tags yet.
+func (l *mp4Layout) ilst() *mp4Box {
+	udta := l.moov.child("udta")
+	if udta == nil {
+		return nil
+	}
+	meta := udta.child("meta")
+	if meta == nil {
+		return nil
+	}
+	return meta.child("ilst")
+}
+
+// ensureIlst returns the item list, creating udta/meta/ilst as iTunes lays them out
+// when the file has never been tagged.
+func (l *mp4Layout) ensureIlst() *mp4Box {
+	udta := l.moov.child("udta")
+	if udta == nil {
+		udta = &mp4Box{Type: "udta"}
+		l.moov.appendChild(udta)
+	}
+	meta := udta.child("meta")
+	if meta == nil {
+		handler := &mp4Box{Type: "hdlr", Payload: []byte{
+			0, 0, 0, 0, // version and flags
+			0, 0, 0, 0, // pre-defined
+			'm', 'd', 'i', 'r',
+			'a', 'p', 'p', 'l',
+			0, 0, 0, 0, 0, 0, 0, 0, // reserved
+			0, 0, // empty name
+		}}
+		meta = &mp4Box{Type: "meta", Payload: []byte{0, 0, 0, 0}, Children: []*mp4Box{handler}}
+		udta.appendChild(meta)
+	}
+	ilst := meta.child("ilst")
+	if ilst == nil {
+		ilst = &mp4Box{Type: "ilst"}
+		meta.appendChild(ilst)
+	}
+	return ilst
+}
+
+// freeformName returns a "----" item's mean and name.
+func freeformName(item *mp4Box) (mean, name string) {
+	for _, c := range item.Children {
+		if len(c.Payload) < 4 {
+			continue
+		}
+		switch c.Type {
+		case "mean":
+			mean = string(c.Payload[4:])
+		case "name":
+			name = string(c.Payload[4:])
+		}
+	}
+	return mean, name
+}
+
+// itemValues returns the payloads of an item's data atoms, past their type and
+// locale fields.
+func itemValues(item *mp4Box) [][]byte {
+	values := [][]byte{}
+	for _, c := range item.Children {
+		if c.Type == "data" && len(c.Payload) >= 8 {
+			values = append(values, c.Payload[8:])
+		}
+	}
+	return values
+}
+
+// mp4TagsMap reads an item list back as the canonical keys the desired-tag map uses.
+func mp4TagsMap(ilst *mp4Box) map[string][]string {
+	res := make(map[string][]string)
+	if ilst == nil {
+		return res
+	}
+	add := func(key, value string) {
+		if value = utilities.NormalizeTagValue(value); value != "" {
+			res[key] = append(res[key], value)
+		}
+	}
+
+	for _, item := range ilst.Children {
+		if halves, paired := mp4PairedAtoms[item.Type]; paired {
+			for _, value := range itemValues(item) {
+				if len(value) < 6 {
+					continue
+				}
+				if number := binary.BigEndian.Uint16(value[2:4]); number > 0 {
+					add(halves[0], strconv.Itoa(int(number)))
+				}
+				if total := binary.BigEndian.Uint16(value[4:6]); total > 0 {
+					add(halves[1], strconv.Itoa(int(total)))
+				}
+			}
+			continue
+		}
+
+		key := mp4KeyForAtom[item.Type]
+		if item.Type == mp4FreeformAtom {
+			mean, name := freeformName(item)
+			if mean != mp4FreeformMean {
+				continue // another application's namespace
+			}
+			key = strings.ToUpper(strings.TrimSpace(name))
+		}
+		if key == "" {
+			continue
+		}
+		for _, value := range itemValues(item) {
+			add(key, string(value))
+		}
+	}
+	return res
+}
+
+// removeItems drops every item drop reports true for.
+func removeItems(ilst *mp4Box, drop func(item *mp4Box) bool) {
+	kept := ilst.Children[:0]
+	for _, item := range ilst.Children {
+		if !drop(item) {
+			kept = append(kept, item)
+		}
+	}
+	ilst.Children = kept
+}
+
+// dataAtom builds one data atom of the given type.
+func dataAtom(dataType byte, value []byte) *mp4Box {
+	payload := make([]byte, 8, 8+len(value))
+	payload[3] = dataType
+	return &mp4Box{Type: "data", Payload: append(payload, value...)}
+}
+
+// textItem builds a standard text item holding values, one data atom each.
+func textItem(atom string, values []string) *mp4Box {
+	item := &mp4Box{Type: atom}
+	for _, value := range values {
+		item.Children = append(item.Children, dataAtom(mp4DataTypeUTF8, []byte(value)))
+	}
+	return item
+}
+
+// freeformItem builds a "----:com.apple.iTunes:<name>" item.
+func freeformItem(name string, values []string) *mp4Box {
+	withVersion := func(text string) []byte { return append([]byte{0, 0, 0, 0}, text...) }
+	item := &mp4Box{Type: mp4FreeformAtom, Children: []*mp4Box{
+		{Type: "mean", Payload: withVersion(mp4FreeformMean)},
+		{Type: "name", Payload: withVersion(name)},
+	}}
+	for _, value := range values {
+		item.Children = append(item.Children, dataAtom(mp4DataTypeUTF8, []byte(value)))
+	}
+	return item
+}
+
+// pairedItem builds a trkn or disk item. An empty number clears the atom, as it does
+// the paired ID3 frame — the two halves share one atom.
+func pairedItem(atom, number, total string) *mp4Box {
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	t, _ := strconv.Atoi(total)
+	value := make([]byte, 6, 8)
+	binary.BigEndian.PutUint16(value[2:4], uint16(n))
+	binary.BigEndian.PutUint16(value[4:6], uint16(max(t, 0)))
+	if atom == "trkn" {
+		value = append(value, 0, 0) // trkn carries two more reserved bytes than disk
+	}
+	return &mp4Box{Type: atom, Children: []*mp4Box{dataAtom(mp4DataTypeImplicit, value)}}
+}
+
+// shiftChunkOffsets moves every chunk offset at or past from by delta: the audio that
+// sits after moov moves when moov changes size, and stco/co64 address it absolutely.
+// An stco offset pushed past 4 GiB is an error rather than a wrapped number: the
+// file would still play its first chunks, then jump to the wrong audio.
+func shiftChunkOffsets(box *mp4Box, from int64, delta int64) error {
+	switch box.Type {
+	case "stco", "co64":
+		width := 4
+		if box.Type == "co64" {
+			width = 8
+		}
+		if len(box.Payload) < 8 {
+			return nil
+		}
+		count := int(binary.BigEndian.Uint32(box.Payload[4:8]))
+		for i := 0; i < count && 8+(i+1)*width <= len(box.Payload); i++ {
+			at := box.Payload[8+i*width:]
+			if width == 4 {
+				if offset := int64(binary.BigEndian.Uint32(at)); offset >= from {
+					shifted := offset + delta
+					if shifted < 0 || shifted > math.MaxUint32 {
+						return fmt.Errorf("chunk offset %d moved by %d does not fit stco", offset, delta)
+					}
+					binary.BigEndian.PutUint32(at, uint32(shifted))
+				}
+			} else if offset := int64(binary.BigEndian.Uint64(at)); offset >= from {
+				binary.BigEndian.PutUint64(at, uint64(offset+delta))
+			}
+		}
+	}
+	for _, child := range box.Children {
+		if err := shiftChunkOffsets(child, from, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMP4Tags reads an MP4's iTunes items back as the canonical keys the desired-tag
+// map uses, so the two can be compared directly.
+func GetMP4Tags(filePath string) (map[string][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read mp4 tags failed: %w", err)
+	}
+	defer file.Close()
+
+	layout, err := readMP4Moov(file)
+	if err != nil {
+		return nil, fmt.Errorf("read mp4 tags failed: %w", err)
+	}
+	return mp4TagsMap(layout.ilst()), nil
+}
+
+// extractFromMP4 is extractFromID3v2 for MP4, keyed by the same metadata types.
+func extractFromMP4(filePath string, metadataType string) (string, error) {
+	var key string
+	switch metadataType {
+	case "release":
+		key = "MusicBrainz Album Id"
+	case "release_group":
+		key = "MusicBrainz Release Group Id"
+	case "track":
+		key = "MusicBrainz Release Track Id"
+	case "recording":
+		key = "MusicBrainz Track Id"
+	case "title":
+		key = "TITLE"
+	default:
+		return "", errors.New("unsupported tag name for media type")
+	}
+
+	tags, err := GetMP4Tags(filePath)
+	if err != nil {
+		return "", err
+	}
+	for _, value := range tags[strings.ToUpper(key)] {
+		if value != "" {
+			return value, nil
+		}
+	}
+	return "", nil
+}
+
+// SetMP4Tags writes iTunes-style items into an MP4 file. The returned changes are the
+// field-level before/after actually applied; see models.TagChange.
+//
+// As with MP3, every key in the change set is written — including the ones
+// remove_values emptied, which delete their item — because the reported diff is
+// derived from the change set. Items this engine has no key for (cover art, encoder,
+// another application's freeform items) are kept as they are.
+func SetMP4Tags(filePath string, metadata models.FileTags, tagger models.TaggerSettings) (unchanged bool, tagsWritten int, changed []models.TagChange, err error) {
+	desired := renderMP4Tags(buildMP4DesiredTags(metadata), tagger)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("read mp4 tags failed: %w", err)
+	}
+	layout, err := readMP4Moov(file)
+	file.Close()
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("read mp4 tags failed: %w", err)
+	}
+	existing := mp4TagsMap(layout.ilst())
+	if metadata.Restore != nil {
+		desired, tagger = restoreDesired(existing, desired, metadata.Restore), restoreTagger(tagger)
+	}
+	// The writer reads values from desired, not from the change set, so the policies
+	// the diff honours are applied here first (see utilities.ApplyTagPolicies).
+	desired = utilities.ApplyTagPolicies(existing, desired, tagger)
+
+	changes, hasChanges := utilities.DiffID3Tags(existing, desired, tagger)
+	if !hasChanges {
+		logger.Log.Debug("no tag changes needed: " + filePath)
+		return true, 0, nil, nil
+	}
+
+	spellingOf := make(map[string]string, len(desired))
+	for key := range desired {
+		spellingOf[strings.ToUpper(key)] = key
+	}
+	valuesOf := func(upperKey string) []string { return desired[spellingOf[upperKey]] }
+	firstOf := func(upperKey string) string { return utilities.JoinTagValues(valuesOf(upperKey)) }
+
+	ilst := layout.ensureIlst()
+
+	for atom, halves := range mp4PairedAtoms {
+		_, numberChanged := changes[halves[0]]
+		_, totalChanged := changes[halves[1]]
+		if !numberChanged && !totalChanged {
+			continue
+		}
+		removeItems(ilst, func(item *mp4Box) bool { return item.Type == atom })
+		if item := pairedItem(atom, firstOf(halves[0]), firstOf(halves[1])); item != nil {
+			ilst.appendChild(item)
+		}
+		if numberChanged {
+			tagsWritten++
+		}
+		if totalChanged {
+			tagsWritten++
+		}
+	}
+
+	for _, upperKey := range sortedKeys(changes) {
+		if isMP4PairedHalf(upperKey) {
+			continue // written above
+		}
+		values := valuesOf(upperKey)
+		if atom, ok := mp4AtomForKey[upperKey]; ok {
+			removeItems(ilst, func(item *mp4Box) bool {
+				// gnre is the legacy numeric genre. Left beside a new ©gen it would
+				// be a second, contradicting genre for readers that prefer it.
+				return item.Type == atom || (upperKey == "GENRE" && item.Type == "gnre")
+			})
+			if len(values) > 0 {
+				ilst.appendChild(textItem(atom, values))
+			}
+		} else {
+			removeItems(ilst, func(item *mp4Box) bool {
+				if item.Type != mp4FreeformAtom {
+					return false
+				}
+				mean, name := freeformName(item)
+				return mean == mp4FreeformMean && strings.EqualFold(strings.TrimSpace(name), upperKey)
+			})
+			if len(values) > 0 {
+				ilst.appendChild(freeformItem(spellingOf[upperKey], values))
+			}
+		}
+		tagsWritten++
+	}
+
+	// moov is rebuilt whole; if it changed size and the audio follows it, every chunk
+	// offset pointing past it moves by the same amount. Patching does not change the
+	// tables' sizes, so the length measured before it is the length written.
+	moov := layout.moov.encode()
+	delta := int64(len(moov)) - layout.moovSize
+	moovEnd := layout.moovOffset + layout.moovSize
+	if delta != 0 {
+		if err := shiftChunkOffsets(layout.moov, moovEnd, delta); err != nil {
+			return false, 0, nil, fmt.Errorf("mp4 tag write failed: %w", err)
+		}
+		moov = layout.moov.encode()
+	}
+
+	err = rewriteFile(filePath, func(source *os.File, target io.Writer) error {
+		if _, err := io.Copy(target, io.NewSectionReader(source, 0, layout.moovOffset)); err != nil {
+			return err
+		}
+		if _, err := target.Write(moov); err != nil {
+			return err
+		}
+		_, err := io.Copy(target, io.NewSectionReader(source, moovEnd, 1<<62))
+		return err
+	})
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("mp4 tag write failed: %w", err)
+	}
+
+	changed = make([]models.TagChange, 0, len(changes))
+	for key, values := range changes {
+		changed = append(changed, models.TagChange{
+			Field:  key,
+			Old:    utilities.DescribeTagValues(existing[key]),
+			New:    utilities.DescribeTagValues(values),
+			Before: existing[key],
+			After:  values,
+		})
+	}
+	utilities.SortTagChanges(changed)
+	return false, tagsWritten, changed, nil
+}
+
+// isMP4PairedHalf reports whether a key is one half of trkn or disk.
+func isMP4PairedHalf(upperKey string) bool {
+	for _, halves := range mp4PairedAtoms {
+		if upperKey == halves[0] || upperKey == halves[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// The MP4 fixtures are assembled atom by atom, for the reason the Ogg ones are: the
+// engine never decodes audio, and what it must not break — the chunk offsets into
+// mdat — is exactly what a hand-built file makes checkable.
+
+// mp4Chunks are the "audio" chunks every fixture carries in its mdat.
+var mp4Chunks = [][]byte{bytes.Repeat([]byte("A"), 300), bytes.Repeat([]byte("B"), 200)}
+
+// synthMP4 builds ftyp + moov + mdat (or ftyp + mdat + moov with audioFirst), with an
+// stco table pointing at mp4Chunks. ilst, when non-nil, is placed in moov/udta/meta.
+func synthMP4(t *testing.T, ilst *mp4Box, audioFirst bool) string {
+	t.Helper()
+
+	ftyp := (&mp4Box{Type: "ftyp", Payload: []byte("M4A \x00\x00\x02\x00isomM4A ")}).encode()
+	mdat := &mp4Box{Type: "mdat", Payload: bytes.Join(mp4Chunks, nil)}
+
+	stco := &mp4Box{Type: "stco", Payload: make([]byte, 8+4*len(mp4Chunks))}
+	binary.BigEndian.PutUint32(stco.Payload[4:8], uint32(len(mp4Chunks)))
+	moov := &mp4Box{Type: "moov", Children: []*mp4Box{
+		{Type: "mvhd", Payload: make([]byte, 100)},
+		{Type: "trak", Children: []*mp4Box{
+			{Type: "mdia", Children: []*mp4Box{
+				{Type: "minf", Children: []*mp4Box{
+					{Type: "stbl", Children: []*mp4Box{stco}},
+				}},
+			}},
+		}},
+	}}
+	if ilst != nil {
+		layout := &mp4Layout{moov: moov}
+		*layout.ensureIlst() = *ilst
+	}
+
+	// The chunk offsets depend on where mdat lands, which depends on moov's size —
+	// fixed before the offsets are written, since patching does not change it.
+	mdatPayloadAt := len(ftyp) + 8
+	if !audioFirst {
+		mdatPayloadAt += len(moov.encode())
+	}
+	offset := mdatPayloadAt
+	for i, chunk := range mp4Chunks {
+		binary.BigEndian.PutUint32(stco.Payload[8+4*i:], uint32(offset))
+		offset += len(chunk)
+	}
+
+	var file []byte
+	if audioFirst {
+		file = slices.Concat(ftyp, mdat.encode(), moov.encode())
+	} else {
+		file = slices.Concat(ftyp, moov.encode(), mdat.encode())
+	}
+	path := filepath.Join(t.TempDir(), "track.m4a")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// assertMP4ChunksIntact follows the stco table back into the file and checks every
+// chunk is where the table says — the property a moov rewrite most easily breaks.
+func assertMP4ChunksIntact(t *testing.T, path string) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	layout, err := readMP4Moov(file)
+	if err != nil {
+		t.Fatalf("readMP4Moov: %v", err)
+	}
+	stco := layout.moov.child("trak").child("mdia").child("minf").child("stbl").child("stco")
+	for i, chunk := range mp4Chunks {
+		offset := binary.BigEndian.Uint32(stco.Payload[8+4*i:])
+		got := make([]byte, len(chunk))
+		if _, err := file.ReadAt(got, int64(offset)); err != nil || !bytes.Equal(got, chunk) {
+			t.Fatalf("chunk %d is no longer at offset %d", i, offset)
+		}
+	}
+}
+
+func TestMP4SetReadRoundTrip(t *testing.T) {
+	for _, audioFirst := range []bool{false, true} {
+		name := "moov before mdat"
+		if audioFirst {
+			name = "mdat before moov"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := synthMP4(t, nil, audioFirst)
+			meta := models.FileTags{
+				Artist:        "Compton’s Most Wanted",
+				Title:         "Intro",
+				Album:         "Music to Driveby",
+				Genres:        []string{"Hip Hop", "Rap"},
+				Track:         "3",
+				TrackTotal:    "12",
+				DiscNumber:    "1",
+				DiscTotal:     "2",
+				MBAlbumID:     "album-id-123",
+				MBRecordingID: "rec-id-456",
+			}
+
+			unchanged, written, _, err := SetFileTags(path, meta, models.TaggerSettings{})
+			if err != nil {
+				t.Fatalf("SetFileTags: %v", err)
+			}
+			if unchanged || written == 0 {
+				t.Fatalf("first write: unchanged=%v written=%d", unchanged, written)
+			}
+			assertMP4ChunksIntact(t, path)
+
+			tags, err := GetMP4Tags(path)
+			if err != nil {
+				t.Fatalf("GetMP4Tags: %v", err)
+			}
+			for key, want := range map[string][]string{
+				"ARTIST":      {"Compton’s Most Wanted"},
+				"TITLE":       {"Intro"},
+				"GENRE":       {"Hip Hop; Rap"}, // joined: the multi-value setting is off
+				"TRACKNUMBER": {"3"},
+				"TRACKTOTAL":  {"12"},
+				"DISCNUMBER":  {"1"},
+				"DISCTOTAL":   {"2"},
+				// Picard's spellings, upper-cased by the reader.
+				"MUSICBRAINZ ALBUM ID": {"album-id-123"},
+				"MUSICBRAINZ TRACK ID": {"rec-id-456"},
+			} {
+				if got := tags[key]; !slices.Equal(got, want) {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+
+			if got, err := ExtractMusicBrainzRecordingID(path); err != nil || got != "rec-id-456" {
+				t.Errorf("ExtractMusicBrainzRecordingID = %q, %v", got, err)
+			}
+
+			unchanged, written, _, err = SetFileTags(path, meta, models.TaggerSettings{})
+			if err != nil || !unchanged || written != 0 {
+				t.Errorf("second identical write should be a no-op, got unchanged=%v written=%d err=%v", unchanged, written, err)
+			}
+		})
+	}
+}
+
+// The delimiter choice is the MP3 one, for the MP3 reason: off joins into one data
+// atom for ffmpeg, on writes one atom per value. Flipping it converges after one write.
+func TestMP4MultiValueSettingConverges(t *testing.T) {
+	path := synthMP4(t, nil, false)
+	meta := models.FileTags{Title: "T", Genres: []string{"Hip Hop", "Rap"}}
+	multi := models.TaggerSettings{MP3MultiValueTags: true}
+
+	if _, _, _, err := SetMP4Tags(path, meta, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, _, changed, err := SetMP4Tags(path, meta, multi)
+	if err != nil || unchanged || len(changed) != 1 || changed[0].Field != "GENRE" {
+		t.Fatalf("flip should rewrite GENRE alone, got unchanged=%v changes=%v err=%v", unchanged, changed, err)
+	}
+	tags, _ := GetMP4Tags(path)
+	if got := tags["GENRE"]; !slices.Equal(got, []string{"Hip Hop", "Rap"}) {
+		t.Errorf("GENRE = %v, want two values", got)
+	}
+	if unchanged, _, _, _ := SetMP4Tags(path, meta, multi); !unchanged {
+		t.Error("the flipped file should converge")
+	}
+}
+
+func TestMP4KeepsForeignItems(t *testing.T) {
+	foreign := &mp4Box{Type: "ilst", Children: []*mp4Box{
+		textItem("\xa9too", []string{"Lavf60"}),
+		{Type: "gnre", Children: []*mp4Box{dataAtom(mp4DataTypeImplicit, []byte{0, 18})}},
+		{Type: mp4FreeformAtom, Children: []*mp4Box{
+			{Type: "mean", Payload: append([]byte{0, 0, 0, 0}, "com.example"...)},
+			{Type: "name", Payload: append([]byte{0, 0, 0, 0}, "LABEL"...)},
+			dataAtom(mp4DataTypeUTF8, []byte("not ours")),
+		}},
+	}}
+	path := synthMP4(t, foreign, false)
+
+	if _, _, _, err := SetMP4Tags(path, models.FileTags{Genres: []string{"rock"}, RecordLabels: []string{"Ours"}}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	assertMP4ChunksIntact(t, path)
+
+	file, _ := os.Open(path)
+	defer file.Close()
+	layout, err := readMP4Moov(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, item := range layout.ilst().Children {
+		types = append(types, item.Type)
+		if item.Type == mp4FreeformAtom {
+			if mean, _ := freeformName(item); mean == "com.example" && string(itemValues(item)[0]) != "not ours" {
+				t.Error("another application's freeform item was changed")
+			}
+		}
+	}
+	if !slices.Contains(types, "\xa9too") {
+		t.Error("the encoder item was dropped")
+	}
+	if slices.Contains(types, "gnre") {
+		t.Error("the legacy numeric genre survived a GENRE write")
+	}
+	tags := mp4TagsMap(layout.ilst())
+	if got := tags["LABEL"]; !slices.Equal(got, []string{"Ours"}) {
+		t.Errorf("LABEL = %v; only the com.apple.iTunes item is ours to read", got)
+	}
+}
+
+func TestMP4RefusesFragmentedFiles(t *testing.T) {
+	file := slices.Concat(
+		(&mp4Box{Type: "ftyp", Payload: []byte("iso5\x00\x00\x00\x00")}).encode(),
+		(&mp4Box{Type: "moov", Children: []*mp4Box{{Type: "mvex", Payload: []byte{}}}}).encode(),
+		(&mp4Box{Type: "moof", Payload: make([]byte, 8)}).encode(),
+	)
+	path := filepath.Join(t.TempDir(), "fragmented.m4a")
+	os.WriteFile(path, file, 0o644)
+
+	if _, _, _, err := SetMP4Tags(path, models.FileTags{Title: "x"}, models.TaggerSettings{}); !errors.Is(err, ErrMP4Unsupported) {
+		t.Errorf("a fragmented MP4 should be ErrMP4Unsupported, got %v", err)
+	}
+}
+
+// An stco offset moved past 4 GiB fails the write instead of wrapping round to the
+// start of the file; co64 has the room and takes it.
+func TestShiftChunkOffsetsRefusesToWrapStco(t *testing.T) {
+	table := func(atom string, width int, offset uint64) *mp4Box {
+		box := &mp4Box{Type: atom, Payload: make([]byte, 8+width)}
+		binary.BigEndian.PutUint32(box.Payload[4:8], 1)
+		if width == 4 {
+			binary.BigEndian.PutUint32(box.Payload[8:], uint32(offset))
+		} else {
+			binary.BigEndian.PutUint64(box.Payload[8:], offset)
+		}
+		return box
+	}
+	const near = math.MaxUint32 - 10
+
+	stco := table("stco", 4, near)
+	if err := shiftChunkOffsets(&mp4Box{Type: "stbl", Children: []*mp4Box{stco}}, 0, 100); err == nil {
+		t.Error("an stco offset pushed past 4 GiB was shifted without an error")
+	}
+	if err := shiftChunkOffsets(stco, 0, 10); err != nil {
+		t.Errorf("an stco offset that still fits: %v", err)
+	} else if got := binary.BigEndian.Uint32(stco.Payload[8:]); got != math.MaxUint32 {
+		t.Errorf("stco offset = %d, want %d", got, uint32(math.MaxUint32))
+	}
+
+	co64 := table("co64", 8, near)
+	if err := shiftChunkOffsets(co64, 0, 100); err != nil {
+		t.Fatalf("co64: %v", err)
+	}
+	if got := binary.BigEndian.Uint64(co64.Payload[8:]); got != near+100 {
+		t.Errorf("co64 offset = %d, want %d", got, uint64(near+100))
+	}
+}
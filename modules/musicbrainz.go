@@ -310,7 +310,15 @@ func QueryMusicBrainzReleaseData(mbID string, autotaggerrVersion string) (models
 	}
 
 	// do API request
-	url := fmt.Sprintf("%s/release/%s?inc=recordings+labels+artists+genres+tags+release-groups+isrcs&fmt=json", musicbrainzBaseURL, mbID)
+	// The relation includes are what carry composer, lyricist and writer: a recording
+	// links to the works it performs (recording-level-rels + work-rels), and each work
+	// to the artists who wrote it (work-level-rels + artist-rels — work-level-rels
+	// only widens the relation kinds already asked for, so without artist-rels the
+	// works arrive with no credits on them). release-rels links the pseudo-releases
+	// carrying a transliterated tracklisting, and aliases puts every credited artist's
+	// other names in the payload for a profile's locale preference.
+	url := fmt.Sprintf("%s/release/%s?inc=recordings+labels+artists+genres+tags+release-groups+isrcs"+
+		"+artist-rels+recording-level-rels+work-rels+work-level-rels+release-rels+aliases&fmt=json", musicbrainzBaseURL, mbID)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		logger.Log.Error("failed to create new request. error: " + err.Error())
@@ -400,6 +408,26 @@ func QueryMusicBrainzReleaseData(mbID string, autotaggerrVersion string) (models
 }
 
 func MusicBrainzArtistsArrayToString(artists []models.ArtistCredit, tagger models.TaggerSettings) string {
+	return joinArtistCredits(artists, tagger, func(feature models.ArtistCredit) string {
+		// the profile's locale alias, else the original release artist name or the
+		// current name
+		return artistCreditName(feature, tagger)
+	})
+}
+
+// MusicBrainzArtistSortNamesToString is MusicBrainzArtistsArrayToString over the
+// artists' sort names — "Beatles, The & Sheridan, Tony" — so a sort tag reads as the
+// credit it sorts. An artist without a sort name sorts under its credited name, which
+// is what a player does with no sort tag at all.
+func MusicBrainzArtistSortNamesToString(artists []models.ArtistCredit, tagger models.TaggerSettings) string {
+	return joinArtistCredits(artists, tagger, func(feature models.ArtistCredit) string {
+		return artistCreditSortName(feature, tagger)
+	})
+}
+
+// joinArtistCredits joins one name per credited artist with the credit's own join
+// phrases, or the profile's custom delimiter when it has one.
+func joinArtistCredits(artists []models.ArtistCredit, tagger models.TaggerSettings, nameOf func(models.ArtistCredit) string) string {
 	artistString := ""
 	for index, feature := range artists {
 		logger.Log.Trace("processing featuring artist: " + feature.Artist.Name)
@@ -416,12 +444,7 @@ func MusicBrainzArtistsArrayToString(artists []models.ArtistCredit, tagger model
 
 		logger.Log.Trace("feature join phrase to use: " + joinPhrase)
 
-		// either use original release artist name or current name
-		if tagger.UseCurrentArtistName {
-			artistString += feature.Artist.Name + joinPhrase
-		} else {
-			artistString += feature.Name + joinPhrase
-		}
+		artistString += nameOf(feature) + joinPhrase
 	}
 
 	return artistString
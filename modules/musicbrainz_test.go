@@ -25,6 +25,41 @@ func credit(name, joinphrase string) models.ArtistCredit {
 	}
 }
 
+// The sort string is the same credit, spelled with sort names: the join phrases and the
+// custom delimiter apply exactly as they do to the name, and an artist with no sort
+// name sorts under its credited name.
+func TestMusicBrainzArtistSortNamesToString(t *testing.T) {
+	beatles := credit("The Beatles", " & ")
+	beatles.Artist.SortName = "Beatles, The"
+	sheridan := credit("Tony Sheridan", "")
+	sheridan.Artist.SortName = "Sheridan, Tony"
+	unsorted := credit("Unsorted", "")
+
+	for _, tc := range []struct {
+		artists []models.ArtistCredit
+		tagger  models.TaggerSettings
+		want    string
+	}{
+		{[]models.ArtistCredit{beatles, sheridan}, models.TaggerSettings{}, "Beatles, The & Sheridan, Tony"},
+		{[]models.ArtistCredit{beatles, sheridan}, models.TaggerSettings{UseCustomArtistDelimiter: true, CustomArtistDelimiter: "; "}, "Beatles, The; Sheridan, Tony"},
+		{[]models.ArtistCredit{beatles, unsorted}, models.TaggerSettings{}, "Beatles, The & Unsorted"},
+	} {
+		if got := MusicBrainzArtistSortNamesToString(tc.artists, tc.tagger); got != tc.want {
+			t.Errorf("MusicBrainzArtistSortNamesToString() = %q, want %q", got, tc.want)
+		}
+	}
+
+	// ALBUMARTIST names the first credited artist, so its sort tag does too.
+	release := models.MusicBrainzReleaseResponse{ArtistCredit: []models.ArtistCredit{beatles, sheridan}}
+	metadata, err := BuildFileTags(models.Track{ArtistCredit: []models.ArtistCredit{beatles, sheridan}}, models.MusicBrainzMedia{}, release, models.TaggerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.AlbumArtistSort != "Beatles, The" || metadata.ArtistSort != "Beatles, The & Sheridan, Tony" {
+		t.Errorf("sort names = %q / %q", metadata.AlbumArtistSort, metadata.ArtistSort)
+	}
+}
+
 func TestMusicBrainzArtistsArrayToString(t *testing.T) {
 	base := models.TaggerSettings{
 		UseCurrentArtistName:        true,
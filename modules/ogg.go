@@ -0,0 +1,594 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/utilities"
+)
+
+// Ogg Vorbis and Ogg Opus carry the same Vorbis comment list FLAC does, only inside a
+// different container: a header packet in the first few Ogg pages instead of a
+// metadata block. So the engine below is a container engine and nothing else — it
+// finds the comment packet, hands its comments to the FLAC tag maps and diff, and puts
+// a new packet back. The fields, keys, multi-value form and remove_values behaviour are
+// FLAC's by construction, which is the point: the same album as Opus and as FLAC has
+// to say the same thing, and a second tag map would drift from the first the way the
+// MP3 one once did.
+//
+// There is no tool to shell out to (vorbiscomment and opustags are separate packages
+// nobody has installed), and the container is simple enough that an in-process writer
+// is less code than the subprocess plumbing would be.
+
+// ErrOggUnsupported means the file is an Ogg container holding something this engine
+// does not tag: a codec other than Vorbis or Opus (FLAC-in-Ogg, Speex, Theora), or a
+// multiplexed stream whose header pages interleave with another stream's. It is
+// refused rather than guessed at, because rewriting a stream the writer does not fully
+// understand is how a file gets damaged.
+var ErrOggUnsupported = errors.New("unsupported Ogg stream")
+
+const (
+	oggCapturePattern = "OggS"
+	// oggPageHeaderSize is the fixed part of a page header, up to and including the
+	// segment count. The segment table and the payload follow it.
+	oggPageHeaderSize = 27
+	oggMaxSegments    = 255
+
+	oggFlagContinued = 0x01
+	oggFlagFirst     = 0x02
+
+	// oggGranuleNone is the granule position of a page on which no packet finishes.
+	// The spec spells it -1.
+	oggGranuleNone = ^uint64(0)
+)
+
+// oggCodec is what a logical stream carries, which decides how many header packets it
+// opens with and how its comment packet is framed.
+type oggCodec struct {
+	name string
+	// headers is the number of header packets before the first audio packet: three
+	// for Vorbis (identification, comment, setup), two for Opus (OpusHead, OpusTags).
+	headers int
+	// commentMagic opens the comment packet.
+	commentMagic string
+	// framingBit is Vorbis's trailing 0x01 after the comment list. Opus has none.
+	framingBit bool
+}
+
+var (
+	oggVorbis = oggCodec{name: "vorbis", headers: 3, commentMagic: "\x03vorbis", framingBit: true}
+	oggOpus   = oggCodec{name: "opus", headers: 2, commentMagic: "OpusTags"}
+)
+
+// detectOggCodec reads the codec off a stream's first packet.
+func detectOggCodec(packet []byte) (oggCodec, error) {
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return oggVorbis, nil
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return oggOpus, nil
+	}
+	return oggCodec{}, fmt.Errorf("%w: the first stream is not Vorbis or Opus", ErrOggUnsupported)
+}
+
+// oggPage is one page of an Ogg bitstream. Segments is the lacing table; Data is the
+// payload it describes.
+type oggPage struct {
+	HeaderType byte
+	Granule    uint64
+	Serial     uint32
+	Sequence   uint32
+	Segments   []byte
+	Data       []byte
+}
+
+// readOggPage reads the next page. io.EOF means the stream ended cleanly between
+// pages.
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errors.New("truncated Ogg page header")
+		}
+		return nil, err
+	}
+	if string(header[:4]) != oggCapturePattern {
+		return nil, errors.New("not an Ogg page: capture pattern missing")
+	}
+	if header[4] != 0 {
+		return nil, fmt.Errorf("unsupported Ogg version %d", header[4])
+	}
+
+	page := &oggPage{
+		HeaderType: header[5],
+		Granule:    binary.LittleEndian.Uint64(header[6:14]),
+		Serial:     binary.LittleEndian.Uint32(header[14:18]),
+		Sequence:   binary.LittleEndian.Uint32(header[18:22]),
+		Segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.Segments); err != nil {
+		return nil, errors.New("truncated Ogg segment table")
+	}
+	size := 0
+	for _, lace := range page.Segments {
+		size += int(lace)
+	}
+	page.Data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.Data); err != nil {
+		return nil, errors.New("truncated Ogg page payload")
+	}
+
+	// The checksum is verified, not just carried: the writer recomputes it for every
+	// page it touches, so a page that was already corrupt on the way in would come out
+	// looking valid — and the damage would then be Autotaggerr's.
+	raw := make([]byte, 0, len(header)+len(page.Segments)+len(page.Data))
+	raw = append(append(append(raw, header...), page.Segments...), page.Data...)
+	if oggCRC(raw) != binary.LittleEndian.Uint32(header[22:26]) {
+		return nil, fmt.Errorf("Ogg page %d fails its checksum", page.Sequence)
+	}
+	return page, nil
+}
+
+// encode renders the page with a freshly computed checksum.
+func (p *oggPage) encode() []byte {
+	out := make([]byte, oggPageHeaderSize+len(p.Segments)+len(p.Data))
+	copy(out, oggCapturePattern)
+	out[5] = p.HeaderType
+	binary.LittleEndian.PutUint64(out[6:14], p.Granule)
+	binary.LittleEndian.PutUint32(out[14:18], p.Serial)
+	binary.LittleEndian.PutUint32(out[18:22], p.Sequence)
+	out[26] = byte(len(p.Segments))
+	copy(out[oggPageHeaderSize:], p.Segments)
+	copy(out[oggPageHeaderSize+len(p.Segments):], p.Data)
+	binary.LittleEndian.PutUint32(out[22:26], oggCRC(out))
+	return out
+}
+
+// oggCRCTable is Ogg's CRC-32: polynomial 0x04c11db7, not reflected, zero initial
+// value and no final XOR — which is not the CRC-32 hash/crc32 implements, so it has
+// its own table.
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC checksums a whole encoded page. The checksum field itself is treated as
+// zero, as the spec requires.
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for i, b := range page {
+		if i >= 22 && i < 26 {
+			b = 0
+		}
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// errFirstOggPageShared refuses a stream whose first page carries more than the
+// identification header. Both codec specs forbid it; the writer keeps page 0 verbatim
+// and lays out everything after it, so such a page would have its share of the
+// comment packet written twice.
+var errFirstOggPageShared = fmt.Errorf("%w: the first page carries more than the identification header", ErrOggUnsupported)
+
+// oggHeaders is the opening of a file's first logical stream: the pages that carry its
+// header packets and the packets themselves.
+type oggHeaders struct {
+	codec   oggCodec
+	serial  uint32
+	pages   []*oggPage
+	packets [][]byte
+}
+
+// readOggHeaders reads pages until the first stream's header packets are complete.
+//
+// It insists that the last header packet ends its page, which both codec specs
+// require (audio starts on a fresh page). That is also what makes a rewrite safe: the
+// header pages can be replaced wholesale and everything after them copied through.
+func readOggHeaders(r io.Reader) (*oggHeaders, error) {
+	first, err := readOggPage(r)
+	if err != nil {
+		return nil, err
+	}
+	if first.HeaderType&oggFlagFirst == 0 {
+		return nil, errors.New("Ogg stream does not open with a beginning-of-stream page")
+	}
+
+	headers := &oggHeaders{serial: first.Serial}
+	var pending []byte
+	page := first
+	for {
+		if page.Serial != headers.serial {
+			return nil, fmt.Errorf("%w: multiplexed streams are not tagged", ErrOggUnsupported)
+		}
+		headers.pages = append(headers.pages, page)
+
+		offset := 0
+		for i, lace := range page.Segments {
+			pending = append(pending, page.Data[offset:offset+int(lace)]...)
+			offset += int(lace)
+			if lace == oggMaxSegments {
+				continue // the packet carries on in the next segment
+			}
+			headers.packets = append(headers.packets, pending)
+			pending = nil
+			if len(headers.pages) == 1 && len(headers.packets) > 1 {
+				return nil, errFirstOggPageShared
+			}
+
+			if len(headers.packets) == 1 {
+				codec, err := detectOggCodec(headers.packets[0])
+				if err != nil {
+					return nil, err
+				}
+				headers.codec = codec
+			}
+			if len(headers.packets) == headers.codec.headers {
+				if i != len(page.Segments)-1 {
+					return nil, fmt.Errorf("%w: audio shares a page with the %s headers", ErrOggUnsupported, headers.codec.name)
+				}
+				return headers, nil
+			}
+		}
+		if len(headers.pages) == 1 && pending != nil {
+			return nil, errFirstOggPageShared
+		}
+
+		page, err = readOggPage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("Ogg stream ends inside its header packets")
+			}
+			return nil, err
+		}
+	}
+}
+
+// commentPacket is the header packet holding the Vorbis comments.
+func (h *oggHeaders) commentPacket() []byte {
+	return h.packets[1]
+}
+
+// vorbisComments is a decoded comment packet. Comments keep their on-disk order and
+// spelling; Trailer is whatever followed the list (Opus allows binary data there) and
+// is carried through untouched.
+type vorbisComments struct {
+	Vendor   string
+	Comments []string
+	Trailer  []byte
+}
+
+// parseVorbisComments decodes a comment packet for the given codec.
+func parseVorbisComments(packet []byte, codec oggCodec) (vorbisComments, error) {
+	parsed := vorbisComments{}
+	if !bytes.HasPrefix(packet, []byte(codec.commentMagic)) {
+		return parsed, fmt.Errorf("%s comment header is missing", codec.name)
+	}
+	rest := packet[len(codec.commentMagic):]
+
+	readString := func() (string, error) {
+		if len(rest) < 4 {
+			return "", errors.New("truncated comment header")
+		}
+		n := binary.LittleEndian.Uint32(rest)
+		rest = rest[4:]
+		if uint64(n) > uint64(len(rest)) {
+			return "", errors.New("comment length runs past the header")
+		}
+		value := string(rest[:n])
+		rest = rest[n:]
+		return value, nil
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return parsed, err
+	}
+	parsed.Vendor = vendor
+
+	if len(rest) < 4 {
+		return parsed, errors.New("truncated comment header")
+	}
+	count := binary.LittleEndian.Uint32(rest)
+	rest = rest[4:]
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return parsed, err
+		}
+		parsed.Comments = append(parsed.Comments, comment)
+	}
+
+	if codec.framingBit {
+		if len(rest) < 1 || rest[0]&0x01 == 0 {
+			return parsed, errors.New("vorbis comment header has no framing bit")
+		}
+		rest = rest[1:]
+	}
+	parsed.Trailer = append([]byte(nil), rest...)
+	return parsed, nil
+}
+
+// encode is the write direction of parseVorbisComments.
+func (c vorbisComments) encode(codec oggCodec) []byte {
+	var out bytes.Buffer
+	out.WriteString(codec.commentMagic)
+	writeString := func(value string) {
+		binary.Write(&out, binary.LittleEndian, uint32(len(value)))
+		out.WriteString(value)
+	}
+	writeString(c.Vendor)
+	binary.Write(&out, binary.LittleEndian, uint32(len(c.Comments)))
+	for _, comment := range c.Comments {
+		writeString(comment)
+	}
+	if codec.framingBit {
+		out.WriteByte(0x01)
+	}
+	out.Write(c.Trailer)
+	return out.Bytes()
+}
+
+// tagsMap groups the comments as KEY -> []values, the shape getFlacTagsMap returns.
+func (c vorbisComments) tagsMap() map[string][]string {
+	out := make(map[string][]string)
+	for _, comment := range c.Comments {
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		out[key] = append(out[key], utilities.NormalizeTagValue(value))
+	}
+	return out
+}
+
+// apply replaces every comment for each changed key with its new values, leaving the
+// rest where they were. New values go to the end, which is where metaflac put them and
+// so where every FLAC tagged before the native writer has them. A key with no values was
+// cleared by remove_values and is only removed.
+func (c *vorbisComments) apply(changes map[string][]string) {
+	kept := make([]string, 0, len(c.Comments))
+	for _, comment := range c.Comments {
+		key, _, _ := strings.Cut(comment, "=")
+		if _, changing := changes[strings.ToUpper(strings.TrimSpace(key))]; changing {
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	for _, key := range sortedKeys(changes) {
+		for _, value := range changes[key] {
+			kept = append(kept, key+"="+value)
+		}
+	}
+	c.Comments = kept
+}
+
+// sortedKeys returns a change set's keys in a stable order, so the same write always
+// produces the same bytes.
+func sortedKeys(changes map[string][]string) []string {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// paginateOggPackets lays header packets out over as many pages as they need,
+// numbered from firstSequence. The last packet ends the last page, which is what the
+// codec specs ask for and what lets the audio pages follow unchanged.
+func paginateOggPackets(packets [][]byte, serial uint32, firstSequence uint32) []*oggPage {
+	type lace struct {
+		size byte
+		ends bool // this segment completes its packet
+	}
+	laces := []lace{}
+	var data []byte
+	for _, packet := range packets {
+		remaining := len(packet)
+		for remaining >= oggMaxSegments {
+			laces = append(laces, lace{size: oggMaxSegments})
+			remaining -= oggMaxSegments
+		}
+		laces = append(laces, lace{size: byte(remaining), ends: true})
+		data = append(data, packet...)
+	}
+
+	pages := []*oggPage{}
+	continued := false
+	offset := 0
+	for start := 0; start < len(laces); start += oggMaxSegments {
+		end := min(start+oggMaxSegments, len(laces))
+		page := &oggPage{
+			Serial:   serial,
+			Sequence: firstSequence + uint32(len(pages)),
+			Granule:  oggGranuleNone,
+		}
+		if continued {
+			page.HeaderType |= oggFlagContinued
+		}
+		size := 0
+		for _, l := range laces[start:end] {
+			page.Segments = append(page.Segments, l.size)
+			size += int(l.size)
+			if l.ends {
+				page.Granule = 0 // a header packet finishes here
+			}
+		}
+		page.Data = data[offset : offset+size]
+		offset += size
+		continued = !laces[end-1].ends
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// readOggComments opens a file and decodes its first stream's comments.
+func readOggComments(filePath string) (*oggHeaders, vorbisComments, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, vorbisComments{}, err
+	}
+	defer file.Close()
+
+	headers, err := readOggHeaders(bufio.NewReader(file))
+	if err != nil {
+		return nil, vorbisComments{}, err
+	}
+	comments, err := parseVorbisComments(headers.commentPacket(), headers.codec)
+	if err != nil {
+		return nil, vorbisComments{}, err
+	}
+	return headers, comments, nil
+}
+
+// getOggTagsMap returns all Vorbis comments of an Ogg Vorbis or Opus file as
+// KEY -> []values (uppercased keys), exactly as getFlacTagsMap does for FLAC.
+func getOggTagsMap(filePath string) (map[string][]string, error) {
+	_, comments, err := readOggComments(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return comments.tagsMap(), nil
+}
+
+// buildOggDesiredTags is FLAC's desired map for an Ogg stream: the same keys, except
+// that Opus carries its gain as R128_* rather than REPLAYGAIN_* (see asR128Tags).
+func buildOggDesiredTags(metadata models.FileTags, codec oggCodec) map[string][]string {
+	desired := buildFLACDesiredTags(metadata)
+	if codec.name == oggOpus.name {
+		return asR128Tags(desired, metadata)
+	}
+	return desired
+}
+
+// ExtractOggTag is ExtractFLACTag for Ogg Vorbis and Opus.
+func ExtractOggTag(filePath, key, metadataType string) (string, error) {
+	if key == "" {
+		var ok bool
+		key, ok = utilities.MBVorbisKeyFor(metadataType)
+		if !ok {
+			return "", errors.New("unsupported or empty key/metadataType")
+		}
+	}
+
+	tags, err := getOggTagsMap(filePath)
+	if err != nil {
+		return "", err
+	}
+	for _, value := range tags[strings.ToUpper(key)] {
+		if value != "" {
+			return value, nil
+		}
+	}
+	return "", nil
+}
+
+// SetOggTags updates the Vorbis comments of an Ogg Vorbis or Opus file. It is
+// SetFlacTags with a different container: the same desired-tag map, the same diff,
+// the same report.
+//
+// The comment packet is rewritten in one pass and the file replaced atomically, so an
+// interrupted write leaves the old file rather than half of a new one. Growing the
+// packet can change how many pages the headers take; when it does, every later page of
+// the stream is renumbered and re-checksummed on the way through, since a reader
+// treats a sequence gap as data loss.
+func SetOggTags(filePath string, metadata models.FileTags, tagger models.TaggerSettings) (unchanged bool, tagsWritten int, changed []models.TagChange, err error) {
+	headers, comments, err := readOggComments(filePath)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	desired := renderFLACTags(buildOggDesiredTags(metadata, headers.codec))
+	existing := comments.tagsMap()
+	if metadata.Restore != nil {
+		desired, tagger = restoreDesired(existing, desired, metadata.Restore), restoreTagger(tagger)
+	}
+
+	changes, hasChanges := utilities.DiffFlacTags(existing, desired, tagger)
+	if !hasChanges {
+		logger.Log.Debug("no tag changes needed: " + filePath)
+		return true, 0, nil, nil
+	}
+
+	comments.apply(changes)
+	packets := append([][]byte{}, headers.packets[1:]...)
+	packets[0] = comments.encode(headers.codec)
+	// Page 0 carries the identification header alone and is kept byte for byte; only
+	// the pages after it are laid out again.
+	replacement := paginateOggPackets(packets, headers.serial, headers.pages[0].Sequence+1)
+	shift := int64(len(replacement)) - int64(len(headers.pages)-1)
+
+	err = rewriteFile(filePath, func(source *os.File, target io.Writer) error {
+		reader := bufio.NewReader(source)
+		// Skip the header pages; they were read already and are being replaced.
+		if _, err := readOggHeaders(reader); err != nil {
+			return err
+		}
+
+		if _, err := target.Write(headers.pages[0].encode()); err != nil {
+			return err
+		}
+		for _, page := range replacement {
+			if _, err := target.Write(page.encode()); err != nil {
+				return err
+			}
+		}
+
+		for {
+			page, err := readOggPage(reader)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// Only the tagged stream moves. A chained file's later streams number their
+			// own pages and are copied through as they are.
+			if page.Serial == headers.serial {
+				page.Sequence = uint32(int64(page.Sequence) + shift)
+			}
+			if _, err := target.Write(page.encode()); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("ogg tag write failed: %w", err)
+	}
+
+	changed = make([]models.TagChange, 0, len(changes))
+	for key, values := range changes {
+		tagsWritten++
+		// Described, not joined, for the reason SetFlacTags gives.
+		changed = append(changed, models.TagChange{
+			Field:  key,
+			Old:    utilities.DescribeTagValues(existing[key]),
+			New:    utilities.DescribeTagValues(values),
+			Before: existing[key],
+			After:  values,
+		})
+	}
+	utilities.SortTagChanges(changed)
+	return false, tagsWritten, changed, nil
+}
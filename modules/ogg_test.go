@@ -0,0 +1,265 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// The Ogg fixtures are built here rather than synthesized with ffmpeg: the engine
+// never decodes audio, so a stream of well-formed pages around arbitrary packet bytes
+// exercises everything it does, and the tests run on a machine without any tools.
+
+const testOggSerial = 0x5eed
+
+// synthOgg writes an Ogg file for codec whose comment packet holds comments, followed
+// by audio packets of audioSize bytes each. It returns the path and the audio packets,
+// so a test can check they come through a rewrite byte for byte.
+func synthOgg(t *testing.T, codec oggCodec, ext string, comments []string, audio int, audioSize int) (string, [][]byte) {
+	t.Helper()
+
+	var ident []byte
+	if codec.name == oggOpus.name {
+		ident = append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	} else {
+		ident = append([]byte("\x01vorbis"), bytes.Repeat([]byte{7}, 22)...)
+	}
+	headers := [][]byte{vorbisComments{Vendor: "synth", Comments: comments}.encode(codec)}
+	if codec.headers == 3 {
+		headers = append(headers, append([]byte("\x05vorbis"), bytes.Repeat([]byte{9}, 600)...))
+	}
+
+	var file bytes.Buffer
+	first := paginateOggPackets([][]byte{ident}, testOggSerial, 0)[0]
+	first.HeaderType = oggFlagFirst
+	file.Write(first.encode())
+	pages := paginateOggPackets(headers, testOggSerial, 1)
+	for _, page := range pages {
+		file.Write(page.encode())
+	}
+
+	packets := make([][]byte, 0, audio)
+	sequence := uint32(1 + len(pages))
+	for i := 0; i < audio; i++ {
+		packet := bytes.Repeat([]byte{byte(i + 1)}, audioSize)
+		packets = append(packets, packet)
+		for _, page := range paginateOggPackets([][]byte{packet}, testOggSerial, sequence) {
+			page.Granule = uint64(960 * (i + 1))
+			if i == audio-1 {
+				page.HeaderType |= 0x04
+			}
+			file.Write(page.encode())
+			sequence++
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "track"+ext)
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, packets
+}
+
+// readOggStream reads every packet of the file's stream, failing the test on a
+// checksum error or a gap in page numbering — the two things a reader treats as
+// corruption.
+func readOggStream(t *testing.T, path string) [][]byte {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	packets := [][]byte{}
+	var pending []byte
+	next := uint32(0)
+	for {
+		page, err := readOggPage(reader)
+		if errors.Is(err, io.EOF) {
+			return packets
+		}
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		if page.Sequence != next {
+			t.Fatalf("page sequence %d, want %d", page.Sequence, next)
+		}
+		next++
+		offset := 0
+		for _, lace := range page.Segments {
+			pending = append(pending, page.Data[offset:offset+int(lace)]...)
+			offset += int(lace)
+			if lace < oggMaxSegments {
+				packets = append(packets, pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+func TestOggSetReadRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		codec oggCodec
+		ext   string
+	}{{oggOpus, ".opus"}, {oggVorbis, ".ogg"}} {
+		t.Run(tc.codec.name, func(t *testing.T) {
+			path, audio := synthOgg(t, tc.codec, tc.ext, []string{"ENCODER=synth", "TITLE=old"}, 3, 400)
+
+			meta := models.FileTags{
+				Artist:        "Compton’s Most Wanted",
+				Title:         "Intro",
+				Genres:        []string{"Hip Hop", "Rap"},
+				MBAlbumID:     "album-id-123",
+				MBRecordingID: "rec-id-456",
+			}
+			unchanged, written, changed, err := SetFileTags(path, meta, models.TaggerSettings{})
+			if err != nil {
+				t.Fatalf("SetFileTags: %v", err)
+			}
+			if unchanged || written == 0 || len(changed) != written {
+				t.Fatalf("first write: unchanged=%v written=%d changes=%d", unchanged, written, len(changed))
+			}
+
+			tags, err := getOggTagsMap(path)
+			if err != nil {
+				t.Fatalf("getOggTagsMap: %v", err)
+			}
+			for key, want := range map[string][]string{
+				"ARTIST":              {"Compton’s Most Wanted"},
+				"TITLE":               {"Intro"},
+				"GENRE":               {"Hip Hop", "Rap"},
+				"MUSICBRAINZ_ALBUMID": {"album-id-123"},
+				"MUSICBRAINZ_TRACKID": {"rec-id-456"},
+				// Not ours, and remove_values is off: left exactly where it was.
+				"ENCODER": {"synth"},
+			} {
+				if got := tags[key]; !slices.Equal(got, want) {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+
+			if got, err := ExtractMusicBrainzReleaseID(path); err != nil || got != "album-id-123" {
+				t.Errorf("ExtractMusicBrainzReleaseID = %q, %v", got, err)
+			}
+			if got, err := ExtractTrackTitle(path); err != nil || got != "Intro" {
+				t.Errorf("ExtractTrackTitle = %q, %v", got, err)
+			}
+
+			packets := readOggStream(t, path)
+			if got := packets[len(packets)-len(audio):]; !slices.EqualFunc(got, audio, bytes.Equal) {
+				t.Error("audio packets did not survive the rewrite")
+			}
+
+			unchanged, written, _, err = SetFileTags(path, meta, models.TaggerSettings{})
+			if err != nil || !unchanged || written != 0 {
+				t.Errorf("second identical write should be a no-op, got unchanged=%v written=%d err=%v", unchanged, written, err)
+			}
+		})
+	}
+}
+
+// A comment packet that outgrows its page moves every audio page along by one. The
+// audio pages then have to be renumbered — a sequence gap reads as data loss — and
+// re-checksummed, since the number is inside the checksum.
+func TestOggRewriteRenumbersPagesWhenHeadersGrow(t *testing.T) {
+	path, audio := synthOgg(t, oggVorbis, ".ogg", nil, 4, 300)
+	before := len(readOggStream(t, path))
+
+	meta := models.FileTags{Title: "Title", Genres: []string{strings.Repeat("g", 70000)}}
+	if _, _, _, err := SetOggTags(path, meta, models.TaggerSettings{}); err != nil {
+		t.Fatalf("SetOggTags: %v", err)
+	}
+
+	packets := readOggStream(t, path)
+	if len(packets) != before {
+		t.Fatalf("%d packets after the rewrite, want %d", len(packets), before)
+	}
+	if got := packets[len(packets)-len(audio):]; !slices.EqualFunc(got, audio, bytes.Equal) {
+		t.Error("audio packets did not survive the rewrite")
+	}
+	if !bytes.HasPrefix(packets[2], []byte("\x05vorbis")) {
+		t.Error("the setup header did not follow the comment header")
+	}
+	tags, err := getOggTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags["GENRE"]) != 1 || len(tags["GENRE"][0]) != 70000 {
+		t.Errorf("the long comment did not read back whole")
+	}
+}
+
+func TestOggRemoveValuesClearsAndConverges(t *testing.T) {
+	path, _ := synthOgg(t, oggOpus, ".opus", []string{"BARCODE=123", "LABEL=A", "LABEL=B"}, 1, 100)
+	tagger := models.TaggerSettings{RemoveValues: true}
+	meta := models.FileTags{Title: "Title"}
+
+	if _, _, _, err := SetOggTags(path, meta, tagger); err != nil {
+		t.Fatalf("SetOggTags: %v", err)
+	}
+	tags, err := getOggTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tags["LABEL"]; ok {
+		t.Errorf("LABEL survived remove_values: %v", tags["LABEL"])
+	}
+	if _, ok := tags["BARCODE"]; ok {
+		t.Errorf("BARCODE survived remove_values: %v", tags["BARCODE"])
+	}
+	if unchanged, _, _, err := SetOggTags(path, meta, tagger); err != nil || !unchanged {
+		t.Errorf("the cleared file should converge, got unchanged=%v err=%v", unchanged, err)
+	}
+}
+
+func TestOggRefusesWhatItCannotRewrite(t *testing.T) {
+	t.Run("corrupt page", func(t *testing.T) {
+		path, _ := synthOgg(t, oggOpus, ".opus", nil, 1, 100)
+		data, _ := os.ReadFile(path)
+		data[len(data)-1] ^= 0xff
+		os.WriteFile(path, data, 0o644)
+
+		_, _, _, err := SetOggTags(path, models.FileTags{Title: "x"}, models.TaggerSettings{})
+		if err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("a corrupt page should be refused, got %v", err)
+		}
+	})
+
+	t.Run("unknown codec", func(t *testing.T) {
+		page := paginateOggPackets([][]byte{[]byte("\x7fFLAC\x01\x00")}, testOggSerial, 0)[0]
+		page.HeaderType = oggFlagFirst
+		path := filepath.Join(t.TempDir(), "flac-in-ogg.ogg")
+		os.WriteFile(path, page.encode(), 0o644)
+
+		if _, err := getOggTagsMap(path); !errors.Is(err, ErrOggUnsupported) {
+			t.Errorf("FLAC-in-Ogg should be ErrOggUnsupported, got %v", err)
+		}
+	})
+}
+
+func TestDiffFileTagsReadsOgg(t *testing.T) {
+	path, _ := synthOgg(t, oggOpus, ".opus", []string{"TITLE=Old"}, 1, 100)
+	entries, err := DiffFileTags(path, models.FileTags{Title: "New"}, models.TaggerSettings{})
+	if err != nil {
+		t.Fatalf("DiffFileTags: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Key == "TITLE" {
+			if !entry.Changed || entry.Current != "Old" || entry.Desired != "New" {
+				t.Errorf("TITLE entry = %+v", entry)
+			}
+			return
+		}
+	}
+	t.Error("no TITLE row in the diff")
+}
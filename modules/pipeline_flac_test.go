@@ -27,7 +27,6 @@ func releaseFixture() models.MusicBrainzReleaseResponse {
 // writes the file's tags. This drives the back half of the per-file pipeline end to end
 // against a mock MusicBrainz and a real synthesized FLAC.
 func TestTagResolvedFileWritesTags(t *testing.T) {
-	requireTool(t, "metaflac")
 	withMockMB(t, func(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(releaseFixture())
 	})
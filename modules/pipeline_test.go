@@ -37,7 +37,6 @@ func testRelease(trackIDs ...string) models.MusicBrainzReleaseResponse {
 // file-tag fallback path of ProcessTrackFile reads.
 func seedFlac(t *testing.T, path, releaseID, trackID string) {
 	t.Helper()
-	requireTool(t, "metaflac")
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +67,6 @@ func synthInto(t *testing.T, path string) {
 }
 
 func TestProcessTrackFileFromFileTags(t *testing.T) {
-	requireTool(t, "metaflac")
 	root := t.TempDir()
 	path := filepath.Join(root, "Test Artist", "Test Album (2020)", "01 track.flac")
 	seedFlac(t, path, "rel-123", "trk-1")
@@ -109,7 +107,6 @@ func TestProcessTrackFileFromFileTags(t *testing.T) {
 }
 
 func TestScanFolderRecursive(t *testing.T) {
-	requireTool(t, "metaflac")
 	root := t.TempDir()
 	albumDir := filepath.Join(root, "Test Artist", "Test Album (2020)")
 	seedFlac(t, filepath.Join(albumDir, "01 one.flac"), "rel-123", "trk-1")
@@ -0,0 +1,60 @@
+package modules
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// restoreDesired is the desired map for a rollback (models.FileTags.Restore): every
+// field as the file has it now, with the restored keys put back to their journaled
+// values. Carrying the rest is what keeps a paired frame whole — TRCK is the track
+// number and the total in one, and restoring one half must not write the other as
+// blank. The carried fields are already what the file says, so the diff finds nothing
+// to do with them.
+//
+// Keys take the spelling the engine's own desired map gives them, so a freeform
+// field keeps its description ("MusicBrainz Album Id", not the reader's upper case);
+// a key that map does not know keeps the reader's.
+func restoreDesired(existing, spelled, restore map[string][]string) map[string][]string {
+	spelling := make(map[string]string, len(spelled))
+	for key := range spelled {
+		spelling[strings.ToUpper(key)] = key
+	}
+	spell := func(key string) string {
+		upper := strings.ToUpper(key)
+		if s, ok := spelling[upper]; ok {
+			return s
+		}
+		return upper
+	}
+
+	desired := make(map[string][]string, len(existing)+len(restore))
+	for key, values := range existing {
+		desired[spell(key)] = values
+	}
+	for key, values := range restore {
+		desired[spell(key)] = values
+	}
+	return desired
+}
+
+// restoreTagger is the profile a rollback writes under. Only remove_values matters:
+// an empty restored value is a field that was absent before the write, and putting
+// it back means removing it, whatever the library's profile says about empties.
+func restoreTagger(tagger models.TaggerSettings) models.TaggerSettings {
+	tagger.RemoveValues = true
+	return tagger
+}
+
+// RestorableField reports whether a rollback can put a field back on this file. MP3
+// performers cannot: TMCL is written from the structured credits rather than from the
+// values its reader reports, and a journaled "Name (role)" has lost which part was
+// the role.
+func RestorableField(filePath, field string) bool {
+	if strings.EqualFold(filepath.Ext(filePath), ".mp3") && strings.EqualFold(field, performerTagKey) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package modules
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// TestRestorePutsBackExactlyTheJournaledFields: a write reports the raw values either
+// side of it, and a Restore of those puts the changed fields back — a field that was
+// absent is removed again — while leaving every field it does not name alone,
+// whatever the metadata around it says.
+func TestRestorePutsBackExactlyTheJournaledFields(t *testing.T) {
+	path := synthFLAC(t, nil, commentBlock("TITLE=Old", "GENRE=Rock", "GENRE=Pop"), paddingBlock(512))
+
+	_, _, changes, err := SetFlacTags(path, models.FileTags{Title: "New", Album: "Album"}, models.TaggerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := map[string][]string{}
+	for _, c := range changes {
+		restore[c.Field] = c.Before
+		if c.Field == "TITLE" && (!slices.Equal(c.Before, []string{"Old"}) || !slices.Equal(c.After, []string{"New"})) {
+			t.Errorf("TITLE change = %+v, want raw values Old → New", c)
+		}
+	}
+	if len(restore) != 2 {
+		t.Fatalf("changes = %+v, want TITLE and ALBUM", changes)
+	}
+
+	unchanged, _, undone, err := SetFlacTags(path, models.FileTags{Title: "Ignored", Restore: restore}, models.TaggerSettings{})
+	if err != nil || unchanged || len(undone) != 2 {
+		t.Fatalf("restore: unchanged=%v changes=%+v err=%v", unchanged, undone, err)
+	}
+	tags, err := getFlacTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags["TITLE"], []string{"Old"}) || tags["ALBUM"] != nil || !slices.Equal(tags["GENRE"], []string{"Rock", "Pop"}) {
+		t.Errorf("tags after restore = %v", tags)
+	}
+	assertFLACFramesIntact(t, path)
+}
+
+func TestRestorableField(t *testing.T) {
+	if RestorableField("/a/b.mp3", "PERFORMER") || !RestorableField("/a/b.flac", "PERFORMER") || !RestorableField("/a/b.mp3", "TITLE") {
+		t.Error("only an MP3's performers should be unrestorable")
+	}
+}
@@ -0,0 +1,207 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// rewriteFile replaces filePath with what write produces from it, atomically: the new
+// content goes to a temporary file in the same folder, is synced, and is renamed over
+// the original. A crash, a full disk or an error half way through therefore leaves the
+// original exactly as it was — the alternative, rewriting in place, leaves a truncated
+// file that no longer plays, and a tagger must never be the reason a file is lost.
+//
+// The temporary file sits beside the original because a rename is only atomic within
+// one filesystem. It is named so that a scan never mistakes it for audio, should the
+// process die before the cleanup below runs.
+func rewriteFile(filePath string, write func(source *os.File, target io.Writer) error) (err error) {
+	source, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".autotaggerr-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	buffered := bufio.NewWriterSize(temp, 1<<20)
+	if err = write(source, buffered); err != nil {
+		return err
+	}
+	if err = buffered.Flush(); err != nil {
+		return err
+	}
+	// The mode is the original's, not CreateTemp's 0600: a library is usually read by
+	// a media server running as somebody else.
+	if err = temp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	source.Close()
+	return os.Rename(temp.Name(), filePath)
+}
+
+// overwriteJournalMagic opens every journal overwriteFile leaves, so that a file which
+// merely has the journal's name is never replayed into audio.
+var overwriteJournalMagic = []byte("autotaggerr overwrite\x00")
+
+// overwriteFile writes data over filePath at offset, without changing the file's
+// length, in a way a crash cannot tear. The bytes go first to a journal beside the
+// file, which is synced together with its folder entry, and only then over the file;
+// the journal is removed once the file is synced. A crash before the journal is whole
+// leaves the file untouched, and one after leaves a journal that recoverOverwrite
+// finishes on the next read — so the file is either all old or, once read again, all
+// new.
+//
+// It is for the writes rewriteFile would make needlessly slow: a FLAC metadata chain
+// that fits the room the old one took, where copying the audio to a new file buys
+// nothing but time.
+func overwriteFile(filePath string, offset int64, data []byte) error {
+	if err := journalOverwrite(filePath, offset, data); err != nil {
+		return err
+	}
+	return recoverOverwrite(filePath)
+}
+
+// journalOverwrite is the first half of overwriteFile: the journal, synced, and the
+// file not yet touched.
+func journalOverwrite(filePath string, offset int64, data []byte) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset+int64(len(data)) > info.Size() {
+		return fmt.Errorf("overwrite of %d bytes at %d runs past the end of the file", len(data), offset)
+	}
+
+	journal := make([]byte, 0, len(overwriteJournalMagic)+20+len(data)+4)
+	journal = append(journal, overwriteJournalMagic...)
+	journal = binary.BigEndian.AppendUint64(journal, uint64(offset))
+	journal = binary.BigEndian.AppendUint64(journal, uint64(info.Size()))
+	journal = binary.BigEndian.AppendUint32(journal, uint32(len(data)))
+	journal = append(journal, data...)
+	journal = binary.BigEndian.AppendUint32(journal, crc32.ChecksumIEEE(journal))
+
+	path := overwriteJournalPath(filePath)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(journal); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	syncFolder(filepath.Dir(filePath))
+	return nil
+}
+
+// recoverOverwrite finishes an overwriteFile a crash interrupted, and is a no-op when
+// there is none. It is called before the file is read, by everything that reads the
+// formats overwriteFile is used on. A journal that does not check out — cut short by
+// the crash, or left for a file that has since been replaced by one of another size —
+// is from before the file was touched, and is only removed.
+func recoverOverwrite(filePath string) error {
+	path := overwriteJournalPath(filePath)
+	journal, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	offset, size, data, ok := parseOverwriteJournal(journal)
+	if ok {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		ok = info.Size() == size
+	}
+	if ok {
+		file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		if _, err := file.WriteAt(data, offset); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+func parseOverwriteJournal(journal []byte) (offset, size int64, data []byte, ok bool) {
+	header := len(overwriteJournalMagic) + 20
+	if len(journal) < header+4 || !bytes.HasPrefix(journal, overwriteJournalMagic) {
+		return 0, 0, nil, false
+	}
+	body, sum := journal[:len(journal)-4], binary.BigEndian.Uint32(journal[len(journal)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return 0, 0, nil, false
+	}
+	fields := body[len(overwriteJournalMagic):]
+	offset = int64(binary.BigEndian.Uint64(fields[0:]))
+	size = int64(binary.BigEndian.Uint64(fields[8:]))
+	length := int(binary.BigEndian.Uint32(fields[16:]))
+	if len(body) != header+length || offset < 0 || offset+int64(length) > size {
+		return 0, 0, nil, false
+	}
+	return offset, size, body[header:], true
+}
+
+// overwriteJournalPath is named, like rewriteFile's temporary file, so that a scan
+// never mistakes it for audio.
+func overwriteJournalPath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".autotaggerr-journal")
+}
+
+// syncFolder makes a new entry in dir durable. Not every platform can sync a folder,
+// and where it cannot the entry is as durable as the platform makes it, so a failure
+// here is not the write's.
+func syncFolder(dir string) {
+	folder, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	folder.Sync()
+	folder.Close()
+}
@@ -53,7 +53,6 @@ func TestMultiValueTagsSurviveBothEngines(t *testing.T) {
 	meta := multiValueFileTags()
 
 	t.Run("flac", func(t *testing.T) {
-		requireTool(t, "metaflac")
 		path := synthAudio(t, ".flac")
 
 		if _, _, _, err := SetFlacTags(path, meta, models.TaggerSettings{}); err != nil {
@@ -225,7 +224,6 @@ func TestEnginesRenderTheSameValuesDifferently(t *testing.T) {
 // reported as "Universal Music Special Markets; Intrada" became "Universal Music
 // Special Markets; Intrada" and looked like a diff that could not settle.
 func TestJoinedMultiValueTagIsReportedLegiblyAndConvergesOnce(t *testing.T) {
-	requireTool(t, "metaflac")
 	path := synthAudio(t, ".flac")
 
 	labels := []string{"Universal Music Special Markets", "Intrada"}
@@ -237,11 +235,7 @@ func TestJoinedMultiValueTagIsReportedLegiblyAndConvergesOnce(t *testing.T) {
 	}
 
 	// Seed the field the way a joined-form tagger leaves it: one comment, both values.
-	seed := exec.Command("metaflac", "--no-utf8-convert", "--set-tag",
-		"LABEL="+utilities.JoinTagValues(labels), path)
-	if out, err := seed.CombinedOutput(); err != nil {
-		t.Fatalf("seeding the joined LABEL failed: %v\n%s", err, out)
-	}
+	seedFlacComment(t, path, "LABEL="+utilities.JoinTagValues(labels))
 
 	_, _, changed, err := SetFlacTags(path, meta, models.TaggerSettings{})
 	if err != nil {
@@ -285,7 +279,6 @@ func TestJoinedMultiValueTagIsReportedLegiblyAndConvergesOnce(t *testing.T) {
 // ours. If a future ffmpeg stops doing this, the trade-off changes and this test is
 // where that shows up.
 func TestFFmpegJoinsRepeatedVorbisComments(t *testing.T) {
-	requireTool(t, "metaflac")
 	requireTool(t, "ffprobe")
 
 	path := synthAudio(t, ".flac")
@@ -0,0 +1,107 @@
+package modules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// bareMP3 is a file of MPEG frame headers and nothing else — enough for the ID3
+// engine, which never decodes audio.
+func bareMP3(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "01 track.mp3")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 500), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestMP3WriteHonoursTagPolicies covers the MP3 writer, which reads values from the
+// desired map rather than the diff: a locked TRACKTOTAL keeps its half of TRCK when
+// the track number changes, and a removed tag is cleared with remove_values off.
+func TestMP3WriteHonoursTagPolicies(t *testing.T) {
+	path := bareMP3(t)
+	if _, _, _, err := SetMP3Tags(path, models.FileTags{Title: "Song", Track: "3", TrackTotal: "9"}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagger := models.TaggerSettings{
+		TagPolicies:  map[string]string{"TITLE": models.TagPolicyRemove},
+		LockedFields: []string{"TRACKTOTAL"},
+	}
+	if _, _, _, err := SetMP3Tags(path, models.FileTags{Title: "Song", Track: "4", TrackTotal: "12"}, tagger); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := GetMP3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstTag(tags, "TRACKNUMBER") != "4" || firstTag(tags, "TRACKTOTAL") != "9" {
+		t.Errorf("TRCK = %v/%v, want the number written and the locked total kept", tags["TRACKNUMBER"], tags["TRACKTOTAL"])
+	}
+	if _, ok := tags["TITLE"]; ok {
+		t.Errorf("TITLE = %v, want it removed", tags["TITLE"])
+	}
+
+	// Written as the policies leave it, the file is converged: nothing more to do.
+	unchanged, _, _, err := SetMP3Tags(path, models.FileTags{Title: "Song", Track: "4", TrackTotal: "12"}, tagger)
+	if err != nil || !unchanged {
+		t.Errorf("second write unchanged = %v (%v), want nothing to write", unchanged, err)
+	}
+}
+
+// TestDiffFileTagsMarksKeptTags: the tag-diff view shows what the metadata says beside
+// what the file keeps, and says why it is kept.
+func TestDiffFileTagsMarksKeptTags(t *testing.T) {
+	path := bareMP3(t)
+	if _, _, _, err := SetMP3Tags(path, models.FileTags{Genres: []string{"hand picked"}}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := DiffFileTags(path, models.FileTags{Genres: []string{"rock"}}, models.TaggerSettings{LockedFields: []string{"GENRE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Key != "GENRE" {
+			continue
+		}
+		if e.Changed || e.Desired != "rock" || e.Policy != models.TagPolicyNever || !e.Locked {
+			t.Errorf("GENRE = %+v, want rock shown, kept by the file's lock", e)
+		}
+		return
+	}
+	t.Errorf("no GENRE row in %+v", entries)
+}
+
+// TestAlbumSortOnlyFills: ALBUMSORT is the release title, so it goes into a file that
+// has no sort title and never over one somebody set, unless the profile says so.
+func TestAlbumSortOnlyFills(t *testing.T) {
+	path := bareMP3(t)
+	if _, _, _, err := SetMP3Tags(path, models.FileTags{Album: "The Album", AlbumSort: "The Album"}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := GetMP3Tags(path); firstTag(tags, "ALBUMSORT") != "The Album" {
+		t.Fatalf("TSOA = %v, want the title filled in", tags["ALBUMSORT"])
+	}
+
+	flacPath := synthFLAC(t, nil, commentBlock("ALBUMSORT=Album, The"))
+	_, _, _, err := SetFlacTags(flacPath, models.FileTags{Album: "The Album", AlbumSort: "The Album"}, models.TaggerSettings{RemoveValues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := getFlacTagsMap(flacPath); len(tags["ALBUMSORT"]) != 1 || tags["ALBUMSORT"][0] != "Album, The" {
+		t.Errorf("ALBUMSORT = %v, want the hand-set sort title kept", tags["ALBUMSORT"])
+	}
+
+	overwrite := models.TaggerSettings{TagPolicies: map[string]string{"ALBUMSORT": models.TagPolicyOverwrite}}
+	if _, _, _, err := SetFlacTags(flacPath, models.FileTags{Album: "The Album", AlbumSort: "The Album"}, overwrite); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := getFlacTagsMap(flacPath); len(tags["ALBUMSORT"]) != 1 || tags["ALBUMSORT"][0] != "The Album" {
+		t.Errorf("ALBUMSORT = %v, want an explicit overwrite policy to replace it", tags["ALBUMSORT"])
+	}
+}
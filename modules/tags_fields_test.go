@@ -15,6 +15,9 @@ func fullFileTags() models.FileTags {
 		Artists:               []string{"Test Artist", "Feature"},
 		AlbumArtist:           "Test Artist",
 		AlbumArtists:          []string{"Test Artist", "Co-Headliner"},
+		ArtistSort:            "Artist, Test & Feature",
+		AlbumArtistSort:       "Artist, Test",
+		AlbumSort:             "Test Album",
 		Genres:                []string{"Hip Hop", "Rap"},
 		OriginalDate:          "2001-01-01",
 		OriginalYear:          "2001",
@@ -73,6 +76,9 @@ func TestMP3FullFieldRoundTrip(t *testing.T) {
 		"ARTISTS":              "Test Artist; Feature",
 		"ALBUMARTIST":          "Test Artist",               // single-valued for Plex
 		"ALBUMARTISTS":         "Test Artist; Co-Headliner", // the whole credit
+		"ARTISTSORT":           "Artist, Test & Feature",    // TSOP
+		"ALBUMARTISTSORT":      "Artist, Test",              // TSO2
+		"ALBUMSORT":            "Test Album",                // TSOA
 		"ISRC":                 "USABC1234567",              // TXXX:ISRC frame
 		"PUBLISHER":            "Test Label",
 		"TMED":                 "CD",
@@ -228,7 +234,6 @@ func TestExtractFromID3v2(t *testing.T) {
 // the seed wrote nothing, the "cleared" assertion read a tag that had never existed,
 // and the whole test passed without touching the branch it names.
 func TestSetFlacTagsRemoveValues(t *testing.T) {
-	requireTool(t, "metaflac")
 	path := filepath.Join(t.TempDir(), "track.flac")
 	synthInto(t, path)
 
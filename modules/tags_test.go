@@ -15,6 +15,9 @@ func sampleFileTags() models.FileTags {
 		Artists:               []string{"v_artists_one", "v_artists_two"},
 		AlbumArtist:           "v_albumartist",
 		AlbumArtists:          []string{"v_albumartists_one", "v_albumartists_two"},
+		ArtistSort:            "v_artistsort",
+		AlbumArtistSort:       "v_albumartistsort",
+		AlbumSort:             "v_albumsort",
 		Genres:                []string{"Rock", "Pop"},
 		OriginalDate:          "v_originaldate",
 		OriginalYear:          "v_originalyear",
@@ -69,6 +72,9 @@ func TestBuildFLACDesiredTags(t *testing.T) {
 	// ALBUMARTIST stays single-valued for Plex; the full credit rides on ALBUMARTISTS.
 	assertTag(t, m, "ALBUMARTIST", "v_albumartist")
 	assertTag(t, m, "ALBUMARTISTS", "v_albumartists_one; v_albumartists_two")
+	assertTag(t, m, "ARTISTSORT", "v_artistsort")
+	assertTag(t, m, "ALBUMARTISTSORT", "v_albumartistsort")
+	assertTag(t, m, "ALBUMSORT", "v_albumsort")
 
 	// Duplicated source fields must all be present.
 	assertTag(t, m, "DATE", "v_releasedate")
@@ -80,9 +86,9 @@ func TestBuildFLACDesiredTags(t *testing.T) {
 	assertTag(t, m, "BARCODE", "v_barcode")
 	assertTag(t, m, "CATALOGNUMBER", "v_catalognumber")
 
-	// Nothing resolves a value for these — they are not even fields on FileTags any
-	// more — so listing them would only ever clear another tagger's value once
-	// remove_values is on.
+	// Nothing resolves a value for AUTHOR or ASIN, so listing them would only ever
+	// clear another tagger's value once remove_values is on. COMPOSER is absent
+	// because the sample's work credits are unknown (see works_test.go).
 	for _, absent := range []string{"COMPOSER", "AUTHOR", "ASIN"} {
 		if _, ok := m[absent]; ok {
 			t.Errorf("FLAC desired tags unexpectedly contains %q", absent)
@@ -116,8 +122,11 @@ func TestBuildMP3DesiredTags(t *testing.T) {
 	assertTag(t, m, "BARCODE", "v_barcode")
 	assertTag(t, m, "CATALOGNUMBER", "v_catalognumber")
 	assertTag(t, m, "ALBUMARTISTS", "v_albumartists_one; v_albumartists_two")
+	assertTag(t, m, "ARTISTSORT", "v_artistsort")
+	assertTag(t, m, "ALBUMARTISTSORT", "v_albumartistsort")
+	assertTag(t, m, "ALBUMSORT", "v_albumsort")
 
-	// Never populated, so never written by either engine.
+	// Never populated (or, for COMPOSER, not known for the sample), so not written.
 	for _, absent := range []string{"COMPOSER", "AUTHOR", "ASIN", "MUSICBRAINZ_TRACKID"} {
 		if _, ok := m[absent]; ok {
 			t.Errorf("MP3 desired tags unexpectedly contains %q", absent)
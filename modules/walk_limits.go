@@ -0,0 +1,208 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WalkLimits is how hard WalkAndProcess may push the disks under a root. One global
+// worker count is the wrong shape for a host whose FLAC library sits on spinning disks
+// and whose MP3 library sits on an SSD: the number that keeps the SSD busy thrashes
+// the spindles, and the number the spindles tolerate leaves the SSD idle. So the pool
+// is sized per walk (the caller picks a library's own count), narrowed per format, and
+// optionally held under a bandwidth ceiling shared by every walk in the process.
+type WalkLimits struct {
+	// Workers is how many files are processed at once. Below 1 means the default.
+	Workers int
+	// PerFormat caps how many files of one format are in flight at once, keyed by
+	// lower-case extension without the dot ("flac"). A format that is not listed, or
+	// is listed at 0, is bounded by Workers alone; a cap above Workers changes nothing.
+	PerFormat map[string]int
+	// Bandwidth, if non-nil, is charged for each file's disk traffic once it is done
+	// (see IOLimiter). It is a pointer because the point of a ceiling is that it is
+	// shared: every library a run walks spends one budget.
+	Bandwidth *IOLimiter
+	// Hold, if set, is called before each file is started, and may block: it is how a
+	// run pauses between files, for quiet hours. Files already in flight finish while
+	// it waits. An error stops the walk, as a cancelled ctx does.
+	Hold func(ctx context.Context) error
+}
+
+// workers is Workers with the default applied.
+func (l WalkLimits) workers() int {
+	if l.Workers < 1 {
+		return defaultProcessConcurrency
+	}
+	return l.Workers
+}
+
+// formatSlots builds one semaphore per capped format. A cap that cannot bind (zero,
+// or at least the pool size) gets none, so an uncapped format never waits on a
+// channel it does not need.
+func (l WalkLimits) formatSlots() map[string]chan struct{} {
+	slots := map[string]chan struct{}{}
+	for format, limit := range l.PerFormat {
+		if limit > 0 && limit < l.workers() {
+			slots[strings.ToLower(format)] = make(chan struct{}, limit)
+		}
+	}
+	return slots
+}
+
+// String describes the limits for the walk's start-of-run log line.
+func (l WalkLimits) String() string {
+	parts := []string{fmt.Sprintf("%d worker(s)", l.workers())}
+	if caps := FormatFormatConcurrency(l.PerFormat); caps != "" {
+		parts = append(parts, "at most "+caps)
+	}
+	if rate := l.Bandwidth.Rate(); rate > 0 {
+		parts = append(parts, fmt.Sprintf("%d MB/s", rate/(1<<20)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fileFormat is the key PerFormat is looked up by.
+func fileFormat(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// ParseFormatConcurrency reads per-format caps written as "flac=2, mp3=8" — the shape
+// the settings page edits them in. Formats are the extensions a scan processes; an
+// unknown one is rejected rather than ignored, since a typo there would silently leave
+// the disk it was meant to protect uncapped. Empty input is no caps.
+func ParseFormatConcurrency(value string) (map[string]int, error) {
+	caps := map[string]int{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		format, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not format=workers", entry)
+		}
+		format = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(format)), ".")
+		if !supportedExtensions["."+format] {
+			return nil, fmt.Errorf("%q is not a format a scan processes", format)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || limit < 1 || limit > 64 {
+			return nil, fmt.Errorf("%s: workers must be between 1 and 64", format)
+		}
+		caps[format] = limit
+	}
+	return caps, nil
+}
+
+// FormatFormatConcurrency writes caps back in ParseFormatConcurrency's shape, sorted
+// so the same caps always read the same.
+func FormatFormatConcurrency(caps map[string]int) string {
+	formats := make([]string, 0, len(caps))
+	for format, limit := range caps {
+		if limit > 0 {
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+	entries := make([]string, len(formats))
+	for i, format := range formats {
+		entries[i] = fmt.Sprintf("%s=%d", format, caps[format])
+	}
+	return strings.Join(entries, ", ")
+}
+
+// IOLimiter holds file processing under a bandwidth ceiling. It is charged after a
+// file is done, with an estimate of the bytes that file moved, and makes the worker
+// that charged it wait until the ceiling has caught up — so the pool's slot stays
+// taken for the wait, and a walk over a slow disk is slowed by holding its workers
+// back rather than by starving anything else on the host.
+//
+// Paying after rather than before is deliberate: what a file costs is only known once
+// it is done (an unchanged file costs a stat, a rewritten one its size twice over), and
+// over a run of any length the average is what the ceiling is for. The estimate is
+// coarse — it does not see the tag reads or a skip check that hashed the audio — but it
+// is charged for exactly the writes that make a run disk-bound.
+//
+// A nil *IOLimiter, or one at rate 0, is no ceiling.
+type IOLimiter struct {
+	rate atomic.Int64 // bytes per second; 0 = unlimited
+
+	mu   sync.Mutex
+	next time.Time // when the traffic charged so far has been paid off
+}
+
+// NewIOLimiter returns a limiter at bytesPerSecond; 0 is no ceiling.
+func NewIOLimiter(bytesPerSecond int64) *IOLimiter {
+	l := &IOLimiter{}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the ceiling. A walk that is running picks it up at its next file,
+// which is the point of being able to change it from the settings page mid-run.
+func (l *IOLimiter) SetRate(bytesPerSecond int64) {
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.rate.Store(bytesPerSecond)
+}
+
+// Rate reports the ceiling in bytes per second; 0 is none.
+func (l *IOLimiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.rate.Load()
+}
+
+// Charge records n bytes of traffic and waits until the ceiling allows for it. It
+// returns early with ctx's error if ctx is cancelled, since a stopped run has no
+// reason to keep pacing a file that is already written.
+func (l *IOLimiter) Charge(ctx context.Context, n int64) error {
+	rate := l.Rate()
+	if rate <= 0 || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now // idle time is not banked as a burst
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	wait := l.next.Sub(now)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fileTraffic estimates what processing path moved on disk: nothing for a file left
+// unchanged, its size for one that was read through, and twice that for one whose
+// tags were rewritten.
+func fileTraffic(path string, unchanged bool, tagsWritten int) int64 {
+	if unchanged {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if tagsWritten > 0 {
+		return 2 * info.Size()
+	}
+	return info.Size()
+}
@@ -0,0 +1,98 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A capped format never has more files in flight than its cap, however big the pool;
+// an uncapped one alongside it is not held to that cap.
+func TestWalkAndProcessCapsAFormat(t *testing.T) {
+	root := t.TempDir()
+	for i := 1; i <= 6; i++ {
+		for _, ext := range []string{".flac", ".mp3"} {
+			if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("%02d%s", i, ext)), []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var (
+		mu             sync.Mutex
+		inFlight, peak = map[string]int{}, map[string]int{}
+	)
+	process := func(path string) (bool, int, error) {
+		format := fileFormat(path)
+		mu.Lock()
+		inFlight[format]++
+		peak[format] = max(peak[format], inFlight[format])
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight[format]--
+		mu.Unlock()
+		return true, 0, nil
+	}
+
+	limits := WalkLimits{Workers: 4, PerFormat: map[string]int{"flac": 1}}
+	counter, _, _, _, err := WalkAndProcess(context.Background(), root, nil, limits, process, nil)
+	if err != nil || counter != 12 {
+		t.Fatalf("counter = %d, err = %v; want all 12 files", counter, err)
+	}
+	if peak["flac"] != 1 {
+		t.Errorf("%d FLAC files in flight at once, want the cap of 1", peak["flac"])
+	}
+	if peak["mp3"] < 2 {
+		t.Errorf("%d MP3 file(s) in flight at once, want the uncapped format to use the pool", peak["mp3"])
+	}
+}
+
+func TestParseFormatConcurrency(t *testing.T) {
+	caps, err := ParseFormatConcurrency(" FLAC=2, .mp3 = 8 ,")
+	if err != nil {
+		t.Fatalf("ParseFormatConcurrency: %v", err)
+	}
+	if len(caps) != 2 || caps["flac"] != 2 || caps["mp3"] != 8 {
+		t.Errorf("caps = %v", caps)
+	}
+	if got := FormatFormatConcurrency(caps); got != "flac=2, mp3=8" {
+		t.Errorf("FormatFormatConcurrency = %q", got)
+	}
+	for _, bad := range []string{"flac", "wav=2", "flac=0", "flac=two"} {
+		if _, err := ParseFormatConcurrency(bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
+
+// The ceiling holds the average: charging twice the per-second budget takes about two
+// seconds' worth of waiting, scaled down here to a tenth of one.
+func TestIOLimiterPacesCharges(t *testing.T) {
+	limiter := NewIOLimiter(1 << 20)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := limiter.Charge(context.Background(), 1<<20/20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("two charges of 1/20 s took %s, want about 100ms", elapsed)
+	}
+
+	limiter.SetRate(0)
+	start = time.Now()
+	limiter.Charge(context.Background(), 1<<30)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("a charge with the ceiling off waited %s", elapsed)
+	}
+
+	var none *IOLimiter
+	if err := none.Charge(context.Background(), 1<<30); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+}
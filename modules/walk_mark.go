@@ -0,0 +1,155 @@
+package modules
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// WalkMark is how far a walk of one root has got, kept so that a walk stopped partway
+// can be picked up where it stopped rather than from the top.
+//
+// It is a point in walk order, not a set of files. filepath.WalkDir visits a folder's
+// entries in name order, so "every file up to here is done" is one path, and a
+// resumed walk passes over whole folders that sort before it without reading them —
+// which is the point on a library of sixty thousand files, where the skip-unchanged
+// check alone still opens every one.
+//
+// The pool finishes files out of order, so the point only advances past a file once
+// every file handed out before it has finished as well. A stop leaves it at the last
+// file of an unbroken run of finished ones; the handful in flight past it are done
+// again, and find themselves unchanged.
+//
+// A file that failed is finished too — the point has to move past it, or one bad file
+// would hold every later one back — but it is not done. The mark keeps it in Retry,
+// and a walk resumed with it visits it again wherever it sorts.
+type WalkMark struct {
+	after string // where the walk resumes: every file at or before it was done already
+
+	mu      sync.Mutex
+	pending []string        // handed to the pool in walk order, oldest unfinished first
+	done    map[string]bool // the pending files that have finished
+	reached string
+	retry   map[string]bool // files at or before after to visit again: an earlier walk failed them
+	failed  map[string]bool // files this walk failed
+}
+
+// NewWalkMark starts a mark for a walk resuming after the file at after, or from the
+// top when after is empty. retry is files an earlier walk failed, visited again even
+// though they sort before after.
+func NewWalkMark(after string, retry ...string) *WalkMark {
+	m := &WalkMark{after: after, reached: after, done: map[string]bool{}, retry: map[string]bool{}, failed: map[string]bool{}}
+	for _, path := range retry {
+		m.retry[path] = true
+	}
+	return m
+}
+
+// Retry is the files still to be tried again: those this walk failed, and those an
+// earlier one failed that this one has not reached yet.
+func (m *WalkMark) Retry() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.retry)+len(m.failed))
+	for path := range m.retry {
+		out = append(out, path)
+	}
+	for path := range m.failed {
+		if !m.retry[path] {
+			out = append(out, path)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Reached is the last file before which the walk has nothing left to do. It is the
+// value to resume from.
+func (m *WalkMark) Reached() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reached
+}
+
+// skip reports whether a resumed walk can pass over path: a file at or before the
+// resume point, or a folder everything in which sorts before it.
+func (m *WalkMark) skip(path string, isDir bool) bool {
+	if m == nil || m.after == "" {
+		return false
+	}
+	if isDir {
+		for retry := range m.retry {
+			if within(retry, path) {
+				return false
+			}
+		}
+		return !within(m.after, path) && walkBefore(path, m.after)
+	}
+	return !walkBefore(m.after, path) && !m.retry[path]
+}
+
+func (m *WalkMark) dispatched(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.pending = append(m.pending, path)
+	m.mu.Unlock()
+}
+
+func (m *WalkMark) finished(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done[path] = true
+	delete(m.retry, path)
+	for len(m.pending) > 0 && m.done[m.pending[0]] {
+		// A retried file sorts before the point it was handed out under; finishing it
+		// must not move the point back.
+		if m.reached == "" || walkBefore(m.reached, m.pending[0]) {
+			m.reached = m.pending[0]
+		}
+		delete(m.done, m.pending[0])
+		m.pending = m.pending[1:]
+	}
+}
+
+// fail records that path failed. It is still finished (see finished); this only
+// keeps it for Retry.
+func (m *WalkMark) fail(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.failed[path] = true
+	m.mu.Unlock()
+}
+
+// walkBefore reports whether a sorts before b in the order filepath.WalkDir visits
+// them. That is not plain string order: the walk compares a folder's entries by name,
+// so "A/x" comes before "A-B" although '/' sorts after '-'.
+func walkBefore(a, b string) bool {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// within reports whether path is dir or somewhere under it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,90 @@
+package modules
+
+import (
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/utilities"
+)
+
+// Work credits: who wrote what a recording performs. MusicBrainz does not credit a
+// composer on a recording or a release — a composer writes a *work*, and a recording
+// is a performance of one or more works — so the credit is two hops from the track:
+//
+//	recording -performance-> work -composer/lyricist/writer-> artist
+//
+// Both hops arrive inside the release payload (see QueryMusicBrainzReleaseData's
+// includes), so this is a walk over data already in hand, not a fetch per work.
+
+// workCreditTypes maps the MusicBrainz work-artist relationship types onto the field
+// that carries them. Everything else on a work — arranger, translator, publisher,
+// the work's own parts — is left out: those are not what a player shows as composer
+// or lyricist, and folding them in would be a guess dressed as a credit.
+var workCreditTypes = map[string]func(*workCreditSet) *[]string{
+	"composer": func(s *workCreditSet) *[]string { return &s.composers },
+	"lyricist": func(s *workCreditSet) *[]string { return &s.lyricists },
+	"writer":   func(s *workCreditSet) *[]string { return &s.writers },
+}
+
+type workCreditSet struct {
+	composers, lyricists, writers []string
+	works, ids                    []string
+}
+
+// applyWorkCredits fills a FileTags' work fields from the recording's relationships,
+// or leaves WorkCredits false when the release was fetched without them.
+//
+// Names are the ones the work credits them under; see creditedName.
+func applyWorkCredits(metadata *models.FileTags, track models.Track, response models.MusicBrainzReleaseResponse, tagger models.TaggerSettings) {
+	if !response.FetchedWithRelations() {
+		return
+	}
+	metadata.WorkCredits = true
+
+	var set workCreditSet
+	for _, rel := range track.Recording.Relations {
+		if rel.TargetType != "work" || rel.Type != "performance" || rel.Work == nil {
+			continue
+		}
+		set.works = appendNew(set.works, rel.Work.Title)
+		set.ids = appendNew(set.ids, rel.Work.ID)
+
+		for _, credit := range rel.Work.Relations {
+			field, ok := workCreditTypes[credit.Type]
+			if !ok || credit.TargetType != "artist" || credit.Artist == nil {
+				continue
+			}
+			list := field(&set)
+			*list = appendNew(*list, creditedName(credit, tagger))
+		}
+	}
+
+	metadata.Composers = utilities.NormalizeTagValues(set.composers)
+	metadata.Lyricists = utilities.NormalizeTagValues(set.lyricists)
+	metadata.Writers = utilities.NormalizeTagValues(set.writers)
+	metadata.Works = utilities.NormalizeTagValues(set.works)
+	metadata.MBWorkIDs = utilities.NormalizeTagValues(set.ids)
+}
+
+// appendNew appends a value the list does not already hold. A composer of both works
+// in a medley is one composer; this is a fact about the credit, not the rendering, so
+// it is settled here rather than left to the diff.
+func appendNew(list []string, value string) []string {
+	for _, have := range list {
+		if have == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// withWorkTags adds an engine's work keys to its desired map — only when the credits
+// are known, for the reason FileTags.WorkCredits gives. keys names the engine's key for
+// composer, lyricist, writer, work and work MBID, in that order.
+func withWorkTags(desired map[string][]string, metadata models.FileTags, keys [5]string) map[string][]string {
+	if !metadata.WorkCredits {
+		return desired
+	}
+	for i, values := range [][]string{metadata.Composers, metadata.Lyricists, metadata.Writers, metadata.Works, metadata.MBWorkIDs} {
+		desired[keys[i]] = values
+	}
+	return desired
+}
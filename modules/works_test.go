@@ -0,0 +1,170 @@
+package modules
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/bogem/id3v2"
+)
+
+// workRelease is a release payload in the shape the relation includes return it: a
+// medley performing two works, each credited, plus the relationships that must not
+// become credits — a recording-level producer and a work-level arranger.
+const workRelease = `{
+  "id": "rel-1",
+  "title": "Medley",
+  "artist-credit": [{"name": "The Band", "artist": {"id": "band", "name": "The Band"}}],
+  "media": [{"position": 1, "tracks": [{
+    "id": "track-1", "position": 1, "title": "Medley",
+    "recording": {"id": "rec-1", "title": "Medley", "relations": [
+      {"type": "producer", "target-type": "artist", "artist": {"id": "p", "name": "Producer"}},
+      {"type": "performance", "target-type": "work", "work": {
+        "id": "work-1", "title": "First Song", "relations": [
+          {"type": "composer", "target-type": "artist", "target-credit": "J. Smith", "artist": {"id": "a1", "name": "John Smith"}},
+          {"type": "lyricist", "target-type": "artist", "artist": {"id": "a2", "name": "Ann Lee"}},
+          {"type": "arranger", "target-type": "artist", "artist": {"id": "a3", "name": "Arranger"}}
+        ]}},
+      {"type": "performance", "target-type": "work", "work": {
+        "id": "work-2", "title": "Second Song", "relations": [
+          {"type": "composer", "target-type": "artist", "target-credit": "J. Smith", "artist": {"id": "a1", "name": "John Smith"}},
+          {"type": "writer", "target-type": "artist", "artist": {"id": "a4", "name": "Bo Writer"}}
+        ]}}
+    ]}
+  }]}]
+}`
+
+func decodeWorkRelease(t *testing.T, payload string) models.MusicBrainzReleaseResponse {
+	t.Helper()
+	var release models.MusicBrainzReleaseResponse
+	if err := json.Unmarshal([]byte(payload), &release); err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+func TestWorkCreditsFollowThePerformanceRelations(t *testing.T) {
+	release := decodeWorkRelease(t, workRelease)
+	track, media := release.Media[0].Tracks[0], release.Media[0]
+
+	metadata, err := BuildFileTags(track, media, release, models.TaggerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.WorkCredits {
+		t.Fatal("a release fetched with relations should have known work credits")
+	}
+	for name, tc := range map[string]struct{ got, want []string }{
+		"composers": {metadata.Composers, []string{"J. Smith"}}, // credited name, once across both works
+		"lyricists": {metadata.Lyricists, []string{"Ann Lee"}},
+		"writers":   {metadata.Writers, []string{"Bo Writer"}},
+		"works":     {metadata.Works, []string{"First Song", "Second Song"}},
+		"work ids":  {metadata.MBWorkIDs, []string{"work-1", "work-2"}},
+	} {
+		if !slices.Equal(tc.got, tc.want) {
+			t.Errorf("%s = %v, want %v", name, tc.got, tc.want)
+		}
+	}
+
+	current, _ := BuildFileTags(track, media, release, models.TaggerSettings{UseCurrentArtistName: true})
+	if !slices.Equal(current.Composers, []string{"John Smith"}) {
+		t.Errorf("composers with use_current_artist_name = %v, want the artist's own name", current.Composers)
+	}
+
+	flac := buildFLACDesiredTags(metadata)
+	assertTag(t, flac, "COMPOSER", "J. Smith")
+	assertTag(t, flac, "WORK", "First Song; Second Song")
+	assertTag(t, flac, "MUSICBRAINZ_WORKID", "work-1; work-2")
+	mp3 := buildMP3DesiredTags(metadata)
+	assertTag(t, mp3, "LYRICIST", "Ann Lee")
+	assertTag(t, mp3, "WRITER", "Bo Writer")
+	assertTag(t, mp3, "MusicBrainz Work Id", "work-1; work-2")
+}
+
+// A release cached before the fetch asked for relations has no work credits to offer.
+// That is "unknown", and writing it as "none" would clear a composer another tagger
+// got right the moment remove_values is on.
+func TestUnknownWorkCreditsLeaveTheFileAlone(t *testing.T) {
+	release := decodeWorkRelease(t, `{"id": "rel-2", "title": "Old", "artist-credit": [{"name": "A", "artist": {"id": "a"}}],
+		"media": [{"position": 1, "tracks": [{"id": "t", "position": 1, "title": "T", "recording": {"id": "r"}}]}]}`)
+	if release.FetchedWithRelations() {
+		t.Fatal("a recording without a relations array should read as fetched without them")
+	}
+	metadata, err := BuildFileTags(release.Media[0].Tracks[0], release.Media[0], release, models.TaggerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desired := range []map[string][]string{buildFLACDesiredTags(metadata), buildMP3DesiredTags(metadata), buildMP4DesiredTags(metadata)} {
+		if _, ok := desired["COMPOSER"]; ok {
+			t.Error("COMPOSER is in the desired tags although the credits are unknown")
+		}
+	}
+
+	path := synthFLAC(t, nil, commentBlock("COMPOSER=Someone Else"), paddingBlock(flacRewritePadding))
+	if _, _, _, err := SetFlacTags(path, metadata, models.TaggerSettings{RemoveValues: true}); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := getFlacTagsMap(path); !slices.Equal(tags["COMPOSER"], []string{"Someone Else"}) {
+		t.Errorf("COMPOSER = %v; unknown credits cleared another tagger's value", tags["COMPOSER"])
+	}
+
+	// The distinction has to survive the release cache, which stores re-encoded JSON.
+	fetched := decodeWorkRelease(t, workRelease)
+	encoded, _ := json.Marshal(fetched)
+	if !decodeWorkRelease(t, string(encoded)).FetchedWithRelations() {
+		t.Error("a cached release lost its relations on the round trip")
+	}
+	encoded, _ = json.Marshal(release)
+	if decodeWorkRelease(t, string(encoded)).FetchedWithRelations() {
+		t.Error("a release cached without relations gained them on the round trip")
+	}
+}
+
+// MP3 puts composer and lyricist in their standard frames and the rest in TXXX, and
+// reads all of it back — the TXXX keys upper-cased, as every description is on read.
+func TestMP3WritesWorkCreditsToTCOMAndTEXT(t *testing.T) {
+	path := writeTail(t)
+	metadata := models.FileTags{
+		Title:       "Medley",
+		WorkCredits: true,
+		Composers:   []string{"J. Smith", "K. Jones"},
+		Lyricists:   []string{"Ann Lee"},
+		Works:       []string{"First Song"},
+		MBWorkIDs:   []string{"work-1"},
+	}
+	multi := models.TaggerSettings{MP3MultiValueTags: true}
+	if _, _, _, err := SetMP3Tags(path, metadata, multi); err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tag.GetTextFrame("TCOM").Text; got != "J. Smith\x00K. Jones" {
+		t.Errorf("TCOM = %q, want two null-separated composers", got)
+	}
+	if got := tag.GetTextFrame("TEXT").Text; got != "Ann Lee" {
+		t.Errorf("TEXT = %q", got)
+	}
+	tag.Close()
+
+	tags, err := GetMP3Tags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string][]string{
+		"COMPOSER":            {"J. Smith", "K. Jones"},
+		"LYRICIST":            {"Ann Lee"},
+		"WORK":                {"First Song"},
+		"MUSICBRAINZ WORK ID": {"work-1"},
+	} {
+		if got := tags[key]; !slices.Equal(got, want) {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if unchanged, _, _, err := SetMP3Tags(path, metadata, multi); err != nil || !unchanged {
+		t.Errorf("second identical write should be a no-op, got unchanged=%v err=%v", unchanged, err)
+	}
+}
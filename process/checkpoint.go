@@ -0,0 +1,291 @@
+package process
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/google/uuid"
+)
+
+// A cold run over a big library is hours of MusicBrainz-paced work, and a run stopped
+// partway — by the Stop button, a container update, a crash — used to mean the next
+// one walked from the top. The skip-unchanged check made that cheaper than the first
+// time, not cheap: it still opens every file to find it unchanged.
+//
+// So a run keeps a checkpoint on its own event (models.RunCheckpoint): which roots it
+// finished, how far into the current one it got, which files failed on the way, and
+// what the refresh found changed upstream. A run of the same scope starting within the resume window adopts the
+// latest one and passes over what it covers. The checkpoint is adopted once — it is
+// cleared from the old row as it is taken — and a run that finishes clears its own.
+
+// checkpointFlushInterval is how often a running walk's checkpoint is written. Slower
+// than the progress bar's tick: the checkpoint is read only after the run has stopped,
+// and what a crash costs is the files done since the last write, which find themselves
+// unchanged when they are walked again.
+const checkpointFlushInterval = 10 * time.Second
+
+// resumeWindow converts the configured hours, where zero means the default and a
+// negative value turns resuming off.
+func resumeWindow(hours int) time.Duration {
+	if hours == 0 {
+		hours = models.DefaultProcessResumeHours
+	}
+	if hours < 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// scopeKey identifies what a scope covers, so a checkpoint is only picked up by a run
+// of the same thing: the libraries and roots, in an order that does not depend on how
+// the scope was built, and whether it was forced. A forced run resumed as an ordinary
+// one would skip the very files it was forced to redo.
+func scopeKey(scope Scope) string {
+	parts := make([]string, 0, len(scope.Targets))
+	for _, target := range scope.Targets {
+		roots := append([]string(nil), target.Roots...)
+		sort.Strings(roots)
+		parts = append(parts, target.Library.ID.String()+"="+strings.Join(roots, "\x00"))
+	}
+	sort.Strings(parts)
+	key := strings.Join(parts, ";")
+	if scope.Force {
+		key = "force:" + key
+	}
+	return key
+}
+
+// rootKey names one root of one library in a checkpoint.
+func rootKey(libraryID uuid.UUID, root string) string {
+	return libraryID.String() + ":" + root
+}
+
+// runCheckpoint is a run's checkpoint while the run holds it. The walk marks are live
+// (the scan's workers advance them); state holds everything else.
+type runCheckpoint struct {
+	mu    sync.Mutex
+	state models.RunCheckpoint
+	marks map[string]*modules.WalkMark
+
+	// resumedFrom is the run whose checkpoint this one adopted, or nil.
+	resumedFrom *uuid.UUID
+}
+
+// beginCheckpoint opens the checkpoint of a run about to start, adopting the latest
+// one a stopped or interrupted run of the same scope left within the resume window.
+func (r *Runner) beginCheckpoint(scope Scope, event *models.Event) *runCheckpoint {
+	cp := &runCheckpoint{
+		state: models.RunCheckpoint{Scope: scopeKey(scope)},
+		marks: map[string]*modules.WalkMark{},
+	}
+	if r.db == nil || r.resumeWindow <= 0 {
+		return cp
+	}
+
+	var candidates []models.Event
+	query := r.db.Where("type = ? AND parent_id IS NULL AND checkpoint IS NOT NULL", models.EventTypeProcess).
+		Where("status IN ?", []string{models.EventStatusCancelled, models.EventStatusResumable}).
+		Where("finished_at >= ?", time.Now().Add(-r.resumeWindow))
+	if event != nil && event.ID != uuid.Nil {
+		query = query.Where("id <> ?", event.ID)
+	}
+	if err := query.Order("finished_at desc").Find(&candidates).Error; err != nil {
+		logger.Log.Warnf("failed to look for a run to resume: %s", err.Error())
+		return cp
+	}
+	for _, candidate := range candidates {
+		if candidate.Checkpoint == nil || candidate.Checkpoint.Scope != cp.state.Scope {
+			continue
+		}
+		// Taken, not copied: a second run must not resume the same checkpoint, and
+		// this run writes its own as soon as it starts.
+		if err := r.saveCheckpoint(candidate.ID, nil); err != nil {
+			logger.Log.Warnf("failed to take the checkpoint of run %s: %s", candidate.ID, err.Error())
+			return cp
+		}
+		cp.state = *candidate.Checkpoint
+		id := candidate.ID
+		cp.resumedFrom = &id
+		retry := 0
+		for _, paths := range cp.state.Retry {
+			retry += len(paths)
+		}
+		logger.Log.Infof("resuming from run %s (%q): %d root(s) done, %d part-way, %d file(s) to retry",
+			candidate.ID, candidate.Title, len(cp.state.Done), len(cp.state.Reached), retry)
+		break
+	}
+	return cp
+}
+
+// saveCheckpoint writes checkpoint onto a run's row; nil clears it.
+func (r *Runner) saveCheckpoint(eventID uuid.UUID, checkpoint *models.RunCheckpoint) error {
+	return r.db.Model(&models.Event{}).Where("id = ?", eventID).
+		Select("checkpoint").Updates(&models.Event{Checkpoint: checkpoint}).Error
+}
+
+// startCheckpoint writes the run's checkpoint now and then on a ticker until the
+// returned stop func is called, which writes it once more. Like events.StartProgress,
+// it must be stopped before the run's event is finished.
+func (r *Runner) startCheckpoint(event *models.Event, cp *runCheckpoint) (stop func()) {
+	if r.db == nil || event == nil || event.ID == uuid.Nil {
+		return func() {}
+	}
+	flush := func() {
+		if err := r.saveCheckpoint(event.ID, cp.snapshot()); err != nil {
+			logger.Log.Warnf("failed to record the run's checkpoint: %s", err.Error())
+		}
+	}
+	flush()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(checkpointFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			flush()
+		})
+	}
+}
+
+// walkStarted is when the walk began: now for a fresh run, the first run's start for
+// a resumed one.
+func (cp *runCheckpoint) walkStarted(now time.Time) time.Time {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.state.WalkStarted.IsZero() {
+		cp.state.WalkStarted = now
+	}
+	return cp.state.WalkStarted
+}
+
+// addDrift records the releases a refresh found changed upstream and returns every
+// one still to be re-tagged, the adopted run's included.
+func (cp *runCheckpoint) addDrift(releases []string) []string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	seen := map[string]bool{}
+	var all []string
+	for _, list := range [][]string{cp.state.Drift, releases} {
+		for _, mbID := range list {
+			if !seen[mbID] {
+				seen[mbID] = true
+				all = append(all, mbID)
+			}
+		}
+	}
+	sort.Strings(all)
+	cp.state.Drift = all
+	return append([]string(nil), all...)
+}
+
+// remaining is the roots of a library still to walk.
+func (cp *runCheckpoint) remaining(libraryID uuid.UUID, roots []string) []string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	var out []string
+	for _, root := range roots {
+		if !slices.Contains(cp.state.Done, rootKey(libraryID, root)) {
+			out = append(out, root)
+		}
+	}
+	return out
+}
+
+// mark is a root's walk mark, started from where the adopted run got to and carrying
+// the files it failed. From here the mark holds those; snapshot reads them back.
+func (cp *runCheckpoint) mark(libraryID uuid.UUID, root string) *modules.WalkMark {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	key := rootKey(libraryID, root)
+	if m, ok := cp.marks[key]; ok {
+		return m
+	}
+	m := modules.NewWalkMark(cp.state.Reached[key], cp.state.Retry[key]...)
+	delete(cp.state.Retry, key)
+	cp.marks[key] = m
+	return m
+}
+
+// walkMarks is the marks for roots, keyed as components.ScanLibraryRoots takes them.
+func (cp *runCheckpoint) walkMarks(libraryID uuid.UUID, roots []string) map[string]*modules.WalkMark {
+	marks := make(map[string]*modules.WalkMark, len(roots))
+	for _, root := range roots {
+		marks[root] = cp.mark(libraryID, root)
+	}
+	return marks
+}
+
+// finish records a library's roots as walked to the end. A root with files that
+// failed is not done: it stays part-way, at its last file, so a resumed run walks it
+// for those files and nothing else.
+func (cp *runCheckpoint) finish(libraryID uuid.UUID, roots []string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for _, root := range roots {
+		key := rootKey(libraryID, root)
+		m := cp.marks[key]
+		delete(cp.marks, key)
+		if retry := m.Retry(); len(retry) > 0 {
+			if cp.state.Reached == nil {
+				cp.state.Reached = map[string]string{}
+			}
+			if cp.state.Retry == nil {
+				cp.state.Retry = map[string][]string{}
+			}
+			cp.state.Reached[key] = m.Reached()
+			cp.state.Retry[key] = retry
+			continue
+		}
+		if !slices.Contains(cp.state.Done, key) {
+			cp.state.Done = append(cp.state.Done, key)
+		}
+		delete(cp.state.Reached, key)
+		delete(cp.state.Retry, key)
+	}
+}
+
+// snapshot is the checkpoint as it stands, with the live marks read in.
+func (cp *runCheckpoint) snapshot() *models.RunCheckpoint {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	out := cp.state
+	out.Done = append([]string(nil), cp.state.Done...)
+	out.Drift = append([]string(nil), cp.state.Drift...)
+	out.Reached = map[string]string{}
+	for key, after := range cp.state.Reached {
+		out.Reached[key] = after
+	}
+	out.Retry = map[string][]string{}
+	for key, paths := range cp.state.Retry {
+		out.Retry[key] = append([]string(nil), paths...)
+	}
+	for key, m := range cp.marks {
+		if reached := m.Reached(); reached != "" {
+			out.Reached[key] = reached
+		}
+		if retry := m.Retry(); len(retry) > 0 {
+			out.Retry[key] = retry
+		}
+	}
+	return &out
+}
@@ -0,0 +1,167 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/database"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/google/uuid"
+)
+
+// A run stopped partway leaves a checkpoint, and the next run of the same scope walks
+// only what it did not get to: not the library it finished, not the file it reached.
+// The checkpoint is used once — the run after that walks everything again.
+func TestTheNextRunOfAScopePicksUpItsCheckpoint(t *testing.T) {
+	finished, partial := t.TempDir(), t.TempDir()
+	for _, path := range []string{
+		filepath.Join(finished, "01.flac"),
+		filepath.Join(partial, "01.flac"),
+		filepath.Join(partial, "02.flac"),
+	} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	first := models.Library{Name: "Finished", Path: finished, Enabled: true}
+	second := models.Library{Name: "Partial", Path: partial, Enabled: true}
+	for _, library := range []*models.Library{&first, &second} {
+		if err := db.Create(library).Error; err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+	}
+	scope := LibraryScope([]models.Library{first, second})
+
+	stopped := events.Begin(db, models.EventTypeProcess, scope.Title)
+	stopped.Checkpoint = &models.RunCheckpoint{
+		Scope:       scopeKey(scope),
+		WalkStarted: time.Now().Add(-time.Hour),
+		Done:        []string{rootKey(first.ID, finished)},
+		Reached:     map[string]string{rootKey(second.ID, partial): filepath.Join(partial, "01.flac")},
+	}
+	events.Finish(db, stopped, models.EventStatusCancelled, "stopped", nil)
+
+	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
+	latestRun := func() (run models.Event, files any) {
+		t.Helper()
+		if err := db.Where("type = ? AND parent_id IS NULL", models.EventTypeProcess).
+			Order("started_at desc").First(&run).Error; err != nil {
+			t.Fatalf("load the run: %v", err)
+		}
+		var count models.Event
+		if err := db.Where("type = ? AND parent_id = ?", models.EventTypeCountFiles, run.ID).First(&count).Error; err != nil {
+			t.Fatalf("load the count stage: %v", err)
+		}
+		return run, count.Details["files"]
+	}
+
+	r.runScope(context.Background(), scope)
+	run, files := latestRun()
+	if run.Details["resumed_from"] != stopped.ID.String() {
+		t.Errorf("resumed_from = %v, want the stopped run %s", run.Details["resumed_from"], stopped.ID)
+	}
+	if files != float64(1) {
+		t.Errorf("counted %v file(s), want only the one the stopped run did not reach", files)
+	}
+	if run.Checkpoint != nil {
+		t.Error("a finished run kept a checkpoint")
+	}
+	if err := db.First(&stopped, "id = ?", stopped.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stopped.Checkpoint != nil {
+		t.Error("the stopped run's checkpoint was left to be resumed again")
+	}
+	for _, library := range []*models.Library{&first, &second} {
+		if err := db.First(library, "id = ?", library.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.LastScan != nil {
+		t.Error("the library the stopped run finished was walked again")
+	}
+	if second.LastScan == nil {
+		t.Error("the library the resumed run finished was not marked scanned")
+	}
+
+	time.Sleep(10 * time.Millisecond) // so the next run sorts after this one
+	r.runScope(context.Background(), scope)
+	if run, files := latestRun(); run.Details["resumed_from"] != nil || files != float64(3) {
+		t.Errorf("the run after: resumed_from = %v, counted %v; want a fresh walk of all 3 files",
+			run.Details["resumed_from"], files)
+	}
+}
+
+func TestScopeKeyIgnoresOrderButNotForce(t *testing.T) {
+	a := models.Library{Name: "A"}
+	b := models.Library{Name: "B"}
+	a.ID, b.ID = uuid.New(), uuid.New()
+	one := Scope{Targets: []Target{{Library: a, Roots: []string{"/x", "/y"}}, {Library: b}}}
+	other := Scope{Targets: []Target{{Library: b}, {Library: a, Roots: []string{"/y", "/x"}}}}
+	if scopeKey(one) != scopeKey(other) {
+		t.Errorf("the same scope built in another order keyed differently: %q, %q", scopeKey(one), scopeKey(other))
+	}
+	other.Force = true
+	if scopeKey(one) == scopeKey(other) {
+		t.Error("a forced scope keyed the same as an ordinary one")
+	}
+}
+
+// A root whose walk reached the end with a failure is not done: the checkpoint keeps it
+// part-way, with the file listed, so a resumed run processes that file again and
+// reports it, rather than passing over it as finished.
+func TestACheckpointKeepsTheFilesThatFailed(t *testing.T) {
+	root := t.TempDir()
+	good, bad := filepath.Join(root, "01.flac"), filepath.Join(root, "02.flac")
+	for _, path := range []string{good, bad} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libraryID := uuid.New()
+	cp := &runCheckpoint{marks: map[string]*modules.WalkMark{}}
+	failBad := func(path string) (bool, int, error) {
+		if path == bad {
+			return false, 0, errors.New("unreadable")
+		}
+		return true, 0, nil
+	}
+	if _, _, _, _, err := modules.WalkAndProcess(context.Background(), root, cp.mark(libraryID, root), modules.WalkLimits{Workers: 1}, failBad, nil); err != nil {
+		t.Fatal(err)
+	}
+	key := rootKey(libraryID, root)
+	if retry := cp.snapshot().Retry[key]; len(retry) != 1 || retry[0] != bad {
+		t.Errorf("mid-run checkpoint retry = %v, want the failed file", retry)
+	}
+
+	cp.finish(libraryID, []string{root})
+	state := cp.snapshot()
+	if len(cp.remaining(libraryID, []string{root})) != 1 || state.Reached[key] != bad || len(state.Retry[key]) != 1 {
+		t.Fatalf("finished with a failure: done %v, reached %v, retry %v", state.Done, state.Reached, state.Retry)
+	}
+
+	// Picked up by the next run, the root is walked for the failed file alone.
+	resumed := &runCheckpoint{state: *state, marks: map[string]*modules.WalkMark{}}
+	var seen []string
+	_, _, _, errs, err := modules.WalkAndProcess(context.Background(), root, resumed.mark(libraryID, root), modules.WalkLimits{Workers: 1}, func(path string) (bool, int, error) {
+		seen = append(seen, path)
+		return failBad(path)
+	}, nil)
+	if err != nil || len(seen) != 1 || seen[0] != bad || len(errs) != 1 {
+		t.Errorf("resumed walk visited %v and reported %v (err %v), want the failed file, failing again", seen, errs, err)
+	}
+	resumed.finish(libraryID, []string{root})
+	if retry := resumed.snapshot().Retry[key]; len(retry) != 1 {
+		t.Errorf("a file that failed again was dropped from the retry list: %v", retry)
+	}
+}
@@ -0,0 +1,282 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/google/uuid"
+)
+
+// DryRun asks a run to work out what it would write and write nothing. Where a verb
+// takes one, nil is the real run.
+//
+// A dry run correlates every file and diffs it against the tags it would be given,
+// and that is all: no file is written, no index row recorded, nothing journaled,
+// Plex not told, and none of a run's other stages — refresh, drift, migrations, the
+// collection — happen. What it leaves behind is one Activity event listing each file
+// that would change, with the changes, and a count per tag.
+type DryRun struct {
+	// TaggerProfileID tries a profile the libraries are not set to yet: every library
+	// in the run is previewed as though it used this one. Nil previews each library
+	// with its own.
+	TaggerProfileID *uuid.UUID
+	// ProfileName names it in the event's title. Filled in when the run is queued.
+	ProfileName string
+}
+
+// key is the part of a job key that tells one dry run from another over the same
+// scope: a dry run with a profile and one without are different questions.
+func (d *DryRun) key() string {
+	if d == nil || d.TaggerProfileID == nil {
+		return ""
+	}
+	return dryRunProfileKey + d.TaggerProfileID.String()
+}
+
+// dryRunProfileKey separates a dry run's scope from its profile in a job key.
+const dryRunProfileKey = "?profile="
+
+// splitDryRunKey is key's inverse, for replaying a stored job.
+func splitDryRunKey(rest string) (string, *DryRun, error) {
+	subject, raw, found := strings.Cut(rest, dryRunProfileKey)
+	dry := &DryRun{}
+	if found {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return "", nil, err
+		}
+		dry.TaggerProfileID = &id
+	}
+	return subject, dry, nil
+}
+
+// title is what the event and the queue entry call the dry run of title.
+func (d *DryRun) title(title string) string {
+	if d.ProfileName != "" {
+		return fmt.Sprintf("Dry run: %s, with profile %s", title, d.ProfileName)
+	}
+	return "Dry run: " + title
+}
+
+// library is the library as the dry run sees it: with the profile being tried, when
+// there is one. A copy, so nothing about the library itself changes.
+func (d *DryRun) library(library models.Library) models.Library {
+	if d.TaggerProfileID != nil {
+		id := *d.TaggerProfileID
+		library.TaggerProfileID = &id
+	}
+	return library
+}
+
+// prepareDryRun loads the profile a dry run is to try, so an unknown one is refused
+// when it is asked for rather than found missing when the job runs, and names it.
+func (r *Runner) prepareDryRun(dry *DryRun) error {
+	if dry.TaggerProfileID == nil {
+		return nil
+	}
+	var profile models.TaggerProfile
+	if err := r.db.Select("name").First(&profile, "id = ?", *dry.TaggerProfileID).Error; err != nil {
+		return err
+	}
+	dry.ProfileName = profile.Name
+	return nil
+}
+
+// dryRunScope is runScope's dry run: the scope's files walked, each correlated and
+// diffed (components.PreviewFile), and the event recorded.
+func (r *Runner) dryRunScope(ctx context.Context, scope Scope, dry DryRun) {
+	r.resetProgress()
+	event := events.Begin(r.db, models.EventTypeDryRun, dry.title(scope.Title))
+	stopProgress := events.StartProgress(r.db, event, r.progressSnapshot)
+
+	r.setPhase(PhaseCounting)
+	total := 0
+	for _, target := range scope.Targets {
+		roots := target.Roots
+		if len(roots) == 0 {
+			roots = []string{target.Library.Path}
+		}
+		for _, root := range roots {
+			total += modules.CountRemainingFiles(root, nil)
+		}
+	}
+	r.progTotal.Store(int64(total))
+
+	r.setPhase(PhaseScanning)
+	detail := newDryRunDetail()
+	var processed, unchanged int
+	var errorFiles []string
+	libraryNames := make([]string, 0, len(scope.Targets))
+	for _, target := range scope.Targets {
+		library := dry.library(target.Library)
+		libraryNames = append(libraryNames, library.Name)
+		root := library.Path
+		onFile := func(path string) {
+			r.progDone.Add(1)
+			if a := artistFromPath(root, path); a != "" {
+				r.setCurrent(a)
+			}
+		}
+		c, u, _, errs, err := components.PreviewLibraryRoots(ctx, r.db, library, target.Roots, detail, r.walkLimits(library), onFile)
+		processed += c
+		unchanged += u
+		errorFiles = append(errorFiles, errs...)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			logger.Log.Errorf("dry run failed for library '%s'. error: %s", library.Path, err.Error())
+		}
+	}
+	stopProgress()
+
+	details := map[string]any{"libraries": libraryNames}
+	for k, v := range scope.Detail {
+		details[k] = v
+	}
+	r.finishDryRun(ctx, event, dry, detail, processed, unchanged, errorFiles, details)
+}
+
+// dryRunRetagAllNow is retagAllNow's dry run: every taggable indexed file, from the
+// correlation the index holds, diffed against what it would be given.
+func (r *Runner) dryRunRetagAllNow(ctx context.Context, dry DryRun) {
+	var libraries []models.Library
+	if err := r.db.Where("enabled = ?", true).Order("name").Find(&libraries).Error; err != nil {
+		logger.Log.Error("failed to load libraries from database. error: " + err.Error())
+		return
+	}
+	if len(libraries) == 0 {
+		logger.Log.Info("no enabled libraries configured; nothing to preview")
+		return
+	}
+	byID := make(map[uuid.UUID]models.Library, len(libraries))
+	ids := make([]uuid.UUID, 0, len(libraries))
+	names := make([]string, 0, len(libraries))
+	for _, library := range libraries {
+		byID[library.ID] = dry.library(library)
+		ids = append(ids, library.ID)
+		names = append(names, library.Name)
+	}
+
+	var items []models.LibraryItem
+	if err := r.db.Where("library_id IN ?", ids).Scopes(models.TaggableItems).
+		Order("path").Find(&items).Error; err != nil {
+		logger.Log.Warnf("failed to load items for a collection-wide dry run: %s", err.Error())
+		return
+	}
+
+	r.resetProgress()
+	event := events.Begin(r.db, models.EventTypeDryRun, dry.title("Tag files in every library"))
+	r.progTotal.Store(int64(len(items)))
+	r.setPhase(PhaseScanning)
+	stopProgress := events.StartProgress(r.db, event, r.progressSnapshot)
+
+	detail := newDryRunDetail()
+	taggers := map[uuid.UUID]*components.Tagger{}
+	var processed, unchanged int
+	var errorFiles []string
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		r.progDone.Add(1)
+		processed++
+		library := byID[item.LibraryID]
+		tagger, ok := taggers[library.ID]
+		if !ok {
+			tagger = components.TaggerForLibrary(r.db, library)
+			taggers[library.ID] = tagger
+		}
+		// The same two passes retagItem makes: a profile that writes nothing, and a
+		// file with no correlation to write from.
+		if !tagger.WriteEnabled() || item.MBReleaseID == "" {
+			unchanged++
+			continue
+		}
+		correlation := models.Correlation{
+			MBReleaseID:      item.MBReleaseID,
+			MBReleaseTrackID: item.MBReleaseTrackID,
+			MBRecordingID:    item.MBRecordingID,
+			Source:           item.CorrelationSource,
+		}
+		changes, err := modules.PreviewResolvedFile(item.Path, correlation, library.Path, tagger.ItemSettings(item))
+		switch {
+		case err != nil:
+			errorFiles = append(errorFiles, item.Path)
+			detail.AddError(item.Path, err)
+		case len(changes) == 0:
+			unchanged++
+		default:
+			detail.AddWouldChange(item.Path, changes)
+		}
+	}
+	stopProgress()
+
+	r.finishDryRun(ctx, event, dry, detail, processed, unchanged, errorFiles, map[string]any{
+		"libraries":      names,
+		"files_in_scope": len(items),
+	})
+}
+
+// newDryRunDetail is the collector a dry run reports into. It keeps every row, where a
+// run keeps the first few hundred: a run's rows are a side report of work done, but a
+// dry run's are the whole of what it produced, and the download of them is only worth
+// having complete. They go when the event is pruned, like any run's.
+func newDryRunDetail() *components.DetailCollector {
+	return components.NewDetailCollector(math.MaxInt)
+}
+
+// finishDryRun records a dry run's outcome: the counters, the per-tag summary, and a
+// row for every file that would change or could not be previewed.
+func (r *Runner) finishDryRun(ctx context.Context, event *models.Event, dry DryRun, detail *components.DetailCollector, processed, unchanged int, errorFiles []string, details map[string]any) {
+	wouldChange, _ := detail.Totals()
+	tagSummary := detail.TagSummary()
+
+	summary := fmt.Sprintf("%d of %d files would change · %d errors", wouldChange, processed, len(errorFiles))
+	if len(tagSummary) > 0 {
+		top := tagSummary[0]
+		summary += fmt.Sprintf(" · %s changes on %d file%s", top.Field, top.Files, plural(top.Files, "", "s"))
+	}
+	status := models.EventStatusOK
+	switch {
+	case ctx.Err() != nil:
+		status = models.EventStatusCancelled
+		summary = cancelledPrefix + summary
+	case len(errorFiles) > 0:
+		status = models.EventStatusError
+	}
+	logger.Log.Infof("dry run finished. %s", summary)
+
+	recorded := errorFiles
+	if len(recorded) > maxErrorFilesRecorded {
+		recorded = recorded[:maxErrorFilesRecorded]
+	}
+	details["dry_run"] = true
+	details["processed"] = processed
+	details["unchanged"] = unchanged
+	details["would_change"] = wouldChange
+	details["errors"] = len(errorFiles)
+	details["error_files"] = recorded
+	details["tag_summary"] = tagSummary
+	details["detail"] = detailSummary(detail)
+	if dry.TaggerProfileID != nil {
+		details["tagger_profile_id"] = dry.TaggerProfileID.String()
+		details["tagger_profile"] = dry.ProfileName
+	}
+	event.Stats = []models.EventStat{
+		{Label: "Files checked", Value: processed},
+		{Label: "Would change", Value: wouldChange, Kind: models.EventStatNotable, Filter: models.EventItemStatusWouldChange},
+		{Label: "Unchanged", Value: unchanged, Kind: models.EventStatMuted},
+		{Label: "Failed", Value: len(errorFiles), Kind: models.EventStatBad, Filter: models.EventItemStatusError},
+	}
+	events.Finish(r.db, event, status, summary, details)
+	events.AddItems(r.db, event, detail.Items())
+	events.Prune(r.db, r.eventRetention)
+}
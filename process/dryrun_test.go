@@ -0,0 +1,129 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// dryRunFixture is retagFixture on a FLAC the tag engine can read without the audio
+// tools: an untagged file, correlated to a cached release, in a library whose profile
+// writes.
+func dryRunFixture(t *testing.T) (*Runner, models.LibraryItem) {
+	t.Helper()
+	path := bareFlac(t)
+	db := newTestDB(t)
+	seedReleaseCache(t, db, models.MusicBrainzReleaseResponse{
+		ID: "rel-1", Title: "Album",
+		ArtistCredit: []models.ArtistCredit{{Name: "Band", Artist: models.Artist{ID: "art-1", Name: "Band"}}},
+		ReleaseGroup: models.ReleaseGroup{ID: "rg-1", Title: "Album", PrimaryType: "Album"},
+		Media: []models.MusicBrainzMedia{{
+			Position: 1,
+			Tracks:   []models.Track{{ID: "trk-1", Title: "Song", Position: 1, Number: "1"}},
+		}},
+	})
+	profile := models.TaggerProfile{Name: "Write", WriteTags: true}
+	if err := db.Create(&profile).Error; err != nil {
+		t.Fatal(err)
+	}
+	lib := models.Library{Name: "L", Path: filepath.Dir(path), Enabled: true, TaggerProfileID: &profile.ID}
+	if err := db.Create(&lib).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := models.LibraryItem{
+		LibraryID: lib.ID, Path: path,
+		MBReleaseID: "rel-1", MBReleaseTrackID: "trk-1", MBRecordingID: "rec-1",
+		Status: models.LibraryItemStatusOK,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	return NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"}), item
+}
+
+// TestDryRunRetagAllWritesNothing runs Tag files dry over an untagged file: the file
+// and its index row are left exactly as they were, nothing is journaled, and the
+// event lists the file as one that would change, with its changes and a count per tag.
+func TestDryRunRetagAllWritesNothing(t *testing.T) {
+	r, item := dryRunFixture(t)
+	before, err := os.ReadFile(item.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.dryRunRetagAllNow(context.Background(), DryRun{})
+
+	after, err := os.ReadFile(item.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("a dry run wrote to the file")
+	}
+	var reloaded models.LibraryItem
+	if err := r.db.First(&reloaded, "id = ?", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.ProcessedVersion != "" || !reloaded.UpdatedAt.Equal(item.UpdatedAt) {
+		t.Errorf("a dry run touched the index row: version %q, updated %v", reloaded.ProcessedVersion, reloaded.UpdatedAt)
+	}
+	var journaled int64
+	r.db.Model(&models.TagJournalEntry{}).Count(&journaled)
+	if journaled != 0 {
+		t.Errorf("a dry run journaled %d writes it did not make", journaled)
+	}
+
+	var ev models.Event
+	if err := r.db.Where("type = ?", models.EventTypeDryRun).First(&ev).Error; err != nil {
+		t.Fatalf("no dry run event: %v", err)
+	}
+	if ev.Status != models.EventStatusOK || ev.Title != "Dry run: Tag files in every library" {
+		t.Errorf("event = %q %q (%s), want an ok dry run of Tag files", ev.Status, ev.Title, ev.Summary)
+	}
+	items, err := events.Items(r.db, ev.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Status != models.EventItemStatusWouldChange || len(items[0].Changes) == 0 {
+		t.Fatalf("rows = %+v, want the file as one that would change, with its changes", items)
+	}
+	summary, ok := ev.Details["tag_summary"].([]any)
+	if !ok || len(summary) == 0 {
+		t.Fatalf("tag_summary = %#v, want a count per tag", ev.Details["tag_summary"])
+	}
+	if len(summary) != len(items[0].Changes) {
+		t.Errorf("tag_summary has %d tags, the one file %d changes", len(summary), len(items[0].Changes))
+	}
+}
+
+// TestDryRunTriesAnotherProfile previews with a profile the library does not use: one
+// that writes nothing, so nothing would change — where the library's own would.
+func TestDryRunTriesAnotherProfile(t *testing.T) {
+	r, _ := dryRunFixture(t)
+	off := models.TaggerProfile{Name: "Off"}
+	if err := r.db.Create(&off).Error; err != nil {
+		t.Fatal(err)
+	}
+	dry := &DryRun{TaggerProfileID: &off.ID}
+	if err := r.prepareDryRun(dry); err != nil {
+		t.Fatal(err)
+	}
+
+	r.dryRunRetagAllNow(context.Background(), *dry)
+
+	var ev models.Event
+	if err := r.db.Where("type = ?", models.EventTypeDryRun).First(&ev).Error; err != nil {
+		t.Fatalf("no dry run event: %v", err)
+	}
+	if ev.Title != "Dry run: Tag files in every library, with profile Off" {
+		t.Errorf("title = %q, want the profile named", ev.Title)
+	}
+	if ev.Details["would_change"] != float64(0) || ev.Details["tagger_profile"] != "Off" {
+		t.Errorf("details = %v, want nothing to change under the profile tried", ev.Details)
+	}
+}
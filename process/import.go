@@ -0,0 +1,366 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/inbox"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/rename"
+	"github.com/google/uuid"
+)
+
+// ErrNoInbox refuses an import into a library with no inbox folder set.
+var ErrNoInbox = errors.New("this library has no inbox folder")
+
+// ImportLibrary queues an import of the library's inbox. Like RenameLibrary it answers
+// an unknown library, a Lidarr-managed one and one with no inbox now, and moves files
+// on the queue worker as a file-writing job.
+func (r *Runner) ImportLibrary(libraryID uuid.UUID) error {
+	j, err := r.importJob(libraryID)
+	if err != nil {
+		return err
+	}
+	r.enqueue(j)
+	return nil
+}
+
+func (r *Runner) importJob(libraryID uuid.UUID) (job, error) {
+	library, _, err := r.importTarget(libraryID)
+	if err != nil {
+		return job{}, err
+	}
+	return job{jobImportLibrary, "import_library:" + libraryID.String(), "Import files into " + library.Name, func(ctx context.Context) {
+		r.importLibraryNow(ctx, libraryID)
+	}}, nil
+}
+
+// importTarget loads a library and the template its imports are laid out by,
+// refusing what cannot be imported into.
+func (r *Runner) importTarget(libraryID uuid.UUID) (models.Library, rename.Template, error) {
+	var library models.Library
+	if err := r.db.First(&library, "id = ?", libraryID).Error; err != nil {
+		return models.Library{}, rename.Template{}, err
+	}
+	manager, _, err := components.BuildForLibrary(r.db, library)
+	if err != nil {
+		return models.Library{}, rename.Template{}, err
+	}
+	if manager.Type() != models.ManagerTypeAutotaggerr {
+		return models.Library{}, rename.Template{}, ErrNotNativeManaged
+	}
+	if strings.TrimSpace(library.InboxPath) == "" {
+		return models.Library{}, rename.Template{}, ErrNoInbox
+	}
+	spec := library.NamingTemplate
+	if strings.TrimSpace(spec) == "" {
+		spec = rename.DefaultTemplate
+	}
+	t, err := rename.Parse(spec)
+	if err != nil {
+		return models.Library{}, rename.Template{}, fmt.Errorf("the naming template is invalid: %w", err)
+	}
+	return library, t, nil
+}
+
+// importIdentifier is what the library's imports identify files with: the runner's
+// metadata source, and AcoustID when all three of its switches are on.
+func (r *Runner) importIdentifier(library models.Library) inbox.Identifier {
+	id := inbox.Identifier{GetRelease: r.meta.GetRelease}
+	source, ok := components.AcoustIDSource(r.db)
+	if !ok || source.APIKey == "" || !library.UseAcoustID || !modules.FpcalcAvailable() {
+		return id
+	}
+	id.Fingerprint = func(path string) ([]modules.RankedCandidate, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		return modules.IdentifyFile(path, source.APIKey, source.BaseURL, info.Size(), info.ModTime())
+	}
+	return id
+}
+
+// importLibraryNow runs one import. Every inbox file gets an index row: an identified
+// one with its correlation, pinned, moved (or copied) into the library by the template
+// and then tagged; an unidentified one left where it is as an unmatched item, with the
+// reason as its error, which is where the attach flow finds it. A file attached by
+// hand there is placed by the next import without being identified again.
+func (r *Runner) importLibraryNow(ctx context.Context, libraryID uuid.UUID) {
+	library, t, err := r.importTarget(libraryID)
+	if err != nil {
+		logger.Log.Warnf("import skipped for library %s: %s", libraryID, err.Error())
+		return
+	}
+	copyMode := library.ImportMode == models.ImportModeCopy
+	details := map[string]any{
+		"library":    library.Name,
+		"library_id": libraryID.String(),
+		"inbox":      library.InboxPath,
+	}
+
+	event := events.Begin(r.db, models.EventTypeImport, "Import files into "+library.Name)
+	r.holdEvent = event
+	defer func() { r.holdEvent = nil }()
+
+	groups, err := inbox.Files(library.InboxPath)
+	if err != nil {
+		logger.Log.Warnf("failed to read the inbox of %s: %s", library.Name, err.Error())
+		events.Finish(r.db, event, models.EventStatusError, "Could not read the inbox: "+err.Error(), details)
+		return
+	}
+
+	var known []models.LibraryItem
+	if err := r.db.Where("library_id = ?", libraryID).Find(&known).Error; err != nil {
+		events.Finish(r.db, event, models.EventStatusError, "Could not load the library's items: "+err.Error(), details)
+		return
+	}
+	byPath := map[string]models.LibraryItem{}
+	for _, item := range known {
+		if pathInScope(item.Path, []string{library.InboxPath}) {
+			byPath[item.Path] = item
+		}
+	}
+
+	identifier := r.importIdentifier(library)
+	var placing []models.LibraryItem
+	var rows []models.EventItem
+	alreadyImported, unidentified, cancelled := 0, 0, false
+	for _, folder := range sortedKeys(groups) {
+		if ctx.Err() != nil || r.holdForQuietHours(ctx) != nil {
+			cancelled = true
+			break
+		}
+		var fresh []string
+		for _, path := range groups[folder] {
+			if copyMode && r.alreadyImported(path) {
+				alreadyImported++
+				continue
+			}
+			// Attached by hand since the last import: that answer stands.
+			if item, ok := byPath[path]; ok && item.Pinned && item.MBReleaseTrackID != "" {
+				placing = append(placing, item)
+				continue
+			}
+			fresh = append(fresh, path)
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		for _, res := range identifier.Folder(fresh) {
+			item, err := r.indexInboxFile(library, byPath[res.Path], res)
+			if err != nil {
+				logger.Log.Errorf("failed to index inbox file %s: %s", res.Path, err.Error())
+				rows = append(rows, models.EventItem{Kind: models.EventItemKindImport, Path: res.Path, Status: models.EventItemStatusError, Error: err.Error()})
+				continue
+			}
+			if !res.Identified() {
+				unidentified++
+				rows = append(rows, models.EventItem{Kind: models.EventItemKindImport, Path: res.Path, Status: models.EventItemStatusUnidentified, Error: res.Reason})
+				continue
+			}
+			placing = append(placing, item)
+		}
+	}
+	logger.Log.Infof("importing %d files into library: %s", len(placing), library.Name)
+
+	_, tagger, err := components.BuildForLibrary(r.db, library)
+	if err != nil {
+		events.AddItems(r.db, event, rows)
+		events.Finish(r.db, event, models.EventStatusError, "Could not load the library's tagger: "+err.Error(), details)
+		return
+	}
+	settings := tagger.Settings()
+	plan := rename.Build(library.Path, t, placing, func(item models.LibraryItem) (models.FileTags, error) {
+		tags, _, _, err := components.DesiredTags(r.meta, settings, item)
+		return tags, err
+	})
+	res := rename.Apply(ctx, r.db, plan, rename.Options{
+		Root: library.InboxPath,
+		Copy: copyMode,
+		Kind: models.EventItemKindImport,
+		Done: models.EventItemStatusImported,
+		Hold: r.holdForQuietHours,
+	})
+	cancelled = cancelled || res.Cancelled
+	rows = append(rows, res.Items...)
+	r.holdBackUnplaced(plan, res)
+
+	// Tagged after the move, not before: in copy mode the inbox original is somebody
+	// else's file, and only the library's copy is ours to write.
+	var doneIDs []uuid.UUID
+	for _, m := range res.Done {
+		doneIDs = append(doneIDs, m.ItemID)
+		if copyMode {
+			r.recordImported(library, m)
+		}
+	}
+	refreshSet := modules.NewAlbumRefreshSet(nil)
+	detail := r.newDetail(event)
+	tagged := releaseRefresh{}
+	if len(doneIDs) > 0 {
+		var imported []models.LibraryItem
+		if err := r.db.Where("id IN ?", doneIDs).Order("path").Find(&imported).Error; err != nil {
+			logger.Log.Warnf("failed to reload the imported items of %s: %s", library.Name, err.Error())
+		}
+		tagged.retagItems(ctx, r, imported, map[uuid.UUID]models.Library{}, refreshSet, detail)
+		cancelled = cancelled || tagged.cancelled
+	}
+	r.flushPlex(refreshSet, event)
+	events.AddItems(r.db, event, append(rows, detail.Items()...))
+
+	if res.Moved > 0 {
+		r.rebuildCollection(event)
+	}
+
+	summary := fmt.Sprintf("%d files imported · %d unidentified · %d skipped · %d failed", res.Moved, unidentified, res.Skipped, res.Failed)
+	status := models.EventStatusOK
+	switch {
+	case cancelled:
+		status = models.EventStatusCancelled
+		summary += " · stopped early"
+	case res.Failed > 0 || len(tagged.errorFiles) > 0:
+		status = models.EventStatusError
+	}
+	logger.Log.Infof("import finished for %s. %s", library.Name, summary)
+	event.Stats = []models.EventStat{
+		{Label: "Imported", Value: res.Moved, Kind: models.EventStatNotable, Filter: models.EventItemStatusImported},
+		{Label: "Unidentified", Value: unidentified, Filter: models.EventItemStatusUnidentified},
+		{Label: "Skipped", Value: res.Skipped, Filter: models.EventItemStatusSkipped},
+		{Label: "Failed", Value: res.Failed + len(tagged.errorFiles), Kind: models.EventStatBad, Filter: models.EventItemStatusError},
+	}
+	if copyMode {
+		event.Stats = append(event.Stats, models.EventStat{Label: "Already imported", Value: alreadyImported, Kind: models.EventStatMuted})
+	}
+	details["mode"] = library.ImportMode
+	details["imported"] = res.Moved
+	details["unidentified"] = unidentified
+	details["skipped"] = res.Skipped
+	details["failed"] = res.Failed
+	details["tag_errors"] = len(tagged.errorFiles)
+	details["already_imported"] = alreadyImported
+	details["files_carried"] = res.CarriedPaths()
+	details["folders_removed"] = res.FoldersRemoved
+	details["folders_kept"] = res.FoldersKept
+	details["cancelled"] = cancelled
+	events.Finish(r.db, event, status, summary, details)
+}
+
+// indexInboxFile writes an inbox file's row: its identification, or the reason there
+// is none. The row is created on first sight and updated after, so a file that stays
+// unidentified is one item however many imports look at it.
+func (r *Runner) indexInboxFile(library models.Library, item models.LibraryItem, res inbox.Result) (models.LibraryItem, error) {
+	now := time.Now()
+	if item.ID == uuid.Nil {
+		item = models.LibraryItem{LibraryID: library.ID, Path: res.Path}
+	}
+	if info, err := os.Stat(res.Path); err == nil {
+		mod := info.ModTime()
+		item.Size = info.Size()
+		item.ModTime = &mod
+	}
+	item.LastScannedAt = &now
+	if res.Identified() {
+		item.MBReleaseID = res.Correlation.MBReleaseID
+		item.MBReleaseTrackID = res.Correlation.MBReleaseTrackID
+		item.MBRecordingID = res.Correlation.MBRecordingID
+		item.CorrelationSource = res.Correlation.Source
+		item.CorrelatedByManager = models.ManagerTypeAutotaggerr
+		item.CorrelatedAt = &now
+		// Pinned because nothing a later scan reads would find it again: most of
+		// these were placed by a fingerprint or a sibling, not by their own tags.
+		item.Pinned = true
+		item.Status = models.LibraryItemStatusOK
+		item.Error = ""
+	} else {
+		item.MBReleaseID, item.MBReleaseTrackID, item.MBRecordingID = "", "", ""
+		item.CorrelationSource = ""
+		item.CorrelatedAt = nil
+		item.Pinned = false
+		item.Status = models.LibraryItemStatusUnmatched
+		item.Error = res.Reason
+	}
+	return item, r.db.Save(&item).Error
+}
+
+// holdBackUnplaced marks the identified files that did not make it into the library
+// unmatched, with the reason: left in the inbox, they are not library files to tag.
+// They keep their pinned correlation, so the next import places them without asking
+// again once whatever was in the way is gone.
+func (r *Runner) holdBackUnplaced(plan rename.Plan, res rename.Result) {
+	done := map[uuid.UUID]bool{}
+	for _, m := range res.Done {
+		done[m.ItemID] = true
+	}
+	reasons := map[uuid.UUID]string{}
+	for _, m := range plan.Moves {
+		if m.Skip != "" {
+			reasons[m.ItemID] = m.Skip
+		}
+	}
+	for _, row := range res.Items {
+		if row.Status == models.EventItemStatusError {
+			for _, m := range plan.Moves {
+				if m.From == row.Path {
+					reasons[m.ItemID] = row.Error
+				}
+			}
+		}
+	}
+	for _, m := range plan.Moves {
+		if done[m.ItemID] {
+			continue
+		}
+		reason := reasons[m.ItemID]
+		if reason == "" {
+			reason = "not imported yet"
+		}
+		if err := r.db.Model(&models.LibraryItem{}).Where("id = ?", m.ItemID).Updates(map[string]any{
+			"status": models.LibraryItemStatusUnmatched,
+			"error":  "not imported: " + reason,
+		}).Error; err != nil {
+			logger.Log.Warnf("failed to hold back %s: %s", m.From, err.Error())
+		}
+	}
+}
+
+// alreadyImported reports whether a copy-mode import has copied this inbox file, as
+// it is now, before.
+func (r *Runner) alreadyImported(path string) bool {
+	var row models.ImportedFile
+	if err := r.db.First(&row, "path = ?", path).Error; err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && row.Size == info.Size() && row.ModTime != nil && row.ModTime.Equal(info.ModTime())
+}
+
+func (r *Runner) recordImported(library models.Library, m rename.Move) {
+	info, err := os.Stat(m.From)
+	if err != nil {
+		return
+	}
+	mod := info.ModTime()
+	row := models.ImportedFile{Path: m.From, LibraryID: library.ID, Size: info.Size(), ModTime: &mod, Target: m.To, ImportedAt: time.Now()}
+	if err := r.db.Save(&row).Error; err != nil {
+		logger.Log.Warnf("failed to remember the import of %s: %s", m.From, err.Error())
+	}
+}
+
+func sortedKeys(groups map[string][]string) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// TestImportLibraryPlacesAndHoldsBack runs one import over an inbox holding a file
+// attached by hand and one nothing can identify: the first is moved into the layout
+// and indexed there, the emptied inbox folder goes, and the second stays put as an
+// unmatched item carrying the reason, which is what the attach flow lists.
+func TestImportLibraryPlacesAndHoldsBack(t *testing.T) {
+	db := newTestDB(t)
+	seedReleaseCache(t, db, models.MusicBrainzReleaseResponse{
+		ID: "rel-1", Title: "Album", Date: "2001-05-01",
+		ArtistCredit: []models.ArtistCredit{{Name: "Band", Artist: models.Artist{ID: "art-1", Name: "Band"}}},
+		ReleaseGroup: models.ReleaseGroup{ID: "rg-1", Title: "Album", PrimaryType: "Album"},
+		Media: []models.MusicBrainzMedia{{
+			Position: 1,
+			Tracks:   []models.Track{{ID: "trk-1", Title: "Song", Position: 1, Number: "1"}},
+		}},
+	})
+
+	root, box := t.TempDir(), t.TempDir()
+	library := models.Library{Name: "L", Path: root, Enabled: true, InboxPath: box, NamingTemplate: "{albumartist}/{album}/{track:02} {title}"}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatal(err)
+	}
+	attached := writeInvalidFlac(t, filepath.Join(box, "attached"))
+	mystery := writeInvalidFlac(t, filepath.Join(box, "mystery"))
+	item := models.LibraryItem{
+		LibraryID: library.ID, Path: attached, Pinned: true, Status: models.LibraryItemStatusOK,
+		MBReleaseID: "rel-1", MBReleaseTrackID: "trk-1", CorrelationSource: models.CorrelationSourceManual,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(db, nil, models.ConfigStruct{})
+	r.importLibraryNow(context.Background(), library.ID)
+
+	want := filepath.Join(root, "Band", "Album", "01 Song.flac")
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("the attached file was not imported: %v", err)
+	}
+	var placed models.LibraryItem
+	db.First(&placed, "id = ?", item.ID)
+	if placed.Path != want {
+		t.Errorf("item path = %q, want %q", placed.Path, want)
+	}
+	if _, err := os.Stat(filepath.Dir(attached)); !os.IsNotExist(err) {
+		t.Errorf("the emptied inbox folder was kept (%v)", err)
+	}
+
+	var left models.LibraryItem
+	if err := db.First(&left, "path = ?", mystery).Error; err != nil {
+		t.Fatalf("the unidentified file was not indexed: %v", err)
+	}
+	if left.Status != models.LibraryItemStatusUnmatched || left.Error == "" || left.LibraryID != library.ID {
+		t.Errorf("unidentified item = %+v, want unmatched with a reason", left)
+	}
+
+	var event models.Event
+	if err := db.Where("type = ?", models.EventTypeImport).First(&event).Error; err != nil {
+		t.Fatalf("no import event: %v", err)
+	}
+	var rows []models.EventItem
+	db.Where("event_id = ? AND kind = ?", event.ID, models.EventItemKindImport).Find(&rows)
+	statuses := map[string]string{}
+	for _, row := range rows {
+		statuses[row.Path] = row.Status
+	}
+	if statuses[attached] != models.EventItemStatusImported || statuses[mystery] != models.EventItemStatusUnidentified {
+		t.Errorf("event rows = %v", statuses)
+	}
+}
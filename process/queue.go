@@ -1,6 +1,8 @@
 package process
 
 import (
+	"context"
+
 	"github.com/aunefyren/autotaggerr/logger"
 )
 
@@ -20,18 +22,30 @@ import (
 type jobKind string
 
 const (
-	jobProcessAll       jobKind = "process_all"
-	jobProcessLibrary   jobKind = "process_library"
-	jobProcessArtist    jobKind = "process_artist"
-	jobRetagAll         jobKind = "retag_all"
-	jobRetagLibrary     jobKind = "retag_library"
-	jobRetagArtist      jobKind = "retag_artist"
-	jobForceRecorrelate jobKind = "force_recorrelate"
-	jobRefreshAll       jobKind = "refresh_all"
-	jobRefreshVerify    jobKind = "refresh_verify"
-	jobRefreshArtist    jobKind = "refresh_artist"
-	jobRefreshLibrary   jobKind = "refresh_library"
-	jobRepairArtist     jobKind = "repair_artist"
+	jobProcessAll          jobKind = "process_all"
+	jobProcessLibrary      jobKind = "process_library"
+	jobProcessArtist       jobKind = "process_artist"
+	jobProcessFolders      jobKind = "process_folders"
+	jobProcessReleaseGroup jobKind = "process_release_group"
+	jobRetagAll            jobKind = "retag_all"
+	jobRetagLibrary        jobKind = "retag_library"
+	jobRetagArtist         jobKind = "retag_artist"
+	jobRetagReleaseGroup   jobKind = "retag_release_group"
+	jobRetagRelease        jobKind = "retag_release"
+	jobForceRecorrelate    jobKind = "force_recorrelate"
+	jobRenameLibrary       jobKind = "rename_library"
+	jobImportLibrary       jobKind = "import_library"
+	jobRollbackEvent       jobKind = "rollback_event"
+	jobRollbackItem        jobKind = "rollback_item"
+	jobDryRunLibrary       jobKind = "dry_run_library"
+	jobDryRunArtist        jobKind = "dry_run_artist"
+	jobDryRunRetagAll      jobKind = "dry_run_retag_all"
+	jobRefreshAll          jobKind = "refresh_all"
+	jobRefreshVerify       jobKind = "refresh_verify"
+	jobRefreshArtist       jobKind = "refresh_artist"
+	jobRefreshLibrary      jobKind = "refresh_library"
+	jobRefreshReleaseGroup jobKind = "refresh_release_group"
+	jobRepairArtist        jobKind = "repair_artist"
 )
 
 // fileWriting reports whether a kind rewrites audio files. File-writing jobs are
@@ -39,7 +53,9 @@ const (
 // behind a hours-long refresh — but a job already running is never preempted.
 func (k jobKind) fileWriting() bool {
 	switch k {
-	case jobProcessAll, jobProcessLibrary, jobProcessArtist, jobRetagAll, jobRetagLibrary, jobRetagArtist, jobForceRecorrelate:
+	case jobProcessAll, jobProcessLibrary, jobProcessArtist, jobProcessReleaseGroup, jobProcessFolders,
+		jobRetagAll, jobRetagLibrary, jobRetagArtist, jobRetagReleaseGroup, jobRetagRelease, jobForceRecorrelate, jobRenameLibrary,
+		jobImportLibrary, jobRollbackEvent, jobRollbackItem:
 		return true
 	}
 	return false
@@ -50,33 +66,51 @@ func (k jobKind) fileWriting() bool {
 // Status() reads their progress from.
 func (k jobKind) metadataRefresh() bool {
 	switch k {
-	case jobRefreshAll, jobRefreshVerify, jobRefreshArtist, jobRefreshLibrary:
+	case jobRefreshAll, jobRefreshVerify, jobRefreshArtist, jobRefreshReleaseGroup, jobRefreshLibrary:
 		return true
 	}
 	return false
 }
 
 // job is one unit of queued work: a stable identity for dedup/priority/display, plus
-// the closure that performs it.
+// the closure that performs it. The closure is handed the job's own context, which
+// Cancel and Shutdown cancel; it is the closure's business to stop at a boundary
+// where stopping leaves nothing half-done.
 type job struct {
 	kind  jobKind
 	key   string // dedup identity; enqueuing a key already queued or running is a no-op
 	title string // human label for the queue view
-	run   func()
+	run   func(ctx context.Context)
 }
 
-// JobView is the API-facing shape of a queued or running job.
+// JobView is the API-facing shape of a queued or running job. Key is what MoveJob and
+// RemoveJob name a pending job by. Unattended marks a job a schedule or the watcher
+// queued, which quiet hours hold back (see quiet.go).
 type JobView struct {
-	Kind  string `json:"kind"`
-	Title string `json:"title"`
+	Key        string `json:"key"`
+	Kind       string `json:"kind"`
+	Title      string `json:"title"`
+	Unattended bool   `json:"unattended,omitempty"`
 }
 
-func (j job) view() JobView { return JobView{Kind: string(j.kind), Title: j.title} }
+func (j job) view() JobView { return JobView{Key: j.key, Kind: string(j.kind), Title: j.title} }
+
+// enqueue adds a job somebody asked for: a button, an API call. See enqueueAs.
+func (r *Runner) enqueue(j job) { r.enqueueAs(j, false) }
+
+// enqueueUnattended adds a job nobody is waiting on — a schedule's, the watcher's —
+// which quiet hours hold back. See enqueueAs.
+func (r *Runner) enqueueUnattended(j job) { r.enqueueAs(j, true) }
 
-// enqueue adds a job unless an identical one (same key) is already running or pending;
-// duplicates collapse onto the existing one, so a restart storm or a double-click
-// cannot stack redundant runs. File-writing jobs slot ahead of pending metadata jobs.
-func (r *Runner) enqueue(j job) {
+// enqueueAs adds a job unless an identical one (same key) is already running or
+// pending; duplicates collapse onto the existing one, so a restart storm or a
+// double-click cannot stack redundant runs. File-writing jobs slot ahead of pending
+// metadata jobs.
+//
+// A person asking for a job the schedule already queued takes it over: it stops being
+// unattended, so a scan deferred for quiet hours runs now because someone pressed the
+// button, and one paused for them carries on.
+func (r *Runner) enqueueAs(j job, unattended bool) {
 	// A job accepted during shutdown would be dropped seconds later by Shutdown, and
 	// in the meantime would show up as pending. Refuse it where the refusal can be
 	// logged with the job's name.
@@ -86,17 +120,39 @@ func (r *Runner) enqueue(j job) {
 	}
 	r.queueMu.Lock()
 	if r.current != nil && r.current.key == j.key {
+		if !unattended {
+			r.attendLocked(j.key)
+		}
 		r.queueMu.Unlock()
 		logger.Log.Debugf("job %q already running; not queued again", j.title)
 		return
 	}
 	for _, q := range r.queue {
 		if q.key == j.key {
+			var views []JobView
+			taken := !unattended && r.unattended[j.key]
+			if taken {
+				r.attendLocked(j.key)
+				r.persistQueueLocked()
+				views = r.queueViewsLocked()
+			}
 			r.queueMu.Unlock()
+			if taken {
+				r.setStatus(func(s *Summary) { s.Queue = views })
+				r.nudge()
+				logger.Log.Infof("queued job no longer waits for quiet hours: %s", j.title)
+				return
+			}
 			logger.Log.Debugf("job %q already queued; not queued again", j.title)
 			return
 		}
 	}
+	if unattended {
+		if r.unattended == nil {
+			r.unattended = map[string]bool{}
+		}
+		r.unattended[j.key] = true
+	}
 	if j.kind.fileWriting() {
 		i := 0
 		for i < len(r.queue) && r.queue[i].kind.fileWriting() {
@@ -106,11 +162,17 @@ func (r *Runner) enqueue(j job) {
 	} else {
 		r.queue = append(r.queue, j)
 	}
+	r.persistQueueLocked()
 	views := r.queueViewsLocked()
 	r.queueMu.Unlock()
 
 	r.setStatus(func(s *Summary) { s.Queue = views })
 	logger.Log.Infof("queued job: %s", j.title)
+	r.nudge()
+}
+
+// nudge wakes the worker if it is waiting for something to do.
+func (r *Runner) nudge() {
 	select {
 	case r.wake <- struct{}{}:
 	default:
@@ -124,11 +186,19 @@ func (r *Runner) queueViewsLocked() []JobView {
 	}
 	out := make([]JobView, len(r.queue))
 	for i, q := range r.queue {
-		out[i] = q.view()
+		out[i] = r.viewLocked(q)
 	}
 	return out
 }
 
+// viewLocked is j's view with what the queue knows about it. The caller must hold
+// queueMu.
+func (r *Runner) viewLocked(j job) JobView {
+	v := j.view()
+	v.Unattended = r.unattended[j.key]
+	return v
+}
+
 // worker drains the queue one job at a time. It holds jobMu for the whole of each job,
 // which is the same lock the synchronous re-tag paths TryLock — so a background job and
 // an interactive re-tag can never write the same file at once.
@@ -141,18 +211,26 @@ func (r *Runner) worker() {
 			return
 		}
 		r.queueMu.Lock()
-		if len(r.queue) == 0 {
+		until, held := r.quietLocked()
+		next := r.nextRunnableLocked(held)
+		deferred := r.noteDeferralsLocked(until, held)
+		if next < 0 {
+			waiting := len(r.queue) > 0
 			r.queueMu.Unlock()
-			<-r.wake
+			r.recordDeferrals(deferred, until)
+			r.idle(until, held && waiting)
 			continue
 		}
-		j := r.queue[0]
-		r.queue = r.queue[1:]
+		j := r.queue[next]
+		r.queue = append(r.queue[:next:next], r.queue[next+1:]...)
 		r.current = &j
+		delete(r.deferred, j.key)
+		r.persistQueueLocked()
 		views := r.queueViewsLocked()
+		cur := r.viewLocked(j)
 		r.queueMu.Unlock()
+		r.recordDeferrals(deferred, until)
 
-		cur := j.view()
 		r.jobMu.Lock()
 		r.running.Store(true)
 		// Clear the previous job's progress before this one is visible as running, so
@@ -161,13 +239,36 @@ func (r *Runner) worker() {
 		r.resetProgress()
 		r.setStatus(func(s *Summary) { s.CurrentJob = &cur; s.Queue = views })
 
-		runJob(j)
+		// A context per job, so cancelling one cannot reach the next: a stop pressed
+		// as a job finishes must not land on whatever the queue starts after it.
+		ctx, cancel := context.WithCancel(context.Background())
+		r.cancelMu.Lock()
+		r.cancel = cancel
+		r.cancelMu.Unlock()
+		// A job pulled just as Shutdown ran has missed its Cancel; stopping was set
+		// before that call, so it is visible here.
+		if r.stopping.Load() {
+			cancel()
+		}
+
+		runJob(ctx, j)
+
+		r.cancelMu.Lock()
+		r.cancel = nil
+		r.cancelMu.Unlock()
+		// Stopped by Shutdown rather than finished or cancelled by hand: it goes back
+		// to the head of the stored queue, so the next start carries on with it.
+		if r.stopping.Load() && ctx.Err() != nil {
+			r.requeueInterrupted(j)
+		}
+		cancel()
 
 		r.running.Store(false)
 		r.jobMu.Unlock()
 
 		r.queueMu.Lock()
 		r.current = nil
+		delete(r.unattended, j.key)
 		views = r.queueViewsLocked()
 		r.queueMu.Unlock()
 		r.setStatus(func(s *Summary) { s.CurrentJob = nil; s.Queue = views })
@@ -176,11 +277,24 @@ func (r *Runner) worker() {
 
 // runJob executes a job, containing a panic so one bad run cannot take down the worker
 // and freeze every job queued behind it.
-func runJob(j job) {
+func runJob(ctx context.Context, j job) {
 	defer func() {
 		if rec := recover(); rec != nil {
 			logger.Log.Errorf("job %q panicked: %v", j.title, rec)
 		}
 	}()
-	j.run()
+	j.run(ctx)
+}
+
+// Cancel stops the running job at its next boundary — between files in a walk or a
+// re-tag, between releases in the drift stage, between entities in a metadata pass —
+// and lets the queue move on to the next one. Pending jobs are not touched; a job that
+// has not started has nothing to stop. Safe and cheap at any time, including when
+// nothing is running.
+func (r *Runner) Cancel() {
+	r.cancelMu.Lock()
+	defer r.cancelMu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+	}
 }
@@ -0,0 +1,402 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/migration"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The queue used to live only in memory, so a re-tag queued before a container update
+// vanished with the container. The pending jobs are now mirrored to `queued_jobs`
+// every time the queue changes, and replayed by restoreQueue at the next start.
+//
+// A job's closure cannot be stored, but its key can, and the key is the verb and its
+// scope: "retag_library:<id>", "refresh_artist_force:<mbid>". Replaying is calling
+// that verb again, which resolves the scope afresh — the same path, the same
+// refusals, the same dedup as a request arriving over HTTP.
+//
+// What is stored is the queue, not the job running: a job is taken out of the table
+// when it starts. One that is stopped by Shutdown goes back in at the head, since the
+// stop was not its own doing. One that a crash or a kill interrupts does not — a job
+// that brings the process down would otherwise take it down again on every start.
+
+// ErrJobNotQueued is returned by MoveJob and RemoveJob for a key that is not pending:
+// never queued, already started, or already removed.
+var ErrJobNotQueued = errors.New("no pending job with that key")
+
+// persistQueueLocked rewrites the stored queue to match r.queue. The caller must hold
+// queueMu, which is what keeps two rewrites from interleaving. The queue is a handful
+// of rows, so rewriting it whole is cheaper to get right than patching positions. A
+// failure is logged and the in-memory queue carries on: losing the stored copy costs
+// a restart's worth of pending jobs, not the jobs themselves.
+func (r *Runner) persistQueueLocked() {
+	if r.db == nil {
+		return
+	}
+	rows := make([]models.QueuedJob, len(r.queue))
+	for i, q := range r.queue {
+		rows[i] = models.QueuedJob{Key: q.key, Kind: string(q.kind), Title: q.title, Position: i, Unattended: r.unattended[q.key]}
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.QueuedJob{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		logger.Log.Warnf("failed to store the job queue: %s", err.Error())
+	}
+}
+
+// requeueInterrupted puts a job stopped by Shutdown back at the head of the stored
+// queue. Shutdown has already emptied the queue in memory, so this writes the one row
+// rather than rewriting the table from an empty queue.
+func (r *Runner) requeueInterrupted(j job) {
+	if r.db == nil {
+		return
+	}
+	var head struct{ Position *int }
+	r.db.Model(&models.QueuedJob{}).Select("MIN(position) AS position").Scan(&head)
+	position := 0
+	if head.Position != nil {
+		position = *head.Position - 1
+	}
+	r.queueMu.Lock()
+	unattended := r.unattended[j.key]
+	r.queueMu.Unlock()
+	row := models.QueuedJob{Key: j.key, Kind: string(j.kind), Title: j.title, Position: position, Unattended: unattended}
+	if err := r.db.Save(&row).Error; err != nil {
+		logger.Log.Warnf("failed to keep interrupted job %q for the next start: %s", j.title, err.Error())
+		return
+	}
+	logger.Log.Infof("interrupted job kept for the next start: %s", j.title)
+}
+
+// restoreQueue replays the stored queue, in its stored order. NewRunner calls it once,
+// before the worker starts — which in main is after events.ReconcileRunning and
+// before any schedule can fire.
+//
+// Each row is replayed through its verb, so a job whose scope no longer resolves — a
+// deleted library, an artist with no files left — is dropped with a log line saying
+// which, rather than restored to fail later. The order is put back afterwards: the
+// verbs queue with the usual priority, and the stored order may be one somebody chose
+// by moving a job.
+func (r *Runner) restoreQueue() {
+	if r.db == nil {
+		return
+	}
+	var rows []models.QueuedJob
+	if err := r.db.Order("position").Find(&rows).Error; err != nil {
+		logger.Log.Warnf("failed to load the stored job queue: %s", err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	order := make(map[string]int, len(rows))
+	for i, row := range rows {
+		order[row.Key] = i
+		if err := r.replayJob(jobKind(row.Kind), row.Key); err != nil {
+			logger.Log.Warnf("dropped stored job %q: %s", row.Title, err.Error())
+		}
+	}
+
+	r.queueMu.Lock()
+	// The verbs queue as though somebody asked; what a schedule queued goes back to
+	// waiting for quiet hours.
+	for _, row := range rows {
+		if row.Unattended && r.pendingIndexLocked(row.Key) >= 0 {
+			if r.unattended == nil {
+				r.unattended = map[string]bool{}
+			}
+			r.unattended[row.Key] = true
+		}
+	}
+	sort.SliceStable(r.queue, func(a, b int) bool {
+		pa, okA := order[r.queue[a].key]
+		pb, okB := order[r.queue[b].key]
+		if okA != okB {
+			return okA // a job queued while restoring goes after the restored ones
+		}
+		return pa < pb
+	})
+	r.persistQueueLocked()
+	views := r.queueViewsLocked()
+	restored := len(r.queue)
+	r.queueMu.Unlock()
+	r.setStatus(func(s *Summary) { s.Queue = views })
+	logger.Log.Infof("restored %d of %d queued job(s)", restored, len(rows))
+}
+
+// replayJob queues a stored job again through the verb that made it, reading the
+// verb's arguments back out of the key.
+func (r *Runner) replayJob(kind jobKind, key string) error {
+	arg := func(prefix string) (string, error) {
+		rest, ok := strings.CutPrefix(key, prefix+":")
+		if !ok || rest == "" {
+			return "", fmt.Errorf("unrecognised key %q", key)
+		}
+		return rest, nil
+	}
+	id := func(prefix string) (uuid.UUID, error) {
+		rest, err := arg(prefix)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return uuid.Parse(rest)
+	}
+
+	switch kind {
+	case jobProcessAll:
+		r.RunAll()
+	case jobRetagAll:
+		return r.RetagAll(nil)
+	case jobRefreshAll:
+		r.SyncDrift()
+	case jobRefreshVerify:
+		r.VerifyIdentities()
+	case jobProcessLibrary:
+		libraryID, err := id("process_library")
+		if err != nil {
+			return err
+		}
+		return r.RunLibrary(libraryID, nil)
+	case jobProcessArtist:
+		mbid, err := arg("process_artist")
+		if err != nil {
+			return err
+		}
+		return r.RunArtist(mbid)
+	case jobProcessReleaseGroup:
+		rgMBID, err := arg("process_release_group")
+		if err != nil {
+			return err
+		}
+		return r.RunReleaseGroup(rgMBID)
+	case jobProcessFolders:
+		rest, err := arg("process_folders")
+		if err != nil {
+			return err
+		}
+		rawID, joined, _ := strings.Cut(rest, ":")
+		libraryID, err := uuid.Parse(rawID)
+		if err != nil {
+			return err
+		}
+		var library models.Library
+		if err := r.db.First(&library, "id = ?", libraryID).Error; err != nil {
+			return err
+		}
+		r.RunFolders(library, strings.Split(joined, "\x00"))
+	case jobForceRecorrelate:
+		if rgMBID, err := arg("force_recorrelate_rg"); err == nil {
+			return r.ForceRecorrelateReleaseGroup(rgMBID)
+		}
+		if libraryID, err := id("force_recorrelate_lib"); err == nil {
+			return r.ForceRecorrelateLibrary(libraryID)
+		}
+		mbid, err := arg("force_recorrelate")
+		if err != nil {
+			return err
+		}
+		return r.ForceRecorrelateArtist(mbid)
+	case jobRenameLibrary:
+		libraryID, err := id("rename_library")
+		if err != nil {
+			return err
+		}
+		return r.RenameLibrary(libraryID)
+	case jobImportLibrary:
+		libraryID, err := id("import_library")
+		if err != nil {
+			return err
+		}
+		return r.ImportLibrary(libraryID)
+	case jobDryRunLibrary:
+		rest, err := arg("dry_run_library")
+		if err != nil {
+			return err
+		}
+		subject, dry, err := splitDryRunKey(rest)
+		if err != nil {
+			return err
+		}
+		libraryID, err := uuid.Parse(subject)
+		if err != nil {
+			return err
+		}
+		return r.RunLibrary(libraryID, dry)
+	case jobDryRunArtist:
+		rest, err := arg("dry_run_artist")
+		if err != nil {
+			return err
+		}
+		mbid, dry, err := splitDryRunKey(rest)
+		if err != nil {
+			return err
+		}
+		scope, err := r.ArtistScope(mbid)
+		if err != nil {
+			return err
+		}
+		scope.DryRun = dry
+		return r.Run(scope)
+	case jobDryRunRetagAll:
+		_, dry, err := splitDryRunKey(strings.TrimPrefix(key, "dry_run_retag_all"))
+		if err != nil {
+			return err
+		}
+		return r.RetagAll(dry)
+	case jobRollbackEvent:
+		eventID, err := id("rollback_event")
+		if err != nil {
+			return err
+		}
+		return r.RollbackEvent(eventID)
+	case jobRollbackItem:
+		itemID, err := id("rollback_item")
+		if err != nil {
+			return err
+		}
+		return r.RollbackItem(itemID)
+	case jobRetagLibrary:
+		libraryID, err := id("retag_library")
+		if err != nil {
+			return err
+		}
+		r.RetagLibrary(libraryID)
+	case jobRetagArtist:
+		mbid, err := arg("retag_artist")
+		if err != nil {
+			return err
+		}
+		r.RetagArtist(mbid)
+	case jobRetagReleaseGroup:
+		rgMBID, err := arg("retag_release_group")
+		if err != nil {
+			return err
+		}
+		return r.RetagReleaseGroup(rgMBID)
+	case jobRetagRelease:
+		releaseMBID, err := arg("retag_release")
+		if err != nil {
+			return err
+		}
+		return r.RetagRelease(releaseMBID)
+	case jobRefreshArtist:
+		if mbid, err := arg("refresh_artist_force"); err == nil {
+			r.RefreshArtist(mbid, true)
+			return nil
+		}
+		mbid, err := arg("refresh_artist")
+		if err != nil {
+			return err
+		}
+		r.RefreshArtist(mbid, false)
+	case jobRefreshReleaseGroup:
+		if rgMBID, err := arg("refresh_release_group_force"); err == nil {
+			return r.RefreshReleaseGroup(rgMBID, true)
+		}
+		rgMBID, err := arg("refresh_release_group")
+		if err != nil {
+			return err
+		}
+		return r.RefreshReleaseGroup(rgMBID, false)
+	case jobRefreshLibrary:
+		libraryID, err := id("refresh_library")
+		if err != nil {
+			return err
+		}
+		r.RefreshLibrary(libraryID)
+	case jobRepairArtist:
+		mbid, err := arg("repair_artist")
+		if err != nil {
+			return err
+		}
+		// migration.ReconcileQueued cleared the marks at startup; this job is the
+		// work they claim, so they go back on before it is queued.
+		if _, err := migration.MarkRepairQueued(r.db, mbid); err != nil {
+			logger.Log.Warnf("failed to mark migrations as repairing for %s: %s", mbid, err.Error())
+		}
+		r.RepairArtistAlbums(mbid)
+	default:
+		return fmt.Errorf("unknown job kind %q", kind)
+	}
+	return nil
+}
+
+// MoveJob moves a pending job to position to in the queue, counted from the next job
+// to run; a position past the end moves it to the end. It overrides the rule that
+// file-writing jobs queue ahead of metadata ones, which only places a job as it
+// arrives — a person who moves a refresh to the front means it. The running job is
+// not in the queue and cannot be moved.
+func (r *Runner) MoveJob(key string, to int) error {
+	r.queueMu.Lock()
+	i := r.pendingIndexLocked(key)
+	if i < 0 {
+		r.queueMu.Unlock()
+		return ErrJobNotQueued
+	}
+	j := r.queue[i]
+	r.queue = append(r.queue[:i], r.queue[i+1:]...)
+	to = max(0, min(to, len(r.queue)))
+	r.queue = append(r.queue[:to], append([]job{j}, r.queue[to:]...)...)
+	r.persistQueueLocked()
+	views := r.queueViewsLocked()
+	r.queueMu.Unlock()
+
+	r.setStatus(func(s *Summary) { s.Queue = views })
+	logger.Log.Infof("moved queued job to position %d: %s", to, j.title)
+	return nil
+}
+
+// RemoveJob takes a pending job out of the queue. To stop the job that is running,
+// Cancel it.
+func (r *Runner) RemoveJob(key string) error {
+	r.queueMu.Lock()
+	i := r.pendingIndexLocked(key)
+	if i < 0 {
+		r.queueMu.Unlock()
+		return ErrJobNotQueued
+	}
+	j := r.queue[i]
+	r.queue = append(r.queue[:i], r.queue[i+1:]...)
+	r.attendLocked(j.key)
+	r.persistQueueLocked()
+	views := r.queueViewsLocked()
+	r.queueMu.Unlock()
+
+	r.setStatus(func(s *Summary) { s.Queue = views })
+	logger.Log.Infof("removed queued job: %s", j.title)
+
+	// A repair marks its migrations as in flight when it is queued, and clears them
+	// when it runs. Removed, it never runs, so the clearing is done here.
+	if mbid, ok := strings.CutPrefix(j.key, "repair_artist:"); ok && r.db != nil {
+		if err := migration.ClearRepairQueued(r.db, mbid); err != nil {
+			logger.Log.Warnf("failed to clear repair marks for %s: %s", mbid, err.Error())
+		}
+	}
+	return nil
+}
+
+// pendingIndexLocked is the position of key in the pending queue, or -1. The caller
+// must hold queueMu.
+func (r *Runner) pendingIndexLocked(key string) int {
+	for i, q := range r.queue {
+		if q.key == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,70 @@
+package process
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/database"
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// The queue a process leaves behind is the queue the next one starts with: the job
+// Shutdown stopped first, then the pending ones in the order they stood — moves
+// included — minus any whose scope went away in between.
+func TestTheQueueSurvivesARestart(t *testing.T) {
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	kept := models.Library{Name: "Kept", Path: t.TempDir(), Enabled: true}
+	gone := models.Library{Name: "Gone", Path: t.TempDir(), Enabled: true}
+	for _, library := range []*models.Library{&kept, &gone} {
+		if err := db.Create(library).Error; err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+	}
+
+	before := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
+	started := make(chan struct{})
+	before.enqueue(job{jobRefreshAll, "refresh_all", "Metadata refresh", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}})
+	<-started
+
+	before.RetagLibrary(kept.ID)
+	if err := before.RunLibrary(gone.ID, nil); err != nil {
+		t.Fatalf("RunLibrary: %v", err)
+	}
+	before.RefreshArtist("artist-mbid", true)
+	if err := before.MoveJob("refresh_artist_force:artist-mbid", 0); err != nil {
+		t.Fatalf("MoveJob: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := before.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := db.Delete(&gone).Error; err != nil {
+		t.Fatalf("delete library: %v", err)
+	}
+
+	// The next process's runner, without its worker, so the restored jobs stay
+	// pending where the test can see them.
+	after := &Runner{db: db, wake: make(chan struct{}, 1)}
+	after.restoreQueue()
+
+	want := []string{"refresh_all", "refresh_artist_force:artist-mbid", "retag_library:" + kept.ID.String()}
+	if got := queuedKeys(after); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored queue = %v, want %v", got, want)
+	}
+	var stored []models.QueuedJob
+	db.Order("position").Find(&stored)
+	if len(stored) != len(want) || stored[0].Key != want[0] {
+		t.Errorf("stored queue = %+v, want it rewritten to match the restored one", stored)
+	}
+}
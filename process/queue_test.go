@@ -3,10 +3,13 @@ package process
 import (
 	"context"
 	"errors"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/aunefyren/autotaggerr/quiet"
 )
 
 // newQueueRunner builds a runner with only the queue wired — no database — for
@@ -26,7 +29,7 @@ func TestQueueDedupCollapsesDuplicates(t *testing.T) {
 	release := make(chan struct{})
 	var blockerRuns, otherRuns int32
 
-	r.enqueue(job{jobRefreshAll, "block", "blocker", func() {
+	r.enqueue(job{jobRefreshAll, "block", "blocker", func(context.Context) {
 		atomic.AddInt32(&blockerRuns, 1)
 		close(started)
 		<-release
@@ -34,9 +37,9 @@ func TestQueueDedupCollapsesDuplicates(t *testing.T) {
 	<-started // the blocker is now the current job
 
 	// Same key as the running job — deduped.
-	r.enqueue(job{jobRefreshAll, "block", "blocker", func() { atomic.AddInt32(&blockerRuns, 1) }})
+	r.enqueue(job{jobRefreshAll, "block", "blocker", func(context.Context) { atomic.AddInt32(&blockerRuns, 1) }})
 	// A distinct job enqueued twice — the duplicate collapses onto the first.
-	other := job{jobRefreshArtist, "other", "other", func() { atomic.AddInt32(&otherRuns, 1) }}
+	other := job{jobRefreshArtist, "other", "other", func(context.Context) { atomic.AddInt32(&otherRuns, 1) }}
 	r.enqueue(other)
 	r.enqueue(other)
 
@@ -60,7 +63,7 @@ func TestQueueRunsSerially(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
 		key := string(rune('a' + i))
-		r.enqueue(job{jobRefreshArtist, key, key, func() {
+		r.enqueue(job{jobRefreshArtist, key, key, func(context.Context) {
 			defer wg.Done()
 			n := atomic.AddInt32(&inFlight, 1)
 			for {
@@ -89,8 +92,8 @@ func TestQueuePrioritisesFileJobs(t *testing.T) {
 	release := make(chan struct{})
 	var mu sync.Mutex
 	var order []string
-	rec := func(k string) func() {
-		return func() {
+	rec := func(k string) func(context.Context) {
+		return func(context.Context) {
 			mu.Lock()
 			order = append(order, k)
 			mu.Unlock()
@@ -98,7 +101,7 @@ func TestQueuePrioritisesFileJobs(t *testing.T) {
 	}
 
 	// Occupy the worker so the next two jobs are ordered while both are pending.
-	r.enqueue(job{jobRefreshAll, "blocker", "blocker", func() { close(started); <-release }})
+	r.enqueue(job{jobRefreshAll, "blocker", "blocker", func(context.Context) { close(started); <-release }})
 	<-started
 
 	r.enqueue(job{jobRefreshArtist, "meta", "meta", rec("meta")})       // metadata: lower priority
@@ -114,6 +117,53 @@ func TestQueuePrioritisesFileJobs(t *testing.T) {
 	}
 }
 
+// queuedKeys lists the pending queue as Status reports it.
+func queuedKeys(r *Runner) []string {
+	var keys []string
+	for _, v := range r.Status().Queue {
+		keys = append(keys, v.Key)
+	}
+	return keys
+}
+
+// TestMoveAndRemovePendingJobs: a moved job keeps the place it was moved to, even
+// ahead of the file jobs the priority rule would have put first, and a removed one
+// never runs. The running job is neither.
+func TestMoveAndRemovePendingJobs(t *testing.T) {
+	r := newQueueRunner()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r.enqueue(job{jobRefreshAll, "blocker", "blocker", func(context.Context) { close(started); <-release }})
+	<-started
+
+	var ranRemoved int32
+	r.enqueue(job{jobProcessAll, "process", "process", func(context.Context) {}})
+	r.enqueue(job{jobRetagAll, "retag", "retag", func(context.Context) { atomic.AddInt32(&ranRemoved, 1) }})
+	r.enqueue(job{jobRefreshArtist, "meta", "meta", func(context.Context) {}})
+
+	if err := r.MoveJob("meta", 0); err != nil {
+		t.Fatalf("MoveJob: %v", err)
+	}
+	if err := r.RemoveJob("retag"); err != nil {
+		t.Fatalf("RemoveJob: %v", err)
+	}
+	if got := queuedKeys(r); !reflect.DeepEqual(got, []string{"meta", "process"}) {
+		t.Errorf("queue = %v, want [meta process]", got)
+	}
+	for _, key := range []string{"blocker", "retag", "never-queued"} {
+		if err := r.RemoveJob(key); !errors.Is(err, ErrJobNotQueued) {
+			t.Errorf("RemoveJob(%q) = %v, want ErrJobNotQueued", key, err)
+		}
+	}
+
+	close(release)
+	r.waitIdle(t)
+	if atomic.LoadInt32(&ranRemoved) != 0 {
+		t.Error("a removed job ran")
+	}
+}
+
 // TestJobDoesNotInheritPreviousProgress: the live progress atomics are written by
 // scans alone, so a job that reports none of its own must not be described with the
 // last scan's. Left unreset, a status poll during a metadata refresh showed the
@@ -130,7 +180,7 @@ func TestJobDoesNotInheritPreviousProgress(t *testing.T) {
 	r.setCurrent("Some Artist")
 
 	var during Summary
-	r.enqueue(job{jobRefreshAll, "refresh", "Metadata refresh", func() { during = r.Status() }})
+	r.enqueue(job{jobRefreshAll, "refresh", "Metadata refresh", func(context.Context) { during = r.Status() }})
 	r.waitIdle(t)
 
 	if !during.Running {
@@ -148,7 +198,7 @@ func TestScanJobReportsItsOwnProgress(t *testing.T) {
 	r := newQueueRunner()
 
 	var during Summary
-	r.enqueue(job{jobProcessAll, "process", "Process all libraries", func() {
+	r.enqueue(job{jobProcessAll, "process", "Process all libraries", func(context.Context) {
 		r.progTotal.Store(200)
 		r.progDone.Store(75)
 		r.setPhase(PhaseScanning)
@@ -163,25 +213,26 @@ func TestScanJobReportsItsOwnProgress(t *testing.T) {
 	}
 }
 
-// TestShutdownDropsPendingAndWaitsForRunning is the shape of a deliberate stop: the
-// job already executing is allowed to finish (it has written files and opened an
-// event), and the ones behind it — which have started nothing — are dropped rather
-// than holding the process open for hours.
-func TestShutdownDropsPendingAndWaitsForRunning(t *testing.T) {
+// TestShutdownLeavesPendingAndWaitsForRunning is the shape of a deliberate stop: the
+// job already executing is waited for (it has written files and opened an event) even
+// when it does not stop on its context, and the ones behind it — which have started
+// nothing — are left for the next start rather than holding the process open for
+// hours (what is stored for that start is TestTheQueueSurvivesARestart's business).
+func TestShutdownLeavesPendingAndWaitsForRunning(t *testing.T) {
 	r := newQueueRunner()
 
 	started := make(chan struct{})
 	release := make(chan struct{})
 	var runningFinished, pendingRan int32
 
-	r.enqueue(job{jobRefreshAll, "running", "the running job", func() {
+	r.enqueue(job{jobRefreshAll, "running", "the running job", func(context.Context) {
 		close(started)
 		<-release
 		atomic.AddInt32(&runningFinished, 1)
 	}})
 	<-started
 
-	r.enqueue(job{jobRefreshArtist, "pending", "the pending job", func() {
+	r.enqueue(job{jobRefreshArtist, "pending", "the pending job", func(context.Context) {
 		atomic.AddInt32(&pendingRan, 1)
 	}})
 
@@ -213,6 +264,52 @@ func TestShutdownDropsPendingAndWaitsForRunning(t *testing.T) {
 	}
 }
 
+// TestShutdownCancelsTheRunningJob: a job that honours its context stops when the
+// process is asked to, instead of holding shutdown for the rest of its run.
+func TestShutdownCancelsTheRunningJob(t *testing.T) {
+	r := newQueueRunner()
+
+	started := make(chan struct{})
+	r.enqueue(job{jobProcessAll, "scan", "a long scan", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v, want the running job cancelled and waited for", err)
+	}
+}
+
+// TestCancelStopsOnlyTheRunningJob: the cancel button is for what is running. The job
+// behind it starts as usual, with a context of its own that the cancel did not touch.
+func TestCancelStopsOnlyTheRunningJob(t *testing.T) {
+	r := newQueueRunner()
+	r.Cancel() // nothing running: a no-op, not a cancel held for the next job
+
+	started := make(chan struct{})
+	r.enqueue(job{jobProcessAll, "running", "the running job", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}})
+	<-started
+
+	next := make(chan error, 1)
+	r.enqueue(job{jobRefreshAll, "pending", "the pending job", func(ctx context.Context) { next <- ctx.Err() }})
+	r.Cancel()
+
+	select {
+	case err := <-next:
+		if err != nil {
+			t.Errorf("the job after the cancelled one started with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cancelled job did not stop, or the queue did not move on")
+	}
+}
+
 // TestShutdownRefusesNewWork: a cron that fires mid-shutdown, or a request that got
 // in just before the server closed, must not queue work the process is about to drop.
 func TestShutdownRefusesNewWork(t *testing.T) {
@@ -223,7 +320,7 @@ func TestShutdownRefusesNewWork(t *testing.T) {
 	}
 
 	var ran int32
-	r.enqueue(job{jobRefreshAll, "late", "a late job", func() { atomic.AddInt32(&ran, 1) }})
+	r.enqueue(job{jobRefreshAll, "late", "a late job", func(context.Context) { atomic.AddInt32(&ran, 1) }})
 
 	r.queueMu.Lock()
 	queued := len(r.queue)
@@ -246,7 +343,7 @@ func TestShutdownGivesUpOnADeadline(t *testing.T) {
 	started := make(chan struct{})
 	release := make(chan struct{})
 	defer close(release)
-	r.enqueue(job{jobRefreshAll, "slow", "a slow job", func() {
+	r.enqueue(job{jobRefreshAll, "slow", "a slow job", func(context.Context) {
 		close(started)
 		<-release
 	}})
@@ -258,3 +355,98 @@ func TestShutdownGivesUpOnADeadline(t *testing.T) {
 		t.Errorf("Shutdown = %v, want a deadline error", err)
 	}
 }
+
+// quietRunner is newQueueRunner with quiet hours read from spec, which a test can
+// change while the worker runs.
+func quietRunner(spec *atomic.Pointer[string]) *Runner {
+	r := &Runner{
+		wake:       make(chan struct{}, 1),
+		quietHours: quiet.New(func() string { return *spec.Load() }),
+	}
+	go r.worker()
+	return r
+}
+
+// wholeDay is quiet hours that are always in force, whatever the clock says.
+const wholeDay = "00:00-12:00, 12:00-00:00"
+
+// While it is quiet a scheduled job waits and a job somebody asked for runs past it;
+// asking for the scheduled one by its own verb takes it over, and it runs too.
+func TestQuietHoursDeferUnattendedJobs(t *testing.T) {
+	spec := &atomic.Pointer[string]{}
+	always := wholeDay
+	spec.Store(&always)
+	r := quietRunner(spec)
+
+	scheduled := make(chan struct{}, 1)
+	asked := make(chan struct{}, 1)
+	scheduledJob := job{jobProcessAll, "process_all", "Process all libraries", func(context.Context) { scheduled <- struct{}{} }}
+	r.enqueueUnattended(scheduledJob)
+	r.enqueue(job{jobRetagAll, "retag_all", "Tag files", func(context.Context) { asked <- struct{}{} }})
+
+	select {
+	case <-asked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a job somebody asked for waited behind a deferred one")
+	}
+	select {
+	case <-scheduled:
+		t.Fatal("a scheduled job ran in quiet hours")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if views := r.Status().Queue; len(views) != 1 || !views[0].Unattended {
+		t.Errorf("queue = %+v, want the scheduled job pending and marked unattended", views)
+	}
+
+	r.enqueue(scheduledJob)
+	select {
+	case <-scheduled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("asking for the deferred job did not start it")
+	}
+}
+
+// A scheduled job running when a window opens pauses at its next boundary, and stays
+// paused until the window ends or it is stopped.
+func TestQuietHoursPauseARunningUnattendedJob(t *testing.T) {
+	defer func(prev time.Duration) { quiet.RecheckInterval = prev }(quiet.RecheckInterval)
+	quiet.RecheckInterval = 5 * time.Millisecond
+
+	spec := &atomic.Pointer[string]{}
+	none := ""
+	spec.Store(&none)
+	r := quietRunner(spec)
+
+	holding := make(chan struct{})
+	held := make(chan error, 1)
+	r.enqueueUnattended(job{jobProcessAll, "process_all", "Process all libraries", func(ctx context.Context) {
+		if err := r.holdForQuietHours(ctx); err != nil {
+			held <- err
+			return
+		}
+		always := wholeDay
+		spec.Store(&always)
+		close(holding)
+		held <- r.holdForQuietHours(ctx)
+	}})
+
+	<-holding
+	select {
+	case err := <-held:
+		t.Fatalf("the job carried on in quiet hours: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if phase := r.Status().Phase; phase != PhaseQuietHours {
+		t.Errorf("phase = %q while paused, want %q", phase, PhaseQuietHours)
+	}
+
+	spec.Store(&none)
+	select {
+	case err := <-held:
+		if err != nil {
+			t.Errorf("hold: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job did not resume when quiet hours ended")
+	}
+}
@@ -0,0 +1,166 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/quiet"
+)
+
+// Quiet hours hold back the work nobody is sitting in front of. A job is queued either
+// because somebody asked for it — a button, an API call — or because a schedule or the
+// watcher did; only the second kind is *unattended*, and only it waits for a window to
+// end. Pressing Process at nine in the evening means now.
+//
+// Held back happens in two places. A pending unattended job is passed over by the
+// worker while it is quiet, and jobs behind it that somebody asked for run in the
+// meantime; each deferral is recorded once per window in the Activity feed. A running
+// unattended job pauses at its next file boundary when a window opens — the files in
+// flight finish their writes, nothing new starts — and records the pause as a stage of
+// its tagging event, running until the window ends.
+//
+// Either way a person can take the job over: asking for it by its own verb while it is
+// deferred or paused makes it attended (see enqueueAs), and it runs or carries on.
+
+// quietLocked asks whether it is quiet, and until when — only if a pending job would be
+// held back by it, so a queue with nothing unattended in it never reads the setting.
+// The caller must hold queueMu.
+func (r *Runner) quietLocked() (time.Time, bool) {
+	for _, q := range r.queue {
+		if r.unattended[q.key] {
+			return r.quietHours.Until()
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextRunnableLocked is the index of the job the worker should start, or -1 if there
+// is none: the first pending job, passing over unattended ones while held. The caller
+// must hold queueMu.
+func (r *Runner) nextRunnableLocked(held bool) int {
+	for i, q := range r.queue {
+		if !held || !r.unattended[q.key] {
+			return i
+		}
+	}
+	return -1
+}
+
+// noteDeferralsLocked marks the unattended jobs held back until until, and returns the
+// ones not already recorded as deferred for this window. The caller must hold queueMu
+// and record what it returns once it has let go.
+func (r *Runner) noteDeferralsLocked(until time.Time, held bool) []job {
+	if !held {
+		return nil
+	}
+	var fresh []job
+	for _, q := range r.queue {
+		if !r.unattended[q.key] || r.deferred[q.key].Equal(until) {
+			continue
+		}
+		if r.deferred == nil {
+			r.deferred = map[string]time.Time{}
+		}
+		r.deferred[q.key] = until
+		fresh = append(fresh, q)
+	}
+	return fresh
+}
+
+// recordDeferrals writes one finished event per deferred job: the feed is where
+// somebody looks for why the nightly scan did not run at six.
+func (r *Runner) recordDeferrals(deferred []job, until time.Time) {
+	for _, j := range deferred {
+		logger.Log.Infof("quiet hours until %s; deferring job: %s", until.Format("15:04"), j.title)
+		ev := events.Begin(r.db, models.EventTypeQuietHours, "Deferred: "+j.title)
+		events.Finish(r.db, ev, models.EventStatusOK, "Waits for quiet hours to end at "+until.Format("15:04"), map[string]any{
+			"job":   j.key,
+			"until": until,
+		})
+	}
+}
+
+// idle waits for something to do: a job queued, or — when every pending job is held
+// back — the window ending. The wait is capped so an edit shortening tonight's window
+// releases the queue within quiet.RecheckInterval rather than at the old end.
+func (r *Runner) idle(until time.Time, held bool) {
+	if !held {
+		<-r.wake
+		return
+	}
+	timer := time.NewTimer(min(time.Until(until), quiet.RecheckInterval))
+	defer timer.Stop()
+	select {
+	case <-r.wake:
+	case <-timer.C:
+	}
+}
+
+// attendLocked makes key a job somebody asked for. The caller must hold queueMu.
+func (r *Runner) attendLocked(key string) {
+	delete(r.unattended, key)
+	delete(r.deferred, key)
+}
+
+// currentUnattended reports the running job's key, and whether nobody asked for it.
+func (r *Runner) currentUnattended() (string, bool) {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+	if r.current == nil {
+		return "", false
+	}
+	return r.current.key, r.unattended[r.current.key]
+}
+
+// holdForQuietHours pauses the running job while it is quiet, if the job is
+// unattended; otherwise it returns at once. It is called between files — by the walk
+// before it starts the next one, by a re-tag before the next item — so a pause never
+// lands inside a write. The pause is recorded under the run's tagging event (holdEvent)
+// and the phase reads PhaseQuietHours until it ends. It returns ctx's error if the job
+// is stopped while paused.
+func (r *Runner) holdForQuietHours(ctx context.Context) error {
+	key, unattended := r.currentUnattended()
+	if !unattended {
+		return nil
+	}
+	until, held := r.quietHours.Until()
+	if !held {
+		return nil
+	}
+
+	logger.Log.Infof("quiet hours until %s; pausing before the next file", until.Format("15:04"))
+	started := time.Now()
+	pause := events.BeginChild(r.db, r.holdEvent, models.EventTypeQuietHours, "Paused for quiet hours")
+	phase := r.progressSnapshot().Phase
+	r.setPhase(PhaseQuietHours)
+	defer r.setPhase(phase)
+
+	for held && unattended {
+		timer := time.NewTimer(min(time.Until(until), quiet.RecheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			events.Finish(r.db, pause, models.EventStatusCancelled, "Stopped while paused for quiet hours", map[string]any{"job": key})
+			return ctx.Err()
+		case <-timer.C:
+		}
+		until, held = r.quietHours.Until()
+		_, unattended = r.currentUnattended()
+	}
+
+	paused := time.Since(started).Round(time.Second)
+	summary := fmt.Sprintf("Paused for %s", paused)
+	if !unattended {
+		summary += "; resumed on request"
+	}
+	logger.Log.Infof("quiet hours over; resuming after %s", paused)
+	events.Finish(r.db, pause, models.EventStatusOK, summary, map[string]any{
+		"job":    key,
+		"paused": paused.String(),
+	})
+	return nil
+}
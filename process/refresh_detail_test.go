@@ -1,6 +1,7 @@
 package process
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -117,7 +118,7 @@ func TestRetagReleasesRecordsOnlyReleasesThatCausedAWrite(t *testing.T) {
 	detail := components.NewDetailCollector(models.DefaultEventDetailRetention)
 
 	changed := []string{"rel-1", "rel-2"}
-	res := r.retagReleases(changed, refreshSet, detail, scopeFilter{})
+	res := r.retagReleases(context.Background(), changed, refreshSet, detail, scopeFilter{})
 
 	// The releases are still counted: what changed upstream is true whatever it cost
 	// in file writes, and the counter is what the activity's summary reports.
@@ -0,0 +1,155 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/rename"
+	"github.com/google/uuid"
+)
+
+// ErrNotNativeManaged refuses a rename of, or an import into, a library Lidarr
+// manages: its layout is Lidarr's naming scheme, and files moved under it would be
+// lost to Lidarr.
+var ErrNotNativeManaged = errors.New("only libraries Autotaggerr manages can be renamed or imported into; this one is managed by Lidarr")
+
+// ErrNoNamingTemplate refuses a rename of a library with no template set.
+var ErrNoNamingTemplate = errors.New("this library has no naming template")
+
+// PreviewRename plans the library's naming template without moving anything: every
+// file that would move, with where to, and every one that would stay and why. It is
+// the same plan RenameLibrary applies, built from the same tags, so what the preview
+// shows is what the run does — unless the library changes in between, which is why
+// the run plans again rather than taking this one.
+func (r *Runner) PreviewRename(libraryID uuid.UUID) (rename.Plan, error) {
+	library, t, err := r.renameTarget(libraryID)
+	if err != nil {
+		return rename.Plan{}, err
+	}
+	return r.planRename(library, t)
+}
+
+// RenameLibrary queues the library's rename. It answers an unknown library, a
+// Lidarr-managed one and one with no template now; the moves happen on the queue
+// worker, as a file-writing job, so a rename never runs alongside a scan tagging the
+// files it is moving.
+func (r *Runner) RenameLibrary(libraryID uuid.UUID) error {
+	library, _, err := r.renameTarget(libraryID)
+	if err != nil {
+		return err
+	}
+	r.enqueue(job{jobRenameLibrary, "rename_library:" + libraryID.String(), "Rename files in " + library.Name, func(ctx context.Context) {
+		r.renameLibraryNow(ctx, libraryID)
+	}})
+	return nil
+}
+
+// renameTarget loads a library and its template, refusing what cannot be renamed.
+func (r *Runner) renameTarget(libraryID uuid.UUID) (models.Library, rename.Template, error) {
+	var library models.Library
+	if err := r.db.First(&library, "id = ?", libraryID).Error; err != nil {
+		return models.Library{}, rename.Template{}, err
+	}
+	manager, _, err := components.BuildForLibrary(r.db, library)
+	if err != nil {
+		return models.Library{}, rename.Template{}, err
+	}
+	if manager.Type() != models.ManagerTypeAutotaggerr {
+		return models.Library{}, rename.Template{}, ErrNotNativeManaged
+	}
+	if strings.TrimSpace(library.NamingTemplate) == "" {
+		return models.Library{}, rename.Template{}, ErrNoNamingTemplate
+	}
+	t, err := rename.Parse(library.NamingTemplate)
+	if err != nil {
+		return models.Library{}, rename.Template{}, fmt.Errorf("the naming template is invalid: %w", err)
+	}
+	return library, t, nil
+}
+
+// planRename builds the plan over the library's taggable files. Only those: a file
+// with no correlation has no tags to be named from, and one in error is waiting on
+// somebody; both are left where they are and not listed.
+func (r *Runner) planRename(library models.Library, t rename.Template) (rename.Plan, error) {
+	_, tagger, err := components.BuildForLibrary(r.db, library)
+	if err != nil {
+		return rename.Plan{}, err
+	}
+	var items []models.LibraryItem
+	if err := r.db.Where("library_id = ?", library.ID).Scopes(models.TaggableItems).
+		Order("path").Find(&items).Error; err != nil {
+		return rename.Plan{}, err
+	}
+	settings := tagger.Settings()
+	return rename.Build(library.Path, t, items, func(item models.LibraryItem) (models.FileTags, error) {
+		tags, _, _, err := components.DesiredTags(r.meta, settings, item)
+		return tags, err
+	}), nil
+}
+
+func (r *Runner) renameLibraryNow(ctx context.Context, libraryID uuid.UUID) {
+	library, t, err := r.renameTarget(libraryID)
+	if err != nil {
+		logger.Log.Warnf("rename skipped for library %s: %s", libraryID, err.Error())
+		return
+	}
+
+	event := events.Begin(r.db, models.EventTypeRename, "Rename files in "+library.Name)
+	r.holdEvent = event
+	defer func() { r.holdEvent = nil }()
+
+	plan, err := r.planRename(library, t)
+	if err != nil {
+		logger.Log.Warnf("failed to plan the rename of %s: %s", library.Name, err.Error())
+		events.Finish(r.db, event, models.EventStatusError, "Could not plan the rename: "+err.Error(), map[string]any{
+			"library":    library.Name,
+			"library_id": libraryID.String(),
+		})
+		return
+	}
+	logger.Log.Infof("renaming %d files in library: %s", plan.Moving(), library.Name)
+	res := rename.Apply(ctx, r.db, plan, rename.Options{Root: library.Path, Hold: r.holdForQuietHours})
+	events.AddItems(r.db, event, res.Items)
+
+	// The collection's release folders are derived from the files' paths, so a rename
+	// that moved anything leaves it pointing at folders that are gone.
+	if res.Moved > 0 {
+		r.rebuildCollection(event)
+	}
+
+	summary := fmt.Sprintf("%d files moved · %d skipped · %d failed", res.Moved, res.Skipped, res.Failed)
+	status := models.EventStatusOK
+	switch {
+	case res.Cancelled:
+		status = models.EventStatusCancelled
+		summary += " · stopped early"
+	case res.Failed > 0:
+		status = models.EventStatusError
+	}
+	logger.Log.Infof("rename finished for %s. %s", library.Name, summary)
+	event.Stats = []models.EventStat{
+		{Label: "Files moved", Value: res.Moved, Kind: models.EventStatNotable, Filter: models.EventItemStatusMoved},
+		{Label: "Files unchanged", Value: plan.Unchanged, Kind: models.EventStatMuted},
+		{Label: "Skipped", Value: res.Skipped, Filter: models.EventItemStatusSkipped},
+		{Label: "Failed", Value: res.Failed, Kind: models.EventStatBad, Filter: models.EventItemStatusError},
+	}
+	events.Finish(r.db, event, status, summary, map[string]any{
+		"library":         library.Name,
+		"library_id":      libraryID.String(),
+		"template":        library.NamingTemplate,
+		"moved":           res.Moved,
+		"unchanged":       plan.Unchanged,
+		"skipped":         res.Skipped,
+		"failed":          res.Failed,
+		"files_carried":   res.CarriedPaths(),
+		"folders_removed": res.FoldersRemoved,
+		"folders_kept":    res.FoldersKept,
+		"cancelled":       res.Cancelled,
+	})
+}
@@ -0,0 +1,229 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/utilities"
+	"github.com/google/uuid"
+)
+
+// ErrNothingJournaled refuses a rollback with nothing to put back: the event wrote no
+// tags, its writes were rolled back already, or the journal has aged them out.
+var ErrNothingJournaled = errors.New("no tag writes are journaled for this, so there is nothing to roll back")
+
+// journalDays converts the configured days, where zero means the default and a
+// negative value turns the journal off, which is returned as zero.
+func journalDays(days int) int {
+	if days == 0 {
+		return models.DefaultTagJournalDays
+	}
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// newDetail opens a run's detail collector, journaling its tag writes under event
+// unless the journal is off. Every tag-writing run builds its collector here, so a
+// write reported in Activity is one that can be rolled back.
+func (r *Runner) newDetail(event *models.Event) *components.DetailCollector {
+	detail := components.NewDetailCollector(r.detailRetention)
+	if r.journalDays > 0 && event != nil {
+		detail.Journal(r.db, event.ID)
+	}
+	return detail
+}
+
+// RollbackEvent queues putting back every journaled tag write of an event and its
+// stages, so the run and its tagging stage roll back the same writes. It answers an
+// event with nothing journaled now; the writes happen on the queue worker, as a
+// file-writing job.
+func (r *Runner) RollbackEvent(eventID uuid.UUID) error {
+	var count int64
+	if err := components.EventJournal(r.db, eventID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNothingJournaled
+	}
+	title := "Roll back an activity"
+	var event models.Event
+	if err := r.db.Select("title").First(&event, "id = ?", eventID).Error; err == nil && event.Title != "" {
+		title = "Roll back: " + event.Title
+	}
+	r.enqueue(job{jobRollbackEvent, "rollback_event:" + eventID.String(), title, func(ctx context.Context) {
+		var entries []models.TagJournalEntry
+		if err := components.EventJournal(r.db, eventID).Find(&entries).Error; err != nil {
+			logger.Log.Warnf("failed to load the journal of event %s: %s", eventID, err.Error())
+			return
+		}
+		r.rollbackNow(ctx, title, entries, map[string]any{"rolled_back_event": eventID.String()})
+	}})
+	return nil
+}
+
+// RollbackItem queues putting one file back as it was before its last journaled
+// write. A rollback's own writes are passed over, so pressing it again steps further
+// back rather than undoing the undo.
+func (r *Runner) RollbackItem(itemID uuid.UUID) error {
+	var item models.LibraryItem
+	if err := r.db.First(&item, "id = ?", itemID).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := components.ItemJournal(r.db, item).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNothingJournaled
+	}
+	title := "Roll back " + filepath.Base(item.Path)
+	r.enqueue(job{jobRollbackItem, "rollback_item:" + itemID.String(), title, func(ctx context.Context) {
+		var entry models.TagJournalEntry
+		if err := components.ItemJournal(r.db, item).Limit(1).Find(&entry).Error; err != nil || entry.ID == uuid.Nil {
+			logger.Log.Infof("nothing left to roll back for %s", item.Path)
+			return
+		}
+		r.rollbackNow(ctx, title, []models.TagJournalEntry{entry}, map[string]any{"library_item_id": itemID.String()})
+	}})
+	return nil
+}
+
+// rollbackNow puts entries back, newest first, under a rollback event of its own. Each
+// field is only put back while it still holds what the journaled write left: one
+// changed since — by a later run, by hand, by another tool — is somebody's newer
+// decision, and is kept and listed rather than overwritten with something older.
+func (r *Runner) rollbackNow(ctx context.Context, title string, entries []models.TagJournalEntry, details map[string]any) {
+	r.resetProgress()
+	event := events.Begin(r.db, models.EventTypeRollback, title)
+	detail := components.NewDetailCollector(r.detailRetention)
+
+	var restored, kept, failed int
+	cancelled := false
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			cancelled = true
+			break
+		}
+		fields, keptFields, err := r.rollbackEntry(entry, event, detail)
+		switch {
+		case err != nil:
+			failed++
+			continue
+		case fields > 0:
+			restored++
+		}
+		kept += len(keptFields)
+		now := time.Now()
+		if err := r.db.Model(&models.TagJournalEntry{}).Where("id = ?", entry.ID).Updates(map[string]any{
+			"rolled_back_at":    now,
+			"rollback_event_id": event.ID,
+		}).Error; err != nil {
+			logger.Log.Warnf("failed to mark a journal entry of %q rolled back: %s", entry.Path, err.Error())
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d files rolled back · %d fields kept · %d errors", restored, len(entries), kept, failed)
+	status := models.EventStatusOK
+	switch {
+	case cancelled:
+		status = models.EventStatusCancelled
+		summary += " · stopped early"
+	case failed > 0:
+		status = models.EventStatusError
+	}
+	logger.Log.Infof("rollback finished. %s", summary)
+	details["files_in_scope"] = len(entries)
+	details["restored"] = restored
+	details["fields_kept"] = kept
+	details["failed"] = failed
+	event.Stats = []models.EventStat{
+		{Label: "Files rolled back", Value: restored, Kind: models.EventStatNotable, Filter: models.EventItemStatusChanged},
+		{Label: "Fields kept", Value: kept, Filter: models.EventItemStatusSkipped},
+		{Label: "Failed", Value: failed, Kind: models.EventStatBad, Filter: models.EventItemStatusError},
+	}
+	events.Finish(r.db, event, status, summary, details)
+	events.AddItems(r.db, event, detail.Items())
+	events.Prune(r.db, r.eventRetention)
+	components.PruneJournal(r.db, r.journalDays)
+}
+
+// rollbackEntry puts one file's journaled fields back, reporting how many it wrote and
+// which it kept. The file is found through its index row where there is one, so a
+// file renamed since the write is still the one written to.
+func (r *Runner) rollbackEntry(entry models.TagJournalEntry, event *models.Event, detail *components.DetailCollector) (int, []string, error) {
+	path := entry.Path
+	var item models.LibraryItem
+	if entry.LibraryItemID != nil {
+		if err := r.db.First(&item, "id = ?", *entry.LibraryItemID).Error; err == nil {
+			path = item.Path
+		}
+	}
+
+	current, err := modules.GetFileTagsMap(path)
+	if err != nil {
+		detail.AddError(path, err)
+		return 0, nil, err
+	}
+	restore := map[string][]string{}
+	var keptFields []string
+	for _, change := range entry.Changes {
+		if !modules.RestorableField(path, change.Field) || !utilities.SameTagValues(current[strings.ToUpper(change.Field)], change.After) {
+			keptFields = append(keptFields, change.Field)
+			continue
+		}
+		restore[change.Field] = change.Before
+	}
+	if len(keptFields) > 0 {
+		detail.AddSkipped(path, "changed since the write, or cannot be put back; kept as they are: "+strings.Join(keptFields, ", "))
+	}
+	if len(restore) == 0 {
+		return 0, keptFields, nil
+	}
+
+	before, _ := os.Stat(path)
+	unchanged, written, changes, err := modules.SetFileTags(path, models.FileTags{Restore: restore}, models.TaggerSettings{})
+	if err != nil {
+		detail.AddError(path, err)
+		return 0, keptFields, err
+	}
+	if unchanged {
+		return 0, keptFields, nil
+	}
+	detail.AddChanged(path, written, changes)
+
+	// Journaled like any other write, so the rollback's event can itself be rolled
+	// back; Undoes is what keeps the file's own rollback from stepping onto it.
+	if fields := components.JournalChanges(changes); r.journalDays > 0 && len(fields) > 0 && event != nil {
+		undone := entry.ID
+		components.RecordJournal(r.db, models.TagJournalEntry{
+			EventID: event.ID, LibraryItemID: entry.LibraryItemID, Path: path, Changes: fields, Undoes: &undone,
+		})
+	}
+
+	// The row's identity and tag hash move with the file, as after any write: left
+	// stale, the next scan would take the rollback for an edit by another tool.
+	if item.ID != uuid.Nil {
+		updates := map[string]any{"last_tagged_at": time.Now()}
+		if fi, statErr := os.Stat(path); statErr == nil {
+			updates["size"] = fi.Size()
+			updates["mod_time"] = fi.ModTime()
+		}
+		updates["content_hash"], updates["tag_state_hash"] = components.ItemHashes(item, before)
+		if err := r.db.Model(&models.LibraryItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+			logger.Log.Warnf("failed to update item after rollback: %s", err.Error())
+		}
+	}
+	return len(restore), keptFields, nil
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/components"
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+)
+
+// bareFlac writes a FLAC with nothing but a STREAMINFO block in front of bytes
+// standing in for the frames — enough for the tag engine, which never decodes audio.
+func bareFlac(t *testing.T) string {
+	t.Helper()
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo[0:], 4096)
+	binary.BigEndian.PutUint16(streamInfo[2:], 4096)
+	binary.BigEndian.PutUint32(streamInfo[10:], 44100<<12|15<<4)
+	file := append([]byte("fLaC\x80\x00\x00\x22"), streamInfo...)
+	file = append(file, 0xff, 0xf8)
+	file = append(file, bytes.Repeat([]byte{0x5a}, 4000)...)
+	path := filepath.Join(t.TempDir(), "01 track.flac")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestRollbackPutsBackWhatTheWriteChanged journals one write, lets another tool edit
+// one of its fields afterwards, and rolls the event back: the untouched field goes
+// back, the field edited since is kept and listed, the entry is marked, and the
+// rollback's own write is journaled as the undo of it — which the file's own
+// rollback then passes over.
+func TestRollbackPutsBackWhatTheWriteChanged(t *testing.T) {
+	db := newTestDB(t)
+	path := bareFlac(t)
+	if _, _, _, err := modules.SetFileTags(path, models.FileTags{Title: "Old"}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	item := models.LibraryItem{Path: path, Status: models.LibraryItemStatusOK}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRunner(db, nil, models.ConfigStruct{})
+	run := events.Begin(db, models.EventTypeTagFiles, "Tag files")
+	_, written, changes, err := modules.SetFileTags(path, models.FileTags{Title: "New", Album: "Album"}, models.TaggerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.newDetail(run).AddChanged(path, written, changes)
+	if _, _, _, err := modules.SetFileTags(path, models.FileTags{Album: "Edited"}, models.TaggerSettings{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []models.TagJournalEntry
+	if err := components.EventJournal(db, run.ID).Find(&entries).Error; err != nil || len(entries) != 1 {
+		t.Fatalf("journal = %v (%v), want one entry", entries, err)
+	}
+	if entries[0].LibraryItemID == nil || *entries[0].LibraryItemID != item.ID {
+		t.Errorf("entry item = %v, want %s", entries[0].LibraryItemID, item.ID)
+	}
+	r.rollbackNow(context.Background(), "Roll back", entries, map[string]any{})
+
+	tags, err := modules.GetFileTagsMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags["TITLE"]; len(got) != 1 || got[0] != "Old" {
+		t.Errorf("TITLE = %v, want it put back to Old", got)
+	}
+	if got := tags["ALBUM"]; len(got) != 1 || got[0] != "Edited" {
+		t.Errorf("ALBUM = %v, want the later edit kept", got)
+	}
+
+	var marked models.TagJournalEntry
+	db.First(&marked, "id = ?", entries[0].ID)
+	if marked.RolledBackAt == nil || marked.RollbackEventID == nil {
+		t.Errorf("entry not marked rolled back: %+v", marked)
+	}
+	var rows []models.EventItem
+	db.Where("event_id = ?", *marked.RollbackEventID).Find(&rows)
+	statuses := map[string]bool{}
+	for _, row := range rows {
+		statuses[row.Status] = true
+	}
+	if !statuses[models.EventItemStatusChanged] || !statuses[models.EventItemStatusSkipped] {
+		t.Errorf("rollback rows = %+v, want a changed and a skipped row", rows)
+	}
+
+	var undo models.TagJournalEntry
+	if err := db.First(&undo, "undoes = ?", marked.ID).Error; err != nil {
+		t.Fatalf("the rollback's write was not journaled: %v", err)
+	}
+	if err := r.RollbackItem(item.ID); !errors.Is(err, ErrNothingJournaled) {
+		t.Errorf("RollbackItem after the only write was undone = %v, want ErrNothingJournaled", err)
+	}
+}
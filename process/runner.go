@@ -31,6 +31,7 @@ import (
 	"github.com/aunefyren/autotaggerr/mirror"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/quiet"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -59,10 +60,14 @@ const (
 	PhaseCounting   = "counting"   // walking every root to size the run
 	PhaseRefresh    = "refresh"    // re-reading metadata due for a refresh
 	PhaseScanning   = "scanning"   // walking libraries and tagging files
+	PhaseAlbumGain  = "album_gain" // re-tagging releases whose album gain the walk moved
 	PhaseDrift      = "drift"      // re-tagging files of upstream-changed releases
 	PhasePlex       = "plex"       // telling Plex to refresh changed albums
 	PhaseMigrations = "migrations" // applying MusicBrainz redirects/deletions
 	PhaseCollection = "collection" // re-deriving the collection and mirroring the manager
+	// PhaseQuietHours is not a stage but a pause within one: an unattended run waiting
+	// at a file boundary for quiet hours to end (see quiet.go).
+	PhaseQuietHours = "quiet_hours"
 )
 
 // Summary is the status of the current or most recent scan, plus the job queue.
@@ -91,6 +96,10 @@ type Summary struct {
 	Phase   string `json:"phase,omitempty"`
 	Current string `json:"current,omitempty"`
 
+	// QuietUntil is when the current quiet window ends, set only while it is quiet. The
+	// queue view reads it to say why an unattended job is waiting.
+	QuietUntil *time.Time `json:"quiet_until,omitempty"`
+
 	// Indexed is how many files are in `library_items` right now. It is not about the
 	// current run at all: it is the precondition the three cheap verbs share, and the
 	// UI reads it to say "run Process first" on a button rather than letting someone
@@ -112,6 +121,13 @@ type Runner struct {
 	// is alive: a scan reads it when it starts a walk, and the API writes it from a
 	// request goroutine.
 	concurrency atomic.Int64
+	// formatConcurrency caps files of one format in flight (see modules.WalkLimits),
+	// swapped whole by SetFormatConcurrency so a walk starting reads a consistent map.
+	formatConcurrency atomic.Pointer[map[string]int]
+	// bandwidth is the I/O ceiling every walk this runner starts is charged against.
+	// One limiter for the runner's lifetime, its rate changed in place, so a new
+	// ceiling applies to the walk already running from its next file.
+	bandwidth *modules.IOLimiter
 
 	// meta is the MusicBrainz metadata source the runner passes to the collection
 	// derivations it drives (SyncArtist). Defaulted to the real source in NewRunner;
@@ -131,13 +147,34 @@ type Runner struct {
 	// which "showing 500 of 3120" stays true for the rows already collected.
 	eventRetention  int
 	detailRetention int
+	// journalDays is how long tag writes stay in the undo journal (see rollback.go).
+	// Zero is the journal switched off: nothing is journaled, and the next prune
+	// empties it.
+	journalDays int
+
+	// resumeWindow is how long after a run stops short a run of the same scope picks
+	// up from its checkpoint (see checkpoint.go). Zero turns resuming off.
+	resumeWindow time.Duration
+
+	// quietHours holds back unattended jobs (see quiet.go). Read live from config, so
+	// an edit on the settings page needs no setter; nil in tests, which is never quiet.
+	quietHours *quiet.Hours
+	// holdEvent is what a pause for quiet hours is recorded under: the running scan's
+	// tagging event. Only the worker goroutine touches it.
+	holdEvent *models.Event
 
 	running atomic.Bool // a job is currently executing
 	// stopping is set by Shutdown. From then on the queue accepts nothing and the
-	// worker starts no further job — what is already running is left to finish.
+	// worker starts no further job — what is already running is cancelled and
+	// waited for.
 	stopping atomic.Bool
 	jobMu    sync.Mutex // held for the duration of each job; TryLock'd by interactive re-tags
 
+	// cancel stops the running job's context; nil between jobs. Set by the worker
+	// around each job, called by Cancel and Shutdown.
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc
+
 	// The job queue: a single worker (started in NewRunner) drains `queue` one at a
 	// time, so every background verb is serial and visible. `current` is the executing
 	// job; `wake` nudges the worker when something is enqueued.
@@ -145,6 +182,11 @@ type Runner struct {
 	queue   []job
 	current *job
 	wake    chan struct{}
+	// unattended holds the keys of pending or running jobs nobody asked for, and
+	// deferred the ones whose wait for quiet hours is already in the feed, with the
+	// window end it was recorded against. Both are made on first use.
+	unattended map[string]bool
+	deferred   map[string]time.Time
 
 	statusMu sync.Mutex
 	summary  Summary
@@ -159,8 +201,10 @@ type Runner struct {
 	progCurrent atomic.Pointer[string]
 }
 
-// NewRunner builds a runner and starts its queue worker. plex may be nil (Plex
-// refresh is then skipped).
+// NewRunner builds a runner, restores the queue the last process left (see
+// restoreQueue) and starts its queue worker. plex may be nil (Plex refresh is then
+// skipped). Build it after events.ReconcileRunning, or a restored job could start
+// before the previous process's orphaned events are closed.
 //
 // The metadata runner is constructed here rather than passed in. It is wired with a
 // nil yieldTo: the queue serialises every background job, so a metadata pass never
@@ -177,9 +221,16 @@ func NewRunner(db *gorm.DB, plex *modules.PlexClient, cfg models.ConfigStruct) *
 		wake:            make(chan struct{}, 1),
 		eventRetention:  retentionOrDefault(cfg.AutotaggerrEventRetention, models.DefaultEventRetention),
 		detailRetention: retentionOrDefault(cfg.AutotaggerrEventDetailRetention, models.DefaultEventDetailRetention),
+		journalDays:     journalDays(cfg.AutotaggerrTagJournalDays),
+		resumeWindow:    resumeWindow(cfg.AutotaggerrProcessResumeHours),
+		bandwidth:       modules.NewIOLimiter(0),
+		quietHours:      quiet.New(func() string { return files.ConfigFile.AutotaggerrQuietHours }),
 	}
-	r.SetConcurrency(cfg.AutotaggerrProcessConcurrency)
+	r.ApplyLimits(cfg)
 	r.refresh = mirror.NewRunner(db, nil, cfg)
+	// Before the worker starts, so the first job to run is the first one stored
+	// rather than whichever the replay happened to queue first.
+	r.restoreQueue()
 	go r.worker()
 	return r
 }
@@ -202,6 +253,44 @@ func (r *Runner) SetConcurrency(workers int) {
 // Concurrency reports the current worker count.
 func (r *Runner) Concurrency() int { return int(r.concurrency.Load()) }
 
+// SetFormatConcurrency changes the per-format caps, keyed by extension without the dot.
+// Like the worker count it applies from the next walk.
+func (r *Runner) SetFormatConcurrency(caps map[string]int) {
+	copied := make(map[string]int, len(caps))
+	for format, limit := range caps {
+		copied[format] = limit
+	}
+	r.formatConcurrency.Store(&copied)
+}
+
+// SetIOLimit changes the bandwidth ceiling, in megabytes per second; 0 lifts it. Unlike
+// the worker counts it reaches the walk already running, at its next file.
+func (r *Runner) SetIOLimit(megabytesPerSecond int) {
+	r.bandwidth.SetRate(int64(megabytesPerSecond) << 20)
+}
+
+// ApplyLimits takes every process-wide walk limit from cfg: the startup path, and what
+// the settings page calls when one of them is saved.
+func (r *Runner) ApplyLimits(cfg models.ConfigStruct) {
+	r.SetConcurrency(cfg.AutotaggerrProcessConcurrency)
+	r.SetFormatConcurrency(cfg.AutotaggerrProcessFormatConcurrency)
+	r.SetIOLimit(cfg.AutotaggerrProcessIOLimitMB)
+}
+
+// walkLimits is what a walk over library is held to: the library's own worker count if
+// it has one, the runner's otherwise, the process-wide format caps and ceiling, and
+// quiet hours if the job is unattended.
+func (r *Runner) walkLimits(library models.Library) modules.WalkLimits {
+	limits := modules.WalkLimits{Workers: r.Concurrency(), Bandwidth: r.bandwidth, Hold: r.holdForQuietHours}
+	if library.ProcessConcurrency > 0 {
+		limits.Workers = library.ProcessConcurrency
+	}
+	if caps := r.formatConcurrency.Load(); caps != nil {
+		limits.PerFormat = *caps
+	}
+	return limits
+}
+
 // Status returns a copy of the current/last scan summary plus the queue. Running is
 // taken from the atomic so it reflects both queue jobs and the interactive re-tags
 // that never touch the summary; while a job runs the live progress of whatever is
@@ -234,6 +323,9 @@ func (r *Runner) Status() Summary {
 		}
 		s.Indexed = int(indexed)
 	}
+	if until, held := r.quietHours.Until(); held {
+		s.QuietUntil = &until
+	}
 	return s
 }
 
@@ -312,34 +404,40 @@ func (r *Runner) Wait() {
 	}
 }
 
-// Shutdown stops the queue and waits for the job in flight, returning ctx's error if
-// that job outlasts the deadline.
+// Shutdown stops the queue, cancels the job in flight and waits for it to stop,
+// returning ctx's error if that job outlasts the deadline.
 //
 // It is not Wait. Wait drains the whole queue, which at shutdown is the wrong
 // promise: a full scan sitting behind the running job would hold the process open for
-// hours after someone asked it to stop. So the pending jobs are dropped — none of
-// them has started, none has an event, and every verb here is re-runnable by design —
-// and only the one already executing is given time to finish, because *that* one has
-// written files and opened an event.
+// hours after someone asked it to stop. So the pending jobs are left where they are —
+// in the stored queue, for restoreQueue to pick up at the next start — and the one
+// already executing is cancelled the way the cancel button cancels it, then put back
+// at the head of that queue.
 //
-// Nothing is cancelled mid-job: the runner has no cancellation to thread through a
-// tag write, and interrupting one is how a file ends up half-written. A job that
-// outlasts the deadline is left to the process exiting under it, which is the crash
-// case the caller already survives — events.ReconcileRunning closes its event on the
-// next boot.
+// Cancelling is not interrupting. A job stops at its next boundary — the files in
+// flight finish their writes, a metadata pass finishes the entity it is on — and
+// closes its event as cancelled with what it got through, so the wait here is for
+// seconds rather than for the rest of a scan. A job that still outlasts the deadline
+// is left to the process exiting under it, which is the crash case the caller already
+// survives — events.ReconcileRunning closes its event on the next boot.
 func (r *Runner) Shutdown(ctx context.Context) error {
 	r.stopping.Store(true)
 
+	// Cleared in memory only: the stored queue keeps them for the next start (see
+	// restoreQueue). The worker must not pull them now — a job started here would only
+	// be cancelled again, leaving a stopped run in the feed that did nothing.
 	r.queueMu.Lock()
-	dropped := len(r.queue)
+	kept := len(r.queue)
 	r.queue = nil
 	views := r.queueViewsLocked()
 	r.queueMu.Unlock()
-	if dropped > 0 {
-		logger.Log.Infof("shutting down: dropped %d queued job(s) that had not started", dropped)
+	if kept > 0 {
+		logger.Log.Infof("shutting down: %d queued job(s) kept for the next start", kept)
 		r.setStatus(func(s *Summary) { s.Queue = views })
 	}
 
+	r.Cancel()
+
 	// Wake the worker so it observes `stopping` and parks instead of sitting on an
 	// empty queue.
 	select {
@@ -386,6 +484,8 @@ type Scope struct {
 	// whole point is to pull a changed Lidarr release selection down onto files whose
 	// bytes never moved.
 	Force bool
+	// DryRun, when set, makes Run queue the scope's dry run instead (see DryRun).
+	DryRun *DryRun
 }
 
 // ErrNothingToProcess reports a scope that resolved to no folders on disk. It is a
@@ -429,8 +529,8 @@ func (r *Runner) ArtistScope(artistMBID string) (Scope, error) {
 		map[string]any{"artist": artist.Name, "artist_mb_id": artistMBID}, found), nil
 }
 
-// ReleaseGroupScope covers the album folders of one release-group, for the narrowest
-// force re-correlate. It returns ErrNothingToProcess when nothing is owned of the group,
+// ReleaseGroupScope covers the album folders of one release-group, for the album verbs
+// and the narrowest force re-correlate. It returns ErrNothingToProcess when nothing is owned of the group,
 // and the DB error when the release-group is unknown.
 func (r *Runner) ReleaseGroupScope(rgMBID string) (Scope, error) {
 	var rg models.CollectionReleaseGroup
@@ -452,6 +552,51 @@ func (r *Runner) ReleaseGroupScope(rgMBID string) (Scope, error) {
 		map[string]any{"release_group": title, "release_group_mb_id": rgMBID}, found), nil
 }
 
+// ReleaseScope covers the folders of one edition — what is left to fix when an album
+// holds two editions and only one of them is wrong. It returns ErrNothingToProcess when
+// no file of the edition is indexed, and the DB error when the edition is unknown.
+func (r *Runner) ReleaseScope(releaseMBID string) (Scope, error) {
+	var release models.CollectionRelease
+	if err := r.db.Where("mb_id = ?", releaseMBID).First(&release).Error; err != nil {
+		return Scope{}, err
+	}
+	found, err := collection.ReleaseTargets(r.db, releaseMBID)
+	if err != nil {
+		return Scope{}, err
+	}
+	if len(found) == 0 {
+		return Scope{}, ErrNothingToProcess
+	}
+	title := release.Title
+	if title == "" {
+		title = releaseMBID
+	}
+	if release.Disambiguation != "" {
+		title += " (" + release.Disambiguation + ")"
+	}
+	return buildScope("Processing "+title,
+		map[string]any{"release": title, "release_mb_id": releaseMBID, "release_group_mb_id": release.ReleaseGroupMBID}, found), nil
+}
+
+// FolderScope covers a set of folders in one library — what the filesystem watcher
+// hands over once an import has settled. The folders are walked recursively like any
+// other root, so an artist folder moved in whole is one folder here.
+func FolderScope(library models.Library, folders []string) Scope {
+	title := "Processing " + library.Name
+	if len(folders) == 1 {
+		if rel, err := filepath.Rel(library.Path, folders[0]); err == nil && rel != "." {
+			title = "Processing " + filepath.ToSlash(rel)
+		}
+	} else {
+		title = fmt.Sprintf("Processing %d folders in %s", len(folders), library.Name)
+	}
+	return Scope{
+		Title:   title,
+		Targets: []Target{{Library: library, Roots: folders}},
+		Detail:  map[string]any{"folders": folders, "trigger": "watcher"},
+	}
+}
+
 // buildScope groups per-folder targets by library into scan Targets and records the
 // walked folders in Detail. Shared by every partial scope (artist, release-group) so
 // they resolve targets identically: one Target per library, since each walk correlates
@@ -479,12 +624,21 @@ func buildScope(title string, detail map[string]any, found []collection.ArtistTa
 // RunAll queues a scan of every enabled library. Deduped against an identical scan
 // already queued or running.
 func (r *Runner) RunAll() {
-	r.enqueue(job{jobProcessAll, "process_all", "Process all libraries", r.runAllNow})
+	r.enqueue(r.runAllJob())
+}
+
+// RunAllOnSchedule is RunAll for the cron: the same job, held back by quiet hours.
+func (r *Runner) RunAllOnSchedule() {
+	r.enqueueUnattended(r.runAllJob())
+}
+
+func (r *Runner) runAllJob() job {
+	return job{jobProcessAll, "process_all", "Process all libraries", r.runAllNow}
 }
 
 // runAllNow is the executor: it loads the libraries at run time (not enqueue time, so a
 // library added while queued is included) and scans them.
-func (r *Runner) runAllNow() {
+func (r *Runner) runAllNow(ctx context.Context) {
 	var libraries []models.Library
 	if err := r.db.Where("enabled = ?", true).Order("name").Find(&libraries).Error; err != nil {
 		logger.Log.Error("failed to load libraries from database. error: " + err.Error())
@@ -494,22 +648,60 @@ func (r *Runner) runAllNow() {
 		logger.Log.Info("no enabled libraries configured; nothing to scan")
 		return
 	}
-	r.runScope(LibraryScope(libraries))
+	r.runScope(ctx, LibraryScope(libraries))
 }
 
-// RunLibrary queues a scan of one library by ID. It returns an error only when the
-// library cannot be loaded now; the scan itself runs later on the queue worker.
-func (r *Runner) RunLibrary(id uuid.UUID) error {
-	var library models.Library
-	if err := r.db.First(&library, "id = ?", id).Error; err != nil {
+// RunLibrary queues a scan of one library by ID, or its dry run when dry is set. It
+// returns an error only when the library (or the profile a dry run tries) cannot be
+// loaded now; the scan itself runs later on the queue worker.
+func (r *Runner) RunLibrary(id uuid.UUID, dry *DryRun) error {
+	if dry != nil {
+		var library models.Library
+		if err := r.db.First(&library, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := r.prepareDryRun(dry); err != nil {
+			return err
+		}
+		scope := LibraryScope([]models.Library{library})
+		r.enqueue(job{jobDryRunLibrary, "dry_run_library:" + id.String() + dry.key(), dry.title(scope.Title), func(ctx context.Context) {
+			r.dryRunScope(ctx, scope, *dry)
+		}})
+		return nil
+	}
+	j, err := r.libraryJob(id)
+	if err != nil {
 		return err
 	}
-	r.enqueue(job{jobProcessLibrary, "process_library:" + id.String(), "Processing " + library.Name, func() {
-		r.runScope(LibraryScope([]models.Library{library}))
-	}})
+	r.enqueue(j)
+	return nil
+}
+
+// RunLibraryOnSchedule is RunLibrary for a library's own schedule: held back by quiet
+// hours. A library with an inbox imports it first, so what was dropped there since the
+// last run is in the library by the time the scan walks it.
+func (r *Runner) RunLibraryOnSchedule(id uuid.UUID) error {
+	j, err := r.libraryJob(id)
+	if err != nil {
+		return err
+	}
+	if imp, err := r.importJob(id); err == nil {
+		r.enqueueUnattended(imp)
+	}
+	r.enqueueUnattended(j)
 	return nil
 }
 
+func (r *Runner) libraryJob(id uuid.UUID) (job, error) {
+	var library models.Library
+	if err := r.db.First(&library, "id = ?", id).Error; err != nil {
+		return job{}, err
+	}
+	return job{jobProcessLibrary, "process_library:" + id.String(), "Processing " + library.Name, func(ctx context.Context) {
+		r.runScope(ctx, LibraryScope([]models.Library{library}))
+	}}, nil
+}
+
 // RunArtist queues a scan of one artist's folders. It returns an error when the scope
 // cannot be resolved (unknown artist, no files on disk); the scan itself runs later.
 func (r *Runner) RunArtist(artistMBID string) error {
@@ -517,19 +709,57 @@ func (r *Runner) RunArtist(artistMBID string) error {
 	if err != nil {
 		return err
 	}
-	r.Run(scope)
+	return r.Run(scope)
+}
+
+// RunReleaseGroup queues a scan of one album's folders — the artist scan narrowed to
+// the album somebody is fixing. Like RunArtist it answers an unresolvable scope now and
+// runs later.
+func (r *Runner) RunReleaseGroup(rgMBID string) error {
+	scope, err := r.ReleaseGroupScope(rgMBID)
+	if err != nil {
+		return err
+	}
+	r.enqueue(job{jobProcessReleaseGroup, "process_release_group:" + rgMBID, scope.Title, func(ctx context.Context) {
+		r.runScope(ctx, scope)
+	}})
 	return nil
 }
 
+// RunFolders queues a scan of folders in one library (see FolderScope). The same set
+// of folders queued twice collapses onto one job; the watcher's debounce is what keeps
+// the sets from overlapping in the first place. The watcher is its only caller, so the
+// job is unattended: an import landing in quiet hours is tagged when they end.
+func (r *Runner) RunFolders(library models.Library, folders []string) {
+	sorted := append([]string(nil), folders...)
+	sort.Strings(sorted)
+	scope := FolderScope(library, sorted)
+	key := "process_folders:" + library.ID.String() + ":" + strings.Join(sorted, "\x00")
+	r.enqueueUnattended(job{jobProcessFolders, key, scope.Title, func(ctx context.Context) { r.runScope(ctx, scope) }})
+}
+
 // Run queues a pre-resolved scope. The API resolves the scope first (so "this artist
 // has no files" is answered immediately) and hands the result here; the dedup key comes
 // from the scope title, so a second identical request collapses onto the first.
-func (r *Runner) Run(scope Scope) {
-	key := "process_artist:" + scope.Title
+//
+// A scope with DryRun set is queued as its dry run, under a key of its own, so it
+// neither collapses onto the real run of the same scope nor stands in for it.
+func (r *Runner) Run(scope Scope) error {
+	subject := scope.Title
 	if mbid, ok := scope.Detail["artist_mb_id"].(string); ok && mbid != "" {
-		key = "process_artist:" + mbid
+		subject = mbid
 	}
-	r.enqueue(job{jobProcessArtist, key, scope.Title, func() { r.runScope(scope) }})
+	if dry := scope.DryRun; dry != nil {
+		if err := r.prepareDryRun(dry); err != nil {
+			return err
+		}
+		r.enqueue(job{jobDryRunArtist, "dry_run_artist:" + subject + dry.key(), dry.title(scope.Title), func(ctx context.Context) {
+			r.dryRunScope(ctx, scope, *dry)
+		}})
+		return nil
+	}
+	r.enqueue(job{jobProcessArtist, "process_artist:" + subject, scope.Title, func(ctx context.Context) { r.runScope(ctx, scope) }})
+	return nil
 }
 
 // ForceRecorrelateArtist repairs an artist whose files diverged from what their
@@ -596,9 +826,9 @@ func forceTitle(name, kind string) string {
 // with Force set so shouldSkip is bypassed. Shared by all three force verbs.
 func (r *Runner) enqueueForceRecorrelate(key string, scope Scope) {
 	scope.Force = true
-	r.enqueue(job{jobForceRecorrelate, key, scope.Title, func() {
+	r.enqueue(job{jobForceRecorrelate, key, scope.Title, func(ctx context.Context) {
 		r.prepareForceRecorrelate(scope)
-		r.runScope(scope)
+		r.runScope(ctx, scope)
 	}})
 }
 
@@ -810,7 +1040,12 @@ func scopeIsFull(scope Scope) bool {
 // runScope executes a scan of a scope. It is only ever called by the queue worker,
 // which holds jobMu and the running flag for its duration — so this body takes no guard
 // of its own.
-func (r *Runner) runScope(scope Scope) {
+//
+// ctx is the job's, and cancelling it stops the run at the next file or release (see
+// Cancel). What follows a stopped tagging stage is cut down to what accounts for the
+// files already written — the Plex refresh and the collection rebuild — and the run is
+// recorded as cancelled with the counters it reached.
+func (r *Runner) runScope(ctx context.Context, scope Scope) {
 	start := time.Now()
 	// Reset the scan counters and progress for this run without disturbing the
 	// queue view (CurrentJob / Queue) the worker set.
@@ -824,6 +1059,12 @@ func (r *Runner) runScope(scope Scope) {
 
 	event := events.Begin(r.db, models.EventTypeProcess, scope.Title)
 
+	// Pick up where a stopped run of the same scope left off, if one did recently, and
+	// keep this run's own checkpoint from here on (see checkpoint.go). Stopped before
+	// Finish, for the same reason as the progress flusher below.
+	checkpoint := r.beginCheckpoint(scope, event)
+	stopCheckpoint := r.startCheckpoint(event, checkpoint)
+
 	// Reset the live progress atomics and start the flusher that writes them onto the
 	// running event, so the Activity feed can draw a bar. Stopped before Finish, whose
 	// Save must not race the flusher for the row.
@@ -837,7 +1078,6 @@ func (r *Runner) runScope(scope Scope) {
 	modules.MusicbrainzResetStats()
 
 	refreshSet := modules.NewAlbumRefreshSet(nil)
-	detail := components.NewDetailCollector(r.detailRetention)
 	var processed, unchanged, tagsWritten, removed int
 	var errorFiles []string
 	libraryNames := make([]string, 0, len(scope.Targets))
@@ -850,7 +1090,7 @@ func (r *Runner) runScope(scope Scope) {
 	// It records its own event because it is a disk walk that can take minutes on a
 	// cold library, and it used to happen inside the refresh phase with the bar at
 	// 0 of 0 — a run's first minutes reported as nothing at all.
-	totalFiles := r.countFiles(scope, event)
+	totalFiles := r.countFiles(scope, event, checkpoint)
 	r.progTotal.Store(int64(totalFiles))
 
 	// What this run is allowed to touch through the index rather than through the
@@ -872,7 +1112,10 @@ func (r *Runner) runScope(scope Scope) {
 	// meant the stage a user was actually waiting on had no row to open.
 	r.setPhase(PhaseRefresh)
 	due := r.narrowDue(modules.MusicbrainzDueForRefresh(), filter)
-	refreshResult := r.refresh.RunStage(context.Background(), mirror.DueScope(due), event)
+	refreshResult := r.refresh.RunStage(ctx, mirror.DueScope(due), event)
+	// What drifted, including what the run this one resumes found and never got to:
+	// its refresh already updated the cache, so this one's would not find them again.
+	changedReleases := checkpoint.addDrift(refreshResult.ChangedReleases)
 
 	fullScan := scopeIsFull(scope)
 
@@ -883,9 +1126,23 @@ func (r *Runner) runScope(scope Scope) {
 	// metadata stage had already listed. One activity, two phases in its detail.
 	r.setPhase(PhaseScanning)
 	tagEvent := events.BeginChild(r.db, event, models.EventTypeTagFiles, taggingActivityTitle)
+	detail := r.newDetail(tagEvent)
+	r.holdEvent = tagEvent
+	defer func() { r.holdEvent = nil }()
+	walkStarted := checkpoint.walkStarted(time.Now())
 	for _, target := range scope.Targets {
 		library := target.Library
 		libraryNames = append(libraryNames, library.Name)
+		roots := target.Roots
+		if len(roots) == 0 {
+			roots = []string{library.Path}
+		}
+		// A library the resumed run finished was pruned and stamped by it, too.
+		remaining := checkpoint.remaining(library.ID, roots)
+		if len(remaining) == 0 {
+			logger.Log.Info("already processed by the run this one resumes: " + library.Path)
+			continue
+		}
 		logger.Log.Info("processing library: " + library.Path)
 
 		// Advance the live counter per file and name the artist folder being worked
@@ -897,7 +1154,18 @@ func (r *Runner) runScope(scope Scope) {
 				r.setCurrent(a)
 			}
 		}
-		c, u, tw, errs, err := components.ScanLibraryRoots(r.db, library, target.Roots, r.plex, refreshSet, detail, r.version, r.Concurrency(), scope.Force, onFile)
+		c, u, tw, errs, err := components.ScanLibraryRoots(ctx, r.db, library, remaining, r.plex, refreshSet, detail, r.version, r.walkLimits(library), scope.Force, checkpoint.walkMarks(library.ID, remaining), onFile)
+		if ctx.Err() != nil {
+			// Stopped partway: the files it got through count, but nothing else about
+			// this library does. Pruning on a half-walk would delete the rows of every
+			// file it had not reached, and the library was not scanned.
+			processed += c
+			unchanged += u
+			tagsWritten += tw
+			errorFiles = append(errorFiles, errs...)
+			logger.Log.Info("stopped processing library: " + library.Path)
+			break
+		}
 		if err != nil {
 			logger.Log.Error("failed to process library '" + library.Path + "'. error: " + err.Error())
 			r.setStatus(func(s *Summary) { s.LastError = err.Error() })
@@ -928,9 +1196,24 @@ func (r *Runner) runScope(scope Scope) {
 				logger.Log.Warnf("failed to record last scan time for library %s: %s", library.ID, err.Error())
 			}
 		}
+		checkpoint.finish(library.ID, roots)
 		logger.Log.Info("processed library: " + library.Path)
 	}
 
+	// Album gain. A release's album gain is measured across all of its files, so a
+	// file the walk tagged can change it for siblings the walk skipped as unchanged —
+	// and on a first scan, the album's early tracks were tagged before its last one was
+	// in the index to be measured. Each release the walk touched is re-tagged once the
+	// walk is over, which is a no-op for every file whose gain already holds.
+	if gain := r.albumGainReleases(scope, walkStarted, changedReleases); len(gain) > 0 && ctx.Err() == nil {
+		r.setPhase(PhaseAlbumGain)
+		gainDetail := r.newDetail(tagEvent)
+		settled := r.retagReleases(ctx, gain, refreshSet, gainDetail, filter)
+		tagsWritten += settled.retagged
+		errorFiles = append(errorFiles, settled.errorFiles...)
+		detail.Adopt(gainDetail, models.EventItemPhaseAlbumGain)
+	}
+
 	// Drift re-tag. shouldSkip drops files whose size and mtime are unchanged, which is
 	// every file of a release that changed only *upstream* — so the walk above cannot
 	// have caught them. This is where the refresh stage's findings are acted on, and it
@@ -944,16 +1227,21 @@ func (r *Runner) runScope(scope Scope) {
 	// Its rows join the walk's on the same tagging event, phase-tagged so the detail
 	// list keeps "found on disk" and "changed upstream" apart.
 	drift := releaseRefresh{}
-	if len(refreshResult.ChangedReleases) > 0 {
+	if len(changedReleases) > 0 && ctx.Err() == nil {
 		r.setPhase(PhaseDrift)
-		logger.Log.Infof("%d release(s) changed upstream; re-tagging their files", len(refreshResult.ChangedReleases))
-		driftDetail := components.NewDetailCollector(r.detailRetention)
-		drift = r.retagReleases(refreshResult.ChangedReleases, refreshSet, driftDetail, filter)
+		logger.Log.Infof("%d release(s) changed upstream; re-tagging their files", len(changedReleases))
+		driftDetail := r.newDetail(tagEvent)
+		drift = r.retagReleases(ctx, changedReleases, refreshSet, driftDetail, filter)
 		tagsWritten += drift.retagged
 		errorFiles = append(errorFiles, drift.errorFiles...)
 		detail.Adopt(driftDetail, models.EventItemPhaseDrift)
 	}
 
+	// Decided once, here, at the end of the last stage that stops for it. A cancel
+	// arriving during the stages below is too late to save anything — they are the
+	// bookkeeping for what was written — and is left to expire with the job.
+	cancelled := ctx.Err() != nil
+
 	// The tagging stage is closed out before the stages that follow it, so its row
 	// carries the file counters and the per-file detail rather than the run — the run's
 	// own event used to be these counters, which is why it read as a tagging event with
@@ -966,6 +1254,7 @@ func (r *Runner) runScope(scope Scope) {
 		errorFiles:  errorFiles,
 		drift:       drift,
 		libraries:   libraryNames,
+		cancelled:   cancelled,
 	}, detail)
 
 	r.setPhase(PhasePlex)
@@ -997,6 +1286,9 @@ func (r *Runner) runScope(scope Scope) {
 	if len(errorFiles) > 0 {
 		status = models.EventStatusError
 	}
+	if cancelled {
+		status = models.EventStatusCancelled
+	}
 	recorded := errorFiles
 	if len(recorded) > maxErrorFilesRecorded {
 		recorded = recorded[:maxErrorFilesRecorded]
@@ -1010,15 +1302,21 @@ func (r *Runner) runScope(scope Scope) {
 	// unblocks the drain below — and running it the other way round would retire albums
 	// the refresh was about to correct. Full runs only: a one-artist button should not
 	// set the whole collection refreshing in Lidarr.
-	if scopeIsFull(scope) {
+	//
+	// A stopped run skips both, and the manager sync below: they act on the whole of
+	// what the scan found, and a scan that stopped did not find it.
+	if scopeIsFull(scope) && !cancelled {
 		r.repairGhostAlbums(event)
 	}
 
 	// A scan fetches releases just as a sync does, so it detects redirects and
 	// deletions too — draining the queue here keeps a cold scan from leaving them
 	// for whenever the next sync happens to run.
-	r.setPhase(PhaseMigrations)
-	migrations := r.applyMigrations(event)
+	var migrations migration.Result
+	if !cancelled {
+		r.setPhase(PhaseMigrations)
+		migrations = r.applyMigrations(event)
+	}
 
 	// Re-derive the collection, then refresh the manager mirror against it. Both run
 	// before the event is finished so what they changed can ride it — a rebuild that
@@ -1028,7 +1326,7 @@ func (r *Runner) runScope(scope Scope) {
 	r.setPhase(PhaseCollection)
 	rebuild := r.rebuildCollection(event)
 	mirrored := map[string]any{}
-	if fullScan {
+	if fullScan && !cancelled {
 		syncedArtists, syncedAlbums := r.syncManagers(event)
 		mirrored["artists"] = syncedArtists
 		mirrored["albums"] = syncedAlbums
@@ -1038,8 +1336,20 @@ func (r *Runner) runScope(scope Scope) {
 	// progress, and Finish then Saves the event without racing an in-flight update.
 	stopProgress()
 
+	// A stopped run keeps its checkpoint for the next run of this scope to pick up; a
+	// finished one has nothing left to resume. Set on the struct, because Finish
+	// Saves it over the row.
+	stopCheckpoint()
+	if cancelled {
+		event.Checkpoint = checkpoint.snapshot()
+	}
+
 	summary := scanSummaryLine(processed, changed, tagsWritten, len(errorFiles), removed, rebuild.CreditChanges, refreshResult)
+	if cancelled {
+		summary = cancelledPrefix + summary
+	}
 	details := map[string]any{
+		"cancelled":     cancelled,
 		"migrations":    migrations,
 		"processed":     processed,
 		"unchanged":     unchanged,
@@ -1067,6 +1377,9 @@ func (r *Runner) runScope(scope Scope) {
 	for k, v := range scope.Detail {
 		details[k] = v
 	}
+	if checkpoint.resumedFrom != nil {
+		details["resumed_from"] = checkpoint.resumedFrom.String()
+	}
 	// The run's counters are a roll-up across stages that do not share a unit, so they
 	// carry no Filter: there is no single list they select from. The stages are where
 	// a number becomes a control over rows.
@@ -1085,6 +1398,7 @@ func (r *Runner) runScope(scope Scope) {
 	// the parent would show the same file twice to anyone opening the run.
 	events.Finish(r.db, event, status, summary, details)
 	events.Prune(r.db, r.eventRetention)
+	components.PruneJournal(r.db, r.journalDays)
 }
 
 // countFiles sizes the run and records the walk that did it.
@@ -1093,7 +1407,10 @@ func (r *Runner) runScope(scope Scope) {
 // disk. It used to run inside the refresh phase with the progress bar at 0 of 0, so a
 // run's first minutes reported as nothing happening at all — the shape of a hang. Its
 // own activity says what it is doing and, afterwards, how big the run is.
-func (r *Runner) countFiles(scope Scope, parent *models.Event) int {
+//
+// A resumed run counts only what is left — the roots and files the run it resumes did
+// not get to — so its bar measures the work ahead rather than starting part-full.
+func (r *Runner) countFiles(scope Scope, parent *models.Event, checkpoint *runCheckpoint) int {
 	ev := events.BeginChild(r.db, parent, models.EventTypeCountFiles, "Counting files")
 
 	total := 0
@@ -1104,8 +1421,8 @@ func (r *Runner) countFiles(scope Scope, parent *models.Event) int {
 			roots = []string{target.Library.Path}
 		}
 		n := 0
-		for _, root := range roots {
-			n += modules.CountSupportedFiles(root)
+		for _, root := range checkpoint.remaining(target.Library.ID, roots) {
+			n += modules.CountRemainingFiles(root, checkpoint.mark(target.Library.ID, root))
 		}
 		perLibrary[target.Library.Name] = n
 		total += n
@@ -1160,8 +1477,14 @@ type taggingResult struct {
 	errorFiles  []string
 	drift       releaseRefresh
 	libraries   []string
+	cancelled   bool
 }
 
+// cancelledPrefix leads the summary of a run that was stopped, the same words the
+// metadata pass uses, so a feed of partial counters never reads as a finished run
+// that happened to find little.
+const cancelledPrefix = "stopped early — "
+
 // finishTagging closes a tagging activity: the file counters, the per-file detail, and
 // what the drift half of it did.
 //
@@ -1174,6 +1497,9 @@ func (r *Runner) finishTagging(ev *models.Event, res taggingResult, detail *comp
 	if len(res.errorFiles) > 0 {
 		status = models.EventStatusError
 	}
+	if res.cancelled {
+		status = models.EventStatusCancelled
+	}
 	recorded := res.errorFiles
 	if len(recorded) > maxErrorFilesRecorded {
 		recorded = recorded[:maxErrorFilesRecorded]
@@ -1191,6 +1517,9 @@ func (r *Runner) finishTagging(ev *models.Event, res taggingResult, detail *comp
 		summary += fmt.Sprintf(" · %d re-tagged from %d release(s) changed upstream",
 			res.drift.retagged, res.drift.changedReleases)
 	}
+	if res.cancelled {
+		summary = cancelledPrefix + summary
+	}
 
 	// Both halves declare their counters, but only when they happened: a run where
 	// nothing drifted should not carry two zeroes explaining a stage it never entered.
@@ -1228,6 +1557,7 @@ func (r *Runner) finishTagging(ev *models.Event, res taggingResult, detail *comp
 		"releases_changed": res.drift.changedReleases,
 		"files_retagged":   res.drift.retagged,
 		"detail":           detailSummary(detail),
+		"cancelled":        res.cancelled,
 	})
 
 	// The release rows go on last: they are few, they are the tie between a metadata
@@ -1428,7 +1758,7 @@ func (r *Runner) repairGhostAlbumsWith(parent *models.Event, opts collection.Rep
 //
 // Run via `go` for background execution.
 func (r *Runner) RepairArtistAlbums(artistMBID string) {
-	r.enqueue(job{jobRepairArtist, "repair_artist:" + artistMBID, "Repair albums via the manager", func() {
+	r.enqueue(job{jobRepairArtist, "repair_artist:" + artistMBID, "Repair albums via the manager", func(context.Context) {
 		r.repairArtistAlbumsNow(artistMBID)
 	}})
 }
@@ -1596,11 +1926,21 @@ func migrationItems(outcomes []migration.Outcome) []models.EventItem {
 //
 // Run via `go` for background execution.
 func (r *Runner) SyncDrift() {
-	r.enqueue(job{jobRefreshAll, "refresh_all", "Metadata refresh", r.syncDriftNow})
+	r.enqueue(r.syncDriftJob())
 }
 
-func (r *Runner) syncDriftNow() {
-	if err := r.refresh.RunCollection(context.Background(), false); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
+// SyncDriftOnSchedule is SyncDrift for the cron. The mirror runner's scheduled pass is
+// this job, so it is here, in the queue, that quiet hours defer it.
+func (r *Runner) SyncDriftOnSchedule() {
+	r.enqueueUnattended(r.syncDriftJob())
+}
+
+func (r *Runner) syncDriftJob() job {
+	return job{jobRefreshAll, "refresh_all", "Metadata refresh", r.syncDriftNow}
+}
+
+func (r *Runner) syncDriftNow(ctx context.Context) {
+	if err := r.refresh.RunCollection(ctx, false); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
 		logger.Log.Warnf("metadata refresh failed: %s", err.Error())
 	}
 }
@@ -1625,8 +1965,8 @@ func (r *Runner) VerifyIdentities() {
 	r.enqueue(job{jobRefreshVerify, "refresh_verify", "Full metadata refresh", r.verifyIdentitiesNow})
 }
 
-func (r *Runner) verifyIdentitiesNow() {
-	if err := r.refresh.RunCollection(context.Background(), true); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
+func (r *Runner) verifyIdentitiesNow(ctx context.Context) {
+	if err := r.refresh.RunCollection(ctx, true); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
 		logger.Log.Warnf("full metadata refresh failed: %s", err.Error())
 	}
 }
@@ -1658,12 +1998,12 @@ func (r *Runner) RefreshArtist(artistMBID string, force bool) {
 		key = "refresh_artist_force:" + artistMBID
 		title = "Full metadata refresh"
 	}
-	r.enqueue(job{jobRefreshArtist, key, title, func() {
-		r.refreshArtistNow(artistMBID, force)
+	r.enqueue(job{jobRefreshArtist, key, title, func(ctx context.Context) {
+		r.refreshArtistNow(ctx, artistMBID, force)
 	}})
 }
 
-func (r *Runner) refreshArtistNow(artistMBID string, force bool) {
+func (r *Runner) refreshArtistNow(ctx context.Context, artistMBID string, force bool) {
 	scope, err := mirror.ArtistScope(r.db, artistMBID, force)
 	if err != nil {
 		logger.Log.Warnf("metadata refresh skipped for artist %s: %s", artistMBID, err.Error())
@@ -1685,7 +2025,7 @@ func (r *Runner) refreshArtistNow(artistMBID string, force bool) {
 		logger.Log.Warnf("failed to sync discography for %s: %s", artistMBID, err.Error())
 	}
 
-	if _, err := r.refresh.Run(context.Background(), scope); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
+	if _, err := r.refresh.Run(ctx, scope); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
 		logger.Log.Warnf("metadata refresh failed for %s: %s", artistMBID, err.Error())
 	}
 }
@@ -1698,18 +2038,49 @@ func (r *Runner) refreshArtistNow(artistMBID string, force bool) {
 //
 // Run via `go` for background execution.
 func (r *Runner) RefreshLibrary(libraryID uuid.UUID) {
-	r.enqueue(job{jobRefreshLibrary, "refresh_library:" + libraryID.String(), "Metadata refresh", func() {
-		r.refreshLibraryNow(libraryID)
+	r.enqueue(job{jobRefreshLibrary, "refresh_library:" + libraryID.String(), "Metadata refresh", func(ctx context.Context) {
+		r.refreshLibraryNow(ctx, libraryID)
+	}})
+}
+
+// RefreshReleaseGroup is RefreshArtist narrowed to one album: its edition list and the
+// editions the collection holds (see mirror.ReleaseGroupScope). The key carries the
+// reading for the same reason RefreshArtist's does. It returns the DB error for an
+// unknown release-group, so a typo is answered rather than queued.
+func (r *Runner) RefreshReleaseGroup(rgMBID string, force bool) error {
+	if err := r.db.Where("mb_id = ?", rgMBID).First(&models.CollectionReleaseGroup{}).Error; err != nil {
+		return err
+	}
+	key := "refresh_release_group:" + rgMBID
+	title := "Metadata refresh"
+	if force {
+		key = "refresh_release_group_force:" + rgMBID
+		title = "Full metadata refresh"
+	}
+	r.enqueue(job{jobRefreshReleaseGroup, key, title, func(ctx context.Context) {
+		r.refreshReleaseGroupNow(ctx, rgMBID, force)
 	}})
+	return nil
 }
 
-func (r *Runner) refreshLibraryNow(libraryID uuid.UUID) {
+func (r *Runner) refreshReleaseGroupNow(ctx context.Context, rgMBID string, force bool) {
+	scope, err := mirror.ReleaseGroupScope(r.db, rgMBID, force)
+	if err != nil {
+		logger.Log.Warnf("metadata refresh skipped for release group %s: %s", rgMBID, err.Error())
+		return
+	}
+	if _, err := r.refresh.Run(ctx, scope); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
+		logger.Log.Warnf("metadata refresh failed for release group %s: %s", rgMBID, err.Error())
+	}
+}
+
+func (r *Runner) refreshLibraryNow(ctx context.Context, libraryID uuid.UUID) {
 	scope, err := mirror.LibraryScope(r.db, libraryID)
 	if err != nil {
 		logger.Log.Warnf("metadata refresh skipped for library %s: %s", libraryID, err.Error())
 		return
 	}
-	if _, err := r.refresh.Run(context.Background(), scope); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
+	if _, err := r.refresh.Run(ctx, scope); err != nil && !errors.Is(err, mirror.ErrAlreadyRunning) {
 		logger.Log.Warnf("metadata refresh failed for library %s: %s", libraryID, err.Error())
 	}
 }
@@ -1721,11 +2092,24 @@ func (r *Runner) refreshLibraryNow(libraryID uuid.UUID) {
 // shows a single entry for what the user asked for once. Libraries are loaded when
 // the job runs, not when it is queued, matching runAllNow: a library added while it
 // waited is included.
-func (r *Runner) RetagAll() {
+//
+// With dry set it queues the dry run instead, which fails only when the profile it is
+// to try cannot be loaded.
+func (r *Runner) RetagAll(dry *DryRun) error {
+	if dry != nil {
+		if err := r.prepareDryRun(dry); err != nil {
+			return err
+		}
+		r.enqueue(job{jobDryRunRetagAll, "dry_run_retag_all" + dry.key(), dry.title("Tag files"), func(ctx context.Context) {
+			r.dryRunRetagAllNow(ctx, *dry)
+		}})
+		return nil
+	}
 	r.enqueue(job{jobRetagAll, "retag_all", "Tag files", r.retagAllNow})
+	return nil
 }
 
-func (r *Runner) retagAllNow() {
+func (r *Runner) retagAllNow(ctx context.Context) {
 	var libraries []models.Library
 	if err := r.db.Where("enabled = ?", true).Order("name").Find(&libraries).Error; err != nil {
 		logger.Log.Error("failed to load libraries from database. error: " + err.Error())
@@ -1753,10 +2137,10 @@ func (r *Runner) retagAllNow() {
 	logger.Log.Infof("re-tagging %d files across %d library(ies)", len(items), len(libraries))
 	event := events.Begin(r.db, models.EventTypeTagFiles, "Tag files in every library")
 	refreshSet := modules.NewAlbumRefreshSet(nil)
-	detail := components.NewDetailCollector(r.detailRetention)
+	detail := r.newDetail(event)
 
 	result := releaseRefresh{}
-	result.retagItems(r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
+	result.retagItems(ctx, r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
 
 	r.flushPlex(refreshSet, event)
 	summary := fmt.Sprintf("%d of %d files re-tagged · %d errors", result.retagged, len(items), len(result.errorFiles))
@@ -1771,12 +2155,12 @@ func (r *Runner) retagAllNow() {
 // correlation, without walking the disk or re-fetching anything. The library-scoped
 // twin of RetagArtist.
 func (r *Runner) RetagLibrary(libraryID uuid.UUID) {
-	r.enqueue(job{jobRetagLibrary, "retag_library:" + libraryID.String(), "Tag files", func() {
-		r.retagLibraryNow(libraryID)
+	r.enqueue(job{jobRetagLibrary, "retag_library:" + libraryID.String(), "Tag files", func(ctx context.Context) {
+		r.retagLibraryNow(ctx, libraryID)
 	}})
 }
 
-func (r *Runner) retagLibraryNow(libraryID uuid.UUID) {
+func (r *Runner) retagLibraryNow(ctx context.Context, libraryID uuid.UUID) {
 	var library models.Library
 	if err := r.db.First(&library, "id = ?", libraryID).Error; err != nil {
 		logger.Log.Warnf("re-tag skipped: library %s not found: %s", libraryID, err.Error())
@@ -1793,10 +2177,10 @@ func (r *Runner) retagLibraryNow(libraryID uuid.UUID) {
 	logger.Log.Infof("re-tagging %d files for library: %s", len(items), library.Name)
 	event := events.Begin(r.db, models.EventTypeTagFiles, "Tag files in "+library.Name)
 	refreshSet := modules.NewAlbumRefreshSet(nil)
-	detail := components.NewDetailCollector(r.detailRetention)
+	detail := r.newDetail(event)
 
 	result := releaseRefresh{}
-	result.retagItems(r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
+	result.retagItems(ctx, r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
 
 	r.flushPlex(refreshSet, event)
 	summary := fmt.Sprintf("%d of %d files re-tagged · %d errors", result.retagged, len(items), len(result.errorFiles))
@@ -1817,12 +2201,12 @@ func (r *Runner) retagLibraryNow(libraryID uuid.UUID) {
 // disk), and a metadata refresh would spend rate limit re-reading releases that never
 // changed; this writes what is already known and stops.
 func (r *Runner) RetagArtist(artistMBID string) {
-	r.enqueue(job{jobRetagArtist, "retag_artist:" + artistMBID, "Tag files", func() {
-		r.retagArtistNow(artistMBID)
+	r.enqueue(job{jobRetagArtist, "retag_artist:" + artistMBID, "Tag files", func(ctx context.Context) {
+		r.retagArtistNow(ctx, artistMBID)
 	}})
 }
 
-func (r *Runner) retagArtistNow(artistMBID string) {
+func (r *Runner) retagArtistNow(ctx context.Context, artistMBID string) {
 	var artist models.CollectionArtist
 	if err := r.db.Where("mb_id = ?", artistMBID).First(&artist).Error; err != nil {
 		logger.Log.Warnf("re-tag skipped: artist %s not found: %s", artistMBID, err.Error())
@@ -1833,23 +2217,89 @@ func (r *Runner) retagArtistNow(artistMBID string) {
 		logger.Log.Warnf("failed to load items for %s: %s", artist.Name, err.Error())
 		return
 	}
+	r.retagFor(ctx, artist.Name, items, map[string]any{
+		"artist":       artist.Name,
+		"artist_mb_id": artistMBID,
+	})
+}
+
+// ErrNothingToTag reports a re-tag scope with no taggable file in it. Like
+// ErrNothingToProcess it is a refusal: the run would report "0 of 0 files re-tagged".
+var ErrNothingToTag = errors.New("nothing to tag: no indexed files found — process them first")
+
+// RetagReleaseGroup is RetagArtist narrowed to one album: every indexed file of the
+// release-group's editions, rewritten from its stored correlation under one Activity
+// event. It returns the DB error for an unknown release-group and ErrNothingToTag when
+// none of its files can be tagged.
+func (r *Runner) RetagReleaseGroup(rgMBID string) error {
+	scope, err := r.ReleaseGroupScope(rgMBID)
+	if err != nil {
+		return retagRefusal(err)
+	}
+	name, _ := scope.Detail["release_group"].(string)
+	return r.enqueueRetag(jobRetagReleaseGroup, "retag_release_group:"+rgMBID, name,
+		map[string]any{"release_group": name, "release_group_mb_id": rgMBID},
+		func() ([]models.LibraryItem, error) { return collection.ReleaseGroupItems(r.db, rgMBID) })
+}
+
+// RetagRelease is RetagReleaseGroup for one edition (see ReleaseScope).
+func (r *Runner) RetagRelease(releaseMBID string) error {
+	scope, err := r.ReleaseScope(releaseMBID)
+	if err != nil {
+		return retagRefusal(err)
+	}
+	name, _ := scope.Detail["release"].(string)
+	return r.enqueueRetag(jobRetagRelease, "retag_release:"+releaseMBID, name,
+		map[string]any{"release": name, "release_mb_id": releaseMBID, "release_group_mb_id": scope.Detail["release_group_mb_id"]},
+		func() ([]models.LibraryItem, error) { return collection.ReleaseItems(r.db, releaseMBID) })
+}
 
-	logger.Log.Infof("re-tagging %d files for artist: %s", len(items), artist.Name)
-	event := events.Begin(r.db, models.EventTypeTagFiles, "Tag files for "+artist.Name)
+// retagRefusal reads a scope with no folders as a re-tag with no files.
+func retagRefusal(err error) error {
+	if errors.Is(err, ErrNothingToProcess) {
+		return ErrNothingToTag
+	}
+	return err
+}
+
+// enqueueRetag refuses a scope whose load finds no taggable file, and otherwise queues
+// the re-tag. The files are loaded again when the job runs, so one indexed while it
+// waited is included.
+func (r *Runner) enqueueRetag(kind jobKind, key, name string, extra map[string]any, load func() ([]models.LibraryItem, error)) error {
+	items, err := load()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrNothingToTag
+	}
+	r.enqueue(job{kind, key, "Tag files", func(ctx context.Context) {
+		items, err := load()
+		if err != nil {
+			logger.Log.Warnf("failed to load items for %s: %s", name, err.Error())
+			return
+		}
+		r.retagFor(ctx, name, items, extra)
+	}})
+	return nil
+}
+
+// retagFor rewrites items under one "Tag files for <name>" event, with extra recorded
+// in its detail. Every scope narrower than a library reports through it.
+func (r *Runner) retagFor(ctx context.Context, name string, items []models.LibraryItem, extra map[string]any) {
+	logger.Log.Infof("re-tagging %d files for: %s", len(items), name)
+	event := events.Begin(r.db, models.EventTypeTagFiles, "Tag files for "+name)
 	refreshSet := modules.NewAlbumRefreshSet(nil)
-	detail := components.NewDetailCollector(r.detailRetention)
+	detail := r.newDetail(event)
 
 	result := releaseRefresh{}
-	result.retagItems(r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
+	result.retagItems(ctx, r, items, map[uuid.UUID]models.Library{}, refreshSet, detail)
 
 	r.flushPlex(refreshSet, event)
 	summary := fmt.Sprintf("%d of %d files re-tagged · %d errors", result.retagged, len(items), len(result.errorFiles))
-	logger.Log.Infof("re-tag finished for %s. %s", artist.Name, summary)
-	r.finishRefresh(event, summary, result, detail, map[string]any{
-		"artist":         artist.Name,
-		"artist_mb_id":   artistMBID,
-		"files_in_scope": len(items),
-	})
+	logger.Log.Infof("re-tag finished for %s. %s", name, summary)
+	extra["files_in_scope"] = len(items)
+	r.finishRefresh(event, summary, result, detail, extra)
 }
 
 // releaseRefresh accumulates the outcome of re-tagging work: how many releases were
@@ -1870,6 +2320,9 @@ type releaseRefresh struct {
 	// carrying how many of its files were re-tagged. Collected here so the scan can
 	// attach them to its event; see refreshDetailItem.
 	refreshItems []models.EventItem
+	// cancelled is set when the job's context stopped the work before the last file,
+	// so the counters above are a prefix of it.
+	cancelled bool
 }
 
 func (res releaseRefresh) summary() string {
@@ -1895,11 +2348,19 @@ func (res releaseRefresh) summary() string {
 // with it. A release still out of scope is counted as checked and changed — that is
 // true of the metadata regardless of whose folders were walked — with no files
 // against it.
-func (r *Runner) retagReleases(mbIDs []string, refreshSet *modules.AlbumRefreshSet, detail *components.DetailCollector, filter scopeFilter) releaseRefresh {
+//
+// ctx is checked between releases, so a stop leaves no release with half its files
+// re-tagged from new metadata and half from old — unless the stop lands inside a
+// release with a great many files, where retagItems stops between files instead.
+func (r *Runner) retagReleases(ctx context.Context, mbIDs []string, refreshSet *modules.AlbumRefreshSet, detail *components.DetailCollector, filter scopeFilter) releaseRefresh {
 	res := releaseRefresh{}
 	libraries := map[uuid.UUID]models.Library{} // small per-run cache
 
 	for _, mbID := range mbIDs {
+		if ctx.Err() != nil {
+			res.cancelled = true
+			break
+		}
 		res.checked++
 		res.changedReleases++
 
@@ -1910,7 +2371,7 @@ func (r *Runner) retagReleases(mbIDs []string, refreshSet *modules.AlbumRefreshS
 		}
 		items = filter.keep(items)
 		before := res.retagged
-		res.retagItems(r, items, libraries, refreshSet, detail)
+		res.retagItems(ctx, r, items, libraries, refreshSet, detail)
 		if written := res.retagged - before; written > 0 {
 			res.refreshItems = append(res.refreshItems, refreshDetailItem(mbID, written))
 		}
@@ -1918,11 +2379,52 @@ func (r *Runner) retagReleases(mbIDs []string, refreshSet *modules.AlbumRefreshS
 	return res
 }
 
+// albumGainReleases lists the releases whose album gain this run's walk may have
+// moved: every release with a file the walk processed, in a library whose profile
+// writes ReplayGain. Releases the drift stage is about to rewrite anyway are left to
+// it, since a drift re-tag measures the album too.
+func (r *Runner) albumGainReleases(scope Scope, since time.Time, drifting []string) []string {
+	seen := map[string]bool{}
+	for _, mbID := range drifting {
+		seen[mbID] = true
+	}
+
+	var out []string
+	for _, target := range scope.Targets {
+		tagger := components.TaggerForLibrary(r.db, target.Library)
+		if !tagger.WriteEnabled() || !tagger.Settings().ReplayGain {
+			continue
+		}
+		var mbIDs []string
+		// To the second: SQLite round-tripping can drop the sub-second part of
+		// last_scanned_at, and a file scanned in the walk's first second must count.
+		if err := r.db.Model(&models.LibraryItem{}).
+			Where("library_id = ? AND last_scanned_at >= ? AND mb_release_id <> ''", target.Library.ID, since.Truncate(time.Second)).
+			Distinct().Pluck("mb_release_id", &mbIDs).Error; err != nil {
+			logger.Log.Warnf("failed to list the releases scanned in %q: %s", target.Library.Name, err.Error())
+			continue
+		}
+		for _, mbID := range mbIDs {
+			if !seen[mbID] {
+				seen[mbID] = true
+				out = append(out, mbID)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 // retagItems rewrites a batch of indexed files, recording each outcome. One
 // unreadable file must not abandon the rest, so errors are collected rather than
-// returned. The libraries map is the caller's cache, reused across batches.
-func (res *releaseRefresh) retagItems(r *Runner, items []models.LibraryItem, libraries map[uuid.UUID]models.Library, refreshSet *modules.AlbumRefreshSet, detail *components.DetailCollector) {
+// returned. The libraries map is the caller's cache, reused across batches. A
+// cancelled ctx stops it before the next file and marks the result cancelled.
+func (res *releaseRefresh) retagItems(ctx context.Context, r *Runner, items []models.LibraryItem, libraries map[uuid.UUID]models.Library, refreshSet *modules.AlbumRefreshSet, detail *components.DetailCollector) {
 	for _, item := range items {
+		if ctx.Err() != nil || r.holdForQuietHours(ctx) != nil {
+			res.cancelled = true
+			return
+		}
 		written, changes, err := r.retagItem(item, libraries, refreshSet)
 		if err != nil {
 			logger.Log.Errorf("failed to re-tag '%s'. error: %s", item.Path, err.Error())
@@ -2015,6 +2517,10 @@ func (r *Runner) finishRefresh(event *models.Event, summary string, res releaseR
 	if len(res.errorFiles) > 0 {
 		status = models.EventStatusError
 	}
+	if res.cancelled {
+		status = models.EventStatusCancelled
+		summary = cancelledPrefix + summary
+	}
 	recorded := res.errorFiles
 	if len(recorded) > maxErrorFilesRecorded {
 		recorded = recorded[:maxErrorFilesRecorded]
@@ -2029,6 +2535,7 @@ func (r *Runner) finishRefresh(event *models.Event, summary string, res releaseR
 		"releases_gone":     res.goneReleases,
 		"releases_relinked": res.relinked,
 		"migrations":        res.migrations,
+		"cancelled":         res.cancelled,
 	}
 	for k, v := range extra {
 		details[k] = v
@@ -2049,11 +2556,12 @@ func (r *Runner) finishRefresh(event *models.Event, summary string, res releaseR
 	events.Finish(r.db, event, status, summary, details)
 	events.AddItems(r.db, event, detail.Items())
 	events.Prune(r.db, r.eventRetention)
+	components.PruneJournal(r.db, r.journalDays)
 }
 
 // retagItem rewrites one indexed file's tags from its stored correlation and its
-// library's tagger settings, then refreshes the item's on-disk identity so
-// skip-unchanged stays correct. Libraries are cached across the run.
+// library's tagger settings, then refreshes the item's on-disk identity and hashes
+// so skip-unchanged stays correct. Libraries are cached across the run.
 //
 // It records the outcome the same way the processing pipeline does
 // (components.recordItem): a write that succeeds clears whatever the last attempt
@@ -2086,7 +2594,16 @@ func (r *Runner) retagItem(item models.LibraryItem, libraries map[uuid.UUID]mode
 	if correlation.MBReleaseID == "" {
 		return 0, nil, nil
 	}
-	unchanged, written, changes, err := modules.TagResolvedFile(item.Path, correlation, r.plex, refreshSet, library.Path, tagger.Settings())
+	// The drift check on the file itself: a re-tag is about to overwrite whatever the
+	// file says, so this is the last moment anything can notice that another tool
+	// wrote it first.
+	before, _ := os.Stat(item.Path)
+	if item.TagStateHash != "" {
+		if current, hashErr := modules.TagStateHash(item.Path); hashErr == nil && current != item.TagStateHash {
+			components.NoteTagsEdited(r.db, item)
+		}
+	}
+	unchanged, written, changes, err := modules.TagResolvedFile(item.Path, correlation, r.plex, refreshSet, library.Path, tagger.ItemSettings(item))
 	if err != nil {
 		r.recordRetagFailure(item, err)
 		return 0, nil, err
@@ -2113,6 +2630,7 @@ func (r *Runner) retagItem(item models.LibraryItem, libraries map[uuid.UUID]mode
 		updates["size"] = fi.Size()
 		updates["mod_time"] = mod
 	}
+	updates["content_hash"], updates["tag_state_hash"] = components.ItemHashes(item, before)
 	if err := r.db.Model(&models.LibraryItem{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
 		logger.Log.Warnf("failed to update item after re-tag: %s", err.Error())
 	}
@@ -2207,7 +2725,7 @@ func (r *Runner) RetagItems(itemIDs []uuid.UUID) ([]RetagResult, error) {
 	// interactive re-tag is one run in the feed however many files it touched — the
 	// same shape the queued re-tags have.
 	event := events.Begin(r.db, models.EventTypeTagFiles, retagItemsTitle(len(itemIDs)))
-	detail := components.NewDetailCollector(r.detailRetention)
+	detail := r.newDetail(event)
 
 	libraries := map[uuid.UUID]models.Library{}
 	results := make([]RetagResult, 0, len(itemIDs))
@@ -2267,6 +2785,7 @@ func (r *Runner) RetagItems(itemIDs []uuid.UUID) ([]RetagResult, error) {
 	})
 	events.AddItems(r.db, event, detail.Items())
 	events.Prune(r.db, r.eventRetention)
+	components.PruneJournal(r.db, r.journalDays)
 
 	return results, nil
 }
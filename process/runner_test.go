@@ -381,3 +381,30 @@ func TestPathInScope(t *testing.T) {
 		})
 	}
 }
+
+// A library's own worker count wins over the global one; the format caps and the
+// ceiling are the runner's either way, and a saved ceiling reaches the limiter in place.
+func TestWalkLimitsPreferTheLibrarysOwnCount(t *testing.T) {
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	r := NewRunner(db, nil, models.ConfigStruct{
+		AutotaggerrProcessConcurrency:       4,
+		AutotaggerrProcessFormatConcurrency: map[string]int{"flac": 1},
+		AutotaggerrVersion:                  "test",
+	})
+
+	if got := r.walkLimits(models.Library{}); got.Workers != 4 || got.PerFormat["flac"] != 1 {
+		t.Errorf("inherited limits = %+v, want 4 workers and the FLAC cap", got)
+	}
+	if got := r.walkLimits(models.Library{ProcessConcurrency: 8}); got.Workers != 8 || got.PerFormat["flac"] != 1 {
+		t.Errorf("library limits = %+v, want its own 8 workers and the FLAC cap", got)
+	}
+
+	limits := r.walkLimits(models.Library{})
+	r.SetIOLimit(20)
+	if limits.Bandwidth.Rate() != 20<<20 {
+		t.Errorf("rate = %d after SetIOLimit(20), want it on the limiter a walk already holds", limits.Bandwidth.Rate())
+	}
+}
@@ -1,6 +1,8 @@
 package process
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -81,7 +83,7 @@ func TestRunLibraryScansOneLibrary(t *testing.T) {
 	}
 
 	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrProcessConcurrency: 2, AutotaggerrVersion: "test"})
-	if err := r.RunLibrary(library.ID); err != nil {
+	if err := r.RunLibrary(library.ID, nil); err != nil {
 		t.Fatalf("RunLibrary: %v", err)
 	}
 	r.waitIdle(t)
@@ -98,10 +100,45 @@ func TestRunLibraryScansOneLibrary(t *testing.T) {
 	}
 }
 
+// TestRunFoldersScansOnlyTheFolders: the watcher's scope walks the folders it was
+// given and nothing else in the library, and does not claim the library was scanned.
+func TestRunFoldersScansOnlyTheFolders(t *testing.T) {
+	root := t.TempDir()
+	album := filepath.Join(root, "Artist", "New Album")
+	writeInvalidFlac(t, album)
+	writeInvalidFlac(t, filepath.Join(root, "Artist", "Old Album"))
+
+	db := newTestDB(t)
+	library := models.Library{Name: "L", Path: root, Enabled: true}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+
+	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrProcessConcurrency: 2, AutotaggerrVersion: "test"})
+	r.RunFolders(library, []string{album})
+	r.waitIdle(t)
+
+	if s := r.Status(); s.Errors != 1 {
+		t.Errorf("errors = %d, want 1 (the new album's file only)", s.Errors)
+	}
+	var ev models.Event
+	if err := db.Where("type = ?", models.EventTypeProcess).First(&ev).Error; err != nil {
+		t.Fatalf("scan event not recorded: %v", err)
+	}
+	if ev.Title != "Processing Artist/New Album" {
+		t.Errorf("title = %q", ev.Title)
+	}
+	var stored models.Library
+	db.First(&stored, "id = ?", library.ID)
+	if stored.LastScan != nil {
+		t.Error("a folder scan recorded the library as scanned")
+	}
+}
+
 func TestRunLibraryUnknownID(t *testing.T) {
 	db := newTestDB(t)
 	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
-	if err := r.RunLibrary(uuid.New()); err == nil {
+	if err := r.RunLibrary(uuid.New(), nil); err == nil {
 		t.Error("RunLibrary with an unknown id should error before enqueueing")
 	}
 }
@@ -164,6 +201,84 @@ func TestForceRecorrelateReleaseGroupUnknown(t *testing.T) {
 	}
 }
 
+// TestReleaseGroupVerbs: the album verbs each report under one event of their own,
+// named for the album or edition and covering just its files. Each runs on a fresh
+// fixture: the fixture's file is unreadable, and a run that touches it marks it as an
+// error, which is not a file the next verb would take.
+func TestReleaseGroupVerbs(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		verb   func(r *Runner) error
+		kind   string
+		title  string
+		detail string
+		want   string
+	}{
+		{"process", func(r *Runner) error { return r.RunReleaseGroup("rg-1") },
+			models.EventTypeProcess, "Processing Album", "release_group_mb_id", "rg-1"},
+		{"retag album", func(r *Runner) error { return r.RetagReleaseGroup("rg-1") },
+			models.EventTypeTagFiles, "Tag files for Album", "release_group_mb_id", "rg-1"},
+		// The edition has no title of its own in the fixture, so it is named by MBID.
+		{"retag edition", func(r *Runner) error { return r.RetagRelease("rel-1") },
+			models.EventTypeTagFiles, "Tag files for rel-1", "release_mb_id", "rel-1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newTestDB(t)
+			seedArtistWithFile(t, db, t.TempDir())
+			r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrProcessConcurrency: 2, AutotaggerrVersion: "test"})
+			if err := tc.verb(r); err != nil {
+				t.Fatalf("verb: %v", err)
+			}
+			r.waitIdle(t)
+
+			var evs []models.Event
+			if err := db.Where("type = ? AND parent_id IS NULL", tc.kind).Find(&evs).Error; err != nil {
+				t.Fatalf("load events: %v", err)
+			}
+			if len(evs) != 1 {
+				t.Fatalf("%d %s events, want one", len(evs), tc.kind)
+			}
+			if evs[0].Title != tc.title || evs[0].Details[tc.detail] != tc.want {
+				t.Errorf("event = %q %#v, want %q with %s=%s", evs[0].Title, evs[0].Details, tc.title, tc.detail, tc.want)
+			}
+		})
+	}
+}
+
+func TestReleaseGroupVerbsRefuse(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Create(&models.CollectionReleaseGroup{MBID: "rg-empty", ArtistMBID: "a", Title: "Empty"}).Error; err != nil {
+		t.Fatalf("create release-group: %v", err)
+	}
+	if err := db.Create(&models.CollectionRelease{MBID: "rel-empty", ReleaseGroupMBID: "rg-empty", ArtistMBID: "a"}).Error; err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
+
+	if err := r.RunReleaseGroup("rg-empty"); !errors.Is(err, ErrNothingToProcess) {
+		t.Errorf("RunReleaseGroup with no files = %v, want ErrNothingToProcess", err)
+	}
+	if err := r.RetagReleaseGroup("rg-empty"); !errors.Is(err, ErrNothingToTag) {
+		t.Errorf("RetagReleaseGroup with no files = %v, want ErrNothingToTag", err)
+	}
+	if err := r.RetagRelease("rel-empty"); !errors.Is(err, ErrNothingToTag) {
+		t.Errorf("RetagRelease with no files = %v, want ErrNothingToTag", err)
+	}
+	for name, err := range map[string]error{
+		"RunReleaseGroup":     r.RunReleaseGroup("nope"),
+		"RetagReleaseGroup":   r.RetagReleaseGroup("nope"),
+		"RetagRelease":        r.RetagRelease("nope"),
+		"RefreshReleaseGroup": r.RefreshReleaseGroup("nope", false),
+	} {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("%s on an unknown MBID = %v, want not found", name, err)
+		}
+	}
+	if len(r.Status().Queue) > 0 {
+		t.Errorf("a refused verb queued something: %+v", r.Status().Queue)
+	}
+}
+
 func TestForceRecorrelateLibrary(t *testing.T) {
 	root := t.TempDir()
 	writeInvalidFlac(t, filepath.Join(root, "Artist", "Album (2020)"))
@@ -247,7 +362,7 @@ func TestRetagAllCoversEveryEnabledLibrary(t *testing.T) {
 	}
 
 	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
-	r.RetagAll()
+	r.RetagAll(nil)
 	r.waitIdle(t)
 
 	var events []models.Event
@@ -445,7 +560,7 @@ func TestForcedArtistRefreshIsNotDedupedOntoTheCheapOne(t *testing.T) {
 	// Occupy the worker so the refreshes queue instead of draining as they arrive;
 	// without this there is nothing to observe.
 	release := make(chan struct{})
-	r.enqueue(job{jobRefreshArtist, "blocker", "blocker", func() { <-release }})
+	r.enqueue(job{jobRefreshArtist, "blocker", "blocker", func(context.Context) { <-release }})
 	waitFor(t, func() bool {
 		r.queueMu.Lock()
 		defer r.queueMu.Unlock()
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"context"
 	"path/filepath"
 	"sort"
 	"testing"
@@ -154,7 +155,7 @@ func TestRetagReleasesHonoursScope(t *testing.T) {
 	filter := newScopeFilter(Scope{Targets: []Target{
 		{Library: library, Roots: []string{filepath.Join(root, "Parliament")}},
 	}})
-	res := r.retagReleases([]string{"rel-1"}, modules.NewAlbumRefreshSet(nil),
+	res := r.retagReleases(context.Background(), []string{"rel-1"}, modules.NewAlbumRefreshSet(nil),
 		components.NewDetailCollector(models.DefaultEventDetailRetention), filter)
 
 	if res.retagged != 1 {
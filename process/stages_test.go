@@ -1,7 +1,10 @@
 package process
 
 import (
+	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aunefyren/autotaggerr/database"
@@ -119,3 +122,58 @@ func TestAnEmptyMigrationQueueRecordsNothing(t *testing.T) {
 		t.Errorf("recorded %d identity-change event(s) with nothing to apply", migrations)
 	}
 }
+
+// A stopped run says so, with the counters it reached, and does none of what only a
+// finished walk may do: a row for a file it never looked for is not pruned, and the
+// library is not marked scanned.
+func TestACancelledRunRecordsWhatItDid(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "01.flac"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	library := models.Library{Name: "L", Path: root, Enabled: true}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	if err := db.Create(&models.LibraryItem{LibraryID: library.ID, Path: filepath.Join(root, "gone.flac")}).Error; err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+
+	r := NewRunner(db, nil, models.ConfigStruct{AutotaggerrVersion: "test"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.runScope(ctx, LibraryScope([]models.Library{library}))
+
+	var run, tagging models.Event
+	if err := db.Where("type = ? AND parent_id IS NULL", models.EventTypeProcess).First(&run).Error; err != nil {
+		t.Fatalf("load the run: %v", err)
+	}
+	if err := db.Where("type = ? AND parent_id = ?", models.EventTypeTagFiles, run.ID).First(&tagging).Error; err != nil {
+		t.Fatalf("load the tagging stage: %v", err)
+	}
+	for _, ev := range []models.Event{run, tagging} {
+		if ev.Status != models.EventStatusCancelled || !strings.HasPrefix(ev.Summary, cancelledPrefix) {
+			t.Errorf("%s: status %q, summary %q; want it recorded as stopped", ev.Type, ev.Status, ev.Summary)
+		}
+	}
+
+	if run.Checkpoint == nil {
+		t.Error("a stopped run left no checkpoint for the next run to resume from")
+	}
+
+	var rows int64
+	db.Model(&models.LibraryItem{}).Where("library_id = ?", library.ID).Count(&rows)
+	if rows != 1 {
+		t.Errorf("%d index row(s) left, want the unvisited one kept", rows)
+	}
+	if err := db.First(&library, "id = ?", library.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if library.LastScan != nil {
+		t.Error("a stopped run marked the library scanned")
+	}
+}
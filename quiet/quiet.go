@@ -0,0 +1,184 @@
+// Package quiet knows when Autotaggerr should keep its hands off the library.
+//
+// A server that is also a media server has hours when people are listening, and a tag
+// write in those hours is not free: the media server sees the file change, rescans the
+// album, and the track someone is playing stutters or drops out of a playlist. Quiet
+// hours are the windows in which nothing Autotaggerr does *on its own* touches a file.
+// A person pressing a button is not held to them — they are the one who asked — but a
+// cron, a library's own schedule and the folder watcher are.
+//
+// The package only answers "is it quiet now, and until when". What to do about it is
+// each runner's business: the processing queue passes over unattended jobs and pauses
+// an unattended run at its next file, the artwork runner holds back its scheduled pass.
+package quiet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecheckInterval bounds how long Wait sleeps between looks at the clock and the
+// setting. A window ending is known in advance, but the setting can be edited while
+// something waits on it — shortening tonight's window must release the wait within a
+// minute, not at the old end. A variable so a test can shorten it.
+var RecheckInterval = time.Minute
+
+// Window is one daily quiet period, in minutes after local midnight. End before Start
+// wraps midnight: 22:00-06:00 is quiet overnight.
+type Window struct {
+	Start int
+	End   int
+}
+
+// Parse reads windows written as "18:00-23:30", several separated by commas. Empty is
+// no quiet hours. A window that starts where it ends is rejected: it could mean never
+// or always, and guessing wrong either way is a surprise at someone's expense.
+func Parse(spec string) ([]Window, error) {
+	var windows []Window
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(entry, "-")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a window like 18:00-23:30", entry)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("%q starts where it ends", entry)
+		}
+		windows = append(windows, Window{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// parseClock reads HH:MM as minutes after midnight.
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	hh, mm, ok := strings.Cut(value, ":")
+	hours, errH := strconv.Atoi(hh)
+	minutes, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("%q is not a time like 18:00", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Validate is Parse for a settings validator.
+func Validate(spec string) error {
+	_, err := Parse(spec)
+	return err
+}
+
+// end reports whether now falls in w, and if so when w ends.
+func (w Window) end(now time.Time) (time.Time, bool) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(day, minutes int) time.Time {
+		return time.Date(midnight.Year(), midnight.Month(), midnight.Day()+day, minutes/60, minutes%60, 0, 0, now.Location())
+	}
+	minute := now.Hour()*60 + now.Minute()
+	switch {
+	case w.Start < w.End && minute >= w.Start && minute < w.End:
+		return at(0, w.End), true
+	case w.Start > w.End && minute >= w.Start:
+		return at(1, w.End), true
+	case w.Start > w.End && minute < w.End:
+		return at(0, w.End), true
+	}
+	return time.Time{}, false
+}
+
+// Hours is the configured quiet windows, read live. A nil *Hours is never quiet, so a
+// runner built without one — a test, the one-shot file mode — needs no branch.
+type Hours struct {
+	spec func() string
+	now  func() time.Time
+
+	mu     sync.Mutex
+	parsed string
+	cached []Window
+}
+
+// New reads its windows from spec on every question, so an edit on the settings page
+// applies from the next one. The parse is cached per spec value.
+func New(spec func() string) *Hours {
+	return &Hours{spec: spec, now: time.Now}
+}
+
+// windows returns the current windows. A value that does not parse is treated as no
+// quiet hours: the settings page refuses one, so only a hand-edited config.json can
+// hold it, and holding every job back on a typo would be the worse reading.
+func (h *Hours) windows() []Window {
+	spec := h.spec()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if spec != h.parsed {
+		h.cached, _ = Parse(spec)
+		h.parsed = spec
+	}
+	return h.cached
+}
+
+// Until reports whether it is quiet now, and if so when it stops being. Windows that
+// touch or overlap are one quiet period: the end returned is the end of all of them.
+func (h *Hours) Until() (time.Time, bool) {
+	if h == nil {
+		return time.Time{}, false
+	}
+	windows := h.windows()
+	now := h.now()
+	until, quiet := time.Time{}, false
+	for {
+		extended := false
+		for _, w := range windows {
+			at := now
+			if quiet {
+				at = until
+			}
+			if end, ok := w.end(at); ok && end.After(until) {
+				until, quiet, extended = end, true, true
+			}
+		}
+		// Bounded: each pass moves the end to a later window end, and a day only has
+		// so many of them before the end would wrap past a window already used.
+		if !extended || until.Sub(now) > 24*time.Hour {
+			return until, quiet
+		}
+	}
+}
+
+// Active reports whether it is quiet now.
+func (h *Hours) Active() bool {
+	_, quiet := h.Until()
+	return quiet
+}
+
+// Wait blocks until it is no longer quiet, or ctx is cancelled. It returns at once
+// when it is not quiet to begin with.
+func (h *Hours) Wait(ctx context.Context) error {
+	for {
+		until, quiet := h.Until()
+		if !quiet {
+			return nil
+		}
+		timer := time.NewTimer(min(time.Until(until), RecheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
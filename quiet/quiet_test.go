@@ -0,0 +1,96 @@
+package quiet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// at builds an Hours fixed at a local wall-clock time on an ordinary day.
+func at(spec string, hour, minute int) *Hours {
+	h := New(func() string { return spec })
+	h.now = func() time.Time { return time.Date(2026, 3, 10, hour, minute, 0, 0, time.Local) }
+	return h
+}
+
+func TestUntil(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		spec         string
+		hour, minute int
+		quiet        bool
+		endDay       int
+		endHour      int
+		endMinute    int
+	}{
+		{"inside an evening window", "18:00-23:30", 19, 0, true, 10, 23, 30},
+		{"at the start", "18:00-23:30", 18, 0, true, 10, 23, 30},
+		{"at the end", "18:00-23:30", 23, 30, false, 0, 0, 0},
+		{"before it", "18:00-23:30", 9, 0, false, 0, 0, 0},
+		{"overnight, before midnight", "22:00-06:00", 23, 0, true, 11, 6, 0},
+		{"overnight, after midnight", "22:00-06:00", 2, 0, true, 10, 6, 0},
+		{"touching windows are one", "18:00-20:00, 20:00-22:00", 19, 0, true, 10, 22, 0},
+		{"no quiet hours", "", 19, 0, false, 0, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			until, quiet := at(tc.spec, tc.hour, tc.minute).Until()
+			if quiet != tc.quiet {
+				t.Fatalf("quiet = %v, want %v", quiet, tc.quiet)
+			}
+			want := time.Date(2026, 3, tc.endDay, tc.endHour, tc.endMinute, 0, 0, time.Local)
+			if quiet && !until.Equal(want) {
+				t.Errorf("until = %s, want %s", until, want)
+			}
+		})
+	}
+}
+
+// Windows that cover the whole day must not send Until round in circles.
+func TestUntilTerminatesOnAWholeDay(t *testing.T) {
+	if _, quiet := at("00:00-12:00, 12:00-00:00", 8, 0).Until(); !quiet {
+		t.Error("a day covered by two windows read as not quiet")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, bad := range []string{"18:00", "18:00-18:00", "25:00-26:00", "6pm-11pm", "18:00-23:60"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+	windows, err := Parse(" 18:00-23:30 , 01:15-05:00 ")
+	if err != nil || len(windows) != 2 || windows[1] != (Window{Start: 75, End: 300}) {
+		t.Errorf("Parse = %v, %v", windows, err)
+	}
+}
+
+// An edit lifting the window releases whatever is waiting on it, without waiting for
+// the old end.
+func TestWaitFollowsTheSetting(t *testing.T) {
+	defer func(prev time.Duration) { RecheckInterval = prev }(RecheckInterval)
+	RecheckInterval = 5 * time.Millisecond
+
+	spec := "00:00-23:59"
+	h := New(func() string { return spec })
+	h.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local) }
+
+	done := make(chan error, 1)
+	go func() { done <- h.Wait(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("Wait returned while it was quiet")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	h.mu.Lock()
+	spec = ""
+	h.mu.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not notice the window was lifted")
+	}
+}
@@ -0,0 +1,479 @@
+package rename
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Move is one file's place under the template: where it is, where the template puts
+// it, and — when it is staying put for a reason — why.
+type Move struct {
+	ItemID uuid.UUID `json:"item_id"`
+	From   string    `json:"from"`
+	To     string    `json:"to,omitempty"`
+	// Skip says why the file is not moving: its tags could not be built, a field the
+	// template needs is empty, or the target is taken. Empty means it moves.
+	Skip string `json:"skip,omitempty"`
+}
+
+// Plan is what applying a template would do to a library. Files already where the
+// template puts them are counted, not listed: on a library that was renamed before,
+// they are nearly all of it.
+type Plan struct {
+	Moves     []Move `json:"moves"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// Moving counts the moves that are not skipped.
+func (p Plan) Moving() int {
+	n := 0
+	for _, m := range p.Moves {
+		if m.Skip == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Build plans the template over items, all of one library rooted at root. tagsFor
+// builds the tags a file is named from, the ones the tagging path would write.
+//
+// Two files the template puts in the same place are both skipped, since moving
+// either would leave the pair to chance; so is a file whose target is already
+// occupied by something else on disk. "Intro.flac" and "intro.flac" are the same
+// place only where the filesystem says so: root is probed once (caseInsensitive), and
+// targets are compared exactly on a filesystem that keeps case apart. A move whose
+// target differs from its source only in case is allowed — on a case-insensitive
+// filesystem the "occupant" is the file itself.
+func Build(root string, t Template, items []models.LibraryItem, tagsFor func(models.LibraryItem) (models.FileTags, error)) Plan {
+	var plan Plan
+	targets := map[string][]int{}
+	foldCase := caseInsensitive(root)
+	for _, item := range items {
+		tags, err := tagsFor(item)
+		if err != nil {
+			plan.Moves = append(plan.Moves, Move{ItemID: item.ID, From: item.Path, Skip: err.Error()})
+			continue
+		}
+		rel, err := t.Path(tags, filepath.Ext(item.Path))
+		if err != nil {
+			plan.Moves = append(plan.Moves, Move{ItemID: item.ID, From: item.Path, Skip: err.Error()})
+			continue
+		}
+		to := filepath.Join(root, filepath.FromSlash(rel))
+		if to == item.Path {
+			plan.Unchanged++
+			continue
+		}
+		key := to
+		if foldCase {
+			key = strings.ToLower(to)
+		}
+		targets[key] = append(targets[key], len(plan.Moves))
+		plan.Moves = append(plan.Moves, Move{ItemID: item.ID, From: item.Path, To: to})
+	}
+
+	for _, at := range targets {
+		if len(at) > 1 {
+			for _, i := range at {
+				plan.Moves[i].Skip = fmt.Sprintf("%d files would be named %s", len(at), filepath.Base(plan.Moves[i].To))
+			}
+			continue
+		}
+		m := &plan.Moves[at[0]]
+		if occupied(m.From, m.To) {
+			m.Skip = "a file is already at " + m.To
+		}
+	}
+
+	sort.Slice(plan.Moves, func(a, b int) bool { return plan.Moves[a].From < plan.Moves[b].From })
+	return plan
+}
+
+// caseInsensitive probes whether the filesystem under root folds case: it looks one of
+// root's entries up again under its name with the case swapped, and asks whether that
+// found the same file. A root with nothing in it to ask about is taken to fold, which
+// can only skip a move, never let two files land on one name.
+func caseInsensitive(root string) bool {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return true
+	}
+	for _, e := range entries {
+		swapped := strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, e.Name())
+		if swapped == e.Name() {
+			continue
+		}
+		original, err := os.Lstat(filepath.Join(root, e.Name()))
+		if err != nil {
+			continue
+		}
+		other, err := os.Lstat(filepath.Join(root, swapped))
+		return err == nil && os.SameFile(original, other)
+	}
+	return true
+}
+
+// occupied reports whether to holds something other than from.
+func occupied(from, to string) bool {
+	target, err := os.Lstat(to)
+	if err != nil {
+		return false
+	}
+	source, err := os.Lstat(from)
+	return err != nil || !os.SameFile(source, target)
+}
+
+// DefaultTemplate is the layout an import uses for a library with no template of its
+// own: the one Lidarr and most players expect.
+const DefaultTemplate = "{albumartist}/{album} ({originalyear})/{disc:02}-{track:02} {title}"
+
+// Options say how Apply carries a plan out. The zero value (with Root set) is a rename.
+type Options struct {
+	// Root bounds the tidy-up: no folder at or above it is removed. For a rename it is
+	// the library; for an import, the inbox the files came from.
+	Root string
+	// Copy leaves each source where it is. Nothing is emptied, so nothing is tidied.
+	Copy bool
+	// Kind and Done are what each event row says it is, and what a file that made it
+	// says happened to it: EventItemKindMove and EventItemStatusMoved by default.
+	Kind string
+	Done string
+	// Hold is called before each file, as a walk's is, so a run can pause or stop
+	// between moves; nil never waits.
+	Hold func(context.Context) error
+}
+
+// Result is what Apply did.
+type Result struct {
+	Moved   int
+	Skipped int
+	Failed  int
+	// Carried are the files that are not audio — a cover, a cue sheet, a log — moved
+	// after the album they sat beside (see carryAlong).
+	Carried []Move
+	// FoldersRemoved are the folders left empty by the moves and removed; FoldersKept
+	// the ones the moves emptied of audio that still hold something else, which could
+	// not follow and is not a rename's to delete.
+	FoldersRemoved []string
+	FoldersKept    []string
+	Items          []models.EventItem
+	// Done are the moves that happened, for a caller with more to do to each file.
+	Done      []Move
+	Cancelled bool
+}
+
+// CarriedPaths lists where each carried file went, for an event's details.
+func (r Result) CarriedPaths() []string {
+	paths := make([]string, 0, len(r.Carried))
+	for _, m := range r.Carried {
+		paths = append(paths, m.To)
+	}
+	return paths
+}
+
+// Apply carries out plan's moves. Each file is renamed on disk — copied, when it
+// crosses filesystems or opts.Copy asks — and then its row re-pointed; a row that will
+// not update undoes the move, so the index never names a path with nothing at it. The
+// path-keyed caches (fingerprints, loudness) move with the file, so a rename does not
+// cost a decode.
+//
+// A folder whose audio all went to one place is followed there by everything else in
+// it (see carryAlong), and then, like every folder the moves emptied, removed.
+//
+// Every move, skip and failure becomes one EventItem of kind opts.Kind.
+func Apply(ctx context.Context, db *gorm.DB, plan Plan, opts Options) Result {
+	if opts.Kind == "" {
+		opts.Kind = models.EventItemKindMove
+	}
+	if opts.Done == "" {
+		opts.Done = models.EventItemStatusMoved
+	}
+	var res Result
+	emptied := map[string]bool{}
+	destinations := map[string]map[string]bool{}
+	for _, m := range plan.Moves {
+		row := models.EventItem{Path: m.From, Kind: opts.Kind}
+		if m.To != "" {
+			row.Changes = []models.TagChange{{Field: "path", Old: m.From, New: m.To}}
+		}
+		if m.Skip != "" {
+			row.Status = models.EventItemStatusSkipped
+			row.Error = m.Skip
+			res.Skipped++
+			res.Items = append(res.Items, row)
+			continue
+		}
+		if ctx.Err() != nil || (opts.Hold != nil && opts.Hold(ctx) != nil) {
+			res.Cancelled = true
+			break
+		}
+		if err := move(db, m, opts.Copy); err != nil {
+			logger.Log.Warnf("failed to move %q: %s", m.From, err.Error())
+			row.Status = models.EventItemStatusError
+			row.Error = err.Error()
+			res.Failed++
+			res.Items = append(res.Items, row)
+			continue
+		}
+		row.Status = opts.Done
+		res.Moved++
+		res.Items = append(res.Items, row)
+		res.Done = append(res.Done, m)
+		if !opts.Copy {
+			emptied[filepath.Dir(m.From)] = true
+			followFolders(destinations, opts.Root, m)
+		}
+	}
+
+	res.Carried, res.FoldersRemoved, res.FoldersKept = removeEmptied(db, opts.Root, emptied, destinations)
+	return res
+}
+
+// followFolders records where m took its folder: the file's folder goes to the
+// target's, and — while the two paths are the same depth under root, as a rename from
+// Artist/Album to Artist/Album (Year) is — each folder above it to the one above the
+// target. Depths that differ (a Disc 1 folder flattened away) map the file's own
+// folder only; there is no telling which folder above an artist.jpg belongs in.
+func followFolders(destinations map[string]map[string]bool, root string, m Move) {
+	root = filepath.Clean(root)
+	from, to := filepath.Dir(m.From), filepath.Dir(m.To)
+	sameDepth := depthUnder(root, from) >= 0 && depthUnder(root, from) == depthUnder(root, to)
+	for {
+		if destinations[from] == nil {
+			destinations[from] = map[string]bool{}
+		}
+		destinations[from][to] = true
+		if !sameDepth {
+			return
+		}
+		from, to = filepath.Dir(from), filepath.Dir(to)
+		if from == root || to == root {
+			return
+		}
+	}
+}
+
+// depthUnder is how many folders deep path is below root, or -1 when it is not below
+// it.
+func depthUnder(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return -1
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// move puts one file at its target and re-points everything keyed by its path.
+func move(db *gorm.DB, m Move, copyOnly bool) error {
+	if err := os.MkdirAll(filepath.Dir(m.To), 0o755); err != nil {
+		return err
+	}
+	if occupied(m.From, m.To) {
+		return fmt.Errorf("a file appeared at %s", m.To)
+	}
+	if err := transfer(m.From, m.To, copyOnly); err != nil {
+		return err
+	}
+	undo := func() error {
+		if copyOnly {
+			return os.Remove(m.To)
+		}
+		return transfer(m.To, m.From, false)
+	}
+	if err := db.Model(&models.LibraryItem{}).Where("id = ?", m.ItemID).Update("path", m.To).Error; err != nil {
+		if back := undo(); back != nil {
+			return fmt.Errorf("moved to %s but the index could not follow (%v), and moving it back failed: %w", m.To, err, back)
+		}
+		return fmt.Errorf("the index could not follow the move, so the file was put back: %w", err)
+	}
+	// Caches, not records: a row that fails to follow costs one fingerprint or one
+	// loudness measurement at the next run, so it does not undo the move. A stale row
+	// already at the new path is dropped first; the path is its key. A copy leaves the
+	// source's rows where they are, since the source is still there.
+	if copyOnly {
+		return nil
+	}
+	for _, cache := range []any{&models.AcoustIDLookup{}, &models.LoudnessAnalysis{}} {
+		err := db.Where("path = ?", m.To).Delete(cache).Error
+		if err == nil {
+			err = db.Model(cache).Where("path = ?", m.From).Update("path", m.To).Error
+		}
+		if err != nil {
+			logger.Log.Debugf("failed to move a cached row for %q: %s", m.From, err.Error())
+		}
+	}
+	return nil
+}
+
+// transfer renames from to to, or copies it. A rename that cannot cross filesystems
+// becomes a copy and a delete — an inbox is often on a download disk — and the copy
+// is synced before the source goes, so a crash between the two leaves two files
+// rather than none.
+func transfer(from, to string, copyOnly bool) error {
+	if !copyOnly {
+		err := os.Rename(from, to)
+		if err == nil || !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+	if err := copyFile(from, to); err != nil {
+		os.Remove(to)
+		return err
+	}
+	if copyOnly {
+		return nil
+	}
+	return os.Remove(from)
+}
+
+// copyFile copies from to a new file at to, keeping its mode and mtime: the mtime is
+// half of the identity a scan skips unchanged files by.
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(to, info.ModTime(), info.ModTime())
+}
+
+// removeEmptied removes each folder the moves left empty, then each parent that is
+// empty in turn, stopping at the library root. A folder the moves emptied of audio
+// has the rest of its files carried after it first, when its audio all went to one
+// place (destinations, see followFolders). A folder with anything left in it stays;
+// one a move emptied of audio but not of everything else is reported as kept.
+func removeEmptied(db *gorm.DB, root string, folders map[string]bool, destinations map[string]map[string]bool) (carried []Move, removed, kept []string) {
+	root = filepath.Clean(root)
+	ordered := make([]string, 0, len(folders))
+	for dir := range folders {
+		ordered = append(ordered, dir)
+	}
+	// Deepest first, so a parent is looked at after its children had their chance.
+	sort.Slice(ordered, func(a, b int) bool { return len(ordered[a]) > len(ordered[b]) })
+
+	keptSet := map[string]bool{}
+	for _, dir := range ordered {
+		// A parent is looked at again after each child it loses: an artist folder
+		// is only empty once its last album has gone.
+		for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			entries, err := os.ReadDir(dir)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err == nil && len(entries) > 0 && !holdsAudio(entries) {
+				if to, ok := soleDestination(destinations[dir]); ok && to != dir {
+					carried = append(carried, carryAlong(db, dir, to, entries)...)
+					entries, err = os.ReadDir(dir)
+				}
+			}
+			if err != nil || len(entries) > 0 {
+				if err == nil && !holdsAudio(entries) && (folders[dir] || destinations[dir] != nil) {
+					keptSet[dir] = true
+				}
+				break
+			}
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+			delete(keptSet, dir)
+			removed = append(removed, dir)
+		}
+	}
+	for dir := range keptSet {
+		kept = append(kept, dir)
+	}
+	sort.Strings(removed)
+	sort.Strings(kept)
+	return carried, removed, kept
+}
+
+func soleDestination(to map[string]bool) (string, bool) {
+	if len(to) != 1 {
+		return "", false
+	}
+	for dir := range to {
+		return dir, true
+	}
+	return "", false
+}
+
+// carryAlong moves the files of dir — no audio is left in it — to to, where its audio
+// went: the cover.jpg, cue sheet, lyrics and rip log that belong to the album and mean
+// nothing in a folder with no album in it. A file whose name is taken at to stays, and
+// so its folder does. A sidecar Autotaggerr wrote keeps its row, re-pointed, so it is
+// still known as ours in its new place.
+func carryAlong(db *gorm.DB, dir, to string, entries []os.DirEntry) []Move {
+	var carried []Move
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		m := Move{From: filepath.Join(dir, e.Name()), To: filepath.Join(to, e.Name())}
+		if occupied(m.From, m.To) {
+			continue
+		}
+		if err := transfer(m.From, m.To, false); err != nil {
+			logger.Log.Warnf("failed to move %q after its album: %s", m.From, err.Error())
+			continue
+		}
+		err := db.Where("path = ?", m.To).Delete(&models.ArtworkSidecar{}).Error
+		if err == nil {
+			err = db.Model(&models.ArtworkSidecar{}).Where("path = ?", m.From).Update("path", m.To).Error
+		}
+		if err != nil {
+			logger.Log.Warnf("failed to re-point the sidecar row of %q: %s", m.From, err.Error())
+		}
+		carried = append(carried, m)
+	}
+	return carried
+}
+
+// holdsAudio reports whether a folder still has audio in it or a folder under it —
+// one that is still an album, which is not worth mentioning as kept.
+func holdsAudio(entries []os.DirEntry) bool {
+	for _, e := range entries {
+		if e.IsDir() || modules.IsSupportedFile(e.Name()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package rename
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/database"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func init() {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	return db
+}
+
+func writeFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenameMovesFilesAndTidiesUp walks one library through a plan and its apply: the
+// files land where the template says, their rows and cached fingerprints follow, a
+// cover follows the one track it sat beside, and the emptied folders go.
+func TestRenameMovesFilesAndTidiesUp(t *testing.T) {
+	db := testDB(t)
+	root := t.TempDir()
+	library := models.Library{Name: "L", Path: root}
+	if err := db.Create(&library).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	titles := map[string]string{}
+	var items []models.LibraryItem
+	for i, f := range []struct{ path, title string }{
+		{filepath.Join(root, "incoming", "a", "track1.flac"), "One"},
+		{filepath.Join(root, "incoming", "a", "track2.flac"), "Two"},
+		{filepath.Join(root, "old", "track3.flac"), "Three"},
+		// Named where the template already puts it.
+		{filepath.Join(root, "Artist", "04 Four.flac"), "Four"},
+		// No title: left alone.
+		{filepath.Join(root, "loose", "x.flac"), ""},
+	} {
+		writeFile(t, f.path)
+		item := models.LibraryItem{LibraryID: library.ID, Path: f.path, MBReleaseID: "rel", MBReleaseTrackID: string(rune('a' + i))}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+		titles[f.path] = f.title
+		items = append(items, item)
+	}
+	writeFile(t, filepath.Join(root, "old", "cover.jpg"))
+	if err := db.Create(&models.AcoustIDLookup{Path: items[0].Path}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := Parse("{albumartist}/{track:02} {title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Build(root, tmpl, items, func(item models.LibraryItem) (models.FileTags, error) {
+		tracks := map[string]string{"One": "1", "Two": "2", "Three": "3", "Four": "4"}
+		return models.FileTags{AlbumArtist: "Artist", Title: titles[item.Path], Track: tracks[titles[item.Path]]}, nil
+	})
+	if plan.Unchanged != 1 || plan.Moving() != 3 || len(plan.Moves) != 4 {
+		t.Fatalf("plan = %+v; want 3 moving, 1 skipped, 1 unchanged", plan)
+	}
+
+	res := Apply(context.Background(), db, plan, Options{Root: library.Path})
+	if res.Moved != 3 || res.Skipped != 1 || res.Failed != 0 || len(res.Items) != 4 {
+		t.Fatalf("result = %+v", res)
+	}
+
+	want := filepath.Join(root, "Artist", "01 One.flac")
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("moved file missing: %v", err)
+	}
+	var moved models.LibraryItem
+	db.First(&moved, "id = ?", items[0].ID)
+	if moved.Path != want {
+		t.Errorf("item path = %q, want %q", moved.Path, want)
+	}
+	var lookup models.AcoustIDLookup
+	if err := db.First(&lookup, "path = ?", want).Error; err != nil {
+		t.Errorf("the fingerprint cache did not follow the file: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "incoming")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("emptied folders were not removed (%v); removed %v", err, res.FoldersRemoved)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Artist", "cover.jpg")); err != nil {
+		t.Errorf("the cover did not follow its track: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "old")); !errors.Is(err, os.ErrNotExist) || len(res.FoldersKept) != 0 {
+		t.Errorf("the folder the cover left was not removed (%v); kept %v", err, res.FoldersKept)
+	}
+
+	for _, row := range res.Items {
+		if row.Kind != models.EventItemKindMove {
+			t.Errorf("item kind = %q", row.Kind)
+		}
+		if row.Status == models.EventItemStatusMoved && (len(row.Changes) != 1 || row.Changes[0].Old != row.Path) {
+			t.Errorf("move row does not record old and new path: %+v", row)
+		}
+	}
+}
+
+// TestRenameCarriesSidecarsWithTheAlbum: the cover, cue sheet and log beside an
+// album's tracks follow them, the artist.jpg above follows the artist folder, and the
+// rows that mark sidecars as ours move with them. A folder whose tracks split between
+// two albums keeps its cover, and says so.
+func TestRenameCarriesSidecarsWithTheAlbum(t *testing.T) {
+	db := testDB(t)
+	root := t.TempDir()
+	album := filepath.Join(root, "Old Artist", "Old Album")
+	split := filepath.Join(root, "Someone", "Mixed")
+
+	var items []models.LibraryItem
+	albums := map[string]string{}
+	for _, f := range []struct{ path, album string }{
+		{filepath.Join(album, "1.flac"), "Album"},
+		{filepath.Join(album, "2.flac"), "Album"},
+		{filepath.Join(split, "3.flac"), "Album"},
+		{filepath.Join(split, "4.flac"), "Other"},
+	} {
+		writeFile(t, f.path)
+		item := models.LibraryItem{Path: f.path}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+		albums[f.path] = f.album
+		items = append(items, item)
+	}
+	for _, extra := range []string{
+		filepath.Join(album, "cover.jpg"), filepath.Join(album, "album.cue"), filepath.Join(album, "rip.log"),
+		filepath.Join(root, "Old Artist", "artist.jpg"), filepath.Join(split, "folder.jpg"),
+	} {
+		writeFile(t, extra)
+	}
+	for _, ours := range []string{filepath.Join(album, "cover.jpg"), filepath.Join(root, "Old Artist", "artist.jpg")} {
+		if err := db.Create(&models.ArtworkSidecar{Path: ours, SHA256: "x"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpl, err := Parse("{albumartist}/{album}/{title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := Build(root, tmpl, items, func(item models.LibraryItem) (models.FileTags, error) {
+		return models.FileTags{AlbumArtist: "Artist", Album: albums[item.Path], Title: strings.TrimSuffix(filepath.Base(item.Path), ".flac")}, nil
+	})
+	res := Apply(context.Background(), db, plan, Options{Root: root})
+	if res.Moved != 4 || res.Failed != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+
+	for _, want := range []string{
+		filepath.Join(root, "Artist", "Album", "cover.jpg"),
+		filepath.Join(root, "Artist", "Album", "album.cue"),
+		filepath.Join(root, "Artist", "Album", "rip.log"),
+		filepath.Join(root, "Artist", "artist.jpg"),
+	} {
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("%s did not follow the album: %v", filepath.Base(want), err)
+		}
+		if filepath.Ext(want) == ".jpg" {
+			var row models.ArtworkSidecar
+			if err := db.First(&row, "path = ?", want).Error; err != nil {
+				t.Errorf("the sidecar row of %s was not re-pointed: %v", filepath.Base(want), err)
+			}
+		}
+	}
+	if len(res.Carried) != 4 {
+		t.Errorf("carried = %+v, want the four files", res.Carried)
+	}
+	if _, err := os.Stat(album); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the album folder was not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(split, "folder.jpg")); err != nil {
+		t.Errorf("the cover of a folder that split was moved: %v", err)
+	}
+	if len(res.FoldersKept) != 1 || res.FoldersKept[0] != split {
+		t.Errorf("kept = %v, want the folder that split", res.FoldersKept)
+	}
+}
+
+// TestBuildSkipsCollisions: two files named alike, and a file whose target is taken by
+// one the library does not know, all stay where they are.
+func TestBuildSkipsCollisions(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a.flac")
+	b := filepath.Join(root, "b.flac")
+	c := filepath.Join(root, "c.flac")
+	for _, p := range []string{a, b, c, filepath.Join(root, "Taken.flac")} {
+		writeFile(t, p)
+	}
+	tmpl, err := Parse("{title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := map[string]string{a: "Same", b: "Same", c: "Taken"}
+	plan := Build(root, tmpl, []models.LibraryItem{{Path: a}, {Path: b}, {Path: c}}, func(item models.LibraryItem) (models.FileTags, error) {
+		return models.FileTags{Title: titles[item.Path]}, nil
+	})
+	if plan.Moving() != 0 || len(plan.Moves) != 3 {
+		t.Fatalf("plan = %+v; want every move skipped", plan)
+	}
+	for _, m := range plan.Moves {
+		if m.Skip == "" {
+			t.Errorf("%s was not skipped", m.From)
+		}
+	}
+}
+
+// TestBuildFoldsCaseOnlyWhereTheFilesystemDoes: "Intro" and "intro" are two names on a
+// filesystem that keeps case apart, and one name on one that does not.
+func TestBuildFoldsCaseOnlyWhereTheFilesystemDoes(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a.flac")
+	b := filepath.Join(root, "b.flac")
+	for _, p := range []string{a, b} {
+		writeFile(t, p)
+	}
+	tmpl, err := Parse("{title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := map[string]string{a: "Intro", b: "intro"}
+	plan := Build(root, tmpl, []models.LibraryItem{{Path: a}, {Path: b}}, func(item models.LibraryItem) (models.FileTags, error) {
+		return models.FileTags{Title: titles[item.Path]}, nil
+	})
+
+	want := 2
+	if caseInsensitive(root) {
+		want = 0
+	}
+	if plan.Moving() != want {
+		t.Errorf("plan = %+v; want %d moving on this filesystem", plan, want)
+	}
+
+	// The probe itself: this root holds "a.flac", and "A.FLAC" is it exactly when the
+	// filesystem folds case.
+	_, err = os.Stat(filepath.Join(root, "A.FLAC"))
+	if folds := err == nil; caseInsensitive(root) != folds {
+		t.Errorf("caseInsensitive = %v, but A.FLAC found a.flac: %v", !folds, folds)
+	}
+}
@@ -0,0 +1,262 @@
+// Package rename lays a library's files out by a naming template.
+//
+// A template is a relative path with fields in braces, evaluated from the tags
+// Autotaggerr writes to the file — the same models.FileTags the tagging path builds,
+// so a file's name never disagrees with what its tags say:
+//
+//	{albumartist}/{album} ({originalyear})/{disc:02}-{track:02} {title}
+//
+// The file's own extension is appended. A field's value never makes a folder: a slash
+// inside one ("AC/DC") is replaced, so the template's slashes are the only ones.
+//
+// Only libraries Autotaggerr manages itself are renamed. Under Lidarr the layout is
+// Lidarr's to decide, and moving its files would only make it lose track of them.
+package rename
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// maxSegment bounds one folder or file name, in bytes. Most filesystems stop at 255;
+// the margin leaves room for the extension and for a filesystem that counts in
+// UTF-16.
+const maxSegment = 200
+
+// fields are the names a template may use. Each reads one value from the tags; a
+// numeric one can be zero-padded with a width, as in {track:02}.
+var fields = map[string]struct {
+	value   func(models.FileTags) string
+	numeric bool
+}{
+	"albumartist":     {value: func(t models.FileTags) string { return t.AlbumArtist }},
+	"albumartistsort": {value: func(t models.FileTags) string { return first(t.AlbumArtistSort, t.AlbumArtist) }},
+	// The track artist is blanked when it only repeats the album artist (see the
+	// profile's IgnoreRedundantContributingArtists), which is not the same as there
+	// being none.
+	"artist":        {value: func(t models.FileTags) string { return first(t.Artist, t.AlbumArtist) }},
+	"artistsort":    {value: func(t models.FileTags) string { return first(t.ArtistSort, t.Artist, t.AlbumArtistSort, t.AlbumArtist) }},
+	"album":         {value: func(t models.FileTags) string { return t.Album }},
+	"title":         {value: func(t models.FileTags) string { return t.Title }},
+	"track":         {value: func(t models.FileTags) string { return t.Track }, numeric: true},
+	"tracktotal":    {value: func(t models.FileTags) string { return t.TrackTotal }, numeric: true},
+	"disc":          {value: func(t models.FileTags) string { return t.DiscNumber }, numeric: true},
+	"disctotal":     {value: func(t models.FileTags) string { return t.DiscTotal }, numeric: true},
+	"year":          {value: func(t models.FileTags) string { return t.ReleaseYear }},
+	"date":          {value: func(t models.FileTags) string { return t.ReleaseDate }},
+	"originalyear":  {value: func(t models.FileTags) string { return first(t.OriginalYear, t.ReleaseYear) }},
+	"originaldate":  {value: func(t models.FileTags) string { return first(t.OriginalDate, t.ReleaseDate) }},
+	"genre":         {value: func(t models.FileTags) string { return firstOf(t.Genres) }},
+	"label":         {value: func(t models.FileTags) string { return firstOf(t.RecordLabels) }},
+	"catalognumber": {value: func(t models.FileTags) string { return firstOf(t.CatalogNumbers) }},
+	"media":         {value: func(t models.FileTags) string { return t.Media }},
+	"country":       {value: func(t models.FileTags) string { return t.MBAlbumReleaseCountry }},
+	"releasetype":   {value: func(t models.FileTags) string { return t.MBAlbumType }},
+}
+
+// Fields lists the names a template may use, for the settings form's help text.
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// part is a literal run of the template, or one field.
+type part struct {
+	literal string
+	field   string
+	width   int
+}
+
+// Template is a parsed naming template.
+type Template struct {
+	parts []part
+}
+
+// Parse reads a template. It is rejected when it could not name a file inside the
+// library: empty, absolute, climbing out with "..", or using a field that does not
+// exist. The last segment must hold a field, or every file would get the same name.
+func Parse(spec string) (Template, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Template{}, fmt.Errorf("the template is empty")
+	}
+	if strings.HasPrefix(spec, "/") || strings.HasPrefix(spec, `\`) || (len(spec) > 1 && spec[1] == ':') {
+		return Template{}, fmt.Errorf("the template must be relative to the library folder")
+	}
+	for _, segment := range strings.Split(spec, "/") {
+		if strings.TrimSpace(segment) == "" {
+			return Template{}, fmt.Errorf("the template has an empty folder name")
+		}
+		if segment == "." || segment == ".." {
+			return Template{}, fmt.Errorf("the template may not use %q", segment)
+		}
+	}
+
+	var t Template
+	rest := spec
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.ContainsRune(rest, '}') {
+				return Template{}, fmt.Errorf("unmatched } in the template")
+			}
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if strings.ContainsRune(rest[:open], '}') {
+			return Template{}, fmt.Errorf("unmatched } in the template")
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{literal: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return Template{}, fmt.Errorf("unclosed { in the template")
+		}
+		p, err := parseField(rest[open+1 : open+end])
+		if err != nil {
+			return Template{}, err
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[open+end+1:]
+	}
+
+	last := strings.LastIndex(spec, "/")
+	if !strings.Contains(spec[last+1:], "{") {
+		return Template{}, fmt.Errorf("the file name part of the template has no field, so every file would get the same name")
+	}
+	return t, nil
+}
+
+// parseField reads "name" or "name:width".
+func parseField(raw string) (part, error) {
+	name, format, hasFormat := strings.Cut(strings.TrimSpace(raw), ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	field, ok := fields[name]
+	if !ok {
+		return part{}, fmt.Errorf("{%s} is not a field a template can use", name)
+	}
+	p := part{field: name}
+	if hasFormat {
+		if !field.numeric {
+			return part{}, fmt.Errorf("{%s} is not a number, so it cannot be padded", name)
+		}
+		width, err := strconv.Atoi(strings.TrimSpace(format))
+		if err != nil || width < 1 || width > 9 {
+			return part{}, fmt.Errorf("{%s:%s}: the width must be a number from 1 to 9", name, format)
+		}
+		p.width = width
+	}
+	return p, nil
+}
+
+// Validate is Parse for a settings validator. Empty is valid: it means no template.
+func Validate(spec string) error {
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+	_, err := Parse(spec)
+	return err
+}
+
+// Path evaluates the template for one file's tags, returning a slash-separated path
+// relative to the library with ext (".flac") appended. It fails when a field the
+// template uses is empty: a file named " - .flac" is worse than a file left alone.
+func (t Template) Path(tags models.FileTags, ext string) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		value := strings.TrimSpace(fields[p.field].value(tags))
+		if p.width > 0 {
+			value = pad(value, p.width)
+		}
+		if value == "" {
+			return "", fmt.Errorf("the file has no %s", p.field)
+		}
+		b.WriteString(cleanValue(value))
+	}
+
+	segments := strings.Split(b.String(), "/")
+	for i, segment := range segments {
+		segment = cleanSegment(segment)
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("the template made an empty folder name")
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, "/") + strings.ToLower(ext), nil
+}
+
+// pad zero-pads the number a value starts with: "3" and "3/12" both read as 3.
+// A value that is not a number is left alone.
+func pad(value string, width int) string {
+	digits := value
+	if i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		digits = value[:i]
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// cleanValue makes a field's value safe inside one path segment: the separators go,
+// as do the characters Windows refuses in a name, so a library shared over SMB stays
+// readable from a Windows machine.
+func cleanValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// cleanSegment trims what would make a name awkward or invalid — surrounding spaces,
+// a trailing dot Windows strips — and bounds its length on a rune boundary.
+func cleanSegment(segment string) string {
+	segment = strings.TrimSpace(segment)
+	segment = strings.TrimRight(segment, ". ")
+	if len(segment) > maxSegment {
+		cut := maxSegment
+		for cut > 0 && !utf8.RuneStart(segment[cut]) {
+			cut--
+		}
+		segment = strings.TrimSpace(segment[:cut])
+	}
+	return segment
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// firstOf returns a list's first value, or "".
+func firstOf(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
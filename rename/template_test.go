@@ -0,0 +1,99 @@
+package rename
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+var fixtureTags = models.FileTags{
+	AlbumArtist:  "AC/DC",
+	Album:        "Back in Black",
+	Title:        "Hells Bells",
+	Track:        "1",
+	TrackTotal:   "10",
+	DiscNumber:   "1",
+	ReleaseYear:  "2003",
+	OriginalYear: "1980",
+}
+
+func TestTemplatePath(t *testing.T) {
+	cases := []struct {
+		template string
+		tags     models.FileTags
+		want     string
+	}{
+		{"{albumartist}/{album} ({originalyear})/{disc:02}-{track:02} {title}", fixtureTags, "AC_DC/Back in Black (1980)/01-01 Hells Bells.flac"},
+		// The year falls back to the edition's when there is no original.
+		{"{album} ({originalyear})/{track} {title}", models.FileTags{Album: "A", Title: "T", Track: "3", ReleaseYear: "2001"}, "A (2001)/3 T.flac"},
+		// Characters Windows refuses are replaced; a trailing dot is trimmed.
+		{"{album}/{title}", models.FileTags{Album: "What?...", Title: `a:b"c`}, "What_/a_b_c.flac"},
+		// A track number written "3/12" pads as 3.
+		{"{track:03} {title}", models.FileTags{Title: "T", Track: "3/12"}, "003 T.flac"},
+		// The track artist falls back to the album artist it was blanked for.
+		{"{artist} - {title}", models.FileTags{AlbumArtist: "Talk Talk", Title: "Eden"}, "Talk Talk - Eden.flac"},
+	}
+	for _, tc := range cases {
+		tmpl, err := Parse(tc.template)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.template, err)
+		}
+		got, err := tmpl.Path(tc.tags, ".FLAC")
+		if err != nil {
+			t.Fatalf("Path(%q): %v", tc.template, err)
+		}
+		if got != tc.want {
+			t.Errorf("Path(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
+
+func TestTemplatePathRefusesAnEmptyField(t *testing.T) {
+	tmpl, err := Parse("{albumartist}/{label}/{title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.Path(fixtureTags, ".flac"); err == nil || !strings.Contains(err.Error(), "label") {
+		t.Fatalf("got %v, want an error naming the empty field", err)
+	}
+}
+
+func TestTemplatePathBoundsALongName(t *testing.T) {
+	tmpl, err := Parse("{title}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tmpl.Path(models.FileTags{Title: strings.Repeat("é", 150)}, ".mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimSuffix(got, ".mp3")
+	if len(name) > maxSegment || !strings.HasPrefix(name, "é") || strings.ContainsRune(name, '\uFFFD') {
+		t.Fatalf("name is %d bytes (%q…); want at most %d on a rune boundary", len(name), name[:4], maxSegment)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"/{albumartist}/{title}",
+		"C:/{title}",
+		"{albumartist}//{title}",
+		"../{title}",
+		"{album}/./{title}",
+		"{album}/{title",
+		"{album}/title}",
+		"{album}/{composer}",
+		"{album}/{title:02}",
+		"{album}/{track:0}",
+		"{album}/track",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted it", spec)
+		}
+	}
+	if err := Validate("  "); err != nil {
+		t.Errorf("Validate of an empty template = %v, want nil", err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/aunefyren/autotaggerr/modules"
 	"github.com/aunefyren/autotaggerr/process"
 	"github.com/aunefyren/autotaggerr/settings"
+	"github.com/aunefyren/autotaggerr/watch"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -38,7 +39,10 @@ type API struct {
 	// scan concurrency). May be nil: a nil *settings.Runtime saves to config.json and
 	// reports everything as needing a restart, which is the correct behaviour for a
 	// caller that owns no scheduler.
-	Settings   *settings.Runtime
+	Settings *settings.Runtime
+	// Watcher turns changes in watched libraries into folder scans. May be nil, which
+	// watches nothing.
+	Watcher    *watch.Watcher
 	SigningKey []byte
 	AppName    string
 	Version    string
@@ -132,10 +136,20 @@ func (a *API) Register(rg *gin.RouterGroup) {
 		protected.POST("/libraries/:id/refresh", a.refreshLibrary)
 		protected.POST("/libraries/:id/retag", a.retagLibrary)
 		protected.POST("/libraries/:id/recorrelate", a.recorrelateLibrary)
+		protected.GET("/libraries/:id/rename", a.previewRename)
+		protected.POST("/libraries/:id/rename", a.applyRename)
+		protected.POST("/libraries/:id/import", a.importLibrary)
 
 		// Library items (the correlation index)
 		protected.GET("/library-items", a.listLibraryItems)
 		protected.GET("/library-items/:id/tags", a.itemTags)
+		protected.POST("/library-items/:id/rollback", a.rollbackItem)
+		// The file's tags no write may change, whatever the profile says.
+		protected.PUT("/library-items/:id/locks", a.lockItemFields)
+		// Files held more than once, and the choice of which copy to keep.
+		protected.GET("/library-items/duplicates", a.listDuplicates)
+		protected.POST("/library-items/:id/keep", a.keepDuplicate)
+		protected.DELETE("/library-items/:id/duplicate", a.reattachDuplicate)
 
 		// Manual attach — identify a file MusicBrainz/Lidarr could not
 		protected.GET("/search/releases", a.searchReleases)
@@ -161,6 +175,9 @@ func (a *API) Register(rg *gin.RouterGroup) {
 		protected.POST("/refresh", a.refreshAll)
 		protected.POST("/retag", a.retagAll)
 		protected.GET("/process/status", a.processStatus)
+		protected.POST("/process/cancel", a.cancelProcess)
+		protected.POST("/process/queue/move", a.moveQueuedJob)
+		protected.POST("/process/queue/remove", a.removeQueuedJob)
 
 		// MusicBrainz mirror: the scheduled refresh of the local entity cache.
 		protected.GET("/mirror/status", a.mirrorStatus)
@@ -176,6 +193,10 @@ func (a *API) Register(rg *gin.RouterGroup) {
 		// Activity events
 		protected.GET("/events", a.listEvents)
 		protected.GET("/events/:id", a.getEvent)
+		// Put back what an activity's tag writes changed, from the undo journal.
+		protected.POST("/events/:id/rollback", a.rollbackEvent)
+		// Download an event's rows — a dry run's would-be changes — as JSON or CSV.
+		protected.GET("/events/:id/changes", a.eventChanges)
 		// The files behind one MusicBrainz identifier — which local audio an Activity
 		// row's MBID actually stands for. Fetched on demand, per row, because a detail
 		// list holds hundreds of identifiers and only the one you are looking at is
@@ -204,6 +225,11 @@ func (a *API) Register(rg *gin.RouterGroup) {
 		protected.POST("/artists", a.addArtist)
 		protected.GET("/release-groups/:mbid/releases", a.releaseGroupEditions)
 		protected.POST("/release-groups/:mbid/recorrelate", a.recorrelateReleaseGroup)
+		// The per-artist verbs one level down, for fixing a single album or edition.
+		protected.POST("/release-groups/:mbid/process", a.processReleaseGroup)
+		protected.POST("/release-groups/:mbid/retag", a.retagReleaseGroup)
+		protected.POST("/release-groups/:mbid/refresh", a.refreshReleaseGroup)
+		protected.POST("/releases/:mbid/retag", a.retagRelease)
 		protected.GET("/artists/:mbid/info", a.artistInfo)
 		protected.GET("/artists/:mbid/discography", a.discography)
 		protected.GET("/artists/:mbid/release-groups/:rgid", a.releaseGroupDetail)
@@ -306,6 +332,9 @@ func (a *API) listLibraries(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list libraries"})
 		return
 	}
+	for i := range rows {
+		rows[i] = a.withLiveState(rows[i])
+	}
 	c.JSON(http.StatusOK, rows)
 }
 
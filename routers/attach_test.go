@@ -86,6 +86,7 @@ func recordingWithID(id string) (r struct {
 		Name  string `json:"name"`
 		Count int    `json:"count"`
 	} `json:"tags"`
+	Relations []models.Relation `json:"relations"`
 }) {
 	r.ID = id
 	return r
@@ -2,8 +2,10 @@ package routers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
 
 	"github.com/aunefyren/autotaggerr/auth"
@@ -12,6 +14,8 @@ import (
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/rename"
+	"github.com/aunefyren/autotaggerr/settings"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -359,6 +363,20 @@ type taggerProfileInput struct {
 	IgnoreRedundantContributingArtists *bool   `json:"ignore_redundant_contributing_artists"`
 	MaxGenres                          *int    `json:"max_genres"`
 	MP3MultiValueTags                  *bool   `json:"mp3_multi_value_tags"`
+	EmbedCoverArt                      *bool   `json:"embed_cover_art"`
+	CoverArtMaxSize                    *int    `json:"cover_art_max_size"`
+	CoverArtMaxBytes                   *int    `json:"cover_art_max_bytes"`
+	WritePerformerCredits              *bool   `json:"write_performer_credits"`
+	WriteProducerCredits               *bool   `json:"write_producer_credits"`
+	WriteEngineerCredits               *bool   `json:"write_engineer_credits"`
+	WriteMixerCredits                  *bool   `json:"write_mixer_credits"`
+	WriteArrangerCredits               *bool   `json:"write_arranger_credits"`
+	Locale                             *string `json:"locale"`
+	PreferTransliteratedTitles         *bool   `json:"prefer_transliterated_titles"`
+	WriteReplayGain                    *bool   `json:"write_replay_gain"`
+	// TagPolicies replaces the profile's per-tag policies whole; an empty map clears
+	// them.
+	TagPolicies *map[string]string `json:"tag_policies"`
 }
 
 func (in taggerProfileInput) apply(p *models.TaggerProfile) {
@@ -392,6 +410,80 @@ func (in taggerProfileInput) apply(p *models.TaggerProfile) {
 	if in.MP3MultiValueTags != nil {
 		p.MP3MultiValueTags = *in.MP3MultiValueTags
 	}
+	if in.EmbedCoverArt != nil {
+		p.EmbedCoverArt = *in.EmbedCoverArt
+	}
+	if in.CoverArtMaxSize != nil {
+		p.CoverArtMaxSize = *in.CoverArtMaxSize
+	}
+	if in.CoverArtMaxBytes != nil {
+		p.CoverArtMaxBytes = *in.CoverArtMaxBytes
+	}
+	if in.WritePerformerCredits != nil {
+		p.WritePerformerCredits = *in.WritePerformerCredits
+	}
+	if in.WriteProducerCredits != nil {
+		p.WriteProducerCredits = *in.WriteProducerCredits
+	}
+	if in.WriteEngineerCredits != nil {
+		p.WriteEngineerCredits = *in.WriteEngineerCredits
+	}
+	if in.WriteMixerCredits != nil {
+		p.WriteMixerCredits = *in.WriteMixerCredits
+	}
+	if in.WriteArrangerCredits != nil {
+		p.WriteArrangerCredits = *in.WriteArrangerCredits
+	}
+	if in.Locale != nil {
+		p.Locale = strings.TrimSpace(*in.Locale)
+	}
+	if in.PreferTransliteratedTitles != nil {
+		p.PreferTransliteratedTitles = *in.PreferTransliteratedTitles
+	}
+	if in.WriteReplayGain != nil {
+		p.WriteReplayGain = *in.WriteReplayGain
+	}
+	if in.TagPolicies != nil {
+		p.TagPolicies = normalizeTagPolicies(*in.TagPolicies)
+	}
+}
+
+// checkTagPolicies accepts a policy map whose every value is one of the four policies.
+func checkTagPolicies(c *gin.Context, policies *map[string]string) bool {
+	if policies == nil {
+		return true
+	}
+	for key, policy := range *policies {
+		if strings.TrimSpace(key) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tag_policies: a tag name is empty"})
+			return false
+		}
+		switch policy {
+		case models.TagPolicyOverwrite, models.TagPolicyFillEmpty, models.TagPolicyNever, models.TagPolicyRemove:
+			continue
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tag_policies: %q must be overwrite, fill_empty, never or remove", key)})
+		return false
+	}
+	return true
+}
+
+// normalizeTagPolicies upper-cases the tag names, as the engines diff them, and drops
+// the entries that say what the tag gets anyway (models.DefaultTagPolicy): keeping
+// them would only make two spellings of the same profile. An overwrite entry for
+// ALBUMSORT stays, since without it that tag only fills.
+func normalizeTagPolicies(policies map[string]string) map[string]string {
+	out := make(map[string]string, len(policies))
+	for key, policy := range policies {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if policy != models.DefaultTagPolicy(key) {
+			out[key] = policy
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
 }
 
 func (a *API) getTaggerProfile(c *gin.Context)    { getEntity[models.TaggerProfile](a, c) }
@@ -407,6 +499,9 @@ func (a *API) createTaggerProfile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
 		return
 	}
+	if !checkTagPolicies(c, in.TagPolicies) {
+		return
+	}
 	p := models.TaggerProfile{WriteTags: true}
 	in.apply(&p)
 	if err := a.DB.Create(&p).Error; err != nil {
@@ -431,6 +526,9 @@ func (a *API) updateTaggerProfile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
+	if !checkTagPolicies(c, in.TagPolicies) {
+		return
+	}
 	in.apply(&p)
 	if err := a.DB.Save(&p).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
@@ -450,6 +548,16 @@ type libraryInput struct {
 	Enabled         *bool      `json:"enabled"`
 	Cron            *string    `json:"cron"`
 	UseAcoustID     *bool      `json:"use_acoustid"`
+	// WriteArtworkSidecars is the library's opt-in to cover.jpg / artist.jpg files.
+	WriteArtworkSidecars *bool `json:"write_artwork_sidecars"`
+	Watch                *bool `json:"watch"`
+	// ProcessConcurrency is the library's own worker count; 0 clears it.
+	ProcessConcurrency *int `json:"process_concurrency"`
+	// NamingTemplate is the library's rename layout; empty clears it.
+	NamingTemplate *string `json:"naming_template"`
+	// InboxPath is the folder imports read from; empty clears it.
+	InboxPath  *string `json:"inbox_path"`
+	ImportMode *string `json:"import_mode"`
 }
 
 func (in libraryInput) apply(l *models.Library) {
@@ -477,10 +585,132 @@ func (in libraryInput) apply(l *models.Library) {
 	if in.UseAcoustID != nil {
 		l.UseAcoustID = *in.UseAcoustID
 	}
+	if in.WriteArtworkSidecars != nil {
+		l.WriteArtworkSidecars = *in.WriteArtworkSidecars
+	}
+	if in.Watch != nil {
+		l.Watch = *in.Watch
+	}
+	if in.ProcessConcurrency != nil {
+		l.ProcessConcurrency = *in.ProcessConcurrency
+	}
+	if in.NamingTemplate != nil {
+		l.NamingTemplate = strings.TrimSpace(*in.NamingTemplate)
+	}
+	if in.InboxPath != nil {
+		l.InboxPath = strings.TrimSpace(*in.InboxPath)
+	}
+	if in.ImportMode != nil {
+		l.ImportMode = *in.ImportMode
+	}
+}
+
+func (a *API) getLibrary(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	var l models.Library
+	if err := a.DB.First(&l, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, a.withLiveState(l))
+}
+
+func (a *API) deleteLibrary(c *gin.Context) {
+	deleteEntity[models.Library](a, c)
+	if c.Writer.Status() == http.StatusNoContent {
+		id, _ := uuid.Parse(c.Param("id"))
+		a.Settings.UnscheduleLibrary(id)
+		a.Watcher.Remove(id)
+	}
+}
+
+// librarySaved brings the running process in line with a saved library row: its own
+// schedule, and whether and how it is watched.
+func (a *API) librarySaved(l models.Library) {
+	a.Settings.ScheduleLibrary(l)
+	a.Watcher.Reload(l)
+}
+
+// withLiveState fills in what a library row cannot store: when its own schedule fires
+// next and how it is being watched. A nil Settings or Watcher has installed nothing,
+// so every library reads as unscheduled and unwatched.
+func (a *API) withLiveState(l models.Library) models.Library {
+	l.NextRun = a.Settings.NextLibraryRun(l.ID)
+	l.WatchMode = a.Watcher.Mode(l.ID)
+	return l
+}
+
+// checkLibraryCron rejects a schedule the scheduler would not accept, the way the
+// settings page rejects a bad global one: at save time, not silently at install.
+func checkLibraryCron(c *gin.Context, cron *string) bool {
+	if cron == nil {
+		return true
+	}
+	if err := settings.ValidateLibraryCron(*cron); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cron: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkLibraryConcurrency holds a library's own worker count to the range the global
+// one is held to, with 0 for "use the global one".
+func checkLibraryConcurrency(c *gin.Context, workers *int) bool {
+	if workers == nil || (*workers >= 0 && *workers <= 64) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "process_concurrency must be between 0 and 64"})
+	return false
+}
+
+// checkNamingTemplate rejects a template that could not name a file inside the
+// library, at save time rather than at the first rename.
+func checkNamingTemplate(c *gin.Context, template *string) bool {
+	if template == nil {
+		return true
+	}
+	if err := rename.Validate(*template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "naming_template: " + err.Error()})
+		return false
+	}
+	return true
 }
 
-func (a *API) getLibrary(c *gin.Context)    { getEntity[models.Library](a, c) }
-func (a *API) deleteLibrary(c *gin.Context) { deleteEntity[models.Library](a, c) }
+// checkImportMode accepts the two import modes, and "" for the default.
+func checkImportMode(c *gin.Context, mode *string) bool {
+	if mode == nil {
+		return true
+	}
+	switch *mode {
+	case "", models.ImportModeMove, models.ImportModeCopy:
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "import_mode must be \"move\" or \"copy\""})
+	return false
+}
+
+// checkInboxPath rejects an inbox that overlaps the library. One inside the library
+// would be scanned as library files before it was ever imported; one holding the
+// library would have the library imported into itself.
+func checkInboxPath(c *gin.Context, l models.Library) bool {
+	if l.InboxPath == "" {
+		return true
+	}
+	if !filepath.IsAbs(l.InboxPath) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "inbox_path must be an absolute path"})
+		return false
+	}
+	inbox, root := filepath.Clean(l.InboxPath), filepath.Clean(l.Path)
+	if inbox == root || strings.HasPrefix(inbox, root+string(filepath.Separator)) ||
+		strings.HasPrefix(root, inbox+string(filepath.Separator)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "inbox_path may not be inside the library, nor hold it"})
+		return false
+	}
+	return true
+}
 
 // checkLibraryDataSource validates a library's chosen data source: it must exist and
 // must be a *metadata* provider. Assigning AcoustID or an artwork provider here was
@@ -516,16 +746,21 @@ func (a *API) createLibrary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name and path are required"})
 		return
 	}
-	if !a.checkLibraryDataSource(c, in.DataSourceID) {
+	if !a.checkLibraryDataSource(c, in.DataSourceID) || !checkLibraryCron(c, in.Cron) || !checkLibraryConcurrency(c, in.ProcessConcurrency) ||
+		!checkNamingTemplate(c, in.NamingTemplate) || !checkImportMode(c, in.ImportMode) {
 		return
 	}
 	l := models.Library{Enabled: true}
 	in.apply(&l)
+	if !checkInboxPath(c, l) {
+		return
+	}
 	if err := a.DB.Create(&l).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "create failed"})
 		return
 	}
-	c.JSON(http.StatusCreated, l)
+	a.librarySaved(l)
+	c.JSON(http.StatusCreated, a.withLiveState(l))
 }
 
 func (a *API) updateLibrary(c *gin.Context) {
@@ -543,15 +778,20 @@ func (a *API) updateLibrary(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
-	if !a.checkLibraryDataSource(c, in.DataSourceID) {
+	if !a.checkLibraryDataSource(c, in.DataSourceID) || !checkLibraryCron(c, in.Cron) || !checkLibraryConcurrency(c, in.ProcessConcurrency) ||
+		!checkNamingTemplate(c, in.NamingTemplate) || !checkImportMode(c, in.ImportMode) {
 		return
 	}
 	in.apply(&l)
+	if !checkInboxPath(c, l) {
+		return
+	}
 	if err := a.DB.Save(&l).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 		return
 	}
-	c.JSON(http.StatusOK, l)
+	a.librarySaved(l)
+	c.JSON(http.StatusOK, a.withLiveState(l))
 }
 
 // --- Auth providers ---------------------------------------------------------
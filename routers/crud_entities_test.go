@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"testing"
 
+	"codnect.io/chrono"
 	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/settings"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -49,13 +51,13 @@ func TestEntityCRUDRoundTrips(t *testing.T) {
 		{
 			name:       "library",
 			collection: "/api/v1/libraries",
-			create:     map[string]any{"name": "Music", "path": "/music", "cron": "0 3 * * *", "use_acoustid": true},
+			create:     map[string]any{"name": "Music", "path": "/music", "cron": "0 0 3 * * *", "use_acoustid": true, "write_artwork_sidecars": true},
 			update:     map[string]any{"enabled": false},
 			verify: func(t *testing.T, body map[string]any) {
 				if body["path"] != "/music" {
 					t.Errorf("path = %v, want it preserved", body["path"])
 				}
-				if body["cron"] != "0 3 * * *" {
+				if body["cron"] != "0 0 3 * * *" {
 					t.Errorf("cron = %v, want it preserved", body["cron"])
 				}
 				// A per-library opt-in that silently resets would quietly disable
@@ -63,6 +65,9 @@ func TestEntityCRUDRoundTrips(t *testing.T) {
 				if body["use_acoustid"] != true {
 					t.Errorf("use_acoustid = %v, want it preserved", body["use_acoustid"])
 				}
+				if body["write_artwork_sidecars"] != true {
+					t.Errorf("write_artwork_sidecars = %v, want it preserved", body["write_artwork_sidecars"])
+				}
 				if body["enabled"] != false {
 					t.Errorf("enabled = %v, want false — the update did not apply", body["enabled"])
 				}
@@ -216,6 +221,7 @@ func TestCreateValidation(t *testing.T) {
 		{"tagger profile with an empty name", "/api/v1/tagger-profiles", map[string]any{"name": ""}},
 		{"library without a path", "/api/v1/libraries", map[string]any{"name": "Music"}},
 		{"library without a name", "/api/v1/libraries", map[string]any{"path": "/music"}},
+		{"library with a five-field schedule", "/api/v1/libraries", map[string]any{"name": "Music", "path": "/music", "cron": "0 3 * * *"}},
 		{"data source with an unknown type", "/api/v1/data-sources", map[string]any{"name": "X", "type": "discogs"}},
 		{"data source without a type", "/api/v1/data-sources", map[string]any{"name": "X"}},
 		{"manager with an unknown type", "/api/v1/managers", map[string]any{"name": "X", "type": "beets"}},
@@ -302,3 +308,44 @@ func TestCRUDRequiresAuth(t *testing.T) {
 		}
 	}
 }
+
+// TestLibraryScheduleFollowsTheRow: a library's own schedule is installed when the row
+// is saved with one, and gone again when the library is disabled or deleted — each
+// visible as next_run, without a restart.
+func TestLibraryScheduleFollowsTheRow(t *testing.T) {
+	r, api := setupAPI(t)
+	scheduler := chrono.NewDefaultTaskScheduler()
+	t.Cleanup(func() { <-scheduler.Shutdown() })
+	api.Settings = settings.NewRuntime(scheduler, nil)
+	token := loginToken(t, r)
+
+	library := createEntity(t, r, token, "/api/v1/libraries", map[string]any{
+		"name": "Music", "path": "/music", "cron": "0 0 4 * * *",
+	})
+	if library["next_run"] == nil {
+		t.Fatalf("a new library with a schedule has no next_run: %v", library)
+	}
+	id, _ := library["id"].(string)
+	libraryID := uuid.MustParse(id)
+
+	w := do(r, "PUT", "/api/v1/libraries/"+id, token, map[string]any{"enabled": false})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	var body map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if body["next_run"] != nil || api.Settings.NextLibraryRun(libraryID) != nil {
+		t.Errorf("a disabled library is still scheduled: next_run %v", body["next_run"])
+	}
+
+	do(r, "PUT", "/api/v1/libraries/"+id, token, map[string]any{"enabled": true})
+	if api.Settings.NextLibraryRun(libraryID) == nil {
+		t.Fatal("re-enabling the library did not reinstall its schedule")
+	}
+	if w := do(r, "DELETE", "/api/v1/libraries/"+id, token, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if api.Settings.NextLibraryRun(libraryID) != nil {
+		t.Error("a deleted library kept its schedule")
+	}
+}
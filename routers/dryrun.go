@@ -0,0 +1,108 @@
+package routers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/process"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// dryRunParam reads a run verb's dry-run switches: `dry_run=true`, and optionally
+// `tagger_profile_id`, the profile to try in its place of the libraries' own. A
+// profile without the dry run is refused rather than ignored — a real run with it
+// would not use it, and running the libraries' own instead is not what was asked.
+// Nil is the real run.
+func (a *API) dryRunParam(c *gin.Context) (*process.DryRun, bool) {
+	raw := strings.TrimSpace(c.Query("tagger_profile_id"))
+	if c.Query("dry_run") != "true" {
+		if raw != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a tagger profile can only be tried in a dry run — add dry_run=true"})
+			return nil, false
+		}
+		return nil, true
+	}
+	dry := &process.DryRun{}
+	if raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tagger profile id"})
+			return nil, false
+		}
+		dry.TaggerProfileID = &id
+	}
+	return dry, true
+}
+
+// dryRunRefusal answers a dry run the runner would not queue. The scope was found
+// before the runner was asked, so a missing row here is the profile being tried.
+func dryRunRefusal(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tagger profile not found"})
+		return
+	}
+	logger.Log.Error("failed to queue a dry run. error: " + err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue the dry run"})
+}
+
+// eventChanges downloads what an event recorded per file — for a dry run, every tag
+// it would have changed — as JSON or, with `format=csv`, as a spreadsheet with one
+// line per changed tag. Any event's rows can be downloaded; a dry run's are the ones
+// worth having, since they are all of them (see process.DryRun).
+func (a *API) eventChanges(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	var ev models.Event
+	if err := a.DB.First(&ev, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+		return
+	}
+	items, err := events.Items(a.DB, ev.ID)
+	if err != nil {
+		logger.Log.Error("failed to load detail rows for download. error: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the event's rows"})
+		return
+	}
+
+	name := fmt.Sprintf("autotaggerr-%s-%s", ev.Type, ev.StartedAt.Format("20060102-150405"))
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, gin.H{
+			"event":       ev,
+			"tag_summary": ev.Details["tag_summary"],
+			"files":       items,
+		})
+	case "csv":
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"path", "status", "field", "old", "new", "error"})
+		for _, item := range items {
+			if len(item.Changes) == 0 {
+				_ = w.Write([]string{item.Path, item.Status, "", "", "", item.Error})
+				continue
+			}
+			for _, change := range item.Changes {
+				_ = w.Write([]string{item.Path, item.Status, change.Field, change.Old, change.New, item.Error})
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			logger.Log.Warnf("failed to write the rows of event %s as CSV: %s", ev.ID, err.Error())
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+	}
+}
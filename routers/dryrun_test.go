@@ -0,0 +1,72 @@
+package routers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+// TestDryRunRefusals: a profile is only tried in a dry run, so one without it is a
+// 400 rather than a real run that quietly ignores it; an unknown profile is a 404
+// when the dry run is asked for, not a failure when it runs.
+func TestDryRunRefusals(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+	lib := models.Library{Name: "L", Path: t.TempDir(), Enabled: true}
+	if err := api.DB.Create(&lib).Error; err != nil {
+		t.Fatal(err)
+	}
+	process := "/api/v1/libraries/" + lib.ID.String() + "/process"
+
+	profile := uuid.NewString()
+	if w := do(r, "POST", process+"?tagger_profile_id="+profile, token, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("profile without dry run = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", process+"?dry_run=true&tagger_profile_id=nope", token, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("bad profile id = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", process+"?dry_run=true&tagger_profile_id="+profile, token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown profile = %d, want 404: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestEventChangesDownload downloads a dry run's rows: one CSV line per would-be
+// change, and a format it does not know is refused.
+func TestEventChangesDownload(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+
+	ev := events.Begin(api.DB, models.EventTypeDryRun, "Dry run: Tag files")
+	events.Finish(api.DB, ev, models.EventStatusOK, "1 of 1 files would change", map[string]any{
+		"tag_summary": []models.TagChangeCount{{Field: "GENRE", Files: 1}, {Field: "TITLE", Files: 1}},
+	})
+	events.AddItems(api.DB, ev, []models.EventItem{{
+		Path: "/music/a.flac", Status: models.EventItemStatusWouldChange, TagsWritten: 2,
+		Changes: []models.TagChange{{Field: "GENRE", Old: "", New: "Rock"}, {Field: "TITLE", Old: "a", New: "Song, Part 1"}},
+	}})
+
+	w := do(r, "GET", "/api/v1/events/"+ev.ID.String()+"/changes?format=csv", token, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Fatalf("csv = %d %q: %s", w.Code, w.Header().Get("Content-Disposition"), w.Body.String())
+	}
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[2][2] != "TITLE" || rows[2][4] != "Song, Part 1" {
+		t.Errorf("csv rows = %q, want a header and one line per change", rows)
+	}
+
+	w = do(r, "GET", "/api/v1/events/"+ev.ID.String()+"/changes", token, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tag_summary":[{"field":"GENRE","files":1}`) {
+		t.Errorf("json = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "GET", "/api/v1/events/"+ev.ID.String()+"/changes?format=xml", token, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,310 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Duplicate resolution actions: what happens to the copies that are not kept.
+const (
+	// duplicateActionDetach leaves the file on disk and takes it out of the
+	// collection (see models.LibraryItem.DuplicateOfID).
+	duplicateActionDetach = "detach"
+	// duplicateActionDelete removes the file from disk and its row from the index.
+	duplicateActionDelete = "delete"
+)
+
+// duplicateItem is one copy in a duplicate group, with the name of the library it
+// sits in — the question a duplicate report is read to answer is usually "which
+// library has the extra one", and a library ID does not answer it.
+type duplicateItem struct {
+	models.LibraryItem
+	LibraryName string `json:"library_name"`
+}
+
+// duplicateGroup is a set of indexed files that are the same thing. Key is what they
+// share: an audio hash, or a MusicBrainz release track ID.
+type duplicateGroup struct {
+	Key   string          `json:"key"`
+	Items []duplicateItem `json:"items"`
+}
+
+// listDuplicates reports files held more than once, grouped two ways:
+//
+//   - **by_audio** — the same audio payload (LibraryItem.ContentHash). Byte-identical
+//     audio under whatever tags and paths; this is the copy a manual import made.
+//   - **by_track** — the same MusicBrainz release track. The same recording *on the
+//     same edition*, which catches a second rip or a different encode the hash cannot.
+//
+// A file can appear in both, and often does: the two are separate answers to separate
+// questions, and merging them would hide which one matched. Copies already detached
+// are left out, so resolving a group makes it go away. `library_id` narrows the report
+// to groups with at least one copy in that library — the other copies are still shown,
+// since a duplicate across libraries is exactly the case worth seeing.
+func (a *API) listDuplicates(c *gin.Context) {
+	var libraryID *uuid.UUID
+	if raw := c.Query("library_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid library_id"})
+			return
+		}
+		libraryID = &id
+	}
+
+	byAudio, err := a.duplicateGroups("content_hash", libraryID, a.DB.Where("content_hash <> ''"))
+	if err != nil {
+		logger.Log.Errorf("failed to group duplicates by audio: %s", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list duplicates"})
+		return
+	}
+	// An unmatched row's track ID is an answer its manager has withdrawn, so two of
+	// them sharing one is not a duplicate of anything.
+	byTrack, err := a.duplicateGroups("mb_release_track_id", libraryID,
+		a.DB.Where("mb_release_track_id <> '' AND status <> ?", models.LibraryItemStatusUnmatched))
+	if err != nil {
+		logger.Log.Errorf("failed to group duplicates by track: %s", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"by_audio": byAudio, "by_track": byTrack})
+}
+
+// duplicateGroups groups the live (not detached) items matching `where` by `column`,
+// keeping the groups of more than one.
+func (a *API) duplicateGroups(column string, libraryID *uuid.UUID, where *gorm.DB) ([]duplicateGroup, error) {
+	var keys []string
+	q := a.DB.Model(&models.LibraryItem{}).Where(where).Where("duplicate_of_id IS NULL").
+		Group(column).Having("COUNT(*) > 1")
+	if libraryID != nil {
+		q = q.Having("SUM(CASE WHEN library_id = ? THEN 1 ELSE 0 END) > 0", *libraryID)
+	}
+	if err := q.Pluck(column, &keys).Error; err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return []duplicateGroup{}, nil
+	}
+
+	var items []models.LibraryItem
+	if err := a.DB.Where(column+" IN ? AND duplicate_of_id IS NULL", keys).
+		Order(column).Order("path").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	names, err := a.libraryNames()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []duplicateGroup{}
+	for _, item := range items {
+		key := item.ContentHash
+		if column == "mb_release_track_id" {
+			key = item.MBReleaseTrackID
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, duplicateGroup{Key: key})
+		}
+		last := &groups[len(groups)-1]
+		last.Items = append(last.Items, duplicateItem{LibraryItem: item, LibraryName: names[item.LibraryID]})
+	}
+	return groups, nil
+}
+
+// libraryNames maps every library's ID to its name.
+func (a *API) libraryNames() (map[uuid.UUID]string, error) {
+	var libraries []models.Library
+	if err := a.DB.Select("id", "name").Find(&libraries).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(libraries))
+	for _, library := range libraries {
+		names[library.ID] = library.Name
+	}
+	return names, nil
+}
+
+// keepDuplicate resolves a duplicate group by keeping :id and detaching or deleting
+// each of `losers`. Every loser must actually be a duplicate of the keeper — same
+// audio or same release track — which stops a stale page from deleting a file that
+// has since been re-correlated to something else.
+//
+// Deleting refuses while a run is active: the run may be writing that very file, and
+// a tag write racing an unlink is not a thing to find out about afterwards. Detaching
+// only touches the index and is allowed at any time.
+//
+// Each loser is handled on its own and reported on its own row of one Activity event,
+// so one file that could not be deleted does not stop the rest, and the record says
+// exactly which copies went where.
+func (a *API) keepDuplicate(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Losers []uuid.UUID `json:"losers"`
+		Action string      `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.Losers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "losers is required"})
+		return
+	}
+	if body.Action != duplicateActionDetach && body.Action != duplicateActionDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be detach or delete"})
+		return
+	}
+	if body.Action == duplicateActionDelete && a.Scan != nil && a.Scan.Running() {
+		c.JSON(http.StatusConflict, gin.H{"error": "a run is in progress — try deleting again once it has finished"})
+		return
+	}
+
+	var keeper models.LibraryItem
+	if err := a.DB.First(&keeper, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "library item not found"})
+		return
+	}
+	if keeper.DuplicateOfID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "that copy was itself detached as a duplicate"})
+		return
+	}
+
+	var losers []models.LibraryItem
+	if err := a.DB.Where("id IN ?", body.Losers).Find(&losers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load the duplicates"})
+		return
+	}
+	if len(losers) != len(body.Losers) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "one or more of those items no longer exist"})
+		return
+	}
+	for _, loser := range losers {
+		if loser.ID == keeper.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the kept copy cannot also be a loser"})
+			return
+		}
+		if !sameRecording(keeper, loser) {
+			c.JSON(http.StatusConflict, gin.H{"error": loser.Path + " is not a duplicate of the kept copy"})
+			return
+		}
+	}
+
+	ev := events.Begin(a.DB, models.EventTypeDuplicates, "Kept "+filepath.Base(keeper.Path))
+	items := make([]models.EventItem, 0, len(losers))
+	done, failed := 0, 0
+	for _, loser := range losers {
+		row := models.EventItem{Path: loser.Path, Kind: models.EventItemKindDuplicate}
+		var err error
+		if body.Action == duplicateActionDelete {
+			err = deleteDuplicate(a.DB, loser)
+			row.Status = models.EventItemStatusDeleted
+		} else {
+			err = detachDuplicate(a.DB, loser, keeper.ID)
+			row.Status = models.EventItemStatusDetached
+		}
+		if err != nil {
+			logger.Log.Warnf("failed to %s duplicate %q: %s", body.Action, loser.Path, err.Error())
+			row.Status = models.EventItemStatusError
+			row.Error = err.Error()
+			failed++
+		} else {
+			done++
+		}
+		items = append(items, row)
+	}
+	events.AddItems(a.DB, ev, items)
+
+	verb := "detached"
+	if body.Action == duplicateActionDelete {
+		verb = "deleted"
+	}
+	status := models.EventStatusOK
+	summary := fmt.Sprintf("%d %s %s", done, plural(done, "copy", "copies"), verb)
+	if failed > 0 {
+		status = models.EventStatusError
+		summary += fmt.Sprintf(" · %d failed", failed)
+	}
+	events.Finish(a.DB, ev, status, summary, map[string]any{
+		"by":        "user",
+		"action":    body.Action,
+		"keeper_id": keeper.ID,
+		"keeper":    keeper.Path,
+	})
+
+	a.Rebuilder.Request()
+	c.JSON(http.StatusOK, gin.H{"event_id": ev.ID, verb: done, "failed": failed})
+}
+
+// sameRecording reports whether two items are duplicates by either of the report's
+// two tests.
+func sameRecording(a, b models.LibraryItem) bool {
+	if a.ContentHash != "" && a.ContentHash == b.ContentHash {
+		return true
+	}
+	return a.MBReleaseTrackID != "" && a.MBReleaseTrackID == b.MBReleaseTrackID
+}
+
+// detachDuplicate takes a copy out of the collection without touching the file:
+// unmatched keeps it out of the disk view and out of every write, and DuplicateOfID
+// keeps the scans from correlating it back in.
+func detachDuplicate(db *gorm.DB, item models.LibraryItem, keeperID uuid.UUID) error {
+	return db.Model(&models.LibraryItem{}).Where("id = ?", item.ID).Updates(map[string]any{
+		"duplicate_of_id": keeperID,
+		"status":          models.LibraryItemStatusUnmatched,
+	}).Error
+}
+
+// deleteDuplicate removes a copy from disk, then its row. A file already gone is
+// what was asked for, so it is not an error; a row that outlived its file would be
+// pruned by the next run anyway, but there is no reason to leave it for that.
+func deleteDuplicate(db *gorm.DB, item models.LibraryItem) error {
+	if err := os.Remove(item.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return db.Delete(&models.LibraryItem{}, "id = ?", item.ID).Error
+}
+
+// reattachDuplicate undoes a detach: the copy is handed back to the next scan, which
+// correlates it like any other file.
+func (a *API) reattachDuplicate(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	var item models.LibraryItem
+	if err := a.DB.First(&item, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "library item not found"})
+		return
+	}
+	if item.DuplicateOfID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "that file is not detached as a duplicate"})
+		return
+	}
+	// processed_version is blanked so the next run does not skip the file as
+	// unchanged — detaching never touched it, so nothing else would send it back.
+	if err := a.DB.Model(&models.LibraryItem{}).Where("id = ?", item.ID).Updates(map[string]any{
+		"duplicate_of_id":   nil,
+		"processed_version": "",
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reattach the file"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"duplicate_of_id": nil})
+}
+
+// plural picks the singular or plural form for n.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,157 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// seedDuplicates indexes the same recording three ways: two byte-identical copies in
+// two libraries, and a third file that is the same release track under different
+// audio. A fourth, unrelated file is there to stay out of every group.
+func seedDuplicates(t *testing.T, api *API) (main, imports models.Library, items []models.LibraryItem) {
+	t.Helper()
+	main = models.Library{Name: "Main", Path: "/music"}
+	imports = models.Library{Name: "Imports", Path: "/imports"}
+	for _, library := range []*models.Library{&main, &imports} {
+		if err := api.DB.Create(library).Error; err != nil {
+			t.Fatalf("library: %v", err)
+		}
+	}
+	dir := t.TempDir()
+	items = []models.LibraryItem{
+		{LibraryID: main.ID, ContentHash: "aaa", MBReleaseTrackID: "trk-1", Status: models.LibraryItemStatusOK},
+		{LibraryID: imports.ID, ContentHash: "aaa", MBReleaseTrackID: "trk-1", Status: models.LibraryItemStatusOK},
+		{LibraryID: imports.ID, ContentHash: "bbb", MBReleaseTrackID: "trk-1", Status: models.LibraryItemStatusOK},
+		{LibraryID: main.ID, ContentHash: "ccc", MBReleaseTrackID: "trk-2", Status: models.LibraryItemStatusOK},
+	}
+	for i := range items {
+		items[i].Path = filepath.Join(dir, string(rune('a'+i))+".flac")
+		if err := os.WriteFile(items[i].Path, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := api.DB.Create(&items[i]).Error; err != nil {
+			t.Fatalf("item: %v", err)
+		}
+	}
+	return main, imports, items
+}
+
+type duplicatesResponse struct {
+	ByAudio []duplicateGroup `json:"by_audio"`
+	ByTrack []duplicateGroup `json:"by_track"`
+}
+
+func TestListDuplicatesGroupsByAudioAndByTrack(t *testing.T) {
+	r, api := setupAPI(t)
+	_, _, items := seedDuplicates(t, api)
+	token := loginToken(t, r)
+
+	w := do(r, "GET", "/api/v1/library-items/duplicates", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var got duplicatesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.ByAudio) != 1 || got.ByAudio[0].Key != "aaa" || len(got.ByAudio[0].Items) != 2 {
+		t.Fatalf("by_audio = %+v, want the two identical copies", got.ByAudio)
+	}
+	if names := []string{got.ByAudio[0].Items[0].LibraryName, got.ByAudio[0].Items[1].LibraryName}; names[0] != "Main" || names[1] != "Imports" {
+		t.Errorf("library names = %v", names)
+	}
+	if len(got.ByTrack) != 1 || got.ByTrack[0].Key != "trk-1" || len(got.ByTrack[0].Items) != 3 {
+		t.Fatalf("by_track = %+v, want the three copies of trk-1", got.ByTrack)
+	}
+	for _, item := range got.ByTrack[0].Items {
+		if item.ID == items[3].ID {
+			t.Error("an unrelated file was grouped")
+		}
+	}
+}
+
+// Detaching keeps the file and takes it out of the report; the decision is on the
+// Activity feed, one row per copy.
+func TestKeepDuplicateDetachesTheLoser(t *testing.T) {
+	r, api := setupAPI(t)
+	_, _, items := seedDuplicates(t, api)
+	token := loginToken(t, r)
+
+	w := do(r, "POST", "/api/v1/library-items/"+items[0].ID.String()+"/keep", token, map[string]any{
+		"losers": []string{items[1].ID.String()}, "action": "detach",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var loser models.LibraryItem
+	if err := api.DB.First(&loser, "id = ?", items[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loser.DuplicateOfID == nil || *loser.DuplicateOfID != items[0].ID || loser.Status != models.LibraryItemStatusUnmatched {
+		t.Errorf("loser = {duplicate_of:%v status:%q}, want detached in favour of the keeper", loser.DuplicateOfID, loser.Status)
+	}
+	if _, err := os.Stat(loser.Path); err != nil {
+		t.Errorf("detaching touched the file: %v", err)
+	}
+
+	var event models.Event
+	if err := api.DB.Where("type = ?", models.EventTypeDuplicates).First(&event).Error; err != nil {
+		t.Fatalf("no Activity event: %v", err)
+	}
+	var rows []models.EventItem
+	api.DB.Where("event_id = ?", event.ID).Find(&rows)
+	if len(rows) != 1 || rows[0].Status != models.EventItemStatusDetached || rows[0].Path != loser.Path {
+		t.Errorf("event rows = %+v", rows)
+	}
+
+	w = do(r, "GET", "/api/v1/library-items/duplicates", token, nil)
+	var got duplicatesResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	if len(got.ByAudio) != 0 {
+		t.Errorf("by_audio = %+v after resolving it, want empty", got.ByAudio)
+	}
+}
+
+func TestKeepDuplicateDeletesTheLoser(t *testing.T) {
+	r, api := setupAPI(t)
+	_, _, items := seedDuplicates(t, api)
+	token := loginToken(t, r)
+
+	w := do(r, "POST", "/api/v1/library-items/"+items[0].ID.String()+"/keep", token, map[string]any{
+		"losers": []string{items[2].ID.String()}, "action": "delete",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(items[2].Path); !os.IsNotExist(err) {
+		t.Errorf("the file is still on disk: %v", err)
+	}
+	var count int64
+	api.DB.Model(&models.LibraryItem{}).Where("id = ?", items[2].ID).Count(&count)
+	if count != 0 {
+		t.Error("the deleted copy is still indexed")
+	}
+}
+
+// A stale page must not be able to delete a file that is not a copy of the keeper.
+func TestKeepDuplicateRefusesANonDuplicate(t *testing.T) {
+	r, api := setupAPI(t)
+	_, _, items := seedDuplicates(t, api)
+	token := loginToken(t, r)
+
+	w := do(r, "POST", "/api/v1/library-items/"+items[0].ID.String()+"/keep", token, map[string]any{
+		"losers": []string{items[3].ID.String()}, "action": "delete",
+	})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(items[3].Path); err != nil {
+		t.Errorf("the unrelated file was touched: %v", err)
+	}
+}
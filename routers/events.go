@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/aunefyren/autotaggerr/components"
 	"github.com/aunefyren/autotaggerr/events"
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
@@ -322,5 +323,13 @@ func (a *API) getEvent(c *gin.Context) {
 	}
 	ev.Children = children
 
+	// Whether there is anything for a rollback to put back, so the detail view only
+	// offers one when there is.
+	var journaled int64
+	if err := components.EventJournal(a.DB, ev.ID).Count(&journaled).Error; err != nil {
+		logger.Log.Warnf("failed to count the journaled writes of event %s: %s", ev.ID, err.Error())
+	}
+	ev.Journaled = int(journaled)
+
 	c.JSON(http.StatusOK, ev)
 }
@@ -5,22 +5,13 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/aunefyren/autotaggerr/components"
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
 	"github.com/aunefyren/autotaggerr/modules"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-// acoustidSource returns the enabled AcoustID data source, if one is configured.
-// No row means the feature was never set up, which is a normal state and not an
-// error — the first of the three switches that make this whole pass detachable.
-func acoustidSource(db *gorm.DB) (models.DataSource, bool) {
-	var row models.DataSource
-	err := db.Where("type = ? AND enabled = ?", models.DataSourceTypeAcoustID, true).First(&row).Error
-	return row, err == nil
-}
-
 // acoustidAvailability describes why identification can or cannot run. Reported as
 // its own endpoint so the attach UI can hide the button with an explanation rather
 // than offering an action that always fails.
@@ -32,7 +23,7 @@ type acoustidAvailability struct {
 // identifyAvailability checks the two global switches (a configured data source and
 // fpcalc on PATH). The per-library opt-in is checked per file, in identifyItem.
 func (a *API) identifyAvailability(c *gin.Context) {
-	source, ok := acoustidSource(a.DB)
+	source, ok := components.AcoustIDSource(a.DB)
 	switch {
 	case !ok:
 		c.JSON(http.StatusOK, acoustidAvailability{
@@ -70,7 +61,7 @@ func (a *API) identifyItem(c *gin.Context) {
 		return
 	}
 
-	source, configured := acoustidSource(a.DB)
+	source, configured := components.AcoustIDSource(a.DB)
 	if !configured {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"error": "no enabled AcoustID data source is configured",
@@ -0,0 +1,55 @@
+package routers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/gin-gonic/gin"
+)
+
+// lockFieldsInput is the whole set of a file's locked fields; an empty list unlocks
+// them all.
+type lockFieldsInput struct {
+	Fields []string `json:"fields"`
+}
+
+// lockItemFields sets which of one file's tags no write may change, whatever its
+// library's profile says (models.LibraryItem.LockedFields). The names are the tags as
+// the engines diff them, upper-cased here; the tag-diff view marks the locked rows.
+func (a *API) lockItemFields(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	var item models.LibraryItem
+	if err := a.DB.First(&item, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+		return
+	}
+	var in lockFieldsInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	var fields []string
+	for _, field := range in.Fields {
+		field = strings.ToUpper(strings.TrimSpace(field))
+		if field == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a field name is empty"})
+			return
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+
+	item.LockedFields = fields
+	if err := a.DB.Model(&item).Select("locked_fields").Updates(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save the locked fields"})
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
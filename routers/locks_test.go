@@ -0,0 +1,59 @@
+package routers
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+)
+
+// TestTagPoliciesAndLocks: a profile's policies are validated and stored upper-cased,
+// overwrite entries dropped as the default they are; a file's locks are stored the
+// same way, and an empty list unlocks it.
+func TestTagPoliciesAndLocks(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+
+	if w := do(r, "POST", "/api/v1/tagger-profiles", token, map[string]any{
+		"name": "Bad", "tag_policies": map[string]string{"genre": "sometimes"},
+	}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy = %d, want 400", w.Code)
+	}
+	if w := do(r, "POST", "/api/v1/tagger-profiles", token, map[string]any{
+		"name": "Curated", "tag_policies": map[string]string{"genre": "never", " Title ": "overwrite", "comment": "remove"},
+	}); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	var profile models.TaggerProfile
+	if err := api.DB.First(&profile, "name = ?", "Curated").Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"GENRE": "never", "COMMENT": "remove"}; !reflect.DeepEqual(profile.TagPolicies, want) {
+		t.Errorf("policies = %v, want %v", profile.TagPolicies, want)
+	}
+
+	item := models.LibraryItem{Path: t.TempDir() + "/a.flac"}
+	if err := api.DB.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	locks := "/api/v1/library-items/" + item.ID.String() + "/locks"
+	if w := do(r, "PUT", locks, token, map[string]any{"fields": []string{"genre", "GENRE", "album"}}); w.Code != http.StatusOK {
+		t.Fatalf("lock = %d: %s", w.Code, w.Body.String())
+	}
+	if err := api.DB.First(&item, "id = ?", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ALBUM", "GENRE"}; !reflect.DeepEqual(item.LockedFields, want) {
+		t.Errorf("locked = %v, want %v", item.LockedFields, want)
+	}
+	if w := do(r, "PUT", locks, token, map[string]any{"fields": []string{}}); w.Code != http.StatusOK {
+		t.Fatalf("unlock = %d", w.Code)
+	}
+	if err := api.DB.First(&item, "id = ?", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(item.LockedFields) != 0 {
+		t.Errorf("locked = %v, want none", item.LockedFields)
+	}
+}
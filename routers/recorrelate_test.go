@@ -94,3 +94,43 @@ func TestRecorrelateEndpointsRequireAuth(t *testing.T) {
 		}
 	}
 }
+
+// The album verbs answer the same way: 404 for an unknown MBID, 409 for an album or
+// edition with nothing on disk, 202 once something is queued.
+func TestReleaseGroupVerbsAnswer(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+	for _, path := range []string{
+		"/api/v1/release-groups/nope/process",
+		"/api/v1/release-groups/nope/retag",
+		"/api/v1/release-groups/nope/refresh",
+		"/api/v1/releases/nope/retag",
+	} {
+		if w := do(r, "POST", path, token, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want 404: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	if err := api.DB.Create(&models.CollectionReleaseGroup{MBID: "rg-empty", ArtistMBID: "art", Title: "Empty"}).Error; err != nil {
+		t.Fatalf("create rg: %v", err)
+	}
+	for _, path := range []string{
+		"/api/v1/release-groups/rg-empty/process",
+		"/api/v1/release-groups/rg-empty/retag",
+	} {
+		if w := do(r, "POST", path, token, nil); w.Code != http.StatusConflict {
+			t.Errorf("%s with no files = %d, want 409: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	seedArtistWithFile(t, api, t.TempDir())
+	if err := api.DB.Create(&models.CollectionReleaseGroup{MBID: "rg-1", ArtistMBID: "artist-1", Title: "Album"}).Error; err != nil {
+		t.Fatalf("create rg: %v", err)
+	}
+	if w := do(r, "POST", "/api/v1/releases/rel-1/retag", token, nil); w.Code != http.StatusAccepted {
+		t.Errorf("retag edition = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", "/api/v1/release-groups/rg-1/refresh?force=true", token, nil); w.Code != http.StatusAccepted {
+		t.Errorf("refresh album = %d, want 202: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,76 @@
+package routers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/process"
+	"github.com/aunefyren/autotaggerr/rename"
+	"github.com/gin-gonic/gin"
+)
+
+// previewRename lists what renaming the library by its naming template would move,
+// without moving anything. The plan is built from the tags a re-tag would write, so a
+// large library costs one release lookup per album — cached, but not free the first
+// time.
+func (a *API) previewRename(c *gin.Context) {
+	lib, ok := a.libraryAction(c)
+	if !ok {
+		return
+	}
+	plan, err := a.Scan.PreviewRename(lib.ID)
+	if layoutRefusal(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"library":  lib.Name,
+		"template": lib.NamingTemplate,
+		"fields":   rename.Fields(),
+		"moving":   plan.Moving(),
+		"plan":     plan,
+	})
+}
+
+// applyRename queues the rename. Every move is recorded on the run's Activity event,
+// old path and new, so what it did can be read back afterwards.
+func (a *API) applyRename(c *gin.Context) {
+	lib, ok := a.libraryAction(c)
+	if !ok {
+		return
+	}
+	if layoutRefusal(c, a.Scan.RenameLibrary(lib.ID)) {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "rename queued", "library": lib.Name})
+}
+
+// layoutRefusal answers a library that cannot be renamed or imported into: 409 for
+// one that is not Autotaggerr's to lay out or lacks the template or inbox the verb
+// needs, 500 for anything else. It reports whether it wrote a response.
+func layoutRefusal(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, process.ErrNotNativeManaged), errors.Is(err, process.ErrNoNamingTemplate),
+		errors.Is(err, process.ErrNoInbox):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logger.Log.Warnf("library layout request failed: %s", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
+
+// importLibrary queues an import of the library's inbox. What happened to each file —
+// placed, left unidentified, skipped — is on the run's Activity event.
+func (a *API) importLibrary(c *gin.Context) {
+	lib, ok := a.libraryAction(c)
+	if !ok {
+		return
+	}
+	if layoutRefusal(c, a.Scan.ImportLibrary(lib.ID)) {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "import queued", "library": lib.Name})
+}
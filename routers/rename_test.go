@@ -0,0 +1,84 @@
+package routers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+// TestRenameAnswers: the rename endpoints refuse what cannot be renamed before queuing
+// anything — an escaping template at save time, a library with no template or one
+// Lidarr lays out at request time.
+func TestRenameAnswers(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+
+	w := do(r, "POST", "/api/v1/libraries", token, map[string]any{"name": "Bad", "path": t.TempDir(), "naming_template": "../{title}"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("create with an escaping template = %d, want 400: %s", w.Code, w.Body.String())
+	}
+
+	plain := models.Library{Name: "Plain", Path: t.TempDir(), Enabled: true}
+	named := models.Library{Name: "Named", Path: t.TempDir(), Enabled: true, NamingTemplate: "{albumartist}/{title}"}
+	for _, l := range []*models.Library{&plain, &named} {
+		if err := api.DB.Create(l).Error; err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+	}
+	if w := do(r, "GET", "/api/v1/libraries/"+uuid.NewString()+"/rename", token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("preview of an unknown library = %d, want 404", w.Code)
+	}
+	if w := do(r, "POST", "/api/v1/libraries/"+plain.ID.String()+"/rename", token, nil); w.Code != http.StatusConflict {
+		t.Errorf("rename without a template = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "GET", "/api/v1/libraries/"+named.ID.String()+"/rename", token, nil); w.Code != http.StatusOK {
+		t.Errorf("preview = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	lidarr := models.Manager{Name: "Lidarr", Type: models.ManagerTypeLidarr, Enabled: true, LidarrBaseURL: "http://x", LidarrAPIKey: "k"}
+	if err := api.DB.Create(&lidarr).Error; err != nil {
+		t.Fatalf("create manager: %v", err)
+	}
+	if err := api.DB.Model(&named).Update("manager_id", lidarr.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := do(r, "POST", "/api/v1/libraries/"+named.ID.String()+"/rename", token, nil); w.Code != http.StatusConflict {
+		t.Errorf("rename of a Lidarr library = %d, want 409: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestImportAnswers: an inbox that overlaps the library or an unknown mode is refused
+// at save time, and an import into a library with no inbox at request time; one with
+// an inbox is queued.
+func TestImportAnswers(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+
+	root := t.TempDir()
+	for _, body := range []map[string]any{
+		{"name": "In", "path": root, "inbox_path": root + "/inbox"},
+		{"name": "Around", "path": root + "/music", "inbox_path": root},
+		{"name": "Mode", "path": root, "inbox_path": t.TempDir(), "import_mode": "link"},
+	} {
+		if w := do(r, "POST", "/api/v1/libraries", token, body); w.Code != http.StatusBadRequest {
+			t.Errorf("create %v = %d, want 400: %s", body["name"], w.Code, w.Body.String())
+		}
+	}
+
+	plain := models.Library{Name: "Plain", Path: t.TempDir(), Enabled: true}
+	if err := api.DB.Create(&plain).Error; err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	if w := do(r, "POST", "/api/v1/libraries/"+plain.ID.String()+"/import", token, nil); w.Code != http.StatusConflict {
+		t.Errorf("import without an inbox = %d, want 409: %s", w.Code, w.Body.String())
+	}
+	w := do(r, "PUT", "/api/v1/libraries/"+plain.ID.String(), token, map[string]any{"inbox_path": t.TempDir(), "import_mode": "copy"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set inbox = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", "/api/v1/libraries/"+plain.ID.String()+"/import", token, nil); w.Code != http.StatusAccepted {
+		t.Errorf("import = %d, want 202: %s", w.Code, w.Body.String())
+	}
+}
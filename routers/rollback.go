@@ -0,0 +1,56 @@
+package routers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/process"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// rollbackEvent queues putting back the tag writes an activity made, its stages'
+// included. What was restored, and what was kept because it changed since, is on the
+// rollback's own Activity event.
+func (a *API) rollbackEvent(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	if rollbackRefusal(c, a.Scan.RollbackEvent(id)) {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "rollback queued"})
+}
+
+// rollbackItem queues putting one file back as it was before its last journaled
+// write. Pressed again, it steps one write further back.
+func (a *API) rollbackItem(c *gin.Context) {
+	id, ok := a.idParam(c)
+	if !ok {
+		return
+	}
+	if rollbackRefusal(c, a.Scan.RollbackItem(id)) {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "rollback queued"})
+}
+
+// rollbackRefusal answers a rollback that could not be queued, reporting whether it
+// did. Nothing journaled is a 404: there is no write to roll back, which is the thing
+// the request names.
+func rollbackRefusal(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+	case errors.Is(err, process.ErrNothingJournaled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		logger.Log.Warnf("rollback request failed: %s", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package routers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/events"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+// TestRollbackAnswers: a rollback names a write, so an event or a file with nothing
+// journaled is a 404, as is an unknown file; one with a journaled write is queued.
+// The event and the file say beforehand whether there is anything to roll back.
+func TestRollbackAnswers(t *testing.T) {
+	r, api := setupAPI(t)
+	token := loginToken(t, r)
+
+	if w := do(r, "POST", "/api/v1/events/not-an-id/rollback", token, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("bad id = %d, want 400", w.Code)
+	}
+	if w := do(r, "POST", "/api/v1/library-items/"+uuid.NewString()+"/rollback", token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown item = %d, want 404: %s", w.Code, w.Body.String())
+	}
+
+	run := events.Begin(api.DB, models.EventTypeTagFiles, "Tag files")
+	events.Finish(api.DB, run, models.EventStatusOK, "", nil)
+	item := models.LibraryItem{Path: t.TempDir() + "/a.flac"}
+	if err := api.DB.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := do(r, "POST", "/api/v1/events/"+run.ID.String()+"/rollback", token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("event with nothing journaled = %d, want 404: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", "/api/v1/library-items/"+item.ID.String()+"/rollback", token, nil); w.Code != http.StatusNotFound {
+		t.Errorf("item with nothing journaled = %d, want 404: %s", w.Code, w.Body.String())
+	}
+
+	entry := models.TagJournalEntry{EventID: run.ID, LibraryItemID: &item.ID, Path: item.Path,
+		Changes: []models.JournalChange{{Field: "TITLE", Before: []string{"Old"}, After: []string{"New"}}}}
+	if err := api.DB.Create(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := do(r, "GET", "/api/v1/events/"+run.ID.String(), token, nil); !strings.Contains(w.Body.String(), `"journaled":1`) {
+		t.Errorf("event does not report its journaled write: %s", w.Body.String())
+	}
+	if w := do(r, "POST", "/api/v1/events/"+run.ID.String()+"/rollback", token, nil); w.Code != http.StatusAccepted {
+		t.Errorf("event rollback = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	if w := do(r, "POST", "/api/v1/library-items/"+item.ID.String()+"/rollback", token, nil); w.Code != http.StatusAccepted {
+		t.Errorf("item rollback = %d, want 202: %s", w.Code, w.Body.String())
+	}
+}
@@ -54,16 +54,28 @@ func (a *API) processLibrary(c *gin.Context) {
 	if !ok {
 		return
 	}
+	dry, ok := a.dryRunParam(c)
+	if !ok {
+		return
+	}
 	var lib models.Library
 	if err := a.DB.First(&lib, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "library not found"})
 		return
 	}
-	if err := a.Scan.RunLibrary(id); err != nil {
+	if err := a.Scan.RunLibrary(id, dry); err != nil {
+		if dry != nil {
+			dryRunRefusal(c, err)
+			return
+		}
 		logger.Log.Error("failed to queue library processing. error: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue the run"})
 		return
 	}
+	if dry != nil {
+		c.JSON(http.StatusAccepted, gin.H{"status": "dry run queued"})
+		return
+	}
 	c.JSON(http.StatusAccepted, gin.H{"status": "processing queued"})
 }
 
@@ -87,6 +99,10 @@ func (a *API) retagAll(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "processor unavailable"})
 		return
 	}
+	dry, ok := a.dryRunParam(c)
+	if !ok {
+		return
+	}
 
 	// Counted with the same scope the runner selects with (models.TaggableItems), so
 	// the refusal cannot disagree with the work.
@@ -101,7 +117,14 @@ func (a *API) retagAll(c *gin.Context) {
 		return
 	}
 
-	a.Scan.RetagAll()
+	if err := a.Scan.RetagAll(dry); err != nil {
+		dryRunRefusal(c, err)
+		return
+	}
+	if dry != nil {
+		c.JSON(http.StatusAccepted, gin.H{"status": "dry run queued", "files": count})
+		return
+	}
 	c.JSON(http.StatusAccepted, gin.H{"status": "tagging queued", "files": count})
 }
 
@@ -203,6 +226,10 @@ func (a *API) processArtist(c *gin.Context) {
 	if !ok {
 		return
 	}
+	dry, ok := a.dryRunParam(c)
+	if !ok {
+		return
+	}
 	scope, err := a.Scan.ArtistScope(artist.MBID)
 	if err != nil {
 		if errors.Is(err, process.ErrNothingToProcess) {
@@ -213,8 +240,17 @@ func (a *API) processArtist(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve what to process"})
 		return
 	}
-	a.Scan.Run(scope)
-	c.JSON(http.StatusAccepted, gin.H{"status": "processing queued", "artist": artist.Name, "folders": scope.Detail["folders"]})
+	// Only a dry run can be refused here: the real run's scope is already resolved.
+	scope.DryRun = dry
+	if err := a.Scan.Run(scope); err != nil {
+		dryRunRefusal(c, err)
+		return
+	}
+	status := "processing queued"
+	if dry != nil {
+		status = "dry run queued"
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": status, "artist": artist.Name, "folders": scope.Detail["folders"]})
 }
 
 // scanArtist re-derives one artist's albums from the files already indexed — the
@@ -310,6 +346,79 @@ func (a *API) recorrelateReleaseGroup(c *gin.Context) {
 	c.JSON(http.StatusAccepted, gin.H{"status": "re-correlate queued", "release_group": rgMBID})
 }
 
+// releaseGroupRefusal answers a release-group or release verb that could not be queued:
+// nothing to do is a 409, an unknown MBID a 404. It reports whether it wrote a response.
+func releaseGroupRefusal(c *gin.Context, err error, what, notFound string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, process.ErrNothingToProcess), errors.Is(err, process.ErrNothingToTag):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		logger.Log.Error("failed to resolve " + what + " scope. error: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve what to " + what})
+	}
+	return true
+}
+
+// processReleaseGroup walks one album's folders — processArtist narrowed to the album
+// somebody is fixing.
+func (a *API) processReleaseGroup(c *gin.Context) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scanner unavailable"})
+		return
+	}
+	rgMBID := c.Param("mbid")
+	if releaseGroupRefusal(c, a.Scan.RunReleaseGroup(rgMBID), "process", "release group not found") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "processing queued", "release_group": rgMBID})
+}
+
+// retagReleaseGroup rewrites one album's indexed files from their stored correlations.
+func (a *API) retagReleaseGroup(c *gin.Context) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scanner unavailable"})
+		return
+	}
+	rgMBID := c.Param("mbid")
+	if releaseGroupRefusal(c, a.Scan.RetagReleaseGroup(rgMBID), "tag", "release group not found") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "tagging queued", "release_group": rgMBID})
+}
+
+// retagRelease rewrites the indexed files of one edition — for an album held in two
+// pressings where only one of them is wrong.
+func (a *API) retagRelease(c *gin.Context) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scanner unavailable"})
+		return
+	}
+	releaseMBID := c.Param("mbid")
+	if releaseGroupRefusal(c, a.Scan.RetagRelease(releaseMBID), "tag", "release not found") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "tagging queued", "release": releaseMBID})
+}
+
+// refreshReleaseGroup re-reads one album's edition list and held editions from
+// MusicBrainz. Like refreshArtist it honours the cache unless force is asked for.
+func (a *API) refreshReleaseGroup(c *gin.Context) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scanner unavailable"})
+		return
+	}
+	rgMBID := c.Param("mbid")
+	force := c.Query("force") == "true"
+	if releaseGroupRefusal(c, a.Scan.RefreshReleaseGroup(rgMBID, force), "refresh", "release group not found") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "refresh queued", "release_group": rgMBID, "force": force})
+}
+
 // recorrelateLibrary forces every file in a library to be re-correlated from its
 // manager — the widest repair, for a re-pointed Lidarr instance.
 func (a *API) recorrelateLibrary(c *gin.Context) {
@@ -359,6 +468,60 @@ func (a *API) processStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, a.Scan.Status())
 }
 
+// cancelProcess stops the running job at its next file or release; the queue then
+// moves on to whatever is pending. Like processStatus it covers every queued verb. A
+// stop is safe because nothing is interrupted mid-write and every verb is re-runnable:
+// the next scan skips what this one already finished.
+func (a *API) cancelProcess(c *gin.Context) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "processor unavailable"})
+		return
+	}
+	a.Scan.Cancel()
+	c.JSON(http.StatusOK, a.Scan.Status())
+}
+
+// queuedJobBody names a pending job by the key GET /process/status lists it under.
+// To is the position to move it to, counted from the next job to run; remove ignores
+// it.
+type queuedJobBody struct {
+	Key string `json:"key" binding:"required"`
+	To  int    `json:"to"`
+}
+
+// moveQueuedJob reorders the pending queue. The job that is running is not in it; a
+// key that is not pending — it started or was removed since the page last polled — is
+// a 404, answered with nothing moved.
+func (a *API) moveQueuedJob(c *gin.Context) {
+	a.editQueue(c, func(body queuedJobBody) error { return a.Scan.MoveJob(body.Key, body.To) })
+}
+
+// removeQueuedJob takes a pending job out of the queue before it starts.
+func (a *API) removeQueuedJob(c *gin.Context) {
+	a.editQueue(c, func(body queuedJobBody) error { return a.Scan.RemoveJob(body.Key) })
+}
+
+func (a *API) editQueue(c *gin.Context, edit func(queuedJobBody) error) {
+	if a.Scan == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "processor unavailable"})
+		return
+	}
+	var body queuedJobBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if err := edit(body); err != nil {
+		if errors.Is(err, process.ErrJobNotQueued) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a.Scan.Status())
+}
+
 // listLibraryItems returns a paginated, filterable view of the correlation index.
 // Filters: library_id, status, q (path substring) and mbid. Pagination: limit/offset.
 func (a *API) listLibraryItems(c *gin.Context) {
@@ -466,7 +629,13 @@ func (a *API) itemTags(c *gin.Context) {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"item": item, "tags": tags})
+	// The write a rollback of this file would undo, if the journal holds one.
+	response := gin.H{"item": item, "tags": tags}
+	var last models.TagJournalEntry
+	if err := components.ItemJournal(a.DB, item).Limit(1).Find(&last).Error; err == nil && last.ID != uuid.Nil {
+		response["last_write"] = last
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func parseIntDefault(s string, def int) int {
@@ -45,6 +45,35 @@ func TestTriggerSyncStarts(t *testing.T) {
 	}
 }
 
+// Cancelling answers with the status whether or not anything was running: the button
+// races the job it is aimed at, and a job that finished first is not an error.
+func TestCancelProcessAnswersWithStatus(t *testing.T) {
+	r, _ := setupAPI(t)
+	token := loginToken(t, r)
+
+	status := decodeJSON[map[string]any](t, r, "POST", "/api/v1/process/cancel", token, nil)
+	if status["running"] != false {
+		t.Errorf("running = %v after cancelling an idle queue, want false", status["running"])
+	}
+}
+
+// Editing the queue names a job by key. One that is not pending — it started, or
+// was removed, since the page last polled — is a 404 the page can take as "already
+// gone", not a failure.
+func TestQueueEditsNeedAPendingKey(t *testing.T) {
+	r, _ := setupAPI(t)
+	token := loginToken(t, r)
+
+	for _, path := range []string{"/api/v1/process/queue/move", "/api/v1/process/queue/remove"} {
+		if w := do(r, "POST", path, token, map[string]any{"to": 0}); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s without a key = %d, want 400", path, w.Code)
+		}
+		if w := do(r, "POST", path, token, map[string]any{"key": "retag_all"}); w.Code != http.StatusNotFound {
+			t.Errorf("POST %s for a job not queued = %d, want 404: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
 func TestScanLibraryValidation(t *testing.T) {
 	r, api := setupAPI(t)
 	token := loginToken(t, r)
@@ -169,7 +198,7 @@ func TestScanEndpointsRequireAuth(t *testing.T) {
 			t.Errorf("GET %s = %d, want 401", path, w.Code)
 		}
 	}
-	for _, path := range []string{"/api/v1/process", "/api/v1/refresh"} {
+	for _, path := range []string{"/api/v1/process", "/api/v1/refresh", "/api/v1/process/cancel", "/api/v1/process/queue/move", "/api/v1/process/queue/remove"} {
 		if w := do(r, "POST", path, "", nil); w.Code != http.StatusUnauthorized {
 			t.Errorf("POST %s = %d, want 401", path, w.Code)
 		}
@@ -7,6 +7,7 @@ import (
 	"codnect.io/chrono"
 	"github.com/aunefyren/autotaggerr/logger"
 	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,19 +45,26 @@ type Runtime struct {
 	jobs      []CronJob
 	tasks     map[string]chrono.ScheduledTask
 
-	// setConcurrency is the scan runner's worker-count setter. Kept as a function so
-	// this package does not depend on the scan package (which depends on most of the
-	// app), and so a test can observe the call.
-	setConcurrency func(int)
+	// libraryTasks are the libraries' own schedules (libraries.go), keyed by library
+	// and run through runLibrary.
+	libraryTasks map[uuid.UUID]librarySchedule
+	runLibrary   func(uuid.UUID) error
+
+	// setLimits hands the scan runner its walk limits — worker count, per-format caps,
+	// bandwidth ceiling. Kept as a function so this package does not depend on the
+	// scan package (which depends on most of the app), and so a test can observe the
+	// call.
+	setLimits func(models.ConfigStruct)
 }
 
-// NewRuntime builds the applier. setConcurrency may be nil.
-func NewRuntime(scheduler chrono.TaskScheduler, setConcurrency func(int), jobs ...CronJob) *Runtime {
+// NewRuntime builds the applier. setLimits may be nil.
+func NewRuntime(scheduler chrono.TaskScheduler, setLimits func(models.ConfigStruct), jobs ...CronJob) *Runtime {
 	return &Runtime{
-		scheduler:      scheduler,
-		jobs:           jobs,
-		tasks:          map[string]chrono.ScheduledTask{},
-		setConcurrency: setConcurrency,
+		scheduler:    scheduler,
+		jobs:         jobs,
+		tasks:        map[string]chrono.ScheduledTask{},
+		libraryTasks: map[uuid.UUID]librarySchedule{},
+		setLimits:    setLimits,
 	}
 }
 
@@ -74,7 +82,7 @@ func (r *Runtime) Schedule(cfg models.ConfigStruct) {
 	}
 }
 
-// Stop cancels every scheduled job. It is Schedule's shutdown counterpart: once the
+// Stop cancels every scheduled job, the libraries' own included. It is Schedule's shutdown counterpart: once the
 // process has decided to exit, a cron firing during the drain would queue work that
 // is about to be dropped, and the job it queued would be reported as pending in an
 // Activity feed nobody is going to see.
@@ -92,6 +100,9 @@ func (r *Runtime) Stop() {
 		}
 		delete(r.tasks, name)
 	}
+	for id := range r.libraryTasks {
+		r.unscheduleLibraryLocked(id)
+	}
 }
 
 // Apply pushes cfg onto the running process and reports what it did, in the caller's
@@ -99,6 +110,7 @@ func (r *Runtime) Stop() {
 // are not its business — Save decides that from the field tiers.
 func (r *Runtime) Apply(cfg models.ConfigStruct, changed []string) []string {
 	applied := []string{}
+	limitsChanged := false
 
 	for _, key := range changed {
 		switch key {
@@ -108,12 +120,29 @@ func (r *Runtime) Apply(cfg models.ConfigStruct, changed []string) []string {
 				applied = append(applied, "log level is now "+cfg.AutotaggerrLogLevel)
 			}
 		case "autotaggerr_process_concurrency":
-			if r != nil && r.setConcurrency != nil {
-				r.setConcurrency(cfg.AutotaggerrProcessConcurrency)
+			if r != nil && r.setLimits != nil {
+				limitsChanged = true
 				applied = append(applied, "new scans will use the new worker count")
 			}
+		case "autotaggerr_process_format_concurrency":
+			if r != nil && r.setLimits != nil {
+				limitsChanged = true
+				applied = append(applied, "new scans will use the new per-format caps")
+			}
+		case "autotaggerr_process_io_limit_mb":
+			if r != nil && r.setLimits != nil {
+				limitsChanged = true
+				applied = append(applied, "the bandwidth ceiling applies from the next file")
+			}
+		case "autotaggerr_quiet_hours":
+			// Read live by every runner that honours it, so there is nothing to push.
+			applied = append(applied, "quiet hours apply from the next job or file")
 		}
 	}
+	// Once however many of them changed: the setter takes them all together.
+	if limitsChanged {
+		r.setLimits(cfg)
+	}
 
 	if r != nil && r.scheduler != nil {
 		applied = append(applied, r.applySchedules(cfg, changed)...)
@@ -35,10 +35,10 @@ func newRuntimeForTest(t *testing.T) (*Runtime, *jobRecorder) {
 	t.Cleanup(func() { <-scheduler.Shutdown() })
 
 	runtime := NewRuntime(scheduler,
-		func(n int) {
+		func(c models.ConfigStruct) {
 			recorder.mu.Lock()
 			defer recorder.mu.Unlock()
-			recorder.workers = append(recorder.workers, n)
+			recorder.workers = append(recorder.workers, c.AutotaggerrProcessConcurrency)
 		},
 		CronJob{
 			Name:     "scan",
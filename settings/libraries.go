@@ -0,0 +1,149 @@
+package settings
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"codnect.io/chrono"
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+// Library schedules: a library's own Cron, scanning just that library on top of the
+// global scan schedule. They are not CronJobs because they do not live in the config —
+// a library row is the source of truth, and the CRUD handlers tell the Runtime when one
+// changes instead of Apply reading a list of changed keys.
+//
+// A library with an empty Cron has no schedule of its own and is covered by the global
+// one like any other; so is a disabled library, which the global scan skips too.
+
+// librarySchedule is one installed library schedule: the task, and the expression it
+// was installed with, kept for working out the next run.
+type librarySchedule struct {
+	expression string
+	task       chrono.ScheduledTask
+}
+
+// ValidateLibraryCron checks a library's schedule before it is saved. Empty is valid
+// and means "no schedule of its own"; anything else must parse the way the scheduler
+// will parse it, so a saved schedule cannot fail to install.
+func ValidateLibraryCron(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return nil
+	}
+	return validCron(expression)
+}
+
+// SetLibraryRunner sets what a library schedule does when it fires: queue a scan of
+// that library. Kept as a function for the same reason setConcurrency is. Schedules
+// installed before it is set do nothing when they fire.
+func (r *Runtime) SetLibraryRunner(run func(uuid.UUID) error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runLibrary = run
+}
+
+// ScheduleLibraries installs every library's schedule, replacing any installed before.
+// It is the startup path; afterwards the CRUD handlers keep the set current one library
+// at a time.
+func (r *Runtime) ScheduleLibraries(libraries []models.Library) {
+	if r == nil || r.scheduler == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.libraryTasks {
+		r.unscheduleLibraryLocked(id)
+	}
+	for _, library := range libraries {
+		r.scheduleLibraryLocked(library)
+	}
+}
+
+// ScheduleLibrary brings one library's schedule in line with its saved row: installed,
+// replaced, or removed when the library was disabled or its Cron cleared.
+func (r *Runtime) ScheduleLibrary(library models.Library) {
+	if r == nil || r.scheduler == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unscheduleLibraryLocked(library.ID)
+	r.scheduleLibraryLocked(library)
+}
+
+// UnscheduleLibrary removes a deleted library's schedule.
+func (r *Runtime) UnscheduleLibrary(id uuid.UUID) {
+	if r == nil || r.scheduler == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unscheduleLibraryLocked(id)
+}
+
+// NextLibraryRun is when a library's own schedule fires next, or nil when it has none
+// installed — the global scan is then the only thing that will reach it.
+func (r *Runtime) NextLibraryRun(id uuid.UUID) *time.Time {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	schedule, ok := r.libraryTasks[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	expression, err := chrono.ParseCronExpression(schedule.expression)
+	if err != nil {
+		return nil
+	}
+	next, err := expression.NextTime(time.Now())
+	if err != nil || next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// scheduleLibraryLocked installs a library's schedule when it has one. Callers hold r.mu
+// and have removed any schedule it had. The runner is read when the task fires, not
+// when it is installed, so SetLibraryRunner may come after ScheduleLibraries.
+func (r *Runtime) scheduleLibraryLocked(library models.Library) {
+	expression := strings.TrimSpace(library.Cron)
+	if !library.Enabled || expression == "" {
+		return
+	}
+	id, name := library.ID, library.Name
+	task, err := r.scheduler.ScheduleWithCron(func(ctx context.Context) {
+		r.mu.Lock()
+		run := r.runLibrary
+		r.mu.Unlock()
+		if run == nil {
+			return
+		}
+		if err := run(id); err != nil {
+			logger.Log.Errorf("failed to queue the scheduled scan of library %s. error: %s", name, err.Error())
+		}
+	}, expression)
+	if err != nil {
+		logger.Log.Errorf("failed to schedule library %s with %q: %s", name, expression, err.Error())
+		return
+	}
+	r.libraryTasks[id] = librarySchedule{expression: expression, task: task}
+	logger.Log.Infof("library %s scheduled with %q", name, expression)
+}
+
+// unscheduleLibraryLocked cancels a library's schedule, if any. Callers hold r.mu.
+func (r *Runtime) unscheduleLibraryLocked(id uuid.UUID) {
+	if schedule, ok := r.libraryTasks[id]; ok {
+		if schedule.task != nil {
+			schedule.task.Cancel()
+		}
+		delete(r.libraryTasks, id)
+	}
+}
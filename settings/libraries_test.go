@@ -0,0 +1,68 @@
+package settings
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+)
+
+func library(cron string, enabled bool) models.Library {
+	l := models.Library{Name: "Music", Cron: cron, Enabled: enabled}
+	l.ID = uuid.New()
+	return l
+}
+
+func TestLibrarySchedulesAreInstalledBesideTheGlobalOnes(t *testing.T) {
+	runtime, _ := newRuntimeForTest(t)
+	runtime.Schedule(baseConfig())
+
+	scheduled := library("0 0 4 * * *", true)
+	unscheduled := library("  ", true)
+	disabled := library("0 0 4 * * *", false)
+	runtime.ScheduleLibraries([]models.Library{scheduled, unscheduled, disabled})
+
+	if runtime.NextLibraryRun(scheduled.ID) == nil {
+		t.Error("a library with a schedule has no next run")
+	}
+	if runtime.NextLibraryRun(unscheduled.ID) != nil || runtime.NextLibraryRun(disabled.ID) != nil {
+		t.Error("a library with no schedule, or a disabled one, was scheduled")
+	}
+
+	// A saved row replaces the task rather than adding one; clearing the schedule
+	// removes it. The global jobs are not touched by either.
+	scheduled.Cron = "0 30 4 * * *"
+	runtime.ScheduleLibrary(scheduled)
+	runtime.mu.Lock()
+	libraries, globals := len(runtime.libraryTasks), len(runtime.tasks)
+	expression := runtime.libraryTasks[scheduled.ID].expression
+	runtime.mu.Unlock()
+	if libraries != 1 || globals != 2 || expression != "0 30 4 * * *" {
+		t.Errorf("%d library and %d global tasks, expression %q", libraries, globals, expression)
+	}
+
+	runtime.Stop()
+	if runtime.NextLibraryRun(scheduled.ID) != nil {
+		t.Error("Stop left a library schedule installed")
+	}
+}
+
+func TestLibraryCronIsValidatedLikeTheGlobalOne(t *testing.T) {
+	if err := ValidateLibraryCron(""); err != nil {
+		t.Errorf("an empty schedule is refused: %v", err)
+	}
+	if err := ValidateLibraryCron("0 0 4 * * *"); err != nil {
+		t.Errorf("a valid schedule is refused: %v", err)
+	}
+	if err := ValidateLibraryCron("0 4 * * *"); err == nil || !strings.Contains(err.Error(), "six fields") {
+		t.Errorf("a five-field schedule: %v", err)
+	}
+
+	// A nil Runtime has nothing installed and says so.
+	var none *Runtime
+	none.ScheduleLibrary(library("0 0 4 * * *", true))
+	if none.NextLibraryRun(uuid.New()) != nil {
+		t.Error("a nil Runtime reported a next run")
+	}
+}
@@ -22,6 +22,8 @@ import (
 
 	"codnect.io/chrono"
 	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/aunefyren/autotaggerr/quiet"
 	"github.com/sirupsen/logrus"
 )
 
@@ -142,6 +144,37 @@ func Sections() []Section {
 					get:  func(c models.ConfigStruct) any { return c.AutotaggerrProcessConcurrency },
 					set:  setInt(func(c *models.ConfigStruct, v int) { c.AutotaggerrProcessConcurrency = v }, intRange(1, 64)),
 				},
+				{
+					// Edited as text and stored as a map: config.json keeps the shape a
+					// person writing it by hand expects, and the page needs no field type
+					// for one setting.
+					Key: "autotaggerr_process_format_concurrency", Label: "Files in parallel per format", Type: TypeString, Tier: TierLive,
+					Help:        "Caps one format below the worker count, e.g. flac=2 when FLAC files sit on spinning disks. Leave empty for no caps.",
+					Placeholder: "flac=2, mp3=8",
+					get: func(c models.ConfigStruct) any {
+						return modules.FormatFormatConcurrency(c.AutotaggerrProcessFormatConcurrency)
+					},
+					set: setFormatConcurrency,
+				},
+				{
+					Key: "autotaggerr_process_io_limit_mb", Label: "Disk bandwidth ceiling (MB/s)", Type: TypeInt, Tier: TierLive,
+					Help: "Holds file processing under this many megabytes per second, so a run over a slow disk leaves room for everything else on it. 0 is no ceiling.",
+					get:  func(c models.ConfigStruct) any { return c.AutotaggerrProcessIOLimitMB },
+					set:  setInt(func(c *models.ConfigStruct, v int) { c.AutotaggerrProcessIOLimitMB = v }, intRange(0, 10000)),
+				},
+				{
+					Key: "autotaggerr_quiet_hours", Label: "Quiet hours", Type: TypeString, Tier: TierLive,
+					Help:        "Daily windows in which scheduled and watched work waits and writes no files, e.g. while people are listening. Runs you start yourself are not held. Leave empty for none.",
+					Placeholder: "18:00-23:30",
+					get:         func(c models.ConfigStruct) any { return c.AutotaggerrQuietHours },
+					set:         setString(func(c *models.ConfigStruct, v string) { c.AutotaggerrQuietHours = v }, quiet.Validate),
+				},
+				{
+					Key: "autotaggerr_process_resume_hours", Label: "Resume stopped runs for (hours)", Type: TypeInt, Tier: TierRestart,
+					Help: "A run that was stopped or cut short by a restart is picked up where it stopped by the next run of the same scope within this many hours. Negative turns resuming off.",
+					get:  func(c models.ConfigStruct) any { return c.AutotaggerrProcessResumeHours },
+					set:  setInt(func(c *models.ConfigStruct, v int) { c.AutotaggerrProcessResumeHours = v }, intRange(-1, 24*30)),
+				},
 				{
 					Key: "autotaggerr_health_cron_schedule", Label: "Health-check schedule", Type: TypeCron, Tier: TierLive,
 					Help:        "How often the Lidarr/Plex connections are probed. Only a change in health is recorded.",
@@ -358,6 +391,12 @@ func Sections() []Section {
 					get:  func(c models.ConfigStruct) any { return c.AutotaggerrEventDetailRetention },
 					set:  setInt(func(c *models.ConfigStruct, v int) { c.AutotaggerrEventDetailRetention = v }, intRange(1, 100000)),
 				},
+				{
+					Key: "autotaggerr_tag_journal_days", Label: "Tag writes can be rolled back for (days)", Type: TypeInt, Tier: TierRestart,
+					Help: "How long the fields a tag write changed are kept, so the write can be rolled back from its activity or from the file. Negative turns the journal off.",
+					get:  func(c models.ConfigStruct) any { return c.AutotaggerrTagJournalDays },
+					set:  setInt(func(c *models.ConfigStruct, v int) { c.AutotaggerrTagJournalDays = v }, intRange(-1, 3650)),
+				},
 			},
 		},
 		{
@@ -562,6 +601,21 @@ func setBool(assign func(*models.ConfigStruct, bool)) func(*models.ConfigStruct,
 	}
 }
 
+// setFormatConcurrency parses the per-format caps' text form into the map config.json
+// stores (see modules.ParseFormatConcurrency).
+func setFormatConcurrency(cfg *models.ConfigStruct, raw json.RawMessage) error {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("expected text")
+	}
+	caps, err := modules.ParseFormatConcurrency(value)
+	if err != nil {
+		return err
+	}
+	cfg.AutotaggerrProcessFormatConcurrency = caps
+	return nil
+}
+
 // --- validators ---------------------------------------------------------------
 
 func required(value string) error {
@@ -279,17 +279,21 @@ func DescribeTagValues(values []string) string {
 // The desired values must already be in the representation the writer will produce
 // (see renderFLACValues) — comparing an unrendered value against what comes back off
 // disk is how a file ends up re-tagged on every scan forever.
+//
+// The profile's per-tag policies and the file's locked fields are honoured here (see
+// ApplyTagPolicies), so a key they keep is never a change.
 func DiffFlacTags(existing map[string][]string, desired map[string][]string, tagger models.TaggerSettings) (map[string][]string, bool) {
 	changes := make(map[string][]string)
 	hasChanges := false
 
-	for k, want := range desired {
+	for k, want := range ApplyTagPolicies(existing, desired, tagger) {
 		key := strings.ToUpper(k)
 		wantValues := cleanTagValues(want)
 
 		// An empty desired value means "Autotaggerr has nothing to say about this
-		// tag", not "clear it" — unless the tagger profile says otherwise.
-		if len(wantValues) == 0 && !tagger.RemoveValues {
+		// tag", not "clear it" — unless the tagger profile says otherwise, for every
+		// tag or for this one.
+		if len(wantValues) == 0 && !tagger.RemoveValues && tagger.TagPolicy(key) != models.TagPolicyRemove {
 			continue
 		}
 
@@ -301,6 +305,57 @@ func DiffFlacTags(existing map[string][]string, desired map[string][]string, tag
 	return changes, hasChanges
 }
 
+// ApplyTagPolicies is the desired map as the profile's per-tag policies and the file's
+// locked fields leave it: a tag the file keeps (TagPolicyNever, a lock, or
+// TagPolicyFillEmpty over a value the file already has) wants what the file holds,
+// and a tag to be removed wants nothing — added when the engine does not write it
+// otherwise, so a policy can clear a tag another tagger left. Everything else is as
+// the engine built it. The result is a new map; desired is not changed.
+//
+// It changes what is wanted rather than filtering the diff's result because the
+// writers read the desired map too: an MP3 rewrites TRCK whole when either half
+// changes, and a locked TRACKTOTAL has to go back in as the file had it. Applying it
+// twice is the same as applying it once, so a writer that applies it before diffing
+// agrees with the diff.
+func ApplyTagPolicies(existing, desired map[string][]string, tagger models.TaggerSettings) map[string][]string {
+	out := make(map[string][]string, len(desired))
+	for k, want := range desired {
+		key := strings.ToUpper(k)
+		switch tagger.TagPolicy(key) {
+		case models.TagPolicyNever:
+			want = existing[key]
+		case models.TagPolicyFillEmpty:
+			if len(cleanTagValues(existing[key])) > 0 {
+				want = existing[key]
+			}
+		case models.TagPolicyRemove:
+			want = nil
+		}
+		out[k] = want
+	}
+	for key, policy := range tagger.TagPolicies {
+		key = strings.ToUpper(key)
+		if policy != models.TagPolicyRemove || tagger.TagPolicy(key) != models.TagPolicyRemove {
+			continue
+		}
+		if !hasDesiredKey(out, key) && len(existing[key]) > 0 {
+			out[key] = nil
+		}
+	}
+	return out
+}
+
+// hasDesiredKey finds key in a desired map whatever its spelling there: the maps keep
+// the spelling a tag is written with ("originaldate"), and the diff works in upper case.
+func hasDesiredKey(desired map[string][]string, upperKey string) bool {
+	for k := range desired {
+		if strings.ToUpper(k) == upperKey {
+			return true
+		}
+	}
+	return false
+}
+
 // cleanTagValues is NormalizeTagValues plus a case-insensitive dedup that keeps the
 // first spelling. It is applied to both sides of a comparison, so a file another
 // tagger wrote the same genre into twice does not read back as a difference that can
@@ -344,6 +399,13 @@ func sameTagValues(have, want []string) bool {
 	return true
 }
 
+// SameTagValues reports whether two lists of a field's values say the same thing, as
+// the diff compares them: normalized, duplicates dropped, in order. It is how a
+// rollback tells a field still as a write left it from one changed since.
+func SameTagValues(a, b []string) bool {
+	return sameTagValues(a, cleanTagValues(b))
+}
+
 // DiffID3Tags is DiffFlacTags for ID3: same comparison, same rule about empty
 // values. An empty desired value only becomes a change when the tagger profile's
 // remove_values is on, so the setting means the same thing on both engines — before,
@@ -357,10 +419,10 @@ func sameTagValues(have, want []string) bool {
 func DiffID3Tags(existing map[string][]string, desired map[string][]string, tagger models.TaggerSettings) (map[string][]string, bool) {
 	changes := make(map[string][]string)
 	has := false
-	for k, want := range desired {
+	for k, want := range ApplyTagPolicies(existing, desired, tagger) {
 		key := strings.ToUpper(k)
 		wantValues := cleanTagValues(want)
-		if len(wantValues) == 0 && !tagger.RemoveValues {
+		if len(wantValues) == 0 && !tagger.RemoveValues && tagger.TagPolicy(key) != models.TagPolicyRemove {
 			continue
 		}
 		if !sameTagValues(existing[key], wantValues) {
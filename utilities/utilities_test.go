@@ -281,6 +281,44 @@ func TestDiffID3Tags(t *testing.T) {
 	})
 }
 
+// TestDiffHonoursTagPolicies: each of the profile's per-tag policies, and a file's
+// lock over the profile, on both engines' diffs.
+func TestDiffHonoursTagPolicies(t *testing.T) {
+	existing := map[string][]string{"GENRE": {"hand picked"}, "TITLE": {"Old"}, "MOOD": {"calm"}, "COMMENT": {"rip"}}
+	desired := map[string][]string{"genre": {"rock"}, "title": {"New"}, "mood": {"dark"}, "comment": nil, "album": {"Album"}}
+	tagger := models.TaggerSettings{TagPolicies: map[string]string{
+		"GENRE":   models.TagPolicyNever,
+		"MOOD":    models.TagPolicyFillEmpty,
+		"ALBUM":   models.TagPolicyFillEmpty,
+		"COMMENT": models.TagPolicyRemove,
+		"ASIN":    models.TagPolicyRemove,
+	}}
+	existing["ASIN"] = []string{"B000"}
+	want := map[string][]string{"TITLE": {"New"}, "ALBUM": {"Album"}, "COMMENT": nil, "ASIN": nil}
+
+	for name, diff := range map[string]func(map[string][]string, map[string][]string, models.TaggerSettings) (map[string][]string, bool){
+		"flac": DiffFlacTags, "id3": DiffID3Tags,
+	} {
+		t.Run(name, func(t *testing.T) {
+			changes, has := diff(existing, desired, tagger)
+			if !has || !reflect.DeepEqual(changes, want) {
+				t.Errorf("changes = %v, want %v", changes, want)
+			}
+
+			// A lock keeps the title too, where the profile would overwrite it.
+			locked := tagger
+			locked.LockedFields = []string{"title"}
+			changes, _ = diff(existing, desired, locked)
+			if _, ok := changes["TITLE"]; ok {
+				t.Errorf("a locked TITLE was changed: %v", changes)
+			}
+		})
+	}
+	if len(desired) != 5 || desired["genre"][0] != "rock" {
+		t.Errorf("the diff changed the caller's desired map: %v", desired)
+	}
+}
+
 // SortTagChanges orders a diff by field name in place, so the same write always
 // reports its fields in the same order rather than shuffling on each map iteration.
 func TestSortTagChanges(t *testing.T) {
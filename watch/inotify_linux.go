@@ -0,0 +1,168 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is what a watched folder reports: a file finished writing, an entry
+// arrived or left by a move, or was created or deleted. IN_MODIFY is left out on
+// purpose — it fires per write(2), and IN_CLOSE_WRITE says the same thing once.
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE | unix.IN_ONLYDIR
+
+// networkFilesystems are the statfs magics of filesystems where inotify only sees
+// changes made through this machine, which for a shared library is not the changes
+// that matter. FUSE is among them: sshfs and rclone are the common cases, and a local
+// FUSE union that would have worked costs only a poll.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x5346414f: "afs",
+	0x00c36400: "ceph",
+}
+
+// isNetworkFS reports whether path is on one of the networkFilesystems.
+func isNetworkFS(path string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return false
+	}
+	_, ok := networkFilesystems[uint32(stat.Type)]
+	return ok
+}
+
+// inotifyWatch is one library's inotify instance: a watch on every folder under the
+// root, since inotify is not recursive.
+type inotifyWatch struct {
+	file  *os.File
+	fd    int
+	root  string
+	touch func(path string, isDir bool)
+
+	mu     sync.Mutex
+	dirs   map[int]string // watch descriptor -> folder
+	closed bool
+}
+
+// watchInotify starts watching root and everything under it, reporting changes to
+// touch. It fails — and the caller polls instead — when inotify is unavailable or the
+// tree does not fit in the user's watch limit.
+func watchInotify(root string, touch func(path string, isDir bool)) (stop func(), err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// Non-blocking and wrapped in an *os.File, the descriptor is read through the
+	// runtime's poller, which is what lets Close interrupt a read that is waiting.
+	w := &inotifyWatch{file: os.NewFile(uintptr(fd), "inotify"), fd: fd, root: root, touch: touch, dirs: map[int]string{}}
+	if err := w.addTree(root); err != nil {
+		w.close()
+		return nil, err
+	}
+	go w.read()
+	return w.close, nil
+}
+
+func (w *inotifyWatch) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		w.file.Close()
+	}
+}
+
+// addTree adds a watch on dir and every folder under it. A folder that vanished or
+// cannot be read is skipped; running out of watches is an error, because a library
+// that is only partly watched would miss imports without saying so.
+func (w *inotifyWatch) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.closed {
+			return filepath.SkipAll
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, path, inotifyMask)
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("the inotify watch limit is reached (raise fs.inotify.max_user_watches): %w", err)
+		}
+		if err != nil {
+			logger.Log.Debugf("cannot watch %q: %s", path, err.Error())
+			return nil
+		}
+		// A folder moved within the library keeps its watch descriptor, so this is
+		// also where a renamed folder's path is brought up to date.
+		w.dirs[wd] = path
+		return nil
+	})
+}
+
+func (w *inotifyWatch) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logger.Log.Errorf("stopped watching %q: %s", w.root, err.Error())
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+			w.handle(int(event.Wd), event.Mask, name)
+		}
+	}
+}
+
+func (w *inotifyWatch) handle(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost, so which folders changed is unknown: the whole library
+		// is the only honest answer.
+		logger.Log.Warnf("inotify queue overflowed for %q; rescanning the library", w.root)
+		w.touch(w.root, true)
+		return
+	}
+
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		ok = false
+	}
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	isDir := mask&unix.IN_ISDIR != 0
+	if isDir && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		// A new folder needs watches of its own before anything inside it is seen —
+		// and whatever landed in it before they were added is covered by scanning the
+		// folder itself.
+		if err := w.addTree(path); err != nil {
+			logger.Log.Warnf("cannot watch new folder %q: %s", path, err.Error())
+		}
+	}
+	w.touch(path, isDir)
+}
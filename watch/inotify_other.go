@@ -0,0 +1,11 @@
+//go:build !linux
+
+package watch
+
+// Outside Linux there is no inotify, and every watched library is polled.
+
+func isNetworkFS(string) bool { return false }
+
+func watchInotify(string, func(string, bool)) (func(), error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/modules"
+)
+
+// fileState is what a poll remembers of a file: enough to tell it was rewritten.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// pollTree is the backend for a library inotify cannot watch. It re-reads the tree
+// every interval and reports each file that appeared, vanished or changed since the
+// last read. The first read is the baseline and reports nothing: what was there before
+// the watch started is the scheduled scan's business.
+func pollTree(root string, interval time.Duration, touch func(path string, isDir bool)) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		previous := snapshot(root)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				current := snapshot(root)
+				if current == nil {
+					continue // the mount is away; compare against the next read that works
+				}
+				if previous != nil {
+					for _, path := range diffSnapshots(previous, current) {
+						touch(path, false)
+					}
+				}
+				previous = current
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// snapshot reads the state of every supported file under root, or nil when root itself
+// cannot be read — an unmounted share is not a library whose files were all deleted.
+func snapshot(root string) map[string]fileState {
+	if _, err := os.Stat(root); err != nil {
+		return nil
+	}
+	files := map[string]fileState{}
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !modules.IsSupportedFile(path) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+// diffSnapshots lists the files that differ between two reads.
+func diffSnapshots(previous, current map[string]fileState) []string {
+	var changed []string
+	for path, state := range current {
+		if before, ok := previous[path]; !ok || before.size != state.size || !before.modTime.Equal(state.modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
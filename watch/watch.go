@@ -0,0 +1,367 @@
+// Package watch turns changes on disk into scoped scans, so a file a manager imports on
+// a Tuesday is tagged on the Tuesday rather than at the Sunday scan.
+//
+// Each watched library gets a backend that reports "something changed under this
+// path": inotify where the kernel will tell us, polling where it will not — a network
+// mount, where a change made by another machine never raises an inotify event on this
+// one, or a kernel whose watch limit the library does not fit in. Whichever reports it,
+// the change is reduced to the album folder it happened in and debounced: an import is
+// a burst of creates and writes, and scanning the folder after the first of them would
+// read half-copied files. Once a folder has been quiet for the settle time it is
+// handed to the scan runner as a folder scope, on the same queue as every other scan.
+//
+// Our own tag writes are changes on disk too. A settled folder is therefore checked
+// against the file index first, and dropped when every file in it is already indexed
+// at its current size and modification time — which is exactly what a scan leaves
+// behind, so a scan does not re-trigger itself.
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/logger"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/aunefyren/autotaggerr/modules"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSettle is how long a folder must go without a change before it is
+	// scanned. Long enough for a manager to finish moving an album in; a folder that
+	// keeps changing keeps waiting.
+	defaultSettle = 30 * time.Second
+	// defaultPollInterval is how often a polled library is re-read. Each poll stats
+	// every file in the library, so this trades latency against disk traffic on a
+	// mount that is, by definition, not local.
+	defaultPollInterval = 5 * time.Minute
+	// flushTick is how often settled folders are looked for.
+	flushTick = time.Second
+)
+
+// Backend modes, as reported in the API.
+const (
+	ModeInotify = "inotify"
+	ModePoll    = "poll"
+)
+
+// errUnsupported reports a platform or filesystem inotify cannot watch; the library
+// is polled instead.
+var errUnsupported = errors.New("inotify is not available here")
+
+// Watcher owns one backend per watched library. A nil *Watcher is usable and watches
+// nothing, so a caller without one (tests, the one-shot file mode) needs no branch.
+type Watcher struct {
+	db  *gorm.DB
+	run func(models.Library, []string)
+
+	settle       time.Duration
+	pollInterval time.Duration
+
+	mu        sync.Mutex
+	libraries map[uuid.UUID]*libraryWatch
+	stopped   bool
+}
+
+// NewWatcher builds a watcher that hands settled folders to run — in production the
+// scan runner's RunFolders. Nothing is watched until Start.
+func NewWatcher(db *gorm.DB, run func(library models.Library, folders []string)) *Watcher {
+	return &Watcher{
+		db:           db,
+		run:          run,
+		settle:       defaultSettle,
+		pollInterval: defaultPollInterval,
+		libraries:    map[uuid.UUID]*libraryWatch{},
+	}
+}
+
+// Start watches every enabled library that has opted in. Libraries saved afterwards
+// are picked up through Reload.
+func (w *Watcher) Start() {
+	if w == nil {
+		return
+	}
+	var libraries []models.Library
+	if err := w.db.Where("enabled = ? AND watch = ?", true, true).Find(&libraries).Error; err != nil {
+		logger.Log.Error("failed to load libraries to watch. error: " + err.Error())
+		return
+	}
+	for _, library := range libraries {
+		w.Reload(library)
+	}
+}
+
+// Reload brings one library's watch in line with its saved row: started, restarted on
+// a new path, or stopped when the library was disabled or opted out.
+func (w *Watcher) Reload(library models.Library) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existing, ok := w.libraries[library.ID]; ok {
+		existing.stop()
+		delete(w.libraries, library.ID)
+	}
+	if w.stopped || !library.Enabled || !library.Watch {
+		return
+	}
+	lw, err := w.start(library)
+	if err != nil {
+		logger.Log.Errorf("failed to watch library %s. error: %s", library.Name, err.Error())
+		return
+	}
+	w.libraries[library.ID] = lw
+}
+
+// Remove stops watching a deleted library.
+func (w *Watcher) Remove(id uuid.UUID) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if existing, ok := w.libraries[id]; ok {
+		existing.stop()
+		delete(w.libraries, id)
+	}
+}
+
+// Stop stops every watch and refuses new ones. Folders still settling are dropped:
+// the process is leaving, and the next scan finds them anyway.
+func (w *Watcher) Stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for id, lw := range w.libraries {
+		lw.stop()
+		delete(w.libraries, id)
+	}
+}
+
+// Mode reports how a library is being watched — ModeInotify, ModePoll — or "" when it
+// is not.
+func (w *Watcher) Mode(id uuid.UUID) string {
+	if w == nil {
+		return ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if lw, ok := w.libraries[id]; ok {
+		return lw.mode
+	}
+	return ""
+}
+
+// start picks a backend for a library and starts it with its flusher. Callers hold
+// w.mu.
+func (w *Watcher) start(library models.Library) (*libraryWatch, error) {
+	if _, err := os.Stat(library.Path); err != nil {
+		return nil, err
+	}
+	lw := &libraryWatch{
+		library: library,
+		settle:  w.settle,
+		pending: map[string]time.Time{},
+		done:    make(chan struct{}),
+	}
+
+	var stopBackend func()
+	var err error
+	if isNetworkFS(library.Path) {
+		err = errUnsupported
+		logger.Log.Infof("library %s is on a network filesystem; polling it every %s", library.Name, w.pollInterval)
+	} else {
+		stopBackend, err = watchInotify(library.Path, lw.touch)
+		if err != nil {
+			logger.Log.Warnf("cannot watch library %s with inotify (%s); polling it every %s", library.Name, err.Error(), w.pollInterval)
+		}
+	}
+	if err != nil {
+		stopBackend = pollTree(library.Path, w.pollInterval, lw.touch)
+		lw.mode = ModePoll
+		// A poll sees a change up to an interval late and sees a copy in progress
+		// only as "changed since last time", so a polled folder settles only once a
+		// poll has found it unchanged.
+		lw.settle = w.pollInterval + w.settle
+	} else {
+		lw.mode = ModeInotify
+	}
+	lw.stopBackend = stopBackend
+
+	go lw.flushLoop(w.db, w.run)
+	logger.Log.Infof("watching library %s (%s)", library.Name, lw.mode)
+	return lw, nil
+}
+
+// libraryWatch is one library's backend and the folders it has reported that have not
+// settled yet.
+type libraryWatch struct {
+	library     models.Library
+	mode        string
+	settle      time.Duration
+	stopBackend func()
+
+	mu      sync.Mutex
+	pending map[string]time.Time // folder -> last change seen in it
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// touch records a change at path. A file change belongs to its folder; a folder
+// created, moved or deleted is itself the folder, since a scan walks it recursively.
+// Files a scan would not process — artwork, a manager's temporary names — are not
+// changes worth a scan.
+func (lw *libraryWatch) touch(path string, isDir bool) {
+	folder := path
+	if !isDir {
+		if !modules.IsSupportedFile(path) {
+			return
+		}
+		folder = filepath.Dir(path)
+	}
+	if !within(folder, lw.library.Path) {
+		return
+	}
+	lw.mu.Lock()
+	lw.pending[folder] = time.Now()
+	lw.mu.Unlock()
+}
+
+func (lw *libraryWatch) stop() {
+	lw.stopOnce.Do(func() {
+		close(lw.done)
+		if lw.stopBackend != nil {
+			lw.stopBackend()
+		}
+	})
+}
+
+func (lw *libraryWatch) flushLoop(db *gorm.DB, run func(models.Library, []string)) {
+	ticker := time.NewTicker(flushTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lw.done:
+			return
+		case now := <-ticker.C:
+			if folders := lw.settled(now); len(folders) > 0 {
+				lw.flush(db, run, folders)
+			}
+		}
+	}
+}
+
+// settled takes the folders that have been quiet for the settle time out of pending.
+func (lw *libraryWatch) settled(now time.Time) []string {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	var folders []string
+	for folder, last := range lw.pending {
+		if now.Sub(last) >= lw.settle {
+			folders = append(folders, folder)
+			delete(lw.pending, folder)
+		}
+	}
+	return folders
+}
+
+// flush hands the settled folders that actually differ from the index to run, as one
+// scope: an import of three albums is one scan, not three.
+func (lw *libraryWatch) flush(db *gorm.DB, run func(models.Library, []string), folders []string) {
+	var changed []string
+	for _, folder := range collapseNested(folders) {
+		dirty, err := folderChanged(db, lw.library.ID, folder)
+		if err != nil {
+			logger.Log.Warnf("failed to compare %q with the index; scanning it. error: %s", folder, err.Error())
+			dirty = true
+		}
+		if dirty {
+			changed = append(changed, folder)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	logger.Log.Infof("changes settled in %d folder(s) of library %s; queuing a scan", len(changed), lw.library.Name)
+	run(lw.library, changed)
+}
+
+// collapseNested drops every folder that is inside another one in the set — the outer
+// folder's walk covers it — and sorts the rest.
+func collapseNested(folders []string) []string {
+	sorted := append([]string(nil), folders...)
+	sort.Strings(sorted)
+	out := make([]string, 0, len(sorted))
+	for _, folder := range sorted {
+		if len(out) > 0 && within(folder, out[len(out)-1]) {
+			continue
+		}
+		out = append(out, folder)
+	}
+	return out
+}
+
+// folderChanged reports whether a folder holds anything the index does not already
+// know at its current size and modification second: a file that is new or rewritten,
+// or an indexed file that has gone. This is the test shouldSkip applies file by file,
+// asked of the whole folder before a scan is queued for it.
+func folderChanged(db *gorm.DB, libraryID uuid.UUID, folder string) (bool, error) {
+	// A range on the path rather than LIKE: no escaping of the folder's own % and _,
+	// and the unique index on path serves it. '0' is the byte after '/'.
+	prefix := folder + string(filepath.Separator)
+	var items []models.LibraryItem
+	if err := db.Where("library_id = ? AND path > ? AND path < ?", libraryID, prefix, folder+string(rune(filepath.Separator+1))).
+		Find(&items).Error; err != nil {
+		return false, err
+	}
+	indexed := make(map[string]models.LibraryItem, len(items))
+	for _, item := range items {
+		indexed[item.Path] = item
+	}
+
+	onDisk := 0
+	changed := false
+	walkErr := filepath.WalkDir(folder, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == folder {
+				return filepath.SkipAll // gone entirely: decided by the rows below
+			}
+			return err
+		}
+		if d.IsDir() || !modules.IsSupportedFile(path) {
+			return nil
+		}
+		onDisk++
+		item, ok := indexed[path]
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !ok || item.ModTime == nil || item.Size != info.Size() || item.ModTime.Unix() != info.ModTime().Unix() {
+			changed = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return false, walkErr
+	}
+	return changed || onDisk != len(indexed), nil
+}
+
+// within reports whether path is root or inside it.
+func within(path, root string) bool {
+	path, root = filepath.Clean(path), filepath.Clean(root)
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,185 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aunefyren/autotaggerr/database"
+	"github.com/aunefyren/autotaggerr/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Connect(models.DatabaseConfig{Type: "sqlite", DSN: filepath.Join(t.TempDir(), "t.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	return db
+}
+
+func writeFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// index records a file the way a scan leaves it: at its current size and mtime.
+func index(t *testing.T, db *gorm.DB, libraryID uuid.UUID, path string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := info.ModTime()
+	if err := db.Create(&models.LibraryItem{LibraryID: libraryID, Path: path, Size: info.Size(), ModTime: &modTime}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangesSettlePerFolder(t *testing.T) {
+	root := t.TempDir()
+	lw := &libraryWatch{library: models.Library{Path: root}, settle: time.Minute, pending: map[string]time.Time{}}
+	album := filepath.Join(root, "Artist", "Album")
+
+	lw.touch(filepath.Join(album, "01.flac"), false)
+	lw.touch(filepath.Join(album, "cover.jpg"), false)             // not a scan's business
+	lw.touch(filepath.Join(album, "02.mp3.partial~"), false)       // nor a copy in progress
+	lw.touch(filepath.Join(os.TempDir(), "elsewhere.flac"), false) // nor outside the library
+	if len(lw.pending) != 1 {
+		t.Fatalf("pending = %v, want only the album folder", lw.pending)
+	}
+
+	// A burst keeps the folder waiting: the settle time runs from the last change.
+	start := lw.pending[album]
+	if got := lw.settled(start.Add(30 * time.Second)); got != nil {
+		t.Fatalf("settled after 30s: %v", got)
+	}
+	lw.touch(filepath.Join(album, "02.flac"), false)
+	if got := lw.settled(start.Add(time.Minute)); got != nil {
+		t.Errorf("settled a minute after the first change, with a second one since: %v", got)
+	}
+	if got := lw.settled(time.Now().Add(time.Minute)); !reflect.DeepEqual(got, []string{album}) {
+		t.Errorf("settled = %v, want the album folder", got)
+	}
+	if len(lw.pending) != 0 {
+		t.Error("a settled folder stayed pending")
+	}
+}
+
+func TestNestedFoldersCollapseOntoTheOuterOne(t *testing.T) {
+	got := collapseNested([]string{"/m/B/Album", "/m/A/Album/CD2", "/m/A", "/m/A/Album", "/m/AB"})
+	if want := []string{"/m/A", "/m/AB", "/m/B/Album"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("collapseNested = %v, want %v", got, want)
+	}
+}
+
+// A folder is worth a scan only when it differs from what the index says — which is
+// what keeps the scan's own tag writes from queuing another scan.
+func TestFolderChangedComparesWithTheIndex(t *testing.T) {
+	db := testDB(t)
+	libraryID := uuid.New()
+	album := filepath.Join(t.TempDir(), "Album")
+	first, second := filepath.Join(album, "01.flac"), filepath.Join(album, "02.flac")
+	writeFile(t, first, "one")
+	writeFile(t, second, "two")
+	writeFile(t, filepath.Join(album, "cover.jpg"), "art")
+	index(t, db, libraryID, first)
+
+	check := func(want bool, why string) {
+		t.Helper()
+		if got, err := folderChanged(db, libraryID, album); err != nil || got != want {
+			t.Errorf("%s: changed = %v (err %v), want %v", why, got, err, want)
+		}
+	}
+	check(true, "a file the index has not seen")
+
+	index(t, db, libraryID, second)
+	check(false, "every file indexed as it is")
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(second, later, later); err != nil {
+		t.Fatal(err)
+	}
+	check(true, "a file rewritten since it was indexed")
+
+	if err := os.RemoveAll(album); err != nil {
+		t.Fatal(err)
+	}
+	check(true, "a folder deleted with its files still indexed")
+}
+
+func TestPollReportsWhatChangedBetweenReads(t *testing.T) {
+	root := t.TempDir()
+	kept, rewritten, removed := filepath.Join(root, "a.flac"), filepath.Join(root, "b.flac"), filepath.Join(root, "c.flac")
+	for _, path := range []string{kept, rewritten, removed} {
+		writeFile(t, path, "x")
+	}
+	before := snapshot(root)
+
+	writeFile(t, rewritten, "xx")
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(root, "d.flac")
+	writeFile(t, added, "x")
+
+	got := map[string]bool{}
+	for _, path := range diffSnapshots(before, snapshot(root)) {
+		got[path] = true
+	}
+	if want := map[string]bool{rewritten: true, removed: true, added: true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed = %v, want %v", got, want)
+	}
+	if snapshot(filepath.Join(root, "unmounted")) != nil {
+		t.Error("an unreadable root read as an empty library")
+	}
+}
+
+// The whole path: a watched library, an album copied in, and one scan of its folder
+// once it settles — and none for a library that has not opted in.
+func TestWatcherQueuesAScanOfAnImportedFolder(t *testing.T) {
+	db := testDB(t)
+	root := t.TempDir()
+	queued := make(chan []string, 4)
+	w := NewWatcher(db, func(_ models.Library, folders []string) { queued <- folders })
+	w.settle, w.pollInterval = 100*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(w.Stop)
+
+	library := models.Library{Name: "Music", Path: root, Enabled: true, Watch: true}
+	library.ID = uuid.New()
+	w.Reload(library)
+	if w.Mode(library.ID) == "" {
+		t.Fatal("the library is not being watched")
+	}
+
+	album := filepath.Join(root, "Artist", "Album")
+	if err := os.MkdirAll(album, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // let a poll take its baseline, or inotify watch the new folder
+	writeFile(t, filepath.Join(album, "01.flac"), "audio")
+
+	select {
+	case folders := <-queued:
+		if len(folders) != 1 || !within(filepath.Join(album, "01.flac"), folders[0]) {
+			t.Errorf("queued %v, want the folder the album landed in", folders)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no scan was queued (%s)", w.Mode(library.ID))
+	}
+
+	library.Watch = false
+	w.Reload(library)
+	if w.Mode(library.ID) != "" {
+		t.Error("a library that opted out is still watched")
+	}
+}
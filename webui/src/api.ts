@@ -69,6 +69,35 @@ export const api = {
   del: (path: string) => request<void>("DELETE", path),
 };
 
+/**
+ * Saves what an endpoint answers as a file. A plain link cannot carry the bearer token,
+ * so the body is fetched like any request and handed to the browser as a blob, under
+ * the name the server gave it.
+ */
+export async function download(path: string, fallbackName: string): Promise<void> {
+  const headers: Record<string, string> = {};
+  const token = getToken();
+  if (token) headers["Authorization"] = `Bearer ${token}`;
+  const res = await fetch(`/api/v1${path}`, { headers });
+  if (!res.ok) {
+    let message = res.statusText;
+    try {
+      const j = await res.json();
+      if (j && typeof j.error === "string") message = j.error;
+    } catch {
+      /* non-JSON error body */
+    }
+    throw new ApiError(res.status, message);
+  }
+  const named = /filename="([^"]+)"/.exec(res.headers.get("Content-Disposition") ?? "");
+  const url = URL.createObjectURL(await res.blob());
+  const a = document.createElement("a");
+  a.href = url;
+  a.download = named?.[1] ?? fallbackName;
+  a.click();
+  URL.revokeObjectURL(url);
+}
+
 export function errMsg(e: unknown): string {
   return e instanceof Error ? e.message : String(e);
 }
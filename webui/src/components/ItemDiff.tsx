@@ -1,13 +1,51 @@
-import { api } from "../api";
+import { api, errMsg } from "../api";
 import { useFetch } from "../hooks";
-import { ItemTags, LibraryItem } from "../types";
+import { useToast } from "../toast";
+import { useState } from "react";
+import { ItemTags, LibraryItem, TagPolicy } from "../types";
 import { Modal, StatusPill } from "./ui";
 
+// What a kept row says about why it is kept.
+const POLICY_NOTES: Record<TagPolicy, string> = {
+  overwrite: "",
+  fill_empty: "kept — filled only if empty",
+  never: "kept — never touched",
+  remove: "removed",
+};
+
 // ItemDiffModal is the signature view: one monospace row per tag, showing the
 // current on-disk value vs what Autotaggerr would write (git-style old → new).
 export function ItemDiffModal({ item, onClose }: { item: LibraryItem; onClose: () => void }) {
-  const { data, err, loading } = useFetch<ItemTags>(() => api.get(`/library-items/${item.id}/tags`), [item.id]);
+  const { data, err, loading, reload } = useFetch<ItemTags>(() => api.get(`/library-items/${item.id}/tags`), [item.id]);
   const changed = data?.tags.filter((t) => t.changed).length ?? 0;
+  const toast = useToast();
+  const lastWrite = data?.last_write;
+  const [locked, setLocked] = useState<string[] | null>(null);
+  const locks = locked ?? data?.item.locked_fields ?? item.locked_fields ?? [];
+
+  // Locks or unlocks one tag of this file. The row's diff is recomputed, since a lock
+  // is exactly what turns a change into a kept value.
+  const toggleLock = async (key: string) => {
+    const upper = key.toUpperCase();
+    const fields = locks.includes(upper) ? locks.filter((f) => f !== upper) : [...locks, upper];
+    try {
+      const saved = await api.put<LibraryItem>(`/library-items/${item.id}/locks`, { fields });
+      setLocked(saved.locked_fields ?? []);
+      reload();
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
+
+  // Steps the file back one journaled write; pressed again, it goes one further.
+  const rollback = async () => {
+    try {
+      await api.post(`/library-items/${item.id}/rollback`);
+      toast("info", "Rollback queued");
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
 
   return (
     <Modal title="File tags" onClose={onClose} wide>
@@ -18,6 +56,16 @@ export function ItemDiffModal({ item, onClose }: { item: LibraryItem; onClose: (
           <span className="dim" style={{ fontSize: 11 }}>
             {changed > 0 ? `${changed} tag${changed > 1 ? "s" : ""} would change` : "all tags up to date"}
           </span>
+          {lastWrite && (
+            <button
+              className="btn btn-sm"
+              style={{ marginLeft: "auto" }}
+              onClick={rollback}
+              title={`Puts back ${lastWrite.changes.map((c) => c.field).join(", ")} as they were before this write`}
+            >
+              Roll back the write of {new Date(lastWrite.created_at).toLocaleString()}
+            </button>
+          )}
         </div>
       </div>
 
@@ -28,7 +76,17 @@ export function ItemDiffModal({ item, onClose }: { item: LibraryItem; onClose: (
         <div className="scroll diff">
           {data.tags.map((t) => (
             <div className="diffrow" key={t.key}>
-              <span className="diffkey">{t.key}</span>
+              <span className="diffkey">
+                <button
+                  className="btn btn-ghost btn-sm"
+                  style={{ padding: "0 4px", marginRight: 4 }}
+                  onClick={() => toggleLock(t.key)}
+                  title={locks.includes(t.key.toUpperCase()) ? "Unlock: let writes change this tag again" : "Lock: no write changes this tag of this file"}
+                >
+                  {locks.includes(t.key.toUpperCase()) ? "🔒" : "🔓"}
+                </button>
+                {t.key}
+              </span>
               <div className="diffvals">
                 {t.changed ? (
                   <>
@@ -38,6 +96,9 @@ export function ItemDiffModal({ item, onClose }: { item: LibraryItem; onClose: (
                 ) : (
                   <span className="diffv same">{t.current || t.desired || "—"}</span>
                 )}
+                {t.policy && !t.changed && (
+                  <span className="dim" style={{ fontSize: 11 }}>{t.locked ? "locked" : POLICY_NOTES[t.policy]}</span>
+                )}
               </div>
             </div>
           ))}
@@ -21,6 +21,7 @@ import { ChoiceDialog } from "./ui";
 export function RefreshMetadataDialog({
   entities,
   artist,
+  album,
   busy,
   onRefresh,
   onForce,
@@ -40,6 +41,12 @@ export function RefreshMetadataDialog({
    * describe them in the same sentence.
    */
   artist?: string;
+  /**
+   * The album this pass covers, when it is scoped to one release-group. Narrower than
+   * an artist, and said so: the pass reads the album's edition list and the editions
+   * held of it, not the artist's discography.
+   */
+  album?: string;
   busy?: boolean;
   /** The routine reading: re-read only what has expired. */
   onRefresh: () => void;
@@ -57,11 +64,12 @@ export function RefreshMetadataDialog({
         ? "a few minutes"
         : "";
 
-  const scoped = Boolean(artist);
+  const scoped = Boolean(artist || album);
+  const name = album ?? artist;
 
   return (
     <ChoiceDialog
-      title={artist ? `Refresh metadata for ${artist}` : "Refresh metadata"}
+      title={name ? `Refresh metadata for ${name}` : "Refresh metadata"}
       primaryLabel="Refresh"
       alternateLabel="Ignore cache and refresh"
       busy={busy}
@@ -72,7 +80,9 @@ export function RefreshMetadataDialog({
         <>
           <p>
             <strong>Refresh</strong> re-reads only what has expired
-            {scoped
+            {album
+              ? " — this album, its editions and the ones you hold."
+              : scoped
               ? " — this artist, their discography, the editions of each album and the releases you hold."
               : " across the artists, release-groups and releases the collection refers to."}{" "}
             This is what the schedule does, and it is usually all you need.
@@ -80,7 +90,9 @@ export function RefreshMetadataDialog({
           <p>
             <strong>Ignore cache and refresh</strong> re-reads every one of them, however
             recently it was checked — <strong>one rate-limited request each</strong>
-            {scoped ? (
+            {album ? (
+              ", so seconds for one album"
+            ) : scoped ? (
               ", so a few minutes for one artist"
             ) : entities ? (
               <>
@@ -90,7 +102,7 @@ export function RefreshMetadataDialog({
               ", so hours on a large collection"
             )}
             . That is how merges and deletions upstream are found
-            {scoped ? " for this artist" : ""}.
+            {album ? " for this album" : scoped ? " for this artist" : ""}.
           </p>
           <p>
             <strong>Reads only: no files are written.</strong> Anything that changed upstream is
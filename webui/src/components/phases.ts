@@ -14,10 +14,12 @@ export const PHASE_LABELS: Record<string, string> = {
   counting: "Counting files",
   refresh: "Refreshing metadata",
   scanning: "Scanning files",
+  album_gain: "Settling album gain",
   drift: "Re-tagging changed releases",
   plex: "Refreshing Plex",
   migrations: "Applying identity changes",
   collection: "Updating the collection",
+  quiet_hours: "Paused for quiet hours",
   // metadata-pass phases
   artists: "Artists",
   discographies: "Discographies",
@@ -39,7 +41,7 @@ export const PHASE_LABELS: Record<string, string> = {
  *
  * A metadata pass counts **entities**, and every one of its phases advances them, so
  * all four are here. `paused` is too: a yielded pass has not moved, but its counters
- * still describe it truthfully.
+ * still describe it truthfully — and so is `quiet_hours`, a walk waiting between files.
  */
 const PHASES_DRIVING_PROGRESS = new Set([
   "scanning",
@@ -48,6 +50,7 @@ const PHASES_DRIVING_PROGRESS = new Set([
   "editions",
   "releases",
   "paused",
+  "quiet_hours",
 ]);
 
 /**
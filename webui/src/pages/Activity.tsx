@@ -1,8 +1,8 @@
 import { useEffect, useState } from "react";
 import { Link } from "react-router-dom";
-import { api, errMsg } from "../api";
+import { api, download, errMsg } from "../api";
 import { useDebounced, useFetch } from "../hooks";
-import { EntityRef, Event, EventItem, EventStat, EventsPage, JobView, MBFilesPage, ScanStatus } from "../types";
+import { EntityRef, Event, EventItem, EventStat, EventsPage, JobView, MBFilesPage, ScanStatus, TagChangeCount } from "../types";
 import { EmptyState, ErrorNote, IdChip, Modal, Pill } from "../components/ui";
 import { ProgressBar } from "../components/ProgressBar";
 import { PHASE_LABELS, phaseDrivesProgress } from "../components/phases";
@@ -17,6 +17,12 @@ const TYPE_LABELS: Record<string, string> = {
   count_files: "Counting files",
   mb_mirror: "Metadata refresh",
   artwork_refresh: "Artwork refresh",
+  duplicates: "Duplicates",
+  rename: "Rename files",
+  import: "Import",
+  rollback: "Rollback",
+  dry_run: "Dry run",
+  quiet_hours: "Quiet hours",
   // Every pass that writes tags, whether a user pressed Tag files or a run reached its
   // tagging stage. One name, because it is one kind of work — the row says which run it
   // came from, which is the part that actually differs.
@@ -62,6 +68,12 @@ const TYPE_NOTES: Record<string, string> = {
     "Mirrors the manager's catalogue over the collection. It runs after the collection scan on purpose: the mirror only covers artists the collection already knows about, including any this run just discovered. Artists Lidarr did not list are reported rather than assumed away — their wanted view has nothing behind it until they are matched or detached.",
   plex_refresh:
     "Tells Plex to re-read the albums this run touched. One event per run rather than per album, which would flood the feed — the albums themselves are listed below.",
+  dry_run:
+    "What a run would write, worked out and not written. Every file is correlated and diffed against the tags it would be given; no file, index row or journal entry is touched, Plex is not told, and none of a run's other stages run. Covers are not compared, and replay gain only where it was measured before.",
+  quiet_hours:
+    "Scheduled work held back by quiet hours: a job deferred until the window ends, or a scheduled run paused between files until it does. Work you start yourself is never held.",
+  rollback:
+    "Tag writes put back as they were, from the undo journal. A field something else has changed since the write is kept rather than overwritten with an older value, and listed. This activity's own writes are journaled too, so it can be rolled back in turn.",
   tag_files:
     "Everything this pass wrote to disk. The walk finds files whose tags no longer match what Autotaggerr knows; the drift half rewrites files whose release changed upstream, which the walk cannot see because the file itself has not moved.",
 };
@@ -76,6 +88,7 @@ const TYPE_NOTES: Record<string, string> = {
 const ITEM_PHASE_LABELS: Record<string, string> = {
   "": "Files found on disk",
   drift: "Files re-tagged after an upstream change",
+  album_gain: "Files whose album gain changed",
   refresh: "Releases that changed upstream",
 };
 
@@ -90,13 +103,25 @@ const JOB_KIND_LABELS: Record<string, string> = {
   process_all: "Processing",
   process_library: "Processing",
   process_artist: "Processing",
+  process_release_group: "Processing",
+  process_folders: "Processing",
   retag_all: "Tag files",
   retag_library: "Tag files",
   retag_artist: "Tag files",
+  retag_release_group: "Tag files",
+  retag_release: "Tag files",
   refresh_all: "Metadata refresh",
   refresh_verify: "Full metadata refresh",
   refresh_artist: "Metadata refresh",
+  refresh_release_group: "Metadata refresh",
   refresh_library: "Metadata refresh",
+  rename_library: "Rename files",
+  import_library: "Import",
+  rollback_event: "Rollback",
+  rollback_item: "Rollback",
+  dry_run_library: "Dry run",
+  dry_run_artist: "Dry run",
+  dry_run_retag_all: "Dry run",
 };
 
 // isProcessJob distinguishes a file-walking processing run (which reports file
@@ -151,6 +176,10 @@ function durationTitle(ev: Event): string {
 function EventStatus({ status }: { status: string }) {
   if (status === "running") return <Pill kind="scan">Running</Pill>;
   if (status === "error") return <Pill kind="err">Failed</Pill>;
+  if (status === "cancelled") return <Pill kind="off">Stopped</Pill>;
+  // A run the service restarted under, with a checkpoint to carry on from: the next
+  // run of the same scope picks up where it stopped, so it is not a failure.
+  if (status === "resumable") return <Pill kind="warn">Interrupted</Pill>;
   return <Pill kind="ok">Done</Pill>;
 }
 
@@ -235,6 +264,18 @@ export default function Activity() {
     }
   };
 
+  // Reordering and removing take effect at once, so the list is reloaded straight
+  // away. A 404 means the job started (or was removed elsewhere) since the last poll;
+  // the toast says so and the reload shows where it went.
+  const editQueue = (path: string, body: { key: string; to?: number }) => async () => {
+    try {
+      await api.post(path, body);
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+    status.reload();
+  };
+
   const rows = events.data?.events ?? [];
   const paging = usePaging(browse, events.data?.total ?? 0, PAGE_SIZE);
   const filtering = !!(typeFilter || statusFilter || parentFilter || query.trim());
@@ -283,7 +324,16 @@ export default function Activity() {
                 </span>
               )}
             </div>
-            <span className="dim mono" style={{ fontSize: 11 }}>{elapsed(status.data.started_at)}</span>
+            <div className="row" style={{ gap: 10, alignItems: "center" }}>
+              <span className="dim mono" style={{ fontSize: 11 }}>{elapsed(status.data.started_at)}</span>
+              <button
+                className="btn btn-secondary btn-sm"
+                onClick={start("/process/cancel", "Stopping after the current file")}
+                title="Stops at the next file or release. Files being written finish first; the run is recorded as stopped with what it got through, and the next scan picks up the rest."
+              >
+                Stop
+              </button>
+            </div>
           </div>
 
           {/* The counters belong to one stage of the job. In any other stage they are
@@ -325,11 +375,44 @@ export default function Activity() {
       {(status.data?.queue?.length ?? 0) > 0 && (
         <div className="card stack" style={{ gap: 6 }}>
           <div className="eyebrow">Queued ({status.data!.queue!.length})</div>
-          {status.data!.queue!.map((j, i) => (
-            <div key={i} className="row" style={{ gap: 8, alignItems: "center" }}>
+          {/* The queue is kept across restarts, so it is worth tending: a job can be
+              moved ahead of the ones queued before it, or taken out before it starts. */}
+          {status.data!.queue!.map((j, i, queue) => (
+            <div key={j.key} className="row" style={{ gap: 8, alignItems: "center" }}>
               <span className="dim mono" style={{ fontSize: 11, minWidth: 16, textAlign: "right" }}>{i + 1}</span>
               <span style={{ fontSize: 13 }}>{j.title}</span>
               <span className="dim" style={{ fontSize: 11 }}>{JOB_KIND_LABELS[j.kind] ?? j.kind}</span>
+              {/* Only while it is quiet: outside a window a scheduled job is just a job. */}
+              {j.unattended && status.data?.quiet_until && (
+                <span className="dim" style={{ fontSize: 11 }} title="Scheduled work waits for quiet hours to end">
+                  waits for quiet hours · until {new Date(status.data.quiet_until).toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" })}
+                </span>
+              )}
+              <div className="row" style={{ gap: 4, marginLeft: "auto" }}>
+                <button
+                  className="btn btn-ghost btn-sm"
+                  disabled={i === 0}
+                  onClick={editQueue("/process/queue/move", { key: j.key, to: i - 1 })}
+                  title="Run this one job earlier"
+                >
+                  Up
+                </button>
+                <button
+                  className="btn btn-ghost btn-sm"
+                  disabled={i === queue.length - 1}
+                  onClick={editQueue("/process/queue/move", { key: j.key, to: i + 1 })}
+                  title="Run this one job later"
+                >
+                  Down
+                </button>
+                <button
+                  className="btn btn-ghost btn-sm"
+                  onClick={editQueue("/process/queue/remove", { key: j.key })}
+                  title="Take this job out of the queue before it starts"
+                >
+                  Remove
+                </button>
+              </div>
             </div>
           ))}
         </div>
@@ -372,6 +455,20 @@ export default function Activity() {
             title="Only events still in flight"
             onClick={() => browse.setFlag("status", statusFilter === "running" ? null : "running")}
           />
+          <FilterChip
+            on={statusFilter === "cancelled"}
+            count={facet("status", "cancelled")}
+            label="Stopped"
+            title="Only runs that were stopped before they finished"
+            onClick={() => browse.setFlag("status", statusFilter === "cancelled" ? null : "cancelled")}
+          />
+          <FilterChip
+            on={statusFilter === "resumable"}
+            count={facet("status", "resumable")}
+            label="Interrupted"
+            title="Only runs a restart cut short, which the next run of the same scope resumes"
+            onClick={() => browse.setFlag("status", statusFilter === "resumable" ? null : "resumable")}
+          />
           {/* A select rather than ten more chips: the types are a list you pick one
               from, and a row of ten would out-weigh the table it narrows. The counts
               ride the option labels so the choice still states its own result. */}
@@ -743,6 +840,21 @@ function EventDetail({
   // single-event fetch, so opening one loads it.
   const full = useFetch<Event>(() => api.get(`/events/${event.id}`), [event.id]);
   const [filter, setFilter] = useState<string | null>(null);
+  const toast = useToast();
+  const journaled = full.data?.journaled ?? 0;
+
+  // Puts back every write this activity and its stages made that the journal still
+  // holds. Confirmed first: it rewrites files, possibly thousands of them.
+  const rollback = async () => {
+    if (!confirm(`Put the tags of ${journaled} file${journaled === 1 ? "" : "s"} back as they were before this activity wrote them? Fields changed since are kept.`)) return;
+    try {
+      await api.post(`/events/${event.id}/rollback`);
+      toast("info", "Rollback queued");
+      full.reload();
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
 
   // Reset the filter when the modal moves to another event: a chip left active would
   // silently hide most of the activity you just opened.
@@ -754,6 +866,16 @@ function EventDetail({
   const errorFiles = Array.isArray(d?.error_files) ? (d!.error_files as string[]) : [];
   const libraries = Array.isArray(d?.libraries) ? (d!.libraries as string[]) : [];
   const failures = Array.isArray(d?.failures) ? (d!.failures as string[]) : [];
+  const tagSummary = Array.isArray(d?.tag_summary) ? (d!.tag_summary as TagChangeCount[]) : [];
+
+  // A dry run's rows are its product, so they can be taken away whole.
+  const save = async (format: "csv" | "json") => {
+    try {
+      await download(`/events/${event.id}/changes?format=${format}`, `dry-run.${format}`);
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
 
   return (
     <Modal title={event.title || TYPE_LABELS[event.type] || event.type} onClose={onClose} wide>
@@ -776,6 +898,17 @@ function EventDetail({
             </span>
           </button>
         )}
+        {event.type === "dry_run" && (
+          <span className="row" style={{ gap: 6, marginLeft: "auto" }}>
+            <button className="btn btn-sm" onClick={() => save("csv")}>Download CSV</button>
+            <button className="btn btn-sm" onClick={() => save("json")}>Download JSON</button>
+          </span>
+        )}
+        {journaled > 0 && (
+          <button className="btn btn-sm" style={{ marginLeft: "auto" }} onClick={rollback}>
+            Roll back {journaled} file{journaled === 1 ? "" : "s"}
+          </button>
+        )}
       </div>
 
       <div className="stack">
@@ -796,6 +929,21 @@ function EventDetail({
           <div className="dim" style={{ fontSize: 12, maxWidth: "70ch" }}>{TYPE_NOTES[event.type]}</div>
         )}
 
+        {/* Which tags the dry run would change, most files first — the answer to "what
+            would this profile do to my library?" before any one file is opened. */}
+        {tagSummary.length > 0 && (
+          <div>
+            <div className="eyebrow" style={{ marginBottom: 6 }}>Tags that would change</div>
+            <div className="stack" style={{ gap: 2 }}>
+              {tagSummary.map((t) => (
+                <div key={t.field} style={{ fontSize: 12 }}>
+                  <span className="mono">{t.field}</span> changes on {t.files.toLocaleString()} file{t.files === 1 ? "" : "s"}
+                </div>
+              ))}
+            </div>
+          </div>
+        )}
+
         {libraries.length > 0 && (
           <div className="dim" style={{ fontSize: 12 }}>
             Libraries: <span className="mono">{libraries.join(", ")}</span>
@@ -1067,8 +1215,8 @@ function ItemList({
 }
 
 /**
- * One recorded row, in one of three shapes: an entity (a MusicBrainz identifier), an
- * album (a Plex refresh target), or a file.
+ * One recorded row, in one of four shapes: an entity (a MusicBrainz identifier), an
+ * album (a Plex refresh target), a sidecar image, or a file.
  *
  * The split is not cosmetic: a file row reports how many tags were written, and a
  * metadata refresh writes none — "0 tags written" beside a release MBID would be a
@@ -1077,6 +1225,9 @@ function ItemList({
 function ItemRow({ item, open, onToggle }: { item: EventItem; open: boolean; onToggle: () => void }) {
   if (item.kind === "entity") return <EntityItemRow item={item} />;
   if (item.kind === "album") return <AlbumItemRow item={item} />;
+  if (item.kind === "sidecar") return <SidecarItemRow item={item} />;
+  if (item.kind === "duplicate") return <DuplicateItemRow item={item} />;
+  if (item.kind === "move" || item.kind === "import") return <MoveItemRow item={item} />;
 
   const changes = item.changes ?? [];
   // A file with no diff — a failure, or a write the emitter counted without recording
@@ -1142,7 +1293,8 @@ function FileHeading({ item }: { item: EventItem }) {
         <Pill kind="err">Failed</Pill>
       ) : (
         <span className="dim" style={{ fontSize: 11, whiteSpace: "nowrap" }}>
-          {item.tags_written} tag{item.tags_written === 1 ? "" : "s"} written
+          {item.tags_written} tag{item.tags_written === 1 ? "" : "s"}{" "}
+          {item.status === "would_change" ? "would be written" : "written"}
         </span>
       )}
     </>
@@ -1174,6 +1326,98 @@ function AlbumItemRow({ item }: { item: EventItem }) {
   );
 }
 
+// An image the artwork refresh wrote into a library folder. A file, but not audio — the
+// file shape would report "0 tags written" about something that has no tags.
+function SidecarItemRow({ item }: { item: EventItem }) {
+  return (
+    <div className="stack" style={{ gap: 4 }}>
+      <div className="row" style={{ gap: 8, alignItems: "baseline", flexWrap: "wrap" }}>
+        <span
+          className="filepath"
+          style={{ color: item.status === "error" ? "var(--danger-text)" : "var(--text)" }}
+        >
+          {item.path}
+        </span>
+        {item.status === "error" ? <Pill kind="err">Failed</Pill> : <Pill kind="ok">Written</Pill>}
+      </div>
+      {item.error && (
+        <div className="mono" style={{ fontSize: 11, color: "var(--danger-text)", wordBreak: "break-all" }}>
+          {item.error}
+        </div>
+      )}
+    </div>
+  );
+}
+
+// A copy of a duplicate that was not kept. Audio, but nothing wrote tags to it — what
+// the row says is whether the file is still on disk.
+function DuplicateItemRow({ item }: { item: EventItem }) {
+  return (
+    <div className="stack" style={{ gap: 4 }}>
+      <div className="row" style={{ gap: 8, alignItems: "baseline", flexWrap: "wrap" }}>
+        <span
+          className="filepath"
+          style={{ color: item.status === "error" ? "var(--danger-text)" : "var(--text)" }}
+        >
+          {item.path}
+        </span>
+        {item.status === "error" ? (
+          <Pill kind="err">Failed</Pill>
+        ) : item.status === "deleted" ? (
+          <Pill kind="warn">Deleted</Pill>
+        ) : (
+          <Pill kind="off">Detached</Pill>
+        )}
+      </div>
+      {item.error && (
+        <div className="mono" style={{ fontSize: 11, color: "var(--danger-text)", wordBreak: "break-all" }}>
+          {item.error}
+        </div>
+      )}
+    </div>
+  );
+}
+
+// A file a rename moved, or left where it was — or an inbox file an import placed, or
+// could not identify. The row's path is where the file was; its one change is where it
+// went, so the feed can answer "where did this file go" after the fact.
+function MoveItemRow({ item }: { item: EventItem }) {
+  const to = item.changes?.[0]?.new;
+  return (
+    <div className="stack" style={{ gap: 4 }}>
+      <div className="row" style={{ gap: 8, alignItems: "baseline", flexWrap: "wrap" }}>
+        <span
+          className="filepath"
+          style={{ color: item.status === "error" ? "var(--danger-text)" : "var(--text)" }}
+        >
+          {item.path}
+        </span>
+        {item.status === "error" ? (
+          <Pill kind="err">Failed</Pill>
+        ) : item.status === "moved" ? (
+          <Pill kind="ok">Moved</Pill>
+        ) : item.status === "imported" ? (
+          <Pill kind="ok">Imported</Pill>
+        ) : item.status === "unidentified" ? (
+          <Pill kind="warn">Unidentified</Pill>
+        ) : (
+          <Pill kind="off">Skipped</Pill>
+        )}
+      </div>
+      {to && (
+        <div className="filepath dim" style={{ fontSize: 11 }}>
+          → {to}
+        </div>
+      )}
+      {item.error && (
+        <div className="mono" style={{ fontSize: 11, color: item.status === "error" ? "var(--danger-text)" : "var(--text-dim)", wordBreak: "break-all" }}>
+          {item.error}
+        </div>
+      )}
+    </div>
+  );
+}
+
 /**
  * One MusicBrainz identifier and what happened to it.
  *
@@ -338,6 +338,18 @@ export default function Collection() {
         >
           Tag files
         </button>
+        <button
+          className="btn btn-ghost btn-sm"
+          onClick={start("/retag?dry_run=true", "Dry run started — see Activity")}
+          disabled={running || noFiles}
+          title={
+            noFiles
+              ? `Nothing to tag — ${needsProcess}`
+              : "Work out what Tag files would write to every indexed file, and write nothing. The result is a dry run in Activity, with a count per tag."
+          }
+        >
+          Dry run
+        </button>
         <button
           className="btn btn-ghost btn-sm"
           // Same verb as the Metadata page's, so it opens the same dialog rather than
@@ -1,7 +1,7 @@
 import { FormEvent, useState } from "react";
 import { api, errMsg } from "../api";
 import { useFetch } from "../hooks";
-import { DataSource, Library, Manager, TaggerProfile, dataSourceCategory } from "../types";
+import { DataSource, Library, Manager, RenamePreview, TaggerProfile, dataSourceCategory } from "../types";
 import { EmptyState, ErrorNote, Modal, Pill } from "../components/ui";
 import { RecorrelateDialog } from "../components/RecorrelateDialog";
 import { useToast } from "../toast";
@@ -22,6 +22,7 @@ export default function Libraries() {
   const [creating, setCreating] = useState(false);
   const [editing, setEditing] = useState<Library | null>(null);
   const [recorrelating, setRecorrelating] = useState<Library | null>(null);
+  const [renaming, setRenaming] = useState<Library | null>(null);
   const [busy, setBusy] = useState(false);
 
   const options: Options = {
@@ -30,6 +31,11 @@ export default function Libraries() {
     profiles: profiles.data ?? [],
   };
   const managerName = (id: string | null) => (id ? options.managers.find((m) => m.id === id)?.name : undefined);
+  // Renaming is only offered where Autotaggerr owns the layout: under Lidarr the folder
+  // structure is Lidarr's, and the API refuses it too. A library with no manager of its
+  // own falls back to the first configured one.
+  const managerType = (l: Library) =>
+    (l.manager_id ? options.managers.find((m) => m.id === l.manager_id) : options.managers[0])?.type ?? "autotaggerr";
 
   // The same three verbs the artist page offers, aimed at one library. None of
   // them cascades into another: each does what its label says and stops.
@@ -113,9 +119,17 @@ export default function Libraries() {
                   <td style={{ color: "var(--text)" }}>{l.name}</td>
                   <td><span className="path">{l.path}</span></td>
                   <td>{managerName(l.manager_id) ?? <span className="dim">— fallback</span>}</td>
-                  <td>{l.enabled ? <Pill kind="ok">Enabled</Pill> : <Pill kind="off">Disabled</Pill>}</td>
+                  <td>
+                    {l.enabled ? <Pill kind="ok">Enabled</Pill> : <Pill kind="off">Disabled</Pill>}
+                    {l.watch_mode && (
+                      <span className="dim" style={{ fontSize: 11, marginLeft: 6 }} title={l.watch_mode === "poll" ? "Checked every five minutes" : "Changes are processed as they settle"}>
+                        {l.watch_mode === "poll" ? "polled" : "watched"}
+                      </span>
+                    )}
+                  </td>
                   <td className="mono dim" style={{ fontSize: 11 }}>
                     {l.last_scan ? new Date(l.last_scan).toLocaleString() : "never"}
+                    {l.next_run && <div title={l.cron}>next {new Date(l.next_run).toLocaleString()}</div>}
                   </td>
                   <td>
                     <div className="row" style={{ justifyContent: "flex-end" }}>
@@ -126,6 +140,13 @@ export default function Libraries() {
                       >
                         Process
                       </button>
+                      <button
+                        className="btn btn-ghost btn-sm"
+                        onClick={action(l, "process?dry_run=true", "Dry run started")}
+                        title="Walk this library and work out what Process would write to each file, without writing anything. The result is a dry run in Activity, with a count per tag."
+                      >
+                        Dry run
+                      </button>
                       <button
                         className="btn btn-ghost btn-sm"
                         onClick={action(l, "refresh", "Metadata refresh started")}
@@ -148,6 +169,24 @@ export default function Libraries() {
                       >
                         Re-correlate
                       </button>
+                      {l.naming_template && managerType(l) !== "lidarr" && (
+                        <button
+                          className="btn btn-ghost btn-sm"
+                          onClick={() => setRenaming(l)}
+                          title="Move this library's files to where its naming template puts them. Shows every move first; nothing is moved until you confirm."
+                        >
+                          Rename
+                        </button>
+                      )}
+                      {l.inbox_path && managerType(l) !== "lidarr" && (
+                        <button
+                          className="btn btn-ghost btn-sm"
+                          onClick={action(l, "import", "Import started")}
+                          title="Identify the files in this library's inbox and move (or copy) them into it by its naming template. Files nothing can identify stay in the inbox and wait on the Items page as unmatched."
+                        >
+                          Import
+                        </button>
+                      )}
                       <button className="btn btn-ghost btn-sm" onClick={() => setEditing(l)}>Edit</button>
                       <button className="btn btn-ghost btn-sm" onClick={() => toggle(l)}>{l.enabled ? "Disable" : "Enable"}</button>
                       <button className="btn btn-ghost btn-sm" onClick={() => remove(l)} style={{ color: "var(--danger-text)" }}>Remove</button>
@@ -175,6 +214,8 @@ export default function Libraries() {
         />
       )}
 
+      {renaming && <RenameDialog library={renaming} onClose={() => setRenaming(null)} />}
+
       {creating && (
         <LibraryForm
           options={options}
@@ -204,14 +245,30 @@ function LibraryForm({ initial, options, onClose, onSaved }: { initial?: Library
   const [dataSourceId, setDataSourceId] = useState(initial?.data_source_id ?? "");
   const [taggerProfileId, setTaggerProfileId] = useState(initial?.tagger_profile_id ?? "");
   const [useAcoustID, setUseAcoustID] = useState(initial?.use_acoustid ?? false);
+  const [writeSidecars, setWriteSidecars] = useState(initial?.write_artwork_sidecars ?? false);
+  const [watch, setWatch] = useState(initial?.watch ?? false);
+  const [workers, setWorkers] = useState(String(initial?.process_concurrency ?? 0));
+  const [template, setTemplate] = useState(initial?.naming_template ?? "");
+  const [inboxPath, setInboxPath] = useState(initial?.inbox_path ?? "");
+  const [importMode, setImportMode] = useState(initial?.import_mode || "move");
   const [busy, setBusy] = useState(false);
 
   const submit = async (e: FormEvent) => {
     e.preventDefault();
     setBusy(true);
     try {
-      const body: Record<string, unknown> = { name, path, use_acoustid: useAcoustID };
-      if (editing) body.cron = cron;
+      const body: Record<string, unknown> = {
+        name,
+        path,
+        use_acoustid: useAcoustID,
+        write_artwork_sidecars: writeSidecars,
+        watch,
+        process_concurrency: Number(workers) || 0,
+        naming_template: template,
+        inbox_path: inboxPath,
+        import_mode: importMode,
+      };
+      if (editing || cron) body.cron = cron;
       // Only send an ID when one is chosen; "None" leaves the field unset.
       if (managerId) body.manager_id = managerId;
       if (dataSourceId) body.data_source_id = dataSourceId;
@@ -285,13 +342,78 @@ function LibraryForm({ initial, options, onClose, onSaved }: { initial?: Library
           data source and fpcalc on the server; it only ever suggests, never tags on its own.
         </span>
 
-        {editing && (
+        <label className="row" style={{ gap: 8, cursor: "pointer" }}>
+          <input type="checkbox" checked={writeSidecars} onChange={(e) => setWriteSidecars(e.target.checked)} />
+          <span style={{ fontSize: 12 }}>Write artwork files into the library folders</span>
+        </label>
+        <span className="dim" style={{ fontSize: 11, marginTop: -6 }}>
+          Puts cover.jpg in album folders and artist.jpg / fanart.jpg in artist folders for Plex,
+          Jellyfin and Navidrome. Never replaces an image that was already there or that you changed.
+        </span>
+
+        <label className="row" style={{ gap: 8, cursor: "pointer" }}>
+          <input type="checkbox" checked={watch} onChange={(e) => setWatch(e.target.checked)} />
+          <span style={{ fontSize: 12 }}>Process new and changed files as they arrive</span>
+        </label>
+        <span className="dim" style={{ fontSize: 11, marginTop: -6 }}>
+          Watches the folder and processes an album once it has been quiet for half a minute.
+          Network shares are checked every five minutes instead, since they do not report changes.
+        </span>
+
+        <div className="field">
+          <label className="flabel">Files in parallel</label>
+          <input className="input" type="number" min={0} max={64} value={workers} onChange={(e) => setWorkers(e.target.value)} />
+          <span className="dim" style={{ fontSize: 11 }}>
+            How many of this library's files are processed at once. 0 uses the setting in Settings;
+            lower it for a library on spinning disks, raise it for one on an SSD.
+          </span>
+        </div>
+
+        {options.managers.find((m) => m.id === managerId)?.type !== "lidarr" && (
+          <div className="field">
+            <label className="flabel">Naming template</label>
+            <input
+              className="input mono"
+              value={template}
+              onChange={(e) => setTemplate(e.target.value)}
+              placeholder="{albumartist}/{album} ({originalyear})/{disc:02}-{track:02} {title}"
+            />
+            <span className="dim" style={{ fontSize: 11 }}>
+              Where Rename puts each file, relative to the folder above, from the tags Autotaggerr
+              writes. Pad a number with {"{track:02}"}. Leave empty to never rename. Not offered under
+              Lidarr, which lays out its own folders.
+            </span>
+          </div>
+        )}
+
+        {options.managers.find((m) => m.id === managerId)?.type !== "lidarr" && (
           <div className="field">
-            <label className="flabel">Processing schedule (cron)</label>
-            <input className="input mono" value={cron} onChange={(e) => setCron(e.target.value)} placeholder="0 0 18 * * 7" />
+            <label className="flabel">Inbox folder</label>
+            <div className="row" style={{ gap: 8 }}>
+              <input className="input mono" style={{ flex: 1 }} value={inboxPath} onChange={(e) => setInboxPath(e.target.value)} placeholder="/downloads/music" />
+              <select className="select" style={{ width: "auto" }} value={importMode} onChange={(e) => setImportMode(e.target.value as Library["import_mode"])}>
+                <option value="move">Move</option>
+                <option value="copy">Copy</option>
+              </select>
+            </div>
+            <span className="dim" style={{ fontSize: 11 }}>
+              Files dropped here are identified and placed in the library by the naming template (or
+              the default one) when you press Import, and before each scheduled run. Copy leaves the
+              inbox as it was, for a folder a download client is still seeding from. Leave empty for
+              no inbox.
+            </span>
           </div>
         )}
 
+        <div className="field">
+          <label className="flabel">Processing schedule (cron)</label>
+          <input className="input mono" value={cron} onChange={(e) => setCron(e.target.value)} placeholder="0 0 18 * * 7" />
+          <span className="dim" style={{ fontSize: 11 }}>
+            Six fields, starting with seconds. Scans this library on its own, on top of the scan
+            schedule in Settings; leave empty for that one only.
+          </span>
+        </div>
+
         <div className="modal-actions">
           <button type="button" className="btn btn-ghost btn-sm" onClick={onClose}>Cancel</button>
           <button className="btn btn-primary btn-sm" disabled={busy || !name || !path}>
@@ -302,3 +424,61 @@ function LibraryForm({ initial, options, onClose, onSaved }: { initial?: Library
     </Modal>
   );
 }
+
+// The rename preview and its confirmation in one: every file that would move, old path
+// over new, and every one that would stay with why. Applying queues the job; the moves
+// themselves are recorded on its Activity event.
+function RenameDialog({ library, onClose }: { library: Library; onClose: () => void }) {
+  const toast = useToast();
+  const preview = useFetch<RenamePreview>(() => api.get(`/libraries/${library.id}/rename`), [library.id]);
+  const [busy, setBusy] = useState(false);
+  const moves = preview.data?.plan.moves ?? [];
+
+  const apply = async () => {
+    setBusy(true);
+    try {
+      await api.post(`/libraries/${library.id}/rename`);
+      toast("info", `Rename started for ${library.name} — see Activity`);
+      onClose();
+    } catch (e) {
+      toast("err", errMsg(e));
+      setBusy(false);
+    }
+  };
+
+  return (
+    <Modal title={`Rename files in ${library.name}`} onClose={onClose} wide>
+      <div className="stack">
+        <span className="mono dim" style={{ fontSize: 11 }}>{library.naming_template}</span>
+        {preview.err && <ErrorNote message={preview.err} />}
+        {preview.loading && <span className="dim">Working out where each file goes…</span>}
+        {preview.data && (
+          <>
+            <span style={{ fontSize: 12 }}>
+              {preview.data.moving} to move · {moves.length - preview.data.moving} staying put ·{" "}
+              {preview.data.plan.unchanged} already in place
+            </span>
+            <div className="stack" style={{ gap: 6 }}>
+              {moves.map((m) => (
+                <div key={m.item_id} className="stack" style={{ gap: 2 }}>
+                  <span className="filepath" style={{ fontSize: 11 }}>{m.from}</span>
+                  {m.skip ? (
+                    <span className="dim" style={{ fontSize: 11 }}>stays — {m.skip}</span>
+                  ) : (
+                    <span className="filepath" style={{ fontSize: 11, color: "var(--accent-text)" }}>→ {m.to}</span>
+                  )}
+                </div>
+              ))}
+            </div>
+          </>
+        )}
+        <div className="modal-actions">
+          <button type="button" className="btn btn-ghost btn-sm" onClick={onClose}>Cancel</button>
+          <button className="btn btn-primary btn-sm" disabled={busy || !preview.data || preview.data.moving === 0} onClick={apply}>
+            {busy ? "Starting…" : `Move ${preview.data?.moving ?? 0} files`}
+          </button>
+        </div>
+      </div>
+    </Modal>
+  );
+}
@@ -12,6 +12,8 @@ import {
 } from "../types";
 import { ErrorNote, Pill } from "../components/ui";
 import { RecorrelateDialog } from "../components/RecorrelateDialog";
+import { RefreshMetadataDialog } from "../components/RefreshMetadataDialog";
+import { RunBar } from "../components/RunBar";
 import { MBLink } from "../components/MBLink";
 import { mediaSummary } from "../components/mediaSummary";
 import { useToast } from "../toast";
@@ -52,6 +54,7 @@ export default function ReleaseGroup() {
 
   const [busy, setBusy] = useState(false);
   const [recorrelateAsk, setRecorrelateAsk] = useState(false);
+  const [choosingRefresh, setChoosingRefresh] = useState(false);
   const browse = useBrowse("date", "asc");
 
   // Re-correlate queues on the shared job runner, so the global status is what says
@@ -124,6 +127,7 @@ export default function ReleaseGroup() {
     earliest(editions)?.id ||
     editions[0]?.id ||
     null;
+  const selectedEdition = editions.find((e) => e.id === detailRelease);
 
   /**
    * Records a want. Widening back to "any edition" and narrowing to a specific one
@@ -169,6 +173,26 @@ export default function ReleaseGroup() {
     }
   };
 
+  // The artist page's verbs, one level down. Each queues and reports under a single
+  // Activity event, so fixing one album is no longer a pass over the whole artist.
+  const action = (path: string, started: string) => async () => {
+    try {
+      await api.post(path);
+      toast("info", started);
+      setTimeout(() => status.reload(), 300);
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
+
+  const startRefresh = (force: boolean) => async () => {
+    setChoosingRefresh(false);
+    await action(
+      `/release-groups/${rgid}/refresh${force ? "?force=true" : ""}`,
+      force ? "Full metadata refresh started — cached copies ignored" : "Metadata refresh started",
+    )();
+  };
+
   const drop = async (releaseMbid: string) => {
     setBusy(true);
     try {
@@ -315,6 +339,59 @@ export default function ReleaseGroup() {
         </div>
       </div>
 
+      {/* Fixing one album is the common case, and it used to mean the artist's verbs —
+          a pass over the whole discography for the one album somebody was looking at.
+          Same three verbs, same order as the artist page; Re-correlate stays in the
+          header as the repair it is. Tag this edition narrows Tag files to the edition
+          open below, for an album held in two pressings where only one is wrong. */}
+      {rg?.owned && (
+        <RunBar status={status.data} idle="Idle">
+          <button
+            className="btn btn-ghost btn-sm"
+            disabled={running}
+            title="Rewrite the tags of this album's indexed files from the metadata already known. Writes tags. No disk walk, no MusicBrainz lookups."
+            onClick={action(`/release-groups/${rgid}/retag`, "Tagging started")}
+          >
+            Tag files
+          </button>
+          {selectedEdition?.owned && editions.filter((e) => e.owned).length > 1 && (
+            <button
+              className="btn btn-ghost btn-sm"
+              disabled={running}
+              title={`Rewrite the tags of the files of the ${selectedEdition.title} edition only. Writes tags.`}
+              onClick={action(`/releases/${selectedEdition.id}/retag`, "Tagging started")}
+            >
+              Tag this edition
+            </button>
+          )}
+          <button
+            className="btn btn-ghost btn-sm"
+            disabled={running}
+            title="Re-read this album from MusicBrainz — its editions and the releases you hold. Reads only: no files are written. If anything changed upstream it is reported, and Tag files (or the next Process) applies it."
+            onClick={() => setChoosingRefresh(true)}
+          >
+            Refresh metadata
+          </button>
+          <button
+            className="btn btn-primary btn-sm"
+            disabled={running}
+            title="Walk this album's folders, resolve their metadata and write tags — the full pipeline, narrowed to this album. Writes tags."
+            onClick={action(`/release-groups/${rgid}/process`, "Processing started")}
+          >
+            Process
+          </button>
+        </RunBar>
+      )}
+
+      {choosingRefresh && (
+        <RefreshMetadataDialog
+          album={rg?.title ?? "this album"}
+          onCancel={() => setChoosingRefresh(false)}
+          onRefresh={startRefresh(false)}
+          onForce={startRefresh(true)}
+        />
+      )}
+
       {recorrelateAsk && (
         <RecorrelateDialog
           scope={rg ? rg.title : "this album"}
@@ -1,7 +1,7 @@
 import { FormEvent, useState } from "react";
 import { api, errMsg } from "../api";
 import { useFetch } from "../hooks";
-import { TaggerProfile } from "../types";
+import { TagPolicy, TaggerProfile } from "../types";
 import { EmptyState, ErrorNote, Modal, Pill } from "../components/ui";
 import { useToast } from "../toast";
 
@@ -10,6 +10,17 @@ export default function TaggerProfiles() {
   const [editing, setEditing] = useState<TaggerProfile | null>(null);
   const toast = useToast();
 
+  // Tag files, dry, as though every library used this profile: what switching to it
+  // would write, before any library is switched.
+  const tryProfile = (p: TaggerProfile) => async () => {
+    try {
+      await api.post(`/retag?dry_run=true&tagger_profile_id=${p.id}`);
+      toast("info", `Dry run with ${p.name} started — see Activity`);
+    } catch (e) {
+      toast("err", errMsg(e));
+    }
+  };
+
   return (
     <div className="stack">
       <div className="page-head">
@@ -39,6 +50,13 @@ export default function TaggerProfiles() {
                   </td>
                   <td>
                     <div className="row" style={{ justifyContent: "flex-end" }}>
+                      <button
+                        className="btn btn-ghost btn-sm"
+                        onClick={tryProfile(p)}
+                        title="Work out what Tag files would write to every indexed file if the libraries used this profile, and write nothing. The result is a dry run in Activity, with a count per tag."
+                      >
+                        Dry run
+                      </button>
                       <button className="btn btn-secondary btn-sm" onClick={() => setEditing(p)}>Edit</button>
                     </div>
                   </td>
@@ -88,6 +106,18 @@ function EditProfile({ profile, onClose, onSaved }: { profile: TaggerProfile; on
         custom_artist_delimiter: p.custom_artist_delimiter,
         max_genres: p.max_genres,
         mp3_multi_value_tags: p.mp3_multi_value_tags,
+        embed_cover_art: p.embed_cover_art,
+        cover_art_max_size: p.cover_art_max_size,
+        cover_art_max_bytes: p.cover_art_max_bytes,
+        write_performer_credits: p.write_performer_credits,
+        write_producer_credits: p.write_producer_credits,
+        write_engineer_credits: p.write_engineer_credits,
+        write_mixer_credits: p.write_mixer_credits,
+        write_arranger_credits: p.write_arranger_credits,
+        locale: p.locale,
+        prefer_transliterated_titles: p.prefer_transliterated_titles,
+        write_replay_gain: p.write_replay_gain,
+        tag_policies: p.tag_policies ?? {},
       });
       onSaved();
     } catch (e) {
@@ -140,6 +170,82 @@ function EditProfile({ profile, onClose, onSaved }: { profile: TaggerProfile; on
             off if Plex is your player. FLAC always uses the multi-value form; it costs nothing there.
           </p>
         </div>
+        <div className="field">
+          <Check
+            label="Embed the front cover in FLAC and MP3 files"
+            checked={p.embed_cover_art}
+            onChange={(v) => set({ embed_cover_art: v })}
+          />
+          <p className="muted" style={{ margin: "4px 0 0", fontSize: 12 }}>
+            For players that never see the folder's artwork — car stereos, phones. Comes from the Cover Art
+            Archive data source; turning it on rewrites every file once.
+          </p>
+        </div>
+        {p.embed_cover_art && (
+          <div className="row" style={{ gap: 12 }}>
+            <div className="field">
+              <label className="flabel">Largest edge (px)</label>
+              <select
+                className="input"
+                value={p.cover_art_max_size || 500}
+                onChange={(e) => set({ cover_art_max_size: Number(e.target.value) })}
+              >
+                <option value={250}>250</option>
+                <option value={500}>500</option>
+                <option value={1200}>1200</option>
+              </select>
+            </div>
+            <div className="field">
+              <label className="flabel">Largest file (KB)</label>
+              <input
+                className="input"
+                type="number"
+                min={16}
+                value={p.cover_art_max_bytes ? Math.round(p.cover_art_max_bytes / 1024) : ""}
+                onChange={(e) => set({ cover_art_max_bytes: Number(e.target.value) * 1024 })}
+                placeholder="1024"
+              />
+            </div>
+          </div>
+        )}
+        <div className="field">
+          <label className="flabel">Name locale</label>
+          <input className="input mono" value={p.locale} onChange={(e) => set({ locale: e.target.value })} placeholder="en, ja-Latn" />
+          <p className="muted" style={{ margin: "4px 0 0", fontSize: 12 }}>
+            Writes each artist under their MusicBrainz alias for this locale. Blank keeps names as the release
+            spells them. The release's own spelling is kept in the *_NATIVE tags.
+          </p>
+        </div>
+        <Check
+          label="Prefer transliterated album and track titles"
+          checked={p.prefer_transliterated_titles}
+          onChange={(v) => set({ prefer_transliterated_titles: v })}
+        />
+        <div className="field">
+          <Check
+            label="Write ReplayGain tags"
+            checked={p.write_replay_gain}
+            onChange={(v) => set({ write_replay_gain: v })}
+          />
+          <p className="muted" style={{ margin: "4px 0 0", fontSize: 12 }}>
+            Measures each track's loudness (ReplayGain 2.0, EBU R128) and writes track and album gain. Album
+            gain waits until every track of the release is in the library. Not M4A yet; the first
+            measurement decodes every file once, later scans reuse it.
+          </p>
+        </div>
+        <div className="field">
+          <label className="flabel">Recording credits</label>
+          <Check label="Performers, by instrument" checked={p.write_performer_credits} onChange={(v) => set({ write_performer_credits: v })} />
+          <Check label="Producers" checked={p.write_producer_credits} onChange={(v) => set({ write_producer_credits: v })} />
+          <Check label="Engineers" checked={p.write_engineer_credits} onChange={(v) => set({ write_engineer_credits: v })} />
+          <Check label="Mixers" checked={p.write_mixer_credits} onChange={(v) => set({ write_mixer_credits: v })} />
+          <Check label="Arrangers" checked={p.write_arranger_credits} onChange={(v) => set({ write_arranger_credits: v })} />
+          <p className="muted" style={{ margin: "4px 0 0", fontSize: 12 }}>
+            From MusicBrainz's recording relationships, written the way Picard writes them. Turning a family
+            on rewrites every file that has the credit once; off leaves whatever the file says alone.
+          </p>
+        </div>
+        <TagPolicies policies={p.tag_policies ?? {}} onChange={(tag_policies) => set({ tag_policies })} />
         <div className="modal-actions">
           <button type="button" className="btn btn-ghost btn-sm" onClick={onClose}>Cancel</button>
           <button className="btn btn-primary btn-sm" disabled={busy || !p.name}>{busy ? "Saving…" : "Save changes"}</button>
@@ -148,3 +254,59 @@ function EditProfile({ profile, onClose, onSaved }: { profile: TaggerProfile; on
     </Modal>
   );
 }
+
+const POLICY_LABELS: Record<TagPolicy, string> = {
+  overwrite: "Always overwrite",
+  fill_empty: "Fill only if empty",
+  never: "Never touch",
+  remove: "Remove",
+};
+
+// The per-tag exceptions to "write everything MusicBrainz says": a row per tag that is
+// not simply overwritten. Choosing "Always overwrite" drops the row on save, since that
+// is what a tag without one gets — except ALBUMSORT, which only fills by default.
+function TagPolicies({ policies, onChange }: { policies: Record<string, TagPolicy>; onChange: (p: Record<string, TagPolicy>) => void }) {
+  const [tag, setTag] = useState("");
+  const add = () => {
+    const key = tag.trim().toUpperCase();
+    if (!key) return;
+    onChange({ ...policies, [key]: policies[key] ?? "never" });
+    setTag("");
+  };
+  const drop = (key: string) => {
+    const next = { ...policies };
+    delete next[key];
+    onChange(next);
+  };
+  return (
+    <div className="field">
+      <label className="flabel">Per-tag policies</label>
+      {Object.keys(policies).sort().map((key) => (
+        <div key={key} className="row" style={{ gap: 8, marginBottom: 4 }}>
+          <span className="mono" style={{ fontSize: 12, flex: 1 }}>{key}</span>
+          <select className="input" value={policies[key]} onChange={(e) => onChange({ ...policies, [key]: e.target.value as TagPolicy })}>
+            {(Object.keys(POLICY_LABELS) as TagPolicy[]).map((v) => (
+              <option key={v} value={v}>{POLICY_LABELS[v]}</option>
+            ))}
+          </select>
+          <button type="button" className="btn btn-ghost btn-sm" onClick={() => drop(key)}>Remove row</button>
+        </div>
+      ))}
+      <div className="row" style={{ gap: 8 }}>
+        <input
+          className="input mono"
+          value={tag}
+          onChange={(e) => setTag(e.target.value)}
+          onKeyDown={(e) => { if (e.key === "Enter") { e.preventDefault(); add(); } }}
+          placeholder="GENRE"
+        />
+        <button type="button" className="btn btn-secondary btn-sm" onClick={add} disabled={!tag.trim()}>Add tag</button>
+      </div>
+      <p className="muted" style={{ margin: "4px 0 0", fontSize: 12 }}>
+        Every other tag is overwritten from MusicBrainz. Tag names are the ones the file-tags view shows. A
+        file can lock its own tags on top of these. Changes apply the next time a file is written — Tag
+        files applies them to everything, and a dry run shows what that would do first.
+      </p>
+    </div>
+  );
+}
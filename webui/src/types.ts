@@ -62,7 +62,23 @@ export interface TaggerProfile {
   custom_artist_delimiter: string;
   max_genres: number;
   mp3_multi_value_tags: boolean;
-}
+  embed_cover_art: boolean;
+  cover_art_max_size: number;
+  cover_art_max_bytes: number;
+  write_performer_credits: boolean;
+  write_producer_credits: boolean;
+  write_engineer_credits: boolean;
+  write_mixer_credits: boolean;
+  write_arranger_credits: boolean;
+  locale: string;
+  prefer_transliterated_titles: boolean;
+  write_replay_gain: boolean;
+  /** Per-tag write policies, by upper-cased tag name; a tag not listed is overwritten. */
+  tag_policies: Record<string, TagPolicy> | null;
+}
+
+/** What a profile does with one tag. */
+export type TagPolicy = "overwrite" | "fill_empty" | "never" | "remove";
 
 export interface Library {
   id: string;
@@ -73,9 +89,41 @@ export interface Library {
   tagger_profile_id: string | null;
   enabled: boolean;
   cron: string;
+  /** When the library's own schedule next scans it; null when it has none or is disabled. */
+  next_run: string | null;
   last_scan: string | null;
   /** Per-library opt-in to audio fingerprint identification. Off by default. */
   use_acoustid: boolean;
+  /** Per-library opt-in to writing cover.jpg / artist.jpg / fanart.jpg into its folders. */
+  write_artwork_sidecars: boolean;
+  /** Per-library opt-in to scanning folders as changes settle in them. */
+  watch: boolean;
+  /** How the library is being watched right now; "" when it is not. */
+  watch_mode: "" | "inotify" | "poll";
+  /** Files this library processes at once; 0 uses the global setting. */
+  process_concurrency: number;
+  /** Where a rename puts each file, e.g. "{albumartist}/{album}/{track:02} {title}"; "" for none. */
+  naming_template: string;
+  /** Folder outside the library that Import reads dropped files from; "" for none. */
+  inbox_path: string;
+  /** "copy" leaves the inbox as it was; "move" (or "") empties it. */
+  import_mode: "" | "move" | "copy";
+}
+
+/** One file in a rename preview: where it is, where it would go, or why it stays. */
+export interface RenameMove {
+  item_id: string;
+  from: string;
+  to?: string;
+  skip?: string;
+}
+
+export interface RenamePreview {
+  library: string;
+  template: string;
+  fields: string[];
+  moving: number;
+  plan: { moves: RenameMove[] | null; unchanged: number };
 }
 
 export interface LibraryItem {
@@ -88,12 +136,18 @@ export interface LibraryItem {
   last_tagged_at: string | null;
   /** A manual attach that automatic resolution must not override. */
   pinned: boolean;
+  /** The item this file was detached in favour of as a duplicate; null when it was not. */
+  duplicate_of_id: string | null;
+  /** When a scan last found the file's tags edited by another tool; null when never. */
+  tags_edited_at: string | null;
   /**
    * False when the file's library is managed by Lidarr: the release, the edition
    * and the track are Lidarr's to decide, so attaching by hand is rejected by the
    * API (409) and the controls are shown disabled rather than offered.
    */
   identity_editable: boolean;
+  /** Tags of this file no write changes, whatever the profile says. */
+  locked_fields: string[] | null;
 }
 
 /** One hit from the MusicBrainz release search used by manual attach. */
@@ -198,8 +252,12 @@ export interface Health {
 
 /** One queued or running background job. */
 export interface JobView {
+  /** The verb and its scope ("retag_library:<id>"); what the queue endpoints take to name a pending job. */
+  key: string;
   kind: string;
   title: string;
+  /** Queued by a schedule or the watcher rather than by somebody; quiet hours hold it back. */
+  unattended?: boolean;
 }
 
 export interface ScanStatus {
@@ -226,6 +284,8 @@ export interface ScanStatus {
    *  means nothing has walked a library yet, which is what those buttons say instead
    *  of running and reporting an honest zero. */
   indexed: number;
+  /** When the current quiet-hours window ends; absent when it is not quiet. */
+  quiet_until?: string;
 }
 
 /**
@@ -295,11 +355,27 @@ export interface TagDiffEntry {
   current: string;
   desired: string;
   changed: boolean;
+  /** The profile's policy for the tag, when it is not a plain overwrite. */
+  policy?: TagPolicy;
+  /** The file's own lock is why the tag is kept. */
+  locked?: boolean;
 }
 
 export interface ItemTags {
   item: LibraryItem;
   tags: TagDiffEntry[];
+  /** The write a rollback of this file would undo; absent when the journal holds none. */
+  last_write?: TagJournalEntry;
+}
+
+/** One file's undo record from a tag write: each changed field's raw values either side. */
+export interface TagJournalEntry {
+  id: string;
+  created_at: string;
+  event_id: string;
+  library_item_id?: string;
+  path: string;
+  changes: { field: string; before: string[] | null; after: string[] | null }[];
 }
 
 /** One field's before/after from a tag write. */
@@ -309,6 +385,12 @@ export interface TagChange {
   new: string;
 }
 
+/** One line of a dry run's per-tag summary: how many files would change the tag. */
+export interface TagChangeCount {
+  field: string;
+  files: number;
+}
+
 /** One file's outcome inside an event: what happened, and exactly what changed. */
 /**
  * One counter an event declares about itself. The emitter says which of its numbers
@@ -349,9 +431,9 @@ export interface EventItem {
   event_id: string;
   /** A file path, the MBID of an entity, or an album title — see `kind`. */
   path: string;
-  /** "" (a file) | "entity" (an MBID) | "album" (a Plex refresh target). */
+  /** "" (a file) | "entity" (an MBID) | "album" (a Plex refresh target) | "sidecar" (an image written into the library) | "duplicate" (a copy not kept). */
   kind?: string;
-  /** "changed" | "error" | "refreshed" | "gone" | "relinked" | "unknown" */
+  /** "changed" | "error" | "refreshed" | "gone" | "relinked" | "unknown" | "detached" | "deleted" */
   status: string;
   /** Which stage of the event produced this row; groups release rows apart from files. */
   phase?: string;
@@ -362,6 +444,19 @@ export interface EventItem {
   related?: EntityRef;
 }
 
+/** One copy in a duplicate group (GET /library-items/duplicates). */
+export interface DuplicateItem extends LibraryItem {
+  library_name: string;
+  content_hash: string;
+  mb_release_track_id: string;
+}
+
+/** Files held more than once: by identical audio, and by the same release track. */
+export interface DuplicateReport {
+  by_audio: { key: string; items: DuplicateItem[] }[];
+  by_track: { key: string; items: DuplicateItem[] }[];
+}
+
 /** One indexed file behind a MusicBrainz identifier (GET /mb/:mbid/files). */
 export interface MBFile {
   path: string;
@@ -411,6 +506,9 @@ export interface Event {
   child_count?: number;
   /** The run this activity came from, set on every row that has one. */
   parent_title?: string;
+  /** Files whose writes by this activity (or its stages) a rollback would put back.
+   *  Only the single-event endpoint fills it in. */
+  journaled?: number;
 }
 
 export interface EventsPage {